@@ -8,7 +8,7 @@
 //
 // Synopsis:
 //
-//	boot [-v][-no-load][-no-exec]
+//	boot [-v][-no-load][-no-exec][-verify off|log|enforce][-uefi-db][-ed25519 keys][-gpg keyring][-pcr n]
 //
 // Description:
 //
@@ -17,6 +17,10 @@
 //	-v prints messages
 //	-no-load prints the boot image paths it was going to load, but doesn't load + exec them
 //	-no-exec loads the boot image, but doesn't exec it
+//	-verify checks the kernel and initrd before loading them, against the
+//	  UEFI db and dbx for Authenticode signed kernels with -uefi-db, or
+//	  against the keys of -ed25519 or -gpg for detached .sig signatures
+//	-pcr measures the kernel and initrd into a TPM PCR before loading them
 //
 // Notes:
 //
@@ -54,6 +58,7 @@ var (
 	reuseCmdlineItem  = flag.String("reuse", "console", "comma separated list of kernel params value to reuse from current kernel (default to console)")
 	appendCmdline     = flag.String("append", "", "Additional kernel params")
 	blockList         = flag.String("block", "", "comma separated list of pci vendor and device ids to ignore (format vendor:device). E.g. 0x8086:0x1234,0x8086:0xabcd")
+	framebuffer       = flag.String("fb", "", "framebuffer device to show the menu on, e.g. /dev/fb0, with input from keyboards (default is the terminal)")
 )
 
 // updateBootCmdline get the kernel command line parameters and filter it:
@@ -67,6 +72,10 @@ func cmdlineModifier(li *boot.LinuxImage) {
 func main() {
 	flag.Parse()
 
+	opts, err := loadOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
 	if *verbose {
 		block.Debug = log.Printf
 	}
@@ -101,9 +110,14 @@ func main() {
 	boot.ApplyLinuxModifiers(images, cmdlineModifier)
 
 	menuEntries := menu.OSImages(*verbose, images...)
+	for _, e := range menuEntries {
+		e.(*menu.OSImageAction).LoadOptions = opts
+	}
 	menuEntries = append(menuEntries, menu.Reboot{})
 	menuEntries = append(menuEntries, menu.StartShell{})
 
+	menu.SetFramebuffer(*framebuffer)
+
 	// Boot does not return.
 	bootcmd.ShowMenuAndBoot(menuEntries, mountPool, *noLoad, *noExec)
 }
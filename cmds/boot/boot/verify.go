@@ -0,0 +1,76 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/secureboot"
+	"github.com/u-root/u-root/pkg/efivarfs"
+)
+
+var (
+	verifyPolicy boot.VerifyPolicy
+
+	uefiDB      = flag.Bool("uefi-db", false, "trust Authenticode signed kernels and UKIs according to the UEFI db and dbx variables; separate initrds are only measured")
+	ed25519Keys = flag.String("ed25519", "", "comma separated PEM ed25519 public keys trusted to sign kernels and initrds, in .sig files next to them")
+	gpgKeyRing  = flag.String("gpg", "", "OpenPGP key ring trusted to sign kernels and initrds, in .sig files next to them")
+	measurePCR  = flag.Int("pcr", -1, "TPM PCR to measure kernels and initrds into before loading them, if there is a TPM (default none)")
+)
+
+func init() {
+	flag.Var(&verifyPolicy, "verify", "verify kernels and initrds before loading them: off, log or enforce")
+}
+
+var errNoVerifiers = errors.New("-verify needs -uefi-db, -ed25519 or -gpg")
+
+// loadOptions returns the options to verify and measure images with.
+func loadOptions() ([]boot.LoadOption, error) {
+	var opts []boot.LoadOption
+	if *measurePCR >= 0 {
+		opts = append(opts, boot.WithMeasurement(secureboot.TPM{PCR: uint32(*measurePCR)}))
+	}
+	if verifyPolicy == boot.VerifyOff {
+		return opts, nil
+	}
+
+	var verifiers []boot.Verifier
+	if *uefiDB {
+		vars, err := efivarfs.New()
+		if err != nil {
+			return nil, err
+		}
+		db, err := secureboot.ReadDatabase(vars, "db")
+		if err != nil {
+			return nil, err
+		}
+		dbx, err := secureboot.ReadDatabase(vars, "dbx")
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, &secureboot.Authenticode{DB: db, DBX: dbx})
+	}
+	if *ed25519Keys != "" {
+		v, err := secureboot.LoadEd25519(strings.Split(*ed25519Keys, ",")...)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, v)
+	}
+	if *gpgKeyRing != "" {
+		v, err := secureboot.LoadGPG(*gpgKeyRing)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, v)
+	}
+	if len(verifiers) == 0 {
+		return nil, errNoVerifiers
+	}
+	return append(opts, boot.WithVerifier(verifyPolicy, verifiers...)), nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot/fit"
+)
+
+var errNoKey = errors.New("no key found")
+
+// fitArch maps GOARCH to FIT architecture names.
+var fitArch = map[string]string{
+	"386":     "x86",
+	"amd64":   "x86_64",
+	"arm":     "arm",
+	"arm64":   "arm64",
+	"riscv64": "riscv",
+}
+
+// list splits a comma separated flag value.
+func list(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// readPEM returns the PEM blocks in file.
+func readPEM(file string) ([]*pem.Block, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("%s: %w", file, errNoKey)
+	}
+	return blocks, nil
+}
+
+// readPrivateKey reads an RSA or ECDSA private key from a PEM file.
+func readPrivateKey(file string) (crypto.Signer, error) {
+	blocks, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	var key any
+	switch blocks[0].Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(blocks[0].Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(blocks[0].Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(blocks[0].Bytes)
+	default:
+		return nil, fmt.Errorf("%s: %w: PEM type %q", file, errNoKey, blocks[0].Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %T", file, errNoKey, key)
+	}
+	return signer, nil
+}
+
+// readPublicKeys reads public keys and certificates from a PEM file.
+func readPublicKeys(file string) ([]crypto.PublicKey, error) {
+	blocks, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	var keys []crypto.PublicKey
+	for _, block := range blocks {
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: %w", file, errNoKey)
+	}
+	return keys, nil
+}
+
+// addr parses an optional load or entry address.
+func addr(s string) (*uint32, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return nil, err
+	}
+	a := uint32(v)
+	return &a, nil
+}
+
+// create assembles a FIT, like mkimage -f auto, with one configuration per
+// device tree, or one without a device tree if there are none.
+func create(args []string) error {
+	fs := flag.NewFlagSet("fitboot create", flag.ContinueOnError)
+	var (
+		out      = fs.String("o", "", "Output FIT file")
+		desc     = fs.String("desc", "", "Description of the FIT")
+		kernel   = fs.String("kernel", "", "Kernel image")
+		initrd   = fs.String("initrd", "", "InitRAMFS -- default none")
+		fdts     = fs.String("fdt", "", "Comma separated device trees, one configuration each")
+		overlays = fs.String("overlay", "", "Comma separated device tree overlays applied in every configuration")
+		arch     = fs.String("arch", fitArch[runtime.GOARCH], "Architecture of the images")
+		load     = fs.String("load", "", "Kernel load address")
+		entry    = fs.String("entry", "", "Kernel entry address")
+		hashes   = fs.String("hash", "sha256", "Comma separated hash algorithms of the images: sha256, sha512, crc32, ...")
+		keyPath  = fs.String("key", "", "PEM RSA or ECDSA private key to sign configurations with")
+		keyName  = fs.String("keyname", "dev", "Key name hint of signatures")
+		sigHash  = fs.String("sighash", "sha256", "Hash of signatures: sha1, sha256, sha384 or sha512")
+		pss      = fs.Bool("pss", false, "Use RSA-PSS padding instead of PKCS #1 v1.5")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || *kernel == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fitboot create -o <file> -kernel <kernel> [flags]")
+	}
+	if *overlays != "" && *fdts == "" {
+		return fmt.Errorf("overlays need a device tree to apply to")
+	}
+
+	loadAddr, err := addr(*load)
+	if err != nil {
+		return fmt.Errorf("load address: %w", err)
+	}
+	entryAddr, err := addr(*entry)
+	if err != nil {
+		return fmt.Errorf("entry address: %w", err)
+	}
+
+	var images []fit.ImageSpec
+	add := func(name, typ, file string) error {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		img := fit.ImageSpec{Name: name, Description: file, Type: typ, Arch: *arch, Data: b, Hashes: list(*hashes)}
+		if typ != "flat_dt" {
+			img.OS = "linux"
+		}
+		images = append(images, img)
+		return nil
+	}
+
+	if err := add("kernel-1", "kernel", *kernel); err != nil {
+		return err
+	}
+	images[0].Load, images[0].Entry = loadAddr, entryAddr
+	config := fit.ConfigSpec{Kernel: "kernel-1"}
+	if *initrd != "" {
+		if err := add("ramdisk-1", "ramdisk", *initrd); err != nil {
+			return err
+		}
+		config.Ramdisk = "ramdisk-1"
+	}
+	var overlayNames []string
+	for i, o := range list(*overlays) {
+		name := fmt.Sprintf("overlay-%d", i+1)
+		if err := add(name, "flat_dt", o); err != nil {
+			return err
+		}
+		overlayNames = append(overlayNames, name)
+	}
+
+	if *keyPath != "" {
+		key, err := readPrivateKey(*keyPath)
+		if err != nil {
+			return err
+		}
+		h, ok := map[string]crypto.Hash{
+			"sha1":   crypto.SHA1,
+			"sha256": crypto.SHA256,
+			"sha384": crypto.SHA384,
+			"sha512": crypto.SHA512,
+		}[*sigHash]
+		if !ok {
+			return fmt.Errorf("unsupported signature hash %q", *sigHash)
+		}
+		config.Keys = []fit.SigningKey{{Name: *keyName, Signer: key, Hash: h, PSS: *pss}}
+	}
+
+	var configs []fit.ConfigSpec
+	for i, f := range list(*fdts) {
+		name := fmt.Sprintf("fdt-%d", i+1)
+		if err := add(name, "flat_dt", f); err != nil {
+			return err
+		}
+		c := config
+		c.Name, c.Description = fmt.Sprintf("conf-%d", i+1), f
+		c.FDT = append([]string{name}, overlayNames...)
+		configs = append(configs, c)
+	}
+	if len(configs) == 0 {
+		config.Name, config.Description = "conf-1", *kernel
+		configs = append(configs, config)
+	}
+
+	b, err := fit.Build(*desc, images, configs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, b, 0o644)
+}
@@ -24,12 +24,20 @@ var (
 	kernel     = flag.String("k", "", "Kernel image node name.")
 	initramfs  = flag.String("i", "", "InitRAMFS node name -- default none")
 	ringPath   = flag.String("r", "", "Path to PGP keyring. Enforces signature if non-empty path")
+	pubKeyPath = flag.String("pubkey", "", "Path to PEM public keys. Enforces a U-Boot style configuration signature if non-empty path")
 	rsdpLookup = flag.Bool("rsdp", false, "Derrive RSDP table pointer from environment")
 )
 
 var v = func(string, ...interface{}) {}
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "create" {
+		if err := create(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	if *debug {
@@ -37,7 +45,7 @@ func main() {
 	}
 
 	if len(flag.Args()) != 1 {
-		log.Fatal("Usage: fitboot <file>")
+		log.Fatal("Usage: fitboot <file>\n       fitboot create -o <file> -kernel <kernel> [flags]")
 	}
 	f, err := fit.New(flag.Args()[0])
 	if err != nil {
@@ -79,6 +87,14 @@ func main() {
 		f.KeyRing = ring
 	}
 
+	if *pubKeyPath != "" {
+		keys, err := readPublicKeys(*pubKeyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.PublicKeys = keys
+	}
+
 	if err := f.Load(boot.WithVerbose(*debug)); err != nil {
 		log.Fatal(err)
 	}
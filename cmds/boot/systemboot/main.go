@@ -27,6 +27,7 @@ var (
 	doQuiet          = flag.Bool("q", false, fmt.Sprintf("Disable verbose output. If not specified, read it from VPD var '%s'. Default false", vpdSystembootLogLevel))
 	interval         = flag.Int("I", 1, "Interval in seconds before looping to the next boot command")
 	noDefaultBoot    = flag.Bool("nodefault", false, "Do not attempt default boot entries if regular ones fail")
+	framebuffer      = flag.String("fb", "", "Framebuffer device for the boot menu of the default boot sequence, e.g. /dev/fb0")
 )
 
 const (
@@ -291,6 +292,14 @@ func getDebugEnabled() bool {
 func main() {
 	flag.Parse()
 
+	if *framebuffer != "" {
+		for i, bootcmd := range defaultBootsequence {
+			if bootcmd[0] == "boot" {
+				defaultBootsequence[i] = append(bootcmd, "-fb="+*framebuffer)
+			}
+		}
+	}
+
 	debugEnabled := getDebugEnabled()
 
 	log.Print(`
@@ -8,6 +8,14 @@
 // init does some basic initialization (mount file systems, turn on loopback)
 // and then tries to execute, in order, /inito, a uinit (either in /bin, /bbin,
 // or /ubin), and then a shell (/bin/defaultsh and /bin/sh).
+//
+// On Linux, if there is a service file at /etc/init.json, or a directory of
+// them at /etc/init.d, init instead supervises the services it declares:
+// it starts them in order, after those they depend on, restarts them with
+// backoff when they exit, and runs a shell on each console of console= on
+// the kernel command line. SIGHUP, SIGUSR1 and SIGUSR2 are forwarded to the
+// services, and SIGTERM or SIGPWR stop them in reverse order and power off.
+// See libinit.ServiceConfig for the format of the file.
 package main
 
 import (
@@ -23,6 +31,11 @@ import (
 // the init process after some initial setup.
 type initCmds struct {
 	cmds []*exec.Cmd
+	// supervise, if set, is run instead of cmds, and returns once the
+	// services it supervises are stopped.
+	supervise func()
+	// shutdown, if set, is run last, like to power off.
+	shutdown func()
 }
 
 var (
@@ -62,8 +75,9 @@ func main() {
 	// to be used in the rest of init.
 	ic := osInitGo()
 
-	cmdCount := libinit.RunCommands(debug, ic.cmds...)
-	if cmdCount == 0 {
+	if ic.supervise != nil {
+		ic.supervise()
+	} else if cmdCount := libinit.RunCommands(debug, ic.cmds...); cmdCount == 0 {
 		log.Printf("No suitable executable found in %v", ic.cmds)
 	}
 
@@ -75,5 +89,8 @@ func main() {
 	if err := quiesce(); err != nil {
 		log.Printf("%v", err)
 	}
+	if ic.shutdown != nil {
+		ic.shutdown()
+	}
 	log.Printf("Exiting...")
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/u-root/u-root/pkg/libinit"
 	"github.com/u-root/u-root/pkg/uflag"
 	"github.com/u-root/u-root/pkg/ulog"
+	"golang.org/x/sys/unix"
 )
 
 func quiet() {
@@ -69,7 +70,7 @@ func osInitGo() *initCmds {
 	}
 	uinitArgs := libinit.WithArguments(args...)
 
-	return &initCmds{
+	ic := &initCmds{
 		cmds: []*exec.Cmd{
 			// inito is (optionally) created by the u-root command when the
 			// u-root initramfs is merged with an existing initramfs that
@@ -86,4 +87,49 @@ func osInitGo() *initCmds {
 			libinit.Command("/bin/sh", ctty),
 		},
 	}
+	for _, path := range serviceFiles {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		// A /etc/init.d of another init has no services.
+		if c, err := libinit.LoadServices(path); err != nil {
+			log.Printf("Not supervising services: %v", err)
+		} else if len(c.Services) > 0 {
+			supervise(ic, c)
+		}
+		break
+	}
+	return ic
+}
+
+// serviceFiles are where init looks for services to supervise, in order.
+var serviceFiles = []string{"/etc/init.json", "/etc/init.d"}
+
+// supervise makes ic supervise the services of c, and power off once they
+// are stopped.
+func supervise(ic *initCmds, c *libinit.ServiceConfig) {
+	services := c.Services
+	if !c.NoGetty {
+		for _, sh := range []string{"/bin/defaultsh", "/bin/sh"} {
+			if _, err := os.Stat(sh); err == nil {
+				services = append(services, libinit.Gettys(libinit.Consoles(cmdline.FullCmdLine()), sh)...)
+				break
+			}
+		}
+	}
+	ic.supervise = func() {
+		s := &libinit.Supervisor{Services: services, Debug: debug}
+		if _, err := s.Run(); err != nil {
+			log.Printf("Supervising services: %v", err)
+		}
+	}
+	ic.shutdown = func() {
+		if *test || os.Getpid() != 1 {
+			return
+		}
+		log.Printf("Powering off")
+		if err := unix.Reboot(unix.LINUX_REBOOT_CMD_POWER_OFF); err != nil {
+			log.Printf("Powering off: %v", err)
+		}
+	}
 }
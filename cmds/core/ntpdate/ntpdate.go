@@ -9,7 +9,7 @@
 //
 // Synopsis:
 //
-//	ntpdate [--config=/etc/ntp.conf] [--rtc] [--verbose] [server ...]
+//	ntpdate [--config=/etc/ntp.conf] [--rtc] [--verbose] [-d [--poll=64s] [--nts]] [server ...]
 //
 // Description:
 //
@@ -21,12 +21,20 @@
 //	If servers are specified on the command line, they are tried first.
 //	time.google.com is used as the last resort.
 //
+//	With -d, ntpdate keeps running and polls all servers every --poll
+//	interval. It selects the servers that agree, slews the clock by small
+//	offsets and steps it by large ones, and with --rtc sets the hardware
+//	clock every 11 minutes. --nts authenticates the servers with NTS, in
+//	which case the servers are NTS-KE servers and time.cloudflare.com is the
+//	last resort.
+//
 // Options:
 //
 //	-w: set hwclock to system clock in UTC
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 
@@ -37,10 +45,14 @@ var (
 	config  = flag.String("config", ntpdate.DefaultNTPConfig, "NTP config file.")
 	setRTC  = flag.Bool("rtc", false, "Set RTC time as well")
 	verbose = flag.Bool("verbose", false, "Verbose output")
+	daemon  = flag.Bool("d", false, "Keep the clock synchronized")
+	poll    = flag.Duration("poll", ntpdate.DefaultPoll, "Interval between polls with -d")
+	nts     = flag.Bool("nts", false, "Authenticate servers with NTS, with -d")
 )
 
 const (
-	fallback = "time.google.com"
+	fallback    = "time.google.com"
+	ntsFallback = "time.cloudflare.com"
 )
 
 func main() {
@@ -48,6 +60,22 @@ func main() {
 	if *verbose {
 		ntpdate.Debug = log.Printf
 	}
+	if *daemon {
+		fb := fallback
+		if *nts {
+			fb = ntsFallback
+		}
+		opts := &ntpdate.Opts{
+			Servers: ntpdate.Servers(flag.Args(), *config, fb),
+			NTS:     *nts,
+			Poll:    *poll,
+			RTC:     *setRTC,
+		}
+		if err := ntpdate.Sync(context.Background(), opts); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
 	server, offset, err := ntpdate.SetTime(flag.Args(), *config, fallback, *setRTC)
 	if err != nil {
 		log.Fatalf("Error: %v", err)
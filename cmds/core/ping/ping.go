@@ -6,22 +6,40 @@
 //
 // Synopsis:
 //
-//	ping [-hV] [-c COUNT] [-i INTERVAL] [-s PACKETSIZE] [-w DEADLINE] DESTINATION
+//	ping [-hV6afq] [-c COUNT] [-i INTERVAL] [-s PACKETSIZE] [-t TTL] [-I INTERFACE] [-M PMTUDISC] [-W TIMEOUT] [-w DEADLINE] DESTINATION
+//
+// Description:
+//
+//	ping prints a line per reply and, when done or interrupted, the
+//	statistics summary of iputils ping. It exits with 1 if no reply was
+//	received, or if fewer than COUNT were by the deadline.
+//
+//	Without the privilege to open raw sockets, ping uses unprivileged ICMP
+//	datagram sockets, which Linux allows the groups of
+//	net.ipv4.ping_group_range.
 //
 // Options:
 //
-//	-6: use ipv6 (ip6:ipv6-icmp)
-//	-s: data size (default: 64)
+//	-6: use ipv6 (ip6:ipv6-icmp), the default for IPv6 addresses
+//	-s: data size (default: 56)
 //	-c: # iterations, 0 to run forever (default)
 //	-i: interval in milliseconds (default: 1000)
+//	-t: TTL of the packets sent
+//	-I: interface or source address to send from
+//	-M: path MTU discovery strategy: do (prohibit fragmentation), want, dont or probe
+//	-W: time to wait for a reply, in seconds (default: 10)
+//	-w: deadline in seconds, after which ping exits however many packets were received
+//	-f: flood: send a packet as soon as a reply arrives, or 100 times per second
+//	-q: quiet: only print the summary
 //	-V: version
-//	-w: wait time in milliseconds (default: 100)
 //	-a: Audible rings a bell when a packet is received
 //	-h: help
 package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -29,50 +47,78 @@ import (
 	"math"
 	"net"
 	"os"
+	"os/signal"
 	"time"
 
+	"github.com/u-root/u-root/pkg/ping"
 	"github.com/u-root/u-root/pkg/uroot/util"
-	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv4"
-	"golang.org/x/net/ipv6"
 )
 
-const usage = "ping [-V] [-6] [-c count] [-i interval] [-s packetsize] [-w deadline] [-a audible] destination"
+const usage = "ping [-V] [-6] [-a] [-f] [-q] [-c count] [-i interval] [-s packetsize] [-t ttl] [-I interface] [-M pmtudisc] [-W timeout] [-w deadline] destination"
+
+// floodInterval is the longest interval of flood pings.
+const floodInterval = 10 * time.Millisecond
+
+var errNoReply = errors.New("no reply")
 
 type params struct {
 	packetSize int
 	intv       int
-	wtf        int
+	timeout    time.Duration
+	deadline   time.Duration
 	iter       uint64
 	host       string
 	net6       bool
 	audible    bool
+	ttl        int
+	iface      string
+	pmtudisc   string
+	quiet      bool
+	flood      bool
 }
 
 type cmd struct {
 	stdout io.Writer
-	conn   net.PacketConn
+	conn   *ping.Conn
 	params
+
+	stats   ping.Stats
+	sent    map[int]time.Time
+	replied map[int]bool
 }
 
-func command(stdin io.Writer, p params) (*cmd, error) {
-	netname, address := "ip4:icmp", "0.0.0.0"
-	if p.net6 {
-		netname, address = "ip6:ipv6-icmp", "::1"
+func command(stdout io.Writer, p params) (*cmd, error) {
+	if ip := net.ParseIP(p.host); ip != nil && ip.To4() == nil {
+		p.net6 = true
 	}
-	conn, err := icmp.ListenPacket(netname, address)
+	o := &ping.Opts{IPv6: p.net6, TTL: p.ttl}
+	if ip := net.ParseIP(p.iface); ip != nil {
+		o.Source = ip
+	} else {
+		o.Interface = p.iface
+	}
+	if p.pmtudisc != "" {
+		var err error
+		if o.PMTUDisc, err = ping.ParsePMTUDisc(p.pmtudisc); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := ping.Listen(o)
 	if err != nil {
-		return nil, fmt.Errorf("can't setup %s socket on %s: %v", netname, address, err)
+		return nil, err
 	}
 
-	return &cmd{stdin, conn, p}, nil
+	return &cmd{stdout: stdout, conn: conn, params: p}, nil
 }
 
-func (c *cmd) run() error {
+func (c *cmd) run(ctx context.Context) error {
 	defer c.conn.Close()
 	if c.packetSize < 8 {
 		return fmt.Errorf("packet size too small (must be >= 8): %v", c.packetSize)
 	}
+	if c.iter == 0 {
+		c.iter = math.MaxUint64
+	}
 
 	network := "ip4"
 	if c.net6 {
@@ -84,78 +130,159 @@ func (c *cmd) run() error {
 		return fmt.Errorf("failed to resolve address: %v", err)
 	}
 
-	interval := time.Duration(c.intv)
-	waitFor := time.Duration(c.wtf) * time.Millisecond
-	for i := uint64(0); i < c.iter; i++ {
-		msg, err := c.ping(addr, i+1, waitFor)
-		if err != nil {
-			return fmt.Errorf("ping failed: %v", err)
-		}
-		if c.audible {
-			msg = "\a" + msg
-		}
-		fmt.Fprintf(c.stdout, "%s\n", msg)
-		time.Sleep(time.Millisecond * interval)
+	if c.net6 {
+		fmt.Fprintf(c.stdout, "PING %s (%v) %d data bytes\n", c.host, addr, c.packetSize)
+	} else {
+		fmt.Fprintf(c.stdout, "PING %s (%v) %d(%d) bytes of data.\n", c.host, addr, c.packetSize, c.packetSize+28)
 	}
 
+	start := time.Now()
+	err = c.pings(ctx, addr)
+	c.stats.Summary(c.stdout, c.host, time.Since(start))
+	if err != nil {
+		return err
+	}
+	if c.stats.Received == 0 || (c.deadline > 0 && c.iter != math.MaxUint64 && uint64(c.stats.Received) < c.iter) {
+		return errNoReply
+	}
 	return nil
 }
 
-func (c *cmd) ping(addr *net.IPAddr, i uint64, waitFor time.Duration) (string, error) {
-	c.conn.SetDeadline(time.Now().Add(waitFor))
-
-	var echoRequestType icmp.Type = ipv4.ICMPTypeEcho
-	if c.net6 {
-		echoRequestType = ipv6.ICMPTypeEchoRequest
-	}
-
-	wm := icmp.Message{Type: echoRequestType, Code: 0, Body: &icmp.Echo{
-		ID:   os.Getpid() & 0xffff,
-		Seq:  int(i),
-		Data: bytes.Repeat([]byte{1}, c.packetSize)},
+// pings sends echo requests until done, or ctx is done.
+func (c *cmd) pings(ctx context.Context, addr *net.IPAddr) error {
+	c.sent, c.replied = map[int]time.Time{}, map[int]bool{}
+	data := bytes.Repeat([]byte{1}, c.packetSize)
+	interval := time.Duration(c.intv) * time.Millisecond
+	if c.flood {
+		interval = min(interval, floodInterval)
 	}
-	wb, err := wm.Marshal(nil)
-	if err != nil {
-		return "", fmt.Errorf("icmp.Message.Marshal failed: %v", err)
+	var deadline time.Time
+	if c.deadline > 0 {
+		deadline = time.Now().Add(c.deadline)
 	}
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
 
-	startTime := time.Now()
-	_, err = c.conn.WriteTo(wb, addr)
-	if err != nil {
-		return "", fmt.Errorf("conn.Write failed: %v", err)
-	}
+	for i := 1; ctx.Err() == nil; i++ {
+		if c.deadline > 0 {
+			// As in iputils, count is that of replies with a deadline.
+			if !time.Now().Before(deadline) || uint64(c.stats.Received) >= c.iter {
+				return nil
+			}
+		} else if uint64(c.stats.Sent) >= c.iter {
+			return nil
+		}
 
-	rb := make([]byte, 1500)
-	n, _, err := c.conn.ReadFrom(rb)
-	if err != nil {
-		return "", fmt.Errorf("conn.Read failed: %v", err)
+		seq := i & 0xffff
+		sent := time.Now()
+		c.send(addr, seq, data)
+		last := c.deadline == 0 && uint64(c.stats.Sent) >= c.iter
+		until := sent.Add(interval)
+		if last {
+			until = sent.Add(c.timeout)
+		}
+		if c.deadline > 0 && until.After(deadline) {
+			until = deadline
+		}
+		if err := c.receive(ctx, until, seq, last || c.flood); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	latency := time.Since(startTime)
-
-	var echoReplyType icmp.Type = ipv4.ICMPTypeEchoReply
-	if c.net6 {
-		echoReplyType = ipv6.ICMPTypeEchoReply
+func (c *cmd) send(addr *net.IPAddr, seq int, data []byte) {
+	c.stats.Sent++
+	c.sent[seq] = time.Now()
+	delete(c.replied, seq)
+	if err := c.conn.WriteEcho(addr, seq, data); err != nil {
+		c.stats.Errors++
+		if c.flood {
+			fmt.Fprint(c.stdout, "E")
+		} else {
+			fmt.Fprintf(c.stdout, "ping: local error: %v\n", err)
+		}
+		return
 	}
+	if c.flood {
+		fmt.Fprint(c.stdout, ".")
+	}
+}
 
-	msg, err := icmp.ParseMessage(echoReplyType.Protocol(), rb[:n])
-	if err != nil {
-		return "", fmt.Errorf("icmp.ParseMessage failed: %v", err)
+// receive handles replies until the time until or, if early, until the
+// reply to seq.
+func (c *cmd) receive(ctx context.Context, until time.Time, seq int, early bool) error {
+	c.conn.SetReadDeadline(until)
+	for ctx.Err() == nil {
+		r, err := c.conn.Read()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("conn.Read failed: %v", err)
+		}
+		if c.handle(r) && early && r.Seq == seq {
+			return nil
+		}
 	}
+	return nil
+}
 
-	echoReply, ok := msg.Body.(*icmp.Echo)
+// handle prints and counts r, and returns whether it is the first reply
+// to one of our requests.
+func (c *cmd) handle(r *ping.Reply) bool {
+	sent, ok := c.sent[r.Seq]
 	if !ok {
-		return "", fmt.Errorf("got %+v; want echo reply", msg)
+		return false
+	}
+	if !r.EchoReply() {
+		if c.replied[r.Seq] {
+			return false
+		}
+		c.stats.Errors++
+		switch {
+		case c.flood:
+			fmt.Fprint(c.stdout, "\bE")
+		case !c.quiet:
+			fmt.Fprintf(c.stdout, "From %v icmp_seq=%d %s\n", r.From, r.Seq, r.Description())
+		}
+		return true
 	}
 
-	if echoReply.ID != os.Getpid()&0xffff {
-		return "", fmt.Errorf("got id %v; want %v", echoReply.ID, os.Getpid()&0xffff)
+	rtt := r.Received.Sub(sent)
+	dup := c.replied[r.Seq]
+	if dup {
+		c.stats.Duplicates++
+	} else {
+		c.replied[r.Seq] = true
+		c.stats.AddRTT(rtt)
 	}
-	if echoReply.Seq != int(i) {
-		return "", fmt.Errorf("got seq %v; want %v", echoReply.Seq, i)
+	switch {
+	case c.flood:
+		if !dup {
+			fmt.Fprint(c.stdout, "\b \b")
+		}
+	case !c.quiet:
+		msg := fmt.Sprintf("%d bytes from %v: icmp_seq=%d", r.Len, r.From, r.Seq)
+		if r.TTL >= 0 {
+			msg += fmt.Sprintf(" ttl=%d", r.TTL)
+		}
+		msg += fmt.Sprintf(" time=%s ms", ping.Millis(rtt))
+		if dup {
+			msg += " (DUP!)"
+		}
+		if c.audible {
+			msg = "\a" + msg
+		}
+		fmt.Fprintf(c.stdout, "%s\n", msg)
 	}
+	return !dup
+}
 
-	return fmt.Sprintf("%d bytes from %v: icmp_seq=%v time=%v", n, c.host, i, latency), nil
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
 
 func main() {
@@ -164,7 +291,13 @@ func main() {
 		packetSize = flag.Int("s", 56, "Data size")
 		iter       = flag.Uint64("c", math.MaxUint64, "# iterations")
 		intv       = flag.Int("i", 1000, "interval in milliseconds")
-		wtf        = flag.Int("w", 100, "wait time in milliseconds")
+		ttl        = flag.Int("t", 0, "TTL of the packets sent")
+		iface      = flag.String("I", "", "interface or source address to send from")
+		pmtudisc   = flag.String("M", "", "path MTU discovery strategy: do, want, dont or probe")
+		timeout    = flag.Float64("W", 10, "time to wait for a reply, in seconds")
+		deadline   = flag.Float64("w", 0, "deadline in seconds")
+		flood      = flag.Bool("f", false, "flood ping")
+		quiet      = flag.Bool("q", false, "only print the summary")
 		audible    = flag.Bool("a", false, "Audible rings a bell when a packet is received")
 	)
 
@@ -176,11 +309,29 @@ func main() {
 		os.Exit(1)
 	}
 	host := flag.Args()[0]
-	cmd, err := command(os.Stdout, params{*packetSize, *intv, *wtf, *iter, host, *net6, *audible})
+	cmd, err := command(os.Stdout, params{
+		packetSize: *packetSize,
+		intv:       *intv,
+		timeout:    seconds(*timeout),
+		deadline:   seconds(*deadline),
+		iter:       *iter,
+		host:       host,
+		net6:       *net6,
+		audible:    *audible,
+		ttl:        *ttl,
+		iface:      *iface,
+		pmtudisc:   *pmtudisc,
+		quiet:      *quiet,
+		flood:      *flood,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := cmd.run(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cmd.run(ctx); errors.Is(err, errNoReply) {
+		os.Exit(1)
+	} else if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -6,28 +6,49 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/hugelgupf/vmtest/guest"
+	"github.com/u-root/u-root/pkg/ping"
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
 )
 
 type testConn struct {
-	lastMessage []byte
+	// replies are those to read, and drop the sequence numbers of the
+	// requests not to reply to.
+	replies [][]byte
+	drop    map[int]bool
+	// reply returns the reply to an echo request.
+	reply func(req *icmp.Echo) icmp.Message
 }
 
 func (tc *testConn) ReadFrom(b []byte) (int, net.Addr, error) {
-	m, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), tc.lastMessage)
+	if len(tc.replies) == 0 {
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+	n := copy(b, tc.replies[0])
+	tc.replies = tc.replies[1:]
+	return n, &net.IPAddr{IP: net.IPv4(1, 1, 1, 1)}, nil
+}
+
+func (tc *testConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	m, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), b)
 	if err != nil {
-		return 0, nil, err
+		return 0, err
 	}
 
 	body := m.Body.(*icmp.Echo)
+	if tc.drop[body.Seq] {
+		return len(b), nil
+	}
 
 	respone := icmp.Message{
 		Type: ipv4.ICMPTypeEchoReply,
@@ -38,18 +59,15 @@ func (tc *testConn) ReadFrom(b []byte) (int, net.Addr, error) {
 			Data: body.Data,
 		},
 	}
+	if tc.reply != nil {
+		respone = tc.reply(body)
+	}
 
 	resp, err := respone.Marshal(nil)
 	if err != nil {
-		return 0, nil, err
+		return 0, err
 	}
-
-	n := copy(b, resp)
-	return n, nil, nil
-}
-
-func (tc *testConn) WriteTo(b []byte, addr net.Addr) (int, error) {
-	tc.lastMessage = b
+	tc.replies = append(tc.replies, resp)
 	return len(b), nil
 }
 
@@ -85,7 +103,7 @@ func parsePingLines(t *testing.T, output []byte) []pingOutputLine {
 	var lines []pingOutputLine
 
 	for _, line := range bytes.Split(output, []byte("\n")) {
-		if len(line) == 0 {
+		if !bytes.Contains(line, []byte(" bytes from ")) {
 			continue
 		}
 
@@ -127,19 +145,19 @@ func TestPing(t *testing.T) {
 	stdout := &bytes.Buffer{}
 	cmd := &cmd{
 		stdout: stdout,
-		conn:   paConn,
+		conn:   ping.NewConn(paConn, false, false),
 		params: params{
 			host:       "1.1.1.1",
 			packetSize: 56,
 			intv:       1000,
-			wtf:        100,
+			timeout:    100 * time.Millisecond,
 			iter:       1,
 			net6:       false,
 			audible:    true,
 		},
 	}
 
-	err := cmd.run()
+	err := cmd.run(context.Background())
 	if err != nil {
 		t.Error(err)
 	}
@@ -170,14 +188,14 @@ func TestRawPing(t *testing.T) {
 		packetSize: 56,
 		host:       "127.0.0.1",
 		intv:       1000,
-		wtf:        100,
+		timeout:    time.Second,
 		iter:       1,
 	})
 	if err != nil {
-		t.Errorf("command() failed: %v", err)
+		t.Fatalf("command() failed: %v", err)
 	}
 
-	err = cmd.run()
+	err = cmd.run(context.Background())
 	if err != nil {
 		t.Errorf("run() failed: %v", err)
 	}
@@ -201,3 +219,96 @@ func TestRawPing(t *testing.T) {
 		t.Errorf("expected addr, got %s", lines[0].addr)
 	}
 }
+
+func TestPingSummary(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		conn   *testConn
+		params params
+		want   []string
+		lines  int
+		err    error
+	}{
+		{
+			name:   "all received",
+			conn:   &testConn{},
+			params: params{iter: 3},
+			want: []string{
+				"PING 1.1.1.1 (1.1.1.1) 56(84) bytes of data.",
+				"--- 1.1.1.1 ping statistics ---",
+				"3 packets transmitted, 3 received, 0% packet loss, time ",
+				"rtt min/avg/max/mdev = ",
+			},
+			lines: 3,
+		},
+		{
+			name:   "loss",
+			conn:   &testConn{drop: map[int]bool{2: true}},
+			params: params{iter: 3},
+			want:   []string{"3 packets transmitted, 2 received, 33.3333% packet loss, time "},
+			lines:  2,
+		},
+		{
+			name:   "none received",
+			conn:   &testConn{drop: map[int]bool{1: true, 2: true}},
+			params: params{iter: 2},
+			want:   []string{"2 packets transmitted, 0 received, 100% packet loss, time "},
+			err:    errNoReply,
+		},
+		{
+			name:   "quiet",
+			conn:   &testConn{},
+			params: params{iter: 2, quiet: true},
+			want:   []string{"2 packets transmitted, 2 received, 0% packet loss, time "},
+		},
+		{
+			name: "errors",
+			conn: &testConn{reply: func(req *icmp.Echo) icmp.Message {
+				b, _ := (&icmp.Message{Type: ipv4.ICMPTypeEcho, Body: req}).Marshal(nil)
+				h := make([]byte, ipv4.HeaderLen)
+				h[0], h[9] = 0x45, 1
+				return icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: append(h, b[:8]...)}}
+			}},
+			params: params{iter: 1},
+			want: []string{
+				"From 1.1.1.1 icmp_seq=1 Time to live exceeded",
+				"1 packets transmitted, 0 received, +1 errors, 100% packet loss, time ",
+			},
+			err: errNoReply,
+		},
+		{
+			name:   "deadline",
+			conn:   &testConn{drop: map[int]bool{1: true}},
+			params: params{iter: 2, deadline: time.Minute},
+			want:   []string{"3 packets transmitted, 2 received, 33.3333% packet loss, time "},
+			lines:  2,
+		},
+		{
+			name:   "deadline passed",
+			conn:   &testConn{drop: map[int]bool{1: true}},
+			params: params{iter: 2, deadline: time.Nanosecond},
+			want:   []string{"0 packets transmitted, 0 received, 0% packet loss, time "},
+			err:    errNoReply,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			tt.params.host = "1.1.1.1"
+			tt.params.packetSize = 56
+			tt.params.timeout = time.Second
+			c := &cmd{stdout: &stdout, conn: ping.NewConn(tt.conn, false, false), params: tt.params}
+			if err := c.run(context.Background()); !errors.Is(err, tt.err) {
+				t.Errorf("run() = %v, want %v", err, tt.err)
+			}
+			out := stdout.String()
+			for _, w := range tt.want {
+				if !strings.Contains(out, "\n"+w) && !strings.HasPrefix(out, w) {
+					t.Errorf("output %q does not have line %q", out, w)
+				}
+			}
+			if lines := parsePingLines(t, stdout.Bytes()); len(lines) != tt.lines {
+				t.Errorf("got %d reply lines, want %d", len(lines), tt.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "os"
+
+// signaled returns false: Plan 9 processes end with exit strings, which
+// ExitCode reports.
+func signaled(ps *os.ProcessState) (string, bool, bool) {
+	return "", false, false
+}
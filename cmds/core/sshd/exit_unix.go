@@ -0,0 +1,25 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9
+
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// signaled returns the name of the signal that killed the process of ps,
+// without the SIG prefix, and whether it dumped core.
+func signaled(ps *os.ProcessState) (string, bool, bool) {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "", false, false
+	}
+	return strings.TrimPrefix(unix.SignalName(ws.Signal()), "SIG"), ws.CoreDump(), true
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	// forwardReq is the payload of "tcpip-forward" and
+	// "cancel-tcpip-forward" requests.
+	forwardReq struct {
+		BindAddr string
+		BindPort uint32
+	}
+	forwardReply struct {
+		Port uint32
+	}
+	// tcpipChannel is the payload of "direct-tcpip" and
+	// "forwarded-tcpip" channels.
+	tcpipChannel struct {
+		Addr     string
+		Port     uint32
+		OrigAddr string
+		OrigPort uint32
+	}
+)
+
+// forwarder forwards TCP connections of a client, for ssh -L and -R.
+type forwarder struct {
+	conn *ssh.ServerConn
+
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+}
+
+func (f *forwarder) allowed() bool {
+	_, no := f.conn.Permissions.Extensions[extNoForward]
+	return !no
+}
+
+// globalRequests handles requests to forward remote ports.
+func (f *forwarder) globalRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		dprintf("Global request %v", req.Type)
+		r := &forwardReq{}
+		switch req.Type {
+		case "tcpip-forward":
+			if err := ssh.Unmarshal(req.Payload, r); err != nil || !f.allowed() {
+				req.Reply(false, nil)
+				continue
+			}
+			port, err := f.listen(r.BindAddr, r.BindPort)
+			if err != nil {
+				log.Printf("Could not forward %s:%d: %v", r.BindAddr, r.BindPort, err)
+				req.Reply(false, nil)
+				continue
+			}
+			// The client learns the port it asked the server to
+			// choose.
+			var reply []byte
+			if r.BindPort == 0 {
+				reply = ssh.Marshal(forwardReply{port})
+			}
+			req.Reply(true, reply)
+		case "cancel-tcpip-forward":
+			if err := ssh.Unmarshal(req.Payload, r); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(f.cancel(r.BindAddr, r.BindPort), nil)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// listenAddr returns the address to listen on for a bind address of a
+// forward request, where "" means all addresses.
+func listenAddr(addr string, port uint32) string {
+	if addr == "*" {
+		addr = ""
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(int(port)))
+}
+
+func (f *forwarder) listen(addr string, port uint32) (uint32, error) {
+	l, err := net.Listen("tcp", listenAddr(addr, port))
+	if err != nil {
+		return 0, err
+	}
+	port = uint32(l.Addr().(*net.TCPAddr).Port)
+
+	f.mu.Lock()
+	if f.listeners == nil {
+		f.listeners = map[string]net.Listener{}
+	}
+	f.listeners[listenAddr(addr, port)] = l
+	f.mu.Unlock()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.forward(c, addr, port)
+		}
+	}()
+	return port, nil
+}
+
+func (f *forwarder) cancel(addr string, port uint32) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, ok := f.listeners[listenAddr(addr, port)]
+	if ok {
+		l.Close()
+		delete(f.listeners, listenAddr(addr, port))
+	}
+	return ok
+}
+
+// close stops forwarding remote ports.
+func (f *forwarder) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range f.listeners {
+		l.Close()
+	}
+	f.listeners = nil
+}
+
+// forward forwards a connection to a remote port to the client.
+func (f *forwarder) forward(c net.Conn, addr string, port uint32) {
+	orig := c.RemoteAddr().(*net.TCPAddr)
+	ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(tcpipChannel{
+		Addr:     addr,
+		Port:     port,
+		OrigAddr: orig.IP.String(),
+		OrigPort: uint32(orig.Port),
+	}))
+	if err != nil {
+		dprintf("Client refused forwarded connection: %v", err)
+		c.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, c)
+}
+
+// directTCPIP connects a client to a host, for local port forwarding.
+func (f *forwarder) directTCPIP(nc ssh.NewChannel) {
+	d := &tcpipChannel{}
+	if err := ssh.Unmarshal(nc.ExtraData(), d); err != nil {
+		nc.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+	if !f.allowed() {
+		nc.Reject(ssh.Prohibited, "port forwarding is disabled")
+		return
+	}
+	addr := net.JoinHostPort(d.Addr, strconv.Itoa(int(d.Port)))
+	c, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		c.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, c)
+}
+
+// pipe copies between ch and c until both directions are done.
+func pipe(ch ssh.Channel, c net.Conn) {
+	defer ch.Close()
+	defer c.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(ch, c)
+		ch.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(c, ch)
+		if tc, ok := c.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
@@ -0,0 +1,292 @@
+// Copyright 2018-2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/pty"
+	"github.com/u-root/u-root/pkg/sftp"
+	"github.com/u-root/u-root/pkg/termios"
+	"golang.org/x/crypto/ssh"
+)
+
+// The ssh package does not define these things so we will
+type (
+	ptyReq struct {
+		TERM   string // TERM environment variable value (e.g., vt100)
+		Col    uint32
+		Row    uint32
+		Xpixel uint32
+		Ypixel uint32
+		Modes  string // encoded terminal modes
+	}
+	windowChangeReq struct {
+		Col    uint32
+		Row    uint32
+		Xpixel uint32
+		Ypixel uint32
+	}
+	envReq struct {
+		Name  string
+		Value string
+	}
+	execReq struct {
+		Command string
+	}
+	subsystemReq struct {
+		Name string
+	}
+	exitStatusReq struct {
+		ExitStatus uint32
+	}
+	exitSignalReq struct {
+		Signal     string // without the SIG prefix
+		CoreDumped bool
+		Error      string
+		Lang       string
+	}
+)
+
+func init() {
+	for _, s := range shells {
+		if _, err := exec.LookPath(s); err == nil {
+			shell = s
+		}
+	}
+}
+
+// session is a session channel, which runs one shell, command or
+// subsystem.
+type session struct {
+	perms   *ssh.Permissions
+	ch      ssh.Channel
+	env     []string
+	pty     *pty.Pty
+	started bool
+}
+
+// serve handles the requests of s, like "pty-req", "env" and "shell".
+func (s *session) serve(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		dprintf("Request %v", req.Type)
+		req.Reply(s.request(req), nil)
+	}
+	// A pty allocated for a shell or command that never ran.
+	if !s.started && s.pty != nil {
+		closePTY(s.pty)
+	}
+}
+
+// acceptEnv reports whether a client may set the environment variable
+// name, which, like AcceptEnv of OpenSSH, is only the locale and TERM.
+// Others, like LD_PRELOAD or PATH, can change what the command runs.
+func acceptEnv(name string) bool {
+	return name == "LANG" || name == "TERM" || strings.HasPrefix(name, "LC_")
+}
+
+// closePTY closes both ends of p, and the tty it was made on.
+func closePTY(p *pty.Pty) {
+	p.Pts.Close()
+	p.Ptm.Close()
+	p.TTY.Close()
+}
+
+func (s *session) request(req *ssh.Request) bool {
+	switch req.Type {
+	case "pty-req":
+		if _, ok := s.perms.Extensions[extNoPTY]; ok || s.pty != nil || s.started {
+			return false
+		}
+		p, term, err := newPTY(req.Payload)
+		if err != nil {
+			log.Printf("sshd: %v", err)
+			return false
+		}
+		s.pty = p
+		s.env = append(s.env, "TERM="+term)
+		return true
+	case "window-change":
+		w := &windowChangeReq{}
+		if err := ssh.Unmarshal(req.Payload, w); err != nil || s.pty == nil {
+			return false
+		}
+		err := s.pty.SetWinSize(winsize(w.Row, w.Col, w.Xpixel, w.Ypixel))
+		return err == nil
+	case "env":
+		e := &envReq{}
+		if err := ssh.Unmarshal(req.Payload, e); err != nil || s.started || !acceptEnv(e.Name) {
+			return false
+		}
+		// The forced command of the key runs in the environment it
+		// was written for.
+		if _, ok := s.perms.Extensions[extCommand]; ok {
+			return false
+		}
+		s.env = append(s.env, e.Name+"="+e.Value)
+		return true
+	case "shell":
+		return s.start("", false)
+	case "exec":
+		e := &execReq{}
+		if err := ssh.Unmarshal(req.Payload, e); err != nil {
+			log.Printf("sshd: %v", err)
+			return false
+		}
+		return s.start(e.Command, false)
+	case "subsystem":
+		sub := &subsystemReq{}
+		if err := ssh.Unmarshal(req.Payload, sub); err != nil || sub.Name != "sftp" {
+			return false
+		}
+		return s.start("", true)
+	}
+	log.Printf("Not handling req %v %q", req.Type, string(req.Payload))
+	return false
+}
+
+// start runs command, a shell if empty, or the sftp subsystem. A forced
+// command of the key runs instead of any of these.
+func (s *session) start(command string, subsystem bool) bool {
+	if s.started {
+		return false
+	}
+	s.started = true
+
+	if force, ok := s.perms.Extensions[extCommand]; ok {
+		if !subsystem {
+			s.env = append(s.env, "SSH_ORIGINAL_COMMAND="+command)
+		}
+		command, subsystem = force, false
+	}
+	env, p := s.env, s.pty
+	if subsystem && p != nil {
+		closePTY(p)
+	}
+	go func() {
+		defer s.ch.Close()
+		if subsystem {
+			code := uint32(0)
+			if err := (&sftp.Server{}).Serve(s.ch); err != nil {
+				log.Printf("sftp: %v", err)
+				code = 1
+			}
+			s.ch.SendRequest("exit-status", false, ssh.Marshal(exitStatusReq{code}))
+			return
+		}
+
+		// Execute command using user's shell. This is what OpenSSH does
+		// so it's the least surprising to the user.
+		args := []string{}
+		if command != "" {
+			args = append(args, "-c", command)
+		}
+		ps, err := runCommand(s.ch, p, env, shell, args...)
+		if err != nil {
+			log.Printf("sshd: %v", err)
+			return
+		}
+		sendExit(s.ch, ps)
+	}()
+	return true
+}
+
+// sendExit tells the client how the command ended.
+func sendExit(c ssh.Channel, ps *os.ProcessState) {
+	if ps.Exited() {
+		code := uint32(ps.ExitCode())
+		dprintf("Exit status %v", code)
+		c.SendRequest("exit-status", false, ssh.Marshal(exitStatusReq{code}))
+		return
+	}
+	if sig, core, ok := signaled(ps); ok {
+		dprintf("Exit signal %v", sig)
+		c.SendRequest("exit-signal", false, ssh.Marshal(exitSignalReq{Signal: sig, CoreDumped: core}))
+	}
+}
+
+// start a command
+// TODO: use /etc/passwd, but the Go support for that is incomplete
+func runCommand(c ssh.Channel, p *pty.Pty, env []string, cmd string, args ...string) (*os.ProcessState, error) {
+	if p != nil {
+		log.Printf("Executing PTY command %s %v", cmd, args)
+		p.Command(cmd, args...)
+		p.C.Env = append(os.Environ(), env...)
+		if err := p.C.Start(); err != nil {
+			dprintf("Failed to execute: %v", err)
+			closePTY(p)
+			return nil, err
+		}
+		// Reading the Ptm ends once the command and its children
+		// closed the Pts.
+		p.Pts.Close()
+		defer p.Ptm.Close()
+		defer p.TTY.Close()
+		go io.Copy(p.Ptm, c)
+		done := make(chan struct{})
+		go func() {
+			io.Copy(c, p.Ptm)
+			close(done)
+		}()
+		p.C.Wait()
+		<-done
+		return p.C.ProcessState, nil
+	}
+
+	e := exec.Command(cmd, args...)
+	e.Env = append(os.Environ(), env...)
+	e.Stdout, e.Stderr = c, c.Stderr()
+	// Do not wait for the client to close its stdin, which it may
+	// only do when the command ended.
+	stdin, err := e.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		io.Copy(stdin, c)
+		stdin.Close()
+	}()
+	log.Printf("Executing non-PTY command %s %v", cmd, args)
+	if err := e.Start(); err != nil {
+		dprintf("Failed to execute: %v", err)
+		return nil, err
+	}
+	e.Wait()
+	return e.ProcessState, nil
+}
+
+func winsize(row, col, xpixel, ypixel uint32) *termios.Winsize {
+	ws := &termios.Winsize{}
+	ws.Row = uint16(row)
+	ws.Col = uint16(col)
+	ws.Xpixel = uint16(xpixel)
+	ws.Ypixel = uint16(ypixel)
+	return ws
+}
+
+// newPTY returns a pty as the client requested, and the TERM it uses.
+func newPTY(b []byte) (*pty.Pty, string, error) {
+	ptyReq := &ptyReq{}
+	err := ssh.Unmarshal(b, ptyReq)
+	dprintf("newPTY: %q", ptyReq)
+	if err != nil {
+		return nil, "", err
+	}
+	p, err := pty.New()
+	if err != nil {
+		return nil, "", err
+	}
+	ws := winsize(ptyReq.Row, ptyReq.Col, ptyReq.Xpixel, ptyReq.Ypixel)
+	dprintf("newPTY: Set winsizes to %v", ws)
+	if err := p.SetWinSize(ws); err != nil {
+		closePTY(p)
+		return nil, "", err
+	}
+	return p, ptyReq.TERM, nil
+}
@@ -2,175 +2,215 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// sshd is a small SSH server.
+//
+// Synopsis:
+//
+//	sshd [-d] [-keys FILE] [-passwords FILE] [-privatekey FILE] [-ip IP] [-port PORT]
+//
+// Description:
+//
+//	sshd runs shells and commands, with or without a pty, serves the sftp
+//	subsystem for sftp and scp, and forwards TCP connections both ways
+//	for ssh -L and -R.
+//
+//	Users log in with a key in the authorized_keys file, whose
+//	command="...", no-pty and no-port-forwarding options are honored, or
+//	with a password from the passwords file, which has user:password
+//	lines. A missing host key file is created with a new ed25519 key.
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
-	"os/exec"
+	"strings"
 
-	"github.com/u-root/u-root/pkg/pty"
 	"golang.org/x/crypto/ssh"
 )
 
-// The ssh package does not define these things so we will
-type (
-	ptyReq struct {
-		TERM   string // TERM environment variable value (e.g., vt100)
-		Col    uint32
-		Row    uint32
-		Xpixel uint32
-		Ypixel uint32
-		Modes  string // encoded terminal modes
-	}
-	execReq struct {
-		Command string
-	}
-	exitStatusReq struct {
-		ExitStatus uint32
-	}
+var (
+	debug     = flag.Bool("d", false, "Enable debug prints")
+	keys      = flag.String("keys", "authorized_keys", "Path to the authorized_keys file")
+	passwords = flag.String("passwords", "", "Path to a file of user:password lines to allow password logins")
+	privkey   = flag.String("privatekey", "id_rsa", "Path of private key, created if it does not exist")
+	ip        = flag.String("ip", "0.0.0.0", "ip address to listen on")
+	port      = flag.String("port", "2022", "port to listen on")
+	dprintf   = func(string, ...interface{}) {}
 )
 
-var (
-	debug   = flag.Bool("d", false, "Enable debug prints")
-	keys    = flag.String("keys", "authorized_keys", "Path to the authorized_keys file")
-	privkey = flag.String("privatekey", "id_rsa", "Path of private key")
-	ip      = flag.String("ip", "0.0.0.0", "ip address to listen on")
-	port    = flag.String("port", "2022", "port to listen on")
-	dprintf = func(string, ...interface{}) {}
+// Extensions of ssh.Permissions for authorized_keys options.
+const (
+	extFingerprint = "pubkey-fp"
+	extCommand     = "force-command"
+	extNoPTY       = "no-pty"
+	extNoForward   = "no-port-forwarding"
 )
 
-// start a command
-// TODO: use /etc/passwd, but the Go support for that is incomplete
-func runCommand(c ssh.Channel, p *pty.Pty, cmd string, args ...string) error {
-	var ps *os.ProcessState
-	defer c.Close()
+// parseAuthorizedKeys returns the permissions of the keys in an
+// authorized_keys file, by their wire format.
+func parseAuthorizedKeys(b []byte) (map[string]*ssh.Permissions, error) {
+	keys := map[string]*ssh.Permissions{}
+	for len(bytes.TrimSpace(b)) > 0 {
+		pubKey, _, options, rest, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
 
-	if p != nil {
-		log.Printf("Executing PTY command %s %v", cmd, args)
-		p.Command(cmd, args...)
-		if err := p.C.Start(); err != nil {
-			dprintf("Failed to execute: %v", err)
-			return err
+		perms := &ssh.Permissions{
+			// Record the public key used for authentication.
+			Extensions: map[string]string{
+				extFingerprint: ssh.FingerprintSHA256(pubKey),
+			},
 		}
-		defer p.C.Wait()
-		go io.Copy(p.Ptm, c)
-		go io.Copy(c, p.Ptm)
-		ps, _ = p.C.Process.Wait()
-	} else {
-		e := exec.Command(cmd, args...)
-		e.Stdin, e.Stdout, e.Stderr = c, c, c
-		log.Printf("Executing non-PTY command %s %v", cmd, args)
-		if err := e.Start(); err != nil {
-			dprintf("Failed to execute: %v", err)
-			return err
+		for _, o := range options {
+			switch name, value, _ := strings.Cut(o, "="); name {
+			case "command":
+				value = strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`)
+				perms.Extensions[extCommand] = strings.ReplaceAll(value, `\"`, `"`)
+			case extNoPTY, extNoForward:
+				perms.Extensions[name] = ""
+			default:
+				log.Printf("Ignoring authorized_keys option %q", o)
+			}
 		}
-		ps, _ = e.Process.Wait()
+		keys[string(pubKey.Marshal())] = perms
 	}
+	return keys, nil
+}
 
-	// TODO(bluecmd): If somebody wants we can send exit-signal to return
-	// information about signal termination, but leave it until somebody needs
-	// it.
-	// if ws.Signaled() {
-	// }
-	if ps.Exited() {
-		code := uint32(ps.ExitCode())
-		dprintf("Exit status %v", code)
-		c.SendRequest("exit-status", false, ssh.Marshal(exitStatusReq{code}))
+// parsePasswords returns the passwords of the users in a file of
+// user:password lines.
+func parsePasswords(b []byte) (map[string]string, error) {
+	users := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		user, password, ok := strings.Cut(s.Text(), ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("password line %q is not user:password", s.Text())
+		}
+		users[user] = password
 	}
-	return nil
+	return users, s.Err()
 }
 
-func newPTY(b []byte) (*pty.Pty, error) {
-	ptyReq := &ptyReq{}
-	err := ssh.Unmarshal(b, ptyReq)
-	dprintf("newPTY: %q", ptyReq)
-	if err != nil {
-		return nil, err
-	}
-	p, err := pty.New()
-	if err != nil {
-		return nil, err
+// loadHostKey reads the host key at path, or creates it.
+func loadHostKey(path string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			return nil, err
+		}
+		log.Printf("Created host key %s", path)
+		return ssh.NewSignerFromKey(key)
 	}
-	ws, err := p.TTY.GetWinSize()
 	if err != nil {
 		return nil, err
 	}
-	ws.Row = uint16(ptyReq.Row)
-	ws.Ypixel = uint16(ptyReq.Ypixel)
-	ws.Col = uint16(ptyReq.Col)
-	ws.Xpixel = uint16(ptyReq.Xpixel)
-	dprintf("newPTY: Set winsizes to %v", ws)
-	if err := p.TTY.SetWinSize(ws); err != nil {
-		return nil, err
-	}
-	dprintf("newPTY: set TERM to %q", ptyReq.TERM)
-	if err := os.Setenv("TERM", ptyReq.TERM); err != nil {
-		return nil, err
-	}
-	return p, nil
+	return ssh.ParsePrivateKey(b)
 }
 
-func init() {
-	for _, s := range shells {
-		if _, err := exec.LookPath(s); err == nil {
-			shell = s
+// serverConfig returns the configuration of a server that accepts the
+// authorized keys, and the passwords of users.
+func serverConfig(authorized map[string]*ssh.Permissions, users map[string]string, hostKey ssh.Signer) *ssh.ServerConfig {
+	// An SSH server is represented by a ServerConfig, which holds
+	// certificate details and handles authentication of ServerConns.
+	config := &ssh.ServerConfig{
+		// Public key authentication is done by comparing
+		// the public key of a received connection
+		// with the entries in the authorized_keys file.
+		PublicKeyCallback: func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
+			if perms, ok := authorized[string(pubKey.Marshal())]; ok {
+				return perms, nil
+			}
+			return nil, fmt.Errorf("unknown public key for %q", c.User())
+		},
+	}
+	if len(users) > 0 {
+		config.PasswordCallback = func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			want, ok := users[c.User()]
+			if ok && subtle.ConstantTimeCompare([]byte(want), password) == 1 {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, fmt.Errorf("wrong password for %q", c.User())
 		}
 	}
+	config.AddHostKey(hostKey)
+	return config
 }
 
-func session(chans <-chan ssh.NewChannel) {
-	var p *pty.Pty
+// handleConn serves one client.
+func handleConn(nConn net.Conn, config *ssh.ServerConfig) {
+	// Before use, a handshake must be performed on the incoming
+	// net.Conn.
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+	if err != nil {
+		log.Printf("failed to handshake: %v", err)
+		return
+	}
+	if fp, ok := conn.Permissions.Extensions[extFingerprint]; ok {
+		log.Printf("%v logged in as %s with key %s", conn.RemoteAddr(), conn.User(), fp)
+	} else {
+		log.Printf("%v logged in as %s with password", conn.RemoteAddr(), conn.User())
+	}
+
+	f := &forwarder{conn: conn}
+	defer f.close()
+	// The incoming Request channel must be serviced.
+	go f.globalRequests(reqs)
+
 	// Service the incoming Channel channel.
 	for newChannel := range chans {
-		// Channels have a type, depending on the application level
-		// protocol intended. In the case of a shell, the type is
-		// "session" and ServerShell may be used to present a simple
-		// terminal interface.
-		if newChannel.ChannelType() != "session" {
+		switch newChannel.ChannelType() {
+		case "session":
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				log.Printf("Could not accept channel: %v", err)
+				continue
+			}
+			s := &session{perms: conn.Permissions, ch: channel}
+			go s.serve(requests)
+		case "direct-tcpip":
+			go f.directTCPIP(newChannel)
+		default:
 			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
-			continue
 		}
-		channel, requests, err := newChannel.Accept()
+	}
+}
+
+// serve serves the clients connecting to l.
+func serve(l net.Listener, config *ssh.ServerConfig) error {
+	for {
+		nConn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
 		if err != nil {
-			log.Printf("Could not accept channel: %v", err)
+			log.Printf("failed to accept incoming connection: %s", err)
 			continue
 		}
-
-		// Sessions have out-of-band requests such as "shell",
-		// "pty-req" and "env".  Here we handle only the
-		// "shell" request.
-		go func(in <-chan *ssh.Request) {
-			for req := range in {
-				dprintf("Request %v", req.Type)
-				switch req.Type {
-				case "shell":
-					err := runCommand(channel, p, shell)
-					req.Reply(true, []byte(fmt.Sprintf("%v", err)))
-				case "exec":
-					e := &execReq{}
-					if err := ssh.Unmarshal(req.Payload, e); err != nil {
-						log.Printf("sshd: %v", err)
-						break
-					}
-					// Execute command using user's shell. This is what OpenSSH does
-					// so it's the least surprising to the user.
-					err := runCommand(channel, p, shell, "-c", e.Command)
-					req.Reply(true, []byte(fmt.Sprintf("%v", err)))
-				case "pty-req":
-					p, err = newPTY(req.Payload)
-					req.Reply(err == nil, nil)
-				default:
-					log.Printf("Not handling req %v %q", req, string(req.Payload))
-					req.Reply(false, nil)
-				}
-			}
-		}(requests)
-
+		go handleConn(nConn, config)
 	}
 }
 
@@ -179,79 +219,38 @@ func main() {
 	if *debug {
 		dprintf = log.Printf
 	}
-	// Public key authentication is done by comparing
-	// the public key of a received connection
-	// with the entries in the authorized_keys file.
-	authorizedKeysBytes, err := os.ReadFile(*keys)
-	if err != nil {
-		log.Fatal(err)
-	}
 
-	authorizedKeysMap := map[string]bool{}
-	for len(authorizedKeysBytes) > 0 {
-		pubKey, _, _, rest, err := ssh.ParseAuthorizedKey(authorizedKeysBytes)
+	var users map[string]string
+	if *passwords != "" {
+		b, err := os.ReadFile(*passwords)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		authorizedKeysMap[string(pubKey.Marshal())] = true
-		authorizedKeysBytes = rest
+		if users, err = parsePasswords(b); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// An SSH server is represented by a ServerConfig, which holds
-	// certificate details and handles authentication of ServerConns.
-	config := &ssh.ServerConfig{
-		// Remove to disable public key auth.
-		PublicKeyCallback: func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
-			if authorizedKeysMap[string(pubKey.Marshal())] {
-				return &ssh.Permissions{
-					// Record the public key used for authentication.
-					Extensions: map[string]string{
-						"pubkey-fp": ssh.FingerprintSHA256(pubKey),
-					},
-				}, nil
-			}
-			return nil, fmt.Errorf("unknown public key for %q", c.User())
-		},
+	// Without passwords, only keys can log in.
+	authorizedKeysBytes, err := os.ReadFile(*keys)
+	if err != nil && (users == nil || !errors.Is(err, os.ErrNotExist)) {
+		log.Fatal(err)
 	}
-
-	privateBytes, err := os.ReadFile(*privkey)
+	authorized, err := parseAuthorizedKeys(authorizedKeysBytes)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	private, err := ssh.ParsePrivateKey(privateBytes)
+	hostKey, err := loadHostKey(*privkey)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	config.AddHostKey(private)
-
 	// Once a ServerConfig has been configured, connections can be
 	// accepted.
 	listener, err := net.Listen("tcp", net.JoinHostPort(*ip, *port))
 	if err != nil {
 		log.Fatal(err)
 	}
-	for {
-		nConn, err := listener.Accept()
-		if err != nil {
-			log.Printf("failed to accept incoming connection: %s", err)
-			continue
-		}
-
-		// Before use, a handshake must be performed on the incoming
-		// net.Conn.
-		conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
-		if err != nil {
-			log.Printf("failed to handshake: %v", err)
-			continue
-		}
-		log.Printf("%v logged in with key %s", conn.RemoteAddr(), conn.Permissions.Extensions["pubkey-fp"])
-
-		// The incoming Request channel must be serviced.
-		go ssh.DiscardRequests(reqs)
-
-		go session(chans)
-	}
+	log.Fatal(serve(listener, serverConfig(authorized, users, hostKey)))
 }
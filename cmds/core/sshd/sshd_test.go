@@ -0,0 +1,360 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer starts a server with an authorized key that has options, and
+// returns a client signer of that key.
+func testServer(t *testing.T, options string, users map[string]string) (string, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := parseAuthorizedKeys([]byte(options + " " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := loadHostKey(filepath.Join(t.TempDir(), "host_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go serve(l, serverConfig(authorized, users, hostKey))
+	return l.Addr().String(), signer
+}
+
+func dial(t *testing.T, addr string, auth ssh.AuthMethod) *ssh.Client {
+	t.Helper()
+	c, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// run runs cmd in a new session, and returns its output and exit error.
+func run(t *testing.T, c *ssh.Client, env map[string]string, cmd string) (string, error) {
+	t.Helper()
+	s, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for k, v := range env {
+		if err := s.Setenv(k, v); err != nil {
+			t.Fatalf("Setenv(%q, %q) = %v", k, v, err)
+		}
+	}
+	out, err := s.CombinedOutput(cmd)
+	return string(out), err
+}
+
+func TestSession(t *testing.T) {
+	addr, signer := testServer(t, "", nil)
+	c := dial(t, addr, ssh.PublicKeys(signer))
+
+	for _, tt := range []struct {
+		name   string
+		env    map[string]string
+		cmd    string
+		out    string
+		status int
+		signal string
+	}{
+		{name: "output", cmd: "echo hi", out: "hi\n"},
+		{name: "stderr", cmd: "echo hi >&2", out: "hi\n"},
+		{name: "env", env: map[string]string{"LC_GREETING": "hello"}, cmd: "echo $LC_GREETING", out: "hello\n"},
+		{name: "exit status", cmd: "exit 3", status: 3},
+		{name: "exit signal", cmd: "kill -TERM $$", signal: "TERM"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := run(t, c, tt.env, tt.cmd)
+			if out != tt.out {
+				t.Errorf("output %q, want %q", out, tt.out)
+			}
+			var exit *ssh.ExitError
+			switch {
+			case tt.status == 0 && tt.signal == "":
+				if err != nil {
+					t.Errorf("run = %v, want nil", err)
+				}
+			case !errors.As(err, &exit):
+				t.Errorf("run = %v, want *ssh.ExitError", err)
+			case exit.ExitStatus() != tt.status && tt.signal == "":
+				t.Errorf("exit status %d, want %d", exit.ExitStatus(), tt.status)
+			case exit.Signal() != tt.signal:
+				t.Errorf("exit signal %q, want %q", exit.Signal(), tt.signal)
+			}
+		})
+	}
+}
+
+func TestEnvRejected(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		keys string
+		env  string
+	}{
+		{name: "LD_PRELOAD", env: "LD_PRELOAD"},
+		{name: "PATH", env: "PATH"},
+		{name: "forced command", keys: `command="echo forced"`, env: "LANG"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, signer := testServer(t, tt.keys, nil)
+			c := dial(t, addr, ssh.PublicKeys(signer))
+			s, err := c.NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := s.Setenv(tt.env, "x"); err == nil {
+				t.Errorf("Setenv(%q) succeeded", tt.env)
+			}
+		})
+	}
+}
+
+func TestUnusedPTYClosed(t *testing.T) {
+	addr, signer := testServer(t, "", nil)
+	c := dial(t, addr, ssh.PublicKeys(signer))
+	fds := func() int {
+		d, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip(err)
+		}
+		return len(d)
+	}
+	before := fds()
+	s, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Skipf("RequestPty: %v", err)
+	}
+	s.Close()
+	for i := 0; fds() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d fds open, want %d: the pty was not closed", fds(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSFTPSubsystem(t *testing.T) {
+	addr, signer := testServer(t, "", nil)
+	c := dial(t, addr, ssh.PublicKeys(signer))
+	s, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	in, err := s.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestSubsystem("sftp"); err != nil {
+		t.Fatal(err)
+	}
+	// SSH_FXP_INIT of version 3.
+	if _, err := in.Write([]byte{0, 0, 0, 5, 1, 0, 0, 0, 3}); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(out, b); err != nil {
+		t.Fatal(err)
+	}
+	b = make([]byte, binary.BigEndian.Uint32(b))
+	if _, err := io.ReadFull(out, b); err != nil {
+		t.Fatal(err)
+	}
+	// SSH_FXP_VERSION 3, followed by extensions.
+	if len(b) < 5 || b[0] != 2 || !bytes.Equal(b[1:5], []byte{0, 0, 0, 3}) {
+		t.Errorf("got %x, want an SSH_FXP_VERSION 3 packet", b)
+	}
+	// The server ends the subsystem when the client closes its end.
+	in.Close()
+	if rest, err := io.ReadAll(out); len(rest) != 0 || err != nil {
+		t.Errorf("sftp subsystem ended with %q, %v, want no more output", rest, err)
+	}
+
+	s, err = c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.RequestSubsystem("nosuch"); err == nil {
+		t.Errorf("RequestSubsystem(nosuch) succeeded")
+	}
+}
+
+// echoServer accepts one connection and echoes it.
+func echoServer(t *testing.T, l net.Listener) {
+	t.Helper()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(c, c)
+		c.Close()
+	}()
+}
+
+func echo(t *testing.T, c net.Conn) {
+	t.Helper()
+	defer c.Close()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "ping" {
+		t.Errorf("read %q, %v, want ping", b, err)
+	}
+}
+
+func TestForwarding(t *testing.T) {
+	addr, signer := testServer(t, "", nil)
+	c := dial(t, addr, ssh.PublicKeys(signer))
+
+	t.Run("local", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		echoServer(t, l)
+		conn, err := c.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		echo(t, conn)
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		l, err := c.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		echoServer(t, l)
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		echo(t, conn)
+	})
+}
+
+func TestAuthorizedKeysOptions(t *testing.T) {
+	addr, signer := testServer(t, `command="echo forced $SSH_ORIGINAL_COMMAND",no-pty,no-port-forwarding`, nil)
+	c := dial(t, addr, ssh.PublicKeys(signer))
+
+	if out, err := run(t, c, nil, "echo hi"); out != "forced echo hi\n" || err != nil {
+		t.Errorf("run = %q, %v, want %q, nil", out, err, "forced echo hi\n")
+	}
+
+	s, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err == nil {
+		t.Errorf("RequestPty succeeded with no-pty")
+	}
+
+	if _, err := c.Dial("tcp", addr); err == nil {
+		t.Errorf("Dial succeeded with no-port-forwarding")
+	}
+	if _, err := c.Listen("tcp", "127.0.0.1:0"); err == nil {
+		t.Errorf("Listen succeeded with no-port-forwarding")
+	}
+}
+
+func TestPassword(t *testing.T) {
+	addr, _ := testServer(t, "", map[string]string{"root": "secret"})
+	c := dial(t, addr, ssh.Password("secret"))
+	if out, err := run(t, c, nil, "echo hi"); out != "hi\n" || err != nil {
+		t.Errorf("run = %q, %v, want %q, nil", out, err, "hi\n")
+	}
+
+	_, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.Password("wrong")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		t.Errorf("Dial with wrong password succeeded")
+	}
+}
+
+func TestParsePasswords(t *testing.T) {
+	users, err := parsePasswords([]byte("root:secret\n\nuser:a:b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(users); got != "map[root:secret user:a:b]" {
+		t.Errorf("parsePasswords = %s", got)
+	}
+	if _, err := parsePasswords([]byte("nopassword\n")); err == nil {
+		t.Errorf("parsePasswords of a line without password succeeded")
+	}
+}
+
+func TestLoadHostKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host_key")
+	created, err := loadHostKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadHostKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := created.PublicKey().Marshal(), loaded.PublicKey().Marshal(); !bytes.Equal(a, b) {
+		t.Errorf("loaded host key %s, want created %s", ssh.FingerprintSHA256(loaded.PublicKey()), ssh.FingerprintSHA256(created.PublicKey()))
+	}
+	if !strings.HasPrefix(created.PublicKey().Type(), "ssh-ed25519") {
+		t.Errorf("created %s host key, want ssh-ed25519", created.PublicKey().Type())
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Print the route packets take to a network host.
+//
+// Synopsis:
+//
+//	traceroute [-6InF] [-f FIRST_TTL] [-m MAX_TTL] [-q NQUERIES] [-w WAIT] [-p PORT] [-s SOURCE] [-i INTERFACE] HOST [PACKETLEN]
+//
+// Description:
+//
+//	traceroute sends probes with increasing TTLs, and prints the
+//	routers whose ICMP time exceeded errors come back, until the host
+//	replies. Probes are UDP datagrams to unlikely ports by default, or
+//	ICMP echo requests with -I. Reading ICMP errors takes a raw socket.
+//
+//	After each router, traceroute prints the round-trip time of each
+//	probe, * for probes without a reply, and annotations like !H, !N or
+//	!P for host, network or protocol unreachable errors.
+//
+// Options:
+//
+//	-6: use IPv6, the default for IPv6 addresses
+//	-I: probe with ICMP echo requests
+//	-n: print addresses without looking up their names
+//	-F: set the don't fragment bit
+//	-f: TTL of the first probes (default: 1)
+//	-m: maximum TTL (default: 30)
+//	-q: number of probes per TTL (default: 3)
+//	-w: time to wait for a reply, in seconds (default: 5)
+//	-p: destination port of the first UDP probe, incremented by each probe (default: 33434)
+//	-s: source address to send from
+//	-i: interface to send through
+//	PACKETLEN: length of the probe packets, headers included (default: 60, or 80 for IPv6)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ping"
+	"github.com/u-root/u-root/pkg/uroot/util"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const usage = "traceroute [-6] [-I] [-n] [-F] [-f first_ttl] [-m max_ttl] [-q nqueries] [-w wait] [-p port] [-s source] [-i interface] host [packetlen]"
+
+var (
+	errTTL      = errors.New("first TTL must be between 1 and the maximum TTL, at most 255")
+	errQueries  = errors.New("number of probes per TTL must be at least 1")
+	errSource   = errors.New("bad source address")
+	errTooSmall = errors.New("packet length too small")
+)
+
+type params struct {
+	host      string
+	packetLen int
+	net6      bool
+	icmp      bool
+	numeric   bool
+	dontFrag  bool
+	firstTTL  int
+	maxTTL    int
+	nqueries  int
+	wait      time.Duration
+	port      int
+	source    string
+	iface     string
+}
+
+type cmd struct {
+	stdout io.Writer
+	// conn reads the replies, and sends ICMP probes.
+	conn *ping.Conn
+	// udp sends UDP probes, unless probing with ICMP.
+	udp net.PacketConn
+	// setTTL sets the TTL of the probes.
+	setTTL func(ttl int) error
+	params
+}
+
+func command(stdout io.Writer, p params) (*cmd, error) {
+	if p.firstTTL < 1 || p.firstTTL > p.maxTTL || p.maxTTL > 255 {
+		return nil, errTTL
+	}
+	if p.nqueries < 1 {
+		return nil, errQueries
+	}
+	if ip := net.ParseIP(p.host); ip != nil && ip.To4() == nil {
+		p.net6 = true
+	}
+	o := &ping.Opts{IPv6: p.net6, Interface: p.iface, Raw: true}
+	if p.source != "" {
+		if o.Source = net.ParseIP(p.source); o.Source == nil {
+			return nil, fmt.Errorf("%w: %q", errSource, p.source)
+		}
+	}
+	if p.dontFrag {
+		o.PMTUDisc = ping.PMTUDiscDo
+	}
+	conn, err := ping.Listen(o)
+	if err != nil {
+		return nil, err
+	}
+	c := &cmd{stdout: stdout, conn: conn, setTTL: conn.SetTTL, params: p}
+	if !p.icmp {
+		if c.udp, err = ping.ListenUDP(o); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.setTTL = func(ttl int) error {
+			return ping.SetTTL(c.udp, p.net6, ttl)
+		}
+	}
+	return c, nil
+}
+
+func (c *cmd) run() error {
+	defer c.conn.Close()
+	if c.udp != nil {
+		defer c.udp.Close()
+	}
+
+	network, hlen := "ip4", ipv4.HeaderLen+8
+	if c.net6 {
+		network, hlen = "ip6", ipv6.HeaderLen+8
+	}
+	if c.packetLen == 0 {
+		c.packetLen = hlen + 32
+	}
+	if c.packetLen < hlen {
+		return fmt.Errorf("%w: %d < %d", errTooSmall, c.packetLen, hlen)
+	}
+	addr, err := net.ResolveIPAddr(network, c.host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve address: %v", err)
+	}
+	data := make([]byte, c.packetLen-hlen)
+
+	fmt.Fprintf(c.stdout, "traceroute to %s (%v), %d hops max, %d byte packets\n", c.host, addr, c.maxTTL, c.packetLen)
+	seq := 0
+	for ttl := c.firstTTL; ttl <= c.maxTTL; ttl++ {
+		if err := c.setTTL(ttl); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "%2d ", ttl)
+		var last net.IP
+		var reached, replies, unreachable int
+		for q := 0; q < c.nqueries; q++ {
+			seq++
+			sent := time.Now()
+			if err := c.probe(addr, seq, data); err != nil {
+				return err
+			}
+			r, err := c.reply(addr, seq, sent.Add(c.wait))
+			if err != nil {
+				return err
+			}
+			if r == nil {
+				fmt.Fprint(c.stdout, " *")
+				continue
+			}
+			replies++
+			if !r.From.Equal(last) {
+				fmt.Fprintf(c.stdout, " %s", c.name(r.From))
+				last = r.From
+			}
+			fmt.Fprintf(c.stdout, "  %s ms", ping.Millis(r.Received.Sub(sent)))
+			switch a := annotation(r); a {
+			case "":
+			case "reached":
+				reached++
+			default:
+				unreachable++
+				fmt.Fprintf(c.stdout, " %s", a)
+			}
+		}
+		fmt.Fprintln(c.stdout)
+		if reached > 0 || (unreachable > 0 && unreachable == replies) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *cmd) probe(dst *net.IPAddr, seq int, data []byte) error {
+	if c.udp == nil {
+		return c.conn.WriteEcho(dst, seq, data)
+	}
+	_, err := c.udp.WriteTo(data, &net.UDPAddr{IP: dst.IP, Zone: dst.Zone, Port: c.probePort(seq)})
+	return err
+}
+
+func (c *cmd) probePort(seq int) int {
+	return (c.port + seq - 1) & 0xffff
+}
+
+// reply returns the reply to the probe seq, or nil if there is none by
+// until.
+func (c *cmd) reply(dst *net.IPAddr, seq int, until time.Time) (*ping.Reply, error) {
+	c.conn.SetReadDeadline(until)
+	for {
+		r, err := c.conn.Read()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.icmp && r.Seq == seq && (r.EchoReply() || r.Dst.Equal(dst.IP)) {
+			return r, nil
+		}
+		if !c.icmp && r.Proto == ping.ProtoUDP && r.Port == c.probePort(seq) && r.Dst.Equal(dst.IP) {
+			return r, nil
+		}
+	}
+}
+
+// annotation returns "reached" if r is from the destination, or the
+// annotation of traceroute for unreachable errors.
+func annotation(r *ping.Reply) string {
+	if r.EchoReply() {
+		return "reached"
+	}
+	var code int
+	switch r.Type {
+	case ipv4.ICMPTypeDestinationUnreachable:
+		code = r.Code
+	case ipv6.ICMPTypeDestinationUnreachable:
+		// Map the codes of ICMPv6 to those of ICMP.
+		switch r.Code {
+		case 0:
+			code = 0
+		case 1:
+			code = 13
+		case 3:
+			code = 1
+		case 4:
+			code = 3
+		default:
+			return fmt.Sprintf("!<%d>", r.Code)
+		}
+	default:
+		return ""
+	}
+	switch code {
+	case 0:
+		return "!N"
+	case 1:
+		return "!H"
+	case 2:
+		return "!P"
+	case 3:
+		// Port unreachable is the reply of the destination to UDP
+		// probes.
+		return "reached"
+	case 4:
+		return fmt.Sprintf("!F-%d", r.MTU)
+	case 5:
+		return "!S"
+	case 9, 10, 13:
+		return "!X"
+	}
+	return fmt.Sprintf("!<%d>", r.Code)
+}
+
+// name returns the name and address of ip, as traceroute prints hops.
+func (c *cmd) name(ip net.IP) string {
+	if c.numeric {
+		return ip.String()
+	}
+	if names, err := net.LookupAddr(ip.String()); err == nil && len(names) > 0 {
+		return fmt.Sprintf("%s (%v)", strings.TrimSuffix(names[0], "."), ip)
+	}
+	return fmt.Sprintf("%v (%v)", ip, ip)
+}
+
+func main() {
+	var (
+		net6     = flag.Bool("6", false, "use IPv6")
+		icmp     = flag.Bool("I", false, "probe with ICMP echo requests")
+		numeric  = flag.Bool("n", false, "print addresses without looking up their names")
+		dontFrag = flag.Bool("F", false, "set the don't fragment bit")
+		firstTTL = flag.Int("f", 1, "TTL of the first probes")
+		maxTTL   = flag.Int("m", 30, "maximum TTL")
+		nqueries = flag.Int("q", 3, "number of probes per TTL")
+		wait     = flag.Float64("w", 5, "time to wait for a reply, in seconds")
+		port     = flag.Int("p", 33434, "destination port of the first UDP probe")
+		source   = flag.String("s", "", "source address to send from")
+		iface    = flag.String("i", "", "interface to send through")
+	)
+
+	flag.Usage = util.Usage(flag.Usage, usage)
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	var packetLen int
+	if flag.NArg() == 2 {
+		var err error
+		if packetLen, err = strconv.Atoi(flag.Arg(1)); err != nil {
+			log.Fatalf("bad packet length %q: %v", flag.Arg(1), err)
+		}
+	}
+	cmd, err := command(os.Stdout, params{
+		host:      flag.Arg(0),
+		packetLen: packetLen,
+		net6:      *net6,
+		icmp:      *icmp,
+		numeric:   *numeric,
+		dontFrag:  *dontFrag,
+		firstTTL:  *firstTTL,
+		maxTTL:    *maxTTL,
+		nqueries:  *nqueries,
+		wait:      time.Duration(*wait * float64(time.Second)),
+		port:      *port,
+		source:    *source,
+		iface:     *iface,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.run(); err != nil {
+		log.Fatal(err)
+	}
+}
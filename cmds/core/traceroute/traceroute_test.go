@@ -0,0 +1,220 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+var dst = net.IPv4(192, 0, 2, 1).To4()
+
+// network simulates a destination hops routers away. Router n is at
+// 10.0.0.n.
+type network struct {
+	t    *testing.T
+	hops int
+	ttl  int
+	// silent are the TTLs that get no reply, and unreachable the TTL
+	// whose router replies with host unreachable.
+	silent      map[int]bool
+	unreachable int
+
+	replies []packet
+}
+
+type packet struct {
+	b    []byte
+	from net.IP
+}
+
+func (n *network) reply(m icmp.Message, from net.IP) {
+	b, err := m.Marshal(nil)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	n.replies = append(n.replies, packet{b, from})
+}
+
+// probe simulates the probe of proto with the first 8 bytes of payload.
+func (n *network) probe(proto int, payload []byte, final icmp.Message) {
+	if n.silent[n.ttl] {
+		return
+	}
+	router := net.IPv4(10, 0, 0, byte(n.ttl)).To4()
+	h := make([]byte, ipv4.HeaderLen)
+	h[0], h[9] = 0x45, byte(proto)
+	copy(h[16:], dst)
+	quote := append(h, payload[:8]...)
+	switch {
+	case n.ttl == n.unreachable:
+		n.reply(icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 1, Body: &icmp.DstUnreach{Data: quote}}, router)
+	case n.ttl < n.hops:
+		n.reply(icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quote}}, router)
+	default:
+		if final.Type == ipv4.ICMPTypeDestinationUnreachable {
+			final.Body = &icmp.DstUnreach{Data: quote}
+		}
+		n.reply(final, dst)
+	}
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Close() error                       { return nil }
+func (fakeConn) LocalAddr() net.Addr                { return nil }
+func (fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// icmpConn reads the replies of the network, and sends echo requests.
+type icmpConn struct {
+	fakeConn
+	n *network
+}
+
+func (c *icmpConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if len(c.n.replies) == 0 {
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+	p := c.n.replies[0]
+	c.n.replies = c.n.replies[1:]
+	return copy(b, p.b), &net.IPAddr{IP: p.from}, nil
+}
+
+func (c *icmpConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	m, err := icmp.ParseMessage(ping.ProtoICMP, b)
+	if err != nil {
+		return 0, err
+	}
+	echo := m.Body.(*icmp.Echo)
+	c.n.probe(ping.ProtoICMP, b, icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: echo})
+	return len(b), nil
+}
+
+// udpConn sends UDP probes.
+type udpConn struct {
+	fakeConn
+	n *network
+}
+
+func (c *udpConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return 0, nil, os.ErrDeadlineExceeded
+}
+
+func (c *udpConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	port := addr.(*net.UDPAddr).Port
+	h := []byte{0x80, 0, byte(port >> 8), byte(port), 0, byte(8 + len(b)), 0, 0}
+	c.n.probe(ping.ProtoUDP, h, icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 3})
+	return len(b), nil
+}
+
+var times = regexp.MustCompile(`\d+\.\d{3} ms`)
+
+func TestTraceroute(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		n      network
+		params params
+		want   string
+	}{
+		{
+			name:   "udp",
+			n:      network{hops: 3},
+			params: params{nqueries: 2},
+			want: `traceroute to 192.0.2.1 (192.0.2.1), 30 hops max, 60 byte packets
+ 1  10.0.0.1  X ms  X ms
+ 2  10.0.0.2  X ms  X ms
+ 3  192.0.2.1  X ms  X ms
+`,
+		},
+		{
+			name:   "icmp",
+			n:      network{hops: 4, silent: map[int]bool{2: true}},
+			params: params{icmp: true, nqueries: 3, packetLen: 100},
+			want: `traceroute to 192.0.2.1 (192.0.2.1), 30 hops max, 100 byte packets
+ 1  10.0.0.1  X ms  X ms  X ms
+ 2  * * *
+ 3  10.0.0.3  X ms  X ms  X ms
+ 4  192.0.2.1  X ms  X ms  X ms
+`,
+		},
+		{
+			name:   "unreachable",
+			n:      network{hops: 5, unreachable: 2},
+			params: params{nqueries: 2},
+			want: `traceroute to 192.0.2.1 (192.0.2.1), 30 hops max, 60 byte packets
+ 1  10.0.0.1  X ms  X ms
+ 2  10.0.0.2  X ms !H  X ms !H
+`,
+		},
+		{
+			name:   "max ttl",
+			n:      network{hops: 5},
+			params: params{nqueries: 1, firstTTL: 2, maxTTL: 3},
+			want: `traceroute to 192.0.2.1 (192.0.2.1), 3 hops max, 60 byte packets
+ 2  10.0.0.2  X ms
+ 3  10.0.0.3  X ms
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.n.t = t
+			p := tt.params
+			p.host, p.numeric, p.wait, p.port = dst.String(), true, time.Second, 33434
+			if p.firstTTL == 0 {
+				p.firstTTL, p.maxTTL = 1, 30
+			}
+			var stdout bytes.Buffer
+			c := &cmd{
+				stdout: &stdout,
+				conn:   ping.NewConn(&icmpConn{n: &tt.n}, false, false),
+				setTTL: func(ttl int) error {
+					tt.n.ttl = ttl
+					return nil
+				},
+				params: p,
+			}
+			if !p.icmp {
+				c.udp = &udpConn{n: &tt.n}
+			}
+			if err := c.run(); err != nil {
+				t.Fatalf("run() = %v", err)
+			}
+			if got := times.ReplaceAllString(stdout.String(), "X ms"); got != tt.want {
+				t.Errorf("run() printed\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		p    params
+		err  error
+	}{
+		{name: "first ttl", p: params{firstTTL: 0, maxTTL: 30, nqueries: 3}, err: errTTL},
+		{name: "first ttl above max", p: params{firstTTL: 5, maxTTL: 4, nqueries: 3}, err: errTTL},
+		{name: "max ttl", p: params{firstTTL: 1, maxTTL: 256, nqueries: 3}, err: errTTL},
+		{name: "queries", p: params{firstTTL: 1, maxTTL: 30}, err: errQueries},
+		{name: "source", p: params{firstTTL: 1, maxTTL: 30, nqueries: 3, source: "nowhere"}, err: errSource},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := command(nil, tt.p); !errors.Is(err, tt.err) {
+				t.Errorf("command() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
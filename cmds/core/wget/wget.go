@@ -6,12 +6,31 @@
 //
 // Synopsis:
 //
-//	wget URL
+//	wget [OPTIONS] URL
 //
 // Description:
 //
 //	Returns a non-zero code on failure.
 //
+//	HTTP(S) downloads that fail midway resume where they stopped, and
+//	HTTP_PROXY, HTTPS_PROXY and NO_PROXY name the proxies to use.
+//
+//	With -c, files that cannot be continued, like those of TFTP or
+//	servers without ranges, are downloaded again from the start.
+//
+// Options:
+//
+//	-O FILE:                output file
+//	-c:                     continue a partial download of the output file
+//	-q:                     do not show progress
+//	-t N:                   number of tries
+//	--user, --password:     basic authentication credentials
+//	--bearer-token TOKEN:   bearer authentication token
+//	--ca-certificate FILE:  PEM file of the CAs to trust for HTTPS
+//	--certificate FILE:     PEM file of the client certificate for HTTPS
+//	--private-key FILE:     PEM file of the client certificate's key
+//	--sha256 HASH:          expected SHA-256 of the file, in hex
+//
 // Notes:
 //
 //	There are a few differences with GNU wget:
@@ -25,31 +44,51 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/u-root/u-root/pkg/curl"
-	"github.com/u-root/uio/uio"
+	"github.com/u-root/u-root/pkg/progress"
+	"github.com/u-root/u-root/pkg/vfile"
 )
 
-var errEmptyURL = errors.New("empty url")
+var (
+	errEmptyURL = errors.New("empty url")
+	errTries    = errors.New("number of tries must be at least 1")
+)
 
 type cmd struct {
 	url        string
 	outputPath string
+	resume     bool
+	quiet      bool
+	tries      int
+	user       string
+	password   string
+	token      string
+	caFile     string
+	certFile   string
+	keyFile    string
+	sha256     string
+	stderr     io.Writer
 }
 
 // flags parses wget flags
 // wget is old school, and allows flags after the URL.
 // This code does not process the -- flag specified in the
 // man page, as the command itself does not seem to either.
-func flags(args ...string) (string, string, error) {
+func flags(args ...string) (*cmd, error) {
 	// -- takes priority over everything else.
 	// flag package does not allow - as a flag.
 	// except, in spite of the docs, wget on linux seems
@@ -60,43 +99,81 @@ func flags(args ...string) (string, string, error) {
 	// the slices package is a good place to start.
 
 	if len(args) == 0 {
-		return "", "", errEmptyURL
+		return nil, errEmptyURL
 	}
 
+	c := &cmd{stderr: os.Stderr}
 	f := flag.NewFlagSet(args[0], flag.ContinueOnError)
-	var outPath = f.String("O", "", "output file")
+	f.StringVar(&c.outputPath, "O", "", "output file")
+	f.BoolVar(&c.resume, "c", false, "continue a partial download")
+	f.BoolVar(&c.quiet, "q", false, "do not show progress")
+	f.IntVar(&c.tries, "t", 20, "number of tries")
+	f.StringVar(&c.user, "user", "", "user for basic authentication")
+	f.StringVar(&c.password, "password", "", "password for basic authentication")
+	f.StringVar(&c.token, "bearer-token", "", "token for bearer authentication")
+	f.StringVar(&c.caFile, "ca-certificate", "", "PEM file of the CAs to trust")
+	f.StringVar(&c.certFile, "certificate", "", "PEM file of the client certificate")
+	f.StringVar(&c.keyFile, "private-key", "", "PEM file of the client certificate's key")
+	f.StringVar(&c.sha256, "sha256", "", "expected SHA-256 of the file, in hex")
 
 	if err := f.Parse(args[1:]); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	if len(f.Args()) == 0 {
-		return "", "", errEmptyURL
+		return nil, errEmptyURL
 	}
 
-	URL := f.Args()[0]
+	c.url = f.Args()[0]
 
 	// Now, it is allowed to have switches after the URL,
 	// handle following flags
 	if err := f.Parse(f.Args()[1:]); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return *outPath, URL, nil
+	if c.tries < 1 {
+		return nil, errTries
+	}
+	return c, nil
 }
 
 func command(args ...string) (*cmd, error) {
-	outPath, URL, err := flags(args...)
+	return flags(args...)
+}
+
+// httpScheme returns the FileScheme of HTTP and HTTPS URLs, which retries
+// and resumes downloads.
+func (c *cmd) httpScheme() (curl.FileScheme, error) {
+	tlsConfig, err := curl.LoadTLSConfig(c.caFile, c.certFile, c.keyFile)
 	if err != nil {
 		return nil, err
 	}
-
-	return &cmd{
-		outputPath: outPath,
-		url:        URL,
+	var opts []curl.HTTPClientOpt
+	if c.user != "" || c.password != "" {
+		opts = append(opts, curl.WithBasicAuth(c.user, c.password))
+	}
+	if c.token != "" {
+		opts = append(opts, curl.WithBearerToken(c.token))
+	}
+	hc := curl.NewHTTPClient(&http.Client{Transport: curl.NewHTTPTransport(nil, tlsConfig)}, opts...)
+	return &curl.SchemeWithRetries{
+		Scheme:  hc,
+		DoRetry: curl.RetryTemporaryNetworkErrors,
+		BackOff: backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(c.tries-1)),
 	}, nil
 }
 
+// countWriter counts the bytes written for progress.
+type countWriter struct {
+	n *int64
+}
+
+func (w countWriter) Write(b []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(b)))
+	return len(b), nil
+}
+
 func (c *cmd) run() error {
 	log.SetPrefix("wget: ")
 
@@ -113,24 +190,94 @@ func (c *cmd) run() error {
 		c.outputPath = defaultOutputPath(parsedURL.Path)
 	}
 
+	var wantHash []byte
+	if c.sha256 != "" {
+		if wantHash, err = hex.DecodeString(c.sha256); err != nil {
+			return fmt.Errorf("bad SHA-256 %q: %w", c.sha256, err)
+		}
+	}
+
+	hs, err := c.httpScheme()
+	if err != nil {
+		return err
+	}
 	schemes := curl.Schemes{
 		"tftp": curl.DefaultTFTPClient,
-		"http": curl.DefaultHTTPClient,
+		"http": hs,
 
 		// curl.DefaultSchemes doesn't support HTTPS by default.
-		"https": curl.DefaultHTTPClient,
+		"https": hs,
 		"file":  &curl.LocalFileClient{},
 	}
 
-	reader, err := schemes.FetchWithoutCache(context.Background(), parsedURL)
+	var offset int64
+	oflag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if c.resume {
+		if fi, err := os.Stat(c.outputPath); err == nil {
+			offset = fi.Size()
+			oflag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+	}
+
+	var reader io.Reader
+	if offset > 0 {
+		reader, err = schemes.FetchRange(context.Background(), parsedURL, offset)
+		var cerr *curl.HTTPClientCodeError
+		if errors.As(err, &cerr) && cerr.HTTPCode == http.StatusRequestedRangeNotSatisfiable {
+			log.Printf("%s is already fully retrieved", c.outputPath)
+			return c.verify(wantHash)
+		}
+		if errors.Is(err, curl.ErrRangeNotSupported) || errors.Is(err, curl.ErrRangeIgnored) {
+			log.Printf("Cannot continue %s, downloading all of it: %v", c.outputPath, err)
+			offset, oflag = 0, os.O_CREATE|os.O_WRONLY|os.O_TRUNC
+		}
+	}
+	if offset == 0 {
+		reader, err = schemes.FetchWithoutCache(context.Background(), parsedURL)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to download %v: %w", c.url, err)
 	}
 
-	if err := uio.ReadIntoFile(reader, c.outputPath); err != nil {
+	f, err := os.OpenFile(c.outputPath, oflag, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mode := "progress"
+	if c.quiet {
+		mode = "none"
+	}
+	n := offset
+	p := progress.New(c.stderr, mode, &n)
+	p.Begin()
+	_, err = io.Copy(io.MultiWriter(f, countWriter{&n}), reader)
+	p.End()
+	if err != nil {
+		return fmt.Errorf("failed to download %v: %w", c.url, err)
+	}
+	if err := f.Close(); err != nil {
 		return err
 	}
 
+	return c.verify(wantHash)
+}
+
+// verify checks the output file against the expected SHA-256, if any, and
+// removes it if it does not match.
+func (c *cmd) verify(wantHash []byte) error {
+	if wantHash == nil {
+		return nil
+	}
+	f, err := vfile.OpenHashedFile256(c.outputPath, wantHash)
+	if f != nil {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(c.outputPath)
+		return err
+	}
 	return nil
 }
 
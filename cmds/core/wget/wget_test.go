@@ -9,16 +9,21 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/vfile"
 )
 
 const content = "Very simple web server"
@@ -206,12 +211,17 @@ func TestFlags(t *testing.T) {
 		{name: "opt but no url", args: []string{"wget", "-O", "b"}, out: "", url: "", err: errEmptyURL},
 		{name: "url with -O first", args: []string{"wget", "-O", "b", "a"}, out: "b", url: "a", err: nil},
 		{name: "url with -O last", args: []string{"wget", "a", "-O", "b"}, out: "b", url: "a", err: nil},
+		{name: "no tries", args: []string{"wget", "-t", "0", "a"}, out: "", url: "", err: errTries},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			o, u, err := flags(tt.args...)
+			c, err := flags(tt.args...)
 			if !errors.Is(err, tt.err) {
 				t.Errorf("err:got %v, want %v", err, tt.err)
 			}
+			var o, u string
+			if c != nil {
+				o, u = c.outputPath, c.url
+			}
 			if o != tt.out {
 				t.Errorf("out:got %q, want %q", o, tt.out)
 			}
@@ -222,3 +232,115 @@ func TestFlags(t *testing.T) {
 
 	}
 }
+
+// rangeHandler serves content with ranges, unless noRanges, and drops the
+// first response midway. /auth needs basic authentication.
+type rangeHandler struct {
+	content  string
+	dropped  bool
+	noRanges bool
+}
+
+func (h *rangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/auth" {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if !h.dropped {
+		h.dropped = true
+		w.Header().Set("Content-Length", fmt.Sprint(len(h.content)))
+		w.Write([]byte(h.content[:len(h.content)/2]))
+		panic(http.ErrAbortHandler)
+	}
+	if h.noRanges {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(h.content))
+}
+
+func TestDownload(t *testing.T) {
+	content := strings.Repeat("u-root ", 10000)
+	sum := sha256.Sum256([]byte(content))
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		path     string
+		partial  string
+		noRanges bool
+		err      error
+		badHash  bool
+	}{
+		{name: "drop", path: "/file"},
+		{name: "continue", args: []string{"-c"}, path: "/file", partial: content[:1000]},
+		{name: "complete", args: []string{"-c"}, path: "/file", partial: content},
+		{name: "continue without ranges", args: []string{"-c"}, path: "/file", partial: "old", noRanges: true},
+		{name: "overwrite", path: "/file", partial: "old"},
+		{name: "sha256", args: []string{"--sha256", hex.EncodeToString(sum[:])}, path: "/file"},
+		{name: "bad sha256", args: []string{"--sha256", "00"}, path: "/file", badHash: true},
+		{name: "auth", args: []string{"--user", "user", "--password", "pass"}, path: "/auth"},
+		{name: "no auth", path: "/auth", err: curl.ErrStatusNotOk},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(&rangeHandler{content: content, dropped: tt.partial != "", noRanges: tt.noRanges})
+			defer srv.Close()
+			out := filepath.Join(t.TempDir(), "out")
+			if tt.partial != "" {
+				if err := os.WriteFile(out, []byte(tt.partial), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			args := append([]string{"wget", "-q", "-O", out}, tt.args...)
+			c, err := command(append(args, srv.URL+tt.path)...)
+			if err == nil {
+				err = c.run()
+			}
+			var herr vfile.ErrInvalidHash
+			if errors.As(err, &herr) != tt.badHash {
+				t.Fatalf("run() = %v, want hash error %t", err, tt.badHash)
+			}
+			if tt.badHash {
+				if _, err := os.Stat(out); err == nil {
+					t.Errorf("%s with a bad hash was kept", out)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("run() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("got %d bytes, want %d bytes of content", len(got), len(content))
+			}
+		})
+	}
+}
+
+func TestContinueFile(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	if err := os.WriteFile(in, []byte("new content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := command("wget", "-q", "-c", "-O", out, "file://"+in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run(); err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+	if got, err := os.ReadFile(out); err != nil || string(got) != "new content" {
+		t.Errorf("got %q, %v, want %q", got, err, "new content")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// cbfs lists, extracts and adds the files of coreboot images.
+//
+// Synopsis:
+//
+//	cbfs IMAGE print
+//	cbfs IMAGE layout
+//	cbfs IMAGE extract -n NAME -f FILE
+//	cbfs IMAGE add -n NAME -f FILE [-t TYPE] [-c COMPRESSION]
+//	cbfs IMAGE elog
+//
+// Description:
+//
+//	cbfs works on images like cbfstool does. print lists the files of
+//	CBFS, in the COREBOOT area of the flash map, or where the master
+//	header says; layout lists the areas of the flash map; extract writes a
+//	file, decompressed, to FILE; add adds FILE to the first empty space big
+//	enough for it; and elog prints the event log, in the RW_ELOG area.
+//
+//	To patch the flash chip, read it to IMAGE with flash -r, and write
+//	IMAGE back with flash -w.
+//
+// Options:
+//
+//	-n: name of the file in CBFS
+//	-f: file to extract to or add
+//	-t: type of the file added (default: raw)
+//	-c: compression of the file added: none, LZMA or LZ4 (default: none)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/coreboot"
+)
+
+const usage = "usage: cbfs IMAGE print|layout|extract|add|elog [OPTIONS]"
+
+var errUsage = errors.New(usage)
+
+func run(args []string, w io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	image, cmd := args[0], args[1]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(w)
+	name := fs.String("n", "", "name of the file in CBFS")
+	file := fs.String("f", "", "file to extract to or add")
+	typ := fs.String("t", "raw", "type of the file added")
+	comp := fs.String("c", "none", "compression of the file added: none, LZMA or LZ4")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errUsage
+	}
+
+	mode := os.O_RDONLY
+	if cmd == "add" {
+		mode = os.O_RDWR
+	}
+	f, err := os.OpenFile(image, mode, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	switch cmd {
+	case "print":
+		c, err := coreboot.ReadCBFS(f, size)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "CBFS of %d bytes at %#x, aligned to %d\n", c.Size, c.Offset, c.Align)
+		fmt.Fprintf(w, "%-32s %-10s %-12s %8s %s\n", "Name", "Offset", "Type", "Size", "Comp")
+		for _, f := range c.Files {
+			fmt.Fprintln(w, f)
+		}
+	case "layout":
+		m, err := coreboot.ReadFMAP(f, size)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "FMAP %q at %#x, version %d.%d, base %#x, %#x bytes\n", m.Name, m.Offset, m.VerMajor, m.VerMinor, m.Base, m.Size)
+		for _, a := range m.Areas {
+			fmt.Fprintln(w, a)
+		}
+	case "extract":
+		if *name == "" || *file == "" {
+			return errUsage
+		}
+		c, err := coreboot.ReadCBFS(f, size)
+		if err != nil {
+			return err
+		}
+		b, err := c.ReadFile(*name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(*file, b, 0o644)
+	case "add":
+		if *name == "" || *file == "" {
+			return errUsage
+		}
+		t, err := coreboot.ParseFileType(*typ)
+		if err != nil {
+			return err
+		}
+		cp, err := coreboot.ParseCompression(*comp)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		c, err := coreboot.ReadCBFS(f, size)
+		if err != nil {
+			return err
+		}
+		if err := c.AddFile(f, *name, t, b, cp); err != nil {
+			return err
+		}
+		return f.Close()
+	case "elog":
+		events, err := coreboot.ReadEventLog(f, size)
+		for i, e := range events {
+			fmt.Fprintf(w, "%d | %v\n", i, e)
+		}
+		return err
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/coreboot"
+)
+
+// genImage writes a 128K image with a flash map and an empty CBFS.
+func genImage(t *testing.T) string {
+	t.Helper()
+	m := &coreboot.FMAP{
+		VerMajor: 1,
+		VerMinor: 1,
+		Size:     0x20000,
+		Name:     "FLASH",
+		Areas: []coreboot.FMAPArea{
+			{Offset: 0x100, Size: 0x100, Name: "FMAP", Flags: coreboot.FMAP_AREA_STATIC},
+			{Offset: 0x10000, Size: 0x10000, Name: "COREBOOT"},
+		},
+	}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "coreboot.rom")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(bytes.Repeat([]byte{0xff}, 0x20000), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(b, 0x100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coreboot.NewCBFS(f, 0x10000, 0x10000); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestCBFS(t *testing.T) {
+	image := genImage(t)
+	d := t.TempDir()
+	payload := filepath.Join(d, "payload")
+	if err := os.WriteFile(payload, bytes.Repeat([]byte("u-root"), 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(d, "out")
+
+	for _, tt := range []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{args: []string{image, "layout"}, want: []string{`FMAP "FLASH" at 0x100`, "COREBOOT"}},
+		{args: []string{image, "add", "-n", "fallback/payload", "-f", payload, "-t", "simple elf", "-c", "lz4"}},
+		{args: []string{image, "add", "-n", "config", "-f", payload}},
+		{args: []string{image, "print"}, want: []string{"CBFS of 65536 bytes at 0x10000", "fallback/payload", "simple elf", "LZ4", "config"}},
+		{args: []string{image, "extract", "-n", "fallback/payload", "-f", out}},
+		{args: []string{image, "extract", "-n", "none", "-f", out}, err: coreboot.ErrNoCBFSFile},
+		{args: []string{image, "add", "-n", "config", "-f", payload}, err: coreboot.ErrCBFSFileExists},
+		{args: []string{image, "add", "-n", "x", "-f", payload, "-t", "bogus"}, err: coreboot.ErrBadCBFS},
+		{args: []string{image, "elog"}, err: coreboot.ErrNoFMAPArea},
+		{args: []string{image, "extract"}, err: errUsage},
+		{args: []string{image, "format"}, err: errUsage},
+		{args: []string{image}, err: errUsage},
+	} {
+		var b bytes.Buffer
+		if err := run(tt.args, &b); !errors.Is(err, tt.err) {
+			t.Errorf("cbfs %q = %v, want %v", tt.args[1:], err, tt.err)
+			continue
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(b.String(), s) {
+				t.Errorf("cbfs %q = %q, want it to contain %q", tt.args[1:], b.String(), s)
+			}
+		}
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := os.ReadFile(payload); !bytes.Equal(got, want) {
+		t.Errorf("extracted %q, want %q", got, want)
+	}
+}
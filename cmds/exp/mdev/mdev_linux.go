@@ -0,0 +1,104 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mdev - manage device nodes and modules of hotplugged devices
+//
+// Synopsis:
+//
+//	mdev [-s] [-d] [-c rules] [-v]
+//
+// Description:
+//
+//	mdev replays the uevents of the devices that exist with -s, and
+//	handles those of devices that come and go with -d, until killed.
+//	Without either, it does both.
+//
+//	For each device it loads the modules matching its MODALIAS, creates
+//	its device node, and creates /dev/disk/by-uuid, by-label,
+//	by-partuuid and by-path links for block devices. The rules file,
+//	/etc/mdev.conf by default, sets owners and modes of device nodes and
+//	commands to run for them, like busybox mdev's:
+//
+//	[-][$VAR=]regex user:group mode [@|$|*command]
+//
+// Options:
+//
+//	-s: coldplug: handle the devices that exist
+//	-d: daemon: handle devices as they come and go
+//	-c: rules file
+//	-v: log every event
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/hotplug"
+	"github.com/u-root/u-root/pkg/uevent"
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+var (
+	scan    = flag.Bool("s", false, "handle the devices that exist")
+	daemon  = flag.Bool("d", false, "handle devices as they come and go")
+	rules   = flag.String("c", "/etc/mdev.conf", "rules file")
+	verbose = flag.Bool("v", false, "log every event")
+)
+
+// verboseReader logs the events it reads.
+type verboseReader struct {
+	hotplug.EventReader
+}
+
+func (v verboseReader) Read() (*uevent.Event, error) {
+	e, err := v.EventReader.Read()
+	if err == nil {
+		log.Printf("%s %s", e.Action, e.DevPath)
+	}
+	return e, err
+}
+
+func run() error {
+	if !*scan && !*daemon {
+		*scan, *daemon = true, true
+	}
+
+	m := &hotplug.Manager{Logger: ulog.Log}
+	r, err := hotplug.ReadRules(*rules)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	m.Rules = r
+
+	// Listen before coldplugging so no device falls between the two.
+	var conn *uevent.Conn
+	if *daemon {
+		if conn, err = uevent.Listen(); err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	if *scan {
+		if err := m.Coldplug(); err != nil {
+			log.Print(err)
+		}
+	}
+	if conn == nil {
+		return nil
+	}
+	var events hotplug.EventReader = conn
+	if *verbose {
+		events = verboseReader{conn}
+	}
+	return m.Run(events)
+}
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		log.Fatalf("mdev: %v", err)
+	}
+}
@@ -8,6 +8,14 @@
 //
 //	modprobe [-n] modulename [parameters...]
 //	modprobe [-n] -a modulename...
+//	modprobe [-n] -r modulename...
+//	modprobe --show-depends modulename [parameters...]
+//
+// Description:
+//
+//	modulename may also be an alias of modules, like a device's modalias.
+//	The options, blacklist, install, remove, softdep and alias directives
+//	of modprobe.d apply.
 //
 // Author:
 //
@@ -16,6 +24,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -23,7 +32,7 @@ import (
 	"github.com/u-root/u-root/pkg/kmodule"
 )
 
-const cmd = "modprobe [-an] modulename[s] [parameters...]"
+const cmd = "modprobe [-anr] [--show-depends] modulename[s] [parameters...]"
 
 var (
 	dryRun     = flag.Bool("n", false, "Dry run")
@@ -31,6 +40,10 @@ var (
 	verboseAll = flag.Bool("va", false, "Insert all module names on the command line.")
 	rootDir    = flag.String("d", "/", "Root directory for modules")
 	kernelVer  = flag.String("S", "", "Set kernel version instead of using uname")
+	remove     = flag.Bool("r", false, "Remove the modules on the command line and their unused dependencies.")
+	showDeps   = flag.Bool("show-depends", false, "List what would be loaded, and how, instead of loading it.")
+	configDir  = flag.String("C", "", "modprobe.d directory to use instead of the default ones")
+	ignoreConf = flag.Bool("ignore-config", false, "Ignore modprobe.d")
 )
 
 func init() {
@@ -51,16 +64,33 @@ func main() {
 	}
 
 	opts := kmodule.ProbeOpts{
-		RootDir: *rootDir,
-		KVer:    *kernelVer,
+		RootDir:      *rootDir,
+		KVer:         *kernelVer,
+		IgnoreConfig: *ignoreConf,
+	}
+	if *configDir != "" {
+		opts.ConfigDirs = []string{*configDir}
 	}
-	if *dryRun {
+	if *showDeps {
+		opts.ShowDepends = func(line string) {
+			fmt.Println(line)
+		}
+	} else if *dryRun {
 		log.Println("Unique dependencies in load order, already loaded ones get skipped:")
 		opts.DryRunCB = func(modPath string) {
 			log.Println(modPath)
 		}
 	}
 
+	if *remove {
+		for _, modName := range flag.Args() {
+			if err := kmodule.Remove(modName, opts); err != nil {
+				log.Fatalf("modprobe: Could not remove module %q: %v", modName, err)
+			}
+		}
+		os.Exit(0)
+	}
+
 	// -va is just an alias for -a
 	*all = *all || *verboseAll
 	if *all {
@@ -0,0 +1,77 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// newns runs a command in a name space built from a Plan 9 name space file.
+//
+// Synopsis:
+//
+//	newns [-a] [-n NSFILE] [COMMAND [ARG]...]
+//
+// Description:
+//
+//	newns sets $user to the current user, builds a new name space from
+//	the commands of NSFILE, described at
+//	https://9p.io/magic/man2html/6/namespace, and runs COMMAND in it, or
+//	$SHELL, or /bin/sh.
+//
+//	On Linux, the name space is a new mount namespace, a copy of the
+//	current one, which takes root. Unions of bind -a and -b are overlayfs
+//	mounts, and mount attaches 9P servers with the kernel v9fs client;
+//	see package namespace.
+//
+// Options:
+//
+//	-a: add to the current name space instead of building a new one
+//	-n: name space file (default: /lib/namespace)
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"syscall"
+
+	"github.com/u-root/u-root/pkg/namespace"
+)
+
+var (
+	add    = flag.Bool("a", false, "add to the current name space instead of building a new one")
+	nsfile = flag.String("n", "/lib/namespace", "name space file")
+)
+
+func newns(nsfile string, add bool, args []string) error {
+	name := "none"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	build := namespace.NewNS
+	if add {
+		build = namespace.AddNS
+	}
+	if err := build(nsfile, name); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		args = []string{os.Getenv("SHELL")}
+		if args[0] == "" {
+			args[0] = "/bin/sh"
+		}
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	// The name space may be that of this thread only, so exec in place.
+	return syscall.Exec(path, args, os.Environ())
+}
+
+func main() {
+	flag.Parse()
+	if err := newns(*nsfile, *add, flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
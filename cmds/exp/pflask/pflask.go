@@ -5,6 +5,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,6 +20,7 @@ import (
 	"unsafe"
 
 	// "github.com/u-root/u-root/pkg/termios"
+	"github.com/u-root/u-root/pkg/oci"
 	"golang.org/x/sys/unix"
 )
 
@@ -285,6 +287,8 @@ var (
 	debug   = flag.Bool("d", false, "Enable debug logs")
 	env     = flag.String("env", "", "other environment variables")
 	user    = flag.String("user", "root" /*user.User.Username*/, "User name")
+	bundle  = flag.String("bundle", "", "run the OCI bundle in this directory instead of -chroot")
+	id      = flag.String("id", "", "container ID for -bundle, defaults to pflask.<pid>")
 	root    = &mount{"", "/", "", "", syscall.MS_SLAVE | syscall.MS_REC, false, false}
 	mounts  = []mount{
 		{"proc", "/proc", "proc", "", syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV, true, false},
@@ -299,13 +303,54 @@ var (
 	v = func(string, ...interface{}) {}
 )
 
+// runBundle runs the container described by dir/config.json and returns
+// its exit status.
+func runBundle(dir, name string) (int, error) {
+	spec, err := oci.Load(dir)
+	if err != nil {
+		return 1, err
+	}
+	if name == "" {
+		name = fmt.Sprintf("pflask.%d", os.Getpid())
+	}
+	c := &oci.Container{
+		ID:     name,
+		Spec:   spec,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if err := c.Start(); err != nil {
+		return 1, err
+	}
+	v("pflask: container %s running as pid %d", name, c.Pid())
+	if err := c.Wait(); err != nil {
+		var e *exec.ExitError
+		if errors.As(err, &e) {
+			return e.ExitCode(), nil
+		}
+		return 1, err
+	}
+	return 0, nil
+}
+
 func main() {
+	// When started by oci.Container, set up the container and exec.
+	oci.Init()
 	flag.Parse()
 	if *debug {
 		v = log.Printf
 	}
 	v("pflask: Let's go!")
 
+	if *bundle != "" {
+		code, err := runBundle(*bundle, *id)
+		if err != nil {
+			log.Fatalf("pflask: %v", err)
+		}
+		os.Exit(code)
+	}
+
 	if len(flag.Args()) < 1 {
 		v("pflask: no args given")
 		os.Exit(1)
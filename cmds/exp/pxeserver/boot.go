@@ -0,0 +1,102 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// client is the kind of a DHCPv4 client, which tells what it boots.
+type client int
+
+const (
+	// clientPXE is a legacy BIOS PXE client, or any client that is not
+	// one of the others.
+	clientPXE client = iota
+	// clientEFI is a UEFI PXE client, which loads a file over TFTP.
+	clientEFI
+	// clientHTTP is a UEFI HTTP Boot client, which loads a URL.
+	clientHTTP
+	// clientIPXE is iPXE, which runs a script. Clients chain to iPXE by
+	// booting it over PXE first.
+	clientIPXE
+)
+
+func (c client) String() string {
+	switch c {
+	case clientEFI:
+		return "UEFI PXE"
+	case clientHTTP:
+		return "UEFI HTTP Boot"
+	case clientIPXE:
+		return "iPXE"
+	}
+	return "PXE"
+}
+
+// Vendor classes of PXE and UEFI HTTP Boot clients, in option 60. Servers
+// send them back.
+const (
+	vendorPXE  = "PXEClient"
+	vendorHTTP = "HTTPClient"
+)
+
+// classify returns the kind of client m comes from, by its user class
+// (option 77), vendor class (option 60) and architecture (option 93).
+func classify(m *dhcpv4.DHCPv4) client {
+	for _, uc := range m.UserClass() {
+		if uc == "iPXE" {
+			return clientIPXE
+		}
+	}
+	if strings.HasPrefix(m.ClassIdentifier(), vendorHTTP) {
+		return clientHTTP
+	}
+	for _, a := range m.ClientArch() {
+		switch a {
+		case iana.EFI_X86_HTTP, iana.EFI_X86_64_HTTP, iana.EFI_BC_HTTP, iana.EFI_ARM32_HTTP,
+			iana.EFI_ARM64_HTTP, iana.INTEL_X86PC_HTTP, iana.EFI_RISCV32_HTTP,
+			iana.EFI_RISCV64_HTTP, iana.EFI_RISCV128_HTTP:
+			return clientHTTP
+		case iana.EFI_IA32, iana.EFI_X86_64, iana.EFI_BC, iana.EFI_ARM32, iana.EFI_ARM64,
+			iana.EFI_RISCV32, iana.EFI_RISCV64, iana.EFI_RISCV128:
+			return clientEFI
+		}
+	}
+	return clientPXE
+}
+
+// bootFile returns the file for a kind of client. Paths for HTTP are made
+// URLs of the HTTP server at httpURL. iPXE gets the templated script of
+// the host, at ipxeURL, unless the config has one. Without either, or
+// without an EFI file for UEFI PXE clients, clients get the legacy PXE
+// file, as they all did before there were files for each kind.
+func (b bootFiles) bootFile(c client, httpURL, ipxeURL string) string {
+	url := func(p string) string {
+		if p == "" || strings.Contains(p, "://") {
+			return p
+		}
+		return httpURL + "/" + strings.TrimPrefix(p, "/")
+	}
+	switch c {
+	case clientEFI:
+		if b.EFI != "" {
+			return b.EFI
+		}
+	case clientHTTP:
+		return url(b.HTTP)
+	case clientIPXE:
+		if b.IPXE != "" {
+			return url(b.IPXE)
+		}
+		if ipxeURL != "" {
+			return ipxeURL
+		}
+	}
+	return b.PXE
+}
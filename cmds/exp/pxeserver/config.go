@@ -0,0 +1,132 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+// bootFiles are the files that each kind of client boots.
+type bootFiles struct {
+	// PXE is the file for legacy BIOS PXE clients, over TFTP.
+	PXE string `json:"pxe,omitempty"`
+	// EFI is the file for UEFI PXE clients, over TFTP.
+	EFI string `json:"efi,omitempty"`
+	// HTTP is the URL for UEFI HTTP Boot clients. Paths are relative to
+	// the HTTP server.
+	HTTP string `json:"http,omitempty"`
+	// IPXE is the script URL for iPXE. Paths are relative to the HTTP
+	// server. If empty, iPXE gets the templated script of the host.
+	IPXE string `json:"ipxe,omitempty"`
+	// V6 is the boot file URL for DHCPv6 clients.
+	V6 string `json:"v6,omitempty"`
+}
+
+// or returns b, with the files it has not set taken from d.
+func (b bootFiles) or(d bootFiles) bootFiles {
+	for _, f := range []struct{ b, d *string }{
+		{&b.PXE, &d.PXE},
+		{&b.EFI, &d.EFI},
+		{&b.HTTP, &d.HTTP},
+		{&b.IPXE, &d.IPXE},
+		{&b.V6, &d.V6},
+	} {
+		if *f.b == "" {
+			*f.b = *f.d
+		}
+	}
+	return b
+}
+
+// host is the configuration of one client.
+type host struct {
+	// IP is the reserved IPv4 address of the host. It is outside of the
+	// pool, or the pool does not hand it out to others.
+	IP net.IP `json:"ip,omitempty"`
+	// IP6 is the IPv6 address of the host.
+	IP6      net.IP `json:"ip6,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	// Boot overrides the boot files of the config.
+	Boot bootFiles `json:"boot"`
+	// Vars are for the templates, along with those of the config.
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// config is the configuration file of pxeserver, in JSON, like
+//
+//	{
+//		"boot": {"pxe": "undionly.kpxe", "efi": "ipxe.efi"},
+//		"hosts": {
+//			"52:54:00:12:34:56": {
+//				"ip": "192.168.0.10",
+//				"hostname": "node1",
+//				"vars": {"kernel": "vmlinuz-6.6"}
+//			}
+//		}
+//	}
+type config struct {
+	Boot  bootFiles         `json:"boot"`
+	Vars  map[string]string `json:"vars,omitempty"`
+	Hosts map[string]*host  `json:"hosts,omitempty"`
+}
+
+// readConfig reads the config file. It normalizes the MACs of the hosts.
+func readConfig(file string) (*config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	c := &config{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	hosts := make(map[string]*host, len(c.Hosts))
+	for m, h := range c.Hosts {
+		mac, err := net.ParseMAC(m)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if h.IP != nil && h.IP.To4() == nil {
+			return nil, fmt.Errorf("%s: host %s: %v is not an IPv4 address", file, m, h.IP)
+		}
+		hosts[mac.String()] = h
+	}
+	c.Hosts = hosts
+	return c, nil
+}
+
+// host returns the configuration of the client with mac: its entry in
+// the config, if any, with the boot files and vars of the config as
+// defaults.
+func (c *config) host(mac net.HardwareAddr) *host {
+	h := &host{}
+	if ch, ok := c.Hosts[mac.String()]; ok {
+		*h = *ch
+	}
+	h.Boot = h.Boot.or(c.Boot)
+	vars := make(map[string]string, len(c.Vars)+len(h.Vars))
+	for k, v := range c.Vars {
+		vars[k] = v
+	}
+	for k, v := range h.Vars {
+		vars[k] = v
+	}
+	h.Vars = vars
+	return h
+}
+
+// reserved returns the reserved IPv4 addresses of the hosts.
+func (c *config) reserved() map[string]net.IP {
+	r := make(map[string]net.IP)
+	for mac, h := range c.Hosts {
+		if h.IP != nil {
+			r[mac] = h.IP.To4()
+		}
+	}
+	return r
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+type dserver4 struct {
+	mac     net.HardwareAddr
+	self    net.IP
+	submask net.IPMask
+	// yourIP is for the clients without a reservation when there is no
+	// pool.
+	yourIP    net.IP
+	pool      *pool
+	leaseTime time.Duration
+	rootpath  string
+	cfg       *config
+	// httpURL is the URL of the HTTP server, for HTTP Boot and iPXE.
+	httpURL string
+	// ipxeTemplate is set if the HTTP server has templated iPXE scripts.
+	ipxeTemplate bool
+}
+
+// address returns the address of mac: its reservation, its lease, or the
+// one address for all without a pool.
+func (s *dserver4) address(mac net.HardwareAddr) net.IP {
+	if h := s.cfg.host(mac); h.IP != nil {
+		return h.IP.To4()
+	}
+	if s.pool != nil {
+		return s.pool.lookup(mac)
+	}
+	return s.yourIP
+}
+
+// reply returns the reply to m, or nil if there is none.
+func (s *dserver4) reply(m *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	if s.mac != nil && !bytes.Equal(m.ClientHWAddr, s.mac) {
+		log.Printf("Not responding to DHCP request for mac %s, which does not match %s", m.ClientHWAddr, s.mac)
+		return nil, nil
+	}
+	mac := m.ClientHWAddr
+	h := s.cfg.host(mac)
+
+	var replyType dhcpv4.MessageType
+	var yourIP net.IP
+	leaseTime := s.leaseTime
+	switch mt := m.MessageType(); mt {
+	case dhcpv4.MessageTypeDiscover:
+		replyType = dhcpv4.MessageTypeOffer
+		switch {
+		case h.IP != nil:
+			yourIP = h.IP.To4()
+		case s.pool != nil:
+			ip, err := s.pool.offer(mac, m.RequestedIPAddress())
+			if err != nil {
+				return nil, err
+			}
+			yourIP = ip
+		default:
+			yourIP = s.yourIP
+		}
+
+	case dhcpv4.MessageTypeRequest:
+		// RFC 2131, Section 4.3.2. A client that selected another
+		// server sends it in the Server Identifier.
+		if sid := m.ServerIdentifier(); sid != nil && !sid.Equal(s.self) {
+			return nil, nil
+		}
+		replyType = dhcpv4.MessageTypeAck
+		want := m.RequestedIPAddress()
+		if want == nil {
+			// Renewing or rebinding.
+			want = m.ClientIPAddr
+		}
+		switch {
+		case h.IP != nil:
+			yourIP = h.IP.To4()
+		case s.pool != nil:
+			if err := s.pool.commit(mac, want); err != nil {
+				log.Printf("NAK to %s: %v", mac, err)
+				return s.nak(m)
+			}
+			leaseTime = s.pool.duration
+			yourIP = want.To4()
+		default:
+			yourIP = s.yourIP
+		}
+		if want != nil && !want.IsUnspecified() && !want.Equal(yourIP) {
+			log.Printf("NAK to %s: requested %v, has %v", mac, want, yourIP)
+			return s.nak(m)
+		}
+
+	case dhcpv4.MessageTypeRelease:
+		if s.pool != nil {
+			return nil, s.pool.release(mac, m.ClientIPAddr)
+		}
+		return nil, nil
+
+	case dhcpv4.MessageTypeDecline:
+		if s.pool != nil {
+			return nil, s.pool.decline(mac, m.RequestedIPAddress())
+		}
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("can't handle type %v", mt)
+	}
+
+	reply, err := dhcpv4.NewReplyFromRequest(m,
+		dhcpv4.WithMessageType(replyType),
+		dhcpv4.WithServerIP(s.self),
+		dhcpv4.WithRouter(s.self),
+		dhcpv4.WithNetmask(s.submask),
+		dhcpv4.WithYourIP(yourIP),
+		// RFC 2131, Section 4.3.1. Server Identifier: MUST
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(s.self)),
+		// RFC 2131, Section 4.3.1. IP lease time: MUST
+		dhcpv4.WithOption(dhcpv4.OptIPAddressLeaseTime(leaseTime)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// RFC 6842, MUST include Client Identifier if client specified one.
+	if val := m.Options.Get(dhcpv4.OptionClientIdentifier); len(val) > 0 {
+		reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionClientIdentifier, val))
+	}
+	if h.Hostname != "" {
+		reply.UpdateOption(dhcpv4.OptHostName(h.Hostname))
+	}
+	if len(s.rootpath) > 0 {
+		reply.UpdateOption(dhcpv4.OptRootPath(s.rootpath))
+	}
+
+	c := classify(m)
+	script := ""
+	if s.ipxeTemplate {
+		script = ipxeURL(s.httpURL, mac)
+	}
+	reply.BootFileName = h.Boot.bootFile(c, s.httpURL, script)
+	// Clients ignore answers without their vendor class, which tells
+	// that the server knows how to boot them.
+	switch vc := m.ClassIdentifier(); {
+	case c == clientHTTP:
+		reply.UpdateOption(dhcpv4.OptClassIdentifier(vendorHTTP))
+	case strings.HasPrefix(vc, vendorPXE):
+		reply.UpdateOption(dhcpv4.OptClassIdentifier(vendorPXE))
+	}
+	log.Printf("%s is a %v client, booting %q", mac, c, reply.BootFileName)
+	return reply, nil
+}
+
+// nak returns a NAK to m.
+func (s *dserver4) nak(m *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	return dhcpv4.NewReplyFromRequest(m,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeNak),
+		dhcpv4.WithServerIP(s.self),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(s.self)),
+	)
+}
+
+func (s *dserver4) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+	log.Printf("Handling request %v for peer %v", m, peer)
+
+	reply, err := s.reply(m)
+	if err != nil {
+		log.Printf("Could not create reply for %v: %v", m, err)
+		return
+	}
+	if reply == nil {
+		return
+	}
+
+	// Experimentally determined. You can't just blindly send a broadcast packet
+	// with the broadcast address. You can, however, send a broadcast packet
+	// to a subnet for an interface. That actually makes some sense.
+	// This fixes the observed problem that OSX just swallows these
+	// packets if the peer is 255.255.255.255.
+	// I chose this way of doing it instead of files with build constraints
+	// because this is not that expensive and it's just a tiny bit easier to
+	// follow IMHO.
+	if runtime.GOOS == "darwin" {
+		p := &net.UDPAddr{IP: s.self.Mask(s.submask), Port: 68}
+		log.Printf("Changing %v to %v", peer, p)
+		peer = p
+	}
+
+	log.Printf("Sending %v to %v", reply.Summary(), peer)
+	if _, err := conn.WriteTo(reply.ToBytes(), peer); err != nil {
+		log.Printf("Could not write %v: %v", reply, err)
+	}
+}
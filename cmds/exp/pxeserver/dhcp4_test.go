@@ -0,0 +1,289 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+func TestClassify(t *testing.T) {
+	mac := mustMAC(t, "52:54:00:12:34:56")
+	for _, tt := range []struct {
+		name string
+		mods []dhcpv4.Modifier
+		want client
+	}{
+		{name: "plain", want: clientPXE},
+		{
+			name: "bios",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00000:UNDI:002001")),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.INTEL_X86PC)),
+			},
+			want: clientPXE,
+		},
+		{
+			name: "efi",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+			},
+			want: clientEFI,
+		},
+		{
+			name: "http",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("HTTPClient:Arch:00016:UNDI:003001")),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64_HTTP)),
+			},
+			want: clientHTTP,
+		},
+		{
+			name: "http arch",
+			mods: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_ARM64_HTTP))},
+			want: clientHTTP,
+		},
+		{
+			name: "ipxe",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+				dhcpv4.WithUserClass("iPXE", false),
+			},
+			want: clientIPXE,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := dhcpv4.NewDiscovery(mac, tt.mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := classify(m); got != tt.want {
+				t.Errorf("classify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// packetConn is a net.PacketConn that keeps what is written to it.
+type packetConn struct {
+	net.PacketConn
+	written [][]byte
+}
+
+func (c *packetConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	c.written = append(c.written, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func testServer4(t *testing.T) *dserver4 {
+	t.Helper()
+	cfg := &config{
+		Boot: bootFiles{PXE: "undionly.kpxe", EFI: "ipxe.efi", HTTP: "/boot.efi"},
+		Hosts: map[string]*host{
+			"52:54:00:00:00:09": {
+				IP:       net.ParseIP("192.168.0.9"),
+				Hostname: "node9",
+				Boot:     bootFiles{IPXE: "http://example.com/node9.ipxe"},
+			},
+		},
+	}
+	p, err := newPool(net.ParseIP("192.168.0.100"), net.ParseIP("192.168.0.101"), time.Hour, "", cfg.reserved())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dserver4{
+		self:         net.ParseIP("192.168.0.1"),
+		submask:      net.CIDRMask(24, 32),
+		pool:         p,
+		leaseTime:    time.Hour,
+		cfg:          cfg,
+		httpURL:      "http://192.168.0.1:80",
+		ipxeTemplate: true,
+	}
+}
+
+func TestDHCPv4(t *testing.T) {
+	s := testServer4(t)
+	for _, tt := range []struct {
+		name     string
+		mac      string
+		mods     []dhcpv4.Modifier
+		ip       string
+		bootfile string
+		vendor   string
+		hostname string
+	}{
+		{
+			name:     "bios",
+			mac:      "52:54:00:00:00:01",
+			mods:     []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00000:UNDI:002001"))},
+			ip:       "192.168.0.100",
+			bootfile: "undionly.kpxe",
+			vendor:   "PXEClient",
+		},
+		{
+			name:     "ipxe chained",
+			mac:      "52:54:00:00:00:01",
+			mods:     []dhcpv4.Modifier{dhcpv4.WithUserClass("iPXE", false)},
+			ip:       "192.168.0.100",
+			bootfile: "http://192.168.0.1:80/ipxe/52:54:00:00:00:01",
+		},
+		{
+			name: "http",
+			mac:  "52:54:00:00:00:02",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("HTTPClient:Arch:00016:UNDI:003001")),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64_HTTP)),
+			},
+			ip:       "192.168.0.101",
+			bootfile: "http://192.168.0.1:80/boot.efi",
+			vendor:   "HTTPClient",
+		},
+		{
+			name:     "reservation",
+			mac:      "52:54:00:00:00:09",
+			mods:     []dhcpv4.Modifier{dhcpv4.WithUserClass("iPXE", false)},
+			ip:       "192.168.0.9",
+			bootfile: "http://example.com/node9.ipxe",
+			hostname: "node9",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &packetConn{}
+			d, err := dhcpv4.NewDiscovery(mustMAC(t, tt.mac), tt.mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.dhcpHandler(conn, &net.UDPAddr{IP: net.IPv4bcast, Port: 68}, d)
+			if len(conn.written) != 1 {
+				t.Fatalf("got %d replies to DISCOVER, want 1", len(conn.written))
+			}
+			offer, err := dhcpv4.FromBytes(conn.written[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offer.MessageType() != dhcpv4.MessageTypeOffer || offer.YourIPAddr.String() != tt.ip {
+				t.Fatalf("reply = %v for %v, want OFFER for %s", offer.MessageType(), offer.YourIPAddr, tt.ip)
+			}
+
+			r, err := dhcpv4.NewRequestFromOffer(offer, tt.mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ack, err := s.reply(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ack.MessageType() != dhcpv4.MessageTypeAck || ack.YourIPAddr.String() != tt.ip {
+				t.Fatalf("reply = %v for %v, want ACK for %s", ack.MessageType(), ack.YourIPAddr, tt.ip)
+			}
+			if ack.BootFileName != tt.bootfile {
+				t.Errorf("boot file = %q, want %q", ack.BootFileName, tt.bootfile)
+			}
+			if got := ack.ClassIdentifier(); got != tt.vendor {
+				t.Errorf("vendor class = %q, want %q", got, tt.vendor)
+			}
+			if got := ack.HostName(); got != tt.hostname {
+				t.Errorf("host name = %q, want %q", got, tt.hostname)
+			}
+			if got := s.address(ack.ClientHWAddr); !got.Equal(ack.YourIPAddr) {
+				t.Errorf("address = %v, want %v", got, ack.YourIPAddr)
+			}
+		})
+	}
+}
+
+// TestBootFileDefaults checks that with only -bootfilename, as before
+// there were files for each kind of client, iPXE and UEFI PXE clients get
+// it too.
+func TestBootFileDefaults(t *testing.T) {
+	s := testServer4(t)
+	s.cfg = &config{Boot: bootFiles{}.or(bootFiles{PXE: "pxelinux.0"})}
+	s.pool = nil
+	s.yourIP = net.ParseIP("192.168.0.2")
+	s.ipxeTemplate = false
+	for _, tt := range []struct {
+		name     string
+		mods     []dhcpv4.Modifier
+		bootfile string
+	}{
+		{
+			name:     "ipxe without a script",
+			mods:     []dhcpv4.Modifier{dhcpv4.WithUserClass("iPXE", false)},
+			bootfile: "pxelinux.0",
+		},
+		{
+			name: "efi without a file",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+			},
+			bootfile: "pxelinux.0",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := dhcpv4.NewDiscovery(mustMAC(t, "52:54:00:00:00:01"), tt.mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offer, err := s.reply(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offer.BootFileName != tt.bootfile {
+				t.Errorf("boot file = %q, want %q", offer.BootFileName, tt.bootfile)
+			}
+		})
+	}
+}
+
+func TestDHCPv4NAK(t *testing.T) {
+	s := testServer4(t)
+	mac := mustMAC(t, "52:54:00:00:00:01")
+
+	// Another client has the address.
+	if err := s.pool.commit(mustMAC(t, "52:54:00:00:00:02"), net.ParseIP("192.168.0.100")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := dhcpv4.NewDiscovery(mac,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("192.168.0.100"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nak, err := s.reply(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nak.MessageType() != dhcpv4.MessageTypeNak {
+		t.Errorf("reply = %v, want NAK", nak.MessageType())
+	}
+
+	// The client chose another server.
+	r.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP("192.168.0.254")))
+	if reply, err := s.reply(r); err != nil || reply != nil {
+		t.Errorf("reply to a request for another server = %v, %v, want nil, nil", reply, err)
+	}
+
+	// A reservation is not in the pool.
+	r, err = dhcpv4.NewDiscovery(mustMAC(t, "52:54:00:00:00:09"),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.ParseIP("192.168.0.101"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nak, err = s.reply(r); err != nil {
+		t.Fatal(err)
+	}
+	if nak.MessageType() != dhcpv4.MessageTypeNak {
+		t.Errorf("reply = %v, want NAK", nak.MessageType())
+	}
+}
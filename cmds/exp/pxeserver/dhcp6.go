@@ -0,0 +1,236 @@
+// Copyright 2018 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+var (
+	errBadPrefix      = errors.New("bad prefix delegation")
+	errPrefixesUsedUp = errors.New("no free prefix to delegate")
+)
+
+// prefixPool delegates prefixes of one length out of a larger prefix. The
+// delegations are not kept across restarts; clients get the same prefix
+// as long as the server runs.
+type prefixPool struct {
+	mu       sync.Mutex
+	base     *big.Int
+	baseLen  int
+	length   int
+	count    uint64
+	next     uint64
+	prefixes map[string]*net.IPNet
+	released []uint64
+}
+
+// newPrefixPool returns the pool of the prefixes of length in prefix.
+func newPrefixPool(prefix *net.IPNet, length int) (*prefixPool, error) {
+	baseLen, bits := prefix.Mask.Size()
+	if bits != 8*net.IPv6len || length < baseLen || length > bits {
+		return nil, fmt.Errorf("%w: /%d out of %v", errBadPrefix, length, prefix)
+	}
+	count := uint64(math.MaxUint64)
+	if length-baseLen < 64 {
+		count = 1 << (length - baseLen)
+	}
+	return &prefixPool{
+		base:     new(big.Int).SetBytes(prefix.IP.Mask(prefix.Mask)),
+		baseLen:  baseLen,
+		length:   length,
+		count:    count,
+		prefixes: make(map[string]*net.IPNet),
+	}, nil
+}
+
+// prefix returns the i-th prefix.
+func (p *prefixPool) prefix(i uint64) *net.IPNet {
+	n := new(big.Int).Lsh(new(big.Int).SetUint64(i), uint(8*net.IPv6len-p.length))
+	ip := make(net.IP, net.IPv6len)
+	new(big.Int).Or(p.base, n).FillBytes(ip)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(p.length, 8*net.IPv6len)}
+}
+
+// delegate returns the prefix of mac, delegating a new one if it has none.
+func (p *prefixPool) delegate(mac net.HardwareAddr) (*net.IPNet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n, ok := p.prefixes[mac.String()]; ok {
+		return n, nil
+	}
+	var i uint64
+	switch {
+	case len(p.released) > 0:
+		i, p.released = p.released[0], p.released[1:]
+	case p.next < p.count:
+		i = p.next
+		p.next++
+	default:
+		return nil, errPrefixesUsedUp
+	}
+	n := p.prefix(i)
+	p.prefixes[mac.String()] = n
+	return n, nil
+}
+
+// release returns the prefix of mac to the pool.
+func (p *prefixPool) release(mac net.HardwareAddr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, ok := p.prefixes[mac.String()]
+	if !ok {
+		return
+	}
+	delete(p.prefixes, mac.String())
+	i := new(big.Int).Rsh(new(big.Int).Xor(new(big.Int).SetBytes(n.IP), p.base), uint(8*net.IPv6len-p.length))
+	p.released = append(p.released, i.Uint64())
+}
+
+type dserver6 struct {
+	mac    net.HardwareAddr
+	yourIP net.IP
+	// cfg has the boot file URLs.
+	cfg *config
+	// duid identifies the server.
+	duid dhcpv6.DUID
+	// prefixes is nil without prefix delegation.
+	prefixes *prefixPool
+	// leaseTime is the valid lifetime of addresses and prefixes.
+	leaseTime time.Duration
+}
+
+// reply returns the reply to msg, or nil if there is none.
+func (s *dserver6) reply(msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	mac, err := dhcpv6.ExtractMAC(msg)
+	if err != nil {
+		return nil, fmt.Errorf("no MAC address in request: %w", err)
+	}
+	if s.mac != nil && !bytes.Equal(s.mac, mac) {
+		log.Printf("MAC address %s doesn't match expected MAC %s", mac, s.mac)
+		return nil, nil
+	}
+	// Requests for other servers.
+	if sid := msg.Options.ServerID(); sid != nil && !sid.Equal(s.duid) {
+		return nil, nil
+	}
+
+	var reply *dhcpv6.Message
+	switch msg.MessageType {
+	case dhcpv6.MessageTypeSolicit:
+		// From RFC 3315, section 17.1.4, If the client includes a Rapid Commit
+		// option in the Solicit message, it will expect a Reply message that
+		// includes a Rapid Commit option in response.
+		if msg.GetOneOption(dhcpv6.OptionRapidCommit) != nil {
+			reply, err = dhcpv6.NewReplyFromMessage(msg)
+		} else {
+			reply, err = dhcpv6.NewAdvertiseFromSolicit(msg)
+		}
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRebind:
+		reply, err = dhcpv6.NewReplyFromMessage(msg)
+	case dhcpv6.MessageTypeRelease:
+		if s.prefixes != nil {
+			s.prefixes.release(mac)
+		}
+		reply, err = dhcpv6.NewReplyFromMessage(msg, dhcpv6.WithOption(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusSuccess,
+			StatusMessage: "released",
+		}))
+		if err != nil {
+			return nil, err
+		}
+		reply.AddOption(dhcpv6.OptServerID(s.duid))
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("can't handle type %s", msg.MessageType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reply.AddOption(dhcpv6.OptServerID(s.duid))
+
+	h := s.cfg.host(mac)
+	yourIP := s.yourIP
+	if h.IP6 != nil {
+		yourIP = h.IP6
+	}
+	if na := msg.Options.OneIANA(); na != nil {
+		na.Options.Update(&dhcpv6.OptIAAddress{
+			IPv6Addr:          yourIP,
+			PreferredLifetime: s.leaseTime,
+			ValidLifetime:     s.leaseTime,
+		})
+		reply.AddOption(na)
+	}
+	for _, pd := range msg.Options.IAPD() {
+		if s.prefixes == nil {
+			// RFC 8415, Section 18.3.9: NoPrefixAvail in the IA_PD.
+			reply.AddOption(&dhcpv6.OptIAPD{
+				IaId: pd.IaId,
+				Options: dhcpv6.PDOptions{Options: dhcpv6.Options{&dhcpv6.OptStatusCode{
+					StatusCode:    iana.StatusNoPrefixAvail,
+					StatusMessage: "no prefix delegation",
+				}}},
+			})
+			continue
+		}
+		p, err := s.prefixes.delegate(mac)
+		if err != nil {
+			return nil, err
+		}
+		reply.AddOption(&dhcpv6.OptIAPD{
+			IaId: pd.IaId,
+			T1:   s.leaseTime / 2,
+			T2:   s.leaseTime * 4 / 5,
+			Options: dhcpv6.PDOptions{Options: dhcpv6.Options{&dhcpv6.OptIAPrefix{
+				PreferredLifetime: s.leaseTime,
+				ValidLifetime:     s.leaseTime,
+				Prefix:            p,
+			}}},
+		})
+	}
+	if len(h.Boot.V6) > 0 {
+		reply.Options.Add(dhcpv6.OptBootFileURL(h.Boot.V6))
+	}
+	return reply, nil
+}
+
+func (s *dserver6) dhcpHandler(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6) {
+	log.Printf("Handling DHCPv6 request %v sent by %v", m.Summary(), peer.String())
+
+	msg, err := m.GetInnerMessage()
+	if err != nil {
+		log.Printf("Could not find unpacked message: %v", err)
+		return
+	}
+	reply, err := s.reply(msg)
+	if err != nil {
+		log.Printf("Failed to create reply for %v: %v", m, err)
+		return
+	}
+	if reply == nil {
+		return
+	}
+
+	if _, err := conn.WriteTo(reply.ToBytes(), peer); err != nil {
+		log.Printf("Failed to send response %v: %v", reply, err)
+		return
+	}
+
+	log.Printf("DHCPv6 request successfully handled, reply: %v", reply.Summary())
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+func TestPrefixPool(t *testing.T) {
+	_, n, err := net.ParseCIDR("fec0:1::/62")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newPrefixPool(n, 60); !errors.Is(err, errBadPrefix) {
+		t.Errorf("newPrefixPool(%v, 60) = %v, want %v", n, err, errBadPrefix)
+	}
+	p, err := newPrefixPool(n, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"fec0:1::/64", "fec0:1:0:1::/64", "fec0:1:0:2::/64", "fec0:1:0:3::/64"} {
+		mac := net.HardwareAddr{0x52, 0x54, 0, 0, 0, byte(i)}
+		got, err := p.delegate(mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("delegate(%s) = %v, want %s", mac, got, want)
+		}
+		if again, _ := p.delegate(mac); again.String() != want {
+			t.Errorf("delegate(%s) again = %v, want %s", mac, again, want)
+		}
+	}
+	other := net.HardwareAddr{0x52, 0x54, 0, 0, 0, 9}
+	if _, err := p.delegate(other); !errors.Is(err, errPrefixesUsedUp) {
+		t.Errorf("delegate with all prefixes used = %v, want %v", err, errPrefixesUsedUp)
+	}
+	p.release(net.HardwareAddr{0x52, 0x54, 0, 0, 0, 2})
+	if got, err := p.delegate(other); err != nil || got.String() != "fec0:1:0:2::/64" {
+		t.Errorf("delegate after release = %v, %v, want fec0:1:0:2::/64", got, err)
+	}
+}
+
+func TestDHCPv6(t *testing.T) {
+	_, n, err := net.ParseCIDR("fec0:1::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPrefixPool(n, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := mustMAC(t, "52:54:00:00:00:09")
+	s := &dserver6{
+		yourIP: net.ParseIP("fec0::3"),
+		cfg: &config{
+			Boot:  bootFiles{V6: "http://[fec0::1]/boot.efi"},
+			Hosts: map[string]*host{mac.String(): {IP6: net.ParseIP("fec0::9")}},
+		},
+		duid:      &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mustMAC(t, "52:54:00:00:00:01")},
+		prefixes:  p,
+		leaseTime: time.Hour,
+	}
+
+	sol, err := dhcpv6.NewSolicit(mac, dhcpv6.WithIAPD([4]byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	adv, err := s.reply(sol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adv.MessageType != dhcpv6.MessageTypeAdvertise {
+		t.Fatalf("reply to SOLICIT = %v, want ADVERTISE", adv.MessageType)
+	}
+	req, err := dhcpv6.NewRequestFromAdvertise(adv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := s.reply(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.MessageType != dhcpv6.MessageTypeReply {
+		t.Fatalf("reply to REQUEST = %v, want REPLY", reply.MessageType)
+	}
+	if got := reply.Options.OneIANA().Options.OneAddress().IPv6Addr; !got.Equal(net.ParseIP("fec0::9")) {
+		t.Errorf("address = %v, want fec0::9", got)
+	}
+	pd := reply.Options.OneIAPD()
+	if pd == nil || len(pd.Options.Prefixes()) != 1 || pd.Options.Prefixes()[0].Prefix.String() != "fec0:1::/64" {
+		t.Errorf("IA_PD = %v, want fec0:1::/64", pd)
+	}
+	if got := reply.Options.BootFileURL(); got != "http://[fec0::1]/boot.efi" {
+		t.Errorf("boot file URL = %q, want http://[fec0::1]/boot.efi", got)
+	}
+
+	// Requests for other servers are not answered.
+	req.UpdateOption(dhcpv6.OptServerID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mustMAC(t, "52:54:00:00:00:02")}))
+	if reply, err := s.reply(req); err != nil || reply != nil {
+		t.Errorf("reply to a request for another server = %v, %v, want nil, nil", reply, err)
+	}
+
+	// With rapid commit, the answer to SOLICIT is a REPLY.
+	sol, err = dhcpv6.NewSolicit(mustMAC(t, "52:54:00:00:00:02"), dhcpv6.WithRapidCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply, err = s.reply(sol); err != nil {
+		t.Fatal(err)
+	}
+	if reply.MessageType != dhcpv6.MessageTypeReply {
+		t.Fatalf("reply to SOLICIT with rapid commit = %v, want REPLY", reply.MessageType)
+	}
+	if got := reply.Options.OneIANA().Options.OneAddress().IPv6Addr; !got.Equal(net.ParseIP("fec0::3")) {
+		t.Errorf("address = %v, want fec0::3", got)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errBadRange      = errors.New("bad address range")
+	errPoolExhausted = errors.New("no free address in the pool")
+	errNotAvailable  = errors.New("address not available")
+)
+
+// offerTime is how long an offered address is kept for the client to
+// request it.
+const offerTime = time.Minute
+
+// lease is an address leased to a client. A declined address, which
+// something else uses, has no MAC.
+type lease struct {
+	MAC    string    `json:"mac"`
+	IP     net.IP    `json:"ip"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// pool hands out the DHCPv4 addresses of a range, and keeps the leases in
+// a file.
+type pool struct {
+	mu       sync.Mutex
+	start    uint32
+	end      uint32
+	duration time.Duration
+	// file is where the leases are kept. If empty, they are not.
+	file string
+	// reserved are the addresses of the config's hosts, which the pool
+	// does not hand out.
+	reserved map[uint32]bool
+	leases   map[uint32]*lease
+	now      func() time.Time
+}
+
+func ip4ToUint(ip net.IP) (uint32, bool) {
+	ip = ip.To4()
+	if ip == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ip), true
+}
+
+func uintToIP4(u uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, u)
+	return ip
+}
+
+// parseRange parses an address range, like 192.168.0.100-192.168.0.200.
+func parseRange(r string) (net.IP, net.IP, error) {
+	s, e, ok := strings.Cut(r, "-")
+	start, end := net.ParseIP(strings.TrimSpace(s)), net.ParseIP(strings.TrimSpace(e))
+	su, sok := ip4ToUint(start)
+	eu, eok := ip4ToUint(end)
+	if !ok || !sok || !eok || su > eu {
+		return nil, nil, fmt.Errorf("%w: %q", errBadRange, r)
+	}
+	return start.To4(), end.To4(), nil
+}
+
+// newPool returns the pool of the addresses from start to end, which
+// leases them for duration. It reads the leases of file, if it exists.
+func newPool(start, end net.IP, duration time.Duration, file string, reserved map[string]net.IP) (*pool, error) {
+	su, sok := ip4ToUint(start)
+	eu, eok := ip4ToUint(end)
+	if !sok || !eok || su > eu {
+		return nil, fmt.Errorf("%w: %v-%v", errBadRange, start, end)
+	}
+	p := &pool{
+		start:    su,
+		end:      eu,
+		duration: duration,
+		file:     file,
+		reserved: make(map[uint32]bool),
+		leases:   make(map[uint32]*lease),
+		now:      time.Now,
+	}
+	for _, ip := range reserved {
+		if u, ok := ip4ToUint(ip); ok {
+			p.reserved[u] = true
+		}
+	}
+	if file == "" {
+		return p, nil
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var leases []*lease
+	if err := json.Unmarshal(b, &leases); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for _, l := range leases {
+		// The range may have changed since.
+		if u, ok := ip4ToUint(l.IP); ok && p.inRange(u) {
+			p.leases[u] = l
+		}
+	}
+	return p, nil
+}
+
+func (p *pool) inRange(u uint32) bool {
+	return u >= p.start && u <= p.end && !p.reserved[u]
+}
+
+// free returns whether mac may lease the address u.
+func (p *pool) free(u uint32, mac string, now time.Time) bool {
+	if !p.inRange(u) {
+		return false
+	}
+	l, ok := p.leases[u]
+	return !ok || l.MAC == mac || now.After(l.Expiry)
+}
+
+// find returns the address leased to mac, even if the lease expired.
+func (p *pool) find(mac string) (uint32, bool) {
+	for u, l := range p.leases {
+		if l.MAC == mac {
+			return u, true
+		}
+	}
+	return 0, false
+}
+
+// firstFree returns the first address that was never leased, or else the
+// first whose lease expired.
+func (p *pool) firstFree(now time.Time) (uint32, bool) {
+	var expired uint32
+	found := false
+	for u := p.start; ; u++ {
+		if p.inRange(u) {
+			l, ok := p.leases[u]
+			if !ok {
+				return u, true
+			}
+			if !found && now.After(l.Expiry) {
+				expired, found = u, true
+			}
+		}
+		if u == p.end {
+			return expired, found
+		}
+	}
+}
+
+// offer returns the address to offer to mac: the one leased to it before,
+// the requested one if it is free, or the first free one. The address is
+// kept for a while for the client to request it.
+func (p *pool) offer(mac net.HardwareAddr, requested net.IP) (net.IP, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now, m := p.now(), mac.String()
+	u, ok := p.find(m)
+	if ok && !p.free(u, m, now) {
+		ok = false
+	}
+	if r, rok := ip4ToUint(requested); !ok && rok && p.free(r, m, now) {
+		u, ok = r, true
+	}
+	if !ok {
+		u, ok = p.firstFree(now)
+	}
+	if !ok {
+		return nil, errPoolExhausted
+	}
+	if l, ok := p.leases[u]; !ok || l.MAC != m || l.Expiry.Before(now.Add(offerTime)) {
+		p.leases[u] = &lease{MAC: m, IP: uintToIP4(u), Expiry: now.Add(offerTime)}
+	}
+	return uintToIP4(u), nil
+}
+
+// commit leases ip to mac.
+func (p *pool) commit(mac net.HardwareAddr, ip net.IP) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now, m := p.now(), mac.String()
+	u, ok := ip4ToUint(ip)
+	if !ok || !p.free(u, m, now) {
+		return fmt.Errorf("%w: %v for %s", errNotAvailable, ip, m)
+	}
+	// A client has one lease.
+	for v, l := range p.leases {
+		if l.MAC == m && v != u {
+			delete(p.leases, v)
+		}
+	}
+	p.leases[u] = &lease{MAC: m, IP: uintToIP4(u), Expiry: now.Add(p.duration)}
+	return p.save()
+}
+
+// release ends the lease of ip to mac.
+func (p *pool) release(mac net.HardwareAddr, ip net.IP) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u, ok := ip4ToUint(ip)
+	if l, lok := p.leases[u]; !ok || !lok || l.MAC != mac.String() {
+		return nil
+	}
+	delete(p.leases, u)
+	return p.save()
+}
+
+// decline marks ip, which mac found in use, as unavailable for a lease
+// time.
+func (p *pool) decline(mac net.HardwareAddr, ip net.IP) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u, ok := ip4ToUint(ip)
+	if l, lok := p.leases[u]; !ok || !lok || l.MAC != mac.String() {
+		return nil
+	}
+	p.leases[u] = &lease{IP: uintToIP4(u), Expiry: p.now().Add(p.duration)}
+	return p.save()
+}
+
+// lookup returns the address leased to mac, or nil.
+func (p *pool) lookup(mac net.HardwareAddr) net.IP {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := mac.String()
+	if u, ok := p.find(m); ok && !p.now().After(p.leases[u].Expiry) {
+		return uintToIP4(u)
+	}
+	return nil
+}
+
+// save writes the leases to the file, atomically.
+func (p *pool) save() error {
+	if p.file == "" {
+		return nil
+	}
+	leases := make([]*lease, 0, len(p.leases))
+	for _, l := range p.leases {
+		leases = append(leases, l)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		a, _ := ip4ToUint(leases[i].IP)
+		b, _ := ip4ToUint(leases[j].IP)
+		return a < b
+	})
+	b, err := json.MarshalIndent(leases, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := p.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.file)
+}
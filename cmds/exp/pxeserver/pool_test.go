@@ -0,0 +1,123 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mac
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tt := range []struct {
+		r     string
+		start string
+		end   string
+		err   error
+	}{
+		{r: "192.168.0.100-192.168.0.200", start: "192.168.0.100", end: "192.168.0.200"},
+		{r: "10.0.0.1 - 10.0.0.1", start: "10.0.0.1", end: "10.0.0.1"},
+		{r: "192.168.0.200-192.168.0.100", err: errBadRange},
+		{r: "192.168.0.100", err: errBadRange},
+		{r: "fec0::1-fec0::2", err: errBadRange},
+	} {
+		start, end, err := parseRange(tt.r)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("parseRange(%q) = %v, want %v", tt.r, err, tt.err)
+			continue
+		}
+		if err == nil && (start.String() != tt.start || end.String() != tt.end) {
+			t.Errorf("parseRange(%q) = %v, %v, want %s, %s", tt.r, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "leases")
+	reserved := map[string]net.IP{"52:54:00:00:00:09": net.ParseIP("10.0.0.2")}
+	p, err := newPool(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.4"), time.Hour, file, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	a, b, c := mustMAC(t, "52:54:00:00:00:01"), mustMAC(t, "52:54:00:00:00:02"), mustMAC(t, "52:54:00:00:00:03")
+
+	offer := func(mac net.HardwareAddr, requested, want string) {
+		t.Helper()
+		ip, err := p.offer(mac, net.ParseIP(requested))
+		if err != nil {
+			t.Fatalf("offer(%s, %s) = %v", mac, requested, err)
+		}
+		if ip.String() != want {
+			t.Fatalf("offer(%s, %s) = %v, want %s", mac, requested, ip, want)
+		}
+	}
+	commit := func(mac net.HardwareAddr, ip string, want error) {
+		t.Helper()
+		if err := p.commit(mac, net.ParseIP(ip)); !errors.Is(err, want) {
+			t.Fatalf("commit(%s, %s) = %v, want %v", mac, ip, err, want)
+		}
+	}
+
+	// The first free address, and the same again.
+	offer(a, "", "10.0.0.1")
+	offer(a, "", "10.0.0.1")
+	// The reserved address is skipped.
+	offer(b, "", "10.0.0.3")
+	// An offered address is kept for its client.
+	commit(c, "10.0.0.3", errNotAvailable)
+	commit(b, "10.0.0.3", nil)
+	// The requested address if it is free.
+	offer(c, "10.0.0.1", "10.0.0.4")
+	offer(c, "10.0.0.4", "10.0.0.4")
+	commit(a, "10.0.0.1", nil)
+	commit(a, "10.0.0.2", errNotAvailable)
+	commit(a, "10.0.0.5", errNotAvailable)
+
+	if _, err := p.offer(mustMAC(t, "52:54:00:00:00:04"), nil); !errors.Is(err, errPoolExhausted) {
+		t.Fatalf("offer with all addresses taken = %v, want %v", err, errPoolExhausted)
+	}
+	if ip := p.lookup(a); ip.String() != "10.0.0.1" {
+		t.Errorf("lookup(%s) = %v, want 10.0.0.1", a, ip)
+	}
+
+	// The leases survive restarts, but not the offers.
+	p, err = newPool(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.4"), time.Hour, file, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.now = func() time.Time { return now }
+	offer(a, "", "10.0.0.1")
+	offer(b, "10.0.0.4", "10.0.0.3")
+	offer(c, "", "10.0.0.4")
+
+	// Released and declined addresses.
+	if err := p.release(a, net.ParseIP("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.decline(c, net.ParseIP("10.0.0.4")); err != nil {
+		t.Fatal(err)
+	}
+	offer(c, "10.0.0.4", "10.0.0.1")
+
+	// Expired leases are free again.
+	now = now.Add(2 * time.Hour)
+	offer(mustMAC(t, "52:54:00:00:00:04"), "10.0.0.3", "10.0.0.3")
+	if ip := p.lookup(b); ip != nil {
+		t.Errorf("lookup(%s) after expiry = %v, want nil", b, ip)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"pack.ag/tftp"
+)
+
+// ipxePath is where the HTTP server serves the iPXE scripts of the hosts,
+// like /ipxe/52:54:00:12:34:56.
+const ipxePath = "/ipxe/"
+
+// pxelinuxPrefix starts the name of the pxelinux config of a host, like
+// pxelinux.cfg/01-52-54-00-12-34-56. The 01 is the ARP type of Ethernet.
+const pxelinuxPrefix = "pxelinux.cfg/01-"
+
+// ipxeURL returns the URL of the iPXE script of mac.
+func ipxeURL(httpURL string, mac net.HardwareAddr) string {
+	return httpURL + ipxePath + mac.String()
+}
+
+// pxelinuxMAC returns the MAC of a pxelinux config file name.
+func pxelinuxMAC(name string) (net.HardwareAddr, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if !strings.HasPrefix(name, pxelinuxPrefix) {
+		return nil, false
+	}
+	mac, err := net.ParseMAC(strings.ReplaceAll(strings.TrimPrefix(name, pxelinuxPrefix), "-", ":"))
+	return mac, err == nil
+}
+
+// templateData is what the iPXE and pxelinux templates are executed with.
+type templateData struct {
+	MAC      string
+	IP       string
+	Hostname string
+	ServerIP string
+	// HTTPURL is the URL of the HTTP server, like http://192.168.0.1:80.
+	HTTPURL string
+	// Vars are those of the host and the config.
+	Vars map[string]string
+}
+
+// templates serves the iPXE and pxelinux configs of the hosts, and else
+// the files of the TFTP and HTTP directories.
+type templates struct {
+	// ipxe and pxelinux may be nil.
+	ipxe     *template.Template
+	pxelinux *template.Template
+	cfg      *config
+	// address returns the IPv4 address of a host.
+	address  func(net.HardwareAddr) net.IP
+	serverIP net.IP
+	httpURL  string
+	// tftpFiles and httpFiles may be nil.
+	tftpFiles tftp.ReadHandler
+	httpFiles http.Handler
+}
+
+// parseTemplate parses the template file, if any.
+func parseTemplate(file string) (*template.Template, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(path.Base(file)).Option("missingkey=zero").Parse(string(b))
+}
+
+// render executes t for mac.
+func (t *templates) render(tmpl *template.Template, mac net.HardwareAddr) ([]byte, error) {
+	h := t.cfg.host(mac)
+	d := &templateData{
+		MAC:      mac.String(),
+		Hostname: h.Hostname,
+		ServerIP: t.serverIP.String(),
+		HTTPURL:  t.httpURL,
+		Vars:     h.Vars,
+	}
+	if ip := t.address(mac); ip != nil {
+		d.IP = ip.String()
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, d); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// config returns the rendered config of a request for name, if it is one.
+func (t *templates) config(name string) ([]byte, bool, error) {
+	if t.ipxe != nil && strings.HasPrefix(name, ipxePath) {
+		mac, err := net.ParseMAC(strings.TrimPrefix(name, ipxePath))
+		if err != nil {
+			return nil, false, nil
+		}
+		b, err := t.render(t.ipxe, mac)
+		return b, true, err
+	}
+	if mac, ok := pxelinuxMAC(name); ok && t.pxelinux != nil {
+		b, err := t.render(t.pxelinux, mac)
+		return b, true, err
+	}
+	return nil, false, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (t *templates) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, ok, err := t.config(r.URL.Path)
+	switch {
+	case err != nil:
+		log.Printf("Rendering %s: %v", r.URL.Path, err)
+		http.Error(w, "template error", http.StatusInternalServerError)
+	case ok:
+		log.Printf("Serving %s to %s", r.URL.Path, r.RemoteAddr)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(b)
+	case t.httpFiles != nil:
+		t.httpFiles.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ServeTFTP implements tftp.ReadHandler.
+func (t *templates) ServeTFTP(r tftp.ReadRequest) {
+	b, ok, err := t.config(r.Name())
+	switch {
+	case err != nil:
+		log.Printf("Rendering %s: %v", r.Name(), err)
+		r.WriteError(tftp.ErrCodeNotDefined, "template error")
+	case ok:
+		log.Printf("Serving %s to %s", r.Name(), r.Addr())
+		r.WriteSize(int64(len(b)))
+		if _, err := r.Write(b); err != nil {
+			log.Printf("Sending %s: %v", r.Name(), err)
+		}
+	case t.tftpFiles != nil:
+		t.tftpFiles.ServeTFTP(r)
+	default:
+		r.WriteError(tftp.ErrCodeFileNotFound, "file not found")
+	}
+}
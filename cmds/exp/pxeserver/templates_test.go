@@ -0,0 +1,180 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pack.ag/tftp"
+)
+
+func TestReadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(`{
+		"boot": {"pxe": "undionly.kpxe", "efi": "ipxe.efi"},
+		"vars": {"kernel": "vmlinuz", "console": "ttyS0"},
+		"hosts": {
+			"52-54-00-12-34-56": {
+				"ip": "192.168.0.10",
+				"hostname": "node1",
+				"boot": {"efi": "node1.efi"},
+				"vars": {"kernel": "vmlinuz-6.6"}
+			}
+		}
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := readConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := c.host(mustMAC(t, "52:54:00:12:34:56"))
+	if h.Hostname != "node1" || !h.IP.Equal(net.ParseIP("192.168.0.10")) {
+		t.Errorf("host = %+v, want node1 at 192.168.0.10", h)
+	}
+	if want := (bootFiles{PXE: "undionly.kpxe", EFI: "node1.efi"}); h.Boot != want {
+		t.Errorf("boot files = %+v, want %+v", h.Boot, want)
+	}
+	if h.Vars["kernel"] != "vmlinuz-6.6" || h.Vars["console"] != "ttyS0" {
+		t.Errorf("vars = %v, want kernel vmlinuz-6.6 and console ttyS0", h.Vars)
+	}
+	if h := c.host(mustMAC(t, "52:54:00:12:34:57")); h.IP != nil || h.Boot.EFI != "ipxe.efi" {
+		t.Errorf("unknown host = %+v, want the defaults", h)
+	}
+
+	for _, bad := range []string{
+		`{"hosts": {"nonsense": {}}}`,
+		`{"hosts": {"52:54:00:12:34:56": {"ip": "fec0::1"}}}`,
+		`{`,
+	} {
+		if err := os.WriteFile(file, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(file); err == nil {
+			t.Errorf("readConfig(%s) = nil, want an error", bad)
+		}
+	}
+}
+
+func TestPxelinuxMAC(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mac  string
+	}{
+		{name: "pxelinux.cfg/01-52-54-00-12-34-56", mac: "52:54:00:12:34:56"},
+		{name: "/pxelinux.cfg/01-52-54-00-12-34-56", mac: "52:54:00:12:34:56"},
+		{name: "pxelinux.cfg/default"},
+		{name: "pxelinux.cfg/C0A8"},
+		{name: "pxelinux.cfg/01-nonsense"},
+	} {
+		mac, ok := pxelinuxMAC(tt.name)
+		if ok != (tt.mac != "") || (ok && mac.String() != tt.mac) {
+			t.Errorf("pxelinuxMAC(%q) = %v, %v, want %q", tt.name, mac, ok, tt.mac)
+		}
+	}
+}
+
+// readRequest is a tftp.ReadRequest that keeps what is written to it.
+type readRequest struct {
+	name string
+	bytes.Buffer
+	errCode tftp.ErrorCode
+	errMsg  string
+}
+
+func (r *readRequest) Name() string                          { return r.name }
+func (r *readRequest) Addr() *net.UDPAddr                    { return &net.UDPAddr{} }
+func (r *readRequest) WriteSize(int64)                       {}
+func (r *readRequest) TransferMode() tftp.TransferMode       { return tftp.ModeOctet }
+func (r *readRequest) WriteError(c tftp.ErrorCode, m string) { r.errCode, r.errMsg = c, m }
+
+func TestTemplates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("file contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ipxeFile := filepath.Join(dir, "ipxe.tmpl")
+	if err := os.WriteFile(ipxeFile, []byte("#!ipxe\nkernel {{.HTTPURL}}/{{.Vars.kernel}} ip={{.IP}} hostname={{.Hostname}}\nboot\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pxelinuxFile := filepath.Join(dir, "pxelinux.tmpl")
+	if err := os.WriteFile(pxelinuxFile, []byte("DEFAULT linux\nLABEL linux\n  KERNEL {{.Vars.kernel}}\n  APPEND ip={{.IP}}::{{.ServerIP}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := testServer4(t)
+	s.cfg.Vars = map[string]string{"kernel": "vmlinuz"}
+	tm := &templates{
+		cfg:       s.cfg,
+		address:   s.address,
+		serverIP:  s.self,
+		httpURL:   s.httpURL,
+		tftpFiles: tftp.FileServer(dir),
+		httpFiles: http.FileServer(http.Dir(dir)),
+	}
+	var err error
+	if tm.ipxe, err = parseTemplate(ipxeFile); err != nil {
+		t.Fatal(err)
+	}
+	if tm.pxelinux, err = parseTemplate(pxelinuxFile); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(tm)
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{
+			path: "/ipxe/52:54:00:00:00:09",
+			want: "#!ipxe\nkernel http://192.168.0.1:80/vmlinuz ip=192.168.0.9 hostname=node9\nboot\n",
+		},
+		{
+			path: "/pxelinux.cfg/01-52-54-00-00-00-09",
+			want: "DEFAULT linux\nLABEL linux\n  KERNEL vmlinuz\n  APPEND ip=192.168.0.9::192.168.0.1\n",
+		},
+		{
+			// Hosts that have no address yet.
+			path: "/ipxe/52:54:00:00:00:01",
+			want: "#!ipxe\nkernel http://192.168.0.1:80/vmlinuz ip= hostname=\nboot\n",
+		},
+		{path: "/file", want: "file contents"},
+	} {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || string(b) != tt.want {
+			t.Errorf("GET %s = %s %q, want %q", tt.path, resp.Status, b, tt.want)
+		}
+
+		r := &readRequest{name: tt.path[1:]}
+		tm.ServeTFTP(r)
+		if strings.HasPrefix(tt.path, ipxePath) {
+			// iPXE scripts are only served over HTTP.
+			if r.errCode != tftp.ErrCodeFileNotFound {
+				t.Errorf("TFTP %s = %q, want file not found", tt.path, r.String())
+			}
+			continue
+		}
+		if r.String() != tt.want || r.errMsg != "" {
+			t.Errorf("TFTP %s = %q, %q, want %q", tt.path, r.String(), r.errMsg, tt.want)
+		}
+	}
+}
@@ -6,28 +6,75 @@
 //
 // Synopsis:
 //
-//	srvfiles [--h=HOST] [--p=PORT] [--d=DIR]
+//	srvfiles [--h=HOST] [--p=PORT] [--d=DIR] [--tls [--cert=FILE --key=FILE]]
+//	         [--user=NAME:PASSWORD] [--token=TOKEN] [--upload]
+//
+// Description:
+//
+//	srvfiles serves the files of a directory over HTTP, or HTTPS with
+//	--tls. Without --cert and --key, it generates a self-signed
+//	certificate, and prints its SHA-256 fingerprint to check clients
+//	against.
+//
+//	Directories are downloaded as gzipped tar archives by appending
+//	.tar.gz to their path, like
+//
+//		curl -O http://host:8080/logs.tar.gz
+//
+//	With --upload, files are uploaded with PUT to their path, or with a
+//	multipart POST of files to a directory, like
+//
+//		curl -T dmesg.txt http://host:8080/logs/
+//		curl -F f=@dmesg.txt http://host:8080/logs/
 //
 // Options:
 //
-//	--h: hostname (default: 127.0.0.1)
-//	--p: port number (default: 8080)
-//	--d: directory to serve (default: .)
+//	--h:      hostname (default: 127.0.0.1)
+//	--p:      port number (default: 8080)
+//	--d:      directory to serve (default: .)
+//	--tls:    serve HTTPS
+//	--cert:   certificate file for --tls
+//	--key:    key file for --tls
+//	--user:   require basic authentication as NAME:PASSWORD
+//	--token:  require the bearer token TOKEN
+//	--upload: allow uploads into the directory
 package main
 
 import (
+	"compress/gzip"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/tarutil"
 )
 
 var (
-	host = flag.String("h", "127.0.0.1", "hostname")
-	port = flag.String("p", "8080", "port number")
-	dir  = flag.String("d", ".", "directory to serve")
+	host     = flag.String("h", "127.0.0.1", "hostname")
+	port     = flag.String("p", "8080", "port number")
+	dir      = flag.String("d", ".", "directory to serve")
+	useTLS   = flag.Bool("tls", false, "serve HTTPS")
+	certFile = flag.String("cert", "", "certificate file for -tls, a self-signed certificate is generated if unset")
+	keyFile  = flag.String("key", "", "key file for -tls")
+	user     = flag.String("user", "", "require basic authentication as name:password")
+	token    = flag.String("token", "", "require this bearer token")
+	upload   = flag.Bool("upload", false, "allow PUT and POST uploads into the directory")
 )
 
+var errBadPath = errors.New("bad upload path")
+
 var cacheHeaders = []string{
 	"ETag",
 	"If-Modified-Since",
@@ -48,8 +95,192 @@ func maxAgeHandler(h http.Handler) http.Handler {
 	})
 }
 
+// equal compares secrets in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authHandler requires basic authentication as user, name:password, or
+// the bearer token. Either does if both are set, and none if neither is.
+func authHandler(user, token string, h http.Handler) http.Handler {
+	if user == "" && token == "" {
+		return h
+	}
+	name, password, _ := strings.Cut(user, ":")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n, p, ok := r.BasicAuth(); ok && user != "" && equal(n, name) && equal(p, password) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" && equal(t, token) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if user != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="srvfiles"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// localPath returns the file of dir at the URL path p.
+func localPath(dir, p string) string {
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// tarHandler serves the directories of dir as gzipped tar archives, at
+// their path with .tar.gz appended. Files with that name are served as
+// they are.
+func tarHandler(dir string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := strings.CutSuffix(r.URL.Path, ".tar.gz")
+		if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if _, err := os.Stat(localPath(dir, r.URL.Path)); err == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		d := localPath(dir, p)
+		if fi, err := os.Stat(d); err != nil || !fi.IsDir() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// The archive has the directory, except for the served one.
+		parent, files := filepath.Dir(d), []string{filepath.Base(d)}
+		if d == filepath.Clean(dir) {
+			parent, files = d, []string{"."}
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(d) + ".tar.gz"}))
+		if r.Method == http.MethodHead {
+			return
+		}
+		gz := gzip.NewWriter(w)
+		if err := tarutil.CreateTar(gz, files, &tarutil.Opts{ChangeDirectory: parent}); err != nil {
+			// The status is sent already, so abort to tell the
+			// client that the archive is cut short.
+			log.Printf("Archiving %s: %v", d, err)
+			panic(http.ErrAbortHandler)
+		}
+		if err := gz.Close(); err != nil {
+			log.Printf("Archiving %s: %v", d, err)
+		}
+	})
+}
+
+// saveFile writes the file of dir at the URL path p from r. It replaces
+// the file only once all of it is written.
+func saveFile(dir, p string, r io.Reader) error {
+	name := localPath(dir, p)
+	if strings.HasSuffix(p, "/") || name == filepath.Clean(dir) {
+		return fmt.Errorf("%w: %q is a directory", errBadPath, p)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// uploadHandler saves the files of PUT requests and multipart POST
+// requests into dir. Other POST requests are like PUT.
+func uploadHandler(dir string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		switch r.Method {
+		case http.MethodPut:
+			err = saveFile(dir, r.URL.Path, r.Body)
+		case http.MethodPost:
+			if mr, merr := r.MultipartReader(); merr == nil {
+				err = saveParts(dir, r.URL.Path, mr)
+			} else {
+				err = saveFile(dir, r.URL.Path, r.Body)
+			}
+		default:
+			h.ServeHTTP(w, r)
+			return
+		}
+		switch {
+		case errors.Is(err, errBadPath):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err != nil:
+			log.Printf("Upload of %s: %v", r.URL.Path, err)
+			http.Error(w, "upload failed", http.StatusInternalServerError)
+		default:
+			log.Printf("Uploaded %s from %s", r.URL.Path, r.RemoteAddr)
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+}
+
+// saveParts saves the files of a multipart form into the directory at p.
+func saveParts(dir, p string, mr *multipart.Reader) error {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if name := part.FileName(); name != "" {
+			err = saveFile(dir, path.Join(p, name), part)
+		}
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func main() {
 	flag.Parse()
-	http.Handle("/", maxAgeHandler(http.FileServer(http.Dir(*dir))))
-	log.Fatal(http.ListenAndServe(net.JoinHostPort(*host, *port), nil))
+
+	var h http.Handler = maxAgeHandler(http.FileServer(http.Dir(*dir)))
+	h = tarHandler(*dir, h)
+	if *upload {
+		h = uploadHandler(*dir, h)
+	}
+	h = authHandler(*user, *token, h)
+	http.Handle("/", h)
+
+	addr := net.JoinHostPort(*host, *port)
+	if !*useTLS {
+		log.Fatal(http.ListenAndServe(addr, nil))
+	}
+
+	var cert tls.Certificate
+	var err error
+	if *certFile != "" || *keyFile != "" {
+		cert, err = tls.LoadX509KeyPair(*certFile, *keyFile)
+	} else {
+		cert, err = selfSignedCert(*host)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Certificate SHA256 fingerprint %s", fingerprint(cert))
+	s := &http.Server{
+		Addr:      addr,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	log.Fatal(s.ListenAndServeTLS("", ""))
 }
@@ -4,12 +4,18 @@
 package main
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"crypto/tls"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -48,3 +54,208 @@ func TestSRVFiles(t *testing.T) {
 		t.Errorf("Expected %q, got %q", content, b)
 	}
 }
+
+func handler(dir string) http.Handler {
+	return authHandler("me:secret", "tok", uploadHandler(dir, tarHandler(dir, maxAgeHandler(http.FileServer(http.Dir(dir))))))
+}
+
+func do(t *testing.T, method, url string, body io.Reader, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("me", "secret")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, b
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello"), []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler(dir))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		name   string
+		auth   func(*http.Request)
+		status int
+	}{
+		{name: "none", auth: func(*http.Request) {}, status: http.StatusUnauthorized},
+		{name: "basic", auth: func(r *http.Request) { r.SetBasicAuth("me", "secret") }, status: http.StatusOK},
+		{name: "bad password", auth: func(r *http.Request) { r.SetBasicAuth("me", "guess") }, status: http.StatusUnauthorized},
+		{name: "token", auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok") }, status: http.StatusOK},
+		{name: "bad token", auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, status: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/hello", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.auth(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello"), []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler(dir))
+	defer ts.Close()
+
+	resp, b := do(t, http.MethodGet, ts.URL+"/hello", nil, map[string]string{"Range": "bytes=6-"})
+	if resp.StatusCode != http.StatusPartialContent || string(b) != "world" {
+		t.Errorf("GET with range = %d %q, want %d %q", resp.StatusCode, b, http.StatusPartialContent, "world")
+	}
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	ts := httptest.NewServer(handler(dir))
+	defer ts.Close()
+
+	if resp, b := do(t, http.MethodPut, ts.URL+"/logs/dmesg", strings.NewReader("dmesg"), nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT = %d %q, want %d", resp.StatusCode, b, http.StatusCreated)
+	}
+	if resp, _ := do(t, http.MethodPut, ts.URL+"/logs/", strings.NewReader("dir"), nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT to a directory = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	// Paths do not escape the directory.
+	if resp, _ := do(t, http.MethodPost, ts.URL+"/../escape", strings.NewReader("escape"), nil); resp.StatusCode != http.StatusCreated {
+		t.Errorf("POST = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, content := range map[string]string{"a.txt": "a", "b.txt": "b"} {
+		w, err := mw.CreateFormFile("f", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	mw.WriteField("comment", "not a file")
+	mw.Close()
+	if resp, b := do(t, http.MethodPost, ts.URL+"/logs/", &body, map[string]string{"Content-Type": mw.FormDataContentType()}); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("multipart POST = %d %q, want %d", resp.StatusCode, b, http.StatusCreated)
+	}
+
+	for name, want := range map[string]string{"logs/dmesg": "dmesg", "escape": "escape", "logs/a.txt": "a", "logs/b.txt": "b"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", name, b, err, want)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "logs"))
+	if err != nil || len(entries) != 3 {
+		t.Errorf("logs has %v, %v, want 3 files", entries, err)
+	}
+}
+
+func TestTarGz(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"logs/dmesg": "dmesg", "logs/sub/messages": "messages", "archive.tar.gz": "real file"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler(dir))
+	defer ts.Close()
+
+	resp, b := do(t, http.MethodGet, ts.URL+"/logs.tar.gz", nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(c)
+	}
+	want := map[string]string{"logs": "", "logs/dmesg": "dmesg", "logs/sub": "", "logs/sub/messages": "messages"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archive = %v, want %v", got, want)
+	}
+
+	// Files are served as they are.
+	if resp, b := do(t, http.MethodGet, ts.URL+"/archive.tar.gz", nil, nil); resp.StatusCode != http.StatusOK || string(b) != "real file" {
+		t.Errorf("GET of a file = %d %q, want %q", resp.StatusCode, b, "real file")
+	}
+	if resp, _ := do(t, http.MethodGet, ts.URL+"/nothing.tar.gz", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of nothing = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	cert, err := selfSignedCert("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	want := fingerprint(cert)
+	if len(want) != 32*3-1 {
+		t.Errorf("fingerprint %q is not 32 hex bytes", want)
+	}
+	var got string
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			got = fingerprint(tls.Certificate{Certificate: [][]byte{cs.PeerCertificates[0].Raw}})
+			return cs.PeerCertificates[0].VerifyHostname("127.0.0.1")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got != want {
+		t.Errorf("fingerprint = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// maxJumps limits ProxyJump chains, which may loop in ssh_config.
+const maxJumps = 16
+
+// endpoint is a host to connect to, with its ssh_config applied.
+type endpoint struct {
+	// alias is the host as given, which ssh_config Host patterns match.
+	alias string
+	user  string
+	// addr is the address to connect to, host:port.
+	addr string
+	// identity is the key file of -i.
+	identity string
+	// overrides are the values of the -o options, by lower case keyword.
+	// Like -i, they only apply to the destination, not to jump hosts.
+	overrides map[string][]string
+}
+
+// option returns the value of an ssh_config keyword for e.
+func (e *endpoint) option(key string) string {
+	// Like ssh_config, the first value given is used.
+	if vs := e.overrides[strings.ToLower(key)]; len(vs) > 0 {
+		return vs[0]
+	}
+	v, _ := cfg.Get(e.alias, key)
+	return v
+}
+
+// options returns the values of an ssh_config keyword that may be given
+// more than once, like LocalForward.
+func (e *endpoint) options(key string) []string {
+	vs, _ := cfg.GetAll(e.alias, key)
+	return append(vs, e.overrides[strings.ToLower(key)]...)
+}
+
+// newEndpoint returns the endpoint of dest, [user@]host[:port], where
+// ssh_config's User and Port apply unless dest has them, and HostName
+// replaces host.
+func newEndpoint(dest string, overrides map[string][]string) (*endpoint, error) {
+	user, host, port, err := parseDest(dest)
+	if err != nil {
+		return nil, err
+	}
+	e := &endpoint{alias: host, overrides: overrides}
+	rest := strings.TrimPrefix(dest, "ssh://")
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	} else if u := e.option("User"); u != "" {
+		user = u
+	}
+	if _, _, err := net.SplitHostPort(rest); err != nil {
+		if p := e.option("Port"); p != "" {
+			port = p
+		}
+	}
+	if h := e.option("HostName"); h != "" {
+		host = h
+	}
+	e.user = user
+	e.addr = net.JoinHostPort(host, port)
+	return e, nil
+}
+
+// route returns the endpoints to connect through to reach dest, which is
+// the last. The jump hosts are those of jump, or dest's ProxyJump. The
+// first jump host may have a ProxyJump itself.
+func route(dest, jump string, overrides map[string][]string, depth int) ([]*endpoint, error) {
+	e, err := newEndpoint(dest, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if jump == "" {
+		jump = e.option("ProxyJump")
+	}
+	if jump == "" || jump == "none" {
+		return []*endpoint{e}, nil
+	}
+	if depth >= maxJumps {
+		return nil, fmt.Errorf("more than %d jump hosts to %s", maxJumps, dest)
+	}
+	jumps := strings.Split(jump, ",")
+	r, err := route(jumps[0], "", nil, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jumps[1:] {
+		je, err := newEndpoint(j, nil)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, je)
+	}
+	return append(r, e), nil
+}
+
+// expandHome replaces a leading ~ in p with the home directory.
+func expandHome(p string) string {
+	if strings.HasPrefix(p, "~") {
+		return filepath.Join(os.Getenv("HOME"), p[1:])
+	}
+	return p
+}
+
+func knownHosts(files ...string) (ssh.HostKeyCallback, error) {
+	etc, err := filepath.Glob("/etc/*/ssh_known_hosts")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if home, ok := os.LookupEnv("HOME"); ok {
+			files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+		}
+	}
+	var existing []string
+	for _, f := range append(etc, files...) {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	return knownhosts.New(existing...)
+}
+
+// hostKeyCallback checks host keys against the known hosts of e, unless
+// its StrictHostKeyChecking is no.
+func hostKeyCallback(e *endpoint) (ssh.HostKeyCallback, error) {
+	if e.option("StrictHostKeyChecking") == "no" {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	var files []string
+	for _, f := range strings.Fields(e.option("UserKnownHostsFile")) {
+		files = append(files, expandHome(f))
+	}
+	return knownHosts(files...)
+}
+
+// loadKey adds the key for e to the agent.
+func (c *cmd) loadKey(e *endpoint) error {
+	kf := e.identity
+	if kf == "" && len(e.overrides["identityfile"]) > 0 {
+		kf = e.overrides["identityfile"][0]
+	}
+	kf = getKeyFile(e.alias, kf)
+	key, err := os.ReadFile(kf)
+	if err != nil {
+		if e.identity != "" {
+			return fmt.Errorf("could not read user-specified keyfile %v: %w", kf, err)
+		}
+		return nil
+	}
+	raw, err := ssh.ParseRawPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("ParsePrivateKey %v: %w", kf, err)
+	}
+	return c.agent.Add(agent.AddedKey{PrivateKey: raw, Comment: kf})
+}
+
+// clientConfig returns the configuration to connect to e with. All keys
+// loaded so far are tried.
+func (c *cmd) clientConfig(e *endpoint) (*ssh.ClientConfig, error) {
+	cb, err := hostKeyCallback(e)
+	if err != nil {
+		return nil, fmt.Errorf("known hosts: %w", err)
+	}
+	if err := c.loadKey(e); err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            e.user,
+		HostKeyCallback: cb,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(c.agent.Signers)},
+	}
+	v("Config: %+v\n", config)
+	if term.IsTerminal(int(c.stdin.Fd())) {
+		pwReader := func() (string, error) {
+			return readPassword(c.stdin, c.stdout)
+		}
+		config.Auth = append(config.Auth, ssh.PasswordCallback(pwReader))
+	}
+	return config, nil
+}
+
+// dial connects to the endpoints one through the other, and returns the
+// client of the last.
+func (c *cmd) dial(r []*endpoint) (*ssh.Client, error) {
+	var client *ssh.Client
+	for _, e := range r {
+		config, err := c.clientConfig(e)
+		if err != nil {
+			return nil, err
+		}
+		v("connecting to %s as %s", e.addr, e.user)
+		var conn net.Conn
+		if client == nil {
+			conn, err = net.Dial("tcp", e.addr)
+		} else {
+			conn, err = client.Dial("tcp", e.addr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to %s: %w", e.addr, err)
+		}
+		sc, chans, reqs, err := ssh.NewClientConn(conn, e.addr, config)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to connect to %s: %w", e.addr, err)
+		}
+		client = ssh.NewClient(sc, chans, reqs)
+		c.clients = append(c.clients, client)
+	}
+	return client, nil
+}
+
+// connect connects to dest, through the jump hosts of -J or ssh_config.
+func (c *cmd) connect(dest string) (*ssh.Client, error) {
+	r, err := route(dest, c.jump, c.overrides, 0)
+	if err != nil {
+		return nil, fmt.Errorf("destination parse failed: %w", err)
+	}
+	c.dest = r[len(r)-1]
+	r[len(r)-1].identity = c.keyFile
+	return c.dial(r)
+}
+
+// close closes the clients, the last first.
+func (c *cmd) close() {
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		c.clients[i].Close()
+	}
+}
+
+var errBadOption = errors.New("bad -o option")
+
+// parseOption parses an -o option, Key=Value or "Key Value".
+func parseOption(o string) (string, string, error) {
+	k, val, ok := strings.Cut(strings.TrimSpace(o), "=")
+	if !ok {
+		k, val, ok = strings.Cut(strings.TrimSpace(o), " ")
+	}
+	k, val = strings.TrimSpace(k), strings.TrimSpace(val)
+	if !ok || k == "" || val == "" {
+		return "", "", fmt.Errorf("%w: %q", errBadOption, o)
+	}
+	return strings.ToLower(k), val, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var errBadForward = errors.New("bad forwarding specification")
+
+// forward is a port forwarding of -L, -R or -D.
+type forward struct {
+	// listen is the address to listen on, locally for -L and -D and on
+	// the server for -R.
+	listen string
+	// dest is where connections are forwarded to, from the server for
+	// -L and locally for -R. It is empty for -D.
+	dest string
+}
+
+// splitForward splits a forwarding specification at the colons that are
+// not in brackets, like in [::1]:80.
+func splitForward(spec string) []string {
+	var fields []string
+	var field strings.Builder
+	brackets := false
+	for _, r := range spec {
+		switch {
+		case r == '[':
+			brackets = true
+		case r == ']':
+			brackets = false
+		case r == ':' && !brackets:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	return append(fields, field.String())
+}
+
+// parseForward parses a forwarding specification of -L or -R,
+// [bind_address:]port:host:hostport, or of -D, [bind_address:]port.
+//
+// A missing bind address means localhost, "*" means all addresses. The
+// port and destination of ssh_config's LocalForward and RemoteForward may
+// be separated by a space.
+func parseForward(spec string, dynamic bool) (*forward, error) {
+	fields := splitForward(strings.Replace(strings.TrimSpace(spec), " ", ":", 1))
+	n := 3
+	if dynamic {
+		n = 1
+	}
+	if len(fields) == n {
+		fields = append([]string{"localhost"}, fields...)
+	}
+	if len(fields) != n+1 {
+		return nil, fmt.Errorf("%w: %q", errBadForward, spec)
+	}
+	for _, f := range fields[1:] {
+		if f == "" {
+			return nil, fmt.Errorf("%w: %q", errBadForward, spec)
+		}
+	}
+	if fields[0] == "*" {
+		fields[0] = ""
+	}
+	fw := &forward{listen: net.JoinHostPort(fields[0], fields[1])}
+	if !dynamic {
+		fw.dest = net.JoinHostPort(fields[2], fields[3])
+	}
+	return fw, nil
+}
+
+// pipe copies between a and b until both are done, and closes them.
+func pipe(a, b io.ReadWriteCloser) {
+	defer a.Close()
+	defer b.Close()
+	done := make(chan struct{}, 2)
+	half := func(dst, src io.ReadWriteCloser) {
+		io.Copy(dst, src)
+		// Tell the other end that no more data comes.
+		switch c := dst.(type) {
+		case ssh.Channel:
+			c.CloseWrite()
+		case *net.TCPConn:
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go half(a, b)
+	go half(b, a)
+	<-done
+	<-done
+}
+
+// serveForward accepts connections on l and pipes them to those that dial
+// returns, until l is closed.
+func serveForward(l net.Listener, dial func(net.Conn) (net.Conn, error)) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			d, err := dial(c)
+			if err != nil {
+				log.Printf("forwarding %v: %v", l.Addr(), err)
+				c.Close()
+				return
+			}
+			pipe(c, d)
+		}()
+	}
+}
+
+// localForward forwards connections to a local port through client, for
+// -L.
+func localForward(client *ssh.Client, f *forward) (net.Listener, error) {
+	l, err := net.Listen("tcp", f.listen)
+	if err != nil {
+		return nil, err
+	}
+	go serveForward(l, func(net.Conn) (net.Conn, error) {
+		return client.Dial("tcp", f.dest)
+	})
+	return l, nil
+}
+
+// remoteForward forwards connections to a port of the server to a local
+// destination, for -R.
+func remoteForward(client *ssh.Client, f *forward) (net.Listener, error) {
+	l, err := client.Listen("tcp", f.listen)
+	if err != nil {
+		return nil, err
+	}
+	go serveForward(l, func(net.Conn) (net.Conn, error) {
+		return net.Dial("tcp", f.dest)
+	})
+	return l, nil
+}
+
+// dynamicForward runs a SOCKS5 proxy on a local port that connects through
+// client, for -D.
+func dynamicForward(client *ssh.Client, f *forward) (net.Listener, error) {
+	l, err := net.Listen("tcp", f.listen)
+	if err != nil {
+		return nil, err
+	}
+	go serveForward(l, func(c net.Conn) (net.Conn, error) {
+		return socks5(c, func(addr string) (net.Conn, error) {
+			return client.Dial("tcp", addr)
+		})
+	})
+	return l, nil
+}
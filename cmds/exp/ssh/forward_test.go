@@ -0,0 +1,117 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestParseForward(t *testing.T) {
+	for _, tt := range []struct {
+		spec    string
+		dynamic bool
+		want    forward
+		err     error
+	}{
+		{spec: "8080:host:80", want: forward{listen: "localhost:8080", dest: "host:80"}},
+		{spec: "0.0.0.0:8080:host:80", want: forward{listen: "0.0.0.0:8080", dest: "host:80"}},
+		{spec: "*:8080:host:80", want: forward{listen: ":8080", dest: "host:80"}},
+		{spec: "[::1]:8080:[fe80::1]:80", want: forward{listen: "[::1]:8080", dest: "[fe80::1]:80"}},
+		{spec: "8080 host:80", want: forward{listen: "localhost:8080", dest: "host:80"}},
+		{spec: "1080", dynamic: true, want: forward{listen: "localhost:1080"}},
+		{spec: "127.0.0.1:1080", dynamic: true, want: forward{listen: "127.0.0.1:1080"}},
+		{spec: "8080:host", err: errBadForward},
+		{spec: "8080::80", err: errBadForward},
+		{spec: "a:b:1080", dynamic: true, err: errBadForward},
+	} {
+		got, err := parseForward(tt.spec, tt.dynamic)
+		if !errors.Is(err, tt.err) || (err == nil && *got != tt.want) {
+			t.Errorf("parseForward(%q, %v) = %+v, %v, want %+v, %v", tt.spec, tt.dynamic, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// echoServer echoes the connections to a new local port, whose address it
+// returns.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func echo(t *testing.T, c io.ReadWriter) {
+	t.Helper()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "ping" {
+		t.Errorf("read %q, %v, want ping", b, err)
+	}
+}
+
+func TestForward(t *testing.T) {
+	config, _, _ := testHosts(t, t.TempDir())
+	if err := loadConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	c := &cmd{agent: agent.NewKeyring(), stdin: os.Stdin}
+	client, err := c.connect("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	addr := echoServer(t)
+
+	for _, tt := range []struct {
+		name  string
+		start func(*ssh.Client, *forward) (net.Listener, error)
+		dest  string
+	}{
+		{name: "local", start: localForward, dest: addr},
+		{name: "remote", start: remoteForward, dest: addr},
+		{name: "dynamic", start: dynamicForward},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := tt.start(client, &forward{listen: "127.0.0.1:0", dest: tt.dest})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if tt.dest == "" {
+				dialSOCKS5(t, conn, addr)
+			}
+			echo(t, conn)
+		})
+	}
+}
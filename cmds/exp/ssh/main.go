@@ -6,14 +6,39 @@
 //
 // Synopsis:
 //
-//	ssh OPTIONS [DEST]
+//	ssh OPTIONS [DEST] [COMMAND]
+//	ssh -scp [-r] OPTIONS SRC... DST
 //
 // Description:
 //
-//	Connects to the specified destination.
+//	Connects to the specified destination, through the jump hosts of -J
+//	or of ProxyJump in the config file. It runs the command, or a shell,
+//	and forwards ports: -L listens locally and connects from the remote
+//	host, -R listens on the remote host and connects locally, and -D runs
+//	a local SOCKS5 proxy that connects from the remote host.
+//
+//	With -A, remote programs can authenticate with the keys ssh loaded,
+//	which an agent inside ssh holds.
+//
+//	With -scp, ssh copies files over SFTP. Either the sources or the
+//	destination are remote files, [user@]host:path.
 //
 // Options:
 //
+//	-A:   forward the agent holding the loaded keys
+//	-D:   [bind_address:]port, local SOCKS5 proxy port
+//	-F:   config file
+//	-J:   comma separated jump hosts, [user@]host[:port]
+//	-L:   [bind_address:]port:host:hostport, local port forwarding
+//	-N:   do not run a command, only forward ports
+//	-R:   [bind_address:]port:host:hostport, remote port forwarding
+//	-d:   enable debug prints
+//	-i:   key file
+//	-o:   config file option, Key=Value, like -o Port=2222; repeat it for
+//	      options like LocalForward
+//	-r:   copy directories recursively with -scp
+//	-scp: copy files over SFTP
+//
 // Destination format:
 //
 //	[user@]hostname or ssh://[user@]hostname[:port]
@@ -28,22 +53,15 @@ import (
 	"net"
 	"os"
 	guser "os/user"
-	"path/filepath"
 	"strings"
 
 	sshconfig "github.com/kevinburke/ssh_config"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/term"
 )
 
 var (
-	flags = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-
-	debug      = flags.Bool("d", false, "enable debug prints")
-	keyFile    = flags.String("i", "", "key file")
-	configFile = flags.String("F", defaultConfigFile, "config file")
-
 	v = func(string, ...interface{}) {}
 
 	// ssh config file
@@ -52,6 +70,43 @@ var (
 	errInvalidArgs = errors.New("invalid command-line arguments")
 )
 
+// listFlag is a flag that may be given more than once.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// cmd is one run of ssh.
+type cmd struct {
+	keyFile    string
+	configFile string
+	jump       string
+	agentFwd   bool
+	noCommand  bool
+	scp        bool
+	recursive  bool
+	local      listFlag
+	remote     listFlag
+	dynamic    listFlag
+	options    listFlag
+
+	stdin  *os.File
+	stdout io.Writer
+	stderr io.Writer
+
+	overrides map[string][]string
+	// agent holds the loaded keys, for authentication and -A.
+	agent   agent.Agent
+	dest    *endpoint
+	clients []*ssh.Client
+}
+
 // loadConfig loads the SSH config file
 func loadConfig(path string) (err error) {
 	var f *os.File
@@ -72,19 +127,22 @@ func main() {
 	}
 }
 
-func knownHosts() (ssh.HostKeyCallback, error) {
-	etc, err := filepath.Glob("/etc/*/ssh_known_hosts")
-	if err != nil {
-		return nil, err
-	}
-	if home, ok := os.LookupEnv("HOME"); ok {
-		etc = append(etc, filepath.Join(home, ".ssh", "known_hosts"))
-	}
-	return knownhosts.New(etc...)
-}
-
 // we demand that stdin be a proper os.File because we need to be able to put it in raw mode
 func run(osArgs []string, stdin *os.File, stdout io.Writer, stderr io.Writer) error {
+	c := &cmd{stdin: stdin, stdout: stdout, stderr: stderr, agent: agent.NewKeyring()}
+	flags := flag.NewFlagSet(osArgs[0], flag.ExitOnError)
+	debug := flags.Bool("d", false, "enable debug prints")
+	flags.StringVar(&c.keyFile, "i", "", "key file")
+	flags.StringVar(&c.configFile, "F", defaultConfigFile, "config file")
+	flags.StringVar(&c.jump, "J", "", "connect through the comma separated jump hosts, [user@]host[:port]")
+	flags.BoolVar(&c.agentFwd, "A", false, "forward the agent holding the loaded keys")
+	flags.BoolVar(&c.noCommand, "N", false, "do not run a command, only forward ports")
+	flags.BoolVar(&c.scp, "scp", false, "copy files over SFTP, the arguments are SRC... DST where remote files are [user@]host:path")
+	flags.BoolVar(&c.recursive, "r", false, "copy directories recursively with -scp")
+	flags.Var(&c.local, "L", "forward a local port to a remote address, [bind_address:]port:host:hostport")
+	flags.Var(&c.remote, "R", "forward a remote port to a local address, [bind_address:]port:host:hostport")
+	flags.Var(&c.dynamic, "D", "forward a local SOCKS5 proxy port to the remote host, [bind_address:]port")
+	flags.Var(&c.options, "o", "ssh_config option, Key=Value")
 	flags.SetOutput(stderr)
 	flags.Parse(osArgs[1:])
 	if *debug {
@@ -94,73 +152,67 @@ func run(osArgs []string, stdin *os.File, stdout io.Writer, stderr io.Writer) er
 
 	// Check if they're given appropriate arguments
 	args := flags.Args()
-	var dest string
-	if len(args) >= 1 {
-		dest = args[0]
-		args = args[1:]
-	} else {
+	if len(args) == 0 {
 		fmt.Fprintf(stderr, "usage: %v [flags] [user@]dest[:port] [command]\n", osArgs[0])
+		fmt.Fprintf(stderr, "       %v -scp [-r] [flags] src... dst\n", osArgs[0])
 		flags.PrintDefaults()
 		return errInvalidArgs
 	}
 
+	c.overrides = map[string][]string{}
+	for _, o := range c.options {
+		k, val, err := parseOption(o)
+		if err != nil {
+			return err
+		}
+		c.overrides[k] = append(c.overrides[k], val)
+	}
+
 	// Read the config file (if any)
-	if err := loadConfig(*configFile); err != nil {
+	if err := loadConfig(expandHome(c.configFile)); err != nil {
 		return fmt.Errorf("config parse failed: %v", err)
 	}
+	defer c.close()
 
-	// Parse out the destination
-	user, host, port, err := parseDest(dest)
-	if err != nil {
-		return fmt.Errorf("destination parse failed: %v", err)
+	if c.scp {
+		return c.copyFiles(args)
 	}
+	return c.session(args[0], args[1:])
+}
 
-	cb, err := knownHosts()
+// session connects to dest, starts the port forwardings and runs the
+// command in args, or a shell.
+func (c *cmd) session(dest string, args []string) error {
+	conn, err := c.connect(dest)
 	if err != nil {
-		return fmt.Errorf("known hosts:%v", err)
-	}
-	// Build a client config with appropriate auth methods
-	config := &ssh.ClientConfig{
-		User:            user,
-		HostKeyCallback: cb,
+		return err
 	}
-	// Figure out if there's a keyfile or not
-	kf := getKeyFile(host, *keyFile)
-	key, err := os.ReadFile(kf)
-	if err == nil {
-		// The key exists
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return fmt.Errorf("ParsePrivateKey %v: %v", kf, err)
-		}
-		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
-	} else if err != nil && *keyFile != "" {
-		return fmt.Errorf("could not read user-specified keyfile %v: %v", kf, err)
+	if err := c.forward(conn); err != nil {
+		return err
 	}
-	v("Config: %+v\n", config)
-	if term.IsTerminal(int(stdin.Fd())) {
-		pwReader := func() (string, error) {
-			return readPassword(stdin, stdout)
-		}
-		config.Auth = append(config.Auth, ssh.PasswordCallback(pwReader))
+	if c.noCommand {
+		return conn.Wait()
 	}
 
-	// Now connect to the server
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(host, port), config)
-	if err != nil {
-		return fmt.Errorf("unable to connect: %v", err)
-	}
-	defer conn.Close()
 	// Create a session on that connection
 	session, err := conn.NewSession()
 	if err != nil {
 		return fmt.Errorf("unable to create session: %v", err)
 	}
-	session.Stdin = stdin
-	session.Stdout = stdout
-	session.Stderr = stderr
+	session.Stdin = c.stdin
+	session.Stdout = c.stdout
+	session.Stderr = c.stderr
 	defer session.Close()
 
+	if c.agentFwd || c.dest.option("ForwardAgent") == "yes" {
+		if err := agent.ForwardToAgent(conn, c.agent); err != nil {
+			return err
+		}
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return fmt.Errorf("agent forwarding: %w", err)
+		}
+	}
+
 	if len(args) > 0 {
 		// run the command
 		if err := session.Run(strings.Join(args, " ")); err != nil {
@@ -173,13 +225,13 @@ func run(osArgs []string, stdin *os.File, stdout io.Writer, stderr io.Writer) er
 			ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
 			ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
 		}
-		if term.IsTerminal(int(stdin.Fd())) {
-			if err := raw(stdin); err != nil {
+		if term.IsTerminal(int(c.stdin.Fd())) {
+			if err := raw(c.stdin); err != nil {
 				// throw a notice but continue
 				log.Printf("failed to set raw mode: %v", err)
 			}
 			// Try to figure out the terminal size
-			width, height, err := getSize(stdin)
+			width, height, err := getSize(c.stdin)
 			if err != nil {
 				return fmt.Errorf("failed to get terminal size: %v", err)
 			}
@@ -190,7 +242,7 @@ func run(osArgs []string, stdin *os.File, stdout io.Writer, stderr io.Writer) er
 		}
 		// Start shell on remote system
 		if err := session.Shell(); err != nil {
-			log.Fatal("failed to start shell: ", err)
+			return fmt.Errorf("failed to start shell: %v", err)
 		}
 		// Wait for the session to complete
 		session.Wait()
@@ -198,6 +250,31 @@ func run(osArgs []string, stdin *os.File, stdout io.Writer, stderr io.Writer) er
 	return nil
 }
 
+// forward starts the port forwardings of the flags and ssh_config.
+func (c *cmd) forward(conn *ssh.Client) error {
+	for _, f := range []struct {
+		specs   []string
+		dynamic bool
+		start   func(*ssh.Client, *forward) (net.Listener, error)
+	}{
+		{append(c.dest.options("LocalForward"), c.local...), false, localForward},
+		{append(c.dest.options("RemoteForward"), c.remote...), false, remoteForward},
+		{append(c.dest.options("DynamicForward"), c.dynamic...), true, dynamicForward},
+	} {
+		for _, spec := range f.specs {
+			fw, err := parseForward(spec, f.dynamic)
+			if err != nil {
+				return err
+			}
+			if _, err := f.start(conn, fw); err != nil {
+				return fmt.Errorf("forwarding %s: %w", spec, err)
+			}
+			v("forwarding %s", spec)
+		}
+	}
+	return nil
+}
+
 // parseDest splits an ssh destination spec into separate user, host, and port fields.
 // Example specs:
 //
@@ -247,9 +324,7 @@ func getKeyFile(host, kf string) string {
 		}
 	}
 	// The kf will always be non-zero at this point.
-	if strings.HasPrefix(kf, "~") {
-		kf = filepath.Join(os.Getenv("HOME"), kf[1:])
-	}
+	kf = expandHome(kf)
 	v("getKeyFile returns %q", kf)
 	// this is a tad annoying, but the config package doesn't handle ~.
 	return kf
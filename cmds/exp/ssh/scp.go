@@ -0,0 +1,241 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// fileSystem is the local or the remote file system, to copy files
+// between them.
+type fileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+	Open(name string) (io.ReadCloser, error)
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+type localFS struct{}
+
+func (localFS) Stat(name string) (os.FileInfo, error)     { return os.Stat(name) }
+func (localFS) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+func (localFS) Open(name string) (io.ReadCloser, error)   { return os.Open(name) }
+func (localFS) Join(elem ...string) string                { return filepath.Join(elem...) }
+func (localFS) Base(name string) string                   { return filepath.Base(name) }
+
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	var fis []os.FileInfo
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		fis = append(fis, fi)
+	}
+	return fis, nil
+}
+
+func (localFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+type remoteFS struct {
+	*sftp.Client
+}
+
+func (r remoteFS) Open(name string) (io.ReadCloser, error) { return r.Client.Open(name) }
+func (remoteFS) Join(elem ...string) string                { return path.Join(elem...) }
+func (remoteFS) Base(name string) string                   { return path.Base(name) }
+
+func (r remoteFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return r.Client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+// splitRemote splits a remote file operand of -scp, [user@]host:path,
+// into the destination and the path. Like scp, operands with a slash
+// before the first colon are local.
+func splitRemote(arg string) (dest, p string, ok bool) {
+	user, rest := "", arg
+	if i := strings.IndexByte(arg, '@'); i >= 0 && !strings.Contains(arg[:i], "/") {
+		user, rest = arg[:i+1], arg[i+1:]
+	}
+	// IPv6 addresses are in brackets, like [::1]:path.
+	if strings.HasPrefix(rest, "[") {
+		i := strings.Index(rest, "]:")
+		if i < 0 {
+			return "", "", false
+		}
+		return user + rest[1:i], rest[i+2:], true
+	}
+	i := strings.IndexByte(rest, ':')
+	if i <= 0 || strings.Contains(rest[:i], "/") {
+		return "", "", false
+	}
+	return user + rest[:i], rest[i+1:], true
+}
+
+// entryPath returns where the directory entry name is copied to in the
+// directory dst. The names come from the server when downloading, and one
+// like "../../.bashrc" must not write outside dst.
+func entryPath(fs fileSystem, dst, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: bad file name %q", dst, name)
+	}
+	p := fs.Join(dst, name)
+	if fs.Base(p) != name || fs.Join(p, "..") != fs.Join(dst) {
+		return "", fmt.Errorf("%s: %q is not in the directory", dst, name)
+	}
+	return p, nil
+}
+
+// copyFile copies the file src to dst, and directories only if recursive.
+func copyFile(from fileSystem, src string, to fileSystem, dst string, recursive bool) error {
+	fi, err := from.Stat(src)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if !recursive {
+			return fmt.Errorf("%s: is a directory, copy it with -r", src)
+		}
+		if dfi, err := to.Stat(dst); err != nil || !dfi.IsDir() {
+			if err := to.Mkdir(dst, fi.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		entries, err := from.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			target, err := entryPath(to, dst, e.Name())
+			if err != nil {
+				return err
+			}
+			if err := copyFile(from, from.Join(src, e.Name()), to, target, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	v("copy %s to %s", src, dst)
+	r, err := from.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := to.Create(dst, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// copyFiles copies the sources in args to the destination, the last
+// argument, where either all sources or the destination are remote.
+func (c *cmd) copyFiles(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%w: -scp needs sources and a destination", errInvalidArgs)
+	}
+	srcs, dst := args[:len(args)-1], args[len(args)-1]
+
+	dest, dstPath, upload := splitRemote(dst)
+	var srcPaths []string
+	for _, s := range srcs {
+		d, p, remote := splitRemote(s)
+		switch {
+		case remote == upload:
+			return fmt.Errorf("%w: copy either from or to one remote host", errInvalidArgs)
+		case remote && dest != "" && d != dest:
+			return fmt.Errorf("%w: copy from one remote host at a time", errInvalidArgs)
+		case remote:
+			dest = d
+		default:
+			p = s
+		}
+		srcPaths = append(srcPaths, p)
+	}
+	if !upload {
+		dstPath = dst
+	}
+
+	client, err := c.connect(dest)
+	if err != nil {
+		return err
+	}
+	sc, err := sftpClient(client)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	var from, to fileSystem = remoteFS{sc}, localFS{}
+	if upload {
+		from, to = to, from
+	}
+	for i, p := range srcPaths {
+		if p == "" {
+			srcPaths[i] = "."
+		}
+	}
+	if dstPath == "" {
+		dstPath = "."
+	}
+	fi, err := to.Stat(dstPath)
+	toDir := err == nil && fi.IsDir()
+	if len(srcPaths) > 1 && !toDir {
+		return fmt.Errorf("%s: not a directory", dst)
+	}
+	for _, src := range srcPaths {
+		target := dstPath
+		if toDir {
+			target = to.Join(dstPath, from.Base(src))
+		}
+		if err := copyFile(from, src, to, target, c.recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sftpClient starts the sftp subsystem in a new session of client.
+func sftpClient(client *ssh.Client) (*sftp.Client, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create session: %w", err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, err
+	}
+	return sftp.NewClient(r, w)
+}
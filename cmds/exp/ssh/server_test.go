@@ -0,0 +1,204 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testServer is an SSH server for the tests. It runs commands with sh,
+// except for "agent-keys", which lists the keys of the forwarded agent.
+// It serves sftp in a directory, and forwards ports.
+type testServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+	// dials counts the connections forwarded from the server, like
+	// those to the next host of a jump.
+	dials atomic.Int32
+}
+
+type tcpipPayload struct {
+	Addr     string
+	Port     uint32
+	OrigAddr string
+	OrigPort uint32
+}
+
+func newTestServer(t *testing.T, authorized ssh.PublicKey, dir string) *testServer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(k.Marshal()) != string(authorized.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &testServer{addr: l.Addr().String(), hostKey: hostKey.PublicKey()}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c, config, dir)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(c net.Conn, config *ssh.ServerConfig, dir string) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go s.globalRequests(conn, reqs)
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "session":
+			ch, reqs, err := nc.Accept()
+			if err != nil {
+				return
+			}
+			go s.session(conn, ch, reqs, dir)
+		case "direct-tcpip":
+			p := &tcpipPayload{}
+			ssh.Unmarshal(nc.ExtraData(), p)
+			d, err := net.Dial("tcp", net.JoinHostPort(p.Addr, strconv.Itoa(int(p.Port))))
+			if err != nil {
+				nc.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			s.dials.Add(1)
+			ch, reqs, err := nc.Accept()
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			go pipe(ch, d)
+		default:
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func (s *testServer) globalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		if req.Type != "tcpip-forward" {
+			req.Reply(false, nil)
+			continue
+		}
+		p := &struct {
+			Addr string
+			Port uint32
+		}{}
+		ssh.Unmarshal(req.Payload, p)
+		l, err := net.Listen("tcp", net.JoinHostPort(p.Addr, strconv.Itoa(int(p.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		port := uint32(l.Addr().(*net.TCPAddr).Port)
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+		go func() {
+			defer l.Close()
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				ch, reqs, err := conn.OpenChannel("forwarded-tcpip", ssh.Marshal(tcpipPayload{Addr: p.Addr, Port: port, OrigAddr: "127.0.0.1", OrigPort: 1}))
+				if err != nil {
+					c.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				go pipe(ch, c)
+			}
+		}()
+	}
+}
+
+func (s *testServer) session(conn *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request, dir string) {
+	defer ch.Close()
+	agentForwarded := false
+	for req := range reqs {
+		switch req.Type {
+		case "auth-agent-req@openssh.com":
+			agentForwarded = true
+			req.Reply(true, nil)
+		case "subsystem":
+			req.Reply(true, nil)
+			(&sftp.Server{Dir: dir}).Serve(ch)
+			return
+		case "exec":
+			req.Reply(true, nil)
+			var cmd struct{ Command string }
+			ssh.Unmarshal(req.Payload, &cmd)
+			status := 0
+			if cmd.Command == "agent-keys" {
+				status = 1
+				if agentForwarded {
+					status = agentKeys(conn, ch)
+				}
+			} else {
+				e := exec.Command("sh", "-c", cmd.Command)
+				e.Dir, e.Stdout, e.Stderr = dir, ch, ch.Stderr()
+				if err := e.Run(); err != nil {
+					status = 1
+				}
+			}
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// agentKeys prints the comments of the keys of the client's agent.
+func agentKeys(conn *ssh.ServerConn, ch ssh.Channel) int {
+	ach, reqs, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return 1
+	}
+	defer ach.Close()
+	go ssh.DiscardRequests(reqs)
+	keys, err := agent.NewClient(ach).List()
+	if err != nil {
+		return 1
+	}
+	for _, k := range keys {
+		fmt.Fprintln(ch, k.Comment)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 protocol constants, from RFC 1928.
+const (
+	socksVersion = 5
+
+	socksNoAuth       = 0
+	socksNoAcceptable = 0xff
+
+	socksConnect = 1
+
+	socksIPv4   = 1
+	socksDomain = 3
+	socksIPv6   = 4
+
+	socksSucceeded           = 0
+	socksFailure             = 1
+	socksCommandNotSupported = 7
+	socksAddressNotSupported = 8
+)
+
+var errSOCKS = errors.New("bad SOCKS5 request")
+
+// socks5 serves the SOCKS5 handshake of a client on c, without
+// authentication and for CONNECT only, and returns the connection that
+// dial makes to the address the client asked for.
+func socks5(c io.ReadWriter, dial func(addr string) (net.Conn, error)) (net.Conn, error) {
+	// Version, and the authentication methods.
+	b := make([]byte, 2, 256+6)
+	if _, err := io.ReadFull(c, b); err != nil {
+		return nil, err
+	}
+	if b[0] != socksVersion {
+		return nil, fmt.Errorf("%w: version %d", errSOCKS, b[0])
+	}
+	methods := make([]byte, b[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return nil, err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := c.Write([]byte{socksVersion, method}); err != nil {
+		return nil, err
+	}
+	if method == socksNoAcceptable {
+		return nil, fmt.Errorf("%w: no supported authentication method", errSOCKS)
+	}
+
+	// Version, command, reserved and address type.
+	b = b[:4]
+	if _, err := io.ReadFull(c, b); err != nil {
+		return nil, err
+	}
+	reply := func(code byte) error {
+		_, err := c.Write([]byte{socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	if b[0] != socksVersion {
+		return nil, fmt.Errorf("%w: version %d", errSOCKS, b[0])
+	}
+	if b[1] != socksConnect {
+		reply(socksCommandNotSupported)
+		return nil, fmt.Errorf("%w: command %d", errSOCKS, b[1])
+	}
+	var host string
+	switch b[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if b[3] == socksIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case socksDomain:
+		b = b[:1]
+		if _, err := io.ReadFull(c, b); err != nil {
+			return nil, err
+		}
+		b = b[:b[0]]
+		if _, err := io.ReadFull(c, b); err != nil {
+			return nil, err
+		}
+		host = string(b)
+	default:
+		reply(socksAddressNotSupported)
+		return nil, fmt.Errorf("%w: address type %d", errSOCKS, b[3])
+	}
+	b = b[:2]
+	if _, err := io.ReadFull(c, b); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(b[0])<<8|int(b[1])))
+
+	conn, err := dial(addr)
+	if err != nil {
+		reply(socksFailure)
+		return nil, err
+	}
+	if err := reply(socksSucceeded); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
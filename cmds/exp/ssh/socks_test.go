@@ -0,0 +1,131 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// dialSOCKS5 asks the SOCKS5 server at the other end of c to connect to
+// addr.
+func dialSOCKS5(t *testing.T, c io.ReadWriter, addr string) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := []byte{socksVersion, 1, socksNoAuth, socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		req = append(append(req, socksIPv4), ip...)
+	} else {
+		req = append(append(req, socksDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(p))
+	if _, err := c.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 12)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply[:4], []byte{socksVersion, socksNoAuth, socksVersion, socksSucceeded}) {
+		t.Fatalf("SOCKS5 reply %x, want success", reply)
+	}
+}
+
+// fakeConn reads a request and records the reply.
+type fakeConn struct {
+	r io.Reader
+	w bytes.Buffer
+}
+
+func (c *fakeConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c *fakeConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+
+func TestSOCKS5(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		req   []byte
+		addr  string
+		reply []byte
+		err   error
+	}{
+		{
+			name:  "ipv4",
+			req:   []byte{5, 1, 0, 5, 1, 0, 1, 10, 0, 0, 1, 0, 80},
+			addr:  "10.0.0.1:80",
+			reply: []byte{5, 0, 5, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:  "domain",
+			req:   append([]byte{5, 2, 2, 0, 5, 1, 0, 3, 4}, "host\x01\xbb"...),
+			addr:  "host:443",
+			reply: []byte{5, 0, 5, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:  "ipv6",
+			req:   append([]byte{5, 1, 0, 5, 1, 0, 4}, append(net.ParseIP("fe80::1"), 0, 22)...),
+			addr:  "[fe80::1]:22",
+			reply: []byte{5, 0, 5, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:  "connection refused",
+			req:   []byte{5, 1, 0, 5, 1, 0, 1, 10, 0, 0, 2, 0, 80},
+			addr:  "10.0.0.2:80",
+			reply: []byte{5, 0, 5, 1, 0, 1, 0, 0, 0, 0, 0, 0},
+			err:   errRefused,
+		},
+		{
+			name:  "only password authentication",
+			req:   []byte{5, 1, 2},
+			reply: []byte{5, 0xff},
+			err:   errSOCKS,
+		},
+		{
+			name:  "bind",
+			req:   []byte{5, 1, 0, 5, 2, 0, 1, 10, 0, 0, 1, 0, 80},
+			reply: []byte{5, 0, 5, 7, 0, 1, 0, 0, 0, 0, 0, 0},
+			err:   errSOCKS,
+		},
+		{
+			name: "socks4",
+			req:  []byte{4, 1},
+			err:  errSOCKS,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := &fakeConn{r: bytes.NewReader(tt.req)}
+			var addr string
+			_, err := socks5(rw, func(a string) (net.Conn, error) {
+				addr = a
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return nil, nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("socks5 = %v, want %v", err, tt.err)
+			}
+			if addr != tt.addr {
+				t.Errorf("dialed %q, want %q", addr, tt.addr)
+			}
+			if !bytes.Equal(rw.w.Bytes(), tt.reply) {
+				t.Errorf("replied %x, want %x", rw.w.Bytes(), tt.reply)
+			}
+		})
+	}
+}
+
+var errRefused = errors.New("connection refused")
@@ -5,17 +5,25 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"io"
 	"log"
+	"net"
 	"os"
 	guser "os/user"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	sshconfig "github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 type destTest struct {
@@ -120,3 +128,253 @@ func genPrivKey(t *testing.T) string {
 	}
 	return kf
 }
+
+// testHosts starts a jump host and a target host serving dir, and writes
+// a config file for them that it returns.
+func testHosts(t *testing.T, dir string) (string, *testServer, *testServer) {
+	t.Helper()
+	kf := genPrivKey(t)
+	b, err := os.ReadFile(kf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jump := newTestServer(t, signer.PublicKey(), dir)
+	target := newTestServer(t, signer.PublicKey(), dir)
+
+	tmp := t.TempDir()
+	kh := filepath.Join(tmp, "known_hosts")
+	var hosts []byte
+	for _, s := range []*testServer{jump, target} {
+		hosts = append(hosts, knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, s.hostKey)+"\n"...)
+	}
+	if err := os.WriteFile(kh, hosts, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host := func(s *testServer) string {
+		h, p, _ := net.SplitHostPort(s.addr)
+		return "\tHostName " + h + "\n\tPort " + p + "\n"
+	}
+	config := filepath.Join(tmp, "config")
+	conf := "Host target\n" + host(target) + "\tProxyJump jump\n" +
+		"Host direct\n" + host(target) +
+		"Host jump\n" + host(jump) +
+		"Host *\n\tIdentityFile " + kf + "\n\tUserKnownHostsFile " + kh + "\n"
+	if err := os.WriteFile(config, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return config, jump, target
+}
+
+func runSSH(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	var stdout bytes.Buffer
+	err = run(append([]string{"ssh"}, args...), stdin, &stdout, io.Discard)
+	return stdout.String(), err
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	config, jump, target := testHosts(t, dir)
+	_, port, _ := net.SplitHostPort(target.addr)
+
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		out   string
+		jumps int32
+	}{
+		{name: "command", args: []string{"direct", "echo", "hi"}, out: "hi\n"},
+		{name: "ProxyJump", args: []string{"target", "echo", "hi"}, out: "hi\n", jumps: 1},
+		{name: "jump flag", args: []string{"-J", "jump", "direct", "echo", "hi"}, out: "hi\n", jumps: 1},
+		{name: "no jump", args: []string{"-J", "none", "target", "echo", "hi"}, out: "hi\n"},
+		{name: "options", args: []string{"-o", "Port=" + port, "-o", "ProxyJump jump", "127.0.0.1", "echo", "hi"}, out: "hi\n", jumps: 1},
+		{name: "agent", args: []string{"-A", "direct", "agent-keys"}, out: "/kf\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			before := jump.dials.Load()
+			out, err := runSSH(t, append([]string{"-F", config}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("run = %v", err)
+			}
+			if !strings.HasSuffix(out, tt.out) {
+				t.Errorf("output %q, want %q", out, tt.out)
+			}
+			if jumps := jump.dials.Load() - before; jumps != tt.jumps {
+				t.Errorf("connected through the jump host %d times, want %d", jumps, tt.jumps)
+			}
+		})
+	}
+
+	if _, err := runSSH(t, "-F", config, "direct", "exit 3"); err == nil {
+		t.Errorf("run of failing command succeeded")
+	}
+	if _, err := runSSH(t, "-F", config, "direct", "agent-keys"); err == nil {
+		t.Errorf("run listed agent keys without -A")
+	}
+	if _, err := runSSH(t, "-F", config, "-o", "UserKnownHostsFile=/dev/null", "direct", "true"); err == nil {
+		t.Errorf("run with unknown host key succeeded")
+	}
+	if _, err := runSSH(t, "-F", config, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", "direct", "true"); err != nil {
+		t.Errorf("run with StrictHostKeyChecking=no = %v", err)
+	}
+}
+
+func TestSCP(t *testing.T) {
+	remote := t.TempDir()
+	config, _, _ := testHosts(t, remote)
+	local := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(local, "d", "e"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"f", "d/g", "d/e/h"} {
+		if err := os.WriteFile(filepath.Join(local, f), []byte(f), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		files map[string]string
+	}{
+		{
+			name:  "upload",
+			args:  []string{filepath.Join(local, "f"), "target:f2"},
+			files: map[string]string{"f2": "f"},
+		},
+		{
+			name:  "upload to directory",
+			args:  []string{filepath.Join(local, "f"), filepath.Join(local, "d", "g"), "target:"},
+			files: map[string]string{"f": "f", "g": "d/g"},
+		},
+		{
+			name:  "upload recursive",
+			args:  []string{"-r", filepath.Join(local, "d"), "target:" + remote + "/d2"},
+			files: map[string]string{"d2/g": "d/g", "d2/e/h": "d/e/h"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := runSSH(t, append([]string{"-F", config, "-scp"}, tt.args...)...); err != nil {
+				t.Fatalf("run = %v", err)
+			}
+			for f, want := range tt.files {
+				if b, err := os.ReadFile(filepath.Join(remote, f)); err != nil || string(b) != want {
+					t.Errorf("%s = %q, %v, want %q", f, b, err, want)
+				}
+			}
+		})
+	}
+	if fi, err := os.Stat(filepath.Join(remote, "f2")); err != nil || fi.Mode() != 0o640 {
+		t.Errorf("uploaded file has mode %v, %v, want 0640", fi.Mode(), err)
+	}
+
+	download := t.TempDir()
+	if _, err := runSSH(t, "-F", config, "-scp", "-r", "target:d2", "target:f2", download); err != nil {
+		t.Fatalf("download = %v", err)
+	}
+	for f, want := range map[string]string{"f2": "f", "d2/g": "d/g", "d2/e/h": "d/e/h"} {
+		if b, err := os.ReadFile(filepath.Join(download, f)); err != nil || string(b) != want {
+			t.Errorf("downloaded %s = %q, %v, want %q", f, b, err, want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"target:f2"},
+		{filepath.Join(local, "f"), download},
+		{"target:f2", "jump:f2", download},
+		{filepath.Join(local, "d"), "target:"},
+		{filepath.Join(local, "f"), filepath.Join(local, "d", "g"), "target:f2"},
+	} {
+		if _, err := runSSH(t, append([]string{"-F", config, "-scp"}, args...)...); err == nil {
+			t.Errorf("run(-scp %v) succeeded", args)
+		}
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	for _, fs := range []fileSystem{localFS{}, remoteFS{}} {
+		if p, err := entryPath(fs, "d", "f"); err != nil || p != fs.Join("d", "f") {
+			t.Errorf("entryPath(d, f) = %q, %v, want d/f", p, err)
+		}
+		// Names a malicious server may send.
+		for _, name := range []string{"", ".", "..", "../../.bashrc", "a/../../x", "/etc/passwd"} {
+			if p, err := entryPath(fs, "d", name); err == nil {
+				t.Errorf("entryPath(d, %q) = %q, want an error", name, p)
+			}
+		}
+	}
+}
+
+func TestSplitRemote(t *testing.T) {
+	for _, tt := range []struct {
+		arg  string
+		dest string
+		path string
+		ok   bool
+	}{
+		{arg: "host:path", dest: "host", path: "path", ok: true},
+		{arg: "user@host:/abs/path", dest: "user@host", path: "/abs/path", ok: true},
+		{arg: "host:", dest: "host", ok: true},
+		{arg: "[::1]:path", dest: "::1", path: "path", ok: true},
+		{arg: "user@[::1]:path", dest: "user@::1", path: "path", ok: true},
+		{arg: "file"},
+		{arg: "./a:b"},
+		{arg: "/a/b:c"},
+		{arg: ":path"},
+		{arg: "[::1]"},
+	} {
+		dest, p, ok := splitRemote(tt.arg)
+		if dest != tt.dest || p != tt.path || ok != tt.ok {
+			t.Errorf("splitRemote(%q) = %q, %q, %v, want %q, %q, %v", tt.arg, dest, p, ok, tt.dest, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	defer func(c *sshconfig.Config) { cfg = c }(cfg)
+	cfg = &sshconfig.Config{}
+	e, err := newEndpoint("host", map[string][]string{
+		"port":         {"2222", "3333"},
+		"localforward": {"8080 localhost:80", "8443 localhost:443"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.addr != "host:2222" {
+		t.Errorf("addr = %q, want the first -o Port, host:2222", e.addr)
+	}
+	if got, want := e.options("LocalForward"), []string{"8080 localhost:80", "8443 localhost:443"}; !slices.Equal(got, want) {
+		t.Errorf("options(LocalForward) = %q, want %q", got, want)
+	}
+}
+
+func TestParseOption(t *testing.T) {
+	for _, tt := range []struct {
+		opt string
+		key string
+		val string
+		err error
+	}{
+		{opt: "Port=2222", key: "port", val: "2222"},
+		{opt: "ProxyJump jump", key: "proxyjump", val: "jump"},
+		{opt: " User = me ", key: "user", val: "me"},
+		{opt: "Port", err: errBadOption},
+		{opt: "=2222", err: errBadOption},
+	} {
+		k, val, err := parseOption(tt.opt)
+		if k != tt.key || val != tt.val || !errors.Is(err, tt.err) {
+			t.Errorf("parseOption(%q) = %q, %q, %v, want %q, %q, %v", tt.opt, k, val, err, tt.key, tt.val, tt.err)
+		}
+	}
+}
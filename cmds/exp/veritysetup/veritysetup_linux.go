@@ -0,0 +1,239 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// veritysetup creates, verifies and activates dm-verity devices.
+//
+// Synopsis:
+//
+//	veritysetup format [OPTIONS] DATA HASH
+//	    Compute the hash tree of DATA, write it to HASH and print the root hash.
+//	veritysetup verify [OPTIONS] DATA HASH ROOTHASH
+//	    Verify DATA against the hash tree in HASH, without the kernel target.
+//	veritysetup open [OPTIONS] DATA NAME HASH ROOTHASH
+//	veritysetup open -cmdline [OPTIONS] NAME
+//	    Create /dev/mapper/NAME. With -cmdline, the devices and root hash
+//	    come from roothash= and systemd.verity_root_* on the kernel command line.
+//	veritysetup close NAME
+//	    Remove /dev/mapper/NAME.
+//
+// Options:
+//
+//	-hash-offset: byte offset of the superblock on HASH
+//	-salt: hex salt (format)
+//	-hash: hash algorithm (format, default sha256)
+//	-data-block-size, -hash-block-size: block sizes (format, default 4096)
+//	-keyring, -sig: check a detached OpenPGP signature of the root hash (open)
+//	-mount DIR, -fstype TYPE: mount the device read-only after opening it (open)
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/dm"
+	"github.com/u-root/u-root/pkg/mount/verity"
+	"github.com/u-root/u-root/pkg/vfile"
+)
+
+var errUsage = errors.New(`usage:
+	veritysetup format [-salt HEX] [-hash ALG] [-data-block-size N] [-hash-block-size N] [-hash-offset N] DATA HASH
+	veritysetup verify [-hash-offset N] DATA HASH ROOTHASH
+	veritysetup open [-hash-offset N] [-keyring FILE -sig FILE] [-mount DIR [-fstype TYPE]] DATA NAME HASH ROOTHASH
+	veritysetup open -cmdline [-keyring FILE -sig FILE] [-mount DIR [-fstype TYPE]] NAME
+	veritysetup close NAME`)
+
+func run(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet("veritysetup "+cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hashOffset := fs.Uint64("hash-offset", 0, "Byte offset of the superblock on the hash device")
+
+	switch cmd {
+	case "format":
+		var (
+			salt     = fs.String("salt", "", "Salt, in hex")
+			alg      = fs.String("hash", "sha256", "Hash algorithm")
+			dataBS   = fs.Uint("data-block-size", 4096, "Data block size")
+			hashBS   = fs.Uint("hash-block-size", 4096, "Hash block size")
+			hashType = fs.Uint("format", verity.HashTypeNormal, "Hash type: 1 normal, 0 Chrome OS")
+		)
+		if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+			return errUsage
+		}
+		s, err := hex.DecodeString(*salt)
+		if err != nil {
+			return fmt.Errorf("bad salt: %w", err)
+		}
+		return format(out, fs.Arg(0), fs.Arg(1), &verity.Params{
+			HashType:      uint32(*hashType),
+			Algorithm:     *alg,
+			DataBlockSize: uint32(*dataBS),
+			HashBlockSize: uint32(*hashBS),
+			Salt:          s,
+			HashOffset:    *hashOffset,
+		})
+
+	case "verify":
+		if err := fs.Parse(args); err != nil || fs.NArg() != 3 {
+			return errUsage
+		}
+		root, err := hex.DecodeString(fs.Arg(2))
+		if err != nil {
+			return fmt.Errorf("bad root hash: %w", err)
+		}
+		if err := verify(fs.Arg(0), fs.Arg(1), *hashOffset, root); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Verification succeeded.")
+		return nil
+
+	case "open":
+		var (
+			fromCmdline = fs.Bool("cmdline", false, "Take devices and root hash from the kernel command line")
+			keyring     = fs.String("keyring", "", "OpenPGP public keyring to check the root hash signature with")
+			sig         = fs.String("sig", "", "Detached OpenPGP signature of the root hash")
+			mountDir    = fs.String("mount", "", "Mount the verified device read-only on this directory")
+			fsType      = fs.String("fstype", "", "File system type for -mount")
+		)
+		if err := fs.Parse(args); err != nil {
+			return errUsage
+		}
+		var (
+			cfg  *verity.Config
+			name string
+		)
+		switch {
+		case *fromCmdline && fs.NArg() == 1:
+			c, err := verity.FromCmdline()
+			if err != nil {
+				return err
+			}
+			cfg, name = c, fs.Arg(0)
+		case !*fromCmdline && fs.NArg() == 4:
+			root, err := hex.DecodeString(fs.Arg(3))
+			if err != nil {
+				return fmt.Errorf("bad root hash: %w", err)
+			}
+			cfg = &verity.Config{DataDevice: fs.Arg(0), HashDevice: fs.Arg(2), RootHash: root, HashOffset: *hashOffset}
+			name = fs.Arg(1)
+		default:
+			return errUsage
+		}
+		if *keyring != "" || *sig != "" {
+			if err := checkSignature(*keyring, *sig, cfg.RootHash); err != nil {
+				return err
+			}
+		}
+		d, err := cfg.Open(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", d.DevName())
+		if *mountDir == "" {
+			return nil
+		}
+		d.FSType = *fsType
+		if _, err := d.Mount(*mountDir, mount.MS_RDONLY); err != nil {
+			d.Remove()
+			return err
+		}
+		return nil
+
+	case "close":
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		return dm.Remove(fs.Arg(0))
+	}
+	return errUsage
+}
+
+func format(out io.Writer, dataPath, hashPath string, p *verity.Params) error {
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	fi, err := data.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if fi.Mode()&os.ModeDevice != 0 {
+		// Block devices report a zero size; seek to find it.
+		if size, err = data.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	if p.DataBlockSize == 0 || size%int64(p.DataBlockSize) != 0 {
+		return fmt.Errorf("%s: size %d is not a multiple of the data block size %d", dataPath, size, p.DataBlockSize)
+	}
+	p.DataBlocks = uint64(size) / uint64(p.DataBlockSize)
+
+	hash, err := os.OpenFile(hashPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer hash.Close()
+	root, err := verity.Format(data, hash, p)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Data blocks:     %d\n", p.DataBlocks)
+	fmt.Fprintf(out, "Data block size: %d\n", p.DataBlockSize)
+	fmt.Fprintf(out, "Hash block size: %d\n", p.HashBlockSize)
+	fmt.Fprintf(out, "Hash algorithm:  %s\n", p.Algorithm)
+	fmt.Fprintf(out, "Salt:            %x\n", p.Salt)
+	fmt.Fprintf(out, "Root hash:       %x\n", root)
+	return hash.Close()
+}
+
+func verify(dataPath, hashPath string, hashOffset uint64, root []byte) error {
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	hash, err := os.Open(hashPath)
+	if err != nil {
+		return err
+	}
+	defer hash.Close()
+	p, err := verity.ReadSuperblock(hash, int64(hashOffset))
+	if err != nil {
+		return err
+	}
+	return verity.Verify(data, hash, p, root)
+}
+
+func checkSignature(keyringPath, sigPath string, root []byte) error {
+	if keyringPath == "" || sigPath == "" {
+		return fmt.Errorf("-keyring and -sig must be used together")
+	}
+	ring, err := vfile.GetKeyRing(keyringPath)
+	if err != nil {
+		return err
+	}
+	sig, err := os.Open(sigPath)
+	if err != nil {
+		return err
+	}
+	defer sig.Close()
+	return verity.VerifyRootHash(ring, root, sig)
+}
+
+func main() {
+	if err := run(os.Stdout, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/mount/verity"
+)
+
+func TestFormatVerify(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	hash := filepath.Join(dir, "hash")
+	if err := os.WriteFile(data, bytes.Repeat([]byte("u-root"), 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run(&out, []string{"format", "-salt", "abcd", "-data-block-size", "512", "-hash-block-size", "512", data, hash}); err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`Root hash:\s+([0-9a-f]+)`).FindStringSubmatch(out.String())
+	if m == nil {
+		t.Fatalf("no root hash in output %q", out.String())
+	}
+	root := m[1]
+
+	out.Reset()
+	if err := run(&out, []string{"verify", data, hash, root}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	f, err := os.OpenFile(data, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("X"), 1000)
+	f.Close()
+	if err := run(&out, []string{"verify", data, hash, root}); !errors.Is(err, verity.ErrDataBlockCorrupt) {
+		t.Errorf("verify(corrupt) = %v, want %v", err, verity.ErrDataBlockCorrupt)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"bogus"},
+		{"format", "onlyone"},
+		{"verify", "a", "b"},
+		{"open", "a"},
+		{"open", "-cmdline", "a", "b"},
+		{"close"},
+	} {
+		if err := run(&bytes.Buffer{}, args); !errors.Is(err, errUsage) {
+			t.Errorf("run(%q) = %v, want usage error", args, err)
+		}
+	}
+}
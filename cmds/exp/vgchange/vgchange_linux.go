@@ -0,0 +1,163 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vgchange activates or deactivates LVM2 logical volumes.
+//
+// Synopsis:
+//
+//	vgchange -ay|-an [-t] [-v] [VG|VG/LV...]
+//
+// Description:
+//
+//	Scans all block devices for LVM2 physical volumes and activates the
+//	linear and striped logical volumes of the named volume groups, or of
+//	all volume groups if none are named. Activated volumes appear as
+//	/dev/mapper/VG-LV and /dev/VG/LV.
+//
+// Options:
+//
+//	-a: y to activate, n to deactivate, also as -ay, -an and --activate
+//	-t: test mode, print the device-mapper tables instead of loading them
+//	-v: verbose
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/mount/dm"
+	"github.com/u-root/u-root/pkg/mount/lvm"
+)
+
+var (
+	activate = flag.String("a", "", "Activate (y) or deactivate (n) logical volumes")
+	test     = flag.Bool("t", false, "Test mode: print the device-mapper tables instead of loading them")
+	verbose  = flag.Bool("v", false, "Verbose output")
+)
+
+var errUsage = errors.New("usage: vgchange -ay|-an [-t] [-v] [VG|VG/LV...]")
+
+// parseArgs parses the command line args. The flag package reads -ay as a
+// flag called ay, so -ay, -an and --activate are first turned into -a.
+func parseArgs(args []string) error {
+	var fixed []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			fixed = append(fixed, args[i:]...)
+			break
+		}
+		switch {
+		case a == "-ay" || a == "-an" || a == "--ay" || a == "--an":
+			fixed = append(fixed, "-a", a[len(a)-1:])
+		case a == "--activate" || strings.HasPrefix(a, "--activate="):
+			fixed = append(fixed, "-a"+strings.TrimPrefix(a, "--activate"))
+		default:
+			fixed = append(fixed, a)
+		}
+		// The value of -a, which is not a flag.
+		if (a == "-a" || a == "--a" || a == "--activate") && i+1 < len(args) {
+			i++
+			fixed = append(fixed, args[i])
+		}
+	}
+	return flag.CommandLine.Parse(fixed)
+}
+
+func run(out io.Writer, scan func() ([]*lvm.VolumeGroup, error), activate string, test bool, args []string) error {
+	var up bool
+	switch activate {
+	case "y", "ay":
+		up = true
+	case "n", "an":
+	default:
+		return errUsage
+	}
+
+	vgs, err := scan()
+	if err != nil {
+		return err
+	}
+
+	// Map VG name to the LV names requested; nil means all.
+	want := map[string][]string{}
+	for _, a := range args {
+		vg, lv, ok := strings.Cut(a, "/")
+		if ok {
+			want[vg] = append(want[vg], lv)
+		} else if _, ok := want[vg]; !ok {
+			want[vg] = nil
+		}
+	}
+
+	var errs []error
+	found := map[string]bool{}
+	for _, vg := range vgs {
+		lvs, ok := want[vg.Name]
+		if len(want) > 0 && !ok {
+			continue
+		}
+		found[vg.Name] = true
+		if vg.Partial() {
+			fmt.Fprintf(out, "  WARNING: volume group %q is missing physical volumes\n", vg.Name)
+		}
+
+		if test {
+			sel, err := vg.Select(lvs...)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, lv := range sel {
+				t, err := vg.Table(lv)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				fmt.Fprintf(out, "%s:\n%s\n", vg.DMName(lv), t)
+			}
+			continue
+		}
+
+		if !up {
+			if err := vg.Deactivate(lvs...); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Fprintf(out, "  logical volumes in volume group %q deactivated\n", vg.Name)
+			continue
+		}
+		devs, err := vg.Activate(lvs...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		fmt.Fprintf(out, "  %d logical volume(s) in volume group %q now active\n", len(devs), vg.Name)
+	}
+	for name := range want {
+		if !found[name] {
+			errs = append(errs, fmt.Errorf("volume group %q not found", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	// flag.CommandLine exits on errors.
+	parseArgs(os.Args[1:])
+	if *verbose {
+		lvm.Debug = log.Printf
+		dm.Debug = log.Printf
+	}
+	if err := run(os.Stdout, lvm.ScanAll, *activate, *test, flag.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+		}
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/mount/lvm"
+)
+
+const metadata = `vg0 {
+id = "abc"
+seqno = 1
+extent_size = 8192
+physical_volumes {
+pv0 {
+id = "def"
+pe_start = 2048
+pe_count = 100
+}
+}
+logical_volumes {
+root {
+id = "ghi"
+status = ["READ", "WRITE", "VISIBLE"]
+segment1 {
+start_extent = 0
+extent_count = 10
+type = "striped"
+stripe_count = 1
+stripes = ["pv0", 0]
+}
+}
+swap {
+id = "jkl"
+status = ["READ", "WRITE", "VISIBLE"]
+segment1 {
+start_extent = 0
+extent_count = 2
+type = "striped"
+stripe_count = 1
+stripes = ["pv0", 10]
+}
+}
+}
+}
+`
+
+func scan() ([]*lvm.VolumeGroup, error) {
+	vg, err := lvm.ParseVolumeGroup(metadata)
+	if err != nil {
+		return nil, err
+	}
+	vg.PV("pv0").Device = "/dev/sda2"
+	return []*lvm.VolumeGroup{vg}, nil
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		activate string
+		args     []string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "all",
+			activate: "y",
+			want:     "vg0-root:\n0 81920 linear /dev/sda2 2048\nvg0-swap:\n0 16384 linear /dev/sda2 83968\n",
+		},
+		{
+			name:     "one lv",
+			activate: "y",
+			args:     []string{"vg0/swap"},
+			want:     "vg0-swap:\n0 16384 linear /dev/sda2 83968\n",
+		},
+		{
+			name:     "missing vg",
+			activate: "y",
+			args:     []string{"nope"},
+			wantErr:  `volume group "nope" not found`,
+		},
+		{
+			name:     "missing lv",
+			activate: "y",
+			args:     []string{"vg0/swap", "vg0/nope"},
+			wantErr:  "vg0/nope: " + lvm.ErrNoLV.Error(),
+		},
+		{
+			name:     "bad flag",
+			activate: "x",
+			wantErr:  errUsage.Error(),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(&out, scan, tt.activate, true, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("run() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+
+	wantErr := errors.New("scan failed")
+	if err := run(&bytes.Buffer{}, func() ([]*lvm.VolumeGroup, error) { return nil, wantErr }, "y", false, nil); !errors.Is(err, wantErr) {
+		t.Errorf("run() = %v, want %v", err, wantErr)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		activate string
+		rest     []string
+	}{
+		{args: []string{"-ay", "vg0"}, activate: "y", rest: []string{"vg0"}},
+		{args: []string{"-t", "-an"}, activate: "n"},
+		{args: []string{"-a", "y", "vg0/root"}, activate: "y", rest: []string{"vg0/root"}},
+		{args: []string{"--activate", "n", "vg0"}, activate: "n", rest: []string{"vg0"}},
+		{args: []string{"--activate=y"}, activate: "y"},
+		{args: []string{"-ay", "--", "-an"}, activate: "y", rest: []string{"-an"}},
+	} {
+		*activate = ""
+		if err := parseArgs(tt.args); err != nil {
+			t.Errorf("parseArgs(%q) = %v", tt.args, err)
+			continue
+		}
+		if *activate != tt.activate || !slices.Equal(flag.Args(), tt.rest) {
+			t.Errorf("parseArgs(%q): -a %q, args %q, want -a %q, args %q", tt.args, *activate, flag.Args(), tt.activate, tt.rest)
+		}
+	}
+}
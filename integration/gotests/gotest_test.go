@@ -85,13 +85,13 @@ func testPkgs(t *testing.T) []string {
 			// beyond their huge timeout under arm64 in the VM. Not
 			// sure why. Slow emulation?
 			"github.com/u-root/u-root/cmds/core/pci",
-			"github.com/u-root/u-root/cmds/exp/cbmem",
+			"github.com/u-root/u-root/pkg/coreboot",
 			"github.com/u-root/u-root/pkg/vfile",
 		)
 
 	case qemu.ArchArm:
 		blocklist = append(blocklist,
-			"github.com/u-root/u-root/cmds/exp/cbmem",
+			"github.com/u-root/u-root/pkg/coreboot",
 
 			// These 4 tests do not compile on arm.
 			"github.com/u-root/u-root/pkg/boot/kexec",
@@ -4,9 +4,10 @@
 
 // Package bls parses systemd Boot Loader Spec config files.
 //
-// See spec at https://systemd.io/BOOT_LOADER_SPECIFICATION. Only Type #1 BLS
-// entries are supported at the moment, while Type #2 EFI entries are left
-// unimplemented awaiting EFI boot support in u-root/LinuxBoot.
+// See spec at https://systemd.io/BOOT_LOADER_SPECIFICATION. Type #1 BLS
+// entries and Type #2 Unified Kernel Images in EFI/Linux are supported. UKIs
+// are booted by extracting their kernel, initrd and command line rather than
+// by running their EFI stub.
 //
 // This package also supports the systemd-boot loader.conf as described in
 // https://www.freedesktop.org/software/systemd/man/loader.conf.html. Only the
@@ -30,6 +31,7 @@ import (
 const (
 	blsEntriesDir  = "loader/entries"
 	blsEntriesDir2 = "boot/loader/entries"
+	ukiDir         = "EFI/Linux"
 	// Set a higher default rank for BLS. It should be booted prior to the
 	// other local images.
 	blsDefaultRank = 1
@@ -47,9 +49,10 @@ func ScanBLSEntries(l ulog.Logger, fsRoot string, variables map[string]string, g
 		// Try blsEntriesDir2
 		entriesDir = filepath.Join(fsRoot, blsEntriesDir2)
 		files, err = filepath.Glob(filepath.Join(entriesDir, "*.conf"))
-		if err != nil || len(files) == 0 {
-			return nil, fmt.Errorf("no BootLoaderSpec entries found: %w", err)
-		}
+	}
+	ukis := findUKIs(fsRoot)
+	if len(files) == 0 && len(ukis) == 0 {
+		return nil, fmt.Errorf("no BootLoaderSpec entries found: %w", err)
 	}
 
 	// loader.conf is not in the real spec; it's an implementation detail
@@ -82,9 +85,62 @@ func ScanBLSEntries(l ulog.Logger, fsRoot string, variables map[string]string, g
 		imgs[identifier] = img
 	}
 
+	// Type #2 entries are identified by their file name, including the
+	// .efi suffix.
+	for _, f := range ukis {
+		identifier := filepath.Base(f)
+		img, err := parseUKI(f, identifier == grubDefaultSavedEntry)
+		if err != nil {
+			l.Printf("BootLoaderSpec skipping UKI %s: %v", f, err)
+			continue
+		}
+		imgs[identifier] = img
+	}
+
 	return sortImages(loaderConf, imgs), nil
 }
 
+// findUKIs returns the Type #2 entries in fsRoot.
+func findUKIs(fsRoot string) []string {
+	var files []string
+	for _, ext := range []string{"*.efi", "*.EFI"} {
+		f, _ := filepath.Glob(filepath.Join(fsRoot, ukiDir, ext))
+		files = append(files, f...)
+	}
+	return files
+}
+
+// parseUKI opens a Type #2 entry.
+func parseUKI(path string, grubDefaultFlag bool) (boot.OSImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	uki, err := boot.NewUKIImage(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	uki.Linux.BootRank = bootRank(grubDefaultFlag)
+	return uki, nil
+}
+
+// bootRank returns the rank of an entry, BLS_BOOT_RANK if set in the
+// environment.
+func bootRank(grubDefaultFlag bool) int {
+	if val, exist := os.LookupEnv("BLS_BOOT_RANK"); exist {
+		if rank, err := strconv.Atoi(val); err == nil {
+			return rank
+		}
+		return 0
+	}
+	// If this is the default option, increase the BootRank by 1.
+	if grubDefaultFlag {
+		return blsDefaultRank + 1
+	}
+	return blsDefaultRank
+}
+
 func sortImages(loaderConf map[string]string, imgs map[string]boot.OSImage) []boot.OSImage {
 	// rankedImages = sort(default-images) + sort(remaining images)
 	var rankedImages []boot.OSImage
@@ -248,19 +304,7 @@ func parseLinuxImage(vals map[string]string, fsRoot string, variables map[string
 	// If both title and version were empty, so will this.
 	linux.Name = strings.Join(name, " ")
 	linux.Cmdline = strings.Join(cmdlines, " ")
-	// If this is the default option, increase the BootRank by 1
-	// when os.LookupEnv("BLS_BOOT_RANK") doesn't exist so it's not affected.
-	if val, exist := os.LookupEnv("BLS_BOOT_RANK"); exist {
-		if rank, err := strconv.Atoi(val); err == nil {
-			linux.BootRank = rank
-		}
-	} else {
-		if grubDefaultFlag {
-			linux.BootRank = blsDefaultRank + 1
-		} else {
-			linux.BootRank = blsDefaultRank
-		}
-	}
+	linux.BootRank = bootRank(grubDefaultFlag)
 
 	return linux, nil
 }
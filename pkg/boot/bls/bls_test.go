@@ -7,10 +7,12 @@ package bls
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/boottest"
 	"github.com/u-root/u-root/pkg/ulog/ulogtest"
 )
@@ -132,3 +134,55 @@ func TestSetBLSRank(t *testing.T) {
 
 	os.Setenv("BLS_BOOT_RANK", originRank)
 }
+
+func TestScanUKIs(t *testing.T) {
+	if rank, ok := os.LookupEnv("BLS_BOOT_RANK"); ok {
+		os.Unsetenv("BLS_BOOT_RANK")
+		defer os.Setenv("BLS_BOOT_RANK", rank)
+	}
+	fsRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(fsRoot, ukiDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, osrel := range map[string]string{
+		"fedora.efi":  "PRETTY_NAME=\"Fedora Linux 40\"\n",
+		"arch.EFI":    "NAME=Arch\n",
+		"garbage.efi": "",
+	} {
+		data := []byte("not a PE file")
+		if osrel != "" {
+			data = boottest.MakePE(
+				boottest.PESection{Name: ".osrel", Data: []byte(osrel)},
+				boottest.PESection{Name: ".cmdline", Data: []byte("quiet")},
+				boottest.PESection{Name: ".linux", Data: []byte("kernel")},
+			)
+		}
+		if err := os.WriteFile(filepath.Join(fsRoot, ukiDir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imgs, err := ScanBLSEntries(ulogtest.Logger{t}, fsRoot, nil, "arch.EFI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, img := range imgs {
+		uki, ok := img.(*boot.UKIImage)
+		if !ok {
+			t.Fatalf("got %T, want *boot.UKIImage", img)
+		}
+		if uki.Linux.Cmdline != "quiet" {
+			t.Errorf("%s: cmdline %q, want quiet", uki.Label(), uki.Linux.Cmdline)
+		}
+		got[img.Label()] = img.Rank()
+	}
+	want := map[string]int{"Fedora Linux 40": blsDefaultRank, "Arch": blsDefaultRank + 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanBLSEntries() labels and ranks = %v, want %v", got, want)
+	}
+
+	if _, err := ScanBLSEntries(ulogtest.Logger{t}, t.TempDir(), nil, ""); err == nil {
+		t.Error("ScanBLSEntries() on an empty root: got nil, want error")
+	}
+}
@@ -20,6 +20,10 @@ type loadOptions struct {
 	logger        ulog.Logger
 	verbose       bool
 	callKexecLoad bool
+
+	policy    VerifyPolicy
+	verifiers []Verifier
+	measurer  Measurer
 }
 
 func defaultLoadOptions() *loadOptions {
@@ -123,13 +127,21 @@ func AppendLinux(cmdline string) LinuxModifier {
 // MultibootModifier modifies a multiboot image.
 type MultibootModifier func(img *MultibootImage)
 
-// ApplyLinuxModifiers applies opts to every LinuxImage in images.
+// ApplyLinuxModifiers applies opts to every LinuxImage in images, including
+// the ones inside UKIImages.
 func ApplyLinuxModifiers(images []OSImage, opts ...LinuxModifier) {
 	for _, img := range images {
-		if li, ok := img.(*LinuxImage); ok {
-			for _, opt := range opts {
-				opt(li)
-			}
+		var li *LinuxImage
+		switch i := img.(type) {
+		case *LinuxImage:
+			li = i
+		case *UKIImage:
+			li = i.Linux
+		default:
+			continue
+		}
+		for _, opt := range opts {
+			opt(li)
 		}
 	}
 }
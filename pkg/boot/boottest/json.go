@@ -118,6 +118,9 @@ func ImagesToJSONLike(imgs []boot.OSImage) []interface{} {
 		if m, ok := img.(*boot.MultibootImage); ok {
 			infs = append(infs, MultibootImageToJSON(m))
 		}
+		if u, ok := img.(*boot.UKIImage); ok {
+			infs = append(infs, UKIImageToJSON(u))
+		}
 	}
 	return infs
 }
@@ -141,6 +144,17 @@ func LinuxImageToJSON(li *boot.LinuxImage) map[string]interface{} {
 	return m
 }
 
+// UKIImageToJSON is implemented only in order to compare UKIImages in
+// tests.
+//
+// It should be json-encodable and decodable.
+func UKIImageToJSON(u *boot.UKIImage) map[string]interface{} {
+	m := LinuxImageToJSON(u.Linux)
+	m["image_type"] = "uki"
+	m["uname"] = u.Uname
+	return m
+}
+
 // MultibootImageToJSON is implemented only in order to compare MultibootImages
 // in tests.
 //
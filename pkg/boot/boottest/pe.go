@@ -0,0 +1,67 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boottest
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+)
+
+// PESection is a section of a PE image built by MakePE.
+type PESection struct {
+	Name string
+	Data []byte
+}
+
+// MakePE returns a minimal x86-64 PE image holding sections, e.g. to
+// synthesise Unified Kernel Images in tests. It has no optional header and
+// cannot be executed.
+func MakePE(sections ...PESection) []byte {
+	const (
+		peOffset  = 0x40
+		fileAlign = 0x200
+		memAlign  = 0x1000
+	)
+	align := func(v, a uint32) uint32 { return (v + a - 1) &^ (a - 1) }
+
+	hdrSize := uint32(peOffset + 4 + binary.Size(pe.FileHeader{}) + len(sections)*binary.Size(pe.SectionHeader32{}))
+	var hdrs []pe.SectionHeader32
+	off, va := align(hdrSize, fileAlign), uint32(memAlign)
+	for _, s := range sections {
+		var name [8]uint8
+		copy(name[:], s.Name)
+		size := uint32(len(s.Data))
+		hdrs = append(hdrs, pe.SectionHeader32{
+			Name:             name,
+			VirtualSize:      size,
+			VirtualAddress:   va,
+			SizeOfRawData:    align(size, fileAlign),
+			PointerToRawData: off,
+			Characteristics:  pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ,
+		})
+		off += align(size, fileAlign)
+		va += align(size, memAlign)
+	}
+
+	var b bytes.Buffer
+	dos := make([]byte, peOffset)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], peOffset)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	binary.Write(&b, binary.LittleEndian, pe.FileHeader{
+		Machine:          pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections: uint16(len(sections)),
+		Characteristics:  pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+	})
+	binary.Write(&b, binary.LittleEndian, hdrs)
+	for i, s := range sections {
+		b.Write(make([]byte, int(hdrs[i].PointerToRawData)-b.Len()))
+		b.Write(s.Data)
+	}
+	b.Write(make([]byte, int(off)-b.Len()))
+	return b.Bytes()
+}
@@ -26,7 +26,7 @@ func mustReadAll(r io.ReaderAt) string {
 // SameBootImage compares the contents of given boot images, but not the
 // underlying URLs.
 //
-// Works for Linux and Multiboot images.
+// Works for Linux, UKI and Multiboot images.
 func SameBootImage(got, want boot.OSImage) error {
 	if got.Label() != want.Label() {
 		return fmt.Errorf("got image label %s, want %s", got.Label(), want.Label())
@@ -55,6 +55,17 @@ func SameBootImage(got, want boot.OSImage) error {
 		return nil
 	}
 
+	if gotUKI, ok := got.(*boot.UKIImage); ok {
+		wantUKI, ok := want.(*boot.UKIImage)
+		if !ok {
+			return fmt.Errorf("got image %s is UKI image, but %s is not", got, want)
+		}
+		if gotUKI.Uname != wantUKI.Uname {
+			return fmt.Errorf("got uname %s, want %s", gotUKI.Uname, wantUKI.Uname)
+		}
+		return SameBootImage(gotUKI.Linux, wantUKI.Linux)
+	}
+
 	if gotMB, ok := got.(*boot.MultibootImage); ok {
 		wantMB, ok := want.(*boot.MultibootImage)
 		if !ok {
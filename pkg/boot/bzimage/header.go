@@ -142,6 +142,18 @@ type LinuxHeader struct {
 	HandoverOffset uint32 `offset:"0x264"`
 }
 
+// EFIInfo describes the EFI system table and memory map.
+type EFIInfo struct {
+	LoaderSignature [4]uint8 `offset:"0x1c0"`
+	Systab          uint32   `offset:"0x1c4"`
+	MemDescSize     uint32   `offset:"0x1c8"`
+	MemDescVersion  uint32   `offset:"0x1cc"`
+	Memmap          uint32   `offset:"0x1d0"`
+	MemmapSize      uint32   `offset:"0x1d4"`
+	SystabHi        uint32   `offset:"0x1d8"`
+	MemmapHi        uint32   `offset:"0x1dc"`
+}
+
 // LinuxParams is parameters passed to the 32-bit part of Linux
 type LinuxParams struct {
 	Origx           uint8  `offset:"0x00"`
@@ -158,57 +170,85 @@ type LinuxParams struct {
 	OrigVideoPoints uint16 `offset:"0x10"`
 
 	// VESA graphic mode -- linear frame buffer
-	Lfbwidth      uint16    `offset:"0x12"`
-	Lfbheight     uint16    `offset:"0x14"`
-	Lfbdepth      uint16    `offset:"0x16"`
-	Lfbbase       uint32    `offset:"0x18"`
-	Lfbsize       uint32    `offset:"0x1c"`
-	CLMagic       uint16    `offset:"0x20"` // DON'T USE
-	CLOffset      uint16    `offset:"0x22"` // DON'T USE
-	Lfblinelength uint16    `offset:"0x24"`
-	Redsize       uint8     `offset:"0x26"`
-	Redpos        uint8     `offset:"0x27"`
-	Greensize     uint8     `offset:"0x28"`
-	Greenpos      uint8     `offset:"0x29"`
-	Bluesize      uint8     `offset:"0x2a"`
-	Bluepos       uint8     `offset:"0x2b"`
-	Rsvdsize      uint8     `offset:"0x2c"`
-	Rsvdpos       uint8     `offset:"0x2d"`
-	Vesapmseg     uint16    `offset:"0x2e"`
-	Vesapmoff     uint16    `offset:"0x30"`
-	Pages         uint16    `offset:"0x32"`
-	_             [12]uint8 `offset:"0x34"` //-- 0x3f reserved for future expansion
+	Lfbwidth       uint16   `offset:"0x12"`
+	Lfbheight      uint16   `offset:"0x14"`
+	Lfbdepth       uint16   `offset:"0x16"`
+	Lfbbase        uint32   `offset:"0x18"`
+	Lfbsize        uint32   `offset:"0x1c"`
+	CLMagic        uint16   `offset:"0x20"` // DON'T USE
+	CLOffset       uint16   `offset:"0x22"` // DON'T USE
+	Lfblinelength  uint16   `offset:"0x24"`
+	Redsize        uint8    `offset:"0x26"`
+	Redpos         uint8    `offset:"0x27"`
+	Greensize      uint8    `offset:"0x28"`
+	Greenpos       uint8    `offset:"0x29"`
+	Bluesize       uint8    `offset:"0x2a"`
+	Bluepos        uint8    `offset:"0x2b"`
+	Rsvdsize       uint8    `offset:"0x2c"`
+	Rsvdpos        uint8    `offset:"0x2d"`
+	Vesapmseg      uint16   `offset:"0x2e"`
+	Vesapmoff      uint16   `offset:"0x30"`
+	Pages          uint16   `offset:"0x32"`
+	VesaAttributes uint16   `offset:"0x34"`
+	Capabilities   uint32   `offset:"0x36"`
+	ExtLfbbase     uint32   `offset:"0x3a"`
+	_              [2]uint8 `offset:"0x3e"`
 
 	// struct apmbiosinfo apmbiosinfo;
-	Apmbiosinfo [0x40]uint8 `offset:"0x40"`
+	Apmbiosinfo  [0x14]uint8 `offset:"0x40"`
+	_            [4]uint8    `offset:"0x54"`
+	TbootAddr    uint64      `offset:"0x58"`
+	ISTInfo      [0x10]uint8 `offset:"0x60"`
+	ACPIRSDPAddr uint64      `offset:"0x70"`
+	_            [8]uint8    `offset:"0x78"`
 	// struct driveinfostruct driveinfo;
 	Driveinfo [0x20]uint8 `offset:"0x80"`
 	// struct sysdesctable sysdesctable;
-	Sysdesctable        [0x140]uint8 `offset:"0xa0"`
-	Altmemk             uint32       `offset:"0x1e0"`
-	_                   [4]uint8     `offset:"0x1e4"`
-	E820MapNr           uint8        `offset:"0x1e8"`
-	_                   [9]uint8     `offset:"0x1e9"`
-	MountRootReadonly   uint16       `offset:"0x1f2"`
-	_                   [4]uint8     `offset:"0x1f4"`
-	Ramdiskflags        uint16       `offset:"0x1f8"`
-	_                   [2]uint8     `offset:"0x1fa"`
-	OrigRootDev         uint16       `offset:"0x1fc"`
-	_                   [1]uint8     `offset:"0x1fe"`
-	Auxdeviceinfo       uint8        `offset:"0x1ff"`
-	_                   [2]uint8     `offset:"0x200"`
-	Paramblocksignature [4]uint8     `offset:"0x202"`
-	Paramblockversion   uint16       `offset:"0x206"`
-	_                   [8]uint8     `offset:"0x208"`
-	LoaderType          uint8        `offset:"0x210"`
-	Loaderflags         uint8        `offset:"0x211"`
-	_                   [2]uint8     `offset:"0x212"`
-	KernelStart         uint32       `offset:"0x214"`
-	Initrdstart         uint32       `offset:"0x218"`
-	Initrdsize          uint32       `offset:"0x21c"`
-	_                   [8]uint8     `offset:"0x220"`
-	CLPtr               uint32       `offset:"0x228"` // USE THIS.
-	InitrdAddrMax       uint32       `offset:"0x22c"`
+	Sysdesctable        [0x10]uint8 `offset:"0xa0"`
+	OLPCOFWHeader       [0x10]uint8 `offset:"0xb0"`
+	ExtRamdiskImage     uint32      `offset:"0xc0"`
+	ExtRamdiskSize      uint32      `offset:"0xc4"`
+	ExtCmdlinePtr       uint32      `offset:"0xc8"`
+	_                   [0x70]uint8 `offset:"0xcc"`
+	CCBlobAddress       uint32      `offset:"0x13c"`
+	EDIDInfo            [0x80]uint8 `offset:"0x140"`
+	EFIInfo             EFIInfo     `offset:"0x1c0"`
+	Altmemk             uint32      `offset:"0x1e0"`
+	_                   [4]uint8    `offset:"0x1e4"`
+	E820MapNr           uint8       `offset:"0x1e8"`
+	EDDBufNr            uint8       `offset:"0x1e9"`
+	EDDMBRSigBufNr      uint8       `offset:"0x1ea"`
+	KbdStatus           uint8       `offset:"0x1eb"`
+	SecureBoot          uint8       `offset:"0x1ec"`
+	_                   [2]uint8    `offset:"0x1ed"`
+	Sentinel            uint8       `offset:"0x1ef"`
+	_                   [1]uint8    `offset:"0x1f0"`
+	SetupSects          uint8       `offset:"0x1f1"`
+	MountRootReadonly   uint16      `offset:"0x1f2"`
+	Syssize             uint32      `offset:"0x1f4"`
+	Ramdiskflags        uint16      `offset:"0x1f8"`
+	Vidmode             uint16      `offset:"0x1fa"`
+	OrigRootDev         uint16      `offset:"0x1fc"`
+	Bootsectormagic     uint8       `offset:"0x1fe"` // Low byte of boot_flag.
+	Auxdeviceinfo       uint8       `offset:"0x1ff"`
+	Jump                uint16      `offset:"0x200"`
+	Paramblocksignature [4]uint8    `offset:"0x202"`
+	Paramblockversion   uint16      `offset:"0x206"`
+	RealModeSwitch      uint32      `offset:"0x208"`
+	StartSys            uint16      `offset:"0x20c"`
+	Kveraddr            uint16      `offset:"0x20e"`
+	LoaderType          uint8       `offset:"0x210"`
+	Loaderflags         uint8       `offset:"0x211"`
+	Setupmovesize       uint16      `offset:"0x212"`
+	KernelStart         uint32      `offset:"0x214"`
+	Initrdstart         uint32      `offset:"0x218"`
+	Initrdsize          uint32      `offset:"0x21c"`
+	BootSectKludge      [4]uint8    `offset:"0x220"`
+	Heapendptr          uint16      `offset:"0x224"`
+	ExtLoaderVer        uint8       `offset:"0x226"`
+	ExtLoaderType       uint8       `offset:"0x227"`
+	CLPtr               uint32      `offset:"0x228"` // USE THIS.
+	InitrdAddrMax       uint32      `offset:"0x22c"`
 	/* 2.04+ */
 	KernelAlignment     uint32               `offset:"0x230"`
 	RelocatableKernel   uint8                `offset:"0x234"`
@@ -225,14 +265,12 @@ type LinuxParams struct {
 	HandoverOffset      uint32               `offset:"0x264"`
 	_                   [0x290 - 0x268]uint8 `offset:"0x268"`
 	EDDMBRSigBuffer     [EDDMBRSigMax]uint32 `offset:"0x290"`
-	// e820map is another cockup from the usual suspects.
-	// Go rounds the size to something reasonable. Oh well. No checking for you.
-	// So the next two offsets are bogus, sorry about that.
+	// binary.Write packs E820Entry into 20 bytes, as in the kernel's
+	// packed struct boot_e820_entry.
 	E820Map [E820Max]E820Entry `offset:"0x2d0"`
-	// we lie.
-	_      [48]uint8         `offset:"0xed0"` // `offset:"0xcd0"`
-	EDDBuf [EDDMaxNR]EDDInfo `offset:"0xf00"` // `offset:"0xd00"`
-
+	_       [48]uint8          `offset:"0xcd0"`
+	EDDBuf  [EDDMaxNR]EDDInfo  `offset:"0xd00"`
+	_       [0x114]uint8       `offset:"0xeec"`
 }
 
 var (
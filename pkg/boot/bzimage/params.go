@@ -0,0 +1,155 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Offsets of the setup header in the boot sector and in LinuxParams.
+const (
+	setupHeaderStart = 0x1f1
+	// The setup header ends at 0x202 plus the byte at 0x201, the
+	// operand of the jump at 0x200.
+	setupHeaderJump = 0x201
+)
+
+// LoaderTypeUnknown is the type_of_loader of boot loaders without an
+// assigned ID.
+const LoaderTypeUnknown = 0xff
+
+// Video types for OrigVideoIsVGA.
+const (
+	VideoTypeVLFB = 0x23
+	VideoTypeEFI  = 0x70
+)
+
+// VideoCapability64BitBase indicates that ExtLfbbase holds the upper 32
+// bits of the framebuffer address.
+const VideoCapability64BitBase = 1 << 1
+
+// EFI64LoaderSignature is EFIInfo.LoaderSignature for 64-bit EFI.
+var EFI64LoaderSignature = [4]uint8{'E', 'L', '6', '4'}
+
+// setup_data types.
+const (
+	SetupE820Ext = 1
+	SetupDTB     = 2
+	SetupPCI     = 3
+	SetupEFI     = 4
+)
+
+// SetupData is a node of the setup_data linked list passed in
+// LinuxParams.SetupData.
+type SetupData struct {
+	Type uint32
+	Data []byte
+}
+
+// MarshalSetupData returns the setup_data list to be loaded at physical
+// address base. Each node is 8-byte aligned and points to the next.
+func MarshalSetupData(base uint64, nodes []SetupData) []byte {
+	var buf bytes.Buffer
+	for i, n := range nodes {
+		start := buf.Len()
+		size := align8(16 + len(n.Data))
+		var next uint64
+		if i < len(nodes)-1 {
+			next = base + uint64(start+size)
+		}
+		binary.Write(&buf, binary.LittleEndian, next)
+		binary.Write(&buf, binary.LittleEndian, n.Type)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(n.Data)))
+		buf.Write(n.Data)
+		buf.Write(make([]byte, start+size-buf.Len()))
+	}
+	return buf.Bytes()
+}
+
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+// EFISetupData is the payload of a SetupEFI node. It gives a kexec'd
+// kernel the physical addresses of the EFI tables the first kernel
+// remapped.
+type EFISetupData struct {
+	FwVendor uint64
+	Runtime  uint64
+	Tables   uint64
+	SMBIOS   uint64
+	Reserved [8]uint64
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *EFISetupData) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.LittleEndian, e)
+	return buf.Bytes(), err
+}
+
+// EFIMemoryDescriptor is an EFI memory map entry.
+type EFIMemoryDescriptor struct {
+	Type      uint32
+	_         uint32
+	PhysAddr  uint64
+	VirtAddr  uint64
+	NumPages  uint64
+	Attribute uint64
+}
+
+// EFIMemoryDescriptorVersion is the EFI memory descriptor version.
+const EFIMemoryDescriptorVersion = 1
+
+// NewLinuxParams returns boot parameters with the setup header of the
+// kernel described by hdr and everything else zeroed, as the boot protocol
+// asks boot loaders to do.
+func NewLinuxParams(hdr *LinuxHeader) (*LinuxParams, error) {
+	h, err := hdr.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	end := 0x202 + int(h[setupHeaderJump])
+	if end > len(h) {
+		// Newer kernels have fields LinuxHeader does not know.
+		end = len(h)
+	}
+	b := make([]byte, binary.Size(LinuxParams{}))
+	copy(b[setupHeaderStart:], h[setupHeaderStart:end])
+
+	var lp LinuxParams
+	if err := lp.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return &lp, nil
+}
+
+// SetE820 sets the e820 memory map. Entries that do not fit into E820Map
+// are returned as a SetupE820Ext node, nil otherwise.
+func (h *LinuxParams) SetE820(entries []E820Entry) *SetupData {
+	h.E820Map = [E820Max]E820Entry{}
+	n := copy(h.E820Map[:], entries)
+	h.E820MapNr = uint8(n)
+	if n == len(entries) {
+		return nil
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, entries[n:])
+	return &SetupData{Type: SetupE820Ext, Data: buf.Bytes()}
+}
+
+// SetEDD sets the EDD information and MBR signatures of BIOS disks.
+func (h *LinuxParams) SetEDD(info []EDDInfo, mbrSigs []uint32) error {
+	if len(info) > EDDMaxNR || len(mbrSigs) > EDDMBRSigMax {
+		return fmt.Errorf("%d EDD entries and %d MBR signatures exceed the maximum of %d and %d", len(info), len(mbrSigs), EDDMaxNR, EDDMBRSigMax)
+	}
+	h.EDDBuf = [EDDMaxNR]EDDInfo{}
+	h.EDDBufNr = uint8(copy(h.EDDBuf[:], info))
+	h.EDDMBRSigBuffer = [EDDMBRSigMax]uint32{}
+	h.EDDMBRSigBufNr = uint8(copy(h.EDDMBRSigBuffer[:], mbrSigs))
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzimage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewLinuxParams(t *testing.T) {
+	for _, tc := range testImages {
+		t.Run(tc.name, func(t *testing.T) {
+			var b BzImage
+			if err := b.UnmarshalBinary(mustReadFile(t, tc.path)); err != nil {
+				t.Fatal(err)
+			}
+			lp, err := NewLinuxParams(&b.Header)
+			if err != nil {
+				t.Fatalf("NewLinuxParams() = %v", err)
+			}
+			params, err := lp.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			hdr, err := b.Header.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			end := 0x202 + int(hdr[setupHeaderJump])
+			if !bytes.Equal(params[setupHeaderStart:end], hdr[setupHeaderStart:end]) {
+				t.Errorf("setup header not copied:\n got %x\nwant %x", params[setupHeaderStart:end], hdr[setupHeaderStart:end])
+			}
+			if !bytes.Equal(params[:setupHeaderStart], make([]byte, setupHeaderStart)) {
+				t.Errorf("parameters before the setup header are not zeroed")
+			}
+			if !bytes.Equal(params[end:], make([]byte, len(params)-end)) {
+				t.Errorf("parameters after the setup header are not zeroed")
+			}
+		})
+	}
+}
+
+func TestSetE820(t *testing.T) {
+	entries := make([]E820Entry, E820Max+2)
+	for i := range entries {
+		entries[i] = E820Entry{Addr: uint64(i) << 20, Size: 1 << 20, MemType: RAM}
+	}
+
+	var lp LinuxParams
+	if ext := lp.SetE820(entries[:3]); ext != nil {
+		t.Errorf("SetE820(3 entries) = %v, want nil", ext)
+	}
+	if lp.E820MapNr != 3 || lp.E820Map[2] != entries[2] {
+		t.Errorf("SetE820(3 entries) set %d entries", lp.E820MapNr)
+	}
+
+	ext := lp.SetE820(entries)
+	if lp.E820MapNr != E820Max {
+		t.Errorf("SetE820(%d entries) set %d entries, want %d", len(entries), lp.E820MapNr, E820Max)
+	}
+	want := &SetupData{
+		Type: SetupE820Ext,
+		Data: []byte{
+			0, 0, 0, 0x08, 0, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0, 0, 1, 0, 0, 0,
+			0, 0, 0x10, 0x08, 0, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0, 0, 1, 0, 0, 0,
+		},
+	}
+	if diff := cmp.Diff(want, ext); diff != "" {
+		t.Errorf("SetE820() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetEDD(t *testing.T) {
+	var lp LinuxParams
+	if err := lp.SetEDD([]EDDInfo{{Device: 0x80}}, []uint32{0x1234}); err != nil {
+		t.Fatalf("SetEDD() = %v", err)
+	}
+	if lp.EDDBufNr != 1 || lp.EDDBuf[0].Device != 0x80 || lp.EDDMBRSigBufNr != 1 || lp.EDDMBRSigBuffer[0] != 0x1234 {
+		t.Errorf("SetEDD() = %d %v, %d %v", lp.EDDBufNr, lp.EDDBuf[0], lp.EDDMBRSigBufNr, lp.EDDMBRSigBuffer[0])
+	}
+	if err := lp.SetEDD(make([]EDDInfo, EDDMaxNR+1), nil); err == nil {
+		t.Errorf("SetEDD(%d entries) = nil, want error", EDDMaxNR+1)
+	}
+}
+
+func TestMarshalSetupData(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		nodes []SetupData
+		want  []byte
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "two nodes",
+			nodes: []SetupData{
+				{Type: SetupDTB, Data: []byte{0xd0, 0x0d}},
+				{Type: SetupEFI, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			},
+			want: []byte{
+				// next, type, len
+				0x18, 0x10, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0,
+				0xd0, 0x0d, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 8, 0, 0, 0,
+				1, 2, 3, 4, 5, 6, 7, 8,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MarshalSetupData(0x1000, tt.nodes)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("MarshalSetupData() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
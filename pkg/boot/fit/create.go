@@ -0,0 +1,240 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+// ImageSpec describes an image of a FIT to Build.
+type ImageSpec struct {
+	// Name is the name of the image node, e.g. "kernel-1".
+	Name        string
+	Description string
+	// Type is the image type, e.g. "kernel", "ramdisk", or "flat_dt" for
+	// device trees and overlays.
+	Type string
+	Arch string
+	OS   string
+	// Compression is "none" if empty.
+	Compression string
+	// Load and Entry are the load and entry addresses, if not nil.
+	Load, Entry *uint32
+	Data        []byte
+	// Hashes are the algorithms of the hash nodes of the image, e.g.
+	// "sha256", "sha512" or "crc32".
+	Hashes []string
+}
+
+// ConfigSpec describes a configuration of a FIT to Build.
+type ConfigSpec struct {
+	// Name is the name of the configuration node, e.g. "conf-1".
+	Name        string
+	Description string
+	// Kernel, Ramdisk and FDT are the names of the images of the
+	// configuration. FDT is a device tree followed by overlays to apply to
+	// it.
+	Kernel  string
+	Ramdisk string
+	FDT     []string
+	// Keys sign the configuration, each in its own signature node.
+	Keys []SigningKey
+}
+
+// SigningKey signs configurations the way U-Boot's mkimage does.
+type SigningKey struct {
+	// Name is the key-name-hint of signatures.
+	Name string
+	// Signer is an *rsa.PrivateKey or an *ecdsa.PrivateKey.
+	Signer crypto.Signer
+	// Hash is the hash to sign, crypto.SHA256 if zero.
+	Hash crypto.Hash
+	// PSS selects RSA-PSS instead of PKCS #1 v1.5 padding.
+	PSS bool
+}
+
+// signerName is the signer-name of the signatures Build makes.
+const signerName = "u-root fit"
+
+func propU32(name string, v uint32) dt.Property {
+	return dt.Property{Name: name, Value: binary.BigEndian.AppendUint32(nil, v)}
+}
+
+func propStringList(name string, s []string) dt.Property {
+	return dt.Property{Name: name, Value: []byte(strings.Join(s, "\x00") + "\x00")}
+}
+
+// imageNode returns the node of an image with its hash nodes.
+func imageNode(img ImageSpec) (*dt.Node, error) {
+	if len(img.Hashes) == 0 {
+		return nil, fmt.Errorf("image %q: %w", img.Name, errNoHashNode)
+	}
+	compression := img.Compression
+	if compression == "" {
+		compression = "none"
+	}
+	n := dt.NewNode(img.Name, dt.WithProperty(
+		dt.PropertyString("description", img.Description),
+		dt.Property{Name: "data", Value: img.Data},
+		dt.PropertyString("type", img.Type),
+	))
+	if img.Arch != "" {
+		n.Properties = append(n.Properties, dt.PropertyString("arch", img.Arch))
+	}
+	if img.OS != "" {
+		n.Properties = append(n.Properties, dt.PropertyString("os", img.OS))
+	}
+	n.Properties = append(n.Properties, dt.PropertyString("compression", compression))
+	if img.Load != nil {
+		n.Properties = append(n.Properties, propU32("load", *img.Load))
+	}
+	if img.Entry != nil {
+		n.Properties = append(n.Properties, propU32("entry", *img.Entry))
+	}
+	for i, algo := range img.Hashes {
+		sum, err := hashData(algo, img.Data)
+		if err != nil {
+			return nil, fmt.Errorf("image %q: %w", img.Name, err)
+		}
+		n.Children = append(n.Children, dt.NewNode(fmt.Sprintf("hash-%d", i+1), dt.WithProperty(
+			dt.PropertyString("algo", algo),
+			dt.Property{Name: "value", Value: sum},
+		)))
+	}
+	return n, nil
+}
+
+type pendingSignature struct {
+	node  *dt.Node
+	key   SigningKey
+	nodes []string
+}
+
+// Build assembles a FIT from images and configurations, the first of which
+// is the default one, and signs the configurations.
+//
+// A signature covers the configuration and the hash nodes of its images,
+// like a signature node with sign-images listing all its images in an
+// image source file for mkimage.
+func Build(description string, images []ImageSpec, configs []ConfigSpec) ([]byte, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no configurations")
+	}
+	imagesNode := dt.NewNode("images")
+	hashNodes := map[string][]string{}
+	for _, img := range images {
+		if _, ok := hashNodes[img.Name]; ok {
+			return nil, fmt.Errorf("duplicate image %q", img.Name)
+		}
+		n, err := imageNode(img)
+		if err != nil {
+			return nil, err
+		}
+		imagesNode.Children = append(imagesNode.Children, n)
+		for _, h := range n.Children {
+			hashNodes[img.Name] = append(hashNodes[img.Name], "/images/"+img.Name+"/"+h.Name)
+		}
+	}
+
+	configsNode := dt.NewNode("configurations", dt.WithProperty(dt.PropertyString("default", configs[0].Name)))
+	var sigs []pendingSignature
+	for _, c := range configs {
+		n := dt.NewNode(c.Name, dt.WithProperty(dt.PropertyString("description", c.Description)))
+		// The properties naming images, in the order U-Boot hashes them.
+		var signImages []string
+		nodes := []string{"/", "/configurations/" + c.Name}
+		for _, p := range []struct {
+			name   string
+			images []string
+		}{
+			{"kernel", []string{c.Kernel}},
+			{"fdt", c.FDT},
+			{"ramdisk", []string{c.Ramdisk}},
+		} {
+			if len(p.images) == 0 || p.images[0] == "" {
+				continue
+			}
+			for _, img := range p.images {
+				if _, ok := hashNodes[img]; !ok {
+					return nil, fmt.Errorf("configuration %q: no image %q", c.Name, img)
+				}
+				nodes = append(nodes, "/images/"+img)
+				nodes = append(nodes, hashNodes[img]...)
+			}
+			n.Properties = append(n.Properties, propStringList(p.name, p.images))
+			signImages = append(signImages, p.name)
+		}
+
+		for i, key := range c.Keys {
+			if key.Hash == 0 {
+				key.Hash = crypto.SHA256
+			}
+			algo, err := signatureAlgo(key.Signer.Public(), key.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("configuration %q: %w", c.Name, err)
+			}
+			// All properties are there before signing, so that the
+			// strings block does not change afterwards. Properties of
+			// signature nodes are not signed.
+			sig := dt.NewNode(fmt.Sprintf("signature-%d", i+1), dt.WithProperty(
+				dt.PropertyString("algo", algo),
+				dt.PropertyString("key-name-hint", key.Name),
+				propStringList("sign-images", signImages),
+			))
+			if key.PSS {
+				sig.Properties = append(sig.Properties, dt.PropertyString("padding", "pss"))
+			}
+			sig.Properties = append(sig.Properties,
+				dt.PropertyString("signer-name", signerName),
+				propStringList("hashed-nodes", nodes),
+				dt.Property{Name: "hashed-strings", Value: make([]byte, 8)},
+				dt.Property{Name: "value"},
+			)
+			n.Children = append(n.Children, sig)
+			sigs = append(sigs, pendingSignature{node: sig, key: key, nodes: nodes})
+		}
+		configsNode.Children = append(configsNode.Children, n)
+	}
+
+	fdt := &dt.FDT{
+		Header: dt.Header{Magic: dt.Magic, Version: 17, LastCompVersion: 16},
+		RootNode: dt.NewNode("", dt.WithProperty(
+			dt.PropertyString("description", description),
+			propU32("#address-cells", 1),
+		), dt.WithChildren(imagesNode, configsNode)),
+	}
+	var b bytes.Buffer
+	if _, err := fdt.Write(&b); err != nil {
+		return nil, err
+	}
+	if len(sigs) == 0 {
+		return b.Bytes(), nil
+	}
+
+	strSize := fdt.Header.SizeDtStrings
+	for _, s := range sigs {
+		data, err := regionData(b.Bytes(), s.nodes, 0, strSize)
+		if err != nil {
+			return nil, err
+		}
+		value, err := sign(s.key.Signer, s.key.Hash, s.key.PSS, data)
+		if err != nil {
+			return nil, err
+		}
+		s.node.UpdateProperty("hashed-strings", binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 0), strSize))
+		s.node.UpdateProperty("value", value)
+	}
+	b.Reset()
+	if _, err := fdt.Write(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
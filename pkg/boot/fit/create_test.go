@@ -0,0 +1,461 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"hash/crc32"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/dt"
+	"github.com/u-root/u-root/pkg/vfile"
+)
+
+func u32(v uint32) *uint32 {
+	return &v
+}
+
+func testImages() []ImageSpec {
+	return []ImageSpec{
+		{Name: "kernel-1", Description: "kernel", Type: "kernel", Arch: "x86_64", OS: "linux", Load: u32(0x10000), Entry: u32(0x10000), Data: []byte("the kernel"), Hashes: []string{"sha256", "crc32"}},
+		{Name: "ramdisk-1", Description: "initramfs", Type: "ramdisk", Arch: "x86_64", OS: "linux", Data: []byte("the initramfs"), Hashes: []string{"sha512"}},
+		{Name: "fdt-1", Type: "flat_dt", Data: []byte("the device tree"), Hashes: []string{"sha256"}},
+		{Name: "overlay-1", Type: "flat_dt", Data: []byte("the overlay"), Hashes: []string{"sha256"}},
+	}
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := []ConfigSpec{
+		{Name: "conf-pkcs1", Description: "Boot A", Kernel: "kernel-1", Ramdisk: "ramdisk-1", FDT: []string{"fdt-1", "overlay-1"}, Keys: []SigningKey{{Name: "dev", Signer: rsaKey}}},
+		{Name: "conf-pss", Kernel: "kernel-1", Keys: []SigningKey{{Name: "dev", Signer: rsaKey, PSS: true, Hash: crypto.SHA512}}},
+		{Name: "conf-p256", Kernel: "kernel-1", Ramdisk: "ramdisk-1", Keys: []SigningKey{{Name: "ec", Signer: p256Key}}},
+		{Name: "conf-p384", Kernel: "kernel-1", FDT: []string{"fdt-1"}, Keys: []SigningKey{{Name: "other", Signer: otherKey}, {Name: "ec", Signer: p384Key, Hash: crypto.SHA384}}},
+		{Name: "conf-unsigned", Kernel: "kernel-1"},
+	}
+	b, err := Build("test FIT", testImages(), configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imgs, err := ParseConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != len(configs) {
+		t.Fatalf("ParseConfig returned %d configurations, want %d", len(imgs), len(configs))
+	}
+	if imgs[0].Kernel != "kernel-1" || imgs[0].InitRAMFS != "ramdisk-1" {
+		t.Errorf("configuration 0 has kernel %q, initramfs %q, want kernel-1, ramdisk-1", imgs[0].Kernel, imgs[0].InitRAMFS)
+	}
+	if d, err := imgs[0].GetConfigName(); err != nil || d != "conf-pkcs1" {
+		t.Errorf("GetConfigName = %q, %v, want conf-pkcs1", d, err)
+	}
+	fdts, err := imgs[0].Root.Root().Walk("configurations").Walk("conf-pkcs1").Property("fdt").AsBytes()
+	if want := "fdt-1\x00overlay-1\x00"; err != nil || string(fdts) != want {
+		t.Errorf("fdt = %q, %v, want %q", fdts, err, want)
+	}
+
+	kernel := imgs[0].Root.Root().Walk("images").Walk("kernel-1")
+	sum := sha256.Sum256([]byte("the kernel"))
+	if got, err := kernel.Walk("hash-1").Property("value").AsBytes(); err != nil || !bytes.Equal(got, sum[:]) {
+		t.Errorf("sha256 = %x, %v, want %x", got, err, sum)
+	}
+	crc := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE([]byte("the kernel")))
+	if got, err := kernel.Walk("hash-2").Property("value").AsBytes(); err != nil || !bytes.Equal(got, crc) {
+		t.Errorf("crc32 = %x, %v, want %x", got, err, crc)
+	}
+	if algo, err := imgs[1].Root.Root().Walk("configurations").Walk("conf-pss").Walk("signature-1").Property("algo").AsString(); err != nil || algo != "sha512,rsa2048" {
+		t.Errorf("algo = %q, %v, want sha512,rsa2048", algo, err)
+	}
+
+	for _, tt := range []struct {
+		config string
+		keys   []crypto.PublicKey
+		ok     bool
+	}{
+		{"conf-pkcs1", []crypto.PublicKey{&rsaKey.PublicKey}, true},
+		{"conf-pkcs1", []crypto.PublicKey{&p256Key.PublicKey}, false},
+		{"conf-pss", []crypto.PublicKey{&p256Key.PublicKey, &rsaKey.PublicKey}, true},
+		{"conf-p256", []crypto.PublicKey{&p256Key.PublicKey}, true},
+		{"conf-p256", []crypto.PublicKey{&otherKey.PublicKey, &rsaKey.PublicKey}, false},
+		{"conf-p384", []crypto.PublicKey{&p384Key.PublicKey}, true},
+		{"conf-p384", []crypto.PublicKey{&otherKey.PublicKey}, true},
+		{"conf-p384", []crypto.PublicKey{&p256Key.PublicKey}, false},
+		{"conf-unsigned", []crypto.PublicKey{&rsaKey.PublicKey}, false},
+	} {
+		i, err := ParseConfig(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := i[0]
+		img.ConfigOverride = tt.config
+		err = img.VerifyConfig(tt.keys...)
+		if tt.ok && err != nil {
+			t.Errorf("VerifyConfig(%s) = %v, want nil", tt.config, err)
+		}
+		if !tt.ok && !errors.As(err, &vfile.ErrUnsigned{}) {
+			t.Errorf("VerifyConfig(%s) = %v, want ErrUnsigned", tt.config, err)
+		}
+	}
+}
+
+func TestVerifyConfigTampered(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Build("test FIT", testImages(), []ConfigSpec{
+		{Name: "conf-1", Description: "Boot A", Kernel: "kernel-1", Ramdisk: "ramdisk-1", Keys: []SigningKey{{Name: "ec", Signer: key}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		desc     string
+		old, new string
+		want     any
+	}{
+		{desc: "untouched"},
+		{desc: "kernel data", old: "the kernel", new: "the kerneL", want: &vfile.ErrInvalidHash{}},
+		{desc: "initramfs data", old: "the initramfs", new: "THE initramfs", want: &vfile.ErrInvalidHash{}},
+		{desc: "configuration", old: "Boot A", new: "Boot B", want: &vfile.ErrUnsigned{}},
+		{desc: "image", old: "x86_64", new: "arm_64", want: &vfile.ErrUnsigned{}},
+		{desc: "root", old: "test FIT", new: "evil FIT", want: &vfile.ErrUnsigned{}},
+		// Images which are not part of the configuration and
+		// properties of signature nodes are not signed.
+		{desc: "other image", old: "the overlay", new: "bad overlay"},
+		{desc: "signer name", old: signerName, new: "someone else"[:len(signerName)]},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			tampered := bytes.Replace(b, []byte(tt.old), []byte(tt.new), 1)
+			if tt.old != "" && bytes.Equal(tampered, b) {
+				t.Fatalf("%q not found", tt.old)
+			}
+			imgs, err := ParseConfig(bytes.NewReader(tampered))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = imgs[0].VerifyConfig(&key.PublicKey)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("VerifyConfig = %v, want nil", err)
+				}
+			} else if !errors.As(err, tt.want) {
+				t.Errorf("VerifyConfig = %v, want %T", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyConfigWeakHash(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hashes := range [][]string{{"crc32"}, {"md5", "crc32"}} {
+		images := testImages()
+		images[0].Hashes = hashes
+		b, err := Build("test FIT", images, []ConfigSpec{
+			{Name: "conf-1", Kernel: "kernel-1", Keys: []SigningKey{{Name: "ec", Signer: key}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		imgs, err := ParseConfig(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := imgs[0].VerifyConfig(&key.PublicKey); !errors.Is(err, errNoSecureHash) {
+			t.Errorf("VerifyConfig with %q hashes = %v, want %v", hashes, err, errNoSecureHash)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		desc    string
+		images  []ImageSpec
+		configs []ConfigSpec
+	}{
+		{desc: "no configurations", images: testImages()},
+		{desc: "missing image", images: testImages(), configs: []ConfigSpec{{Name: "conf-1", Kernel: "kernel-2"}}},
+		{desc: "no hashes", images: []ImageSpec{{Name: "kernel-1"}}, configs: []ConfigSpec{{Name: "conf-1", Kernel: "kernel-1"}}},
+		{desc: "unknown hash", images: []ImageSpec{{Name: "kernel-1", Hashes: []string{"sha3"}}}, configs: []ConfigSpec{{Name: "conf-1", Kernel: "kernel-1"}}},
+		{desc: "duplicate image", images: append(testImages(), testImages()[0]), configs: []ConfigSpec{{Name: "conf-1", Kernel: "kernel-1"}}},
+		{desc: "bad hash", images: testImages(), configs: []ConfigSpec{{Name: "conf-1", Kernel: "kernel-1", Keys: []SigningKey{{Signer: key, Hash: crypto.MD5}}}}},
+	} {
+		if _, err := Build("", tt.images, tt.configs); err == nil {
+			t.Errorf("Build(%s) = nil, want error", tt.desc)
+		}
+	}
+}
+
+func TestRegionData(t *testing.T) {
+	// / { p; a { p; b { p; c { p; }; }; }; d { p; }; };
+	prop := dt.PropertyString("p", "x")
+	fdt := &dt.FDT{
+		Header: dt.Header{Magic: dt.Magic, Version: 17, LastCompVersion: 16},
+		RootNode: dt.NewNode("", dt.WithProperty(prop), dt.WithChildren(
+			dt.NewNode("a", dt.WithProperty(prop, dt.Property{Name: "data", Value: []byte{1}}), dt.WithChildren(
+				dt.NewNode("b", dt.WithProperty(prop), dt.WithChildren(
+					dt.NewNode("c", dt.WithProperty(prop)),
+				)),
+			)),
+			dt.NewNode("d", dt.WithProperty(prop)),
+		)),
+	}
+	var b bytes.Buffer
+	if _, err := fdt.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	be := func(v ...uint32) []byte {
+		var b []byte
+		for _, v := range v {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	begin := func(name string) []byte {
+		b := append(be(1), name...)
+		return append(b, make([]byte, 4-len(name)%4)...)
+	}
+	p := append(be(3, 2, 0), 'x', 0, 0, 0)
+	end := be(2)
+
+	var want []byte
+	for _, b := range [][]byte{
+		begin(""), p, // In the list.
+		begin("a"), p, // In the list, without data.
+		begin("b"), end, // A child without properties.
+		end,
+		begin("d"), end, // A child without properties.
+		end, be(9),
+		[]byte("p\x00da"), // The given part of the strings.
+	} {
+		want = append(want, b...)
+	}
+	got, err := regionData(b.Bytes(), []string{"/", "/a"}, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("regionData =\n%x, want\n%x", got, want)
+	}
+
+	// Parents are not covered unless listed.
+	want = nil
+	for _, b := range [][]byte{begin("b"), p, begin("c"), end, end, be(9)} {
+		want = append(want, b...)
+	}
+	if got, err := regionData(b.Bytes(), []string{"/a/b"}, 0, 0); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("regionData(/a/b) =\n%x, %v, want\n%x", got, err, want)
+	}
+
+	if _, err := regionData(b.Bytes()[:64], []string{"/"}, 0, 4); err == nil {
+		t.Errorf("regionData of truncated FDT = nil, want error")
+	}
+}
+
+func TestLoadVerified(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Build("test FIT", testImages(), []ConfigSpec{
+		{Name: "conf-1", Kernel: "kernel-1", Ramdisk: "ramdisk-1", Keys: []SigningKey{{Name: "dev", Signer: key}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(old func(i *boot.LinuxImage, opts ...boot.LoadOption) error) { loadImage = old }(loadImage)
+	loadImage = func(*boot.LinuxImage, ...boot.LoadOption) error { return nil }
+
+	for _, tt := range []struct {
+		desc    string
+		kernel  string
+		keys    []crypto.PublicKey
+		wantErr bool
+	}{
+		{desc: "verified", kernel: "kernel-1", keys: []crypto.PublicKey{&key.PublicKey}},
+		{desc: "other kernel", kernel: "fdt-1", keys: []crypto.PublicKey{&key.PublicKey}, wantErr: true},
+		{desc: "no key", kernel: "kernel-1", keys: []crypto.PublicKey{}, wantErr: true},
+		{desc: "unverified", kernel: "fdt-1"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			imgs, err := ParseConfig(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			i := imgs[0]
+			i.Kernel, i.PublicKeys = tt.kernel, tt.keys
+			if err := i.Load(); (err != nil) != tt.wantErr {
+				t.Errorf("Load = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestVerifyMkimage verifies a FIT signed by U-Boot's mkimage, which needs
+// u-boot-tools and dtc.
+func TestVerifyMkimage(t *testing.T) {
+	for _, tool := range []string{"mkimage", "dtc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s: %v", tool, err)
+		}
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "dev"}}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	its := `/dts-v1/;
+/ {
+	description = "mkimage FIT";
+	#address-cells = <1>;
+	images {
+		kernel-1 {
+			description = "kernel";
+			data = /incbin/("kernel");
+			type = "kernel";
+			arch = "x86_64";
+			os = "linux";
+			compression = "none";
+			load = <0x100000>;
+			entry = <0x100000>;
+			hash-1 { algo = "sha256"; };
+			hash-2 { algo = "crc32"; };
+		};
+		ramdisk-1 {
+			description = "initramfs";
+			data = /incbin/("ramdisk");
+			type = "ramdisk";
+			arch = "x86_64";
+			os = "linux";
+			compression = "none";
+			hash-1 { algo = "sha256"; };
+		};
+	};
+	configurations {
+		default = "conf-pkcs1";
+		conf-pkcs1 {
+			description = "Boot A";
+			kernel = "kernel-1";
+			ramdisk = "ramdisk-1";
+			signature-1 {
+				algo = "sha256,rsa2048";
+				key-name-hint = "dev";
+				sign-images = "kernel", "ramdisk";
+			};
+		};
+		conf-pss {
+			kernel = "kernel-1";
+			signature-1 {
+				algo = "sha256,rsa2048";
+				padding = "pss";
+				key-name-hint = "dev";
+				sign-images = "kernel";
+			};
+		};
+	};
+};
+`
+	for name, data := range map[string][]byte{
+		"fit.its": []byte(its),
+		"kernel":  []byte("the kernel"),
+		"ramdisk": []byte("the initramfs"),
+		"dev.key": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"dev.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("mkimage", "-f", "fit.its", "-k", ".", "fit.itb")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("mkimage: %v\n%s", err, out)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "fit.itb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		config   string
+		old, new string
+		want     any
+	}{
+		{config: "conf-pkcs1"},
+		{config: "conf-pss"},
+		{config: "conf-pkcs1", old: "the kernel", new: "the kerneL", want: &vfile.ErrInvalidHash{}},
+		{config: "conf-pkcs1", old: "Boot A", new: "Boot B", want: &vfile.ErrUnsigned{}},
+		{config: "conf-pss", old: "mkimage FIT", new: "evil FIT!!!", want: &vfile.ErrUnsigned{}},
+	} {
+		t.Run(tt.config+" "+tt.old, func(t *testing.T) {
+			tampered := bytes.Replace(b, []byte(tt.old), []byte(tt.new), 1)
+			imgs, err := ParseConfig(bytes.NewReader(tampered))
+			if err != nil {
+				t.Fatal(err)
+			}
+			img := imgs[0]
+			img.ConfigOverride = tt.config
+			err = img.VerifyConfig(&key.PublicKey)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("VerifyConfig = %v, want nil", err)
+				}
+			} else if !errors.As(err, tt.want) {
+				t.Errorf("VerifyConfig = %v, want %T", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,13 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package fit provides tools to read and verify FIT kernel images
+// Package fit provides tools to create, read and verify FIT kernel images
 // See https://doc.coreboot.org/lib/payloads/fit.html
 package fit
 
 import (
 	"bytes"
+	"crypto"
 	"fmt"
 	"io"
 	"os"
@@ -36,28 +37,37 @@ type Image struct {
 	BootRank int
 	// KeyRing is the optional set of public keys used to validate images at Load
 	KeyRing openpgp.KeyRing
+	// PublicKeys are the optional keys used to validate the U-Boot style
+	// configuration signatures at Load, see VerifyConfig.
+	PublicKeys []crypto.PublicKey
+
+	// raw is the FIT as read, which configuration signatures cover.
+	raw []byte
 }
 
 var _ = boot.OSImage(&Image{})
 
 // New returns a new image initialized with a file containing an FDT.
 func New(n string) (*Image, error) {
-	f, err := os.Open(n)
+	b, err := os.ReadFile(n)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	fdt, err := dt.ReadFDT(f)
+	fdt, err := dt.ReadFDT(bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
-	return &Image{name: n, Root: fdt}, nil
+	return &Image{name: n, Root: fdt, raw: b}, nil
 }
 
 // ParseConfig reads r for a FIT image and returns a OSImage for each
 // configuration parsed.
 func ParseConfig(r io.ReadSeeker) ([]Image, error) {
-	fdt, err := dt.ReadFDT(r)
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fdt, err := dt.ReadFDT(bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +77,7 @@ func ParseConfig(r io.ReadSeeker) ([]Image, error) {
 	cn, _ := configs.ListChildNodes()
 
 	for _, n := range cn {
-		i := Image{name: n, Root: fdt, ConfigOverride: n}
+		i := Image{name: n, Root: fdt, ConfigOverride: n, raw: b}
 
 		kn, in, err := i.LoadConfig()
 
@@ -121,6 +131,20 @@ func (i *Image) Load(opts ...boot.LoadOption) error {
 		Cmdline: i.Cmdline,
 	}
 
+	if i.PublicKeys != nil {
+		if err := i.VerifyConfig(i.PublicKeys...); err != nil {
+			return err
+		}
+		// Only the images of the configuration are verified.
+		kn, rn, err := i.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if i.Kernel != kn || i.InitRAMFS != rn {
+			return fmt.Errorf("kernel %q and initramfs %q are not those of the verified configuration, %q and %q", i.Kernel, i.InitRAMFS, kn, rn)
+		}
+	}
+
 	if i.KeyRing != nil {
 		kr, err := i.ReadSignedImage(i.Kernel, i.KeyRing)
 		if err != nil {
@@ -154,6 +178,19 @@ func (i *Image) Load(opts ...boot.LoadOption) error {
 	return loadImage(image, opts...)
 }
 
+// blob returns the FIT as read, or as serialized from Root if it was not
+// read by New or ParseConfig.
+func (i *Image) blob() ([]byte, error) {
+	if i.raw != nil {
+		return i.raw, nil
+	}
+	var b bytes.Buffer
+	if _, err := i.Root.Write(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 // ReadImage reads an image node from an FDT and returns the `data` contents.
 func (i *Image) ReadImage(image string) (*bytes.Reader, error) {
 	root := i.Root.Root().Walk("images").Walk(image)
@@ -6,6 +6,8 @@ package fit
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/dt"
 	"github.com/u-root/u-root/pkg/vfile"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -365,3 +368,40 @@ func TestRank(t *testing.T) {
 		t.Fatalf("Expected Image rank %d, got %d", testRank, l)
 	}
 }
+
+func TestRSASignaturePSS(t *testing.T) {
+	e, err := openpgp.NewEntity("u-root", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := e.PrivateKey.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		t.Fatalf("key is %T, want RSA", e.PrivateKey.PrivateKey)
+	}
+	data := []byte("the kernel")
+	value, err := sign(key, crypto.SHA256, true, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		padding string
+		ok      bool
+	}{
+		{"pss", true},
+		{"pkcs-1.5", false},
+	} {
+		n := dt.NewNode("signature-1", dt.WithProperty(
+			dt.PropertyString("algo", "sha256,rsa2048"),
+			dt.PropertyString("padding", tt.padding),
+			dt.Property{Name: "value", Value: value},
+		))
+		sigs, err := parseSignatures(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sigs[0].Verify(data, openpgp.EntityList{e}); (err == nil) != tt.ok {
+			t.Errorf("Verify with padding %s = %v, want ok %t", tt.padding, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/dt"
+	"github.com/u-root/u-root/pkg/vfile"
+)
+
+// U-Boot verified boot signs configurations. A signature covers the
+// structure of the FIT for the nodes listed in its hashed-nodes property,
+// except image data, and the strings block. Image data is covered by the
+// hash nodes of the images, which are among the hashed nodes.
+//
+// See doc/usage/fit/signature.rst in U-Boot.
+
+var (
+	errNoHashNode     = errors.New("no hash node")
+	errBadFDT         = errors.New("malformed FDT structure")
+	errNotHashed      = errors.New("node is not covered by the signature")
+	errUnknownAlgo    = errors.New("unsupported algorithm")
+	errNoSignature    = errors.New("no valid signature")
+	errUnsupportedKey = errors.New("unsupported key type")
+	errNoSecureHash   = errors.New("no signed sha hash node")
+)
+
+// excludedProps are never part of signed configuration data.
+var excludedProps = []string{"data", "data-size", "data-position", "data-offset"}
+
+// hashAlgos maps algo properties of hash nodes to hash functions.
+var hashAlgos = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    crypto.MD5.New,
+	"sha1":   crypto.SHA1.New,
+	"sha256": crypto.SHA256.New,
+	"sha384": crypto.SHA384.New,
+	"sha512": crypto.SHA512.New,
+}
+
+// secureHashes are the hash algorithms that make the image data part of a
+// signed configuration. crc32 and md5 only detect corruption.
+var secureHashes = []string{"sha1", "sha256", "sha384", "sha512"}
+
+// hashData returns the value of a hash node with algo for data.
+func hashData(algo string, data []byte) ([]byte, error) {
+	h, ok := hashAlgos[algo]
+	if !ok {
+		return nil, fmt.Errorf("%w: hash %q", errUnknownAlgo, algo)
+	}
+	hh := h()
+	hh.Write(data)
+	return hh.Sum(nil), nil
+}
+
+// regionData returns the data U-Boot hashes for a signature covering nodes:
+// the struct block tags of those nodes and their properties, the tags of
+// their children without properties, and finally the strings block section
+// [strOff, strOff+strSize). Parents are only covered if they are listed too,
+// as mkimage lists "/". This follows fdt_find_regions in U-Boot's libfdt.
+func regionData(blob []byte, nodes []string, strOff, strSize uint32) ([]byte, error) {
+	var h dt.Header
+	if err := binary.Read(bytes.NewReader(blob), binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Magic != dt.Magic || uint64(h.OffDtStruct)+uint64(h.SizeDtStruct) > uint64(len(blob)) ||
+		uint64(h.OffDtStrings)+uint64(strOff)+uint64(strSize) > uint64(len(blob)) ||
+		strOff+strSize > h.SizeDtStrings {
+		return nil, errBadFDT
+	}
+	st := blob[h.OffDtStruct : h.OffDtStruct+h.SizeDtStruct]
+	strs := blob[h.OffDtStrings : h.OffDtStrings+h.SizeDtStrings]
+
+	var out []byte
+	var stack []int
+	want := 0
+	path := ""
+	for off := 0; ; {
+		if off+4 > len(st) {
+			return nil, errBadFDT
+		}
+		tag := binary.BigEndian.Uint32(st[off:])
+		next := off + 4
+		var include bool
+		switch tag {
+		case 1: // FDT_BEGIN_NODE
+			end := bytes.IndexByte(st[next:], 0)
+			if end < 0 {
+				return nil, errBadFDT
+			}
+			name := string(st[next : next+end])
+			next = (next + end + 1 + 3) &^ 3
+			switch {
+			case len(stack) == 0:
+				path = "/"
+			case path == "/":
+				path += name
+			default:
+				path += "/" + name
+			}
+			stack = append(stack, want)
+			if slices.Contains(nodes, path) {
+				want = 2
+			} else if want > 0 {
+				want--
+			}
+			include = want > 0
+		case 2: // FDT_END_NODE
+			if len(stack) == 0 {
+				return nil, errBadFDT
+			}
+			include = want > 0
+			want = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			path = path[:strings.LastIndexByte(path, '/')]
+			if path == "" && len(stack) > 0 {
+				path = "/"
+			}
+		case 3: // FDT_PROP
+			if next+8 > len(st) {
+				return nil, errBadFDT
+			}
+			size := binary.BigEndian.Uint32(st[next:])
+			nameOff := binary.BigEndian.Uint32(st[next+4:])
+			if uint64(next)+8+uint64(size) > uint64(len(st)) || nameOff >= uint32(len(strs)) {
+				return nil, errBadFDT
+			}
+			next = (next + 8 + int(size) + 3) &^ 3
+			name := strs[nameOff:]
+			name = name[:max(bytes.IndexByte(name, 0), 0)]
+			include = want >= 2 && !slices.Contains(excludedProps, string(name))
+		case 4: // FDT_NOP
+			include = want >= 2
+		case 9: // FDT_END
+			out = append(out, st[off:next]...)
+			return append(out, strs[strOff:strOff+strSize]...), nil
+		default:
+			return nil, errBadFDT
+		}
+		if next > len(st) {
+			return nil, errBadFDT
+		}
+		if include {
+			out = append(out, st[off:next]...)
+		}
+		off = next
+	}
+}
+
+// signatureAlgo returns the algo property of a signature made with key.
+func signatureAlgo(key crypto.PublicKey, h crypto.Hash) (string, error) {
+	var name string
+	switch h {
+	case crypto.SHA1:
+		name = "sha1"
+	case crypto.SHA256:
+		name = "sha256"
+	case crypto.SHA384:
+		name = "sha384"
+	case crypto.SHA512:
+		name = "sha512"
+	default:
+		return "", fmt.Errorf("%w: hash %v", errUnknownAlgo, h)
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("%s,rsa%d", name, k.N.BitLen()), nil
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("%s,ecdsa%d", name, k.Curve.Params().BitSize), nil
+	}
+	return "", fmt.Errorf("%w: %T", errUnsupportedKey, key)
+}
+
+// sign signs data like U-Boot: RSA signatures are PKCS #1 v1.5 or PSS with
+// the maximum salt length, ECDSA signatures are r and s, each the size of
+// the curve, big-endian.
+func sign(key crypto.Signer, h crypto.Hash, pss bool, data []byte) ([]byte, error) {
+	hh := h.New()
+	hh.Write(data)
+	digest := hh.Sum(nil)
+	switch k := key.Public().(type) {
+	case *rsa.PublicKey:
+		var opts crypto.SignerOpts = h
+		if pss {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: h}
+		}
+		return key.Sign(rand.Reader, digest, opts)
+	case *ecdsa.PublicKey:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", errUnsupportedKey, key)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest)
+		if err != nil {
+			return nil, err
+		}
+		n := (k.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*n)
+		r.FillBytes(sig[:n])
+		s.FillBytes(sig[n:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("%w: %T", errUnsupportedKey, key.Public())
+}
+
+// verify checks a signature made by sign with one of keys. algo is the algo
+// property of the signature node, e.g. "sha256,rsa2048" or
+// "sha256,ecdsa256", and padding its padding property.
+func verify(keys []crypto.PublicKey, algo, padding string, data, sig []byte) error {
+	h, err := parseHash(algo)
+	if err != nil {
+		return err
+	}
+	if !h.Available() {
+		return fmt.Errorf("%w: hash %v", errUnknownAlgo, h)
+	}
+	hh := h.New()
+	hh.Write(data)
+	digest := hh.Sum(nil)
+
+	for _, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			if !strings.Contains(algo, "rsa") {
+				continue
+			}
+			switch padding {
+			case "", "pkcs-1.5":
+				err = rsa.VerifyPKCS1v15(k, h, digest, sig)
+			case "pss":
+				err = rsa.VerifyPSS(k, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+			default:
+				return fmt.Errorf("%w: padding %q", errUnknownAlgo, padding)
+			}
+			if err == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			n := (k.Curve.Params().BitSize + 7) / 8
+			if !strings.Contains(algo, "ecdsa") || len(sig) != 2*n {
+				continue
+			}
+			r, s := new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])
+			if ecdsa.Verify(k, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return errNoSignature
+}
+
+// VerifyConfig verifies the configuration to boot, see GetConfigName,
+// against the U-Boot style signatures in its signature nodes, and the hashes
+// of the images it uses. One signature made by one of keys suffices. Like
+// U-Boot, it needs a signed sha hash node for each image.
+func (i *Image) VerifyConfig(keys ...crypto.PublicKey) error {
+	name, err := i.GetConfigName()
+	if err != nil {
+		return err
+	}
+	blob, err := i.blob()
+	if err != nil {
+		return err
+	}
+	config, err := i.Root.Root().Walk("configurations").Walk(name).Find(func(*dt.Node) bool { return true })
+	if err != nil {
+		return vfile.ErrUnsigned{Path: name, Err: err}
+	}
+	path := "/configurations/" + name
+
+	var hashed []string
+	err = errNoSignature
+	for _, n := range config.Children {
+		if !strings.HasPrefix(n.Name, "signature") {
+			continue
+		}
+		if hashed, err = verifyConfigSignature(n, blob, path, keys); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return vfile.ErrUnsigned{Path: name, Err: err}
+	}
+
+	// Now that the hashes of the images are trusted, check the images.
+	for _, p := range config.Properties {
+		switch p.Name {
+		case "kernel", "ramdisk", "fdt", "firmware", "loadables":
+		default:
+			continue
+		}
+		images, err := p.AsStringList()
+		if err != nil {
+			return err
+		}
+		for _, img := range images {
+			if !slices.Contains(hashed, "/images/"+img) {
+				return vfile.ErrUnsigned{Path: img, Err: errNotHashed}
+			}
+			if err := i.VerifyImageHashes(img); err != nil {
+				return err
+			}
+			if !i.signedHash(img, hashed) {
+				return vfile.ErrUnsigned{Path: img, Err: errNoSecureHash}
+			}
+		}
+	}
+	return nil
+}
+
+// signedHash reports whether image has a hash node with a secure algorithm
+// among the hashed nodes, which makes its data part of the signature.
+func (i *Image) signedHash(image string, hashed []string) bool {
+	n, err := i.Root.Root().Walk("images").Walk(image).Find(func(*dt.Node) bool { return true })
+	if err != nil {
+		return false
+	}
+	for _, h := range n.Children {
+		if !strings.HasPrefix(h.Name, "hash") || !slices.Contains(hashed, "/images/"+image+"/"+h.Name) {
+			continue
+		}
+		if algo, ok := h.LookProperty("algo"); ok {
+			if a, err := algo.AsString(); err == nil && slices.Contains(secureHashes, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyConfigSignature verifies one signature node of the configuration at
+// path and returns the nodes it covers.
+func verifyConfigSignature(n *dt.Node, blob []byte, path string, keys []crypto.PublicKey) ([]string, error) {
+	prop := func(name string) []byte {
+		p, ok := n.LookProperty(name)
+		if !ok {
+			return nil
+		}
+		return p.Value
+	}
+	value, algo := prop("value"), prop("algo")
+	if value == nil || algo == nil {
+		return nil, fmt.Errorf("%s: missing value or algo", n.Name)
+	}
+	nodesProp, ok := n.LookProperty("hashed-nodes")
+	if !ok {
+		return nil, fmt.Errorf("%s: missing hashed-nodes", n.Name)
+	}
+	nodes, err := nodesProp.AsStringList()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(nodes, path) {
+		return nil, fmt.Errorf("%s: %w: %s", n.Name, errNotHashed, path)
+	}
+	var strOff, strSize uint32
+	if s := prop("hashed-strings"); len(s) == 8 {
+		strOff, strSize = binary.BigEndian.Uint32(s), binary.BigEndian.Uint32(s[4:])
+	}
+	data, err := regionData(blob, nodes, strOff, strSize)
+	if err != nil {
+		return nil, err
+	}
+	padding := strings.TrimRight(string(prop("padding")), "\x00")
+	if err := verify(keys, strings.TrimRight(string(algo), "\x00"), padding, data, value); err != nil {
+		return nil, fmt.Errorf("%s: %w", n.Name, err)
+	}
+	return nodes, nil
+}
+
+// VerifyImageHashes checks the data of an image against all of its hash
+// nodes. At least one hash node is required.
+func (i *Image) VerifyImageHashes(image string) error {
+	root := i.Root.Root().Walk("images").Walk(image)
+	data, err := root.Property("data").AsBytes()
+	if err != nil {
+		return err
+	}
+	hashes, err := root.FindAll(func(n *dt.Node) bool {
+		return strings.HasPrefix(n.Name, "hash")
+	})
+	if err != nil || len(hashes) == 0 {
+		return vfile.ErrInvalidHash{Path: image, Err: errNoHashNode}
+	}
+	for _, n := range hashes {
+		algo, ok := n.LookProperty("algo")
+		if !ok {
+			return vfile.ErrInvalidHash{Path: image, Err: fmt.Errorf("%s: missing algo", n.Name)}
+		}
+		want, ok := n.LookProperty("value")
+		if !ok {
+			return vfile.ErrInvalidHash{Path: image, Err: fmt.Errorf("%s: missing value", n.Name)}
+		}
+		a, _ := algo.AsString()
+		got, err := hashData(a, data)
+		if err != nil {
+			return vfile.ErrInvalidHash{Path: image, Err: err}
+		}
+		if !bytes.Equal(got, want.Value) {
+			return vfile.ErrInvalidHash{Path: image, Err: vfile.ErrHashMismatch{Want: want.Value, Got: got}}
+		}
+	}
+	return nil
+}
@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 //
 // Performs signature checks on FDT images.
-// Currently supports PGP and raw PKCS1v15 RSA signatures.
+// Currently supports PGP and raw PKCS1v15 and PSS RSA signatures.
 //
 // Expected FDT Format:
 //  Node: images
@@ -12,6 +12,7 @@
 //   Node: signature*
 //    P: value
 //    P: algo          (ex. 'sha256,rsa4096', 'pgp')
+//    P: padding       (Optional, 'pkcs-1.5' or 'pss')
 //    P: signer-name   (Optional)
 //    P: key-name-hint (Optional)
 
@@ -64,10 +65,11 @@ type PGPSignature struct {
 	hint   string
 }
 
-// RSASignature implements a PKCS1v15 signature check.
+// RSASignature implements a PKCS1v15 or PSS signature check.
 type RSASignature struct {
 	name  string // Name of signature Node
 	hash  crypto.Hash
+	pss   bool
 	value []byte
 	// Optional description fields
 	signer string
@@ -109,7 +111,12 @@ func (s RSASignature) Verify(b []byte, ring openpgp.KeyRing) (*bytes.Reader, err
 	}
 
 	for _, key := range keys {
-		if err = rsa.VerifyPKCS1v15(key, s.hash, hashed, s.value); err == nil {
+		if s.pss {
+			err = rsa.VerifyPSS(key, s.hash, hashed, s.value, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(key, s.hash, hashed, s.value)
+		}
+		if err == nil {
 			return r, nil
 		}
 	}
@@ -175,7 +182,11 @@ func parseSignatures(n ...*dt.Node) ([]Signature, error) {
 				fmt.Printf("Skipping signature %s: %v", node.Name, err)
 				continue
 			}
-			sigs = append(sigs, RSASignature{value: v.Value, hash: hf, signer: signer, hint: hint})
+			pss := false
+			if p, ok := node.LookProperty("padding"); ok {
+				pss = strings.HasPrefix(string(p.Value), "pss")
+			}
+			sigs = append(sigs, RSASignature{value: v.Value, hash: hf, pss: pss, signer: signer, hint: hint})
 		}
 	}
 	if len(sigs) == 0 {
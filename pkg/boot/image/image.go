@@ -2,8 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package image contains a parser for Arm64 Linux Image format. It
-// assumes little endian arm.
+// Package image contains parsers for the Arm64 and RISC-V Linux Image formats
+// and the 32-bit arm zImage format. It assumes little endian kernels.
 package image
 
 import (
@@ -5,6 +5,8 @@
 package image
 
 import (
+	"encoding/binary"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
@@ -41,3 +43,118 @@ func TestParseFromBytes(t *testing.T) {
 		t.Errorf("got %+v, want %+v", got.Header, wantImage.Header)
 	}
 }
+
+func riscvImage(magic uint64, magic2 uint32, flags uint64) []byte {
+	b := make([]byte, 0x100)
+	binary.LittleEndian.PutUint64(b[0x10:], 0x1400000)
+	binary.LittleEndian.PutUint64(b[0x18:], flags)
+	binary.LittleEndian.PutUint32(b[0x20:], 0x2)
+	binary.LittleEndian.PutUint64(b[0x30:], magic)
+	binary.LittleEndian.PutUint32(b[0x38:], magic2)
+	return b
+}
+
+func TestParseRISCVFromBytes(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want RISCVHeader
+		err  error
+	}{
+		{
+			name: "version 0.2",
+			data: riscvImage(RISCVMagic, RISCVMagic2, 0),
+			want: RISCVHeader{ImageSize: 0x1400000, Version: 2, Magic: RISCVMagic, Magic2: RISCVMagic2},
+		},
+		{
+			name: "deprecated magic only",
+			data: riscvImage(RISCVMagic, 0, 0),
+			want: RISCVHeader{ImageSize: 0x1400000, Version: 2, Magic: RISCVMagic},
+		},
+		{
+			name: "arm64 Image",
+			data: riscvImage(0, Magic, 0),
+			err:  errBadMagic,
+		},
+		{
+			name: "big endian",
+			data: riscvImage(RISCVMagic, RISCVMagic2, 1),
+			err:  errBadEndianess,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRISCVFromBytes(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseRISCVFromBytes() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Header, tt.want) {
+				t.Errorf("got %+v, want %+v", got.Header, tt.want)
+			}
+		})
+	}
+}
+
+func zImage(magic, start, end, endian uint32, size int) []byte {
+	b := make([]byte, size)
+	binary.LittleEndian.PutUint32(b[0x24:], magic)
+	binary.LittleEndian.PutUint32(b[0x28:], start)
+	binary.LittleEndian.PutUint32(b[0x2c:], end)
+	binary.LittleEndian.PutUint32(b[0x30:], endian)
+	return b
+}
+
+func TestParseZImageFromBytes(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want ZImageHeader
+		err  error
+	}{
+		{
+			name: "little endian",
+			data: zImage(ZImageMagic, 0, 0x1000, ZImageLittleEndian, 0x1000),
+			want: ZImageHeader{Magic: ZImageMagic, End: 0x1000, Endian: ZImageLittleEndian},
+		},
+		{
+			name: "appended dtb",
+			data: zImage(ZImageMagic, 0, 0x800, ZImageLittleEndian, 0x1000),
+			want: ZImageHeader{Magic: ZImageMagic, End: 0x800, Endian: ZImageLittleEndian},
+		},
+		{
+			name: "no endianness flag",
+			data: zImage(ZImageMagic, 0, 0x1000, 0, 0x1000),
+			want: ZImageHeader{Magic: ZImageMagic, End: 0x1000},
+		},
+		{
+			name: "bad magic",
+			data: zImage(0, 0, 0x1000, ZImageLittleEndian, 0x1000),
+			err:  errBadMagic,
+		},
+		{
+			name: "big endian",
+			data: zImage(ZImageMagic, 0, 0x1000, zImageBigEndian, 0x1000),
+			err:  errBadEndianess,
+		},
+		{
+			name: "truncated",
+			data: zImage(ZImageMagic, 0, 0x2000, ZImageLittleEndian, 0x1000),
+			err:  errBadZImageSize,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseZImageFromBytes(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseZImageFromBytes() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Header, tt.want) {
+				t.Errorf("got %+v, want %+v", got.Header, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Magic values used in the arm zImage header.
+const (
+	ZImageMagic = 0x016f2818
+	// ZImageLittleEndian is the endianness flag of little endian
+	// kernels. Kernels before v3.0 have no flag.
+	ZImageLittleEndian = 0x04030201
+	zImageBigEndian    = 0x01020304
+)
+
+var errBadZImageSize = errors.New("zImage start and end are inconsistent with its size")
+
+// ZImageHeader is the header of a 32-bit arm zImage.
+type ZImageHeader struct {
+	Code   [9]uint32 `offset:"0x00"`
+	Magic  uint32    `offset:"0x24"`
+	Start  uint32    `offset:"0x28"`
+	End    uint32    `offset:"0x2c"`
+	Endian uint32    `offset:"0x30"`
+}
+
+// ZImage abstracts a 32-bit arm zImage.
+type ZImage struct {
+	Header ZImageHeader
+	Data   []byte
+}
+
+// ParseZImageFromBytes parses an arm zImage from bytes slice.
+func ParseZImageFromBytes(data []byte) (*ZImage, error) {
+	img := &ZImage{}
+
+	if err := binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &img.Header); err != nil {
+		return img, fmt.Errorf("unmarshaling zImage header: %w", err)
+	}
+
+	if img.Header.Magic != ZImageMagic {
+		return img, errBadMagic
+	}
+
+	if img.Header.Endian == zImageBigEndian {
+		return img, errBadEndianess
+	}
+
+	// The zImage is position independent; start and end are link
+	// addresses.
+	if img.Header.End < img.Header.Start || uint64(img.Header.End-img.Header.Start) > uint64(len(data)) {
+		return img, fmt.Errorf("%w: start %#x, end %#x, size %#x", errBadZImageSize, img.Header.Start, img.Header.End, len(data))
+	}
+
+	img.Data = data
+
+	return img, nil
+}
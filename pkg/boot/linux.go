@@ -231,7 +231,17 @@ func (li *LinuxImage) Load(opts ...LoadOption) error {
 		opt(loadOpts)
 	}
 
-	k, i, err := li.loadImage(loadOpts)
+	// Load what was verified, leaving li as it is.
+	img := *li
+	var err error
+	if img.Kernel, err = loadOpts.check("kernel", li.Kernel); err != nil {
+		return err
+	}
+	if img.Initrd, err = loadOpts.check("initrd", li.Initrd); err != nil {
+		return err
+	}
+
+	k, i, err := img.loadImage(loadOpts)
 	if err != nil {
 		return err
 	}
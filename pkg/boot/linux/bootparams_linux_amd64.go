@@ -0,0 +1,390 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/acpi"
+	"github.com/u-root/u-root/pkg/boot/bzimage"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/fb"
+)
+
+// Where the firmware information for the boot parameters comes from.
+// Tests point these elsewhere.
+var (
+	sysfsFirmware     = "/sys/firmware"
+	framebufferDevice = "/dev/fb0"
+	physicalMemory    = "/dev/mem"
+	getRSDPAddr       = func() (int64, error) {
+		rsdp, err := acpi.GetRSDP()
+		if err != nil {
+			return 0, err
+		}
+		return rsdp.RSDPAddr(), nil
+	}
+)
+
+// e820Entries converts a memory map into e820 entries.
+func e820Entries(mm kexec.MemoryMap) []bzimage.E820Entry {
+	var e []bzimage.E820Entry
+	for _, r := range mm {
+		entry := bzimage.E820Entry{
+			Addr:    uint64(r.Start),
+			Size:    uint64(r.Size),
+			MemType: bzimage.Reserved,
+		}
+		switch r.Type {
+		case kexec.RangeRAM:
+			entry.MemType = bzimage.RAM
+		case kexec.RangeACPI:
+			entry.MemType = bzimage.ACPI
+		case kexec.RangeNVS:
+			entry.MemType = bzimage.NVS
+		}
+		e = append(e, entry)
+	}
+	return e
+}
+
+// setScreenInfo describes a VESA or EFI framebuffer in lp, so that the next
+// kernel can keep using it. Other framebuffers are not passed on since
+// their drivers reinitialize the hardware anyway.
+func setScreenInfo(lp *bzimage.LinuxParams, fix *fb.FixScreenInfo, v *fb.VarScreenInfo) bool {
+	switch fix.Name() {
+	case "VESA VGA":
+		lp.OrigVideoIsVGA = bzimage.VideoTypeVLFB
+	case "EFI VGA":
+		lp.OrigVideoIsVGA = bzimage.VideoTypeEFI
+	default:
+		return false
+	}
+	lp.Lfbwidth = uint16(v.XRes)
+	lp.Lfbheight = uint16(v.YRes)
+	lp.Lfbdepth = uint16(v.BitsPerPixel)
+	lp.Lfbbase = uint32(fix.SmemStart)
+	lp.Lfblinelength = uint16(fix.LineLength)
+	// Lfbsize is in units of 64K.
+	lp.Lfbsize = (fix.SmemLen + 0xffff) >> 16
+	lp.Pages = uint16((fix.SmemLen + 0xfff) >> 12)
+	if v.BitsPerPixel > 8 {
+		lp.Redpos, lp.Redsize = uint8(v.Red.Offset), uint8(v.Red.Length)
+		lp.Greenpos, lp.Greensize = uint8(v.Green.Offset), uint8(v.Green.Length)
+		lp.Bluepos, lp.Bluesize = uint8(v.Blue.Offset), uint8(v.Blue.Length)
+		lp.Rsvdpos, lp.Rsvdsize = uint8(v.Transp.Offset), uint8(v.Transp.Length)
+	}
+	if hi := uint64(fix.SmemStart) >> 32; hi != 0 {
+		lp.ExtLfbbase = uint32(hi)
+		lp.Capabilities |= bzimage.VideoCapability64BitBase
+	}
+	return true
+}
+
+func readSysfsString(dir, name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	return strings.TrimSpace(string(b)), err
+}
+
+func readSysfsUint(dir, name string, bitSize int) (uint64, error) {
+	s, err := readSysfsString(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(s, 0, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", filepath.Join(dir, name), err)
+	}
+	return v, nil
+}
+
+var eddExtensions = map[string]uint16{
+	"Fixed disk access":           bzimage.EDDExtFixedDiskAccess,
+	"Device locking and ejecting": bzimage.EDDExtDeviceLockingAndEjecting,
+	"Enhanced Disk Drive support": bzimage.EDDExtEnhancedDiskDriveSupport,
+	"64-bit extensions":           bzimage.EDDExt64BitExtensions,
+}
+
+// readEDD reads the BIOS Enhanced Disk Drive information the kernel exports
+// in sysfs, e.g. /sys/firmware/edd/int13_dev80.
+func readEDD(dir string) ([]bzimage.EDDInfo, []uint32, error) {
+	devs, err := filepath.Glob(filepath.Join(dir, "int13_dev*"))
+	if err != nil {
+		return nil, nil, err
+	}
+	var infos []bzimage.EDDInfo
+	var sigs []uint32
+	for _, d := range devs {
+		dev, err := strconv.ParseUint(strings.TrimPrefix(filepath.Base(d), "int13_dev"), 16, 8)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", d, err)
+		}
+		if sig, err := readSysfsUint(d, "mbr_signature", 32); err == nil && len(sigs) < bzimage.EDDMBRSigMax {
+			sigs = append(sigs, uint32(sig))
+		}
+		if len(infos) == bzimage.EDDMaxNR {
+			continue
+		}
+		info := bzimage.EDDInfo{Device: uint8(dev)}
+		version, err := readSysfsUint(d, "version", 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Version = uint8(version)
+		// Version 0 is a dummy entry.
+		if version != 0 {
+			cyl, err := readSysfsUint(d, "legacy_max_cylinder", 16)
+			if err != nil {
+				return nil, nil, err
+			}
+			head, err := readSysfsUint(d, "legacy_max_head", 8)
+			if err != nil {
+				return nil, nil, err
+			}
+			sectors, err := readSysfsUint(d, "legacy_sectors_per_track", 8)
+			if err != nil {
+				return nil, nil, err
+			}
+			info.LegacyMaxCylinder = uint16(cyl)
+			info.LegacyMaxHead = uint8(head)
+			info.LegacySectorsPerTrace = uint8(sectors)
+
+			ext, err := readSysfsString(d, "extensions")
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, l := range strings.Split(ext, "\n") {
+				info.InterfaceSupport |= eddExtensions[strings.TrimSpace(l)]
+			}
+			raw, err := os.ReadFile(filepath.Join(d, "raw_data"))
+			if err != nil {
+				return nil, nil, err
+			}
+			copy(info.EDDDeviceParams[:], raw)
+		}
+		infos = append(infos, info)
+	}
+	return infos, sigs, nil
+}
+
+// efiFirmware is what a kexec'd kernel needs to use EFI runtime services.
+type efiFirmware struct {
+	setup  bzimage.EFISetupData
+	memmap []bzimage.EFIMemoryDescriptor
+}
+
+// efiRuntimeServicesData is the EFI memory type of the system table.
+const efiRuntimeServicesData = 6
+
+// readEFI reads the physical addresses of the EFI tables and the runtime
+// memory map from /sys/firmware/efi.
+func readEFI(dir string) (*efiFirmware, error) {
+	var e efiFirmware
+	var err error
+	if e.setup.FwVendor, err = readSysfsUint(dir, "fw_vendor", 64); err != nil {
+		return nil, err
+	}
+	if e.setup.Runtime, err = readSysfsUint(dir, "runtime", 64); err != nil {
+		return nil, err
+	}
+	if e.setup.Tables, err = readSysfsUint(dir, "config_table", 64); err != nil {
+		return nil, err
+	}
+	systab, err := readSysfsString(dir, "systab")
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range strings.Split(systab, "\n") {
+		if v, ok := strings.CutPrefix(l, "SMBIOS="); ok {
+			if e.setup.SMBIOS, err = strconv.ParseUint(v, 0, 64); err != nil {
+				return nil, fmt.Errorf("bad SMBIOS address %q: %w", v, err)
+			}
+		}
+	}
+
+	maps, err := os.ReadDir(filepath.Join(dir, "runtime-map"))
+	if err != nil {
+		return nil, err
+	}
+	e.memmap = make([]bzimage.EFIMemoryDescriptor, len(maps))
+	for _, m := range maps {
+		i, err := strconv.Atoi(m.Name())
+		if err != nil || i < 0 || i >= len(maps) {
+			return nil, fmt.Errorf("unexpected runtime map entry %q", m.Name())
+		}
+		d := filepath.Join(dir, "runtime-map", m.Name())
+		desc := &e.memmap[i]
+		typ, err := readSysfsUint(d, "type", 32)
+		if err != nil {
+			return nil, err
+		}
+		desc.Type = uint32(typ)
+		for _, f := range []struct {
+			name string
+			v    *uint64
+		}{
+			{"phys_addr", &desc.PhysAddr},
+			{"virt_addr", &desc.VirtAddr},
+			{"num_pages", &desc.NumPages},
+			{"attribute", &desc.Attribute},
+		} {
+			if *f.v, err = readSysfsUint(d, f.name, 64); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &e, nil
+}
+
+var errNoSystemTable = errors.New("EFI system table not found")
+
+// efiSystemTableSignature is "IBI SYST".
+const efiSystemTableSignature = 0x5453595320494249
+
+// findEFISystemTable searches the EFI runtime data regions for the EFI
+// system table.
+//
+// Linux does not export the system table's address, but it lives in runtime
+// services data and starts with a signature and a header checksum.
+func findEFISystemTable(mem io.ReaderAt, memmap []bzimage.EFIMemoryDescriptor) (uint64, error) {
+	const hdrSize = 24
+	for _, m := range memmap {
+		if m.Type != efiRuntimeServicesData {
+			continue
+		}
+		b := make([]byte, m.NumPages*4096)
+		if _, err := mem.ReadAt(b, int64(m.PhysAddr)); err != nil {
+			return 0, fmt.Errorf("reading EFI runtime data at %#x: %w", m.PhysAddr, err)
+		}
+		for off := 0; off+hdrSize <= len(b); off += 8 {
+			if binary.LittleEndian.Uint64(b[off:]) != efiSystemTableSignature {
+				continue
+			}
+			size := int(binary.LittleEndian.Uint32(b[off+12:]))
+			if size < hdrSize || off+size > len(b) {
+				continue
+			}
+			tbl := bytes.Clone(b[off : off+size])
+			sum := binary.LittleEndian.Uint32(tbl[16:])
+			binary.LittleEndian.PutUint32(tbl[16:], 0)
+			if crc32.ChecksumIEEE(tbl) == sum {
+				return m.PhysAddr + uint64(off), nil
+			}
+		}
+	}
+	return 0, errNoSystemTable
+}
+
+// findSystemTable searches physical memory for the EFI system table.
+func findSystemTable(e *efiFirmware) (uint64, error) {
+	f, err := os.Open(physicalMemory)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return findEFISystemTable(f, e.memmap)
+}
+
+// setEFI passes the EFI system table and runtime memory map on, loading the
+// memory map into kmem. It returns the SetupEFI node.
+func setEFI(lp *bzimage.LinuxParams, kmem *kexec.Memory, e *efiFirmware, systab uint64) (*bzimage.SetupData, error) {
+	var mm bytes.Buffer
+	if err := binary.Write(&mm, binary.LittleEndian, e.memmap); err != nil {
+		return nil, err
+	}
+	r, err := kmem.AddKexecSegment(mm.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("add EFI memory map segment: %w", err)
+	}
+	sd, err := e.setup.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	lp.EFIInfo = bzimage.EFIInfo{
+		LoaderSignature: bzimage.EFI64LoaderSignature,
+		Systab:          uint32(systab),
+		SystabHi:        uint32(systab >> 32),
+		MemDescSize:     uint32(binary.Size(bzimage.EFIMemoryDescriptor{})),
+		MemDescVersion:  bzimage.EFIMemoryDescriptorVersion,
+		Memmap:          uint32(r.Start),
+		MemmapHi:        uint32(uint64(r.Start) >> 32),
+		MemmapSize:      uint32(mm.Len()),
+	}
+	return &bzimage.SetupData{Type: bzimage.SetupEFI, Data: sd}, nil
+}
+
+// bootParams builds the boot parameters for the kernel with header hdr from
+// what the running kernel knows about the firmware: the e820 memory map in
+// kmem, the framebuffer, the ACPI RSDP, EDD and EFI.
+//
+// Information that is unavailable is left out. It returns the setup_data
+// nodes that have to be loaded along with the parameters.
+func bootParams(hdr *bzimage.LinuxHeader, kmem *kexec.Memory) (*bzimage.LinuxParams, []bzimage.SetupData, error) {
+	lp, err := bzimage.NewLinuxParams(hdr)
+	if err != nil {
+		return nil, nil, err
+	}
+	lp.LoaderType = bzimage.LoaderTypeUnknown
+
+	var setupData []bzimage.SetupData
+	if ext := lp.SetE820(e820Entries(kmem.Phys)); ext != nil {
+		setupData = append(setupData, *ext)
+	}
+
+	if fix, v, err := fb.GetScreenInfo(framebufferDevice); err != nil {
+		Debug("No framebuffer: %v", err)
+	} else if !setScreenInfo(lp, fix, v) {
+		Debug("Not passing on framebuffer %q", fix.Name())
+	}
+
+	if rsdp, err := getRSDPAddr(); err != nil {
+		Debug("No ACPI RSDP: %v", err)
+	} else {
+		lp.ACPIRSDPAddr = uint64(rsdp)
+	}
+
+	if infos, sigs, err := readEDD(filepath.Join(sysfsFirmware, "edd")); err != nil {
+		Debug("No EDD: %v", err)
+	} else if err := lp.SetEDD(infos, sigs); err != nil {
+		return nil, nil, err
+	}
+
+	if e, err := readEFI(filepath.Join(sysfsFirmware, "efi")); err != nil {
+		Debug("No EFI: %v", err)
+	} else if systab, err := findSystemTable(e); err != nil {
+		Debug("Not passing on EFI: %v", err)
+	} else {
+		sd, err := setEFI(lp, kmem, e, systab)
+		if err != nil {
+			return nil, nil, err
+		}
+		setupData = append(setupData, *sd)
+	}
+	return lp, setupData, nil
+}
+
+// addSetupData loads the setup_data list and points lp at it.
+func addSetupData(lp *bzimage.LinuxParams, kmem *kexec.Memory, nodes []bzimage.SetupData) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	r, err := kmem.FindSpace(uint(len(bzimage.MarshalSetupData(0, nodes))), 0)
+	if err != nil {
+		return err
+	}
+	kmem.Segments.Insert(kexec.NewSegment(bzimage.MarshalSetupData(uint64(r.Start), nodes), r))
+	lp.SetupData = uint64(r.Start)
+	return nil
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/boot/bzimage"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/fb"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// firmwareParams are the boot parameters that describe the firmware, as
+// opposed to the kernel and the boot loader.
+type firmwareParams struct {
+	E820       []bzimage.E820Entry
+	ScreenInfo []byte
+	RSDP       uint64
+	EFI        bzimage.EFIInfo
+	EDD        []bzimage.EDDInfo
+	MBRSigs    []uint32
+}
+
+func toFirmwareParams(t *testing.T, lp *bzimage.LinuxParams) firmwareParams {
+	t.Helper()
+	b, err := lp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return firmwareParams{
+		E820:       normalizeE820(lp.E820Map[:lp.E820MapNr]),
+		ScreenInfo: b[:0x40],
+		RSDP:       lp.ACPIRSDPAddr,
+		EFI:        lp.EFIInfo,
+		EDD:        lp.EDDBuf[:lp.EDDBufNr],
+		MBRSigs:    lp.EDDMBRSigBuffer[:lp.EDDMBRSigBufNr],
+	}
+}
+
+// normalizeE820 sorts e820 entries and merges overlapping and adjacent
+// entries of the same type, as firmware e820 tables are often neither
+// sorted nor minimal while /sys/firmware/memmap is.
+func normalizeE820(entries []bzimage.E820Entry) []bzimage.E820Entry {
+	e := append([]bzimage.E820Entry(nil), entries...)
+	sort.Slice(e, func(i, j int) bool { return e[i].Addr < e[j].Addr })
+	var out []bzimage.E820Entry
+	for _, entry := range e {
+		if n := len(out); n > 0 {
+			last := &out[n-1]
+			if last.MemType == entry.MemType && entry.Addr <= last.Addr+last.Size {
+				last.Size = max(last.Size, entry.Addr+entry.Size-last.Addr)
+				continue
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// efiMemory returns physical memory with a broken and a valid EFI system
+// table in the runtime data page at 0x1000. The valid one is at 0x1018.
+func efiMemory() []byte {
+	mem := make([]byte, 0x2000)
+	for _, off := range []int{0x1000, 0x1018} {
+		tbl := mem[off : off+0x78]
+		binary.LittleEndian.PutUint64(tbl, efiSystemTableSignature)
+		binary.LittleEndian.PutUint32(tbl[8:], 0x2003c)
+		binary.LittleEndian.PutUint32(tbl[12:], 0x78)
+	}
+	binary.LittleEndian.PutUint32(mem[0x1018+16:], crc32.ChecksumIEEE(mem[0x1018:0x1018+0x78]))
+	return mem
+}
+
+func TestBootParams(t *testing.T) {
+	kernel := readFile(t, "../bzimage/testdata/bzImage")
+	var bzimg bzimage.BzImage
+	if err := bzimg.UnmarshalBinary(kernel); err != nil {
+		t.Fatal(err)
+	}
+
+	efiSetup := bzimage.EFISetupData{
+		FwVendor: 0x7f6ed018,
+		Runtime:  0x7f6ecb98,
+		Tables:   0x7f6eda98,
+		SMBIOS:   0x7f52d000,
+	}
+	efiSetupData, err := efiSetup.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		// captured are boot_params captured from
+		// /sys/kernel/boot_params/data of a running system.
+		captured string
+		want     firmwareParams
+		// files of /sys/firmware.
+		files     map[string]string
+		mem       []byte
+		rsdp      int64
+		mm        kexec.MemoryMap
+		wantSetup []bzimage.SetupData
+	}{
+		{
+			name:     "firecracker",
+			captured: "testdata/bootparams/firecracker/boot_params",
+			mm: kexec.MemoryMap{
+				{Range: kexec.RangeFromInterval(0, 0x9fc00), Type: kexec.RangeRAM},
+				{Range: kexec.RangeFromInterval(0x9fc00, 0x100000), Type: kexec.RangeReserved},
+				{Range: kexec.RangeFromInterval(0x100000, 0xc0000000), Type: kexec.RangeRAM},
+				{Range: kexec.RangeFromInterval(0xeec00000, 0xfec00000), Type: kexec.RangeReserved},
+				{Range: kexec.RangeFromInterval(0x100000000, 0x1c0000000), Type: kexec.RangeRAM},
+			},
+		},
+		{
+			name: "efi and edd",
+			files: map[string]string{
+				"efi/fw_vendor":                            "0x7f6ed018\n",
+				"efi/runtime":                              "0x7f6ecb98\n",
+				"efi/config_table":                         "0x7f6eda98\n",
+				"efi/systab":                               "ACPI20=0x7f77e014\nACPI=0x7f77e000\nSMBIOS=0x7f52d000\n",
+				"efi/runtime-map/0/type":                   "0x6\n",
+				"efi/runtime-map/0/phys_addr":              "0x1000\n",
+				"efi/runtime-map/0/virt_addr":              "0xfffffffeffe00000\n",
+				"efi/runtime-map/0/num_pages":              "0x1\n",
+				"efi/runtime-map/0/attribute":              "0x800000000000000f\n",
+				"efi/runtime-map/1/type":                   "0x5\n",
+				"efi/runtime-map/1/phys_addr":              "0x3000\n",
+				"efi/runtime-map/1/virt_addr":              "0xfffffffeffe01000\n",
+				"efi/runtime-map/1/num_pages":              "0x2\n",
+				"efi/runtime-map/1/attribute":              "0x800000000000000f\n",
+				"edd/int13_dev80/mbr_signature":            "0x12345678\n",
+				"edd/int13_dev80/version":                  "0x30\n",
+				"edd/int13_dev80/legacy_max_cylinder":      "1023\n",
+				"edd/int13_dev80/legacy_max_head":          "254\n",
+				"edd/int13_dev80/legacy_sectors_per_track": "63\n",
+				"edd/int13_dev80/extensions":               "Fixed disk access\nEnhanced Disk Drive support\n",
+				"edd/int13_dev80/raw_data":                 "\x1e\x00\x02\x00",
+				"edd/int13_dev81/mbr_signature":            "0xabcd\n",
+				"edd/int13_dev81/version":                  "0x0\n",
+			},
+			mem:  efiMemory(),
+			rsdp: 0x7f77e014,
+			mm: kexec.MemoryMap{
+				{Range: kexec.RangeFromInterval(0, 0xa0000), Type: kexec.RangeRAM},
+				{Range: kexec.RangeFromInterval(0x100000, 0x7f000000), Type: kexec.RangeRAM},
+				{Range: kexec.RangeFromInterval(0x7f000000, 0x7f700000), Type: kexec.RangeReserved},
+				{Range: kexec.RangeFromInterval(0x7f700000, 0x7f780000), Type: kexec.RangeACPI},
+				{Range: kexec.RangeFromInterval(0x7f780000, 0x7f800000), Type: kexec.RangeNVS},
+			},
+			want: firmwareParams{
+				E820: []bzimage.E820Entry{
+					{Addr: 0, Size: 0xa0000, MemType: bzimage.RAM},
+					{Addr: 0x100000, Size: 0x7ef00000, MemType: bzimage.RAM},
+					{Addr: 0x7f000000, Size: 0x700000, MemType: bzimage.Reserved},
+					{Addr: 0x7f700000, Size: 0x80000, MemType: bzimage.ACPI},
+					{Addr: 0x7f780000, Size: 0x80000, MemType: bzimage.NVS},
+				},
+				ScreenInfo: make([]byte, 0x40),
+				RSDP:       0x7f77e014,
+				EFI: bzimage.EFIInfo{
+					LoaderSignature: bzimage.EFI64LoaderSignature,
+					Systab:          0x1018,
+					MemDescSize:     40,
+					MemDescVersion:  1,
+					// The first free page above 1M.
+					Memmap:     0x100000,
+					MemmapSize: 80,
+				},
+				EDD: []bzimage.EDDInfo{
+					{
+						Device:                0x80,
+						Version:               0x30,
+						InterfaceSupport:      bzimage.EDDExtFixedDiskAccess | bzimage.EDDExtEnhancedDiskDriveSupport,
+						LegacyMaxCylinder:     1023,
+						LegacyMaxHead:         254,
+						LegacySectorsPerTrace: 63,
+						EDDDeviceParams:       [bzimage.EDDDeviceParamSize]uint8{0x1e, 0, 2, 0},
+					},
+					{Device: 0x81},
+				},
+				MBRSigs: []uint32{0x12345678, 0xabcd},
+			},
+			wantSetup: []bzimage.SetupData{
+				{Type: bzimage.SetupEFI, Data: efiSetupData},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, filepath.Join(dir, "firmware"), tt.files)
+			memPath := filepath.Join(dir, "mem")
+			if err := os.WriteFile(memPath, tt.mem, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			defer func(s, f, m string, r func() (int64, error)) {
+				sysfsFirmware, framebufferDevice, physicalMemory, getRSDPAddr = s, f, m, r
+			}(sysfsFirmware, framebufferDevice, physicalMemory, getRSDPAddr)
+			sysfsFirmware = filepath.Join(dir, "firmware")
+			framebufferDevice = filepath.Join(dir, "fb0")
+			physicalMemory = memPath
+			getRSDPAddr = func() (int64, error) {
+				if tt.rsdp == 0 {
+					return 0, errors.New("no RSDP")
+				}
+				return tt.rsdp, nil
+			}
+
+			want := tt.want
+			if tt.captured != "" {
+				var captured bzimage.LinuxParams
+				if err := captured.UnmarshalBinary(readFile(t, tt.captured)); err != nil {
+					t.Fatal(err)
+				}
+				want = toFirmwareParams(t, &captured)
+			}
+
+			lp, setupData, err := bootParams(&bzimg.Header, &kexec.Memory{Phys: tt.mm})
+			if err != nil {
+				t.Fatalf("bootParams() = %v", err)
+			}
+			if diff := cmp.Diff(want, toFirmwareParams(t, lp)); diff != "" {
+				t.Errorf("bootParams() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantSetup, setupData); diff != "" {
+				t.Errorf("bootParams() setup_data mismatch (-want +got):\n%s", diff)
+			}
+			if lp.LoaderType != bzimage.LoaderTypeUnknown {
+				t.Errorf("LoaderType = %#x, want %#x", lp.LoaderType, bzimage.LoaderTypeUnknown)
+			}
+			if lp.Paramblockversion != bzimg.Header.Protocolversion || lp.KernelAlignment != bzimg.Header.Kernelalignment {
+				t.Errorf("bootParams() did not copy the kernel's setup header")
+			}
+		})
+	}
+}
+
+func TestSetScreenInfo(t *testing.T) {
+	rgb := fb.VarScreenInfo{
+		XRes:         1024,
+		YRes:         768,
+		BitsPerPixel: 32,
+		Red:          fb.Bitfield{Offset: 16, Length: 8},
+		Green:        fb.Bitfield{Offset: 8, Length: 8},
+		Blue:         fb.Bitfield{Offset: 0, Length: 8},
+		Transp:       fb.Bitfield{Offset: 24, Length: 8},
+	}
+	for _, tt := range []struct {
+		name string
+		id   string
+		base uint
+		want *bzimage.LinuxParams
+	}{
+		{
+			name: "efifb",
+			id:   "EFI VGA",
+			base: 0x80000000,
+			want: &bzimage.LinuxParams{
+				OrigVideoIsVGA: bzimage.VideoTypeEFI,
+				Lfbwidth:       1024,
+				Lfbheight:      768,
+				Lfbdepth:       32,
+				Lfbbase:        0x80000000,
+				Lfbsize:        48,
+				Lfblinelength:  4096,
+				Redpos:         16,
+				Redsize:        8,
+				Greenpos:       8,
+				Greensize:      8,
+				Bluesize:       8,
+				Rsvdpos:        24,
+				Rsvdsize:       8,
+				Pages:          768,
+			},
+		},
+		{
+			name: "vesafb above 4G",
+			id:   "VESA VGA",
+			base: 0x4000000000,
+			want: &bzimage.LinuxParams{
+				OrigVideoIsVGA: bzimage.VideoTypeVLFB,
+				Lfbwidth:       1024,
+				Lfbheight:      768,
+				Lfbdepth:       32,
+				Lfbsize:        48,
+				Lfblinelength:  4096,
+				Redpos:         16,
+				Redsize:        8,
+				Greenpos:       8,
+				Greensize:      8,
+				Bluesize:       8,
+				Rsvdpos:        24,
+				Rsvdsize:       8,
+				Pages:          768,
+				Capabilities:   bzimage.VideoCapability64BitBase,
+				ExtLfbbase:     0x40,
+			},
+		},
+		{
+			name: "drm",
+			id:   "virtio_gpudrmfb",
+			base: 0x80000000,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fix := fb.FixScreenInfo{SmemStart: tt.base, SmemLen: 1024 * 768 * 4, LineLength: 4096}
+			copy(fix.ID[:], tt.id)
+
+			var lp bzimage.LinuxParams
+			ok := setScreenInfo(&lp, &fix, &rgb)
+			if ok != (tt.want != nil) {
+				t.Fatalf("setScreenInfo() = %t, want %t", ok, tt.want != nil)
+			}
+			if tt.want == nil {
+				tt.want = &bzimage.LinuxParams{}
+			}
+			if diff := cmp.Diff(tt.want, &lp); diff != "" {
+				t.Errorf("setScreenInfo() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -17,10 +17,6 @@ import (
 	"github.com/u-root/uio/uio"
 )
 
-const (
-	bootParams = "/sys/kernel/boot_params/data"
-)
-
 // KexecLoad loads a bzImage-formated Linux kernel file as the to-be-kexeced
 // kernel with the given ramfs file and cmdline string.
 //
@@ -38,20 +34,6 @@ func KexecLoad(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservat
 	// It has routines to work with physical memory
 	// ranges.
 	var kmem *kexec.Memory
-	// TODO(10000TB): construct default params in go.
-	//
-	// boot_params directory is x86 specific. So for now, following code only
-	// works on x86.
-	// https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-kernel-boot_params
-	bp, err := os.ReadFile("/sys/kernel/boot_params/data")
-	if err != nil {
-		return fmt.Errorf("reading boot_param data: %w", err)
-	}
-	var lp = &bzimage.LinuxParams{}
-	if err := lp.UnmarshalBinary(bp); err != nil {
-		return fmt.Errorf("unmarshaling header: %w", err)
-	}
-
 	kb, err := uio.ReadAll(kernel)
 	if err != nil {
 		return fmt.Errorf("reading Linux kernel into memory: %w", err)
@@ -101,6 +83,11 @@ func KexecLoad(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservat
 		return fmt.Errorf("loading kernel ELF segments: %w", err)
 	}
 
+	lp, setupData, err := bootParams(&bzimg.Header, kmem)
+	if err != nil {
+		return fmt.Errorf("building boot params: %w", err)
+	}
+
 	var ramfsRange kexec.Range
 	if ramfs != nil {
 		ramfsContents, cleanup, err := getFile(ramfs)
@@ -136,6 +123,10 @@ func KexecLoad(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservat
 		lp.CmdLineSize = uint32(cmdlineRange.Size) // 2.06+
 	}
 
+	if err := addSetupData(lp, kmem, setupData); err != nil {
+		return fmt.Errorf("add setup_data segment: %w", err)
+	}
+
 	// The kernel is a bzImage kernel if the protocol >= 2.00 and the 0x01
 	// bit (LOAD_HIGH) in the loadflags field is set.
 	// TODO(10000TB): check on loadflags.
@@ -55,7 +55,9 @@ func sanitizeFDT(fdt *dt.FDT) (*dt.Node, error) {
 
 var ErrMemmapEmpty = errors.New("memory map is empty or contains no information about system RAM")
 
-func kexecLoadImage(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservedRanges kexec.Ranges) (*kimage, error) {
+// readFDTMemoryMap reads the device tree to pass on, dtb if given or the
+// current one otherwise, and the memory map it describes.
+func readFDTMemoryMap(dtb io.ReaderAt, reservedRanges kexec.Ranges) (*dt.FDT, kexec.MemoryMap, error) {
 	var fdt *dt.FDT
 	var err error
 	// We want to fail when a user-supplied FDT is not parseable, not
@@ -66,7 +68,7 @@ func kexecLoadImage(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, res
 		fdt, err = dt.ReadFile("/sys/firmware/fdt")
 	}
 	if err != nil {
-		return nil, fmt.Errorf("Read FDT = %w", err)
+		return nil, nil, fmt.Errorf("Read FDT = %w", err)
 	}
 	Debug("Loaded FDT: %s", fdt)
 
@@ -74,15 +76,23 @@ func kexecLoadImage(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, res
 	Debug("Try parsing memory map...")
 	mm, err := kexec.MemoryMapFromFDT(fdt)
 	if err != nil {
-		return nil, fmt.Errorf("MemoryMapFromFDT(%v): %w", fdt, err)
+		return nil, nil, fmt.Errorf("MemoryMapFromFDT(%v): %w", fdt, err)
 	}
 	Debug("Mem map: \n%+v", mm)
 	if len(mm.RAM()) == 0 {
-		return nil, ErrMemmapEmpty
+		return nil, nil, ErrMemmapEmpty
 	}
 	for _, r := range reservedRanges {
 		mm.Insert(kexec.TypedRange{Range: r, Type: kexec.RangeReserved})
 	}
+	return fdt, mm, nil
+}
+
+func kexecLoadImage(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservedRanges kexec.Ranges) (*kimage, error) {
+	fdt, mm, err := readFDTMemoryMap(dtb, reservedRanges)
+	if err != nil {
+		return nil, err
+	}
 	return kexecLoadImageMM(mm, kernel, ramfs, fdt, cmdline)
 }
 
@@ -93,55 +103,20 @@ var (
 	errTrampolineSegmentFailed = errors.New("failed to add trampolineSegment")
 )
 
-func kexecLoadImageMM(mm kexec.MemoryMap, kernel, ramfs *os.File, fdt *dt.FDT, cmdline string) (*kimage, error) {
-	kmem := &kexec.Memory{
-		Phys: mm,
-	}
-
-	img := &kimage{}
-
-	// Load kernel.
-	kernelBuf, cleanup, err := getFile(kernel)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kernel contents: %w", err)
-	}
-	img.cleanup = append(img.cleanup, cleanup)
-
-	kImage, err := image.ParseFromBytes(kernelBuf)
-	if err != nil {
-		return nil, fmt.Errorf("parse arm64 Image from bytes: %w", err)
-	}
-
-	// "The Image must be placed text_offset bytes from a 2MB aligned base
-	// address anywhere in usable system RAM and called there."
-	// (arm64/booting.rst)
-	//
-	// "At least image_size bytes from the start of the image must be free
-	// for use by the kernel." (arm64/booting.rst)
-	//
-	// TODO: support versions below v4.6?
-	//
-	// "NOTE: versions prior to v4.6 cannot make use of memory below the
-	// physical offset of the Image so it is recommended that the Image be
-	// placed as close as possible to the start of system RAM."
-	// (arm64/booting.rst)
-	kernelRange, err := kmem.AddKexecSegmentExplicit(kernelBuf, uint(kImage.Header.ImageSize), uint(kImage.Header.TextOffset), kernelAlignSize)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", errKernelSegmentFailed, err)
-	}
-
-	Debug("Added %#x byte (size %#x) kernel at %s with offset %#x with alignment %#x", len(kernelBuf), kImage.Header.ImageSize, kernelRange, kImage.Header.TextOffset, kernelAlignSize)
-
+// addBootParams points the /chosen node of fdt at the initramfs and cmdline
+// and loads both the initramfs and the device tree. It returns where the
+// device tree was loaded.
+func (img *kimage) addBootParams(kmem *kexec.Memory, fdt *dt.FDT, ramfs *os.File, cmdline string) (kexec.Range, error) {
 	chosen, err := sanitizeFDT(fdt)
 	if err != nil {
-		return nil, fmt.Errorf("sanitizeFDT(%v) = %w", fdt, err)
+		return kexec.Range{}, fmt.Errorf("sanitizeFDT(%v) = %w", fdt, err)
 	}
 	Debug("FDT after sanitization: %s", fdt)
 
 	if ramfs != nil {
 		ramfsBuf, cleanup, err := getFile(ramfs)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get initramfs contents: %w", err)
+			return kexec.Range{}, fmt.Errorf("failed to get initramfs contents: %w", err)
 		}
 		img.cleanup = append(img.cleanup, cleanup)
 
@@ -153,7 +128,7 @@ func kexecLoadImageMM(mm kexec.MemoryMap, kernel, ramfs *os.File, fdt *dt.FDT, c
 		// Image as well." (arm64/booting.rst)
 		ramfsRange, err := kmem.AddKexecSegment(ramfsBuf)
 		if err != nil {
-			return nil, fmt.Errorf("%w: %w", errInitramfsSegmentFailed, err)
+			return kexec.Range{}, fmt.Errorf("%w: %w", errInitramfsSegmentFailed, err)
 		}
 		Debug("Added %d byte initramfs at %s", len(ramfsBuf), ramfsRange)
 
@@ -175,15 +150,62 @@ func kexecLoadImageMM(mm kexec.MemoryMap, kernel, ramfs *os.File, fdt *dt.FDT, c
 
 	var dtbBuffer bytes.Buffer
 	if _, err := fdt.Write(&dtbBuffer); err != nil {
-		return nil, fmt.Errorf("flattening device tree: %v", err)
+		return kexec.Range{}, fmt.Errorf("flattening device tree: %v", err)
 	}
 	dtbBuf := dtbBuffer.Bytes()
 	dtbRange, err := kmem.AddKexecSegment(dtbBuf)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", errDTBSegmentFailed, err)
+		return kexec.Range{}, fmt.Errorf("%w: %w", errDTBSegmentFailed, err)
 	}
 	Debug("Added %d byte device tree at %s", len(dtbBuf), dtbRange)
 
+	return dtbRange, nil
+}
+
+func kexecLoadImageMM(mm kexec.MemoryMap, kernel, ramfs *os.File, fdt *dt.FDT, cmdline string) (*kimage, error) {
+	kmem := &kexec.Memory{
+		Phys: mm,
+	}
+
+	img := &kimage{}
+
+	// Load kernel.
+	kernelBuf, cleanup, err := getFile(kernel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kernel contents: %w", err)
+	}
+	img.cleanup = append(img.cleanup, cleanup)
+
+	kImage, err := image.ParseFromBytes(kernelBuf)
+	if err != nil {
+		return nil, fmt.Errorf("parse arm64 Image from bytes: %w", err)
+	}
+
+	// "The Image must be placed text_offset bytes from a 2MB aligned base
+	// address anywhere in usable system RAM and called there."
+	// (arm64/booting.rst)
+	//
+	// "At least image_size bytes from the start of the image must be free
+	// for use by the kernel." (arm64/booting.rst)
+	//
+	// TODO: support versions below v4.6?
+	//
+	// "NOTE: versions prior to v4.6 cannot make use of memory below the
+	// physical offset of the Image so it is recommended that the Image be
+	// placed as close as possible to the start of system RAM."
+	// (arm64/booting.rst)
+	kernelRange, err := kmem.AddKexecSegmentExplicit(kernelBuf, uint(kImage.Header.ImageSize), uint(kImage.Header.TextOffset), kernelAlignSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errKernelSegmentFailed, err)
+	}
+
+	Debug("Added %#x byte (size %#x) kernel at %s with offset %#x with alignment %#x", len(kernelBuf), kImage.Header.ImageSize, kernelRange, kImage.Header.TextOffset, kernelAlignSize)
+
+	dtbRange, err := img.addBootParams(kmem, fdt, ramfs, cmdline)
+	if err != nil {
+		return nil, err
+	}
+
 	// Trampoline.
 	//
 	// We need a trampoline to pass the DTB to the kernel; because
@@ -0,0 +1,63 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/u-root/u-root/pkg/boot/image"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+func kexecLoadRISCVImage(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservedRanges kexec.Ranges) (*kimage, error) {
+	fdt, mm, err := readFDTMemoryMap(dtb, reservedRanges)
+	if err != nil {
+		return nil, err
+	}
+	return kexecLoadRISCVImageMM(mm, kernel, ramfs, fdt, cmdline)
+}
+
+func kexecLoadRISCVImageMM(mm kexec.MemoryMap, kernel, ramfs *os.File, fdt *dt.FDT, cmdline string) (*kimage, error) {
+	kmem := &kexec.Memory{
+		Phys: mm,
+	}
+
+	img := &kimage{}
+
+	// Load kernel.
+	kernelBuf, cleanup, err := getFile(kernel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kernel contents: %w", err)
+	}
+	img.cleanup = append(img.cleanup, cleanup)
+
+	kImage, err := image.ParseRISCVFromBytes(kernelBuf)
+	if err != nil {
+		return nil, fmt.Errorf("parse riscv Image from bytes: %w", err)
+	}
+
+	// "The RISC-V kernel expects to be placed at a PMD boundary (2MB
+	// aligned for rv64 and 4MB aligned for rv32)." (riscv/boot.rst)
+	kernelRange, err := kmem.AddKexecSegmentExplicit(kernelBuf, uint(kImage.Header.ImageSize), uint(kImage.Header.TextOffset), kernelAlignSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errKernelSegmentFailed, err)
+	}
+	Debug("Added %#x byte (size %#x) kernel at %s with offset %#x with alignment %#x", len(kernelBuf), kImage.Header.ImageSize, kernelRange, kImage.Header.TextOffset, kernelAlignSize)
+
+	if _, err := img.addBootParams(kmem, fdt, ramfs, cmdline); err != nil {
+		return nil, err
+	}
+
+	// No trampoline is needed: the kernel finds the device tree among
+	// the segments and enters the new kernel with the hart ID in a0 and
+	// the device tree in a1.
+	img.entry = kernelRange.Start
+	img.segments = kmem.Segments
+	Debug("Entry: %#x", img.entry)
+	return img, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/image"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+// riscvImage returns a RISC-V Image that needs imageSize bytes of memory.
+func riscvImage(imageSize uint64) []byte {
+	b := make([]byte, 0x1000)
+	binary.LittleEndian.PutUint64(b[0x10:], imageSize)
+	binary.LittleEndian.PutUint32(b[0x20:], 0x2)
+	binary.LittleEndian.PutUint64(b[0x30:], image.RISCVMagic)
+	binary.LittleEndian.PutUint32(b[0x38:], image.RISCVMagic2)
+	return b
+}
+
+func TestKexecLoadRISCVImage(t *testing.T) {
+	Debug = t.Logf
+
+	kernel := riscvImage(0x1400000)
+	memory := dt.NewNode("memory@80000000", dt.WithProperty(
+		dt.PropertyString("device_type", "memory"),
+		dt.PropertyRegion("reg", 0x80000000, 0x4000000),
+	))
+
+	for _, tt := range []struct {
+		name string
+
+		// Inputs
+		kernel       *os.File
+		ramfs        *os.File
+		fdt          io.ReaderAt
+		cmdline      string
+		reservations kexec.Ranges
+
+		// Results
+		segments kexec.Segments
+		entry    uintptr
+		errs     []error
+	}{
+		{
+			name:    "load-initramfs-and-cmdline",
+			kernel:  createFile(t, kernel),
+			ramfs:   createFile(t, []byte("ramfs")),
+			cmdline: "console=ttyS0",
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen", dt.WithProperty(
+					dt.PropertyString("bootargs", "ohno"),
+					dt.PropertyU64("kaslr-seed", 1),
+				)),
+				memory,
+			))}),
+			entry: 0x80000000,
+			segments: kexec.Segments{
+				kexec.NewSegment(kernel, kexec.Range{Start: 0x80000000, Size: 0x1400000}),
+				kexec.NewSegment([]byte("ramfs"), kexec.Range{Start: 0x81400000, Size: 0x1000}),
+				kexec.NewSegment(fdtBytes(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+					dt.NewNode("chosen", dt.WithProperty(
+						dt.PropertyString("bootargs", "console=ttyS0"),
+						dt.PropertyU64("linux,initrd-start", 0x81400000),
+						dt.PropertyU64("linux,initrd-end", 0x81401000),
+					)),
+					memory,
+				))}), kexec.Range{Start: 0x81401000, Size: 0x1000}),
+			},
+		},
+		{
+			name:   "load-with-reservation",
+			kernel: createFile(t, kernel),
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen"),
+				memory,
+			))}),
+			reservations: kexec.Ranges{
+				// Firmware, e.g. OpenSBI, at the start of RAM
+				// pushes the kernel to the next 2M boundary.
+				{Start: 0x80000000, Size: 0x80000},
+			},
+			entry: 0x80200000,
+			segments: kexec.Segments{
+				kexec.NewSegment(fdtBytes(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+					dt.NewNode("chosen"),
+					memory,
+				))}), kexec.Range{Start: 0x80080000, Size: 0x1000}),
+				kexec.NewSegment(kernel, kexec.Range{Start: 0x80200000, Size: 0x1400000}),
+			},
+		},
+		{
+			name:   "not enough space for kernel image",
+			kernel: createFile(t, riscvImage(0x8000000)),
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen"),
+				memory,
+			))}),
+			errs: []error{errKernelSegmentFailed, kexec.ErrNotEnoughSpace},
+		},
+		{
+			name:   "no chosen node in fdt",
+			kernel: createFile(t, kernel),
+			fdt:    fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(memory))}),
+			errs:   []error{errNoChosenNode},
+		},
+		{
+			name:   "no-memmap",
+			kernel: createFile(t, kernel),
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen", dt.WithProperty(
+					dt.PropertyString("bootargs", "ohno"),
+				)),
+			))}),
+			errs: []error{ErrMemmapEmpty},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kexecLoadRISCVImage(tt.kernel, tt.ramfs, tt.cmdline, tt.fdt, tt.reservations)
+			for _, wantErr := range tt.errs {
+				if !errors.Is(err, wantErr) {
+					t.Errorf("kexecLoad RISC-V Image = %v, want %v", err, wantErr)
+				}
+			}
+			if got == nil {
+				return
+			}
+			if got.entry != tt.entry {
+				t.Errorf("kexecLoad RISC-V Image = %#x, want %#x", got.entry, tt.entry)
+			}
+			if !kexec.SegmentsEqual(got.segments, tt.segments) {
+				t.Errorf("kexecLoad RISC-V Image =\n%v, want\n%v", got.segments, tt.segments)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/u-root/u-root/pkg/align"
+	"github.com/u-root/u-root/pkg/boot/image"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+const (
+	// With CONFIG_AUTO_ZRELADDR, the zImage decompresses the kernel to
+	// TEXT_OFFSET above the 128MB aligned base of the memory it runs
+	// in, and puts the initial page tables in the 16K below that.
+	zImageAlignSize  = 1 << 27 // 128 MB.
+	zImageTextOffset = 0x8000
+)
+
+func kexecLoadZImage(kernel, ramfs *os.File, cmdline string, dtb io.ReaderAt, reservedRanges kexec.Ranges) (*kimage, error) {
+	fdt, mm, err := readFDTMemoryMap(dtb, reservedRanges)
+	if err != nil {
+		return nil, err
+	}
+	return kexecLoadZImageMM(mm, kernel, ramfs, fdt, cmdline)
+}
+
+func kexecLoadZImageMM(mm kexec.MemoryMap, kernel, ramfs *os.File, fdt *dt.FDT, cmdline string) (*kimage, error) {
+	kmem := &kexec.Memory{
+		Phys: mm,
+	}
+
+	img := &kimage{}
+
+	// Load kernel.
+	kernelBuf, cleanup, err := getFile(kernel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kernel contents: %w", err)
+	}
+	img.cleanup = append(img.cleanup, cleanup)
+
+	if _, err := image.ParseZImageFromBytes(kernelBuf); err != nil {
+		return nil, fmt.Errorf("parse arm zImage from bytes: %w", err)
+	}
+
+	// The zImage runs at TEXT_OFFSET, where the kernel will be
+	// decompressed to, and moves itself out of the way. Like
+	// kexec-tools, guess that the decompressed kernel is at most 4 times
+	// the size of the zImage and keep that much free for it.
+	kernelSize := align.UpPage(4 * uint(len(kernelBuf)))
+	base, err := kmem.AvailableRAM().FindSpace(zImageTextOffset+kernelSize, kexec.WithStartAlignment(zImageAlignSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errKernelSegmentFailed, err)
+	}
+	kernelRange := kexec.Range{Start: base.Start + zImageTextOffset, Size: kernelSize}
+	kmem.Segments.Insert(kexec.NewSegment(kernelBuf, kernelRange))
+
+	// The kernel derives the start of usable memory from where it
+	// runs, so keep everything else above it, and off the page tables.
+	kmem.Phys.Insert(kexec.TypedRange{
+		Range: kexec.RangeFromInterval(0, kernelRange.Start),
+		Type:  kexec.RangeReserved,
+	})
+	Debug("Added %#x byte zImage at %s", len(kernelBuf), kernelRange)
+
+	if _, err := img.addBootParams(kmem, fdt, ramfs, cmdline); err != nil {
+		return nil, err
+	}
+
+	// No trampoline is needed: the kernel finds the device tree among
+	// the segments and enters the new kernel with it in r2.
+	img.entry = kernelRange.Start
+	img.segments = kmem.Segments
+	Debug("Entry: %#x", img.entry)
+	return img, nil
+}
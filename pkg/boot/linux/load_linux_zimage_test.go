@@ -0,0 +1,150 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linux
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/image"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/dt"
+)
+
+// zImage returns a 4K arm zImage.
+func zImage() []byte {
+	b := make([]byte, 0x1000)
+	binary.LittleEndian.PutUint32(b[0x24:], image.ZImageMagic)
+	binary.LittleEndian.PutUint32(b[0x2c:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[0x30:], image.ZImageLittleEndian)
+	return b
+}
+
+func TestKexecLoadZImage(t *testing.T) {
+	Debug = t.Logf
+
+	kernel := zImage()
+	memory := dt.NewNode("memory@80000000", dt.WithProperty(
+		dt.PropertyString("device_type", "memory"),
+		dt.PropertyRegion("reg", 0x80000000, 0x10000000),
+	))
+
+	for _, tt := range []struct {
+		name string
+
+		// Inputs
+		kernel       *os.File
+		ramfs        *os.File
+		fdt          io.ReaderAt
+		cmdline      string
+		reservations kexec.Ranges
+
+		// Results
+		segments kexec.Segments
+		entry    uintptr
+		errs     []error
+	}{
+		{
+			name:    "load-initramfs-and-cmdline",
+			kernel:  createFile(t, kernel),
+			ramfs:   createFile(t, []byte("ramfs")),
+			cmdline: "console=ttyAMA0",
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen", dt.WithProperty(
+					dt.PropertyU64("linux,initrd-start", 500),
+					dt.PropertyU64("linux,initrd-end", 500),
+				)),
+				memory,
+			))}),
+			// The kernel is decompressed to 0x80008000 and may
+			// take 4 times the zImage size.
+			entry: 0x80008000,
+			segments: kexec.Segments{
+				kexec.NewSegment(kernel, kexec.Range{Start: 0x80008000, Size: 0x4000}),
+				kexec.NewSegment([]byte("ramfs"), kexec.Range{Start: 0x8000c000, Size: 0x1000}),
+				kexec.NewSegment(fdtBytes(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+					dt.NewNode("chosen", dt.WithProperty(
+						dt.PropertyU64("linux,initrd-start", 0x8000c000),
+						dt.PropertyU64("linux,initrd-end", 0x8000d000),
+						dt.PropertyString("bootargs", "console=ttyAMA0"),
+					)),
+					memory,
+				))}), kexec.Range{Start: 0x8000d000, Size: 0x1000}),
+			},
+		},
+		{
+			name:   "load-with-reservation",
+			kernel: createFile(t, kernel),
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen"),
+				memory,
+			))}),
+			reservations: kexec.Ranges{
+				// Forces the kernel to the next 128M boundary.
+				// Nothing may go below it.
+				{Start: 0x80000000, Size: 0x100000},
+			},
+			entry: 0x88008000,
+			segments: kexec.Segments{
+				kexec.NewSegment(kernel, kexec.Range{Start: 0x88008000, Size: 0x4000}),
+				kexec.NewSegment(fdtBytes(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+					dt.NewNode("chosen"),
+					memory,
+				))}), kexec.Range{Start: 0x8800c000, Size: 0x1000}),
+			},
+		},
+		{
+			name:   "not enough space for kernel",
+			kernel: createFile(t, kernel),
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen"),
+				dt.NewNode("memory@80000000", dt.WithProperty(
+					dt.PropertyString("device_type", "memory"),
+					dt.PropertyRegion("reg", 0x80000000, 0x8000),
+				)),
+			))}),
+			errs: []error{errKernelSegmentFailed, kexec.ErrNotEnoughSpace},
+		},
+		{
+			name:   "not-enough-space-for-dtb",
+			kernel: createFile(t, kernel),
+			fdt: fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(
+				dt.NewNode("chosen"),
+				dt.NewNode("memory@80000000", dt.WithProperty(
+					dt.PropertyString("device_type", "memory"),
+					dt.PropertyRegion("reg", 0x80000000, 0xc000),
+				)),
+			))}),
+			errs: []error{errDTBSegmentFailed, kexec.ErrNotEnoughSpace},
+		},
+		{
+			name:   "no chosen node in fdt",
+			kernel: createFile(t, kernel),
+			fdt:    fdtReader(t, &dt.FDT{RootNode: dt.NewNode("/", dt.WithChildren(memory))}),
+			errs:   []error{errNoChosenNode},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kexecLoadZImage(tt.kernel, tt.ramfs, tt.cmdline, tt.fdt, tt.reservations)
+			for _, wantErr := range tt.errs {
+				if !errors.Is(err, wantErr) {
+					t.Errorf("kexecLoad zImage = %v, want %v", err, wantErr)
+				}
+			}
+			if got == nil {
+				return
+			}
+			if got.entry != tt.entry {
+				t.Errorf("kexecLoad zImage = %#x, want %#x", got.entry, tt.entry)
+			}
+			if !kexec.SegmentsEqual(got.segments, tt.segments) {
+				t.Errorf("kexecLoad zImage =\n%v, want\n%v", got.segments, tt.segments)
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 
 // Package menu displays a Terminal UI based text menu to choose boot options
-// from.
+// from, or a graphical menu on a framebuffer.
 package menu
 
 import (
@@ -125,41 +125,7 @@ func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
 				fmt.Fprintln(term, "Returning to main menu...")
 				continue
 			}
-			entries[num-1].Edit(func(cmdline string) string {
-				fmt.Fprintf(term, "The current quoted cmdline for option %d is:\r\n > %q\r\n", num, cmdline)
-				fmt.Fprintln(term, ` * Note the cmdline is c-style quoted. Ex: \n => newline, \\ => \`)
-				term.SetPrompt("Enter an option:\r\n * (a)ppend, (o)verwrite, (r)eturn to main menu\r\n > ")
-				choice, err := term.ReadLine()
-				if err != nil {
-					fmt.Fprintln(term, err)
-					return cmdline
-				}
-				switch choice {
-				case "a":
-					term.SetPrompt("Enter unquoted cmdline to append:\r\n > ")
-					appendCmdline, err := term.ReadLine()
-					if err != nil {
-						fmt.Fprintln(term, err)
-						return cmdline
-					}
-					if appendCmdline != "" {
-						cmdline += " " + appendCmdline
-					}
-				case "o":
-					term.SetPrompt("Enter new unquoted cmdline:\r\n > ")
-					newCmdline, err := term.ReadLine()
-					if err != nil {
-						fmt.Fprintln(term, err)
-						return cmdline
-					}
-					cmdline = newCmdline
-				case "r":
-				default:
-					fmt.Fprintf(term, "Unrecognized choice %q", choice)
-				}
-				fmt.Fprintf(term, "The new quoted cmdline for option %d is:\r\n > %q\r\n", num, cmdline)
-				return cmdline
-			})
+			entries[num-1].Edit(editCmdline(term, num))
 			fmt.Fprintln(term, "Returning to main menu...")
 			continue
 		}
@@ -176,9 +142,63 @@ func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
 	}
 }
 
+// editCmdline returns a function that lets the user edit the kernel cmdline
+// of entry num on term, for Entry.Edit.
+func editCmdline(term MenuTerminal, num int) func(cmdline string) string {
+	return func(cmdline string) string {
+		fmt.Fprintf(term, "The current quoted cmdline for option %d is:\r\n > %q\r\n", num, cmdline)
+		fmt.Fprintln(term, ` * Note the cmdline is c-style quoted. Ex: \n => newline, \\ => \`)
+		term.SetPrompt("Enter an option:\r\n * (a)ppend, (o)verwrite, (r)eturn to main menu\r\n > ")
+		choice, err := term.ReadLine()
+		if err != nil {
+			fmt.Fprintln(term, err)
+			return cmdline
+		}
+		switch choice {
+		case "a":
+			term.SetPrompt("Enter unquoted cmdline to append:\r\n > ")
+			appendCmdline, err := term.ReadLine()
+			if err != nil {
+				fmt.Fprintln(term, err)
+				return cmdline
+			}
+			if appendCmdline != "" {
+				cmdline += " " + appendCmdline
+			}
+		case "o":
+			term.SetPrompt("Enter new unquoted cmdline:\r\n > ")
+			newCmdline, err := term.ReadLine()
+			if err != nil {
+				fmt.Fprintln(term, err)
+				return cmdline
+			}
+			cmdline = newCmdline
+		case "r":
+		default:
+			fmt.Fprintf(term, "Unrecognized choice %q", choice)
+		}
+		fmt.Fprintf(term, "The new quoted cmdline for option %d is:\r\n > %q\r\n", num, cmdline)
+		return cmdline
+	}
+}
+
 // ShowMenuAndLoad calls showMenuAndLoadFromFile using the default tty.
 // Use TTY because os.stdin does not support deadlines well.
+//
+// If a framebuffer was set with SetFramebuffer, the menu is shown there
+// instead, falling back to the tty if it cannot be used.
 func ShowMenuAndLoad(allowEdit bool, entries ...Entry) Entry {
+	if framebuffer != "" {
+		m, err := openFBMenu(framebuffer)
+		if err == nil {
+			defer m.Close()
+			return loadChosen(func() Entry {
+				return chooseFB(m, allowEdit, entries...)
+			}, entries...)
+		}
+		log.Printf("Failed to show the menu on %s, using the terminal: %v", framebuffer, err)
+	}
+
 	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
 		log.Printf("Failed to open /dev/tty: %s\n", err)
@@ -200,7 +220,7 @@ func showMenuAndLoadFromFile(file *os.File, allowEdit bool, entries ...Entry) En
 	fmt.Printf("Welcome to LinuxBoot's Menu\n\n")
 	fmt.Printf("Enter a number to boot a kernel:\n")
 
-	for {
+	return loadChosen(func() Entry {
 		t := NewTerminal(file)
 		// Allow the user to choose.
 		entry := Choose(t, allowEdit, entries...)
@@ -208,7 +228,16 @@ func showMenuAndLoadFromFile(file *os.File, allowEdit bool, entries ...Entry) En
 			log.Printf("Failed to close terminal made from file %s "+
 				"(desc %d): %v", file.Name(), file.Fd(), err)
 		}
+		return entry
+	}, entries...)
+}
 
+// loadChosen loads the entries the user chooses with choose until one loads
+// successfully. If the user does not choose an entry, it loads the first
+// default entry that loads.
+func loadChosen(choose func() Entry, entries ...Entry) Entry {
+	for {
+		entry := choose()
 		if entry == nil {
 			// This only returns something if the user explicitly
 			// entered something.
@@ -269,11 +298,15 @@ type OSImageAction struct {
 	boot.OSImage
 	Verbose     bool
 	NoKexecLoad bool
+	// LoadOptions are additional options to load the OSImage with, e.g.
+	// to verify it.
+	LoadOptions []boot.LoadOption
 }
 
 // Load implements Entry.Load by loading the OS image into memory.
 func (oia OSImageAction) Load() error {
-	if err := oia.OSImage.Load(boot.WithVerbose(oia.Verbose), boot.WithDryRun(oia.NoKexecLoad)); err != nil {
+	opts := append([]boot.LoadOption{boot.WithVerbose(oia.Verbose), boot.WithDryRun(oia.NoKexecLoad)}, oia.LoadOptions...)
+	if err := oia.OSImage.Load(opts...); err != nil {
 		return fmt.Errorf("could not load image %s: %v", oia.OSImage, err)
 	}
 	return nil
@@ -0,0 +1,330 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/evdev"
+	"github.com/u-root/u-root/pkg/fb"
+)
+
+// framebuffer is the device ShowMenuAndLoad shows the menu on, if set.
+var framebuffer string
+
+// SetFramebuffer makes ShowMenuAndLoad show a graphical menu on the
+// framebuffer device dev, e.g. /dev/fb0, taking input from all keyboards.
+// An empty dev uses the terminal.
+func SetFramebuffer(dev string) {
+	framebuffer = dev
+}
+
+// Screen is what the framebuffer menu is drawn on.
+type Screen interface {
+	Bounds() image.Rectangle
+	Draw(img image.Image) error
+}
+
+var _ Screen = (*fb.Device)(nil)
+
+var (
+	fbBackground = color.RGBA{0x10, 0x10, 0x20, 0xff}
+	fbForeground = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	fbHighlight  = color.RGBA{0x30, 0x60, 0xc0, 0xff}
+	fbSelected   = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	fbDim        = color.RGBA{0x80, 0x80, 0x90, 0xff}
+)
+
+// fbColumns is the number of characters that should at least fit in a line.
+const fbColumns = 100
+
+var errNoKeyboard = errors.New("no keyboard found")
+
+// fbMenu shows the menu entries on a Screen, one of them highlighted, with
+// the time left until the default entries boot. Below them is a terminal,
+// so that it can be used as a MenuTerminal to edit cmdlines with the same
+// dialog as the text menu.
+type fbMenu struct {
+	screen  Screen
+	img     *image.RGBA
+	scale   int
+	keys    <-chan evdev.Key
+	closers []io.Closer
+
+	// labels of the entries, which are not asked for while an entry is
+	// being edited.
+	labels    []string
+	allowEdit bool
+	selected  int
+
+	// The terminal.
+	output   []string
+	prompt   string
+	line     []rune
+	deadline time.Time
+	onKey    func()
+}
+
+var _ MenuTerminal = &fbMenu{}
+
+func newFBMenu(screen Screen, keys <-chan evdev.Key) *fbMenu {
+	b := screen.Bounds()
+	return &fbMenu{
+		screen: screen,
+		img:    image.NewRGBA(b),
+		scale:  max(1, b.Dx()/(fbColumns*fb.GlyphWidth)),
+		keys:   keys,
+	}
+}
+
+// openFBMenu opens a framebuffer menu on dev, reading keys from all
+// keyboards.
+func openFBMenu(dev string) (*fbMenu, error) {
+	kbds, err := evdev.Keyboards()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(chan evdev.Key, 64)
+	var closers []io.Closer
+	for _, kbd := range kbds {
+		f, err := os.Open(kbd)
+		if err != nil {
+			continue
+		}
+		closers = append(closers, f)
+		go func() { _ = evdev.ReadKeys(f, keys) }()
+	}
+	if len(closers) == 0 {
+		return nil, errNoKeyboard
+	}
+	d, err := fb.Open(dev)
+	if err != nil {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, err
+	}
+	m := newFBMenu(d, keys)
+	m.closers = append(closers, d)
+	return m, nil
+}
+
+// Close closes the framebuffer and keyboards.
+func (m *fbMenu) Close() error {
+	var errs []error
+	for _, c := range m.closers {
+		errs = append(errs, c.Close())
+	}
+	m.closers = nil
+	return errors.Join(errs...)
+}
+
+// Write adds p to the terminal.
+func (m *fbMenu) Write(p []byte) (int, error) {
+	s := strings.ReplaceAll(string(p), "\r", "")
+	if len(m.output) == 0 {
+		m.output = []string{""}
+	}
+	lines := strings.Split(s, "\n")
+	m.output[len(m.output)-1] += lines[0]
+	m.output = append(m.output, lines[1:]...)
+	return len(p), nil
+}
+
+// SetPrompt sets the prompt shown in front of the line being read.
+func (m *fbMenu) SetPrompt(prompt string) {
+	m.prompt = strings.ReplaceAll(prompt, "\r", "")
+}
+
+// SetEntryCallback sets a function called on every key press.
+func (m *fbMenu) SetEntryCallback(f func()) {
+	m.onKey = f
+}
+
+// SetTimeout sets the time after which reading fails with
+// os.ErrDeadlineExceeded.
+func (m *fbMenu) SetTimeout(d time.Duration) error {
+	m.deadline = time.Now().Add(d)
+	return nil
+}
+
+// readKey waits for a key press, redrawing every second to update the
+// countdown.
+func (m *fbMenu) readKey() (evdev.Key, error) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		m.draw()
+		left := time.Until(m.deadline)
+		if left <= 0 {
+			return evdev.Key{}, os.ErrDeadlineExceeded
+		}
+		timeout := time.NewTimer(left)
+		select {
+		case k, ok := <-m.keys:
+			timeout.Stop()
+			if !ok {
+				return evdev.Key{}, io.EOF
+			}
+			if m.onKey != nil {
+				m.onKey()
+			}
+			return k, nil
+		case <-timeout.C:
+		case <-tick.C:
+			timeout.Stop()
+		}
+	}
+}
+
+// ReadLine reads a line in the terminal.
+func (m *fbMenu) ReadLine() (string, error) {
+	m.line = nil
+	for {
+		k, err := m.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case k.Code == evdev.KeyEnter:
+			line := string(m.line)
+			fmt.Fprintf(m, "%s%s\n", m.prompt, line)
+			m.line = nil
+			return line, nil
+		case k.Code == evdev.KeyBackspace:
+			if len(m.line) > 0 {
+				m.line = m.line[:len(m.line)-1]
+			}
+		case k.Ctrl && k.Rune == 'u':
+			m.line = nil
+		case k.Rune != 0 && !k.Ctrl:
+			m.line = append(m.line, k.Rune)
+		}
+	}
+}
+
+// chooseFB lets the user choose an entry with the arrow keys. It returns nil
+// if the user did not choose one before the timeout.
+func chooseFB(m *fbMenu, allowEdit bool, entries ...Entry) Entry {
+	m.setLabels(entries)
+	m.allowEdit = allowEdit
+	m.selected = 0
+	m.prompt = ""
+
+	_ = m.SetTimeout(initialTimeout)
+	// Reset the countdown timer when you press a key.
+	m.SetEntryCallback(func() {
+		_ = m.SetTimeout(subsequentTimeout)
+	})
+
+	for {
+		k, err := m.readKey()
+		if err != nil {
+			return nil
+		}
+		switch {
+		case k.Code == evdev.KeyUp && m.selected > 0:
+			m.selected--
+		case k.Code == evdev.KeyDown && m.selected < len(entries)-1:
+			m.selected++
+		case k.Code == evdev.KeyHome:
+			m.selected = 0
+		case k.Code == evdev.KeyEnd:
+			m.selected = len(entries) - 1
+		case k.Rune >= '1' && k.Rune <= '9' && int(k.Rune-'0') <= len(entries):
+			m.selected = int(k.Rune - '1')
+		case k.Code == evdev.KeyEnter && len(entries) > 0:
+			return entries[m.selected]
+		case allowEdit && k.Rune == 'e' && len(entries) > 0:
+			num := m.selected + 1
+			entries[m.selected].Edit(editCmdline(m, num))
+			fmt.Fprintln(m, "Returning to main menu...")
+			m.prompt = ""
+			m.setLabels(entries)
+		}
+	}
+}
+
+func (m *fbMenu) setLabels(entries []Entry) {
+	m.labels = nil
+	for _, e := range entries {
+		m.labels = append(m.labels, e.Label())
+	}
+}
+
+// draw renders the menu and shows it on the screen.
+func (m *fbMenu) draw() {
+	b := m.img.Bounds()
+	draw.Draw(m.img, b, image.NewUniform(fbBackground), image.Point{}, draw.Src)
+
+	cw, ch := fb.GlyphWidth*m.scale, fb.GlyphHeight*m.scale
+	cols, rows := b.Dx()/cw-4, b.Dy()/ch-2
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	row := 0
+	text := func(s string, c color.Color) {
+		if len([]rune(s)) > cols {
+			s = string([]rune(s)[:cols])
+		}
+		fb.DrawText(m.img, b.Min.Add(image.Pt(2*cw, (row+1)*ch)), s, m.scale, c)
+		row++
+	}
+
+	text("Welcome to LinuxBoot's Menu", fbSelected)
+	help := "Up/Down to select an entry, Enter to boot it"
+	if m.allowEdit {
+		help += ", 'e' to edit its kernel cmdline"
+	}
+	text(help, fbDim)
+	row++
+
+	// Show as many entries as fit in half of the screen, scrolling to
+	// keep the selected one visible.
+	visible := min(len(m.labels), max(1, rows/2-4))
+	first := max(0, m.selected-visible+1)
+	for i := first; i < first+visible; i++ {
+		label := fmt.Sprintf("%02d. %s", i+1, m.labels[i])
+		if i == m.selected {
+			bar := image.Rect(cw, (row+1)*ch-m.scale, b.Dx()-cw, (row+2)*ch-m.scale).Add(b.Min)
+			draw.Draw(m.img, bar, image.NewUniform(fbHighlight), image.Point{}, draw.Src)
+			text(label, fbSelected)
+		} else {
+			text(label, fbForeground)
+		}
+	}
+	row++
+
+	if left := time.Until(m.deadline); left > 0 {
+		text(fmt.Sprintf("The default entries boot in %d seconds", (left+time.Second-1)/time.Second), fbForeground)
+	}
+	row++
+
+	// The terminal gets the remaining rows, showing the latest output
+	// and the prompt with the line being edited.
+	term := append([]string{}, m.output...)
+	if len(term) > 0 && term[len(term)-1] == "" {
+		term = term[:len(term)-1]
+	}
+	if m.prompt != "" {
+		term = append(term, strings.Split(m.prompt+string(m.line)+"_", "\n")...)
+	}
+	if n := rows - row; len(term) > n {
+		term = term[len(term)-max(n, 0):]
+	}
+	for _, l := range term {
+		text(l, fbForeground)
+	}
+
+	_ = m.screen.Draw(m.img)
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/evdev"
+	"github.com/u-root/u-root/pkg/fb"
+)
+
+// memScreen is an in-memory framebuffer.
+type memScreen struct {
+	*image.RGBA
+}
+
+func (s memScreen) Draw(img image.Image) error {
+	draw.Draw(s.RGBA, s.Bounds(), img, s.Bounds().Min, draw.Src)
+	return nil
+}
+
+var (
+	enter = evdev.Key{Code: evdev.KeyEnter}
+	down  = evdev.Key{Code: evdev.KeyDown}
+	up    = evdev.Key{Code: evdev.KeyUp}
+)
+
+func typed(s string) []evdev.Key {
+	var keys []evdev.Key
+	for _, r := range s {
+		keys = append(keys, evdev.Key{Rune: r})
+	}
+	return keys
+}
+
+func keyChan(keys ...evdev.Key) chan evdev.Key {
+	c := make(chan evdev.Key, len(keys))
+	for _, k := range keys {
+		c <- k
+	}
+	return c
+}
+
+func TestChooseFB(t *testing.T) {
+	entry1 := &testEntry{label: "foo", cmdline: "console=ttyS0"}
+	entry2 := &testEntry{label: "bar"}
+	entry3 := &testEntry{label: "baz"}
+
+	for _, tt := range []struct {
+		name      string
+		keys      []evdev.Key
+		allowEdit bool
+		want      Entry
+		selected  int
+	}{
+		{
+			name: "first",
+			keys: []evdev.Key{enter},
+			want: entry1,
+		},
+		{
+			name:     "down",
+			keys:     []evdev.Key{down, enter},
+			want:     entry2,
+			selected: 1,
+		},
+		{
+			name:     "past the end",
+			keys:     []evdev.Key{down, down, down, up, enter},
+			want:     entry2,
+			selected: 1,
+		},
+		{
+			name:     "number",
+			keys:     append(typed("3"), enter),
+			want:     entry3,
+			selected: 2,
+		},
+		{
+			name: "timeout",
+			keys: []evdev.Key{down},
+		},
+		{
+			name: "no edit",
+			keys: typed("e"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := memScreen{image.NewRGBA(image.Rect(0, 0, 320, 240))}
+			m := newFBMenu(s, keyChan(tt.keys...))
+			got := chooseFB(m, tt.allowEdit, entry1, entry2, entry3)
+			if got != tt.want {
+				t.Fatalf("chooseFB = %v, want %v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+
+			// Entries start on the fourth row, the chosen one on a
+			// highlighted bar.
+			for i := 0; i < 3; i++ {
+				y := (4+i)*fb.GlyphHeight + 1
+				want := fbBackground
+				if i == tt.selected {
+					want = fbHighlight
+				}
+				if c := s.RGBAAt(fb.GlyphWidth+1, y); c != want {
+					t.Errorf("color of entry %d = %v, want %v", i+1, c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChooseFBEdit(t *testing.T) {
+	entry1 := &testEntry{label: "foo", cmdline: "console=ttyS0"}
+	entry2 := &testEntry{label: "bar"}
+
+	var keys []evdev.Key
+	keys = append(keys, down)
+	keys = append(keys, typed("e")...)
+	keys = append(keys, typed("a")...)
+	keys = append(keys, enter)
+	keys = append(keys, typed("fooo")...)
+	keys = append(keys, evdev.Key{Code: evdev.KeyBackspace}, enter, up, enter)
+
+	s := memScreen{image.NewRGBA(image.Rect(0, 0, 320, 240))}
+	m := newFBMenu(s, keyChan(keys...))
+	entry2.cmdline = "quiet"
+	if got := chooseFB(m, true, entry1, entry2); got != entry1 {
+		t.Fatalf("chooseFB = %v, want %v", got, entry1)
+	}
+	if want := "quiet foo"; entry2.cmdline != want {
+		t.Errorf("cmdline = %q, want %q", entry2.cmdline, want)
+	}
+	if want := "console=ttyS0"; entry1.cmdline != want {
+		t.Errorf("cmdline = %q, want %q", entry1.cmdline, want)
+	}
+	out := strings.Join(m.output, "\n")
+	for _, want := range []string{
+		"The current quoted cmdline for option 2 is:\n > \"quiet\"",
+		" > a\n",
+		"The new quoted cmdline for option 2 is:\n > \"quiet foo\"",
+		"Returning to main menu...",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+}
+
+func TestFBMenuWrite(t *testing.T) {
+	m := newFBMenu(memScreen{image.NewRGBA(image.Rect(0, 0, 64, 64))}, nil)
+	for _, s := range []string{"a", "b\r\nc", "\n", "d"} {
+		if _, err := m.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := strings.Join(m.output, "|"), "ab|c|d"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -16,6 +16,9 @@ import (
 
 // MultibootImage is a multiboot-formated OSImage, such as ESXi, Xen, Akaros,
 // tboot.
+//
+// Multiboot v1, multiboot2 and esxBootInfo kernels are supported; the
+// format is detected from the kernel's header when loading.
 type MultibootImage struct {
 	Name string
 
@@ -53,7 +56,19 @@ func (mi *MultibootImage) Load(opts ...LoadOption) error {
 		opt(loadOpts)
 	}
 
-	entryPoint, segments, err := multiboot.PrepareLoad(loadOpts.verbose, mi.Kernel, mi.Cmdline, mi.Modules, mi.IBFT)
+	kernel, err := loadOpts.check("kernel", mi.Kernel)
+	if err != nil {
+		return err
+	}
+	modules := make([]multiboot.Module, len(mi.Modules))
+	for i, mod := range mi.Modules {
+		modules[i] = mod
+		if modules[i].Module, err = loadOpts.check("module", mod.Module); err != nil {
+			return err
+		}
+	}
+
+	entryPoint, segments, err := multiboot.PrepareLoad(loadOpts.verbose, kernel, mi.Cmdline, modules, mi.IBFT)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,41 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"errors"
+
+	"github.com/u-root/u-root/pkg/fb"
+)
+
+// readFramebuffer returns the current mode of a direct color framebuffer
+// device.
+func readFramebuffer(dev string) (*framebufferInfo, error) {
+	fix, v, err := fb.GetScreenInfo(dev)
+	if err != nil {
+		return nil, err
+	}
+	if fix.Type != fb.TypePackedPixels || fix.Visual != fb.VisualTrueColor {
+		return nil, errors.New("framebuffer is not a packed pixel true color framebuffer")
+	}
+	// Many DRM drivers hide the physical address.
+	if fix.SmemStart == 0 {
+		return nil, errors.New("framebuffer physical address is unknown")
+	}
+	bpp := uint64(v.BitsPerPixel / 8)
+	return &framebufferInfo{
+		Addr:      uint64(fix.SmemStart) + uint64(v.YOffset)*uint64(fix.LineLength) + uint64(v.XOffset)*bpp,
+		Pitch:     fix.LineLength,
+		Width:     v.XRes,
+		Height:    v.YRes,
+		BPP:       uint8(v.BitsPerPixel),
+		RedPos:    uint8(v.Red.Offset),
+		RedSize:   uint8(v.Red.Length),
+		GreenPos:  uint8(v.Green.Offset),
+		GreenSize: uint8(v.Green.Length),
+		BluePos:   uint8(v.Blue.Offset),
+		BlueSize:  uint8(v.Blue.Length),
+	}, nil
+}
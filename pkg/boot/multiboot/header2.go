@@ -0,0 +1,253 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/u-root/u-root/pkg/align"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/uio/uio"
+)
+
+// ErrTagNotSupported indicates that a Multiboot2 header contains a
+// non-optional tag this package cannot honor.
+var ErrTagNotSupported = errors.New("multiboot2 header tag not supported")
+
+const (
+	// header2Magic is the magic value found in a Multiboot2 kernel header.
+	header2Magic = 0xE85250D6
+
+	// boot2Magic is the magic expected by the loaded OS in EAX at boot
+	// handover.
+	boot2Magic = 0x36D76289
+
+	// header2ArchI386 is the 32-bit protected mode i386 architecture.
+	header2ArchI386 = 0
+
+	// header2SearchSize is the size of the image prefix the Multiboot2
+	// header must be contained in.
+	header2SearchSize = 32768
+
+	sizeofHeader2    = 16
+	sizeofHeader2Tag = 8
+)
+
+type header2TagType uint16
+
+// Multiboot2 header tag types, see
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Header-tags.
+const (
+	header2TagEnd               header2TagType = 0
+	header2TagInfoRequest       header2TagType = 1
+	header2TagAddress           header2TagType = 2
+	header2TagEntryAddress      header2TagType = 3
+	header2TagConsoleFlags      header2TagType = 4
+	header2TagFramebuffer       header2TagType = 5
+	header2TagModuleAlign       header2TagType = 6
+	header2TagEFIBootServices   header2TagType = 7
+	header2TagEntryAddressEFI32 header2TagType = 8
+	header2TagEntryAddressEFI64 header2TagType = 9
+	header2TagRelocatable       header2TagType = 10
+)
+
+// header2TagFlagOptional marks a header tag the loader may ignore.
+const header2TagFlagOptional = 1
+
+// addressTag is the Multiboot2 address header tag, which describes how to
+// load a non-ELF image.
+type addressTag struct {
+	HeaderAddr  uint32
+	LoadAddr    uint32
+	LoadEndAddr uint32
+	BSSEndAddr  uint32
+}
+
+// framebufferTag is the preferred graphics mode of the kernel.
+type framebufferTag struct {
+	Width  uint32
+	Height uint32
+	Depth  uint32
+}
+
+// header2 represents a Multiboot2 header loaded from the file.
+type header2 struct {
+	Architecture uint32
+	HeaderLength uint32
+
+	// offset is the file offset of the header.
+	offset uint32
+
+	// infoRequests are the boot information tag types the kernel needs.
+	infoRequests []mbiTagType
+	address      *addressTag
+	entry        *uint32
+	framebuffer  *framebufferTag
+}
+
+func (h *header2) name() string {
+	return "multiboot2"
+}
+
+func (h *header2) bootMagic() uintptr {
+	return boot2Magic
+}
+
+// parseHeader2 parses a Multiboot2 header as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#OS-image-format
+func parseHeader2(r io.Reader) (*header2, error) {
+	buf := make([]byte, header2SearchSize)
+	n, err := io.ReadAtLeast(r, buf, sizeofHeader2)
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	// The Multiboot2 header must be 64-bit aligned.
+	for off := 0; off+sizeofHeader2 <= len(buf); off += 8 {
+		b := uio.NewNativeEndianBuffer(buf[off : off+sizeofHeader2])
+		magic, arch, length, checksum := b.Read32(), b.Read32(), b.Read32(), b.Read32()
+		if magic != header2Magic || magic+arch+length+checksum != 0 {
+			continue
+		}
+		if arch != header2ArchI386 {
+			return nil, fmt.Errorf("multiboot2 architecture %d not supported", arch)
+		}
+		if length < sizeofHeader2 || off+int(length) > len(buf) {
+			return nil, fmt.Errorf("multiboot2 header length %d out of bounds", length)
+		}
+		h := &header2{
+			Architecture: arch,
+			HeaderLength: length,
+			offset:       uint32(off),
+		}
+		if err := h.parseTags(buf[off+sizeofHeader2 : off+int(length)]); err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+	return nil, ErrHeaderNotFound
+}
+
+func (h *header2) parseTags(b []byte) error {
+	for len(b) >= sizeofHeader2Tag {
+		tb := uio.NewNativeEndianBuffer(b)
+		typ, flags, size := header2TagType(tb.Read16()), tb.Read16(), tb.Read32()
+		if size < sizeofHeader2Tag || int(size) > len(b) {
+			return fmt.Errorf("multiboot2 header tag %d has bad size %d", typ, size)
+		}
+		optional := flags&header2TagFlagOptional != 0
+		data := uio.NewNativeEndianBuffer(b[sizeofHeader2Tag:size])
+
+		switch typ {
+		case header2TagEnd:
+			return nil
+
+		case header2TagInfoRequest:
+			for data.Len() >= 4 {
+				t := mbiTagType(data.Read32())
+				if !supportedMBITags[t] {
+					if !optional {
+						return fmt.Errorf("%w: boot information tag %d requested", ErrTagNotSupported, t)
+					}
+					log.Printf("Multiboot2 boot information tag %d not supported, ignoring optional request", t)
+					continue
+				}
+				h.infoRequests = append(h.infoRequests, t)
+			}
+
+		case header2TagAddress:
+			var a addressTag
+			a.HeaderAddr, a.LoadAddr, a.LoadEndAddr, a.BSSEndAddr = data.Read32(), data.Read32(), data.Read32(), data.Read32()
+			h.address = &a
+
+		case header2TagEntryAddress:
+			e := data.Read32()
+			h.entry = &e
+
+		case header2TagConsoleFlags:
+			// Console flags only matter for EGA text mode, which
+			// kexec cannot set up.
+			if f := data.Read32(); f != 0 {
+				log.Printf("Multiboot2 console flags %#x are not supported, trying to load anyway", f)
+			}
+
+		case header2TagFramebuffer:
+			var f framebufferTag
+			f.Width, f.Height, f.Depth = data.Read32(), data.Read32(), data.Read32()
+			h.framebuffer = &f
+
+		case header2TagModuleAlign:
+			// Modules are always page aligned.
+
+		case header2TagEntryAddressEFI32, header2TagEntryAddressEFI64:
+			// Only used together with the EFI boot services tag.
+
+		case header2TagRelocatable:
+			// The image may be relocated, but loading it at its
+			// link address is always allowed.
+
+		default:
+			// Includes header2TagEFIBootServices: boot services are
+			// long gone by the time we kexec.
+			if !optional {
+				return fmt.Errorf("%w: header tag %d", ErrTagNotSupported, typ)
+			}
+		}
+		if err := data.Error(); err != nil {
+			return fmt.Errorf("multiboot2 header tag %d: %w", typ, err)
+		}
+		next := align.Up(uint(size), 8)
+		if next > uint(len(b)) {
+			next = uint(len(b))
+		}
+		b = b[next:]
+	}
+	return fmt.Errorf("multiboot2 header has no end tag")
+}
+
+// loadAddress loads the kernel as described by the address tag rather than
+// by its ELF program headers.
+func (h *header2) loadAddress(m *multiboot) error {
+	a := h.address
+	if a.HeaderAddr < a.LoadAddr {
+		return fmt.Errorf("multiboot2 address tag: header address %#x below load address %#x", a.HeaderAddr, a.LoadAddr)
+	}
+	if a.HeaderAddr-a.LoadAddr > h.offset {
+		return fmt.Errorf("multiboot2 address tag: load address %#x is before the start of the image", a.LoadAddr)
+	}
+	fileOff := int64(h.offset - (a.HeaderAddr - a.LoadAddr))
+
+	var d []byte
+	if a.LoadEndAddr == 0 {
+		var err error
+		d, err = io.ReadAll(io.NewSectionReader(m.kernel, fileOff, 1<<62))
+		if err != nil {
+			return err
+		}
+	} else {
+		if a.LoadEndAddr < a.LoadAddr {
+			return fmt.Errorf("multiboot2 address tag: load end address %#x below load address %#x", a.LoadEndAddr, a.LoadAddr)
+		}
+		d = make([]byte, a.LoadEndAddr-a.LoadAddr)
+		if _, err := m.kernel.ReadAt(d, fileOff); err != nil {
+			return fmt.Errorf("reading kernel image: %w", err)
+		}
+	}
+
+	// kexec zeroes the rest of the segment, which takes care of the BSS.
+	size := uint(len(d))
+	if a.BSSEndAddr > a.LoadAddr+uint32(size) {
+		size = uint(a.BSSEndAddr - a.LoadAddr)
+	}
+	m.mem.Segments.Insert(kexec.NewSegment(d, kexec.Range{
+		Start: uintptr(a.LoadAddr),
+		Size:  size,
+	}))
+	return nil
+}
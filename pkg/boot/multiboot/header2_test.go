@@ -0,0 +1,255 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/uio/uio"
+)
+
+type testTag struct {
+	typ      header2TagType
+	optional bool
+	data     []uint32
+}
+
+// createHeader2 returns a multiboot2 header with the given tags, followed
+// by an end tag.
+func createHeader2(arch uint32, tags ...testTag) []byte {
+	b := uio.NewNativeEndianBuffer(nil)
+	for _, tag := range append(tags, testTag{typ: header2TagEnd}) {
+		b.Write16(uint16(tag.typ))
+		if tag.optional {
+			b.Write16(header2TagFlagOptional)
+		} else {
+			b.Write16(0)
+		}
+		b.Write32(uint32(8 + 4*len(tag.data)))
+		for _, d := range tag.data {
+			b.Write32(d)
+		}
+		b.Align(8)
+	}
+	tags2 := b.Data()
+
+	var magic uint32 = header2Magic
+	length := uint32(sizeofHeader2 + len(tags2))
+	h := uio.NewNativeEndianBuffer(nil)
+	h.Write32(magic)
+	h.Write32(arch)
+	h.Write32(length)
+	h.Write32(-(magic + arch + length))
+	h.WriteBytes(tags2)
+	return h.Data()
+}
+
+func createFile2(hdr []byte, offset, size int) []byte {
+	buf := bytes.Repeat([]byte{0xDE, 0xAD, 0xBE, 0xEF}, (size+4)/4)
+	buf = buf[:size]
+	copy(buf[offset:], hdr)
+	return buf
+}
+
+func TestParseHeader2(t *testing.T) {
+	entry := uint32(0x100010)
+	for _, tt := range []struct {
+		name   string
+		hdr    []byte
+		offset int
+		want   *header2
+		err    error
+	}{
+		{
+			name: "no tags",
+			hdr:  createHeader2(header2ArchI386),
+			want: &header2{HeaderLength: 24},
+		},
+		{
+			name:   "at 32K boundary",
+			hdr:    createHeader2(header2ArchI386),
+			offset: header2SearchSize - 24,
+			want:   &header2{HeaderLength: 24, offset: header2SearchSize - 24},
+		},
+		{
+			name:   "unaligned",
+			hdr:    createHeader2(header2ArchI386),
+			offset: 4,
+			err:    ErrHeaderNotFound,
+		},
+		{
+			name:   "beyond 32K",
+			hdr:    createHeader2(header2ArchI386),
+			offset: header2SearchSize,
+			err:    ErrHeaderNotFound,
+		},
+		{
+			name: "all tags",
+			hdr: createHeader2(header2ArchI386,
+				testTag{typ: header2TagInfoRequest, data: []uint32{uint32(mbiTagMmap), uint32(mbiTagACPINew)}},
+				testTag{typ: header2TagInfoRequest, optional: true, data: []uint32{uint32(mbiTagAPM)}},
+				testTag{typ: header2TagAddress, data: []uint32{0x100000, 0x100000, 0x200000, 0x300000}},
+				testTag{typ: header2TagEntryAddress, data: []uint32{entry}},
+				testTag{typ: header2TagConsoleFlags, data: []uint32{0}},
+				testTag{typ: header2TagFramebuffer, optional: true, data: []uint32{1024, 768, 32}},
+				testTag{typ: header2TagModuleAlign},
+				testTag{typ: header2TagRelocatable, optional: true, data: []uint32{0x100000, 0x1000000, 0x1000, 0}},
+				testTag{typ: 42, optional: true},
+			),
+			want: &header2{
+				HeaderLength: 176,
+				infoRequests: []mbiTagType{mbiTagMmap, mbiTagACPINew},
+				address: &addressTag{
+					HeaderAddr:  0x100000,
+					LoadAddr:    0x100000,
+					LoadEndAddr: 0x200000,
+					BSSEndAddr:  0x300000,
+				},
+				entry:       &entry,
+				framebuffer: &framebufferTag{Width: 1024, Height: 768, Depth: 32},
+			},
+		},
+		{
+			name: "unsupported info request",
+			hdr:  createHeader2(header2ArchI386, testTag{typ: header2TagInfoRequest, data: []uint32{uint32(mbiTagAPM)}}),
+			err:  ErrTagNotSupported,
+		},
+		{
+			name: "EFI boot services",
+			hdr:  createHeader2(header2ArchI386, testTag{typ: header2TagEFIBootServices}),
+			err:  ErrTagNotSupported,
+		},
+		{
+			name: "unknown tag",
+			hdr:  createHeader2(header2ArchI386, testTag{typ: 42}),
+			err:  ErrTagNotSupported,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHeader2(bytes.NewReader(createFile2(tt.hdr, tt.offset, 40000)))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseHeader2() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(header2{})); diff != "" {
+				t.Errorf("parseHeader2() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseHeader2Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		hdr  []byte
+	}{
+		{
+			name: "MIPS",
+			hdr:  createHeader2(4),
+		},
+		{
+			name: "short tag",
+			hdr:  createHeader2(header2ArchI386, testTag{typ: header2TagEntryAddress}),
+		},
+		{
+			name: "no end tag",
+			hdr:  createHeaderNoTags(),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseHeader2(bytes.NewReader(createFile2(tt.hdr, 0, 4096))); err == nil || errors.Is(err, ErrHeaderNotFound) {
+				t.Errorf("parseHeader2() = %v, want a parse error", err)
+			}
+		})
+	}
+}
+
+// createHeaderNoTags returns a multiboot2 header that lacks an end tag.
+func createHeaderNoTags() []byte {
+	var magic, length uint32 = header2Magic, sizeofHeader2
+	h := uio.NewNativeEndianBuffer(nil)
+	h.Write32(magic)
+	h.Write32(header2ArchI386)
+	h.Write32(length)
+	h.Write32(-(magic + length))
+	return h.Data()
+}
+
+func TestProbe(t *testing.T) {
+	v1 := createHeader(flagGood)
+	r, err := createFile(&v1, 0, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1File, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Xen-like image with a multiboot v1 and a multiboot2 header.
+	both := append([]byte{}, v1File...)
+	copy(both[64:], createHeader2(header2ArchI386))
+
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		want string
+	}{
+		{name: "v1", img: v1File, want: "multiboot"},
+		{name: "v2", img: createFile2(createHeader2(header2ArchI386), 8, 4096), want: "multiboot2"},
+		{name: "both", img: both, want: "multiboot2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := parseImageHeader(bytes.NewReader(tt.img))
+			if err != nil {
+				t.Fatalf("parseImageHeader() = %v", err)
+			}
+			if got := h.name(); got != tt.want {
+				t.Errorf("parseImageHeader() = %s image, want %s", got, tt.want)
+			}
+			if err := Probe(bytes.NewReader(tt.img)); err != nil {
+				t.Errorf("Probe() = %v", err)
+			}
+		})
+	}
+
+	if err := Probe(bytes.NewReader(make([]byte, 8192))); err != ErrHeaderNotFound {
+		t.Errorf("Probe(zeroes) = %v, want %v", err, ErrHeaderNotFound)
+	}
+}
+
+func TestLoadAddress(t *testing.T) {
+	// The header sits 0x40 bytes into the image, which is loaded at 1M.
+	hdr := createHeader2(header2ArchI386,
+		testTag{typ: header2TagAddress, data: []uint32{0x100040, 0x100000, 0x100800, 0x101000}},
+		testTag{typ: header2TagEntryAddress, data: []uint32{0x100100}},
+	)
+	img := createFile2(hdr, 0x40, 0x1000)
+
+	h, err := parseHeader2(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("parseHeader2() = %v", err)
+	}
+	m := &multiboot{kernel: bytes.NewReader(img)}
+	if err := h.loadAddress(m); err != nil {
+		t.Fatalf("loadAddress() = %v", err)
+	}
+	want := kexec.Segments{kexec.NewSegment(img[:0x800], kexec.Range{Start: 0x100000, Size: 0x1000})}
+	if diff := cmp.Diff(want, m.mem.Segments); diff != "" {
+		t.Errorf("loadAddress() segments mismatch (-want +got):\n%s", diff)
+	}
+
+	h.address.LoadAddr = 0xf0000
+	if err := h.loadAddress(&multiboot{kernel: bytes.NewReader(img)}); err == nil {
+		t.Errorf("loadAddress() with load address before the image = nil, want error")
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/acpi"
+	"github.com/u-root/u-root/pkg/ubinary"
+	"github.com/u-root/uio/uio"
+)
+
+type mbiTagType uint32
+
+// Multiboot2 boot information tag types, see
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Boot-information-format.
+const (
+	mbiTagEnd            mbiTagType = 0
+	mbiTagCmdline        mbiTagType = 1
+	mbiTagBootLoaderName mbiTagType = 2
+	mbiTagModule         mbiTagType = 3
+	mbiTagBasicMeminfo   mbiTagType = 4
+	mbiTagBootDev        mbiTagType = 5
+	mbiTagMmap           mbiTagType = 6
+	mbiTagVBE            mbiTagType = 7
+	mbiTagFramebuffer    mbiTagType = 8
+	mbiTagELFSections    mbiTagType = 9
+	mbiTagAPM            mbiTagType = 10
+	mbiTagEFI32          mbiTagType = 11
+	mbiTagEFI64          mbiTagType = 12
+	mbiTagSMBIOS         mbiTagType = 13
+	mbiTagACPIOld        mbiTagType = 14
+	mbiTagACPINew        mbiTagType = 15
+)
+
+// supportedMBITags are the boot information tags a kernel may request.
+//
+// Requested tags are provided when the information is available, e.g. there
+// is no framebuffer tag without a framebuffer.
+var supportedMBITags = map[mbiTagType]bool{
+	mbiTagCmdline:        true,
+	mbiTagBootLoaderName: true,
+	mbiTagModule:         true,
+	mbiTagBasicMeminfo:   true,
+	mbiTagMmap:           true,
+	mbiTagFramebuffer:    true,
+	mbiTagSMBIOS:         true,
+	mbiTagACPIOld:        true,
+	mbiTagACPINew:        true,
+}
+
+var (
+	getRSDP             = rsdp
+	getSMBIOSEntryPoint = func() ([]byte, error) {
+		return os.ReadFile("/sys/firmware/dmi/tables/smbios_entry_point")
+	}
+	getFramebuffer = func() (*framebufferInfo, error) {
+		return readFramebuffer("/dev/fb0")
+	}
+)
+
+func rsdp() ([]byte, error) {
+	r, err := acpi.GetRSDP()
+	if err != nil {
+		return nil, err
+	}
+	return r.AllData(), nil
+}
+
+// info2 is the Multiboot2 boot information passed to the loaded kernel.
+type info2 struct {
+	tags []mbiTag
+}
+
+type mbiTag interface {
+	typ() mbiTagType
+	marshal() []byte
+}
+
+// marshal writes out the boot information: its total size, a reserved
+// field, and 8-byte aligned tags terminated by an end tag.
+func (i *info2) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	// Total size, filled in below.
+	buf.Write32(0)
+	// Reserved.
+	buf.Write32(0)
+	for _, t := range append(i.tags, &mbiEnd{}) {
+		b := t.marshal()
+		buf.Write32(uint32(t.typ()))
+		// The tag size includes type and size, but not the padding.
+		buf.Write32(uint32(len(b)) + 8)
+		buf.WriteBytes(b)
+		buf.Align(8)
+	}
+	d := buf.Data()
+	ubinary.NativeEndian.PutUint32(d, uint32(len(d)))
+	return d
+}
+
+// has reports whether the boot information contains a tag of type t.
+func (i *info2) has(t mbiTagType) bool {
+	for _, tag := range i.tags {
+		if tag.typ() == t {
+			return true
+		}
+	}
+	return false
+}
+
+type mbiEnd struct{}
+
+func (*mbiEnd) typ() mbiTagType { return mbiTagEnd }
+func (*mbiEnd) marshal() []byte { return nil }
+
+// mbiString is a tag holding a null-terminated string.
+type mbiString struct {
+	t mbiTagType
+	s string
+}
+
+func (m *mbiString) typ() mbiTagType { return m.t }
+
+func (m *mbiString) marshal() []byte {
+	return append([]byte(m.s), 0)
+}
+
+// mbiData is a tag holding opaque data, e.g. a copy of the ACPI RSDP.
+type mbiData struct {
+	t    mbiTagType
+	data []byte
+}
+
+func (m *mbiData) typ() mbiTagType { return m.t }
+func (m *mbiData) marshal() []byte { return m.data }
+
+type mbiModule struct {
+	start   uint32
+	end     uint32
+	cmdline string
+}
+
+func (*mbiModule) typ() mbiTagType { return mbiTagModule }
+
+func (m *mbiModule) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(m.start)
+	buf.Write32(m.end)
+	buf.WriteBytes([]byte(m.cmdline))
+	buf.Write8(0)
+	return buf.Data()
+}
+
+type mbiBasicMeminfo struct {
+	// lower and upper memory in KiB.
+	lower uint32
+	upper uint32
+}
+
+func (*mbiBasicMeminfo) typ() mbiTagType { return mbiTagBasicMeminfo }
+
+func (m *mbiBasicMeminfo) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(m.lower)
+	buf.Write32(m.upper)
+	return buf.Data()
+}
+
+type mbiMmap memoryMaps
+
+func (mbiMmap) typ() mbiTagType { return mbiTagMmap }
+
+func (m mbiMmap) marshal() []byte {
+	const entrySize = 24
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write32(entrySize)
+	// Entry version.
+	buf.Write32(0)
+	for _, mm := range m {
+		buf.Write64(mm.BaseAddr)
+		buf.Write64(mm.Length)
+		buf.Write32(mm.Type)
+		// Reserved.
+		buf.Write32(0)
+	}
+	return buf.Data()
+}
+
+// framebufferInfo describes a linear direct color framebuffer.
+type framebufferInfo struct {
+	Addr   uint64
+	Pitch  uint32
+	Width  uint32
+	Height uint32
+	BPP    uint8
+
+	RedPos, RedSize     uint8
+	GreenPos, GreenSize uint8
+	BluePos, BlueSize   uint8
+}
+
+// framebufferTypeRGB is a direct color framebuffer.
+const framebufferTypeRGB = 1
+
+type mbiFramebuffer framebufferInfo
+
+func (*mbiFramebuffer) typ() mbiTagType { return mbiTagFramebuffer }
+
+func (m *mbiFramebuffer) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write64(m.Addr)
+	buf.Write32(m.Pitch)
+	buf.Write32(m.Width)
+	buf.Write32(m.Height)
+	buf.Write8(m.BPP)
+	buf.Write8(framebufferTypeRGB)
+	// Reserved.
+	buf.Write16(0)
+	buf.WriteBytes([]byte{m.RedPos, m.RedSize, m.GreenPos, m.GreenSize, m.BluePos, m.BlueSize})
+	return buf.Data()
+}
+
+type mbiSMBIOS struct {
+	major, minor uint8
+	// entry is the SMBIOS entry point structure.
+	entry []byte
+}
+
+func (*mbiSMBIOS) typ() mbiTagType { return mbiTagSMBIOS }
+
+func (m *mbiSMBIOS) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	buf.Write8(m.major)
+	buf.Write8(m.minor)
+	// Reserved.
+	buf.WriteBytes(make([]byte, 6))
+	buf.WriteBytes(m.entry)
+	return buf.Data()
+}
+
+// parseSMBIOSEntryPoint returns the version of a 32-bit or 64-bit SMBIOS
+// entry point structure.
+func parseSMBIOSEntryPoint(entry []byte) (*mbiSMBIOS, error) {
+	switch {
+	case bytes.HasPrefix(entry, []byte("_SM3_")) && len(entry) >= 9:
+		return &mbiSMBIOS{major: entry[7], minor: entry[8], entry: entry}, nil
+	case bytes.HasPrefix(entry, []byte("_SM_")) && len(entry) >= 8:
+		return &mbiSMBIOS{major: entry[6], minor: entry[7], entry: entry}, nil
+	}
+	return nil, fmt.Errorf("invalid SMBIOS entry point")
+}
+
+const (
+	rsdpV1Len       = 20
+	rsdpRevisionOff = 15
+)
+
+// firmwareTags returns the ACPI, SMBIOS and framebuffer tags that are
+// available on this machine.
+func firmwareTags() []mbiTag {
+	var tags []mbiTag
+	if fb, err := getFramebuffer(); err != nil {
+		log.Printf("No framebuffer for multiboot2 info: %v", err)
+	} else {
+		tags = append(tags, (*mbiFramebuffer)(fb))
+	}
+
+	if entry, err := getSMBIOSEntryPoint(); err != nil {
+		log.Printf("No SMBIOS for multiboot2 info: %v", err)
+	} else if s, err := parseSMBIOSEntryPoint(entry); err != nil {
+		log.Printf("No SMBIOS for multiboot2 info: %v", err)
+	} else {
+		tags = append(tags, s)
+	}
+
+	if r, err := getRSDP(); err != nil {
+		log.Printf("No ACPI RSDP for multiboot2 info: %v", err)
+	} else if len(r) >= rsdpV1Len {
+		// The first 20 bytes of any RSDP are a valid version 1 RSDP.
+		tags = append(tags, &mbiData{t: mbiTagACPIOld, data: r[:rsdpV1Len]})
+		if r[rsdpRevisionOff] >= 2 {
+			tags = append(tags, &mbiData{t: mbiTagACPINew, data: r})
+		}
+	}
+	return tags
+}
+
+// newInfo2 collects the Multiboot2 boot information. Modules are loaded
+// into kexec segments on the way.
+func (h *header2) newInfo2(m *multiboot) (*info2, error) {
+	mi := &info2{
+		tags: []mbiTag{
+			&mbiString{t: mbiTagCmdline, s: m.cmdLine},
+			&mbiString{t: mbiTagBootLoaderName, s: m.bootloader},
+		},
+	}
+
+	if len(m.modules) > 0 {
+		loaded, err := m.loadModules()
+		if err != nil {
+			return nil, err
+		}
+		for i, mod := range loaded {
+			mi.tags = append(mi.tags, &mbiModule{
+				start:   mod.Start,
+				end:     mod.End,
+				cmdline: m.modules[i].Cmdline,
+			})
+		}
+	}
+
+	lower, upper := m.memoryBoundaries()
+	mi.tags = append(mi.tags,
+		&mbiBasicMeminfo{lower: lower >> 10, upper: upper >> 10},
+		mbiMmap(m.memoryMap()),
+	)
+	mi.tags = append(mi.tags, firmwareTags()...)
+
+	for _, t := range h.infoRequests {
+		if !mi.has(t) && t != mbiTagModule {
+			log.Printf("Multiboot2 boot information tag %d was requested but is not available", t)
+		}
+	}
+	if h.framebuffer != nil && !mi.has(mbiTagFramebuffer) {
+		log.Printf("Multiboot2 kernel prefers a %dx%dx%d framebuffer, but there is none", h.framebuffer.Width, h.framebuffer.Height, h.framebuffer.Depth)
+	}
+	return mi, nil
+}
+
+// addInfo collects and adds the Multiboot2 boot information into the
+// segments.
+//
+// The format is described in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Boot-information-format
+func (h *header2) addInfo(m *multiboot) (addr uintptr, err error) {
+	mi, err := h.newInfo2(m)
+	if err != nil {
+		return 0, err
+	}
+	r, err := m.mem.AddKexecSegment(mi.marshal())
+	if err != nil {
+		return 0, err
+	}
+	return r.Start, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/boot/kexec"
+)
+
+func TestInfo2Marshal(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mi   *info2
+		want []byte
+	}{
+		{
+			name: "no tags",
+			mi:   &info2{},
+			want: []byte{
+				// total size, reserved
+				16, 0, 0, 0, 0, 0, 0, 0,
+				// end tag
+				0, 0, 0, 0, 8, 0, 0, 0,
+			},
+		},
+		{
+			name: "cmdline and module",
+			mi: &info2{
+				tags: []mbiTag{
+					&mbiString{t: mbiTagCmdline, s: "ab"},
+					&mbiModule{start: 0x1000, end: 0x2000, cmdline: "m"},
+				},
+			},
+			want: []byte{
+				56, 0, 0, 0, 0, 0, 0, 0,
+				// cmdline, 11 bytes and padding
+				1, 0, 0, 0, 11, 0, 0, 0,
+				'a', 'b', 0, 0, 0, 0, 0, 0,
+				// module, 18 bytes and padding
+				3, 0, 0, 0, 18, 0, 0, 0,
+				0, 0x10, 0, 0, 0, 0x20, 0, 0,
+				'm', 0, 0, 0, 0, 0, 0, 0,
+				// end tag
+				0, 0, 0, 0, 8, 0, 0, 0,
+			},
+		},
+		{
+			name: "memory map",
+			mi: &info2{
+				tags: []mbiTag{
+					mbiMmap{{BaseAddr: 0x1000, Length: 0x9f000, Type: 1}},
+				},
+			},
+			want: []byte{
+				56, 0, 0, 0, 0, 0, 0, 0,
+				6, 0, 0, 0, 40, 0, 0, 0,
+				// entry size, entry version
+				24, 0, 0, 0, 0, 0, 0, 0,
+				0, 0x10, 0, 0, 0, 0, 0, 0,
+				0, 0xf0, 0x09, 0, 0, 0, 0, 0,
+				1, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 8, 0, 0, 0,
+			},
+		},
+		{
+			name: "framebuffer",
+			mi: &info2{
+				tags: []mbiTag{
+					&mbiFramebuffer{
+						Addr:      0xfd000000,
+						Pitch:     4096,
+						Width:     1024,
+						Height:    768,
+						BPP:       32,
+						RedPos:    16,
+						RedSize:   8,
+						GreenPos:  8,
+						GreenSize: 8,
+						BluePos:   0,
+						BlueSize:  8,
+					},
+				},
+			},
+			want: []byte{
+				56, 0, 0, 0, 0, 0, 0, 0,
+				8, 0, 0, 0, 38, 0, 0, 0,
+				0, 0, 0, 0xfd, 0, 0, 0, 0,
+				0, 0x10, 0, 0, 0, 4, 0, 0,
+				0, 3, 0, 0, 32, framebufferTypeRGB, 0, 0,
+				16, 8, 8, 8, 0, 8, 0, 0,
+				0, 0, 0, 0, 8, 0, 0, 0,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.mi.marshal()
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("marshal() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSMBIOSEntryPoint(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		entry        []byte
+		major, minor uint8
+		err          bool
+	}{
+		{name: "32-bit", entry: []byte("_SM_\x00\x1f\x02\x08"), major: 2, minor: 8},
+		{name: "64-bit", entry: []byte("_SM3_\x00\x18\x03\x04"), major: 3, minor: 4},
+		{name: "short", entry: []byte("_SM3_"), err: true},
+		{name: "garbage", entry: []byte("_DMI_\x00\x00\x00\x00"), err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSMBIOSEntryPoint(tt.entry)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseSMBIOSEntryPoint() = %v, want error %t", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got.major != tt.major || got.minor != tt.minor {
+				t.Errorf("parseSMBIOSEntryPoint() = %d.%d, want %d.%d", got.major, got.minor, tt.major, tt.minor)
+			}
+		})
+	}
+}
+
+func TestNewInfo2(t *testing.T) {
+	rsdpv2 := make([]byte, 36)
+	copy(rsdpv2, "RSD PTR ")
+	rsdpv2[rsdpRevisionOff] = 2
+	smbiosEntry := []byte("_SM3_\x00\x18\x03\x04\x00")
+	fb := &framebufferInfo{Addr: 0xfd000000, Width: 800, Height: 600, BPP: 32, Pitch: 3200}
+
+	defer func(r, s func() ([]byte, error), f func() (*framebufferInfo, error)) {
+		getRSDP, getSMBIOSEntryPoint, getFramebuffer = r, s, f
+	}(getRSDP, getSMBIOSEntryPoint, getFramebuffer)
+	getRSDP = func() ([]byte, error) { return rsdpv2, nil }
+	getSMBIOSEntryPoint = func() ([]byte, error) { return smbiosEntry, nil }
+	getFramebuffer = func() (*framebufferInfo, error) { return fb, nil }
+
+	m := &multiboot{
+		cmdLine:    "console=ttyS0",
+		bootloader: bootloader,
+		modules: []Module{
+			{Module: bytes.NewReader([]byte("module data")), Cmdline: "mod arg"},
+		},
+		mem: kexec.Memory{
+			Phys: kexec.MemoryMap{
+				{Range: kexec.Range{Start: 0, Size: 0x9f000}, Type: kexec.RangeRAM},
+				{Range: kexec.Range{Start: 0x100000, Size: 0x7f00000}, Type: kexec.RangeRAM},
+				{Range: kexec.Range{Start: 0x8000000, Size: 0x10000}, Type: kexec.RangeACPI},
+			},
+		},
+	}
+	h := &header2{infoRequests: []mbiTagType{mbiTagFramebuffer, mbiTagACPINew}}
+
+	mi, err := h.newInfo2(m)
+	if err != nil {
+		t.Fatalf("newInfo2() = %v", err)
+	}
+	if len(m.loadedModules) != 1 {
+		t.Fatalf("newInfo2() loaded %d modules, want 1", len(m.loadedModules))
+	}
+	mod := m.loadedModules[0]
+
+	want := []mbiTag{
+		&mbiString{t: mbiTagCmdline, s: "console=ttyS0"},
+		&mbiString{t: mbiTagBootLoaderName, s: bootloader},
+		&mbiModule{start: mod.Start, end: mod.End, cmdline: "mod arg"},
+		&mbiBasicMeminfo{lower: 0x9f000 >> 10, upper: 0x7f00000 >> 10},
+		mbiMmap{
+			{Size: 20, BaseAddr: 0, Length: 0x9f000, Type: 1},
+			{Size: 20, BaseAddr: 0x100000, Length: 0x7f00000, Type: 1},
+			{Size: 20, BaseAddr: 0x8000000, Length: 0x10000, Type: 3},
+		},
+		(*mbiFramebuffer)(fb),
+		&mbiSMBIOS{major: 3, minor: 4, entry: smbiosEntry},
+		&mbiData{t: mbiTagACPIOld, data: rsdpv2[:rsdpV1Len]},
+		&mbiData{t: mbiTagACPINew, data: rsdpv2},
+	}
+	opts := cmp.AllowUnexported(mbiString{}, mbiModule{}, mbiBasicMeminfo{}, mbiSMBIOS{}, mbiData{})
+	if diff := cmp.Diff(want, mi.tags, opts); diff != "" {
+		t.Errorf("newInfo2() mismatch (-want +got):\n%s", diff)
+	}
+	if mod.End-mod.Start != uint32(len("module data")) || mod.Start%4096 != 0 {
+		t.Errorf("module loaded at [%#x, %#x), want page aligned %d bytes", mod.Start, mod.End, len("module data"))
+	}
+}
@@ -3,7 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // Package multiboot implements bootloading multiboot kernels as defined by
-// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html.
+// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html and
+// multiboot2 kernels as defined by
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html.
 //
 // Package multiboot crafts kexec segments that can be used with the kexec_load
 // system call.
@@ -61,6 +63,7 @@ type multiboot struct {
 	// trampoline is a path to an executable blob, which contains a trampoline segment.
 	// Trampoline sets machine to a specific state defined by multiboot v1 spec.
 	// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html#Machine-state.
+	// The i386 machine state of multiboot2 is the same, but for the magic.
 	trampoline string
 
 	// EntryPoint is a pointer to trampoline.
@@ -130,18 +133,42 @@ func (m memoryMaps) String() string {
 	return strings.Join(s, "\n")
 }
 
-// Probe checks if `kernel` is multiboot v1 or esxBootInfo kernel.
+// Probe checks if `kernel` is multiboot v1, multiboot2 or esxBootInfo kernel.
 // If the `kernel` is gzip'ed, it will decompress it.
 // Only Gzip decmpression is supported at present.
 func Probe(kernel io.ReaderAt) error {
-	r := util.TryGzipFilter(kernel)
-	_, err := parseHeader(uio.Reader(r))
-	if err == ErrHeaderNotFound {
-		_, err = parseMutiHeader(uio.Reader(r))
-	}
+	_, err := parseImageHeader(util.TryGzipFilter(kernel))
 	return err
 }
 
+// parseImageHeader finds the header of a multiboot2, multiboot v1 or
+// esxBootInfo kernel, in that order of preference. Kernels such as Xen carry
+// both multiboot headers; multiboot2 can pass more information, e.g. the
+// ACPI RSDP.
+func parseImageHeader(kernel io.ReaderAt) (imageType, error) {
+	multiboot2Header, err := parseHeader2(uio.Reader(kernel))
+	if err == nil {
+		return multiboot2Header, nil
+	}
+	if err != ErrHeaderNotFound {
+		return nil, err
+	}
+	multibootHeader, err := parseHeader(uio.Reader(kernel))
+	if err == nil {
+		return multibootHeader, nil
+	}
+	if err != ErrHeaderNotFound {
+		return nil, err
+	}
+	// We don't even need the header at the moment. Just need to
+	// know it's there. Everything that matters is in the ELF.
+	esxBootInfoHeader, err := parseMutiHeader(uio.Reader(kernel))
+	if err != nil {
+		return nil, err
+	}
+	return esxBootInfoHeader, nil
+}
+
 // newMB returns a new multiboot instance.
 func newMB(kernel io.ReaderAt, cmdLine string, modules []Module) (*multiboot, error) {
 	// Trampoline should be a part of current binary.
@@ -261,33 +288,40 @@ func (m *multiboot) load(debug bool, ibft *ibft.IBFT) error {
 	// TODO: the kernel is opened like 4 separate times here. Just open it
 	// once and pass it around.
 
-	var header imageType
-	multibootHeader, err := parseHeader(uio.Reader(m.kernel))
-	if err == nil {
-		header = multibootHeader
-	} else if err == ErrHeaderNotFound {
-		var esxBootInfoHeader *esxBootInfoHeader
-		// We don't even need the header at the moment. Just need to
-		// know it's there. Everything that matters is in the ELF.
-		esxBootInfoHeader, err = parseMutiHeader(uio.Reader(m.kernel))
-		header = esxBootInfoHeader
-	}
+	header, err := parseImageHeader(m.kernel)
 	if err != nil {
 		return fmt.Errorf("error parsing headers: %v", err)
 	}
 	log.Printf("Found %s image", header.name())
 
-	log.Printf("Getting kernel entry point")
-	kernelEntry, err := getEntryPoint(m.kernel)
-	if err != nil {
-		return fmt.Errorf("error getting kernel entry point: %v", err)
-	}
-	log.Printf("Kernel entry point at %#x", kernelEntry)
+	// A multiboot2 address tag describes a non-ELF image, and an entry
+	// address tag overrides the ELF entry point.
+	h2, _ := header.(*header2)
+	var kernelEntry uintptr
+	if h2 != nil && h2.address != nil {
+		if h2.entry == nil {
+			return fmt.Errorf("multiboot2 address tag without entry address tag")
+		}
+		log.Printf("Loading kernel at %#x", h2.address.LoadAddr)
+		if err := h2.loadAddress(m); err != nil {
+			return fmt.Errorf("error loading kernel: %v", err)
+		}
+	} else {
+		log.Printf("Getting kernel entry point")
+		kernelEntry, err = getEntryPoint(m.kernel)
+		if err != nil {
+			return fmt.Errorf("error getting kernel entry point: %v", err)
+		}
 
-	log.Printf("Parsing ELF segments")
-	if _, err := m.mem.LoadElfSegments(m.kernel); err != nil {
-		return fmt.Errorf("error loading ELF segments: %v", err)
+		log.Printf("Parsing ELF segments")
+		if _, err := m.mem.LoadElfSegments(m.kernel); err != nil {
+			return fmt.Errorf("error loading ELF segments: %v", err)
+		}
+	}
+	if h2 != nil && h2.entry != nil {
+		kernelEntry = uintptr(*h2.entry)
 	}
+	log.Printf("Kernel entry point at %#x", kernelEntry)
 
 	log.Printf("Parsing memory map")
 	memmap, err := kexec.MemoryMapFromSysfsMemmap()
@@ -0,0 +1,434 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secureboot
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/u-root/u-root/pkg/boot"
+)
+
+var (
+	// ErrNotPE is returned for images that are not PE images.
+	ErrNotPE = errors.New("not a PE image")
+	// ErrBadAuthenticode is returned for malformed Authenticode signatures.
+	ErrBadAuthenticode = errors.New("bad Authenticode signature")
+	// ErrForbidden is returned for images whose hash or signing certificate
+	// is in dbx.
+	ErrForbidden = errors.New("forbidden by dbx")
+	// ErrUntrusted is returned for images that are neither signed by a
+	// certificate in db nor have their hash in it.
+	ErrUntrusted = errors.New("not trusted by db")
+)
+
+// Authenticode verifies Authenticode signatures of PE images, like UEFI
+// firmware does with its db and dbx.
+//
+// An image is trusted if it has a signature chaining up to a certificate in
+// DB, or its SHA-256 Authenticode hash is in DB. It is not if its hash or
+// any certificate of a signature is in DBX. Authenticode covers kernels and
+// UKIs, whose signature includes their initrd, but not separate initrds.
+type Authenticode struct {
+	DB  *Database
+	DBX *Database
+}
+
+var _ boot.Verifier = &Authenticode{}
+
+const (
+	winCertRevision2          = 0x0200
+	winCertTypePKCSSignedData = 0x0002
+
+	pe32Magic     = 0x10b
+	pe32PlusMagic = 0x20b
+
+	// certTableIndex is the index of the certificate table in the data
+	// directories of the optional header.
+	certTableIndex = 4
+)
+
+// peImage is a PE image with the locations of what the Authenticode hash
+// leaves out.
+type peImage struct {
+	data []byte
+	// checksum is the offset of the checksum in the optional header.
+	checksum int
+	// certDir is the offset of the data directory entry of the
+	// certificate table, or 0 if there is none.
+	certDir int
+	// certOff is the offset of the certificate table.
+	certOff int
+	certs   []byte
+}
+
+func parsePE(b []byte) (*peImage, error) {
+	le := binary.LittleEndian
+	if len(b) < 0x40 || string(b[:2]) != "MZ" {
+		return nil, ErrNotPE
+	}
+	pe := int(le.Uint32(b[0x3c:]))
+	// The PE signature is followed by the 20 bytes COFF header.
+	opt := pe + 24
+	if pe < 0x40 || opt > len(b) || string(b[pe:pe+4]) != "PE\x00\x00" {
+		return nil, ErrNotPE
+	}
+	optSize := int(le.Uint16(b[pe+20:]))
+	if optSize < 2 || opt+optSize > len(b) {
+		return nil, fmt.Errorf("%w: optional header of %d bytes", ErrNotPE, optSize)
+	}
+
+	var numDirs, dirs int
+	switch le.Uint16(b[opt:]) {
+	case pe32Magic:
+		numDirs, dirs = opt+92, opt+96
+	case pe32PlusMagic:
+		numDirs, dirs = opt+108, opt+112
+	default:
+		return nil, fmt.Errorf("%w: optional header magic %#x", ErrNotPE, le.Uint16(b[opt:]))
+	}
+	if dirs > opt+optSize {
+		return nil, fmt.Errorf("%w: optional header of %d bytes", ErrNotPE, optSize)
+	}
+
+	img := &peImage{data: b, checksum: opt + 64, certOff: len(b)}
+	certDir := dirs + certTableIndex*8
+	if le.Uint32(b[numDirs:]) <= certTableIndex || certDir+8 > opt+optSize {
+		return img, nil
+	}
+	img.certDir = certDir
+	off, size := int(le.Uint32(b[certDir:])), int(le.Uint32(b[certDir+4:]))
+	if size == 0 {
+		return img, nil
+	}
+	if off < opt+optSize || off > len(b) || size > len(b)-off {
+		return nil, fmt.Errorf("%w: certificate table at %#x of %d bytes", ErrNotPE, off, size)
+	}
+	img.certOff, img.certs = off, b[off:off+size]
+	return img, nil
+}
+
+// hash returns the Authenticode hash of the image: the hash of everything
+// but the checksum, the certificate table and its data directory entry.
+func (img *peImage) hash(h crypto.Hash) []byte {
+	d := h.New()
+	b := img.data
+	d.Write(b[:img.checksum])
+	if img.certDir == 0 {
+		d.Write(b[img.checksum+4:])
+	} else {
+		d.Write(b[img.checksum+4 : img.certDir])
+		d.Write(b[img.certDir+8 : img.certOff])
+		d.Write(b[img.certOff+len(img.certs):])
+	}
+	return d.Sum(nil)
+}
+
+// signatures returns the PKCS #7 signatures of the certificate table.
+func (img *peImage) signatures() ([][]byte, error) {
+	le := binary.LittleEndian
+	var sigs [][]byte
+	for b := img.certs; len(b) >= 8; {
+		length := int(le.Uint32(b))
+		if length < 8 || length > len(b) {
+			return nil, fmt.Errorf("%w: WIN_CERTIFICATE of %d bytes", ErrBadAuthenticode, length)
+		}
+		if le.Uint16(b[4:]) == winCertRevision2 && le.Uint16(b[6:]) == winCertTypePKCSSignedData {
+			sigs = append(sigs, b[8:length])
+		}
+		// Entries are 8 byte aligned.
+		b = b[min(len(b), (length+7)&^7):]
+	}
+	return sigs, nil
+}
+
+var (
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSpcIndirectData = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+func digestHash(alg pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	switch {
+	case alg.Algorithm.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case alg.Algorithm.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case alg.Algorithm.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported digest algorithm %v", ErrBadAuthenticode, alg.Algorithm)
+}
+
+// PKCS #7 structures of Authenticode signatures. Explicitly tagged content
+// is kept as a RawValue of the tag, whose Bytes are the content.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type digestInfo struct {
+	DigestAlgorithm pkix.AlgorithmIdentifier
+	Digest          []byte
+}
+
+type spcIndirectDataContent struct {
+	Data          asn1.RawValue
+	MessageDigest digestInfo
+}
+
+// unmarshal parses exactly one DER value.
+func unmarshal(b []byte, v any, params string) error {
+	rest, err := asn1.UnmarshalWithParams(b, v, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadAuthenticode, err)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrBadAuthenticode, len(rest))
+	}
+	return nil
+}
+
+// signedAttributes returns the DER encoded authenticated attributes, which
+// are what the signer signs, and the values of the content type and message
+// digest attributes.
+func signedAttributes(si *signerInfo) ([]byte, asn1.ObjectIdentifier, []byte, error) {
+	if len(si.AuthenticatedAttributes.FullBytes) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: no authenticated attributes", ErrBadAuthenticode)
+	}
+	// They are signed as a SET OF, not with their implicit tag.
+	signed := append([]byte{0x31}, si.AuthenticatedAttributes.FullBytes[1:]...)
+	var attrs []attribute
+	if err := unmarshal(signed, &attrs, "set"); err != nil {
+		return nil, nil, nil, err
+	}
+	var contentType asn1.ObjectIdentifier
+	var digest []byte
+	for _, a := range attrs {
+		var err error
+		switch {
+		case a.Type.Equal(oidContentType):
+			err = unmarshal(a.Values.Bytes, &contentType, "")
+		case a.Type.Equal(oidMessageDigest):
+			err = unmarshal(a.Values.Bytes, &digest, "")
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if digest == nil {
+		return nil, nil, nil, fmt.Errorf("%w: no message digest", ErrBadAuthenticode)
+	}
+	return signed, contentType, digest, nil
+}
+
+// checkSignature checks that sig is a signature of the hash of data by
+// cert's key.
+func checkSignature(cert *x509.Certificate, h crypto.Hash, data, sig []byte) error {
+	d := h.New()
+	d.Write(data)
+	digest := d.Sum(nil)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, h, digest, sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return fmt.Errorf("ECDSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported public key %T", ErrBadAuthenticode, cert.PublicKey)
+}
+
+// verifySignature verifies the PKCS #7 signature sig of img, and that its
+// signer chains up to a certificate in db. It returns ErrForbidden if a
+// certificate of the signature is in dbx.
+func (a *Authenticode) verifySignature(img *peImage, sig []byte) error {
+	var ci contentInfo
+	// The signature may be followed by padding.
+	if _, err := asn1.Unmarshal(sig, &ci); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadAuthenticode, err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return fmt.Errorf("%w: content type %v is not signed data", ErrBadAuthenticode, ci.ContentType)
+	}
+	var sd signedData
+	if err := unmarshal(ci.Content.Bytes, &sd, ""); err != nil {
+		return err
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidSpcIndirectData) {
+		return fmt.Errorf("%w: content type %v is not SPC indirect data", ErrBadAuthenticode, sd.ContentInfo.ContentType)
+	}
+	var content asn1.RawValue
+	if err := unmarshal(sd.ContentInfo.Content.Bytes, &content, ""); err != nil {
+		return err
+	}
+	var idc spcIndirectDataContent
+	if err := unmarshal(content.FullBytes, &idc, ""); err != nil {
+		return err
+	}
+	h, err := digestHash(idc.MessageDigest.DigestAlgorithm)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(idc.MessageDigest.Digest, img.hash(h)) {
+		return fmt.Errorf("%w: image hash mismatch", ErrBadAuthenticode)
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadAuthenticode, err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return fmt.Errorf("%w: %d signers", ErrBadAuthenticode, len(sd.SignerInfos))
+	}
+	si := &sd.SignerInfos[0]
+	var signer *x509.Certificate
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, si.IssuerAndSerialNumber.Issuer.FullBytes) && c.SerialNumber.Cmp(si.IssuerAndSerialNumber.SerialNumber) == 0 {
+			signer = c
+			break
+		}
+	}
+	if signer == nil {
+		return fmt.Errorf("%w: no signer certificate", ErrBadAuthenticode)
+	}
+
+	// The signer signs the authenticated attributes, which include the
+	// digest of the content, which includes the image hash.
+	h, err = digestHash(si.DigestAlgorithm)
+	if err != nil {
+		return err
+	}
+	signed, contentType, digest, err := signedAttributes(si)
+	if err != nil {
+		return err
+	}
+	if contentType != nil && !contentType.Equal(oidSpcIndirectData) {
+		return fmt.Errorf("%w: signed content type %v", ErrBadAuthenticode, contentType)
+	}
+	d := h.New()
+	d.Write(content.Bytes)
+	if !bytes.Equal(digest, d.Sum(nil)) {
+		return fmt.Errorf("%w: content digest mismatch", ErrBadAuthenticode)
+	}
+	if err := checkSignature(signer, h, signed, si.EncryptedDigest); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadAuthenticode, err)
+	}
+
+	if a.DBX.containsCert(signer) {
+		return fmt.Errorf("%w: signer %q", ErrForbidden, signer.Subject)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	if a.DB != nil {
+		for _, c := range a.DB.Certs {
+			roots.AddCert(c)
+		}
+	}
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	// UEFI does not check validity periods, which Go does. The signer was
+	// at least valid when it was issued.
+	chains, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   signer.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: signer %q: %w", ErrUntrusted, signer.Subject, err)
+	}
+	for _, chain := range chains {
+		for _, c := range chain {
+			if a.DBX.containsCert(c) {
+				return fmt.Errorf("%w: certificate %q", ErrForbidden, c.Subject)
+			}
+		}
+	}
+	return nil
+}
+
+// Verify implements boot.Verifier. Only kernels and UKIs are PE images;
+// other components are not covered.
+func (a *Authenticode) Verify(c boot.Component) error {
+	if c.Kind != "kernel" && c.Kind != "uki" {
+		return fmt.Errorf("%w: %s is not signed with Authenticode", boot.ErrNotCovered, c.Kind)
+	}
+	img, err := parsePE(c.Data)
+	if err != nil {
+		return err
+	}
+	sum := img.hash(crypto.SHA256)
+	if a.DBX.containsHash(sum) {
+		return fmt.Errorf("%w: image hash %x", ErrForbidden, sum)
+	}
+	sigs, err := img.signatures()
+	if err != nil {
+		return err
+	}
+
+	trusted := false
+	var errs []error
+	for _, sig := range sigs {
+		err := a.verifySignature(img, sig)
+		if errors.Is(err, ErrForbidden) {
+			return err
+		}
+		if err == nil {
+			trusted = true
+		}
+		errs = append(errs, err)
+	}
+	if trusted || a.DB.containsHash(sum) {
+		return nil
+	}
+	if len(sigs) == 0 {
+		return fmt.Errorf("%w: image is not signed", ErrUntrusted)
+	}
+	return errors.Join(errs...)
+}
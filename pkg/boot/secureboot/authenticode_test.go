@@ -0,0 +1,312 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secureboot
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot"
+)
+
+var serial int64
+
+// newCert returns a certificate for key signed by parent, or self-signed if
+// parent is nil.
+func newCert(t *testing.T, name string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// peFile returns a minimal PE32+ image with some data after the headers.
+func peFile(data string) []byte {
+	const optSize = 112 + 16*8
+	b := make([]byte, 0x40+24+optSize)
+	copy(b, "MZ")
+	binary.LittleEndian.PutUint32(b[0x3c:], 0x40)
+	copy(b[0x40:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(b[0x40+20:], optSize)
+	opt := b[0x40+24:]
+	binary.LittleEndian.PutUint16(opt, pe32PlusMagic)
+	binary.LittleEndian.PutUint32(opt[64:], 0x1234)
+	binary.LittleEndian.PutUint32(opt[108:], 16)
+	b = append(b, data...)
+	// The certificate table is 8 byte aligned.
+	return append(b, make([]byte, (8-len(b)%8)%8)...)
+}
+
+func explicit(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// sign appends an Authenticode signature of img by key and its certificate
+// chain to img.
+func sign(t *testing.T, img []byte, key crypto.Signer, chain ...*x509.Certificate) []byte {
+	t.Helper()
+	pe, err := parsePE(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	content := mustMarshal(t, spcIndirectDataContent{
+		Data:          asn1.RawValue{FullBytes: mustMarshal(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}})},
+		MessageDigest: digestInfo{DigestAlgorithm: sha256Alg, Digest: pe.hash(crypto.SHA256)},
+	})
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(content, &raw); err != nil {
+		t.Fatal(err)
+	}
+	contentDigest := sha256.Sum256(raw.Bytes)
+
+	attr := func(oid asn1.ObjectIdentifier, v any) attribute {
+		return attribute{Type: oid, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, v)}}
+	}
+	attrs, err := asn1.MarshalWithParams([]attribute{
+		attr(oidContentType, oidSpcIndirectData),
+		attr(oidMessageDigest, contentDigest[:]),
+	}, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(attrs)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certs []byte
+	for _, c := range chain {
+		certs = append(certs, c.Raw...)
+	}
+	sd := mustMarshal(t, signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		ContentInfo:      contentInfo{ContentType: oidSpcIndirectData, Content: explicit(content)},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []signerInfo{{
+			Version:                 1,
+			IssuerAndSerialNumber:   issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: chain[0].RawIssuer}, SerialNumber: chain[0].SerialNumber},
+			DigestAlgorithm:         sha256Alg,
+			AuthenticatedAttributes: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs[2:]},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+			},
+			EncryptedDigest: sig,
+		}},
+	})
+	p7 := mustMarshal(t, contentInfo{ContentType: oidSignedData, Content: explicit(sd)})
+
+	// A WIN_CERTIFICATE with the signature, padded to 8 bytes.
+	winCert := binary.LittleEndian.AppendUint32(nil, uint32(8+len(p7)))
+	winCert = binary.LittleEndian.AppendUint16(winCert, winCertRevision2)
+	winCert = binary.LittleEndian.AppendUint16(winCert, winCertTypePKCSSignedData)
+	winCert = append(winCert, p7...)
+	winCert = append(winCert, make([]byte, (8-len(winCert)%8)%8)...)
+
+	off, size := len(img), 0
+	if pe.certs != nil {
+		off, size = pe.certOff, len(pe.certs)
+	}
+	signed := append(append([]byte{}, img...), winCert...)
+	binary.LittleEndian.PutUint32(signed[pe.certDir:], uint32(off))
+	binary.LittleEndian.PutUint32(signed[pe.certDir+4:], uint32(size+len(winCert)))
+	return signed
+}
+
+func TestAuthenticode(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := newCert(t, "root", rootKey, nil, nil)
+	signer := newCert(t, "signer", signerKey, root, rootKey)
+	other := newCert(t, "other", otherKey, nil, nil)
+
+	unsigned := peFile("kernel")
+	signed := sign(t, unsigned, signerKey, signer, root)
+	pe, err := parsePE(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := [sha256.Size]byte(pe.hash(crypto.SHA256))
+
+	tampered := append([]byte{}, signed...)
+	copy(tampered[len(unsigned)-8:], "evil")
+	// The checksum is not signed.
+	checksummed := append([]byte{}, signed...)
+	binary.LittleEndian.PutUint32(checksummed[pe.checksum:], 0x5678)
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		db   *Database
+		dbx  *Database
+		err  error
+	}{
+		{
+			name: "signed by root",
+			data: signed,
+			db:   &Database{Certs: []*x509.Certificate{other, root}},
+		},
+		{
+			name: "signed by signer",
+			data: signed,
+			db:   &Database{Certs: []*x509.Certificate{signer}},
+		},
+		{
+			name: "checksum changed",
+			data: checksummed,
+			db:   &Database{Certs: []*x509.Certificate{root}},
+		},
+		{
+			name: "two signatures",
+			data: sign(t, signed, otherKey, other),
+			db:   &Database{Certs: []*x509.Certificate{root}},
+		},
+		{
+			name: "unknown signer",
+			data: signed,
+			db:   &Database{Certs: []*x509.Certificate{other}},
+			err:  ErrUntrusted,
+		},
+		{
+			name: "empty db",
+			data: signed,
+			err:  ErrUntrusted,
+		},
+		{
+			name: "tampered",
+			data: tampered,
+			db:   &Database{Certs: []*x509.Certificate{root}},
+			err:  ErrBadAuthenticode,
+		},
+		{
+			name: "unsigned",
+			data: unsigned,
+			db:   &Database{Certs: []*x509.Certificate{root}},
+			err:  ErrUntrusted,
+		},
+		{
+			name: "unsigned hash in db",
+			data: unsigned,
+			db:   &Database{Hashes: [][sha256.Size]byte{sum}},
+		},
+		{
+			name: "hash in dbx",
+			data: signed,
+			db:   &Database{Certs: []*x509.Certificate{root}},
+			dbx:  &Database{Hashes: [][sha256.Size]byte{sum}},
+			err:  ErrForbidden,
+		},
+		{
+			name: "signer in dbx",
+			data: signed,
+			db:   &Database{Certs: []*x509.Certificate{root}},
+			dbx:  &Database{Certs: []*x509.Certificate{signer}},
+			err:  ErrForbidden,
+		},
+		{
+			name: "root hash in dbx",
+			data: signed,
+			db:   &Database{Certs: []*x509.Certificate{root}},
+			dbx:  &Database{CertHashes: [][sha256.Size]byte{sha256.Sum256(root.RawTBSCertificate)}},
+			err:  ErrForbidden,
+		},
+		{
+			name: "not PE",
+			data: []byte("kernel"),
+			err:  ErrNotPE,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticode{DB: tt.db, DBX: tt.dbx}
+			if err := a.Verify(boot.Component{Kind: "kernel", Data: tt.data}); !errors.Is(err, tt.err) {
+				t.Errorf("Verify = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	a := &Authenticode{DB: &Database{Certs: []*x509.Certificate{root}}}
+	if err := a.Verify(boot.Component{Kind: "uki", Data: signed}); err != nil {
+		t.Errorf("Verify(uki) = %v", err)
+	}
+	if err := a.Verify(boot.Component{Kind: "initrd", Data: []byte("initrd")}); !errors.Is(err, boot.ErrNotCovered) {
+		t.Errorf("Verify(initrd) = %v, want %v", err, boot.ErrNotCovered)
+	}
+}
+
+func TestParsePE(t *testing.T) {
+	pe := peFile("kernel")
+	for _, tt := range []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"truncated", func(b []byte) []byte { return b[:0x50] }},
+		{"no MZ", func(b []byte) []byte { b[0] = 'X'; return b }},
+		{"no PE", func(b []byte) []byte { b[0x41] = 'X'; return b }},
+		{"bad magic", func(b []byte) []byte { b[0x40+24] = 0; return b }},
+		{"certificate table out of bounds", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[0x40+24+112+32:], uint32(len(b)-4))
+			binary.LittleEndian.PutUint32(b[0x40+24+112+36:], 8)
+			return b
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePE(tt.modify(append([]byte{}, pe...))); !errors.Is(err, ErrNotPE) {
+				t.Errorf("parsePE = %v, want %v", err, ErrNotPE)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secureboot implements boot.Verifiers to only load trusted OS
+// images: Authenticode signed PE kernels checked against UEFI's db and dbx,
+// and detached ed25519 and OpenPGP signatures.
+package secureboot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/crypto"
+	"github.com/u-root/u-root/pkg/vfile"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	// ErrNoSignature is returned for components without a detached
+	// signature.
+	ErrNoSignature = errors.New("no detached signature")
+	// ErrBadSignature is returned for components whose detached signature
+	// is not from a trusted key.
+	ErrBadSignature = errors.New("signature verification failed")
+)
+
+// signatureSuffix is appended to the name of a component to get the file
+// holding its detached signature.
+const signatureSuffix = ".sig"
+
+// detachedSignature reads the detached signature of c.
+func detachedSignature(c boot.Component) ([]byte, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("%w: %s has no file name", ErrNoSignature, c.Kind)
+	}
+	sig, err := os.ReadFile(c.Name + signatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoSignature, err)
+	}
+	return sig, nil
+}
+
+// Ed25519 verifies detached ed25519 signatures, which are next to the
+// signed files with a .sig suffix. Signatures are of the data itself, as
+// ed25519.Sign makes them.
+type Ed25519 struct {
+	Keys []ed25519.PublicKey
+}
+
+var _ boot.Verifier = &Ed25519{}
+
+// LoadEd25519 returns a verifier of signatures by the PEM encoded public
+// keys in files, as pkg/crypto writes them.
+func LoadEd25519(files ...string) (*Ed25519, error) {
+	e := &Ed25519{}
+	for _, f := range files {
+		key, err := crypto.LoadPublicKeyFromFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s: ed25519 public key of %d bytes, want %d", f, len(key), ed25519.PublicKeySize)
+		}
+		e.Keys = append(e.Keys, key)
+	}
+	return e, nil
+}
+
+// Verify implements boot.Verifier.
+func (e *Ed25519) Verify(c boot.Component) error {
+	sig, err := detachedSignature(c)
+	if err != nil {
+		return err
+	}
+	for _, key := range e.Keys {
+		if ed25519.Verify(key, c.Data, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrBadSignature, c.Name)
+}
+
+// GPG verifies detached OpenPGP signatures, which are next to the signed
+// files with a .sig suffix.
+type GPG struct {
+	KeyRing openpgp.KeyRing
+}
+
+var _ boot.Verifier = &GPG{}
+
+// LoadGPG returns a verifier of signatures by the keys in the key ring
+// file.
+func LoadGPG(file string) (*GPG, error) {
+	ring, err := vfile.GetKeyRing(file)
+	if err != nil {
+		return nil, err
+	}
+	return &GPG{KeyRing: ring}, nil
+}
+
+// Verify implements boot.Verifier.
+func (g *GPG) Verify(c boot.Component) error {
+	sig, err := detachedSignature(c)
+	if err != nil {
+		return err
+	}
+	return vfile.CheckSignature(g.KeyRing, c.Name, bytes.NewReader(c.Data), bytes.NewReader(sig))
+}
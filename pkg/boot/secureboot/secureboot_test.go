@@ -0,0 +1,132 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secureboot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/vfile"
+	"golang.org/x/crypto/ed25519"
+)
+
+func writeFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEd25519(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	v, err := LoadEd25519(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("kernel")
+	sum := sha256.Sum256(data)
+	for _, tt := range []struct {
+		name string
+		sig  []byte
+		err  error
+	}{
+		{name: "signed", sig: ed25519.Sign(priv, data)},
+		{name: "signed hash", sig: ed25519.Sign(priv, sum[:]), err: ErrBadSignature},
+		{name: "other key", sig: ed25519.Sign(otherPriv, data), err: ErrBadSignature},
+		{name: "no signature", err: ErrNoSignature},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := filepath.Join(dir, "kernel")
+			os.Remove(kernel + ".sig")
+			if tt.sig != nil {
+				writeFile(t, kernel+".sig", tt.sig)
+			}
+			if err := v.Verify(boot.Component{Kind: "kernel", Name: kernel, Data: data}); !errors.Is(err, tt.err) {
+				t.Errorf("Verify = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	if err := v.Verify(boot.Component{Kind: "kernel", Data: data}); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Verify of component without name = %v, want %v", err, ErrNoSignature)
+	}
+	if _, err := LoadEd25519(filepath.Join(dir, "kernel.sig")); err == nil {
+		t.Errorf("LoadEd25519 of a file without key succeeded")
+	}
+}
+
+func TestGPG(t *testing.T) {
+	dir := t.TempDir()
+	key, err := openpgp.NewEntity("goog", "goog", "goog@goog", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := openpgp.NewEntity("goog", "goog", "goog@goog", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ring bytes.Buffer
+	if err := key.Serialize(&ring); err != nil {
+		t.Fatal(err)
+	}
+	ringFile := filepath.Join(dir, "ring.gpg")
+	writeFile(t, ringFile, ring.Bytes())
+	v, err := LoadGPG(ringFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("initrd")
+	for _, tt := range []struct {
+		name     string
+		signer   *openpgp.Entity
+		unsigned bool
+		err      error
+	}{
+		{name: "signed", signer: key},
+		{name: "other key", signer: otherKey, unsigned: true},
+		{name: "no signature", err: ErrNoSignature},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			initrd := filepath.Join(dir, "initrd")
+			os.Remove(initrd + ".sig")
+			if tt.signer != nil {
+				var sig bytes.Buffer
+				if err := openpgp.DetachSign(&sig, tt.signer, bytes.NewReader(data), nil); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, initrd+".sig", sig.Bytes())
+			}
+			err := v.Verify(boot.Component{Kind: "initrd", Name: initrd, Data: data})
+			var unsigned vfile.ErrUnsigned
+			if tt.unsigned {
+				if !errors.As(err, &unsigned) {
+					t.Errorf("Verify = %v, want vfile.ErrUnsigned", err)
+				}
+			} else if !errors.Is(err, tt.err) {
+				t.Errorf("Verify = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secureboot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	guid "github.com/google/uuid"
+	"github.com/u-root/u-root/pkg/efivarfs"
+)
+
+// ErrBadSignatureList is returned for malformed EFI_SIGNATURE_LISTs.
+var ErrBadSignatureList = errors.New("bad EFI signature list")
+
+// Signature types of EFI_SIGNATURE_LISTs, in their mixed endian encoding.
+var (
+	certSHA256GUID     = mixedGUID("c1c41626-504c-4092-aca9-41f936934328")
+	certX509GUID       = mixedGUID("a5c059a1-94e4-4aa7-87b5-ab155c2bf072")
+	certX509SHA256GUID = mixedGUID("3bd2a492-96c0-4079-b420-fcf98ef103ed")
+)
+
+// imageSecurityDatabaseGUID is the vendor GUID of db and dbx.
+var imageSecurityDatabaseGUID = guid.MustParse("d719b2cb-3d3a-4596-a3bc-dad00e67656f")
+
+func mixedGUID(s string) [16]byte {
+	u := guid.MustParse(s)
+	var m [16]byte
+	m[0], m[1], m[2], m[3] = u[3], u[2], u[1], u[0]
+	m[4], m[5] = u[5], u[4]
+	m[6], m[7] = u[7], u[6]
+	copy(m[8:], u[8:])
+	return m
+}
+
+// Database is an image security database such as db or dbx.
+type Database struct {
+	// Certs are X.509 certificates.
+	Certs []*x509.Certificate
+	// Hashes are SHA-256 Authenticode hashes of images.
+	Hashes [][sha256.Size]byte
+	// CertHashes are SHA-256 hashes of the TBSCertificate of
+	// certificates, which is how dbx revokes certificates.
+	CertHashes [][sha256.Size]byte
+}
+
+// efiTimeSize is the size of an EFI_TIME.
+const efiTimeSize = 16
+
+type signatureListHeader struct {
+	SignatureType       [16]byte
+	SignatureListSize   uint32
+	SignatureHeaderSize uint32
+	SignatureSize       uint32
+}
+
+// ParseSignatureLists parses the EFI_SIGNATURE_LISTs of a db or dbx
+// variable. Signature types other than X.509 certificates and SHA-256 hashes
+// are skipped.
+func ParseSignatureLists(b []byte) (*Database, error) {
+	db := &Database{}
+	for len(b) > 0 {
+		var h signatureListHeader
+		if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &h); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadSignatureList, err)
+		}
+		start := uint64(binary.Size(h)) + uint64(h.SignatureHeaderSize)
+		end := uint64(h.SignatureListSize)
+		if end > uint64(len(b)) || end < start || h.SignatureSize <= 16 || (end-start)%uint64(h.SignatureSize) != 0 {
+			return nil, fmt.Errorf("%w: list size %d, header size %d, signature size %d", ErrBadSignatureList,
+				h.SignatureListSize, h.SignatureHeaderSize, h.SignatureSize)
+		}
+		sigs := b[start:end]
+		b = b[end:]
+
+		for ; len(sigs) > 0; sigs = sigs[h.SignatureSize:] {
+			// Every EFI_SIGNATURE_DATA starts with the GUID of its owner.
+			data := sigs[16:h.SignatureSize]
+			switch h.SignatureType {
+			case certX509GUID:
+				cert, err := x509.ParseCertificate(data)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrBadSignatureList, err)
+				}
+				db.Certs = append(db.Certs, cert)
+			case certSHA256GUID:
+				if len(data) != sha256.Size {
+					return nil, fmt.Errorf("%w: SHA-256 signature of %d bytes", ErrBadSignatureList, len(data))
+				}
+				db.Hashes = append(db.Hashes, [sha256.Size]byte(data))
+			case certX509SHA256GUID:
+				// The hash is followed by the time of revocation,
+				// after which signatures are invalid. It is
+				// ignored, revoking all signatures.
+				if len(data) != sha256.Size+efiTimeSize {
+					return nil, fmt.Errorf("%w: X.509 SHA-256 signature of %d bytes", ErrBadSignatureList, len(data))
+				}
+				db.CertHashes = append(db.CertHashes, [sha256.Size]byte(data[:sha256.Size]))
+			}
+		}
+	}
+	return db, nil
+}
+
+// ReadDatabase reads the image security database name, "db" or "dbx", from
+// the UEFI variables in e. A database that does not exist is empty.
+func ReadDatabase(e efivarfs.EFIVar, name string) (*Database, error) {
+	_, b, err := e.Get(efivarfs.VariableDescriptor{Name: name, GUID: imageSecurityDatabaseGUID})
+	if errors.Is(err, efivarfs.ErrVarNotExist) {
+		return &Database{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	db, err := ParseSignatureLists(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return db, nil
+}
+
+// containsHash returns whether db contains image hash h. A nil db is empty.
+func (db *Database) containsHash(h []byte) bool {
+	if db == nil {
+		return false
+	}
+	for _, dh := range db.Hashes {
+		if bytes.Equal(dh[:], h) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsCert returns whether db contains cert, or the hash of its
+// TBSCertificate.
+func (db *Database) containsCert(cert *x509.Certificate) bool {
+	if db == nil {
+		return false
+	}
+	for _, c := range db.Certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	tbs := sha256.Sum256(cert.RawTBSCertificate)
+	for _, h := range db.CertHashes {
+		if h == tbs {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureLists returns the certificates and hashes of db as
+// EFI_SIGNATURE_LISTs owned by owner, e.g. to write a db variable.
+func (db *Database) SignatureLists(owner guid.UUID) []byte {
+	ownerGUID := mixedGUID(owner.String())
+	var b bytes.Buffer
+	list := func(typ [16]byte, sigs ...[]byte) {
+		if len(sigs) == 0 {
+			return
+		}
+		h := signatureListHeader{SignatureType: typ, SignatureSize: uint32(16 + len(sigs[0]))}
+		h.SignatureListSize = uint32(binary.Size(h)) + uint32(len(sigs))*h.SignatureSize
+		_ = binary.Write(&b, binary.LittleEndian, h)
+		for _, sig := range sigs {
+			b.Write(ownerGUID[:])
+			b.Write(sig)
+		}
+	}
+	// Certificates differ in size, so each gets a list of its own.
+	for _, c := range db.Certs {
+		list(certX509GUID, c.Raw)
+	}
+	var hashes, certHashes [][]byte
+	for _, h := range db.Hashes {
+		hashes = append(hashes, bytes.Clone(h[:]))
+	}
+	for _, h := range db.CertHashes {
+		// Revoked since the beginning of time.
+		certHashes = append(certHashes, append(bytes.Clone(h[:]), make([]byte, efiTimeSize)...))
+	}
+	list(certSHA256GUID, hashes...)
+	list(certX509SHA256GUID, certHashes...)
+	return b.Bytes()
+}
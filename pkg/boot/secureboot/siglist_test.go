@@ -0,0 +1,126 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secureboot
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	guid "github.com/google/uuid"
+	"github.com/u-root/u-root/pkg/efivarfs"
+)
+
+// fakeVars holds variables in memory.
+type fakeVars map[efivarfs.VariableDescriptor][]byte
+
+func (f fakeVars) Get(desc efivarfs.VariableDescriptor) (efivarfs.VariableAttributes, []byte, error) {
+	b, ok := f[desc]
+	if !ok {
+		return 0, nil, efivarfs.ErrVarNotExist
+	}
+	return efivarfs.AttributeNonVolatile, b, nil
+}
+
+func (f fakeVars) List() ([]efivarfs.VariableDescriptor, error) {
+	return nil, nil
+}
+
+func (f fakeVars) Remove(desc efivarfs.VariableDescriptor) error {
+	delete(f, desc)
+	return nil
+}
+
+func (f fakeVars) Set(desc efivarfs.VariableDescriptor, attrs efivarfs.VariableAttributes, data []byte) error {
+	f[desc] = data
+	return nil
+}
+
+func TestSignatureLists(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newCert(t, "a", key, nil, nil), newCert(t, "b", key, nil, nil)
+	want := &Database{
+		Certs:      []*x509.Certificate{a, b},
+		Hashes:     [][sha256.Size]byte{sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b"))},
+		CertHashes: [][sha256.Size]byte{sha256.Sum256(a.RawTBSCertificate)},
+	}
+	owner := guid.MustParse("77fa9abd-0359-4d32-bd60-28f4e78f784b")
+
+	vars := fakeVars{
+		{Name: "db", GUID: imageSecurityDatabaseGUID}: want.SignatureLists(owner),
+	}
+	got, err := ReadDatabase(vars, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Certs) != 2 || !got.Certs[0].Equal(a) || !got.Certs[1].Equal(b) {
+		t.Errorf("got %d certificates, want a and b", len(got.Certs))
+	}
+	if len(got.Hashes) != 2 || got.Hashes[0] != want.Hashes[0] || got.Hashes[1] != want.Hashes[1] {
+		t.Errorf("got hashes %x, want %x", got.Hashes, want.Hashes)
+	}
+	if !got.containsCert(a) || !got.containsHash(want.Hashes[1][:]) {
+		t.Errorf("database does not contain a certificate or hash it was made of")
+	}
+
+	dbx, err := ReadDatabase(vars, "dbx")
+	if err != nil || len(dbx.Certs)+len(dbx.Hashes)+len(dbx.CertHashes) != 0 {
+		t.Errorf("ReadDatabase(dbx) = %v, %v, want empty database", dbx, err)
+	}
+
+	// The owner GUID is in mixed endian encoding after the header.
+	lists := want.SignatureLists(owner)
+	wantOwner := []byte{0xbd, 0x9a, 0xfa, 0x77, 0x59, 0x03, 0x32, 0x4d, 0xbd, 0x60, 0x28, 0xf4, 0xe7, 0x8f, 0x78, 0x4b}
+	if !bytes.Equal(lists[28:44], wantOwner) {
+		t.Errorf("owner GUID encoded as %x, want %x", lists[28:44], wantOwner)
+	}
+	if got := [16]byte(lists[:16]); got != certX509GUID {
+		t.Errorf("first list type %x, want X.509 %x", got, certX509GUID)
+	}
+}
+
+func TestParseSignatureListsErrors(t *testing.T) {
+	lists := (&Database{Hashes: [][sha256.Size]byte{{1}}}).SignatureLists(guid.UUID{})
+	for _, tt := range []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"truncated header", func(b []byte) []byte { return b[:20] }},
+		{"truncated list", func(b []byte) []byte { return b[:len(b)-1] }},
+		{"huge header", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[20:], 0xffffffff)
+			return b
+		}},
+		{"odd signature size", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[24:], 47)
+			return b
+		}},
+		{"short hash", func(b []byte) []byte {
+			b = b[:len(b)-1]
+			binary.LittleEndian.PutUint32(b[16:], uint32(len(b)))
+			binary.LittleEndian.PutUint32(b[24:], 47)
+			return b
+		}},
+		{"bad certificate", func(b []byte) []byte {
+			copy(b, certX509GUID[:])
+			return b
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSignatureLists(tt.modify(append([]byte{}, lists...))); !errors.Is(err, ErrBadSignatureList) {
+				t.Errorf("ParseSignatureLists = %v, want %v", err, ErrBadSignatureList)
+			}
+		})
+	}
+}
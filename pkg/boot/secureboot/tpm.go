@@ -0,0 +1,29 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secureboot
+
+import (
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/tss"
+)
+
+// TPM measures components into a PCR of the system's TPM. Without a TPM,
+// measuring does nothing.
+type TPM struct {
+	PCR uint32
+}
+
+var _ boot.Measurer = TPM{}
+
+// Measure implements boot.Measurer.
+func (t TPM) Measure(c boot.Component) error {
+	tpm, err := tss.NewTPM()
+	if err != nil {
+		// There is no TPM.
+		return nil
+	}
+	defer tpm.Close()
+	return tpm.Measure(c.Data, t.PCR)
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bufio"
+	"bytes"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNotUKI is returned for PE images without a .linux section.
+var ErrNotUKI = errors.New("not a unified kernel image")
+
+// UKIImage is a Unified Kernel Image, a PE binary bundling a kernel with its
+// initrd, command line, os-release and optional device tree and microcode.
+//
+// See https://uapi-group.org/specifications/specs/unified_kernel_image/.
+// The sections are booted as a LinuxImage; the EFI stub itself is not run.
+type UKIImage struct {
+	// Linux is the image built from the UKI sections. Modifiers such as
+	// the command line apply to it.
+	Linux *LinuxImage
+
+	// OSRelease are the key/value pairs of the .osrel section.
+	OSRelease map[string]string
+
+	// Uname is the kernel release from the .uname section, if any.
+	Uname string
+
+	image io.ReaderAt
+}
+
+var _ OSImage = &UKIImage{}
+
+// sectionReader returns the contents of PE section s. The virtual size is
+// the real size of the data; the raw size is padded to the file alignment.
+func sectionReader(r io.ReaderAt, s *pe.Section) *io.SectionReader {
+	size := s.Size
+	if s.VirtualSize != 0 && s.VirtualSize < size {
+		size = s.VirtualSize
+	}
+	return io.NewSectionReader(r, int64(s.Offset), int64(size))
+}
+
+func sectionString(r io.ReaderAt, s *pe.Section) (string, error) {
+	b, err := io.ReadAll(sectionReader(r, s))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(b, "\x00"))), nil
+}
+
+// ParseOSRelease parses os-release(5) data.
+func ParseOSRelease(s string) map[string]string {
+	vals := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if uq, err := strconv.Unquote(v); err == nil {
+			v = uq
+		} else if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+			v = v[1 : len(v)-1]
+		}
+		vals[k] = v
+	}
+	return vals
+}
+
+// NewUKIImage reads the sections of the UKI in r.
+//
+// The microcode in .ucode, if any, is prepended to the .initrd so that the
+// kernel finds it in the first cpio archive. The image is named after the
+// PRETTY_NAME from .osrel.
+func NewUKIImage(r io.ReaderAt) (*UKIImage, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotUKI, err)
+	}
+	defer f.Close()
+
+	uki := &UKIImage{Linux: &LinuxImage{}, image: r}
+	var initrd, ucode io.ReaderAt
+	for _, s := range f.Sections {
+		switch s.Name {
+		case ".linux":
+			uki.Linux.Kernel = sectionReader(r, s)
+		case ".initrd":
+			initrd = sectionReader(r, s)
+		case ".ucode":
+			ucode = sectionReader(r, s)
+		case ".dtb":
+			uki.Linux.DTB = sectionReader(r, s)
+		case ".cmdline":
+			if uki.Linux.Cmdline, err = sectionString(r, s); err != nil {
+				return nil, fmt.Errorf(".cmdline: %w", err)
+			}
+		case ".uname":
+			if uki.Uname, err = sectionString(r, s); err != nil {
+				return nil, fmt.Errorf(".uname: %w", err)
+			}
+		case ".osrel":
+			osrel, err := sectionString(r, s)
+			if err != nil {
+				return nil, fmt.Errorf(".osrel: %w", err)
+			}
+			uki.OSRelease = ParseOSRelease(osrel)
+		}
+	}
+	if uki.Linux.Kernel == nil {
+		return nil, fmt.Errorf("%w: no .linux section", ErrNotUKI)
+	}
+
+	switch {
+	case ucode != nil && initrd != nil:
+		uki.Linux.Initrd = CatInitrds(ucode, initrd)
+	case ucode != nil:
+		uki.Linux.Initrd = ucode
+	default:
+		uki.Linux.Initrd = initrd
+	}
+
+	for _, k := range []string{"PRETTY_NAME", "NAME", "ID"} {
+		if n := uki.OSRelease[k]; n != "" {
+			uki.Linux.Name = n
+			break
+		}
+	}
+	return uki, nil
+}
+
+// Label implements OSImage.Label.
+func (u *UKIImage) Label() string {
+	if u.Linux.Name != "" {
+		return u.Linux.Name
+	}
+	return fmt.Sprintf("UKI(%s)", stringer(u.image))
+}
+
+// Rank implements OSImage.Rank.
+func (u *UKIImage) Rank() int {
+	return u.Linux.Rank()
+}
+
+// String implements fmt.Stringer.
+func (u *UKIImage) String() string {
+	return fmt.Sprintf("UKIImage(\n  Uname: %s\n  OSRelease: %v\n  %s)\n", u.Uname, u.OSRelease, u.Linux)
+}
+
+// Edit implements OSImage.Edit.
+func (u *UKIImage) Edit(f func(cmdline string) string) {
+	u.Linux.Edit(f)
+}
+
+// Load implements OSImage.Load.
+//
+// The whole UKI is verified and measured, as its signature covers all of
+// its sections, and the sections loaded are those of what was verified.
+func (u *UKIImage) Load(opts ...LoadOption) error {
+	loadOpts := defaultLoadOptions()
+	for _, opt := range opts {
+		opt(loadOpts)
+	}
+	if loadOpts.measurer == nil && loadOpts.policy == VerifyOff {
+		return u.Linux.Load(opts...)
+	}
+	r, err := loadOpts.check("uki", u.image)
+	if err != nil {
+		return err
+	}
+	verified, err := NewUKIImage(r)
+	if err != nil {
+		return err
+	}
+	li := *u.Linux
+	li.Kernel, li.Initrd, li.DTB = verified.Linux.Kernel, verified.Linux.Initrd, verified.Linux.DTB
+	// The sections were checked as part of the UKI.
+	return li.Load(append(opts, func(o *loadOptions) {
+		o.policy = VerifyOff
+		o.measurer = nil
+	})...)
+}
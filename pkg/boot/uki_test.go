@@ -0,0 +1,146 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/boottest"
+	"github.com/u-root/uio/uio"
+)
+
+const testOSRel = `# comment
+NAME="Fedora Linux"
+VERSION_ID=40
+PRETTY_NAME="Fedora Linux 40 (Workstation Edition)"
+ID=fedora
+HOME_URL='https://fedoraproject.org/'
+`
+
+func TestNewUKIImage(t *testing.T) {
+	ucode := bytes.Repeat([]byte{'u'}, 700)
+	pe := boottest.MakePE(
+		boottest.PESection{Name: ".osrel", Data: []byte(testOSRel)},
+		boottest.PESection{Name: ".cmdline", Data: []byte("console=ttyS0 root=LABEL=root\n\x00")},
+		boottest.PESection{Name: ".uname", Data: []byte("6.8.5-301.fc40.x86_64")},
+		boottest.PESection{Name: ".dtb", Data: []byte("dtb")},
+		boottest.PESection{Name: ".ucode", Data: ucode},
+		boottest.PESection{Name: ".linux", Data: []byte("kernel")},
+		boottest.PESection{Name: ".initrd", Data: []byte("initrd")},
+	)
+	uki, err := boot.NewUKIImage(bytes.NewReader(pe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uki.Label(), "Fedora Linux 40 (Workstation Edition)"; got != want {
+		t.Errorf("Label() = %q, want %q", got, want)
+	}
+	if got, want := uki.Linux.Cmdline, "console=ttyS0 root=LABEL=root"; got != want {
+		t.Errorf("Cmdline = %q, want %q", got, want)
+	}
+	if uki.Uname != "6.8.5-301.fc40.x86_64" {
+		t.Errorf("Uname = %q", uki.Uname)
+	}
+	if got := uki.OSRelease["HOME_URL"]; got != "https://fedoraproject.org/" {
+		t.Errorf("HOME_URL = %q", got)
+	}
+
+	wantInitrd := append(append(ucode, make([]byte, 1024-len(ucode))...), "initrd"...)
+	for _, tt := range []struct {
+		name string
+		got  io.ReaderAt
+		want []byte
+	}{
+		{"kernel", uki.Linux.Kernel, []byte("kernel")},
+		{"initrd", uki.Linux.Initrd, wantInitrd},
+		{"dtb", uki.Linux.DTB, []byte("dtb")},
+	} {
+		b, err := uio.ReadAll(tt.got)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if diff := cmp.Diff(tt.want, b); diff != "" {
+			t.Errorf("%s (-want +got):\n%s", tt.name, diff)
+		}
+	}
+
+	boot.ApplyLinuxModifiers([]boot.OSImage{uki}, boot.AppendLinux("quiet"))
+	if !strings.HasSuffix(uki.Linux.Cmdline, " quiet") {
+		t.Errorf("modifier not applied: %q", uki.Linux.Cmdline)
+	}
+	if err := uki.Load(boot.WithDryRun(true)); err != nil {
+		t.Errorf("Load() = %v", err)
+	}
+}
+
+func TestUKIImageLoadVerified(t *testing.T) {
+	pe := boottest.MakePE(
+		boottest.PESection{Name: ".linux", Data: []byte("kernel")},
+		boottest.PESection{Name: ".initrd", Data: []byte("initrd")},
+	)
+	uki, err := boot.NewUKIImage(bytes.NewReader(pe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errUntrusted := errors.New("untrusted")
+	for _, tt := range []struct {
+		name  string
+		trust string
+		err   error
+	}{
+		{name: "trusted", trust: "uki"},
+		{name: "sections are not verified alone", trust: "kernel", err: boot.ErrNotVerified},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var verified []string
+			v := boot.VerifierFunc(func(c boot.Component) error {
+				verified = append(verified, c.Kind)
+				if c.Kind != tt.trust || !bytes.Equal(c.Data, pe) {
+					return errUntrusted
+				}
+				return nil
+			})
+			if err := uki.Load(boot.WithDryRun(true), boot.WithVerifier(boot.VerifyEnforce, v)); !errors.Is(err, tt.err) {
+				t.Errorf("Load() = %v, want %v", err, tt.err)
+			}
+			if diff := cmp.Diff([]string{"uki"}, verified); diff != "" {
+				t.Errorf("verified (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewUKIImageMinimal(t *testing.T) {
+	uki, err := boot.NewUKIImage(bytes.NewReader(boottest.MakePE(boottest.PESection{Name: ".linux", Data: []byte("kernel")})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uki.Linux.Initrd != nil || uki.Linux.DTB != nil || uki.Linux.Cmdline != "" {
+		t.Errorf("unexpected sections in %s", uki)
+	}
+	if !strings.HasPrefix(uki.Label(), "UKI(") {
+		t.Errorf("Label() = %q, want a UKI() description", uki.Label())
+	}
+}
+
+func TestNewUKIImageErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"not PE", []byte("hello, world")},
+		{"no .linux", boottest.MakePE(boottest.PESection{Name: ".osrel", Data: []byte(testOSRel)})},
+	} {
+		if _, err := boot.NewUKIImage(bytes.NewReader(tt.data)); !errors.Is(err, boot.ErrNotUKI) {
+			t.Errorf("%s: NewUKIImage() = %v, want %v", tt.name, err, boot.ErrNotUKI)
+		}
+	}
+}
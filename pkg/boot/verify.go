@@ -0,0 +1,172 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/u-root/uio/uio"
+)
+
+// VerifyPolicy decides what Load does with images that fail verification.
+type VerifyPolicy int
+
+const (
+	// VerifyOff does not verify images.
+	VerifyOff VerifyPolicy = iota
+	// VerifyLog logs images that fail verification, and loads them anyway.
+	VerifyLog
+	// VerifyEnforce refuses to load images that fail verification.
+	VerifyEnforce
+)
+
+func (p VerifyPolicy) String() string {
+	switch p {
+	case VerifyOff:
+		return "off"
+	case VerifyLog:
+		return "log"
+	case VerifyEnforce:
+		return "enforce"
+	}
+	return fmt.Sprintf("VerifyPolicy(%d)", int(p))
+}
+
+// Set implements flag.Value, parsing "off", "log" or "enforce".
+func (p *VerifyPolicy) Set(s string) error {
+	for _, policy := range []VerifyPolicy{VerifyOff, VerifyLog, VerifyEnforce} {
+		if s == policy.String() {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown verification policy %q, want off, log or enforce", s)
+}
+
+// ErrNotVerified is returned by Load for an image none of the verifiers
+// accepted.
+var ErrNotVerified = errors.New("image failed verification")
+
+// ErrNotCovered is returned by a Verifier for components it does not
+// verify, like Authenticode for initrds, which are not PE images. A
+// component that no verifier covers is loaded unverified, and only
+// measured, as UEFI does with initrds.
+var ErrNotCovered = errors.New("not covered by verifier")
+
+// Component is a part of an OSImage to verify before it is loaded.
+type Component struct {
+	// Kind is "kernel", "initrd", "module", or "uki" for a whole Unified
+	// Kernel Image.
+	Kind string
+	// Name is where the component comes from, usually a file path, or
+	// empty if that is not known. It is where verifiers look for detached
+	// signatures.
+	Name string
+	Data []byte
+}
+
+// Verifier verifies components of OSImages.
+type Verifier interface {
+	// Verify returns nil if c is trusted.
+	Verify(c Component) error
+}
+
+// VerifierFunc is a function implementing Verifier.
+type VerifierFunc func(c Component) error
+
+// Verify implements Verifier.
+func (f VerifierFunc) Verify(c Component) error {
+	return f(c)
+}
+
+// WithVerifier is a LoadOption that verifies the kernel and initrd, or the
+// kernel and modules of multiboot images, before loading them. A component
+// is trusted if any of verifiers accepts it; policy decides what happens to
+// one that is not.
+//
+// Verified components are read into memory, so that what gets loaded is
+// what was verified.
+func WithVerifier(policy VerifyPolicy, verifiers ...Verifier) LoadOption {
+	return func(o *loadOptions) {
+		o.policy = policy
+		o.verifiers = verifiers
+	}
+}
+
+// Measurer measures components of OSImages, e.g. into a TPM.
+type Measurer interface {
+	Measure(c Component) error
+}
+
+// WithMeasurement is a LoadOption that measures the components of an image
+// with m before loading them.
+func WithMeasurement(m Measurer) LoadOption {
+	return func(o *loadOptions) {
+		o.measurer = m
+	}
+}
+
+// check measures and verifies a component according to o, returning the
+// contents of r to load. It returns r itself if there is nothing to do.
+func (o *loadOptions) check(kind string, r io.ReaderAt) (io.ReaderAt, error) {
+	if r == nil || (o.measurer == nil && o.policy == VerifyOff) {
+		return r, nil
+	}
+	name := ""
+	switch r.(type) {
+	case fmt.Stringer, named:
+		name = stringer(r)
+	}
+	what := kind
+	if name != "" {
+		what += " " + name
+	}
+	data, err := uio.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", what, err)
+	}
+
+	c := Component{Kind: kind, Name: name, Data: data}
+	if o.measurer != nil {
+		if err := o.measurer.Measure(c); err != nil {
+			return nil, fmt.Errorf("measuring %s: %w", what, err)
+		}
+		o.logger.Printf("Measured %s", what)
+	}
+
+	if o.policy == VerifyOff {
+		return bytes.NewReader(data), nil
+	}
+	err = fmt.Errorf("%w: no verifiers", ErrNotVerified)
+	var errs []error
+	for _, v := range o.verifiers {
+		if err = v.Verify(c); err == nil {
+			break
+		}
+		if !errors.Is(err, ErrNotCovered) {
+			errs = append(errs, err)
+		}
+	}
+	switch {
+	case err == nil:
+		o.logger.Printf("Verified %s", what)
+	case len(errs) > 0:
+		err = fmt.Errorf("%w: %w", ErrNotVerified, errors.Join(errs...))
+	case len(o.verifiers) > 0:
+		log.Printf("No verifier covers %s, loading it unverified", what)
+		err = nil
+	}
+	if err != nil {
+		if o.policy == VerifyEnforce {
+			return nil, fmt.Errorf("%s: %w", what, err)
+		}
+		log.Printf("Loading unverified %s: %v", what, err)
+	}
+	return bytes.NewReader(data), nil
+}
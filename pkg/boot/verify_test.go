@@ -0,0 +1,183 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/multiboot"
+	"github.com/u-root/uio/uio"
+)
+
+var errBadSignature = errors.New("bad signature")
+
+// trustData is a verifier accepting components containing "trusted".
+var trustData = VerifierFunc(func(c Component) error {
+	if !strings.Contains(string(c.Data), "trusted") {
+		return errBadSignature
+	}
+	return nil
+})
+
+// recorder records the components it is asked to verify, and rejects them.
+type recorder []string
+
+func (r *recorder) Verify(c Component) error {
+	*r = append(*r, strings.TrimSpace(c.Kind+" "+c.Name))
+	return errBadSignature
+}
+
+func TestLoadVerified(t *testing.T) {
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "kernel")
+	if err := os.WriteFile(kernel, []byte("trusted kernel"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		img       OSImage
+		policy    VerifyPolicy
+		verifiers []Verifier
+		err       error
+		checked   []string
+	}{
+		{
+			name:   "off",
+			img:    &LinuxImage{Kernel: strings.NewReader("kernel"), Initrd: strings.NewReader("initrd")},
+			policy: VerifyOff,
+		},
+		{
+			name:      "enforce trusted",
+			img:       &LinuxImage{Kernel: uio.NewLazyFile(kernel), Initrd: strings.NewReader("trusted initrd")},
+			policy:    VerifyEnforce,
+			verifiers: []Verifier{trustData},
+			checked:   []string{"kernel " + kernel, "initrd"},
+		},
+		{
+			name:      "enforce untrusted initrd",
+			img:       &LinuxImage{Kernel: strings.NewReader("trusted kernel"), Initrd: strings.NewReader("initrd")},
+			policy:    VerifyEnforce,
+			verifiers: []Verifier{trustData},
+			err:       ErrNotVerified,
+			checked:   []string{"kernel", "initrd"},
+		},
+		{
+			name:    "log untrusted",
+			img:     &LinuxImage{Kernel: strings.NewReader("kernel"), Initrd: strings.NewReader("initrd")},
+			policy:  VerifyLog,
+			checked: []string{"kernel", "initrd"},
+		},
+		{
+			name: "enforce untrusted multiboot module",
+			img: &MultibootImage{
+				Kernel:  strings.NewReader("trusted kernel"),
+				Modules: []multiboot.Module{{Module: strings.NewReader("trusted module")}, {Module: strings.NewReader("module")}},
+			},
+			policy:    VerifyEnforce,
+			verifiers: []Verifier{trustData},
+			err:       ErrNotVerified,
+			checked:   []string{"kernel", "module", "module"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var r recorder
+			err := tt.img.Load(WithDryRun(true), WithVerifier(tt.policy, append([]Verifier{&r}, tt.verifiers...)...))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Load = %v, want %v", err, tt.err)
+			}
+			if !slices.Equal(r, tt.checked) {
+				t.Errorf("verified %q, want %q", r, tt.checked)
+			}
+		})
+	}
+}
+
+// measurements records what it measures.
+type measurements []string
+
+func (m *measurements) Measure(c Component) error {
+	*m = append(*m, fmt.Sprintf("%s:%s", c.Kind, c.Data))
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	var measured measurements
+	for _, tt := range []struct {
+		name     string
+		opts     []LoadOption
+		err      error
+		measured []string
+	}{
+		{
+			name: "nothing to do",
+		},
+		{
+			name:     "measure only",
+			opts:     []LoadOption{WithMeasurement(&measured)},
+			measured: []string{"kernel:trusted kernel"},
+		},
+		{
+			name:     "measure and verify",
+			opts:     []LoadOption{WithMeasurement(&measured), WithVerifier(VerifyEnforce, trustData)},
+			measured: []string{"kernel:trusted kernel"},
+		},
+		{
+			name: "no verifiers",
+			opts: []LoadOption{WithVerifier(VerifyEnforce)},
+			err:  ErrNotVerified,
+		},
+		{
+			name: "not covered",
+			opts: []LoadOption{WithVerifier(VerifyEnforce, VerifierFunc(func(c Component) error {
+				return fmt.Errorf("%w: %s", ErrNotCovered, c.Kind)
+			}))},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			measured = nil
+			o := defaultLoadOptions()
+			for _, opt := range tt.opts {
+				opt(o)
+			}
+			r, err := o.check("kernel", strings.NewReader("trusted kernel"))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("check = %v, want %v", err, tt.err)
+			}
+			if err == nil {
+				if b, _ := uio.ReadAll(r); string(b) != "trusted kernel" {
+					t.Errorf("check returned %q, want %q", b, "trusted kernel")
+				}
+			}
+			if !slices.Equal(measured, measurements(tt.measured)) {
+				t.Errorf("measured %q, want %q", measured, tt.measured)
+			}
+		})
+	}
+}
+
+func TestVerifyPolicySet(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want VerifyPolicy
+		err  bool
+	}{
+		{s: "off", want: VerifyOff},
+		{s: "log", want: VerifyLog},
+		{s: "enforce", want: VerifyEnforce},
+		{s: "strict", want: VerifyLog, err: true},
+	} {
+		p := VerifyLog
+		if err := p.Set(tt.s); (err != nil) != tt.err || p != tt.want {
+			t.Errorf("Set(%q) = %v, %v, want %v, error %t", tt.s, p, err, tt.want, tt.err)
+		}
+	}
+}
@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package coreboot
 
 // This is the set of segments comprising a coreboot table from an PC Engines APU2.
 var apu2 = []seg{
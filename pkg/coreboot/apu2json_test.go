@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package coreboot
 
 // This JSON is from an APU2 running coreboot.
 var apu2JSON = `{
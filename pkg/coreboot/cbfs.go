@@ -0,0 +1,523 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coreboot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// CBFS magic numbers.
+const (
+	CBFSFileMagic      = "LARCHIVE"
+	CBFSHeaderMagic    = 0x4F524243
+	CBFSHeaderVersion1 = 0x31313131
+	CBFSHeaderVersion2 = 0x31313132
+
+	// CBFSAlign is the alignment of CBFS files, unless the master
+	// header says otherwise.
+	CBFSAlign = 64
+)
+
+// FileType is the type of a CBFS file.
+type FileType uint32
+
+// CBFS file types.
+const (
+	CBFS_TYPE_DELETED      FileType = 0x00000000
+	CBFS_TYPE_NULL         FileType = 0xffffffff
+	CBFS_TYPE_BOOTBLOCK    FileType = 0x01
+	CBFS_TYPE_CBFSHEADER   FileType = 0x02
+	CBFS_TYPE_LEGACY_STAGE FileType = 0x10
+	CBFS_TYPE_STAGE        FileType = 0x11
+	CBFS_TYPE_SELF         FileType = 0x20
+	CBFS_TYPE_FIT          FileType = 0x21
+	CBFS_TYPE_OPTIONROM    FileType = 0x30
+	CBFS_TYPE_BOOTSPLASH   FileType = 0x40
+	CBFS_TYPE_RAW          FileType = 0x50
+	CBFS_TYPE_VSA          FileType = 0x51
+	CBFS_TYPE_MBI          FileType = 0x52
+	CBFS_TYPE_MICROCODE    FileType = 0x53
+	CBFS_TYPE_INTEL_FIT    FileType = 0x54
+	CBFS_TYPE_FSP          FileType = 0x60
+	CBFS_TYPE_MRC          FileType = 0x61
+	CBFS_TYPE_MMA          FileType = 0x62
+	CBFS_TYPE_EFI          FileType = 0x63
+	CBFS_TYPE_STRUCT       FileType = 0x70
+	CBFS_TYPE_CMOS_DEFAULT FileType = 0xaa
+	CBFS_TYPE_SPD          FileType = 0xab
+	CBFS_TYPE_MRC_CACHE    FileType = 0xac
+	CBFS_TYPE_CMOS_LAYOUT  FileType = 0x01aa
+)
+
+// fileTypeNames are the names cbfstool gives file types.
+var fileTypeNames = map[FileType]string{
+	CBFS_TYPE_DELETED:      "deleted",
+	CBFS_TYPE_NULL:         "null",
+	CBFS_TYPE_BOOTBLOCK:    "bootblock",
+	CBFS_TYPE_CBFSHEADER:   "cbfs header",
+	CBFS_TYPE_LEGACY_STAGE: "legacy stage",
+	CBFS_TYPE_STAGE:        "stage",
+	CBFS_TYPE_SELF:         "simple elf",
+	CBFS_TYPE_FIT:          "fit",
+	CBFS_TYPE_OPTIONROM:    "optionrom",
+	CBFS_TYPE_BOOTSPLASH:   "bootsplash",
+	CBFS_TYPE_RAW:          "raw",
+	CBFS_TYPE_VSA:          "vsa",
+	CBFS_TYPE_MBI:          "mbi",
+	CBFS_TYPE_MICROCODE:    "microcode",
+	CBFS_TYPE_INTEL_FIT:    "intel_fit",
+	CBFS_TYPE_FSP:          "fsp",
+	CBFS_TYPE_MRC:          "mrc",
+	CBFS_TYPE_MMA:          "mma",
+	CBFS_TYPE_EFI:          "efi",
+	CBFS_TYPE_STRUCT:       "struct",
+	CBFS_TYPE_CMOS_DEFAULT: "cmos_default",
+	CBFS_TYPE_SPD:          "spd",
+	CBFS_TYPE_MRC_CACHE:    "mrc_cache",
+	CBFS_TYPE_CMOS_LAYOUT:  "cmos_layout",
+}
+
+func (t FileType) String() string {
+	if n, ok := fileTypeNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("(unknown %#x)", uint32(t))
+}
+
+// ParseFileType returns the file type named name, as cbfstool names them.
+func ParseFileType(name string) (FileType, error) {
+	for t, n := range fileTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown file type %q", ErrBadCBFS, name)
+}
+
+// Compression is the compression of a CBFS file.
+type Compression uint32
+
+// CBFS compressions.
+const (
+	CBFS_COMPRESS_NONE Compression = 0
+	CBFS_COMPRESS_LZMA Compression = 1
+	CBFS_COMPRESS_LZ4  Compression = 2
+)
+
+var compressionNames = map[Compression]string{
+	CBFS_COMPRESS_NONE: "none",
+	CBFS_COMPRESS_LZMA: "LZMA",
+	CBFS_COMPRESS_LZ4:  "LZ4",
+}
+
+func (c Compression) String() string {
+	if n, ok := compressionNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("(unknown %#x)", uint32(c))
+}
+
+// ParseCompression returns the compression named name, in any case.
+func ParseCompression(name string) (Compression, error) {
+	for c, n := range compressionNames {
+		if strings.EqualFold(n, name) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown compression %q", ErrBadCBFS, name)
+}
+
+// CBFS file attribute tags.
+const (
+	CBFS_FILE_ATTR_TAG_UNUSED      = 0
+	CBFS_FILE_ATTR_TAG_UNUSED2     = 0xffffffff
+	CBFS_FILE_ATTR_TAG_COMPRESSION = 0x42435a4c
+	CBFS_FILE_ATTR_TAG_HASH        = 0x68736148
+	CBFS_FILE_ATTR_TAG_POSITION    = 0x42435350
+	CBFS_FILE_ATTR_TAG_ALIGNMENT   = 0x42434c41
+	CBFS_FILE_ATTR_TAG_PADDING     = 0x47444150
+	CBFS_FILE_ATTR_TAG_STAGEHEADER = 0x53746748
+)
+
+const (
+	// cbfsFileHeaderSize is the size of the fixed part of file headers.
+	cbfsFileHeaderSize = 24
+	// cbfsNameAlign is the alignment of file names, with their NUL.
+	cbfsNameAlign = 16
+	// cbfsCompressionAttrSize is the size of compression attributes.
+	cbfsCompressionAttrSize = 16
+	// cbfsHeaderSize is the size of the master header.
+	cbfsHeaderSize = 32
+)
+
+// Errors of CBFS.
+var (
+	ErrNoCBFS         = errors.New("no CBFS found")
+	ErrBadCBFS        = errors.New("bad CBFS")
+	ErrNoCBFSFile     = errors.New("no such CBFS file")
+	ErrCBFSFileExists = errors.New("CBFS file exists")
+	ErrCBFSFull       = errors.New("no room in CBFS")
+)
+
+// CBFSHeader is the CBFS master header, which locates CBFS in images
+// without a flash map.
+type CBFSHeader struct {
+	Magic         uint32
+	Version       uint32
+	ROMSize       uint32
+	BootBlockSize uint32
+	Align         uint32
+	Offset        uint32
+	Architecture  uint32
+	Pad           uint32
+}
+
+// CBFSFile is a file of a CBFS.
+type CBFSFile struct {
+	Name string
+	Type FileType
+	// Offset is where the file header is, from the start of the image.
+	Offset int64
+	// DataOffset is where the data is, from the start of the image.
+	DataOffset int64
+	// Size is the size of the data, as stored.
+	Size uint32
+	// Compression is that of the data, and DecompressedSize its size
+	// once decompressed.
+	Compression      Compression
+	DecompressedSize uint32
+}
+
+func (f *CBFSFile) String() string {
+	return fmt.Sprintf("%-32s %#08x %-12s %8d %s", f.Name, f.Offset, f.Type, f.Size, f.Compression)
+}
+
+// CBFS is a coreboot file system, the files of a region of a firmware
+// image.
+type CBFS struct {
+	// Offset and Size are those of the region, from the start of the image.
+	Offset int64
+	Size   int64
+	Align  int64
+	Files  []*CBFSFile
+
+	// data is the region.
+	data []byte
+}
+
+// OpenCBFS reads the CBFS in the size bytes at off of an image.
+func OpenCBFS(r io.ReaderAt, off int64, size int64) (*CBFS, error) {
+	return openCBFS(r, off, size, CBFSAlign)
+}
+
+// NewCBFS makes the size bytes at off of an image an empty CBFS, of one
+// empty file, and writes it with w.
+func NewCBFS(w io.WriterAt, off int64, size int64) (*CBFS, error) {
+	null := int64(len(fileHeader("", CBFS_TYPE_NULL, 0, CBFS_COMPRESS_NONE, 0)))
+	if size < null {
+		return nil, fmt.Errorf("%w: %d bytes is too small", ErrBadCBFS, size)
+	}
+	c := &CBFS{Offset: off, Size: size, Align: CBFSAlign, data: bytes.Repeat([]byte{0xff}, int(size))}
+	copy(c.data, fileHeader("", CBFS_TYPE_NULL, int(size-null), CBFS_COMPRESS_NONE, 0))
+	if _, err := w.WriteAt(c.data, off); err != nil {
+		return nil, fmt.Errorf("writing CBFS at %#x: %w", off, err)
+	}
+	return c, c.walk()
+}
+
+func openCBFS(r io.ReaderAt, off int64, size int64, align int64) (*CBFS, error) {
+	if align <= 0 || align&(align-1) != 0 {
+		return nil, fmt.Errorf("%w: alignment %d", ErrBadCBFS, align)
+	}
+	c := &CBFS{Offset: off, Size: size, Align: align, data: make([]byte, size)}
+	if _, err := r.ReadAt(c.data, off); err != nil {
+		return nil, fmt.Errorf("reading CBFS at %#x: %w", off, err)
+	}
+	if err := c.walk(); err != nil {
+		return nil, err
+	}
+	if len(c.Files) == 0 {
+		return nil, ErrNoCBFS
+	}
+	return c, nil
+}
+
+func alignUp(n int64, align int64) int64 {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// walk finds the files of c, which are aligned, and between which there
+// may be padding.
+func (c *CBFS) walk() error {
+	c.Files = nil
+	for off := int64(0); off+cbfsFileHeaderSize <= c.Size; {
+		b := c.data[off:]
+		if string(b[:8]) != CBFSFileMagic {
+			off += c.Align
+			continue
+		}
+		f, err := c.parseFile(off)
+		if err != nil {
+			return err
+		}
+		c.Files = append(c.Files, f)
+		off = alignUp(f.DataOffset-c.Offset+int64(f.Size), c.Align)
+	}
+	return nil
+}
+
+func (c *CBFS) parseFile(off int64) (*CBFSFile, error) {
+	b := c.data[off:]
+	size := binary.BigEndian.Uint32(b[8:])
+	attrs := int64(binary.BigEndian.Uint32(b[16:]))
+	data := int64(binary.BigEndian.Uint32(b[20:]))
+	if data < cbfsFileHeaderSize || data+int64(size) > int64(len(b)) {
+		return nil, fmt.Errorf("%w: file at %#x has data at %#x of %#x bytes", ErrBadCBFS, c.Offset+off, data, size)
+	}
+	nameEnd := data
+	if attrs != 0 {
+		if attrs < cbfsFileHeaderSize || attrs > data {
+			return nil, fmt.Errorf("%w: file at %#x has attributes at %#x", ErrBadCBFS, c.Offset+off, attrs)
+		}
+		nameEnd = attrs
+	}
+	f := &CBFSFile{
+		Name:       cString(b[cbfsFileHeaderSize:nameEnd]),
+		Type:       FileType(binary.BigEndian.Uint32(b[12:])),
+		Offset:     c.Offset + off,
+		DataOffset: c.Offset + off + data,
+		Size:       size,
+	}
+	f.DecompressedSize = size
+	for a := attrs; attrs != 0 && a+8 <= data; {
+		tag := binary.BigEndian.Uint32(b[a:])
+		n := int64(binary.BigEndian.Uint32(b[a+4:]))
+		if tag == CBFS_FILE_ATTR_TAG_UNUSED || tag == CBFS_FILE_ATTR_TAG_UNUSED2 || n < 8 || a+n > data {
+			break
+		}
+		if tag == CBFS_FILE_ATTR_TAG_COMPRESSION && n >= cbfsCompressionAttrSize {
+			f.Compression = Compression(binary.BigEndian.Uint32(b[a+8:]))
+			f.DecompressedSize = binary.BigEndian.Uint32(b[a+12:])
+		}
+		a += n
+	}
+	return f, nil
+}
+
+// ReadCBFS reads the CBFS of a firmware image of size bytes, like a ROM
+// file or a *flash.Flash. It is in the COREBOOT area of the flash map, or,
+// in images without one, where the CBFS master header says, which the last
+// 4 bytes of the image point to.
+func ReadCBFS(r io.ReaderAt, size int64) (*CBFS, error) {
+	fmap, err := ReadFMAP(r, size)
+	if err == nil {
+		a, err := fmap.Area("COREBOOT")
+		if err != nil {
+			return nil, err
+		}
+		return OpenCBFS(r, int64(a.Offset), int64(a.Size))
+	}
+	if !errors.Is(err, ErrNoFMAP) {
+		return nil, err
+	}
+
+	var rel int32
+	if err := binary.Read(io.NewSectionReader(r, size-4, 4), binary.LittleEndian, &rel); err != nil {
+		return nil, fmt.Errorf("reading CBFS master header pointer: %w", err)
+	}
+	off := size + int64(rel)
+	if off < 0 || off+cbfsHeaderSize > size {
+		return nil, ErrNoCBFS
+	}
+	var h CBFSHeader
+	if err := binary.Read(io.NewSectionReader(r, off, cbfsHeaderSize), binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("reading CBFS master header: %w", err)
+	}
+	if h.Magic != CBFSHeaderMagic {
+		return nil, ErrNoCBFS
+	}
+	// The region ends where the bootblock, at the end of the image,
+	// starts.
+	start, end := int64(h.Offset), int64(h.ROMSize)-int64(h.BootBlockSize)
+	if int64(h.ROMSize) != size || start >= end {
+		return nil, fmt.Errorf("%w: master header of a %#x byte image has CBFS at %#x-%#x", ErrBadCBFS, h.ROMSize, start, end)
+	}
+	return openCBFS(r, start, end-start, int64(h.Align))
+}
+
+// File returns the file named name.
+func (c *CBFS) File(name string) (*CBFSFile, error) {
+	for _, f := range c.Files {
+		if f.Name == name && f.Type != CBFS_TYPE_NULL && f.Type != CBFS_TYPE_DELETED {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNoCBFSFile, name)
+}
+
+// ReadFile returns the data of the file named name, decompressed. Stages
+// of old coreboot, of type CBFS_TYPE_LEGACY_STAGE, compress their
+// contents, not their files, and are returned as stored.
+func (c *CBFS) ReadFile(name string) ([]byte, error) {
+	f, err := c.File(name)
+	if err != nil {
+		return nil, err
+	}
+	off := f.DataOffset - c.Offset
+	b := c.data[off : off+int64(f.Size)]
+	d, err := decompress(b, f.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(d) != int(f.DecompressedSize) {
+		return nil, fmt.Errorf("%w: %s is %d bytes decompressed, not %d", ErrBadCBFS, name, len(d), f.DecompressedSize)
+	}
+	return d, nil
+}
+
+func decompress(b []byte, c Compression) ([]byte, error) {
+	var r io.Reader
+	switch c {
+	case CBFS_COMPRESS_NONE:
+		return append([]byte(nil), b...), nil
+	case CBFS_COMPRESS_LZMA:
+		lr, err := lzma.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("LZMA: %w", err)
+		}
+		r = lr
+	case CBFS_COMPRESS_LZ4:
+		r = lz4.NewReader(bytes.NewReader(b))
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %v", ErrBadCBFS, c)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", c, err)
+	}
+	return d, nil
+}
+
+func compress(b []byte, c Compression) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c {
+	case CBFS_COMPRESS_NONE:
+		return b, nil
+	case CBFS_COMPRESS_LZMA:
+		// coreboot wants the size in the header, and no end marker.
+		lw, err := lzma.WriterConfig{SizeInHeader: true, Size: int64(len(b))}.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("LZMA: %w", err)
+		}
+		w = lw
+	case CBFS_COMPRESS_LZ4:
+		w = lz4.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %v", ErrBadCBFS, c)
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, fmt.Errorf("%v: %w", c, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("%v: %w", c, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fileHeader encodes the header of a file of size bytes, with a
+// compression attribute unless comp is CBFS_COMPRESS_NONE.
+func fileHeader(name string, typ FileType, size int, comp Compression, decompressed int) []byte {
+	n := alignUp(int64(len(name)+1), cbfsNameAlign)
+	attrs, data := int64(0), cbfsFileHeaderSize+n
+	if comp != CBFS_COMPRESS_NONE {
+		attrs = data
+		data += cbfsCompressionAttrSize
+	}
+	b := make([]byte, data)
+	copy(b, CBFSFileMagic)
+	binary.BigEndian.PutUint32(b[8:], uint32(size))
+	binary.BigEndian.PutUint32(b[12:], uint32(typ))
+	binary.BigEndian.PutUint32(b[16:], uint32(attrs))
+	binary.BigEndian.PutUint32(b[20:], uint32(data))
+	copy(b[cbfsFileHeaderSize:], name)
+	if attrs != 0 {
+		binary.BigEndian.PutUint32(b[attrs:], CBFS_FILE_ATTR_TAG_COMPRESSION)
+		binary.BigEndian.PutUint32(b[attrs+4:], cbfsCompressionAttrSize)
+		binary.BigEndian.PutUint32(b[attrs+8:], uint32(comp))
+		binary.BigEndian.PutUint32(b[attrs+12:], uint32(decompressed))
+	}
+	return b
+}
+
+// AddFile adds a file named name, of data compressed with comp, to c, in
+// the first empty file big enough for it, and writes it to the image with
+// w. What is left of the empty file stays empty.
+//
+// Images that coreboot verifies, with CONFIG_CBFS_VERIFICATION, also need
+// their metadata hash updated, which AddFile does not do.
+func (c *CBFS) AddFile(w io.WriterAt, name string, typ FileType, data []byte, comp Compression) error {
+	if _, err := c.File(name); err == nil {
+		return fmt.Errorf("%w: %q", ErrCBFSFileExists, name)
+	}
+	if typ == CBFS_TYPE_NULL || typ == CBFS_TYPE_DELETED {
+		return fmt.Errorf("%w: cannot add a %v file", ErrBadCBFS, typ)
+	}
+	d, err := compress(data, comp)
+	if err != nil {
+		return err
+	}
+	b := append(fileHeader(name, typ, len(d), comp, len(data)), d...)
+	null := int64(len(fileHeader("", CBFS_TYPE_NULL, 0, CBFS_COMPRESS_NONE, 0)))
+
+	for _, f := range c.Files {
+		if f.Type != CBFS_TYPE_NULL {
+			continue
+		}
+		start, end := f.Offset-c.Offset, f.DataOffset-c.Offset+int64(f.Size)
+		used := alignUp(start+int64(len(b)), c.Align)
+		rest := end - used
+		if used > end || (rest != 0 && rest < null) {
+			continue
+		}
+		// Pad the file to the alignment, and follow it with what is
+		// left of the empty file.
+		for int64(len(b)) < used-start {
+			b = append(b, 0xff)
+		}
+		if rest != 0 {
+			b = append(b, fileHeader("", CBFS_TYPE_NULL, int(rest-null), CBFS_COMPRESS_NONE, 0)...)
+		}
+		if _, err := w.WriteAt(b, c.Offset+start); err != nil {
+			return fmt.Errorf("writing %s at %#x: %w", name, c.Offset+start, err)
+		}
+		copy(c.data[start:], b)
+		return c.walk()
+	}
+	return fmt.Errorf("%w: %q is %d bytes", ErrCBFSFull, name, len(b))
+}
+
+// OpenCBFSFile reads the CBFS of the firmware image in the file name.
+func OpenCBFSFile(name string) (*CBFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadCBFS(f, fi.Size())
+}
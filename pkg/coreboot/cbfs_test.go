@@ -0,0 +1,235 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coreboot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testFile struct {
+	name string
+	typ  FileType
+	data []byte
+	comp Compression
+}
+
+var testFiles = []testFile{
+	{name: "config", typ: CBFS_TYPE_RAW, data: []byte("CONFIG_VENDOR_EMULATION=y\n"), comp: CBFS_COMPRESS_NONE},
+	{name: "fallback/payload", typ: CBFS_TYPE_SELF, data: bytes.Repeat([]byte("u-root "), 1000), comp: CBFS_COMPRESS_LZMA},
+	{name: "fallback/romstage", typ: CBFS_TYPE_STAGE, data: bytes.Repeat([]byte{0x90, 0xeb, 0xfe}, 2000), comp: CBFS_COMPRESS_LZ4},
+	{name: "cmos_layout.bin", typ: CBFS_TYPE_CMOS_LAYOUT, data: nil, comp: CBFS_COMPRESS_NONE},
+}
+
+func addFiles(t *testing.T, img image, c *CBFS) {
+	t.Helper()
+	for _, f := range testFiles {
+		if err := c.AddFile(img, f.name, f.typ, f.data, f.comp); err != nil {
+			t.Fatalf("AddFile(%s) = %v", f.name, err)
+		}
+	}
+}
+
+func checkFiles(t *testing.T, c *CBFS) {
+	t.Helper()
+	var names []string
+	for _, f := range c.Files {
+		names = append(names, f.Name)
+	}
+	want := []string{"config", "fallback/payload", "fallback/romstage", "cmos_layout.bin", ""}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("Files (-want, +got): %s", diff)
+	}
+	for _, tf := range testFiles {
+		f, err := c.File(tf.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type != tf.typ || f.Compression != tf.comp || f.DecompressedSize != uint32(len(tf.data)) {
+			t.Errorf("File(%s) = %v, want type %v, compression %v, %d bytes", tf.name, f, tf.typ, tf.comp, len(tf.data))
+		}
+		if f.Offset%c.Align != 0 {
+			t.Errorf("File(%s) is at %#x, not aligned to %d", tf.name, f.Offset, c.Align)
+		}
+		b, err := c.ReadFile(tf.name)
+		if err != nil {
+			t.Errorf("ReadFile(%s) = %v", tf.name, err)
+			continue
+		}
+		if !bytes.Equal(b, tf.data) {
+			t.Errorf("ReadFile(%s) = %q, want %q", tf.name, b, tf.data)
+		}
+	}
+	if last := c.Files[len(c.Files)-1]; last.Type != CBFS_TYPE_NULL || last.DataOffset+int64(last.Size) != c.Offset+c.Size {
+		t.Errorf("last file %v does not fill the rest of CBFS", last)
+	}
+}
+
+func TestCBFS(t *testing.T) {
+	img := genImage(t)
+	c, err := ReadCBFS(img, int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Offset != 0x10000 || c.Size != 0x30000 || len(c.Files) != 1 {
+		t.Fatalf("ReadCBFS() = %#x bytes at %#x, %v, want one empty file in COREBOOT", c.Size, c.Offset, c.Files)
+	}
+	addFiles(t, img, c)
+	checkFiles(t, c)
+
+	// What was written is read back.
+	c, err = ReadCBFS(img, int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, c)
+	if got := c.Files[1].String(); got != "fallback/payload                 0x00010080 simple elf         57 LZMA" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if err := c.AddFile(img, "config", CBFS_TYPE_RAW, nil, CBFS_COMPRESS_NONE); !errors.Is(err, ErrCBFSFileExists) {
+		t.Errorf("AddFile(config) = %v, want %v", err, ErrCBFSFileExists)
+	}
+	if err := c.AddFile(img, "big", CBFS_TYPE_RAW, make([]byte, 0x30000), CBFS_COMPRESS_NONE); !errors.Is(err, ErrCBFSFull) {
+		t.Errorf("AddFile(big) = %v, want %v", err, ErrCBFSFull)
+	}
+	if err := c.AddFile(img, "null", CBFS_TYPE_NULL, nil, CBFS_COMPRESS_NONE); !errors.Is(err, ErrBadCBFS) {
+		t.Errorf("AddFile(null) = %v, want %v", err, ErrBadCBFS)
+	}
+	if _, err := c.ReadFile("none"); !errors.Is(err, ErrNoCBFSFile) {
+		t.Errorf("ReadFile(none) = %v, want %v", err, ErrNoCBFSFile)
+	}
+
+	// A file that fills CBFS leaves no empty file.
+	last := c.Files[len(c.Files)-1]
+	fill := int(last.DataOffset + int64(last.Size) - last.Offset - int64(len(fileHeader("fill", CBFS_TYPE_RAW, 0, CBFS_COMPRESS_NONE, 0))))
+	if err := c.AddFile(img, "fill", CBFS_TYPE_RAW, make([]byte, fill), CBFS_COMPRESS_NONE); err != nil {
+		t.Fatalf("AddFile(fill) = %v", err)
+	}
+	if last := c.Files[len(c.Files)-1]; last.Name != "fill" {
+		t.Errorf("last file is %v, want fill", last)
+	}
+
+	name := filepath.Join(t.TempDir(), "coreboot.rom")
+	if err := os.WriteFile(name, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = OpenCBFSFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Files) != len(testFiles)+1 {
+		t.Errorf("OpenCBFSFile() has %d files, want %d", len(c.Files), len(testFiles)+1)
+	}
+}
+
+// TestCBFSMasterHeader tests images without a flash map, like those of
+// old x86 boards, whose CBFS ends where the bootblock starts.
+func TestCBFSMasterHeader(t *testing.T) {
+	const size, bootblock = 0x20000, 0x1000
+	img := image(bytes.Repeat([]byte{0xff}, size))
+	if _, err := NewCBFS(img, 0, size-bootblock); err != nil {
+		t.Fatal(err)
+	}
+	var h bytes.Buffer
+	binary.Write(&h, binary.BigEndian, CBFSHeader{
+		Magic:         CBFSHeaderMagic,
+		Version:       CBFSHeaderVersion2,
+		ROMSize:       size,
+		BootBlockSize: bootblock,
+		Align:         CBFSAlign,
+	})
+	copy(img[size-0x100:], h.Bytes())
+	rel := int32(-0x100)
+	binary.LittleEndian.PutUint32(img[size-4:], uint32(rel))
+
+	c, err := ReadCBFS(img, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Offset != 0 || c.Size != size-bootblock {
+		t.Errorf("ReadCBFS() = %#x bytes at %#x, want %#x at 0", c.Size, c.Offset, size-bootblock)
+	}
+	addFiles(t, img, c)
+	checkFiles(t, c)
+
+	binary.LittleEndian.PutUint32(img[size-4:], 0)
+	if _, err := ReadCBFS(img, size); !errors.Is(err, ErrNoCBFS) {
+		t.Errorf("ReadCBFS(no header) = %v, want %v", err, ErrNoCBFS)
+	}
+}
+
+func TestCBFSBad(t *testing.T) {
+	img := genImage(t)
+	// A file whose data runs past the end of CBFS.
+	copy(img[0x10000:], fileHeader("bad", CBFS_TYPE_RAW, 0x40000, CBFS_COMPRESS_NONE, 0))
+	if _, err := ReadCBFS(img, int64(len(img))); !errors.Is(err, ErrBadCBFS) {
+		t.Errorf("ReadCBFS(bad size) = %v, want %v", err, ErrBadCBFS)
+	}
+
+	if _, err := NewCBFS(img, 0, 0x20); !errors.Is(err, ErrBadCBFS) {
+		t.Errorf("NewCBFS(0x20) = %v, want %v", err, ErrBadCBFS)
+	}
+
+	img = genImage(t)
+	copy(img[0x10000:], bytes.Repeat([]byte{0xff}, 0x100))
+	if _, err := OpenCBFS(img, 0x10000, 0x100); !errors.Is(err, ErrNoCBFS) {
+		t.Errorf("OpenCBFS(empty) = %v, want %v", err, ErrNoCBFS)
+	}
+
+	img = genImage(t)
+	c, err := ReadCBFS(img, int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddFile(img, "lzma", CBFS_TYPE_RAW, []byte("data"), CBFS_COMPRESS_LZMA); err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the compressed data.
+	f, _ := c.File("lzma")
+	copy(img[f.DataOffset:], bytes.Repeat([]byte{0xff}, int(f.Size)))
+	if c, err = ReadCBFS(img, int64(len(img))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadFile("lzma"); err == nil {
+		t.Errorf("ReadFile(corrupt) = nil, want error")
+	}
+}
+
+func TestFileTypes(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		typ  FileType
+	}{
+		{name: "simple elf", typ: CBFS_TYPE_SELF},
+		{name: "cbfs header", typ: CBFS_TYPE_CBFSHEADER},
+		{name: "raw", typ: CBFS_TYPE_RAW},
+	} {
+		if typ, err := ParseFileType(tt.name); err != nil || typ != tt.typ {
+			t.Errorf("ParseFileType(%q) = %v, %v, want %v", tt.name, typ, err, tt.typ)
+		}
+		if got := tt.typ.String(); got != tt.name {
+			t.Errorf("%#x.String() = %q, want %q", uint32(tt.typ), got, tt.name)
+		}
+	}
+	if _, err := ParseFileType("bogus"); !errors.Is(err, ErrBadCBFS) {
+		t.Errorf("ParseFileType(bogus) = %v, want %v", err, ErrBadCBFS)
+	}
+	if got := FileType(0x1234).String(); got != "(unknown 0x1234)" {
+		t.Errorf("String() = %q", got)
+	}
+	if c, err := ParseCompression("lzma"); err != nil || c != CBFS_COMPRESS_LZMA {
+		t.Errorf("ParseCompression(lzma) = %v, %v, want LZMA", c, err)
+	}
+	if _, err := ParseCompression("zstd"); !errors.Is(err, ErrBadCBFS) {
+		t.Errorf("ParseCompression(zstd) = %v, want %v", err, ErrBadCBFS)
+	}
+}
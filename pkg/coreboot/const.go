@@ -5,7 +5,7 @@
 //go:build linux
 // +build linux
 
-package main
+package coreboot
 
 // Constants from coreboot. We will not change these names.
 const (
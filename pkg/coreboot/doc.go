@@ -0,0 +1,9 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package coreboot reads what coreboot leaves behind: its tables, CBMEM
+// console and time stamps, in memory, on Linux, from /dev/mem or a dump of
+// it; and the flash map, CBFS and event log of firmware images, from a ROM
+// file or a *flash.Flash.
+package coreboot
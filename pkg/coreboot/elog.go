@@ -0,0 +1,179 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coreboot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Event log magic numbers.
+const (
+	ELOG_SIGNATURE      = 0x474f4c45 // "ELOG"
+	ELOG_VERSION        = 1
+	ELOG_TYPE_EOL       = 0xff
+	elogHeaderSize      = 8
+	elogEventHeaderSize = 8
+)
+
+// Event types, of SMBIOS and of coreboot.
+const (
+	ELOG_TYPE_LOG_CLEAR         = 0x16
+	ELOG_TYPE_SYSTEM_BOOT       = 0x17
+	ELOG_TYPE_OS_EVENT          = 0x81
+	ELOG_TYPE_OS_BOOT           = 0x90
+	ELOG_TYPE_EC_EVENT          = 0x91
+	ELOG_TYPE_POWER_FAIL        = 0x92
+	ELOG_TYPE_SUS_POWER_FAIL    = 0x93
+	ELOG_TYPE_PWROK_FAIL        = 0x94
+	ELOG_TYPE_SYS_PWROK_FAIL    = 0x95
+	ELOG_TYPE_POWER_ON          = 0x96
+	ELOG_TYPE_POWER_BUTTON      = 0x97
+	ELOG_TYPE_POWER_BUTTON_OVR  = 0x98
+	ELOG_TYPE_RESET_BUTTON      = 0x99
+	ELOG_TYPE_SYSTEM_RESET      = 0x9a
+	ELOG_TYPE_RTC_RESET         = 0x9b
+	ELOG_TYPE_TCO_RESET         = 0x9c
+	ELOG_TYPE_ACPI_ENTER        = 0x9d
+	ELOG_TYPE_ACPI_WAKE         = 0x9e
+	ELOG_TYPE_CR50_UPDATE       = 0x9f
+	ELOG_TYPE_CROS_DEVELOPER    = 0xa0
+	ELOG_TYPE_CROS_RECOVERY     = 0xa1
+	ELOG_TYPE_MANAGEMENT_ENGINE = 0xa2
+	ELOG_TYPE_LAST_POST_CODE    = 0xa3
+)
+
+// EventTypeNames are the names of event types.
+var EventTypeNames = map[uint8]string{
+	0x01:                        "Single-bit ECC memory error",
+	0x02:                        "Multi-bit ECC memory error",
+	0x03:                        "Parity memory error",
+	0x04:                        "Bus timeout",
+	0x05:                        "I/O channel block",
+	0x06:                        "Software NMI",
+	0x07:                        "POST memory resize",
+	0x08:                        "POST error",
+	0x09:                        "PCI parity error",
+	0x0a:                        "PCI system error",
+	0x0b:                        "CPU failure",
+	0x0c:                        "EISA failsafe timer timeout",
+	0x0d:                        "Correctable memory log disabled",
+	0x0e:                        "Logging disabled",
+	0x10:                        "System limit exceeded",
+	0x11:                        "Hardware watchdog reset",
+	0x12:                        "System configuration information",
+	0x13:                        "Hard-disk information",
+	0x14:                        "System reconfigured",
+	0x15:                        "Uncorrectable CPU-complex error",
+	ELOG_TYPE_LOG_CLEAR:         "Log area cleared",
+	ELOG_TYPE_SYSTEM_BOOT:       "System boot",
+	ELOG_TYPE_OS_EVENT:          "Kernel event",
+	ELOG_TYPE_OS_BOOT:           "OS boot",
+	ELOG_TYPE_EC_EVENT:          "EC event",
+	ELOG_TYPE_POWER_FAIL:        "Power fail",
+	ELOG_TYPE_SUS_POWER_FAIL:    "SUS power fail",
+	ELOG_TYPE_PWROK_FAIL:        "PWROK fail",
+	ELOG_TYPE_SYS_PWROK_FAIL:    "SYS PWROK fail",
+	ELOG_TYPE_POWER_ON:          "Power on",
+	ELOG_TYPE_POWER_BUTTON:      "Power button",
+	ELOG_TYPE_POWER_BUTTON_OVR:  "Power button override",
+	ELOG_TYPE_RESET_BUTTON:      "Reset button",
+	ELOG_TYPE_SYSTEM_RESET:      "System reset",
+	ELOG_TYPE_RTC_RESET:         "RTC reset",
+	ELOG_TYPE_TCO_RESET:         "TCO reset",
+	ELOG_TYPE_ACPI_ENTER:        "ACPI enter",
+	ELOG_TYPE_ACPI_WAKE:         "ACPI wake",
+	ELOG_TYPE_CR50_UPDATE:       "cr50 update",
+	ELOG_TYPE_CROS_DEVELOPER:    "Chrome OS developer mode",
+	ELOG_TYPE_CROS_RECOVERY:     "Chrome OS recovery mode",
+	ELOG_TYPE_MANAGEMENT_ENGINE: "Management engine",
+	ELOG_TYPE_LAST_POST_CODE:    "Last post code in previous boot",
+}
+
+// Errors of event logs.
+var (
+	ErrNoEventLog  = errors.New("no event log found")
+	ErrBadEventLog = errors.New("bad event log")
+)
+
+// Event is an event of the coreboot event log.
+type Event struct {
+	Type uint8
+	// Time is when the event happened, in the time zone of the RTC,
+	// which coreboot does not know, so it is in UTC.
+	Time time.Time
+	Data []byte
+}
+
+func (e Event) String() string {
+	n, ok := EventTypeNames[e.Type]
+	if !ok {
+		n = fmt.Sprintf("Unknown event %#02x", e.Type)
+	}
+	s := fmt.Sprintf("%s | %s", e.Time.Format(time.DateTime), n)
+	if len(e.Data) > 0 {
+		s += fmt.Sprintf(" | % x", e.Data)
+	}
+	return s
+}
+
+func bcd(b byte) int {
+	return int(b>>4)*10 + int(b&0xf)
+}
+
+// ParseEventLog parses the events of the event log in b, which starts
+// with its header. A bad event ends the log: the events before it are
+// returned, with an error wrapping ErrBadEventLog.
+func ParseEventLog(b []byte) ([]Event, error) {
+	if len(b) < elogHeaderSize || binary.LittleEndian.Uint32(b) != ELOG_SIGNATURE {
+		return nil, ErrNoEventLog
+	}
+	if b[4] != ELOG_VERSION || b[5] != elogHeaderSize {
+		return nil, fmt.Errorf("%w: version %d, header size %d", ErrBadEventLog, b[4], b[5])
+	}
+	var events []Event
+	for off := elogHeaderSize; off < len(b) && b[off] != ELOG_TYPE_EOL; {
+		e := b[off:]
+		if len(e) < 2 {
+			return events, fmt.Errorf("%w: event at %#x is truncated", ErrBadEventLog, off)
+		}
+		n := int(e[1])
+		if n < elogEventHeaderSize+1 || n > len(e) {
+			return events, fmt.Errorf("%w: event at %#x is %d bytes", ErrBadEventLog, off, n)
+		}
+		var sum byte
+		for _, c := range e[:n] {
+			sum += c
+		}
+		if sum != 0 {
+			return events, fmt.Errorf("%w: event at %#x has a bad checksum", ErrBadEventLog, off)
+		}
+		events = append(events, Event{
+			Type: e[0],
+			Time: time.Date(2000+bcd(e[2]), time.Month(bcd(e[3])), bcd(e[4]), bcd(e[5]), bcd(e[6]), bcd(e[7]), 0, time.UTC),
+			Data: append([]byte(nil), e[elogEventHeaderSize:n-1]...),
+		})
+		off += n
+	}
+	return events, nil
+}
+
+// ReadEventLog reads the events of the event log of a firmware image of
+// size bytes, like a ROM file or a *flash.Flash, which is in the RW_ELOG
+// area of its flash map.
+func ReadEventLog(r io.ReaderAt, size int64) ([]Event, error) {
+	f, err := ReadFMAP(r, size)
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.ReadArea(r, "RW_ELOG")
+	if err != nil {
+		return nil, err
+	}
+	return ParseEventLog(b)
+}
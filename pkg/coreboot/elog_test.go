@@ -0,0 +1,90 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coreboot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// event encodes an event at 2024-03-15 13:45:30.
+func event(typ uint8, data ...byte) []byte {
+	e := append([]byte{typ, byte(elogEventHeaderSize + len(data) + 1), 0x24, 0x03, 0x15, 0x13, 0x45, 0x30}, data...)
+	var sum byte
+	for _, b := range e {
+		sum += b
+	}
+	return append(e, -sum)
+}
+
+func eventLog(events ...[]byte) []byte {
+	b := []byte{'E', 'L', 'O', 'G', ELOG_VERSION, elogHeaderSize, 0xff, 0xff}
+	for _, e := range events {
+		b = append(b, e...)
+	}
+	for len(b) < 0x1000 {
+		b = append(b, ELOG_TYPE_EOL)
+	}
+	return b
+}
+
+func TestEventLog(t *testing.T) {
+	when := time.Date(2024, time.March, 15, 13, 45, 30, 0, time.UTC)
+	img := genImage(t)
+	copy(img[0x2000:], eventLog(
+		event(ELOG_TYPE_LOG_CLEAR, 0x00, 0x10),
+		event(ELOG_TYPE_SYSTEM_BOOT, 0x2a, 0x00, 0x00, 0x00),
+		event(0xb0),
+	))
+	events, err := ReadEventLog(img, int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{Type: ELOG_TYPE_LOG_CLEAR, Time: when, Data: []byte{0x00, 0x10}},
+		{Type: ELOG_TYPE_SYSTEM_BOOT, Time: when, Data: []byte{0x2a, 0x00, 0x00, 0x00}},
+		{Type: 0xb0, Time: when},
+	}
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Errorf("ReadEventLog() (-want, +got): %s", diff)
+	}
+	for i, s := range []string{
+		"2024-03-15 13:45:30 | Log area cleared | 00 10",
+		"2024-03-15 13:45:30 | System boot | 2a 00 00 00",
+		"2024-03-15 13:45:30 | Unknown event 0xb0",
+	} {
+		if got := events[i].String(); got != s {
+			t.Errorf("String() = %q, want %q", got, s)
+		}
+	}
+
+	bad := event(ELOG_TYPE_POWER_ON)
+	bad[len(bad)-1]++
+	for _, tt := range []struct {
+		name string
+		log  []byte
+		n    int
+		err  error
+	}{
+		{name: "none", log: make([]byte, 0x100), err: ErrNoEventLog},
+		{name: "version", log: append([]byte("ELOG\x02\x08\xff\xff"), 0xff), err: ErrBadEventLog},
+		{name: "checksum", log: eventLog(event(ELOG_TYPE_POWER_ON), bad), n: 1, err: ErrBadEventLog},
+		{name: "length", log: append([]byte("ELOG\x01\x08\xff\xff"), ELOG_TYPE_POWER_ON, 3), err: ErrBadEventLog},
+		{name: "truncated", log: append([]byte("ELOG\x01\x08\xff\xff"), event(ELOG_TYPE_POWER_ON)[:5]...), err: ErrBadEventLog},
+		{name: "empty", log: eventLog()},
+	} {
+		events, err := ParseEventLog(tt.log)
+		if !errors.Is(err, tt.err) || len(events) != tt.n {
+			t.Errorf("%s: ParseEventLog() = %v, %v, want %d events, %v", tt.name, events, err, tt.n, tt.err)
+		}
+	}
+
+	if _, err := ReadEventLog(make(image, 0x1000), 0x1000); !errors.Is(err, ErrNoFMAP) {
+		t.Errorf("ReadEventLog(no flash map) = %v, want %v", err, ErrNoFMAP)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coreboot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FMAPSignature starts a flash map.
+const FMAPSignature = "__FMAP__"
+
+// Flags of flash map areas.
+const (
+	FMAP_AREA_STATIC     = 1 << 0
+	FMAP_AREA_COMPRESSED = 1 << 1
+	FMAP_AREA_RO         = 1 << 2
+	FMAP_AREA_PRESERVE   = 1 << 3
+)
+
+const (
+	fmapNameLen    = 32
+	fmapHeaderSize = 8 + 2 + 8 + 4 + fmapNameLen + 2
+	fmapAreaSize   = 4 + 4 + fmapNameLen + 2
+)
+
+// Errors of flash maps.
+var (
+	ErrNoFMAP     = errors.New("no flash map found")
+	ErrBadFMAP    = errors.New("bad flash map")
+	ErrNoFMAPArea = errors.New("no such flash map area")
+)
+
+// FMAP is a flash map, which describes the areas of a firmware image.
+type FMAP struct {
+	VerMajor uint8
+	VerMinor uint8
+	// Base is the address of the image in memory.
+	Base  uint64
+	Size  uint32
+	Name  string
+	Areas []FMAPArea
+	// Offset is where in the image the flash map is.
+	Offset int64
+}
+
+// FMAPArea is an area of a flash map.
+type FMAPArea struct {
+	Offset uint32
+	Size   uint32
+	Name   string
+	Flags  uint16
+}
+
+func (a FMAPArea) String() string {
+	var flags []string
+	for _, f := range []struct {
+		flag uint16
+		name string
+	}{
+		{FMAP_AREA_STATIC, "static"},
+		{FMAP_AREA_COMPRESSED, "compressed"},
+		{FMAP_AREA_RO, "ro"},
+		{FMAP_AREA_PRESERVE, "preserve"},
+	} {
+		if a.Flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	return fmt.Sprintf("%-24s %#08x %#08x %s", a.Name, a.Offset, a.Size, strings.Join(flags, ","))
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// ParseFMAP parses the flash map at the start of b.
+func ParseFMAP(b []byte) (*FMAP, error) {
+	if len(b) < fmapHeaderSize || string(b[:8]) != FMAPSignature {
+		return nil, ErrNoFMAP
+	}
+	f := &FMAP{
+		VerMajor: b[8],
+		VerMinor: b[9],
+		Base:     binary.LittleEndian.Uint64(b[10:]),
+		Size:     binary.LittleEndian.Uint32(b[18:]),
+		Name:     cString(b[22 : 22+fmapNameLen]),
+	}
+	if f.VerMajor != 1 {
+		return nil, fmt.Errorf("%w: version %d.%d", ErrBadFMAP, f.VerMajor, f.VerMinor)
+	}
+	n := int(binary.LittleEndian.Uint16(b[fmapHeaderSize-2:]))
+	b = b[fmapHeaderSize:]
+	if len(b) < n*fmapAreaSize {
+		return nil, fmt.Errorf("%w: %d areas in %d bytes", ErrBadFMAP, n, len(b))
+	}
+	for i := 0; i < n; i++ {
+		a := b[i*fmapAreaSize:]
+		f.Areas = append(f.Areas, FMAPArea{
+			Offset: binary.LittleEndian.Uint32(a),
+			Size:   binary.LittleEndian.Uint32(a[4:]),
+			Name:   cString(a[8 : 8+fmapNameLen]),
+			Flags:  binary.LittleEndian.Uint16(a[8+fmapNameLen:]),
+		})
+	}
+	return f, nil
+}
+
+// ReadFMAP finds and parses the flash map of an image of size bytes, like
+// a ROM file or a *flash.Flash. The flash map is not always aligned, so
+// the image is searched for its signature, from the start.
+func ReadFMAP(r io.ReaderAt, size int64) (*FMAP, error) {
+	const chunk = 1 << 20
+	buf := make([]byte, chunk+fmapHeaderSize)
+	for off := int64(0); off < size; off += chunk {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-off)], off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		b := buf[:n]
+		for i := 0; ; {
+			j := bytes.Index(b[i:], []byte(FMAPSignature))
+			if j < 0 || i+j >= chunk {
+				break
+			}
+			i += j
+			f, err := readFMAPAt(r, off+int64(i), size)
+			if err == nil {
+				return f, nil
+			}
+			i++
+		}
+	}
+	return nil, ErrNoFMAP
+}
+
+func readFMAPAt(r io.ReaderAt, off int64, size int64) (*FMAP, error) {
+	h := make([]byte, fmapHeaderSize)
+	if _, err := r.ReadAt(h, off); err != nil {
+		return nil, err
+	}
+	n := int64(binary.LittleEndian.Uint16(h[fmapHeaderSize-2:]))
+	if off+fmapHeaderSize+n*fmapAreaSize > size {
+		return nil, ErrBadFMAP
+	}
+	b := make([]byte, fmapHeaderSize+n*fmapAreaSize)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	f, err := ParseFMAP(b)
+	if err != nil {
+		return nil, err
+	}
+	f.Offset = off
+	return f, nil
+}
+
+// Area returns the area named name.
+func (f *FMAP) Area(name string) (*FMAPArea, error) {
+	for i := range f.Areas {
+		if f.Areas[i].Name == name {
+			return &f.Areas[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNoFMAPArea, name)
+}
+
+// ReadArea returns the contents of the area named name of an image read
+// with r.
+func (f *FMAP) ReadArea(r io.ReaderAt, name string) ([]byte, error) {
+	a, err := f.Area(name)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, a.Size)
+	if _, err := r.ReadAt(b, int64(a.Offset)); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func putName(b []byte, name string) error {
+	if len(name) >= fmapNameLen {
+		return fmt.Errorf("%w: name %q is longer than %d bytes", ErrBadFMAP, name, fmapNameLen-1)
+	}
+	copy(b[:fmapNameLen], name)
+	return nil
+}
+
+// MarshalBinary encodes the flash map.
+func (f *FMAP) MarshalBinary() ([]byte, error) {
+	b := make([]byte, fmapHeaderSize+len(f.Areas)*fmapAreaSize)
+	copy(b, FMAPSignature)
+	b[8], b[9] = f.VerMajor, f.VerMinor
+	binary.LittleEndian.PutUint64(b[10:], f.Base)
+	binary.LittleEndian.PutUint32(b[18:], f.Size)
+	if err := putName(b[22:], f.Name); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint16(b[fmapHeaderSize-2:], uint16(len(f.Areas)))
+	for i, a := range f.Areas {
+		e := b[fmapHeaderSize+i*fmapAreaSize:]
+		binary.LittleEndian.PutUint32(e, a.Offset)
+		binary.LittleEndian.PutUint32(e[4:], a.Size)
+		if err := putName(e[8:], a.Name); err != nil {
+			return nil, err
+		}
+		binary.LittleEndian.PutUint16(e[8+fmapNameLen:], a.Flags)
+	}
+	return b, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coreboot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// image is a firmware image in memory.
+type image []byte
+
+func (i image) ReadAt(b []byte, off int64) (int, error) {
+	return bytes.NewReader(i).ReadAt(b, off)
+}
+
+func (i image) WriteAt(b []byte, off int64) (int, error) {
+	if off+int64(len(b)) > int64(len(i)) {
+		return 0, errors.New("write past the end of the image")
+	}
+	return copy(i[off:], b), nil
+}
+
+var testFMAP = &FMAP{
+	VerMajor: 1,
+	VerMinor: 1,
+	Base:     0xfffc0000,
+	Size:     0x40000,
+	Name:     "FLASH",
+	Areas: []FMAPArea{
+		{Offset: 0, Size: 0x10000, Name: "RO_SECTION", Flags: FMAP_AREA_STATIC | FMAP_AREA_RO},
+		{Offset: 0x1234, Size: 0x100, Name: "FMAP", Flags: FMAP_AREA_STATIC},
+		{Offset: 0x2000, Size: 0x1000, Name: "RW_ELOG"},
+		{Offset: 0x10000, Size: 0x30000, Name: "COREBOOT"},
+	},
+}
+
+// genImage generates a 256K image with testFMAP, whose COREBOOT area has
+// an empty CBFS.
+func genImage(t *testing.T) image {
+	t.Helper()
+	img := image(bytes.Repeat([]byte{0xff}, 0x40000))
+	b, err := testFMAP.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(img[0x1234:], b)
+	if _, err := NewCBFS(img, 0x10000, 0x30000); err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestFMAP(t *testing.T) {
+	img := genImage(t)
+	f, err := ReadFMAP(img, int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *testFMAP
+	want.Offset = 0x1234
+	if diff := cmp.Diff(&want, f); diff != "" {
+		t.Errorf("ReadFMAP() (-want, +got): %s", diff)
+	}
+
+	a, err := f.Area("COREBOOT")
+	if err != nil || a.Offset != 0x10000 {
+		t.Errorf("Area(COREBOOT) = %v, %v, want offset 0x10000", a, err)
+	}
+	if _, err := f.Area("RW_VPD"); !errors.Is(err, ErrNoFMAPArea) {
+		t.Errorf("Area(RW_VPD) = %v, want %v", err, ErrNoFMAPArea)
+	}
+	if got, want := f.Areas[0].String(), "RO_SECTION               0x00000000 0x00010000 static,ro"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// The flash map may be anywhere, even across chunks read.
+	big := make(image, 0x300000)
+	b, _ := testFMAP.MarshalBinary()
+	copy(big[0x100000-10:], b)
+	if f, err := ReadFMAP(big, int64(len(big))); err != nil || f.Offset != 0x100000-10 {
+		t.Errorf("ReadFMAP(big) = %v, %v, want it at %#x", f, err, 0x100000-10)
+	}
+
+	for _, tt := range []struct {
+		name string
+		img  image
+		err  error
+	}{
+		{name: "empty", img: make(image, 0x1000), err: ErrNoFMAP},
+		{name: "signature only", img: append(make(image, 0x10), FMAPSignature...), err: ErrNoFMAP},
+		{name: "bad version", img: append(image(FMAPSignature), make([]byte, 0x100)...), err: ErrNoFMAP},
+	} {
+		if _, err := ReadFMAP(tt.img, int64(len(tt.img))); !errors.Is(err, tt.err) {
+			t.Errorf("%s: ReadFMAP() = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if _, err := ParseFMAP(append(image(FMAPSignature), make([]byte, 0x100)...)); !errors.Is(err, ErrBadFMAP) {
+		t.Errorf("ParseFMAP(version 0) = %v, want %v", err, ErrBadFMAP)
+	}
+	long := &FMAP{VerMajor: 1, Name: "A_NAME_FAR_TOO_LONG_FOR_THE_FLASH_MAP"}
+	if _, err := long.MarshalBinary(); !errors.Is(err, ErrBadFMAP) {
+		t.Errorf("MarshalBinary(long name) = %v, want %v", err, ErrBadFMAP)
+	}
+}
@@ -29,7 +29,7 @@ func genAPU2(n string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	out := bytes.NewBuffer([]byte("package main\nvar apu2 = []seg {\n"))
+	out := bytes.NewBuffer([]byte("package coreboot\nvar apu2 = []seg {\n"))
 	for _, m := range []struct {
 		offset int64
 		size   int64
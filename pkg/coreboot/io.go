@@ -5,7 +5,7 @@
 //go:build linux
 // +build linux
 
-package main
+package coreboot
 
 import (
 	"bytes"
@@ -36,36 +36,45 @@ var _ io.ReaderAt = &offsetReader{}
 // that absolute address is used unchanged.
 func (o *offsetReader) ReadAt(b []byte, i int64) (int, error) {
 	// This is the line that makes it "not a section reader".
-	debug("readat %#x base %#x %d bytes....", i, o.base, len(b))
+	Debug("readat %#x base %#x %d bytes....", i, o.base, len(b))
 	i -= o.base
-	debug("\treadat %d bytes at %#x", len(b), i)
+	Debug("\treadat %d bytes at %#x", len(b), i)
 	n, err := o.r.ReadAt(b, i)
-	debug("\t... i %#x n %d err %v", i, n, err)
+	Debug("\t... i %#x n %d err %v", i, n, err)
 	if err != nil && err != io.EOF {
 		return n, fmt.Errorf("reading at #%x for %d bytes: %v", i, len(b), err)
 	}
 	return n, err
 }
 
+// mapit returns a reader of sz bytes at addr of f: a mapping of memory
+// devices like /dev/mem, or a section of files like dumps of it.
 func mapit(f *os.File, addr int64, sz int) (io.ReaderAt, error) {
-	if addr+int64(size) > int64(0xffffffff) {
+	if addr+int64(sz) > int64(0xffffffff) {
 		return nil, fmt.Errorf("cbmem tables can only be in 32-bit space and (%#x-%#x is outside it", addr, addr+int64(sz))
 	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().IsRegular() {
+		return io.NewSectionReader(f, addr, int64(sz)), nil
+	}
 	ba := (addr >> 12) << 12
 	basz := sz + int(addr-ba)
-	debug("Map %#x %#x", ba, basz)
+	Debug("Map %#x %#x", ba, basz)
 	// we are limited to 32 bits.
 	b, err := syscall.Mmap(int(f.Fd()), ba, basz, syscall.PROT_READ, syscall.MAP_SHARED)
 	if err != nil {
 		return nil, fmt.Errorf("mmap %d bytes at %#x: %v", sz, addr, err)
 	}
 	off := int(addr - ba)
-	debug("new reader b len %d off %d off + size %d", len(b), off, off+sz)
+	Debug("new reader b len %d off %d off + size %d", len(b), off, off+sz)
 	return bytes.NewReader(b[off : off+sz]), nil
 }
 
 func newOffsetReader(f *os.File, off int64, sz int) (*offsetReader, error) {
-	debug("newOffsetReader(%v, %#x, %#x)", f, off, sz)
+	Debug("newOffsetReader(%v, %#x, %#x)", f, off, sz)
 	r, err := mapit(f, off, sz)
 	if err != nil {
 		return nil, err
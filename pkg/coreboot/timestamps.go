@@ -2,10 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// cbmem prints out coreboot mem table information in JSON by default,
-// and also implements the basic cbmem -list and -console commands.
-// TODO: checksum tables.
-package main
+//go:build linux
+// +build linux
+
+package coreboot
 
 import (
 	"fmt"
@@ -2,7 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+//go:build linux
+// +build linux
+
+package coreboot
 
 import (
 	"fmt"
@@ -0,0 +1,34 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9
+
+package curl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// dialReserved connects to addr over TCP from a privileged port, which NFS
+// servers may insist on, if it can bind one.
+func dialReserved(ctx context.Context, addr string) (net.Conn, error) {
+	for port := 1023; port >= 512; port-- {
+		d := net.Dialer{LocalAddr: &net.TCPAddr{Port: port}}
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return c, nil
+		}
+		if errors.Is(err, syscall.EACCES) {
+			break
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
@@ -109,3 +109,12 @@ func (m *MockScheme) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error)
 func (m *MockScheme) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
 	return mockFetch(m, u)
 }
+
+// Size implements FileScheme.Size.
+func (m *MockScheme) Size(ctx context.Context, u *url.URL) (int64, error) {
+	r, err := mockFetch(m, u)
+	if err != nil {
+		return -1, err
+	}
+	return r.Size(), nil
+}
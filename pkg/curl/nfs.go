@@ -0,0 +1,431 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/u-root/uio/uio"
+)
+
+// This is a minimal read-only NFSv3 client over TCP, from RFC 1813, with
+// ONC RPC from RFC 5531.
+
+// ONC RPC programs and procedures.
+const (
+	rpcPortmap     = 100000
+	rpcPortmapVers = 2
+	rpcGetport     = 3
+
+	rpcMount     = 100005
+	rpcMountVers = 3
+	rpcMnt       = 1
+	rpcUmnt      = 3
+	rpcExport    = 5
+
+	rpcNFS     = 100003
+	rpcNFSVers = 3
+	nfsGetattr = 1
+	nfsLookup  = 3
+	nfsRead    = 6
+
+	rpcCall     = 0
+	rpcReply    = 1
+	rpcVersion  = 2
+	rpcAuthNone = 0
+	rpcAuthUnix = 1
+	rpcLastFrag = 0x80000000
+	ipProtoTCP  = 6
+
+	rpcPortmapPort = "111"
+	// rpcMaxFrag bounds the fragments of replies.
+	rpcMaxFrag = 1 << 20
+	// nfsReadSize is within the limit of all servers.
+	nfsReadSize = 32 << 10
+	// nfsFattrLen is the length of fattr3.
+	nfsFattrLen = 84
+)
+
+var (
+	errRPC      = errors.New("bad ONC RPC message")
+	errNoExport = errors.New("no NFS export has the path")
+)
+
+// NFSStatusError is an NFS or MOUNT error status.
+type NFSStatusError uint32
+
+// Error implements error.
+func (e NFSStatusError) Error() string {
+	return fmt.Sprintf("NFS status %d", uint32(e))
+}
+
+// Unwrap returns the errno of the status, which NFSv3 statuses mostly
+// are.
+func (e NFSStatusError) Unwrap() error {
+	return syscall.Errno(e)
+}
+
+// NFSClient implements FileScheme for files of NFSv3 servers, with URLs
+// like nfs://host[:port]/export/path[?mountport=port]. The ports of NFS and
+// MOUNT that are not given are those the portmapper knows.
+//
+// The export is the longest one that the server lists which the path
+// starts with.
+type NFSClient struct {
+	// portmapPort is that of the portmapper, for tests.
+	portmapPort string
+}
+
+// xdr encodes XDR, from RFC 4506.
+type xdr []byte
+
+func (x xdr) uint32(v uint32) xdr { return binary.BigEndian.AppendUint32(x, v) }
+func (x xdr) uint64(v uint64) xdr { return binary.BigEndian.AppendUint64(x, v) }
+
+func (x xdr) opaque(b []byte) xdr {
+	x = x.uint32(uint32(len(b)))
+	x = append(x, b...)
+	return append(x, make([]byte, padLen4(len(b))-len(b))...)
+}
+
+func padLen4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// xdrReader decodes XDR. The first error sticks.
+type xdrReader struct {
+	b   []byte
+	err error
+}
+
+func (r *xdrReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.err = errRPC
+		return make([]byte, max(n, 0))
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *xdrReader) uint32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *xdrReader) uint64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+func (r *xdrReader) bool() bool     { return r.uint32() != 0 }
+
+func (r *xdrReader) opaque() []byte {
+	n := int(r.uint32())
+	if r.err != nil || n > len(r.b) {
+		r.err = errRPC
+		return nil
+	}
+	b := r.next(n)
+	r.next(padLen4(n) - n)
+	return b
+}
+
+// rpcConn is an ONC RPC connection to a program.
+type rpcConn struct {
+	c    net.Conn
+	prog uint32
+	vers uint32
+	xid  uint32
+}
+
+// dialRPC connects to the program at addr.
+func dialRPC(ctx context.Context, addr string, prog, vers uint32) (*rpcConn, error) {
+	c, err := dialReserved(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcConn{c: c, prog: prog, vers: vers}, nil
+}
+
+// call calls proc with args, and returns the reader of its results.
+func (r *rpcConn) call(proc uint32, args xdr) (*xdrReader, error) {
+	r.xid++
+	msg := xdr(nil).uint32(0).uint32(r.xid).uint32(rpcCall).uint32(rpcVersion)
+	msg = msg.uint32(r.prog).uint32(r.vers).uint32(proc)
+	// AUTH_UNIX as root, which servers map as they like.
+	hostname, _ := os.Hostname()
+	cred := xdr(nil).uint32(0).opaque([]byte(hostname)).uint32(0).uint32(0).uint32(0)
+	msg = msg.uint32(rpcAuthUnix).opaque(cred)
+	msg = msg.uint32(rpcAuthNone).opaque(nil)
+	msg = append(msg, args...)
+	binary.BigEndian.PutUint32(msg, rpcLastFrag|uint32(len(msg)-4))
+	if _, err := r.c.Write(msg); err != nil {
+		return nil, err
+	}
+
+	for {
+		var reply []byte
+		for last := false; !last; {
+			h := make([]byte, 4)
+			if _, err := io.ReadFull(r.c, h); err != nil {
+				return nil, err
+			}
+			frag := binary.BigEndian.Uint32(h)
+			last = frag&rpcLastFrag != 0
+			if frag&^rpcLastFrag > rpcMaxFrag {
+				return nil, fmt.Errorf("%w: fragment of %d bytes", errRPC, frag&^rpcLastFrag)
+			}
+			b := make([]byte, frag&^rpcLastFrag)
+			if _, err := io.ReadFull(r.c, b); err != nil {
+				return nil, err
+			}
+			reply = append(reply, b...)
+		}
+
+		x := &xdrReader{b: reply}
+		xid, typ := x.uint32(), x.uint32()
+		if x.err != nil || typ != rpcReply {
+			return nil, errRPC
+		}
+		if xid != r.xid {
+			continue
+		}
+		if stat := x.uint32(); stat != 0 {
+			return nil, fmt.Errorf("%w: call denied (%d)", errRPC, stat)
+		}
+		x.uint32()
+		x.opaque()
+		if stat := x.uint32(); stat != 0 || x.err != nil {
+			return nil, fmt.Errorf("%w: call not accepted (%d)", errRPC, stat)
+		}
+		return x, nil
+	}
+}
+
+func (r *rpcConn) Close() error {
+	return r.c.Close()
+}
+
+// getport asks the portmapper of host for the TCP port of prog.
+func (n *NFSClient) getport(ctx context.Context, host string, prog, vers uint32) (string, error) {
+	port := n.portmapPort
+	if port == "" {
+		port = rpcPortmapPort
+	}
+	c, err := dialRPC(ctx, net.JoinHostPort(host, port), rpcPortmap, rpcPortmapVers)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	x, err := c.call(rpcGetport, xdr(nil).uint32(prog).uint32(vers).uint32(ipProtoTCP).uint32(0))
+	if err != nil {
+		return "", err
+	}
+	p := x.uint32()
+	if x.err != nil || p == 0 {
+		return "", fmt.Errorf("%w: program %d is not registered", errRPC, prog)
+	}
+	return fmt.Sprint(p), nil
+}
+
+// mount returns the file handle of the export that has p, and the rest of
+// p.
+func (n *NFSClient) mount(ctx context.Context, u *url.URL) ([]byte, string, error) {
+	port := u.Query().Get("mountport")
+	if port == "" {
+		var err error
+		if port, err = n.getport(ctx, u.Hostname(), rpcMount, rpcMountVers); err != nil {
+			return nil, "", err
+		}
+	}
+	c, err := dialRPC(ctx, net.JoinHostPort(u.Hostname(), port), rpcMount, rpcMountVers)
+	if err != nil {
+		return nil, "", err
+	}
+	defer c.Close()
+
+	x, err := c.call(rpcExport, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	p := path.Clean("/" + u.Path)
+	export := ""
+	for x.bool() {
+		dir := path.Clean(string(x.opaque()))
+		for x.bool() {
+			x.opaque()
+		}
+		if (p == dir || strings.HasPrefix(p, dir+"/") || dir == "/") && len(dir) > len(export) {
+			export = dir
+		}
+	}
+	if x.err != nil {
+		return nil, "", x.err
+	}
+	if export == "" {
+		return nil, "", fmt.Errorf("%w: %s", errNoExport, p)
+	}
+
+	x, err = c.call(rpcMnt, xdr(nil).opaque([]byte(export)))
+	if err != nil {
+		return nil, "", err
+	}
+	if stat := x.uint32(); stat != 0 {
+		return nil, "", NFSStatusError(stat)
+	}
+	fh := x.opaque()
+	if x.err != nil {
+		return nil, "", x.err
+	}
+	// The handle stays valid after UMNT, which only updates the
+	// server's list of clients.
+	c.call(rpcUmnt, xdr(nil).opaque([]byte(export)))
+	return fh, strings.TrimPrefix(p, export), nil
+}
+
+// nfsFile is a file of an NFS server.
+type nfsFile struct {
+	c  *rpcConn
+	fh []byte
+}
+
+// open looks up the file of u.
+func (n *NFSClient) open(ctx context.Context, u *url.URL) (*nfsFile, error) {
+	fh, rest, err := n.mount(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		if port, err = n.getport(ctx, u.Hostname(), rpcNFS, rpcNFSVers); err != nil {
+			return nil, err
+		}
+	}
+	c, err := dialRPC(ctx, net.JoinHostPort(u.Hostname(), port), rpcNFS, rpcNFSVers)
+	if err != nil {
+		return nil, err
+	}
+	f := &nfsFile{c: c, fh: fh}
+	for _, name := range strings.Split(rest, "/") {
+		if name == "" {
+			continue
+		}
+		x, err := c.call(nfsLookup, xdr(nil).opaque(f.fh).opaque([]byte(name)))
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if stat := x.uint32(); stat != 0 {
+			c.Close()
+			return nil, NFSStatusError(stat)
+		}
+		f.fh = x.opaque()
+		if x.err != nil {
+			c.Close()
+			return nil, x.err
+		}
+	}
+	return f, nil
+}
+
+func (f *nfsFile) size() (int64, error) {
+	x, err := f.c.call(nfsGetattr, xdr(nil).opaque(f.fh))
+	if err != nil {
+		return -1, err
+	}
+	if stat := x.uint32(); stat != 0 {
+		return -1, NFSStatusError(stat)
+	}
+	// type, mode, nlink, uid, gid, then size.
+	x.next(20)
+	size := x.uint64()
+	if x.err != nil {
+		return -1, x.err
+	}
+	return int64(size), nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *nfsFile) ReadAt(b []byte, off int64) (int, error) {
+	var n int
+	for n < len(b) {
+		m, err := f.read(b[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// read reads at most one READ of the file at off.
+func (f *nfsFile) read(b []byte, off int64) (int, error) {
+	count := min(len(b), nfsReadSize)
+	x, err := f.c.call(nfsRead, xdr(nil).opaque(f.fh).uint64(uint64(off)).uint32(uint32(count)))
+	if err != nil {
+		return 0, err
+	}
+	stat := x.uint32()
+	if x.bool() {
+		x.next(nfsFattrLen)
+	}
+	if stat != 0 {
+		return 0, NFSStatusError(stat)
+	}
+	x.uint32()
+	eof := x.bool()
+	data := x.opaque()
+	if x.err != nil {
+		return 0, x.err
+	}
+	n := copy(b, data)
+	if n == 0 && eof {
+		return 0, io.EOF
+	}
+	if n == 0 {
+		return 0, io.ErrNoProgress
+	}
+	return n, nil
+}
+
+func (f *nfsFile) Close() error {
+	return f.c.Close()
+}
+
+// Fetch implements FileScheme.Fetch for NFS.
+func (n *NFSClient) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	r, err := n.FetchRange(ctx, u, 0)
+	if err != nil {
+		return nil, err
+	}
+	return uio.NewCachingReader(r), nil
+}
+
+// FetchWithoutCache implements FileScheme.FetchWithoutCache for NFS.
+func (n *NFSClient) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
+	return n.FetchRange(ctx, u, 0)
+}
+
+// FetchRange implements RangeScheme.FetchRange for NFS.
+func (n *NFSClient) FetchRange(ctx context.Context, u *url.URL, offset int64) (io.Reader, error) {
+	f, err := n.open(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return &closingReader{r: io.NewSectionReader(f, offset, 1<<63-1-offset), c: f}, nil
+}
+
+// Size implements FileScheme.Size for NFS.
+func (n *NFSClient) Size(ctx context.Context, u *url.URL) (int64, error) {
+	f, err := n.open(ctx, u)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	return f.size()
+}
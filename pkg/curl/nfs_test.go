@@ -0,0 +1,215 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// nfsServer serves the portmapper, MOUNT and NFS on one port. File
+// handles are paths.
+type nfsServer struct {
+	port    uint32
+	exports []string
+	files   map[string][]byte
+}
+
+func (s *nfsServer) exists(p string) bool {
+	for f := range s.files {
+		if f == p || strings.HasPrefix(f, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// call returns the results of a call, or false if it is unknown.
+func (s *nfsServer) call(prog, proc uint32, x *xdrReader) (xdr, bool) {
+	var r xdr
+	switch {
+	case prog == rpcPortmap && proc == rpcGetport:
+		return r.uint32(s.port), true
+	case prog == rpcMount && proc == rpcExport:
+		for _, e := range s.exports {
+			r = r.uint32(1).opaque([]byte(e)).uint32(0)
+		}
+		return r.uint32(0), true
+	case prog == rpcMount && proc == rpcMnt:
+		dir := string(x.opaque())
+		for _, e := range s.exports {
+			if e == dir {
+				return r.uint32(0).opaque([]byte(dir)).uint32(0), true
+			}
+		}
+		return r.uint32(uint32(syscall.EACCES)), true
+	case prog == rpcMount && proc == rpcUmnt:
+		return r, true
+	case prog == rpcNFS && proc == nfsLookup:
+		p := path.Join(string(x.opaque()), string(x.opaque()))
+		if !s.exists(p) {
+			return r.uint32(uint32(syscall.ENOENT)).uint32(0), true
+		}
+		return r.uint32(0).opaque([]byte(p)).uint32(0).uint32(0), true
+	case prog == rpcNFS && proc == nfsGetattr:
+		f := s.files[string(x.opaque())]
+		attr := make(xdr, 20).uint64(uint64(len(f)))
+		return append(r.uint32(0), append(attr, make([]byte, nfsFattrLen-len(attr))...)...), true
+	case prog == rpcNFS && proc == nfsRead:
+		f, ok := s.files[string(x.opaque())]
+		if !ok {
+			return r.uint32(uint32(syscall.EISDIR)).uint32(0), true
+		}
+		off, count := int(x.uint64()), int(x.uint32())
+		data := f[min(off, len(f)):min(off+count, len(f))]
+		eof := uint32(0)
+		if off+len(data) == len(f) {
+			eof = 1
+		}
+		return r.uint32(0).uint32(0).uint32(uint32(len(data))).uint32(eof).opaque(data), true
+	}
+	return nil, false
+}
+
+func (s *nfsServer) serve(c net.Conn) {
+	defer c.Close()
+	for {
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(c, h); err != nil {
+			return
+		}
+		b := make([]byte, binary.BigEndian.Uint32(h)&^rpcLastFrag)
+		if _, err := io.ReadFull(c, b); err != nil {
+			return
+		}
+		x := &xdrReader{b: b}
+		xid := x.uint32()
+		x.uint32()
+		x.uint32()
+		prog, _, proc := x.uint32(), x.uint32(), x.uint32()
+		x.uint32()
+		x.opaque()
+		x.uint32()
+		x.opaque()
+
+		reply := xdr(nil).uint32(0).uint32(xid).uint32(rpcReply).uint32(0).uint32(rpcAuthNone).opaque(nil)
+		if res, ok := s.call(prog, proc, x); ok {
+			reply = append(reply.uint32(0), res...)
+		} else {
+			// PROC_UNAVAIL.
+			reply = reply.uint32(3)
+		}
+		binary.BigEndian.PutUint32(reply, rpcLastFrag|uint32(len(reply)-4))
+		if _, err := c.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+func newNFSServer(t *testing.T, exports []string, files map[string][]byte) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &nfsServer{port: uint32(l.Addr().(*net.TCPAddr).Port), exports: exports, files: files}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNFS(t *testing.T) {
+	big := bytes.Repeat([]byte("NFSv3"), 30000)
+	addr := newNFSServer(t, []string{"/srv", "/srv/boot"}, map[string][]byte{
+		"/srv/boot/kernel": big,
+		"/srv/config":      []byte("console=ttyS0"),
+	})
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		url    string
+		offset int64
+		want   []byte
+		err    error
+	}{
+		{name: "portmapper", url: "nfs://127.0.0.1/srv/config", want: []byte("console=ttyS0")},
+		{name: "ports", url: "nfs://" + addr + "/srv/config?mountport=" + port, want: []byte("console=ttyS0")},
+		{name: "large file", url: "nfs://127.0.0.1/srv/boot/kernel", want: big},
+		{name: "offset", url: "nfs://127.0.0.1/srv/boot/kernel", offset: 77777, want: big[77777:]},
+		{name: "missing", url: "nfs://127.0.0.1/srv/initrd", err: syscall.ENOENT},
+		{name: "no export", url: "nfs://127.0.0.1/home/file", err: errNoExport},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := &NFSClient{portmapPort: port}
+			r, err := n.FetchRange(context.Background(), u, tt.offset)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("FetchRange(%s) = %v, want %v", u, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("FetchRange(%s) = %d bytes, want %d", u, len(got), len(tt.want))
+			}
+			if tt.offset != 0 {
+				return
+			}
+			size, err := n.Size(context.Background(), u)
+			if err != nil || size != int64(len(tt.want)) {
+				t.Errorf("Size(%s) = %d, %v, want %d", u, size, err, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestNFSSchemes(t *testing.T) {
+	addr := newNFSServer(t, []string{"/"}, map[string][]byte{"/tftpboot/grub.cfg": []byte("menuentry")})
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Schemes{"nfs": &NFSClient{}}
+	u := &url.URL{Scheme: "nfs", Host: addr, Path: "/tftpboot/grub.cfg", RawQuery: "mountport=" + port}
+	f, err := s.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch(%s) = %v", u, err)
+	}
+	got := make([]byte, 4)
+	if _, err := f.ReadAt(got, 4); err != nil || string(got) != "entr" {
+		t.Errorf("ReadAt() = %q, %v, want %q", got, err, "entr")
+	}
+	if size, err := s.Size(context.Background(), u); err != nil || size != 9 {
+		t.Errorf("Size(%s) = %d, %v, want 9", u, size, err)
+	}
+}
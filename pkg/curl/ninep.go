@@ -0,0 +1,299 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/u-root/uio/uio"
+)
+
+// This is a minimal read-only 9P2000.L client, enough to read a file.
+
+// 9P2000.L message types.
+const (
+	p9Rlerror  = 7
+	p9Tlopen   = 12
+	p9Tgetattr = 24
+	p9Tversion = 100
+	p9Tattach  = 104
+	p9Twalk    = 110
+	p9Tread    = 116
+	p9Tclunk   = 120
+)
+
+const (
+	p9Version = "9P2000.L"
+	p9NoTag   = 0xffff
+	p9NoFid   = 0xffffffff
+	p9MSize   = 64 << 10
+	// p9MaxWalk is the maximum number of names in a Twalk.
+	p9MaxWalk = 16
+	// p9HeaderLen is the length of size[4] type[1] tag[2].
+	p9HeaderLen = 7
+	// p9GetattrSize asks Tgetattr for the size.
+	p9GetattrSize = 0x200
+	p9DefaultPort = "564"
+
+	p9RootFid = 0
+	p9FileFid = 1
+)
+
+var errP9 = errors.New("bad 9P message")
+
+// NinePClient implements FileScheme for files of 9P2000.L servers, with
+// URLs like 9p://host[:port]/path?aname=/export.
+type NinePClient struct {
+	// User is the user name to attach as. If empty, it is "root".
+	User string
+}
+
+// p9Conn is a connection with the file of a URL open.
+type p9Conn struct {
+	c     net.Conn
+	msize uint32
+	buf   []byte
+}
+
+func p9String(b []byte, s string) []byte {
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// rpc sends the message of typ with body, and returns the body of the
+// reply.
+func (p *p9Conn) rpc(typ uint8, tag uint16, body []byte) ([]byte, error) {
+	msg := binary.LittleEndian.AppendUint32(nil, uint32(p9HeaderLen+len(body)))
+	msg = append(msg, typ)
+	msg = binary.LittleEndian.AppendUint16(msg, tag)
+	if _, err := p.c.Write(append(msg, body...)); err != nil {
+		return nil, err
+	}
+
+	h := make([]byte, p9HeaderLen)
+	if _, err := io.ReadFull(p.c, h); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(h)
+	if size < p9HeaderLen || size > p.msize {
+		return nil, fmt.Errorf("%w: size %d", errP9, size)
+	}
+	if cap(p.buf) < int(size) {
+		p.buf = make([]byte, size)
+	}
+	resp := p.buf[:size-p9HeaderLen]
+	if _, err := io.ReadFull(p.c, resp); err != nil {
+		return nil, err
+	}
+	switch h[4] {
+	case typ + 1:
+		return resp, nil
+	case p9Rlerror:
+		if len(resp) < 4 {
+			return nil, errP9
+		}
+		return nil, syscall.Errno(binary.LittleEndian.Uint32(resp))
+	default:
+		return nil, fmt.Errorf("%w: type %d in reply to %d", errP9, h[4], typ)
+	}
+}
+
+// open connects to the server of u, and opens the file of u as
+// p9FileFid.
+func (n *NinePClient) open(ctx context.Context, u *url.URL) (*p9Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), p9DefaultPort)
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	p := &p9Conn{c: c, msize: p9MSize}
+	if err := p.open(u, n.User); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *p9Conn) open(u *url.URL, user string) error {
+	b := binary.LittleEndian.AppendUint32(nil, p9MSize)
+	resp, err := p.rpc(p9Tversion, p9NoTag, p9String(b, p9Version))
+	if err != nil {
+		return err
+	}
+	if len(resp) < 6 || string(resp[6:]) != p9Version {
+		return fmt.Errorf("%w: server does not speak %s", errP9, p9Version)
+	}
+	p.msize = min(p.msize, binary.LittleEndian.Uint32(resp))
+
+	if user == "" {
+		user = "root"
+	}
+	b = binary.LittleEndian.AppendUint32(nil, p9RootFid)
+	b = binary.LittleEndian.AppendUint32(b, p9NoFid)
+	b = p9String(b, user)
+	b = p9String(b, u.Query().Get("aname"))
+	b = binary.LittleEndian.AppendUint32(b, p9NoFid)
+	if _, err := p.rpc(p9Tattach, 0, b); err != nil {
+		return err
+	}
+
+	var names []string
+	for _, name := range strings.Split(u.Path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	fid := uint32(p9RootFid)
+	for {
+		walk := names[:min(len(names), p9MaxWalk)]
+		names = names[len(walk):]
+		b = binary.LittleEndian.AppendUint32(nil, fid)
+		b = binary.LittleEndian.AppendUint32(b, p9FileFid)
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(walk)))
+		for _, name := range walk {
+			b = p9String(b, name)
+		}
+		resp, err := p.rpc(p9Twalk, 0, b)
+		if err != nil {
+			return err
+		}
+		if len(resp) < 2 || int(binary.LittleEndian.Uint16(resp)) != len(walk) {
+			return syscall.ENOENT
+		}
+		fid = p9FileFid
+		if len(names) == 0 {
+			break
+		}
+	}
+
+	// O_RDONLY.
+	b = binary.LittleEndian.AppendUint32(nil, p9FileFid)
+	_, err = p.rpc(p9Tlopen, 0, binary.LittleEndian.AppendUint32(b, 0))
+	return err
+}
+
+func (p *p9Conn) size() (int64, error) {
+	b := binary.LittleEndian.AppendUint32(nil, p9FileFid)
+	resp, err := p.rpc(p9Tgetattr, 0, binary.LittleEndian.AppendUint64(b, p9GetattrSize))
+	if err != nil {
+		return -1, err
+	}
+	// valid[8] qid[13] mode[4] uid[4] gid[4] nlink[8] rdev[8] size[8]
+	const off = 8 + 13 + 4 + 4 + 4 + 8 + 8
+	if len(resp) < off+8 {
+		return -1, errP9
+	}
+	return int64(binary.LittleEndian.Uint64(resp[off:])), nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (p *p9Conn) ReadAt(b []byte, off int64) (int, error) {
+	var n int
+	for n < len(b) {
+		m, err := p.read(b[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// read reads at most one Rread of the file at off.
+func (p *p9Conn) read(b []byte, off int64) (int, error) {
+	// Rread has count[4] before the data.
+	n := min(len(b), int(p.msize)-p9HeaderLen-4)
+	req := binary.LittleEndian.AppendUint32(nil, p9FileFid)
+	req = binary.LittleEndian.AppendUint64(req, uint64(off))
+	resp, err := p.rpc(p9Tread, 0, binary.LittleEndian.AppendUint32(req, uint32(n)))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 4 || int(binary.LittleEndian.Uint32(resp)) > min(n, len(resp)-4) {
+		return 0, errP9
+	}
+	n = copy(b, resp[4:4+binary.LittleEndian.Uint32(resp)])
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Close clunks the fids, and closes the connection.
+func (p *p9Conn) Close() error {
+	p.rpc(p9Tclunk, 0, binary.LittleEndian.AppendUint32(nil, p9FileFid))
+	p.rpc(p9Tclunk, 0, binary.LittleEndian.AppendUint32(nil, p9RootFid))
+	return p.c.Close()
+}
+
+// Fetch implements FileScheme.Fetch for 9P.
+func (n *NinePClient) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	r, err := n.FetchRange(ctx, u, 0)
+	if err != nil {
+		return nil, err
+	}
+	return uio.NewCachingReader(r), nil
+}
+
+// FetchWithoutCache implements FileScheme.FetchWithoutCache for 9P.
+func (n *NinePClient) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
+	return n.FetchRange(ctx, u, 0)
+}
+
+// FetchRange implements RangeScheme.FetchRange for 9P.
+func (n *NinePClient) FetchRange(ctx context.Context, u *url.URL, offset int64) (io.Reader, error) {
+	p, err := n.open(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return &closingReader{r: io.NewSectionReader(p, offset, 1<<63-1-offset), c: p}, nil
+}
+
+// Size implements FileScheme.Size for 9P.
+func (n *NinePClient) Size(ctx context.Context, u *url.URL) (int64, error) {
+	p, err := n.open(ctx, u)
+	if err != nil {
+		return -1, err
+	}
+	defer p.Close()
+	return p.size()
+}
+
+// closingReader closes c when reading r fails or ends.
+type closingReader struct {
+	r io.Reader
+	c io.Closer
+}
+
+// Read implements io.Reader.
+func (r *closingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err != nil {
+		r.Close()
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (r *closingReader) Close() error {
+	if r.c == nil {
+		return nil
+	}
+	err := r.c.Close()
+	r.c = nil
+	return err
+}
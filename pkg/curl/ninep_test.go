@@ -0,0 +1,207 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/u-root/uio/uio"
+)
+
+// p9Server serves files, by path, over 9P2000.L.
+type p9Server struct {
+	files map[string][]byte
+}
+
+func (s *p9Server) isDir(p string) bool {
+	for f := range s.files {
+		if p == "" || strings.HasPrefix(f, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *p9Server) serve(c net.Conn) {
+	defer c.Close()
+	fids := map[uint32]string{}
+	for {
+		h := make([]byte, p9HeaderLen)
+		if _, err := io.ReadFull(c, h); err != nil {
+			return
+		}
+		body := make([]byte, binary.LittleEndian.Uint32(h)-p9HeaderLen)
+		if _, err := io.ReadFull(c, body); err != nil {
+			return
+		}
+		typ, tag := h[4], binary.LittleEndian.Uint16(h[5:])
+		fid := uint32(0)
+		if len(body) >= 4 {
+			fid = binary.LittleEndian.Uint32(body)
+		}
+		qid := make([]byte, 13)
+
+		var resp []byte
+		var errno syscall.Errno
+		switch typ {
+		case p9Tversion:
+			resp = p9String(binary.LittleEndian.AppendUint32(nil, 8192), p9Version)
+		case p9Tattach:
+			fids[fid] = ""
+			resp = qid
+		case p9Twalk:
+			newfid := binary.LittleEndian.Uint32(body[4:])
+			n := int(binary.LittleEndian.Uint16(body[8:]))
+			p := fids[fid]
+			b := body[10:]
+			resp = binary.LittleEndian.AppendUint16(nil, 0)
+			walked := 0
+			for i := 0; i < n; i++ {
+				l := int(binary.LittleEndian.Uint16(b))
+				name := string(b[2 : 2+l])
+				b = b[2+l:]
+				np := strings.TrimPrefix(p+"/"+name, "/")
+				if _, ok := s.files[np]; !ok && !s.isDir(np) {
+					break
+				}
+				p = np
+				walked++
+				resp = append(resp, qid...)
+			}
+			if walked == 0 && n > 0 {
+				errno = syscall.ENOENT
+				break
+			}
+			binary.LittleEndian.PutUint16(resp, uint16(walked))
+			if walked == n {
+				fids[newfid] = p
+			}
+		case p9Tlopen:
+			if _, ok := s.files[fids[fid]]; !ok {
+				errno = syscall.EISDIR
+				break
+			}
+			resp = binary.LittleEndian.AppendUint32(qid, 0)
+		case p9Tgetattr:
+			resp = make([]byte, 8+13+4+4+4+8+8)
+			resp = binary.LittleEndian.AppendUint64(resp, uint64(len(s.files[fids[fid]])))
+			resp = append(resp, make([]byte, 80)...)
+		case p9Tread:
+			f := s.files[fids[fid]]
+			off := int(binary.LittleEndian.Uint64(body[4:]))
+			count := int(binary.LittleEndian.Uint32(body[12:]))
+			data := f[min(off, len(f)):min(off+count, len(f))]
+			resp = append(binary.LittleEndian.AppendUint32(nil, uint32(len(data))), data...)
+		case p9Tclunk:
+			delete(fids, fid)
+		default:
+			errno = syscall.ENOSYS
+		}
+
+		rtyp := typ + 1
+		if errno != 0 {
+			rtyp = p9Rlerror
+			resp = binary.LittleEndian.AppendUint32(nil, uint32(errno))
+		}
+		msg := binary.LittleEndian.AppendUint32(nil, uint32(p9HeaderLen+len(resp)))
+		msg = append(msg, rtyp)
+		msg = binary.LittleEndian.AppendUint16(msg, tag)
+		if _, err := c.Write(append(msg, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func newP9Server(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &p9Server{files: files}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNineP(t *testing.T) {
+	big := bytes.Repeat([]byte("9P2000.L"), 10000)
+	deep := strings.Repeat("d/", 20) + "file"
+	addr := newP9Server(t, map[string][]byte{
+		"boot/kernel": big,
+		"config":      []byte("console=ttyS0"),
+		deep:          []byte("deep"),
+	})
+	for _, tt := range []struct {
+		name   string
+		path   string
+		offset int64
+		want   []byte
+		err    error
+	}{
+		{name: "file", path: "/config", want: []byte("console=ttyS0")},
+		{name: "large file", path: "/boot/kernel", want: big},
+		{name: "offset", path: "/boot/kernel", offset: 12345, want: big[12345:]},
+		{name: "deep", path: "/" + deep, want: []byte("deep")},
+		{name: "missing", path: "/boot/initrd", err: syscall.ENOENT},
+		{name: "directory", path: "/boot", err: syscall.EISDIR},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &url.URL{Scheme: "9p", Host: addr, Path: tt.path}
+			n := &NinePClient{}
+			r, err := n.FetchRange(context.Background(), u, tt.offset)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("FetchRange(%s) = %v, want %v", u, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("FetchRange(%s) = %d bytes, want %d", u, len(got), len(tt.want))
+			}
+			if tt.offset != 0 {
+				return
+			}
+			size, err := n.Size(context.Background(), u)
+			if err != nil || size != int64(len(tt.want)) {
+				t.Errorf("Size(%s) = %d, %v, want %d", u, size, err, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestNinePSchemes(t *testing.T) {
+	addr := newP9Server(t, map[string][]byte{"pxelinux.cfg/default": []byte("default linux")})
+	u := &url.URL{Scheme: "9p", Host: addr, Path: "/pxelinux.cfg/default"}
+	f, err := LazyFetch(u)
+	if err != nil {
+		t.Fatalf("LazyFetch(%s) = %v", u, err)
+	}
+	got, err := io.ReadAll(uio.Reader(f))
+	if err != nil || string(got) != "default linux" {
+		t.Errorf("LazyFetch(%s) = %q, %v, want %q", u, got, err, "default linux")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// ErrRangeNotSupported is returned by FetchRange if the scheme cannot
+// fetch a file from an offset.
+var ErrRangeNotSupported = errors.New("scheme does not support ranges")
+
+// ErrRangeIgnored is returned by FetchRange if an HTTP server sent the
+// whole file rather than the range, because the file changed since the
+// download started, or the server does not do ranges and it cannot be told
+// that it did not. The download has to start over.
+var ErrRangeIgnored = errors.New("server sent the whole file instead of the range")
+
+type ifRangeKey struct{}
+
+// withIfRange makes the HTTP range requests of FetchRange with ctx
+// conditional on the file still being the version of validator, an ETag or
+// Last-Modified date.
+func withIfRange(ctx context.Context, validator string) context.Context {
+	if validator == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ifRangeKey{}, validator)
+}
+
+// ifRange returns the validator of withIfRange.
+func ifRange(ctx context.Context) string {
+	v, _ := ctx.Value(ifRangeKey{}).(string)
+	return v
+}
+
+// RangeScheme is a FileScheme that can fetch a file from an offset. This
+// lets SchemeWithRetries resume downloads that fail midway.
+type RangeScheme interface {
+	FileScheme
+
+	// FetchRange returns a reader of the contents of `u` from offset on.
+	FetchRange(ctx context.Context, u *url.URL, offset int64) (io.Reader, error)
+}
+
+// FetchRange fetches the file of `u` from offset on, without caching. See
+// Schemes.FetchWithoutCache.
+//
+// If the FileScheme of `u.Scheme` is not a RangeScheme,
+// ErrRangeNotSupported is returned.
+func (s Schemes) FetchRange(ctx context.Context, u *url.URL, offset int64) (FileWithoutCache, error) {
+	fg, ok := s[u.Scheme]
+	if !ok {
+		return nil, &URLError{URL: u, Err: ErrNoSuchScheme}
+	}
+	rs, ok := fg.(RangeScheme)
+	if !ok {
+		return nil, &URLError{URL: u, Err: ErrRangeNotSupported}
+	}
+	r, err := rs.FetchRange(ctx, u, offset)
+	if err != nil {
+		return nil, &URLError{URL: u, Err: err}
+	}
+	return &file{Reader: r, url: u}, nil
+}
+
+// resumeReader reads a file of a RangeScheme, and fetches the rest of it
+// when a read fails.
+type resumeReader struct {
+	ctx    context.Context
+	s      *SchemeWithRetries
+	rs     RangeScheme
+	u      *url.URL
+	r      io.Reader
+	offset int64
+
+	// validator is the version of the file of the first response, which
+	// resumed requests ask for, so that a changed file is not spliced
+	// onto the old one.
+	validator string
+
+	// back is reset when reads make progress, so that only failures in
+	// a row exhaust it.
+	back     backoff.BackOff
+	progress bool
+}
+
+// Read implements io.Reader.
+func (r *resumeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.r.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.progress = true
+		}
+		if err == nil || err == io.EOF || r.ctx.Err() != nil {
+			return n, err
+		}
+
+		log.Printf("Error: Reading %v at %d: %v", r.u, r.offset, err)
+		if c, ok := r.r.(io.Closer); ok {
+			c.Close()
+		}
+		if r.progress {
+			r.back.Reset()
+			r.progress = false
+		}
+		if err := r.resume(err); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume fetches the file from where reading failed with err.
+func (r *resumeReader) resume(err error) error {
+	for {
+		d := r.back.NextBackOff()
+		if d == backoff.Stop {
+			log.Printf("Error: Too many retries to get file %v", r.u)
+			return err
+		}
+		time.Sleep(d)
+
+		log.Printf("Resuming %v at %d", r.u, r.offset)
+		var next io.Reader
+		next, err = r.rs.FetchRange(withIfRange(r.ctx, r.validator), r.u, r.offset)
+		if err == nil {
+			r.r = next
+			return nil
+		}
+		log.Printf("Error: Getting %v: %v", r.u, err)
+		if errors.Is(err, ErrRangeIgnored) || (r.s.DoRetry != nil && !r.s.DoRetry(r.u, err)) {
+			return err
+		}
+	}
+}
+
+// Close closes the underlying reader, if it is an io.Closer.
+func (r *resumeReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/u-root/uio/uio"
+)
+
+// dropWriter aborts the response after limit bytes.
+type dropWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *dropWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		w.ResponseWriter.Write(b[:w.limit])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// flakyServer serves content, but drops the connections of the first
+// drops requests after chunk bytes. If ranges is false, it ignores Range
+// requests.
+func flakyServer(t *testing.T, content []byte, chunk int, ranges bool, drops int) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		if drops--; drops >= 0 {
+			w = &dropWriter{ResponseWriter: w, limit: chunk}
+		}
+		http.ServeContent(w, r, "", time.Unix(1e9, 0), bytes.NewReader(content))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestResumeChanged(t *testing.T) {
+	content := make([]byte, 256<<10)
+	rand.Read(content)
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The file changes after the first, dropped, response.
+		requests++
+		w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, min(requests, 2)))
+		if requests == 1 {
+			w = &dropWriter{ResponseWriter: w, limit: 40000}
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content[requests-1:]))
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SchemeWithRetries{
+		Scheme:  NewHTTPClient(ts.Client()),
+		BackOff: backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3),
+	}
+	r, err := s.FetchRange(context.Background(), u, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrRangeIgnored) {
+		t.Errorf("ReadAll() = %v, want %v", err, ErrRangeIgnored)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestFetchRangeWithoutValidator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("the whole file"))
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHTTPClient(ts.Client()).FetchRange(context.Background(), u, 4); !errors.Is(err, ErrRangeIgnored) {
+		t.Errorf("FetchRange = %v, want %v", err, ErrRangeIgnored)
+	}
+}
+
+func TestResume(t *testing.T) {
+	content := make([]byte, 256<<10)
+	rand.Read(content)
+	for _, tt := range []struct {
+		name   string
+		chunk  int
+		ranges bool
+		drops  int
+		offset int64
+		err    error
+	}{
+		{name: "resume", chunk: 40000, ranges: true, drops: 100},
+		{name: "no ranges", chunk: 40000, drops: 1},
+		{name: "offset", chunk: 40000, ranges: true, drops: 100, offset: 100000},
+		{name: "stalled", ranges: true, drops: 100, err: io.ErrUnexpectedEOF},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := flakyServer(t, content, tt.chunk, tt.ranges, tt.drops)
+			u, err := url.Parse(ts.URL + "/file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &SchemeWithRetries{
+				Scheme:  NewHTTPClient(ts.Client()),
+				BackOff: backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3),
+			}
+			r, err := s.FetchRange(context.Background(), u, tt.offset)
+			if err != nil {
+				t.Fatalf("FetchRange(%s, %d) = %v", u, tt.offset, err)
+			}
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ReadAll() = %v, want %v", err, tt.err)
+			}
+			if err == nil && !bytes.Equal(got, content[tt.offset:]) {
+				t.Errorf("ReadAll() = %d bytes, want %d bytes of content", len(got), len(content[tt.offset:]))
+			}
+		})
+	}
+}
+
+func TestResumeFetch(t *testing.T) {
+	content := make([]byte, 256<<10)
+	rand.Read(content)
+	ts := flakyServer(t, content, 40000, true, 100)
+	u, err := url.Parse(ts.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := make(Schemes)
+	s.Register("http", &SchemeWithRetries{
+		Scheme:  NewHTTPClient(ts.Client()),
+		BackOff: backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3),
+	})
+	f, err := s.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch(%s) = %v", u, err)
+	}
+	got, err := io.ReadAll(uio.Reader(f))
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Fetch(%s) = %d bytes, want %d bytes of content", u, len(got), len(content))
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); ok && u == "user" && p == "pass" {
+			io.WriteString(w, "basic")
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer token" {
+			io.WriteString(w, "bearer")
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts []HTTPClientOpt
+		want string
+		code int
+	}{
+		{name: "none", code: http.StatusUnauthorized},
+		{name: "basic", opts: []HTTPClientOpt{WithBasicAuth("user", "pass")}, want: "basic"},
+		{name: "wrong password", opts: []HTTPClientOpt{WithBasicAuth("user", "secret")}, code: http.StatusUnauthorized},
+		{name: "bearer", opts: []HTTPClientOpt{WithBearerToken("token")}, want: "bearer"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewHTTPClient(ts.Client(), tt.opts...).FetchWithoutCache(context.Background(), u)
+			var cerr *HTTPClientCodeError
+			if tt.code != 0 {
+				if !errors.As(err, &cerr) || cerr.HTTPCode != tt.code {
+					t.Fatalf("FetchWithoutCache() = %v, want code %d", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchWithoutCache() = %v", err)
+			}
+			if got, _ := io.ReadAll(r); string(got) != tt.want {
+				t.Errorf("FetchWithoutCache() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	var got string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.String()
+		io.WriteString(w, "proxied")
+	}))
+	defer proxy.Close()
+	pu, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &url.URL{Scheme: "http", Host: "boot.example.com", Path: "/kernel"}
+	c := NewHTTPClient(&http.Client{Transport: NewHTTPTransport(pu, nil)})
+	r, err := c.FetchWithoutCache(context.Background(), u)
+	if err != nil {
+		t.Fatalf("FetchWithoutCache(%s) = %v", u, err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "proxied" {
+		t.Errorf("FetchWithoutCache(%s) = %q, want %q", u, b, "proxied")
+	}
+	if got != u.String() {
+		t.Errorf("proxy got request for %q, want %q", got, u)
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its key to
+// dir.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "mtls")
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	ts.TLS.ClientCAs.AddCert(clientCert)
+	ts.StartTLS()
+	defer ts.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name             string
+		ca, cert, key    string
+		wantLoad, wantOK bool
+	}{
+		{name: "mtls", ca: caFile, cert: certFile, key: keyFile, wantLoad: true, wantOK: true},
+		{name: "no client cert", ca: caFile, wantLoad: true},
+		{name: "system roots", cert: certFile, key: keyFile, wantLoad: true},
+		{name: "no CA", ca: empty},
+		{name: "no key", ca: caFile, cert: certFile},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := LoadTLSConfig(tt.ca, tt.cert, tt.key)
+			if (err == nil) != tt.wantLoad {
+				t.Fatalf("LoadTLSConfig() = %v, want error %t", err, !tt.wantLoad)
+			}
+			if err != nil {
+				return
+			}
+			h := NewHTTPClient(&http.Client{Transport: NewHTTPTransport(nil, c)})
+			r, err := h.FetchWithoutCache(context.Background(), u)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("FetchWithoutCache() = %v, want error %t", err, !tt.wantOK)
+			}
+			if err != nil {
+				return
+			}
+			if b, _ := io.ReadAll(r); string(b) != "mtls" {
+				t.Errorf("FetchWithoutCache() = %q, want %q", b, "mtls")
+			}
+		})
+	}
+}
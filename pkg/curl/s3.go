@@ -0,0 +1,234 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/u-root/uio/uio"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	// emptySHA256 is the SHA-256 of the empty payload of GET and HEAD.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Client implements FileScheme for objects of S3-compatible stores, with
+// URLs like s3://bucket/key. Requests are signed with AWS Signature
+// Version 4, or anonymous without credentials.
+type S3Client struct {
+	c *http.Client
+
+	// Endpoint is the URL of the store, like http://minio:9000. If empty,
+	// it is that of AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, or else AWS
+	// S3 in Region.
+	Endpoint string
+	// Region is the region to sign requests for. If empty, it is that of
+	// AWS_REGION or AWS_DEFAULT_REGION, or else us-east-1.
+	Region string
+	// The credentials are those of AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN if AccessKeyID is
+	// empty.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	now func() time.Time
+}
+
+// NewS3Client returns a new S3 FileScheme based on the given http.Client.
+func NewS3Client(c *http.Client) *S3Client {
+	return &S3Client{c: c, now: time.Now}
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// awsURIEncode encodes s as SigV4 wants, escaping all but the unreserved
+// characters and, if path, slashes.
+func awsURIEncode(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', path && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// signV4 signs req for service in region at t, as in
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+func signV4(req *http.Request, service, region, accessKeyID, secretAccessKey, sessionToken string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(sigV4TimeFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "range" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	var query []string
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			query = append(query, awsURIEncode(k, false)+"="+awsURIEncode(v, false))
+		}
+	}
+	sort.Strings(query)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(query, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, accessKeyID, scope, signedHeaders, signature))
+}
+
+// do sends a signed request for the object of u, from offset on.
+func (s *S3Client) do(ctx context.Context, method string, u *url.URL, offset int64) (*http.Response, error) {
+	region := s.Region
+	if region == "" {
+		region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	accessKeyID, secretAccessKey, sessionToken := s.AccessKeyID, s.SecretAccessKey, s.SessionToken
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	// Path-style requests, which S3-compatible stores all support.
+	p := "/" + u.Host + "/" + strings.TrimPrefix(u.Path, "/")
+	ou, err := url.Parse(strings.TrimSuffix(endpoint, "/") + awsURIEncode(p, true))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, ou.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	setRange(ctx, req, offset)
+	if accessKeyID != "" {
+		now := s.now
+		if now == nil {
+			now = time.Now
+		}
+		signV4(req, "s3", region, accessKeyID, secretAccessKey, sessionToken, now())
+	}
+	return s.c.Do(req)
+}
+
+// Fetch implements FileScheme.Fetch for S3.
+func (s *S3Client) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	r, err := s.FetchRange(ctx, u, 0)
+	if err != nil {
+		return nil, err
+	}
+	return uio.NewCachingReader(r), nil
+}
+
+// FetchWithoutCache implements FileScheme.FetchWithoutCache for S3.
+func (s *S3Client) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
+	return s.FetchRange(ctx, u, 0)
+}
+
+// FetchRange implements RangeScheme.FetchRange for S3.
+func (s *S3Client) FetchRange(ctx context.Context, u *url.URL, offset int64) (io.Reader, error) {
+	resp, err := s.do(ctx, "GET", u, offset)
+	if err != nil {
+		return nil, err
+	}
+	return httpBody(resp, offset, ifRange(ctx))
+}
+
+// Size implements FileScheme.Size for S3.
+func (s *S3Client) Size(ctx context.Context, u *url.URL) (int64, error) {
+	resp, err := s.do(ctx, "HEAD", u, 0)
+	if err != nil {
+		return -1, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return -1, &HTTPClientCodeError{ErrStatusNotOk, resp.StatusCode}
+	}
+	return resp.ContentLength, nil
+}
@@ -4,11 +4,13 @@
 
 // Package curl implements routines to fetch files given a URL.
 //
-// curl currently supports HTTP, TFTP, and local files.
+// curl currently supports HTTP, TFTP, NFSv3, 9P2000.L, S3, and local files.
 package curl
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +36,14 @@ var ErrNoSuchScheme = errors.New("no such scheme")
 // ErrStatusNotOk is a error represents http codes other than 200.
 var ErrStatusNotOk = errors.New("not status 200")
 
+// ErrBadContentRange is returned when an HTTP server sends another range
+// than the one requested.
+var ErrBadContentRange = errors.New("bad Content-Range")
+
+// ErrNoCerts is returned by LoadTLSConfig if the CA file has no
+// certificates.
+var ErrNoCerts = errors.New("no certificates found")
+
 // File is a reference to a file fetched through this library.
 type File interface {
 	fmt.Stringer
@@ -83,6 +93,9 @@ var (
 		"tftp": DefaultTFTPClient,
 		"http": DefaultHTTPClient,
 		"file": &LocalFileClient{},
+		"nfs":  &NFSClient{},
+		"9p":   &NinePClient{},
+		"s3":   NewS3Client(http.DefaultClient),
 	}
 )
 
@@ -366,8 +379,9 @@ type SchemeWithRetries struct {
 	BackOff backoff.BackOff
 }
 
-// Fetch implements FileScheme.Fetch for retry wrapper.
-func (s *SchemeWithRetries) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+// retry calls fetch until it succeeds, DoRetry rejects its error, or
+// BackOff stops.
+func (s *SchemeWithRetries) retry(ctx context.Context, u *url.URL, fetch func() error) error {
 	var err error
 	s.BackOff.Reset()
 	back := backoff.WithContext(s.BackOff, ctx)
@@ -376,50 +390,111 @@ func (s *SchemeWithRetries) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt,
 			time.Sleep(d)
 		}
 
-		var r io.ReaderAt
 		// Note: err uses the scope outside the for loop.
-		r, err = s.Scheme.Fetch(ctx, u)
+		err = fetch()
 		if err == nil {
-			return r, nil
+			return nil
 		}
 
 		log.Printf("Error: Getting %v: %v", u, err)
-		if s.DoRetry != nil && !s.DoRetry(u, err) {
-			return r, err
+		// Asking again gets the whole file again.
+		if errors.Is(err, ErrRangeIgnored) || (s.DoRetry != nil && !s.DoRetry(u, err)) {
+			return err
 		}
 		log.Printf("Retrying %v", u)
 	}
 
 	log.Printf("Error: Too many retries to get file %v", u)
-	return nil, err
+	return err
+}
+
+// Fetch implements FileScheme.Fetch for retry wrapper.
+//
+// If Scheme is a RangeScheme, reads that fail midway resume where they
+// stopped.
+func (s *SchemeWithRetries) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	if _, ok := s.Scheme.(RangeScheme); ok {
+		r, err := s.FetchRange(ctx, u, 0)
+		if err != nil {
+			return nil, err
+		}
+		return uio.NewCachingReader(r), nil
+	}
+
+	var r io.ReaderAt
+	err := s.retry(ctx, u, func() (err error) {
+		r, err = s.Scheme.Fetch(ctx, u)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // FetchWithoutCache implements FileScheme.FetchWithoutCache for retry wrapper.
+//
+// If Scheme is a RangeScheme, reads that fail midway resume where they
+// stopped.
 func (s *SchemeWithRetries) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
-	var err error
-	s.BackOff.Reset()
-	back := backoff.WithContext(s.BackOff, ctx)
-	for d := time.Duration(0); d != backoff.Stop; d = back.NextBackOff() {
-		if d > 0 {
-			time.Sleep(d)
-		}
+	if _, ok := s.Scheme.(RangeScheme); ok {
+		return s.FetchRange(ctx, u, 0)
+	}
 
-		var r io.Reader
-		// Note: err uses the scope outside the for loop.
+	var r io.Reader
+	err := s.retry(ctx, u, func() (err error) {
 		r, err = s.Scheme.FetchWithoutCache(ctx, u)
-		if err == nil {
-			return r, nil
-		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-		log.Printf("Error: Getting %v: %v", u, err)
-		if s.DoRetry != nil && !s.DoRetry(u, err) {
-			return r, err
-		}
-		log.Printf("Retrying %v", u)
+// FetchRange implements RangeScheme.FetchRange for retry wrapper. Reads
+// that fail midway resume where they stopped.
+//
+// If Scheme is not a RangeScheme, ErrRangeNotSupported is returned.
+func (s *SchemeWithRetries) FetchRange(ctx context.Context, u *url.URL, offset int64) (io.Reader, error) {
+	rs, ok := s.Scheme.(RangeScheme)
+	if !ok {
+		return nil, ErrRangeNotSupported
+	}
+	var r io.Reader
+	err := s.retry(ctx, u, func() (err error) {
+		r, err = rs.FetchRange(ctx, u, offset)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	rr := &resumeReader{
+		ctx:    ctx,
+		s:      s,
+		rs:     rs,
+		u:      u,
+		r:      r,
+		offset: offset,
+		back:   backoff.WithContext(s.BackOff, ctx),
+	}
+	if f, ok := r.(*httpFile); ok {
+		rr.validator = f.validator
 	}
+	return rr, nil
+}
 
-	log.Printf("Error: Too many retries to get file %v", u)
-	return nil, err
+// Size implements FileScheme.Size for retry wrapper.
+func (s *SchemeWithRetries) Size(ctx context.Context, u *url.URL) (int64, error) {
+	var sz int64
+	err := s.retry(ctx, u, func() (err error) {
+		sz, err = s.Scheme.Size(ctx, u)
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+	return sz, nil
 }
 
 // HTTPClientCodeError is returned by HTTPClient.Fetch when the server replies
@@ -442,40 +517,176 @@ func (h *HTTPClientCodeError) Unwrap() error {
 // HTTPClient implements FileScheme for HTTP files.
 type HTTPClient struct {
 	c *http.Client
+
+	// user and password are for basic authentication, token for bearer
+	// authentication.
+	user     string
+	password string
+	token    string
+}
+
+// HTTPClientOpt is an option of NewHTTPClient.
+type HTTPClientOpt func(*HTTPClient)
+
+// WithBasicAuth authenticates requests with user and password.
+func WithBasicAuth(user, password string) HTTPClientOpt {
+	return func(h *HTTPClient) {
+		h.user, h.password = user, password
+	}
+}
+
+// WithBearerToken authenticates requests with the bearer token.
+func WithBearerToken(token string) HTTPClientOpt {
+	return func(h *HTTPClient) {
+		h.token = token
+	}
 }
 
 // NewHTTPClient returns a new HTTP FileScheme based on the given http.Client.
-func NewHTTPClient(c *http.Client) *HTTPClient {
-	return &HTTPClient{
+func NewHTTPClient(c *http.Client, opts ...HTTPClientOpt) *HTTPClient {
+	h := &HTTPClient{
 		c: c,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-func httpFetch(ctx context.Context, c *http.Client, u *url.URL) (io.Reader, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+// NewHTTPTransport returns an http.Transport with tlsConfig, which may be
+// nil, that connects through proxy, or the proxy that HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY name if proxy is nil.
+func NewHTTPTransport(proxy *url.URL, tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if proxy != nil {
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	t.TLSClientConfig = tlsConfig
+	return t
+}
+
+// LoadTLSConfig returns a TLS configuration that trusts the CA
+// certificates of the PEM file caFile instead of the system's, and
+// presents the client certificate of certFile and keyFile for mutual TLS.
+// Either may be empty.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	c := &tls.Config{}
+	if caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%w: %s", ErrNoCerts, caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+func (h HTTPClient) do(ctx context.Context, method string, u *url.URL, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.Do(req)
+	if h.user != "" || h.password != "" {
+		req.SetBasicAuth(h.user, h.password)
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	setRange(ctx, req, offset)
+	return h.c.Do(req)
+}
+
+// setRange asks for the file from offset on, if the file is still the
+// version of the withIfRange validator of ctx.
+func setRange(ctx context.Context, req *http.Request, offset int64) {
+	if offset <= 0 {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if v := ifRange(ctx); v != "" {
+		req.Header.Set("If-Range", v)
+	}
+}
+
+func httpFetch(ctx context.Context, h HTTPClient, u *url.URL, offset int64) (io.Reader, error) {
+	resp, err := h.do(ctx, "GET", u, offset)
 	if err != nil {
 		return nil, err
 	}
+	return httpBody(resp, offset, ifRange(ctx))
+}
 
-	if resp.StatusCode != 200 {
-		return nil, &HTTPClientCodeError{ErrStatusNotOk, resp.StatusCode}
+// httpFile is the body of a response, and the validator of the version of
+// the file it is.
+type httpFile struct {
+	io.ReadCloser
+	validator string
+}
+
+// validator returns the strong ETag of resp, or else its Last-Modified
+// date, for If-Range.
+func validator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
 	}
-	return resp.Body, nil
+	return resp.Header.Get("Last-Modified")
 }
 
-func httpSize(ctx context.Context, c *http.Client, u *url.URL) (int64, error) {
-	req, err := http.NewRequestWithContext(ctx, "HEAD", u.String(), nil)
-	if err != nil {
-		return -1, err
+// httpBody returns the body of the response to a GET from offset on, which
+// was conditional on the validator sent, if any.
+func httpBody(resp *http.Response, offset int64, sent string) (io.Reader, error) {
+	v := validator(resp)
+	switch {
+	case resp.StatusCode == 200:
+		if offset > 0 {
+			// Skip to the range if the server just does not do
+			// ranges, but start over if the file may have changed.
+			if sent == "" || v != sent {
+				resp.Body.Close()
+				return nil, ErrRangeIgnored
+			}
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+	case resp.StatusCode == 206 && offset > 0:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: %q", ErrBadContentRange, resp.Header.Get("Content-Range"))
+		}
+		if sent != "" && v != "" && v != sent {
+			resp.Body.Close()
+			return nil, ErrRangeIgnored
+		}
+	default:
+		resp.Body.Close()
+		return nil, &HTTPClientCodeError{ErrStatusNotOk, resp.StatusCode}
+	}
+	if v == "" {
+		v = sent
 	}
-	resp, err := c.Do(req)
+	return &httpFile{ReadCloser: resp.Body, validator: v}, nil
+}
+
+func httpSize(ctx context.Context, h HTTPClient, u *url.URL) (int64, error) {
+	resp, err := h.do(ctx, "HEAD", u, 0)
 	if err != nil {
 		return -1, err
 	}
+	resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		return -1, &HTTPClientCodeError{ErrStatusNotOk, resp.StatusCode}
@@ -485,7 +696,7 @@ func httpSize(ctx context.Context, c *http.Client, u *url.URL) (int64, error) {
 
 // Fetch implements FileScheme.Fetch for HTTP.
 func (h HTTPClient) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
-	r, err := httpFetch(ctx, h.c, u)
+	r, err := httpFetch(ctx, h, u, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -494,12 +705,18 @@ func (h HTTPClient) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error)
 
 // FetchWithoutCache implements FileScheme.FetchWithoutCache for HTTP.
 func (h HTTPClient) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
-	return httpFetch(ctx, h.c, u)
+	return httpFetch(ctx, h, u, 0)
+}
+
+// FetchRange implements RangeScheme.FetchRange for HTTP with a Range
+// request.
+func (h HTTPClient) FetchRange(ctx context.Context, u *url.URL, offset int64) (io.Reader, error) {
+	return httpFetch(ctx, h, u, offset)
 }
 
 // Size implements FileScheme.Size for HTTP.
 func (h HTTPClient) Size(ctx context.Context, u *url.URL) (int64, error) {
-	sz, err := httpSize(ctx, h.c, u)
+	sz, err := httpSize(ctx, h, u)
 	if err != nil {
 		return -1, err
 	}
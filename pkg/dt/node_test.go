@@ -464,3 +464,29 @@ func TestAsRegion(t *testing.T) {
 		})
 	}
 }
+
+func TestAsStringList(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		value   []byte
+		want    []string
+		wantErr bool
+	}{
+		{name: "one", value: []byte("a\x00"), want: []string{"a"}},
+		{name: "two", value: []byte("kernel-1\x00fdt-1\x00"), want: []string{"kernel-1", "fdt-1"}},
+		{name: "empty string", value: []byte("\x00"), want: []string{""}},
+		{name: "no null", value: []byte("a"), wantErr: true},
+		{name: "empty", value: []byte{}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Property{Name: "p", Value: tc.value}
+			got, err := p.AsStringList()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("AsStringList() = %v, want error %t", err, tc.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("AsStringList() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -168,7 +168,9 @@ func (v *EFIVarFS) Set(desc VariableDescriptor, attrs VariableAttributes, data [
 // Remove makes the specified EFI var mutable and then deletes it
 func (v *EFIVarFS) Remove(desc VariableDescriptor) error {
 	path := filepath.Join(v.path, fmt.Sprintf("%s-%s", desc.Name, desc.GUID.String()))
-	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	// Open read-only: an immutable file cannot be opened for writing
+	// before makeMutable.
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
 	switch {
 	case os.IsNotExist(err):
 		return ErrVarNotExist
@@ -176,18 +178,22 @@ func (v *EFIVarFS) Remove(desc VariableDescriptor) error {
 		return ErrVarPermission
 	case err != nil:
 		return err
-	default:
-		_, err := makeMutable(f)
-		switch {
-		case os.IsPermission(err):
-			return ErrVarPermission
-		case err != nil:
-			return err
-		default:
-			f.Close()
-		}
 	}
-	return os.Remove(path)
+	defer f.Close()
+
+	restoreImmutable, err := makeMutable(f)
+	switch {
+	case os.IsPermission(err):
+		return ErrVarPermission
+	case err != nil:
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		// Don't leave a variable the kernel protects mutable.
+		restoreImmutable()
+		return err
+	}
+	return nil
 }
 
 // List returns the VariableDescriptor for each efivar in the system
@@ -511,3 +511,47 @@ func TestNew(t *testing.T) {
 	e, err := New()
 	t.Logf("New(): %v, %v", e, err)
 }
+
+func TestImmutableVar(t *testing.T) {
+	tmp := t.TempDir()
+	e := &EFIVarFS{path: tmp}
+	vd := VariableDescriptor{
+		Name: "TestVar",
+		GUID: guid.MustParse("bc54d3fb-ed45-462d-9df8-b9f736228350"),
+	}
+	if err := e.Set(vd, AttributeNonVolatile, []byte{1}); err != nil {
+		t.Fatalf("Set() = %v, want nil", err)
+	}
+	f, err := os.Open(filepath.Join(tmp, "TestVar-bc54d3fb-ed45-462d-9df8-b9f736228350"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	flags, err := getInodeFlags(f)
+	if err != nil {
+		t.Skipf("Cannot getInodeFlags: %v", err)
+	}
+	if err := setInodeFlags(f, flags|FS_IMMUTABLE_FL); err != nil {
+		t.Skipf("Unable to set immutable flag: %v", err)
+	}
+	// Let t.TempDir clean up if the test fails.
+	t.Cleanup(func() { _ = setInodeFlags(f, flags) })
+
+	// Set restores the immutable flag after writing.
+	if err := e.Set(vd, AttributeNonVolatile, []byte{2}); err != nil {
+		t.Fatalf("Set() on immutable var = %v, want nil", err)
+	}
+	if _, data, err := e.Get(vd); err != nil || !bytes.Equal(data, []byte{2}) {
+		t.Errorf("Get() = %v, %v, want [2], nil", data, err)
+	}
+	if got, err := getInodeFlags(f); err != nil || got&FS_IMMUTABLE_FL == 0 {
+		t.Errorf("immutable flag not restored after Set(): %#x, %v", got, err)
+	}
+
+	if err := e.Remove(vd); err != nil {
+		t.Fatalf("Remove() on immutable var = %v, want nil", err)
+	}
+	if _, _, err := e.Get(vd); !errors.Is(err, ErrVarNotExist) {
+		t.Errorf("Get() after Remove() = %v, want %v", err, ErrVarNotExist)
+	}
+}
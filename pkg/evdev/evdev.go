@@ -0,0 +1,109 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package evdev reads Linux input events, e.g. from /dev/input/event0, and
+// translates keyboard events to keys.
+package evdev
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Event types from linux/input-event-codes.h.
+const (
+	EvSyn = 0x00
+	EvKey = 0x01
+)
+
+// Values of EvKey events.
+const (
+	KeyReleased = 0
+	KeyPressed  = 1
+	KeyRepeated = 2
+)
+
+// Event is struct input_event from linux/input.h.
+type Event struct {
+	Time  unix.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// ReadEvent reads one event from r.
+func ReadEvent(r io.Reader) (*Event, error) {
+	var e Event
+	if err := binary.Read(r, binary.NativeEndian, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// devicesFile lists the input devices, and can be overridden for testing.
+var devicesFile = "/proc/bus/input/devices"
+
+// Keyboards returns the event devices of all keyboards, e.g.
+// /dev/input/event0.
+func Keyboards() ([]string, error) {
+	f, err := os.Open(devicesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Devices are separated by blank lines. Keyboards have the kbd
+	// handler, which is also used by power buttons and the like, so also
+	// look for letter keys in the key bitmap.
+	var kbds []string
+	var handlers []string
+	var letters bool
+	s := bufio.NewScanner(f)
+	for {
+		more := s.Scan()
+		line := s.Text()
+		if !more || line == "" {
+			if letters && slices.Contains(handlers, "kbd") {
+				for _, h := range handlers {
+					if strings.HasPrefix(h, "event") {
+						kbds = append(kbds, filepath.Join("/dev/input", h))
+					}
+				}
+			}
+			handlers, letters = nil, false
+			if !more {
+				break
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "H: Handlers="):
+			handlers = strings.Fields(strings.TrimPrefix(line, "H: Handlers="))
+		case strings.HasPrefix(line, "B: KEY="):
+			letters = hasKey(strings.Fields(strings.TrimPrefix(line, "B: KEY=")), KeyA)
+		}
+	}
+	return kbds, s.Err()
+}
+
+// hasKey checks the bitmap of keys of a device, as printed in
+// /proc/bus/input/devices: hex words of the kernel's long size, most
+// significant first.
+func hasKey(words []string, code uint16) bool {
+	i := len(words) - 1 - int(code)/bits.UintSize
+	if i < 0 {
+		return false
+	}
+	w, err := strconv.ParseUint(words[i], 16, bits.UintSize)
+	return err == nil && w&(1<<(uint(code)%bits.UintSize)) != 0
+}
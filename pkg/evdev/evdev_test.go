@@ -0,0 +1,138 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evdev
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const devices = `I: Bus=0019 Vendor=0000 Product=0001 Version=0000
+N: Name="Power Button"
+P: Phys=PNP0C0C/button/input0
+S: Sysfs=/devices/LNXSYSTM:00/LNXSYBUS:00/PNP0C0C:00/input/input0
+U: Uniq=
+H: Handlers=kbd event0 
+B: PROP=0
+B: EV=3
+B: KEY=10000000000000 0
+
+I: Bus=0011 Vendor=0001 Product=0001 Version=ab41
+N: Name="AT Translated Set 2 keyboard"
+P: Phys=isa0060/serio0/input0
+S: Sysfs=/devices/platform/i8042/serio0/input/input1
+U: Uniq=
+H: Handlers=sysrq kbd event1 leds 
+B: PROP=0
+B: EV=120013
+B: KEY=402000000 3803078f800d001 feffffdfffefffff fffffffffffffffe
+B: MSC=10
+B: LED=7
+
+I: Bus=0011 Vendor=0002 Product=0006 Version=0000
+N: Name="ImExPS/2 Generic Explorer Mouse"
+H: Handlers=mouse0 event2 
+B: PROP=1
+B: EV=7
+B: KEY=1f0000 0 0 0 0
+
+I: Bus=0003 Vendor=046d Product=c31c Version=0110
+N: Name="Logitech USB Keyboard"
+H: Handlers=sysrq kbd leds event3 
+B: EV=120013
+B: KEY=1000000000007 ff9f207ac14057ff febeffdfffefffff fffffffffffffffe
+`
+
+func TestKeyboards(t *testing.T) {
+	if bits.UintSize != 64 {
+		t.Skip("test data is from a 64-bit kernel")
+	}
+	devicesFile = filepath.Join(t.TempDir(), "devices")
+	if err := os.WriteFile(devicesFile, []byte(devices), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Keyboards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/dev/input/event1", "/dev/input/event3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keyboards() = %v, want %v", got, want)
+	}
+
+	devicesFile = filepath.Join(t.TempDir(), "nonexistent")
+	if _, err := Keyboards(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Keyboards() = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func events(t *testing.T, evs ...Event) io.Reader {
+	t.Helper()
+	var b bytes.Buffer
+	for _, e := range evs {
+		if err := binary.Write(&b, binary.NativeEndian, e); err != nil {
+			t.Fatal(err)
+		}
+		// Every key event is followed by a sync event.
+		if err := binary.Write(&b, binary.NativeEndian, Event{Type: EvSyn}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &b
+}
+
+func press(code uint16) Event   { return Event{Type: EvKey, Code: code, Value: KeyPressed} }
+func release(code uint16) Event { return Event{Type: EvKey, Code: code, Value: KeyReleased} }
+func repeat(code uint16) Event  { return Event{Type: EvKey, Code: code, Value: KeyRepeated} }
+
+func TestReadKeys(t *testing.T) {
+	const keyC = 46
+	r := events(t,
+		press(KeyA), release(KeyA),
+		press(KeyLeftShift), press(KeyA), release(KeyA), press(2), release(KeyLeftShift),
+		press(KeyCapsLock), release(KeyCapsLock), press(KeyA), press(2),
+		press(KeyRightShift), press(KeyA), release(KeyRightShift),
+		press(KeyCapsLock), release(KeyCapsLock),
+		press(KeyRightCtrl), press(keyC), release(KeyRightCtrl),
+		press(KeyUp), repeat(KeyUp), press(KeyKPEnter),
+	)
+	keys := make(chan Key, 100)
+	if err := ReadKeys(r, keys); err != io.EOF {
+		t.Errorf("ReadKeys = %v, want %v", err, io.EOF)
+	}
+	close(keys)
+	var got []Key
+	for k := range keys {
+		got = append(got, k)
+	}
+	want := []Key{
+		{Code: KeyA, Rune: 'a'},
+		{Code: KeyA, Rune: 'A'},
+		{Code: 2, Rune: '!'},
+		{Code: KeyA, Rune: 'A'},
+		{Code: 2, Rune: '1'},
+		{Code: KeyA, Rune: 'a'},
+		{Code: keyC, Rune: 'c', Ctrl: true},
+		{Code: KeyUp},
+		{Code: KeyUp},
+		{Code: KeyEnter},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadKeys =\n%+v, want\n%+v", got, want)
+	}
+}
+
+func TestReadEventShort(t *testing.T) {
+	if _, err := ReadEvent(bytes.NewReader([]byte{1, 2, 3})); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadEvent = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evdev
+
+import (
+	"io"
+	"unicode"
+)
+
+// Key codes from linux/input-event-codes.h.
+const (
+	KeyEsc        = 1
+	KeyBackspace  = 14
+	KeyTab        = 15
+	KeyEnter      = 28
+	KeyLeftCtrl   = 29
+	KeyA          = 30
+	KeyLeftShift  = 42
+	KeyRightShift = 54
+	KeyCapsLock   = 58
+	KeyKPEnter    = 96
+	KeyRightCtrl  = 97
+	KeyHome       = 102
+	KeyUp         = 103
+	KeyPageUp     = 104
+	KeyLeft       = 105
+	KeyRight      = 106
+	KeyEnd        = 107
+	KeyDown       = 108
+	KeyPageDown   = 109
+	KeyDelete     = 111
+)
+
+// usLayout maps key codes to the characters they type, unshifted and
+// shifted, on a US keyboard.
+var usLayout = map[uint16][2]rune{
+	2: {'1', '!'}, 3: {'2', '@'}, 4: {'3', '#'}, 5: {'4', '$'}, 6: {'5', '%'},
+	7: {'6', '^'}, 8: {'7', '&'}, 9: {'8', '*'}, 10: {'9', '('}, 11: {'0', ')'},
+	12: {'-', '_'}, 13: {'=', '+'},
+	16: {'q', 'Q'}, 17: {'w', 'W'}, 18: {'e', 'E'}, 19: {'r', 'R'}, 20: {'t', 'T'},
+	21: {'y', 'Y'}, 22: {'u', 'U'}, 23: {'i', 'I'}, 24: {'o', 'O'}, 25: {'p', 'P'},
+	26: {'[', '{'}, 27: {']', '}'},
+	30: {'a', 'A'}, 31: {'s', 'S'}, 32: {'d', 'D'}, 33: {'f', 'F'}, 34: {'g', 'G'},
+	35: {'h', 'H'}, 36: {'j', 'J'}, 37: {'k', 'K'}, 38: {'l', 'L'},
+	39: {';', ':'}, 40: {'\'', '"'}, 41: {'`', '~'}, 43: {'\\', '|'},
+	44: {'z', 'Z'}, 45: {'x', 'X'}, 46: {'c', 'C'}, 47: {'v', 'V'}, 48: {'b', 'B'},
+	49: {'n', 'N'}, 50: {'m', 'M'}, 51: {',', '<'}, 52: {'.', '>'}, 53: {'/', '?'},
+	57: {' ', ' '},
+}
+
+// Key is a key press.
+type Key struct {
+	Code uint16
+
+	// Rune is the character typed, or 0 for keys such as arrows.
+	Rune rune
+
+	// Ctrl is set if a control key was held.
+	Ctrl bool
+}
+
+// Keyboard translates the events of a keyboard to key presses, tracking the
+// state of modifiers. It assumes a US layout.
+type Keyboard struct {
+	leftShift, rightShift bool
+	leftCtrl, rightCtrl   bool
+	capsLock              bool
+}
+
+// Translate returns the key pressed by e, if any. Repeats of a held key are
+// presses too.
+func (k *Keyboard) Translate(e *Event) (Key, bool) {
+	if e.Type != EvKey {
+		return Key{}, false
+	}
+	down := e.Value != KeyReleased
+	switch e.Code {
+	case KeyLeftShift:
+		k.leftShift = down
+		return Key{}, false
+	case KeyRightShift:
+		k.rightShift = down
+		return Key{}, false
+	case KeyLeftCtrl:
+		k.leftCtrl = down
+		return Key{}, false
+	case KeyRightCtrl:
+		k.rightCtrl = down
+		return Key{}, false
+	case KeyCapsLock:
+		if e.Value == KeyPressed {
+			k.capsLock = !k.capsLock
+		}
+		return Key{}, false
+	}
+	if !down {
+		return Key{}, false
+	}
+
+	key := Key{Code: e.Code, Ctrl: k.leftCtrl || k.rightCtrl}
+	if e.Code == KeyKPEnter {
+		key.Code = KeyEnter
+	}
+	if r, ok := usLayout[e.Code]; ok {
+		shift := k.leftShift || k.rightShift
+		if k.capsLock && unicode.IsLetter(r[0]) {
+			shift = !shift
+		}
+		key.Rune = r[0]
+		if shift {
+			key.Rune = r[1]
+		}
+	}
+	return key, true
+}
+
+// ReadKeys reads events from r, e.g. an open /dev/input/event0, and sends
+// key presses to keys. It returns when reading fails.
+func ReadKeys(r io.Reader, keys chan<- Key) error {
+	var k Keyboard
+	for {
+		e, err := ReadEvent(r)
+		if err != nil {
+			return err
+		}
+		if key, ok := k.Translate(e); ok {
+			keys <- key
+		}
+	}
+}
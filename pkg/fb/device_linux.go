@@ -0,0 +1,122 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+var errUnsupportedFormat = errors.New("unsupported framebuffer pixel format")
+
+// Device is a packed pixel true color framebuffer. Images drawn on it are
+// converted to the pixel format of the device.
+type Device struct {
+	w                io.WriterAt
+	width, height    int
+	lineLength       int
+	bytesPerPixel    int
+	offset           int64
+	red, green, blue Bitfield
+
+	buf []byte
+}
+
+// Open opens a framebuffer device, e.g. /dev/fb0.
+func Open(dev string) (*Device, error) {
+	fix, v, err := GetScreenInfo(dev)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDevice(f, fix, v)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", dev, err)
+	}
+	return d, nil
+}
+
+// NewDevice returns a Device writing to the framebuffer memory w, described
+// by fix and v.
+func NewDevice(w io.WriterAt, fix *FixScreenInfo, v *VarScreenInfo) (*Device, error) {
+	if fix.Type != TypePackedPixels || (fix.Visual != VisualTrueColor && fix.Visual != VisualDirectColor) {
+		return nil, fmt.Errorf("%w: type %d, visual %d", errUnsupportedFormat, fix.Type, fix.Visual)
+	}
+	switch v.BitsPerPixel {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("%w: %d bits per pixel", errUnsupportedFormat, v.BitsPerPixel)
+	}
+	d := &Device{
+		w:             w,
+		width:         int(v.XRes),
+		height:        int(v.YRes),
+		lineLength:    int(fix.LineLength),
+		bytesPerPixel: int(v.BitsPerPixel / 8),
+		red:           v.Red,
+		green:         v.Green,
+		blue:          v.Blue,
+	}
+	if d.lineLength < d.width*d.bytesPerPixel {
+		return nil, fmt.Errorf("%w: line length %d for %d pixels", errUnsupportedFormat, d.lineLength, d.width)
+	}
+	d.offset = int64(v.YOffset)*int64(d.lineLength) + int64(v.XOffset)*int64(d.bytesPerPixel)
+	d.buf = make([]byte, d.height*d.lineLength)
+	return d, nil
+}
+
+// Bounds returns the visible area of the framebuffer.
+func (d *Device) Bounds() image.Rectangle {
+	return image.Rect(0, 0, d.width, d.height)
+}
+
+// channel scales an 8 bit color channel to the bitfield.
+func channel(c uint32, b Bitfield) uint32 {
+	if b.Length >= 8 {
+		return c << (b.Length - 8) << b.Offset
+	}
+	return c >> (8 - b.Length) << b.Offset
+}
+
+// Draw draws img, clipped to Bounds, onto the framebuffer.
+func (d *Device) Draw(img image.Image) error {
+	r := img.Bounds().Intersect(d.Bounds())
+	rgba, _ := img.(*image.RGBA)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		line := d.buf[y*d.lineLength:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			var cr, cg, cb uint32
+			if rgba != nil {
+				// Fast path for what menus and the like draw on.
+				p := rgba.Pix[rgba.PixOffset(x, y):]
+				cr, cg, cb = uint32(p[0]), uint32(p[1]), uint32(p[2])
+			} else {
+				cr, cg, cb, _ = img.At(x, y).RGBA()
+				cr, cg, cb = cr>>8, cg>>8, cb>>8
+			}
+			px := channel(cr, d.red) | channel(cg, d.green) | channel(cb, d.blue)
+			for i := 0; i < d.bytesPerPixel; i++ {
+				line[x*d.bytesPerPixel+i] = byte(px >> (8 * i))
+			}
+		}
+	}
+	_, err := d.w.WriteAt(d.buf, d.offset)
+	return err
+}
+
+// Close closes the framebuffer device.
+func (d *Device) Close() error {
+	if c, ok := d.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// memory is framebuffer memory.
+type memory []byte
+
+func (m memory) WriteAt(p []byte, off int64) (int, error) {
+	return copy(m[off:], p), nil
+}
+
+func TestDevice(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{0xff, 0x80, 0x00, 0xff})
+	img.Set(2, 1, color.RGBA{0x10, 0x20, 0xff, 0xff})
+	// Generic path.
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	gray.Set(1, 0, color.Gray{0xff})
+
+	for _, tt := range []struct {
+		name string
+		fix  FixScreenInfo
+		v    VarScreenInfo
+		img  image.Image
+		want []byte
+		err  error
+	}{
+		{
+			name: "xrgb8888",
+			fix:  FixScreenInfo{Visual: VisualTrueColor, LineLength: 16},
+			v: VarScreenInfo{
+				XRes: 3, YRes: 2, BitsPerPixel: 32,
+				Red: Bitfield{Offset: 16, Length: 8}, Green: Bitfield{Offset: 8, Length: 8}, Blue: Bitfield{Length: 8},
+			},
+			img: img,
+			want: []byte{
+				0x00, 0x80, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0x20, 0x10, 0, 0, 0, 0, 0,
+			},
+		},
+		{
+			name: "rgb565 with y offset",
+			fix:  FixScreenInfo{Visual: VisualTrueColor, LineLength: 6},
+			v: VarScreenInfo{
+				XRes: 3, YRes: 2, YOffset: 1, BitsPerPixel: 16,
+				Red: Bitfield{Offset: 11, Length: 5}, Green: Bitfield{Offset: 5, Length: 6}, Blue: Bitfield{Length: 5},
+			},
+			img: img,
+			want: []byte{
+				0, 0, 0, 0, 0, 0,
+				0x00, 0xfc, 0, 0, 0, 0,
+				0, 0, 0, 0, 0x1f, 0x11,
+			},
+		},
+		{
+			name: "bgr888 gray",
+			fix:  FixScreenInfo{Visual: VisualTrueColor, LineLength: 9},
+			v: VarScreenInfo{
+				XRes: 3, YRes: 2, BitsPerPixel: 24,
+				Red: Bitfield{Offset: 0, Length: 8}, Green: Bitfield{Offset: 8, Length: 8}, Blue: Bitfield{Offset: 16, Length: 8},
+			},
+			img: gray,
+			want: []byte{
+				0, 0, 0, 0xff, 0xff, 0xff, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0,
+			},
+		},
+		{
+			name: "palette",
+			fix:  FixScreenInfo{Visual: 3, LineLength: 3},
+			v:    VarScreenInfo{XRes: 3, YRes: 2, BitsPerPixel: 8},
+			err:  errUnsupportedFormat,
+		},
+		{
+			name: "8 bpp",
+			fix:  FixScreenInfo{Visual: VisualTrueColor, LineLength: 3},
+			v:    VarScreenInfo{XRes: 3, YRes: 2, BitsPerPixel: 8},
+			err:  errUnsupportedFormat,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := make(memory, len(tt.want))
+			d, err := NewDevice(mem, &tt.fix, &tt.v)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("NewDevice = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := d.Bounds(), image.Rect(0, 0, 3, 2); got != want {
+				t.Errorf("Bounds = %v, want %v", got, want)
+			}
+			if err := d.Draw(tt.img); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(mem, tt.want) {
+				t.Errorf("framebuffer = %x, want %x", []byte(mem), tt.want)
+			}
+			if err := d.Close(); err != nil {
+				t.Errorf("Close = %v", err)
+			}
+		})
+	}
+}
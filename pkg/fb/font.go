@@ -0,0 +1,196 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// Size of a character cell of the built-in font, in unscaled pixels. Glyphs
+// are 5x9 pixels, including 2 rows for descenders, and cells leave a column
+// and a row of space.
+const (
+	GlyphWidth  = 6
+	GlyphHeight = 10
+)
+
+const (
+	glyphCols = 5
+	glyphRows = 9
+	firstRune = ' '
+	lastRune  = '~'
+)
+
+// fontArt is the printable ASCII range, ' ' to '~', 8 glyphs per block.
+const fontArt = `
+..... ..#.. .#.#. .#.#. ..#.. ##... .##.. ..#..
+..... ..#.. .#.#. .#.#. .#### ##..# #..#. ..#..
+..... ..#.. .#.#. ##### #.#.. ...#. #.#.. .#...
+..... ..#.. ..... .#.#. .###. ..#.. .#... .....
+..... ..#.. ..... ##### ..#.# .#... #.#.# .....
+..... ..... ..... .#.#. ####. #..## #..#. .....
+..... ..#.. ..... .#.#. ..#.. ...## .##.# .....
+..... ..... ..... ..... ..... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+...#. .#... ..... ..... ..... ..... ..... .....
+..#.. ..#.. ..#.. ..#.. ..... ..... ..... ....#
+.#... ...#. #.#.# ..#.. ..... ..... ..... ...#.
+.#... ...#. .###. ##### ..... ##### ..... ..#..
+.#... ...#. #.#.# ..#.. ..... ..... ..... .#...
+..#.. ..#.. ..#.. ..#.. .##.. ..... .##.. #....
+...#. .#... ..... ..... ..#.. ..... .##.. .....
+..... ..... ..... ..... .#... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+.###. ..#.. .###. ##### ...#. ##### ..##. #####
+#...# .##.. #...# ...#. ..##. #.... .#... ....#
+#..## ..#.. ....# ..#.. .#.#. ####. #.... ...#.
+#.#.# ..#.. ...#. ...#. #..#. ....# ####. ..#..
+##..# ..#.. ..#.. ....# ##### ....# #...# .#...
+#...# ..#.. .#... #...# ...#. #...# #...# .#...
+.###. .###. ##### .###. ...#. .###. .###. .#...
+..... ..... ..... ..... ..... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+.###. .###. ..... ..... ...#. ..... .#... .###.
+#...# #...# .##.. .##.. ..#.. ..... ..#.. #...#
+#...# #...# .##.. .##.. .#... ##### ...#. ....#
+.###. .#### ..... ..... #.... ..... ....# ...#.
+#...# ....# .##.. .##.. .#... ##### ...#. ..#..
+#...# ...#. .##.. ..#.. ..#.. ..... ..#.. .....
+.###. .##.. ..... .#... ...#. ..... .#... ..#..
+..... ..... ..... ..... ..... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+.###. .###. ####. .###. ###.. ##### ##### .###.
+#...# #...# #...# #...# #..#. #.... #.... #...#
+....# #...# #...# #.... #...# #.... #.... #....
+.##.# ##### ####. #.... #...# ####. ####. #.###
+#.#.# #...# #...# #.... #...# #.... #.... #...#
+#.#.# #...# #...# #...# #..#. #.... #.... #...#
+.###. #...# ####. .###. ###.. ##### #.... .####
+..... ..... ..... ..... ..... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+#...# .###. ..### #...# #.... #...# #...# .###.
+#...# ..#.. ...#. #..#. #.... ##.## #...# #...#
+#...# ..#.. ...#. #.#.. #.... #.#.# ##..# #...#
+##### ..#.. ...#. ##... #.... #.#.# #.#.# #...#
+#...# ..#.. ...#. #.#.. #.... #...# #..## #...#
+#...# ..#.. #..#. #..#. #.... #...# #...# #...#
+#...# .###. .##.. #...# ##### #...# #...# .###.
+..... ..... ..... ..... ..... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+####. .###. ####. .#### ##### #...# #...# #...#
+#...# #...# #...# #.... ..#.. #...# #...# #...#
+#...# #...# #...# #.... ..#.. #...# #...# #...#
+####. #...# ####. .###. ..#.. #...# #...# #.#.#
+#.... #.#.# #.#.. ....# ..#.. #...# #...# #.#.#
+#.... #..#. #..#. ....# ..#.. #...# .#.#. #.#.#
+#.... .##.# #...# ####. ..#.. .###. ..#.. .#.#.
+..... ..... ..... ..... ..... ..... ..... .....
+..... ..... ..... ..... ..... ..... ..... .....
+
+#...# #...# ##### .###. ..... .###. ..#.. .....
+#...# #...# ....# .#... #.... ...#. .#.#. .....
+.#.#. #...# ...#. .#... .#... ...#. #...# .....
+..#.. .#.#. ..#.. .#... ..#.. ...#. ..... .....
+.#.#. ..#.. .#... .#... ...#. ...#. ..... .....
+#...# ..#.. #.... .#... ....# ...#. ..... .....
+#...# ..#.. ##### .###. ..... .###. ..... .....
+..... ..... ..... ..... ..... ..... ..... #####
+..... ..... ..... ..... ..... ..... ..... .....
+
+.#... ..... #.... ..... ....# ..... ..##. .....
+..#.. ..... #.... ..... ....# ..... .#..# .....
+...#. .###. #.##. .###. .##.# .###. .#... .####
+..... ....# ##..# #.... #..## #...# ###.. #...#
+..... .#### #...# #.... #...# ##### .#... #...#
+..... #...# #...# #...# #...# #.... .#... #...#
+..... .#### ####. .###. .#### .###. .#... .####
+..... ..... ..... ..... ..... ..... ..... ....#
+..... ..... ..... ..... ..... ..... ..... .###.
+
+#.... ..#.. ...#. #.... .##.. ..... ..... .....
+#.... ..... ..... #.... ..#.. ..... ..... .....
+#.##. .##.. ..##. #..#. ..#.. ##.#. #.##. .###.
+##..# ..#.. ...#. #.#.. ..#.. #.#.# ##..# #...#
+#...# ..#.. ...#. ##... ..#.. #.#.# #...# #...#
+#...# ..#.. ...#. #.#.. ..#.. #...# #...# #...#
+#...# .###. ...#. #..#. .###. #...# #...# .###.
+..... ..... #..#. ..... ..... ..... ..... .....
+..... ..... .##.. ..... ..... ..... ..... .....
+
+..... ..... ..... ..... .#... ..... ..... .....
+..... ..... ..... ..... .#... ..... ..... .....
+####. .#### #.##. .###. ###.. #...# #...# #...#
+#...# #...# ##..# #.... .#... #...# #...# #...#
+#...# #...# #.... .###. .#... #...# #...# #.#.#
+#...# #...# #.... ....# .#..# #..## .#.#. #.#.#
+####. .#### #.... ####. ..##. .##.# ..#.. .#.#.
+#.... ....# ..... ..... ..... ..... ..... .....
+#.... ....# ..... ..... ..... ..... ..... .....
+
+..... ..... ..... ...#. ..#.. .#... .....
+..... ..... ..... ..#.. ..#.. ..#.. .....
+#...# #...# ##### ..#.. ..#.. ..#.. .#...
+.#.#. #...# ...#. .#... ..#.. ...#. #.#.#
+..#.. #...# ..#.. ..#.. ..#.. ..#.. ...#.
+.#.#. #...# .#... ..#.. ..#.. ..#.. .....
+#...# .#### ##### ...#. ..#.. .#... .....
+..... ....# ..... ..... ..... ..... .....
+..... .###. ..... ..... ..... ..... .....
+`
+
+// font holds a bitmap per glyph, one row per byte, with bit 4 the leftmost
+// pixel.
+var font = parseFont(fontArt)
+
+func parseFont(art string) [lastRune - firstRune + 1][glyphRows]uint8 {
+	var f [lastRune - firstRune + 1][glyphRows]uint8
+	blocks := strings.Split(strings.TrimSpace(art), "\n\n")
+	for b, block := range blocks {
+		for row, line := range strings.Split(block, "\n") {
+			for i, g := range strings.Fields(line) {
+				for col, px := range g {
+					if px == '#' {
+						f[b*8+i][row] |= 1 << (glyphCols - 1 - col)
+					}
+				}
+			}
+		}
+	}
+	return f
+}
+
+// DrawText draws s onto dst with its top left corner at p, using the
+// built-in font scaled by scale. Only the glyphs are drawn; the background is
+// left as is. Characters outside printable ASCII are drawn as '?'. It returns
+// the point after the last character.
+func DrawText(dst draw.Image, p image.Point, s string, scale int, c color.Color) image.Point {
+	src := image.NewUniform(c)
+	for _, r := range s {
+		if r < firstRune || r > lastRune {
+			r = '?'
+		}
+		glyph := font[r-firstRune]
+		for row, bits := range glyph {
+			for col := 0; col < glyphCols; col++ {
+				if bits&(1<<(glyphCols-1-col)) == 0 {
+					continue
+				}
+				px := image.Rect(0, 0, scale, scale).Add(p.Add(image.Pt(col*scale, row*scale)))
+				draw.Draw(dst, px, src, image.Point{}, draw.Src)
+			}
+		}
+		p.X += GlyphWidth * scale
+	}
+	return p
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestFont(t *testing.T) {
+	for r := firstRune; r <= lastRune; r++ {
+		empty := font[r-firstRune] == [glyphRows]uint8{}
+		if empty != (r == ' ') {
+			t.Errorf("glyph %q empty = %t", r, empty)
+		}
+	}
+	// Spot check a glyph against the art.
+	want := [glyphRows]uint8{0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001}
+	if got := font['A'-firstRune]; got != want {
+		t.Errorf("glyph 'A' = %05b, want %05b", got, want)
+	}
+}
+
+// render returns the pixels of img set to c as art, like fontArt.
+func render(img *image.RGBA, c color.Color) string {
+	var b strings.Builder
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			if img.At(x, y) == c {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestDrawText(t *testing.T) {
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for _, tt := range []struct {
+		name  string
+		s     string
+		scale int
+		want  string
+		end   image.Point
+	}{
+		{
+			name:  "one glyph",
+			s:     "T",
+			scale: 1,
+			want: `
+............
+.#####......
+...#........
+...#........
+...#........
+...#........
+...#........
+...#........
+............
+............
+`,
+			end: image.Pt(7, 1),
+		},
+		{
+			name:  "scaled",
+			s:     "-",
+			scale: 2,
+			want: `
+............
+............
+............
+............
+............
+............
+............
+.##########.
+.##########.
+............
+`,
+			end: image.Pt(13, 1),
+		},
+		{
+			name:  "non ascii",
+			s:     "\u00e9",
+			scale: 1,
+			want: `
+............
+..###.......
+.#...#......
+.....#......
+....#.......
+...#........
+............
+...#........
+............
+............
+`,
+			end: image.Pt(7, 1),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Leave a margin to see that nothing is drawn outside the cell.
+			img := image.NewRGBA(image.Rect(0, 0, 2*GlyphWidth, GlyphHeight))
+			end := DrawText(img, image.Pt(1, 1), tt.s, tt.scale, white)
+			if end != tt.end {
+				t.Errorf("DrawText = %v, want %v", end, tt.end)
+			}
+			if got, want := render(img, white), strings.TrimPrefix(tt.want, "\n"); got != want {
+				t.Errorf("DrawText(%q) =\n%s\nwant\n%s", tt.s, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Framebuffer ioctls, types and visuals from linux/fb.h.
+const (
+	ioctlGetVScreenInfo = 0x4600
+	ioctlGetFScreenInfo = 0x4602
+
+	TypePackedPixels = 0
+
+	VisualTrueColor   = 2
+	VisualDirectColor = 4
+)
+
+// FixScreenInfo is struct fb_fix_screeninfo from linux/fb.h.
+type FixScreenInfo struct {
+	ID           [16]byte
+	SmemStart    uint
+	SmemLen      uint32
+	Type         uint32
+	TypeAux      uint32
+	Visual       uint32
+	XPanStep     uint16
+	YPanStep     uint16
+	YWrapStep    uint16
+	LineLength   uint32
+	MMIOStart    uint
+	MMIOLen      uint32
+	Accel        uint32
+	Capabilities uint16
+	Reserved     [2]uint16
+}
+
+// Name returns the name of the framebuffer driver, e.g. "EFI VGA".
+func (f *FixScreenInfo) Name() string {
+	id, _, _ := bytes.Cut(f.ID[:], []byte{0})
+	return string(id)
+}
+
+// Bitfield describes the position of a color channel in a pixel.
+type Bitfield struct {
+	Offset   uint32
+	Length   uint32
+	MSBRight uint32
+}
+
+// VarScreenInfo is struct fb_var_screeninfo from linux/fb.h.
+type VarScreenInfo struct {
+	XRes, YRes               uint32
+	XResVirtual, YResVirtual uint32
+	XOffset, YOffset         uint32
+	BitsPerPixel             uint32
+	Grayscale                uint32
+	Red, Green, Blue, Transp Bitfield
+	NonStd                   uint32
+	Activate                 uint32
+	Height, Width            uint32
+	AccelFlags               uint32
+	PixClock                 uint32
+	Margins                  [4]uint32
+	HSyncLen, VSyncLen       uint32
+	Sync                     uint32
+	VMode                    uint32
+	Rotate                   uint32
+	Colorspace               uint32
+	Reserved                 [4]uint32
+}
+
+// GetScreenInfo returns the fixed and current variable screen information
+// of a framebuffer device, e.g. /dev/fb0.
+func GetScreenInfo(dev string) (*FixScreenInfo, *VarScreenInfo, error) {
+	f, err := os.Open(dev)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var fix FixScreenInfo
+	var v VarScreenInfo
+	for _, req := range []struct {
+		cmd uintptr
+		arg unsafe.Pointer
+	}{
+		{ioctlGetFScreenInfo, unsafe.Pointer(&fix)},
+		{ioctlGetVScreenInfo, unsafe.Pointer(&v)},
+	} {
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req.cmd, uintptr(req.arg)); errno != 0 {
+			return nil, nil, &os.PathError{Op: "ioctl", Path: dev, Err: errno}
+		}
+	}
+	return &fix, &v, nil
+}
@@ -0,0 +1,355 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hotplug manages devices as the kernel reports them with uevents,
+// a small mdev or udev.
+//
+// For each device it loads the kernel modules matching its MODALIAS,
+// creates its device node with the owner and mode of the first matching
+// Rule, runs the rule's command, and creates the /dev/disk/by-uuid,
+// by-label, by-partuuid and by-path links of block devices.
+package hotplug
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/kmodule"
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/uevent"
+	"github.com/u-root/u-root/pkg/ulog"
+	"golang.org/x/sys/unix"
+)
+
+// EventReader is a source of uevents, like a uevent.Conn.
+type EventReader interface {
+	Read() (*uevent.Event, error)
+}
+
+var _ EventReader = &uevent.Conn{}
+
+// Manager handles uevents.
+//
+// The zero Manager manages /dev from /sys without rules.
+type Manager struct {
+	// DevRoot is where device nodes are, /dev by default.
+	DevRoot string
+	// SysRoot is where sysfs is, /sys by default.
+	SysRoot string
+
+	Rules []Rule
+
+	// LoadModule loads the kernel modules for a modalias. By default,
+	// the modules matching it in modules.alias are loaded with
+	// kmodule.Probe.
+	LoadModule func(modalias string) error
+
+	// RunCommand runs the command of a rule with the given environment
+	// and DevRoot as working directory. By default, it runs "sh -c".
+	RunCommand func(command string, env []string) error
+
+	// Logger logs the errors of Run. By default, nothing is logged.
+	Logger ulog.Logger
+
+	mu sync.Mutex
+	// modaliases loaded before; many devices share one.
+	modaliases map[string]bool
+	aliases    kmodule.Aliases
+	aliasErr   error
+	// links of block devices by devpath, to remove them with the device.
+	links map[string][]string
+}
+
+func (m *Manager) devRoot() string {
+	if m.DevRoot == "" {
+		return "/dev"
+	}
+	return m.DevRoot
+}
+
+func (m *Manager) sysRoot() string {
+	if m.SysRoot == "" {
+		return "/sys"
+	}
+	return m.SysRoot
+}
+
+func (m *Manager) logger() ulog.Logger {
+	if m.Logger == nil {
+		return ulog.Null
+	}
+	return m.Logger
+}
+
+// Coldplug handles "add" events for all devices that already exist, as
+// sysfs has them. All devices are handled, even after errors.
+func (m *Manager) Coldplug() error {
+	var errs []error
+	err := uevent.Coldplug(m.sysRoot(), func(e *uevent.Event) error {
+		if err := m.Handle(e); err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// Run handles the events of r until reading fails. Errors handling events
+// are logged.
+func (m *Manager) Run(r EventReader) error {
+	for {
+		e, err := r.Read()
+		if err != nil {
+			return err
+		}
+		if err := m.Handle(e); err != nil {
+			m.logger().Printf("%v", err)
+		}
+	}
+}
+
+// Handle handles one event.
+func (m *Manager) Handle(e *uevent.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	if alias := e.Env["MODALIAS"]; e.Action == "add" && alias != "" {
+		errs = append(errs, m.loadModule(alias))
+	}
+
+	devname := e.Env["DEVNAME"]
+	if devname == "" {
+		return errors.Join(errs...)
+	}
+	rules := m.matchingRules(devname, e.Env)
+
+	switch e.Action {
+	case "add":
+		errs = append(errs, m.addNode(e, devname, rules))
+		errs = append(errs, m.runCommands(e, devname, rules))
+		if e.Subsystem == "block" {
+			errs = append(errs, m.addLinks(e, devname))
+		}
+	case "change":
+		if e.Subsystem == "block" {
+			// A new medium or file system.
+			m.removeLinks(e)
+			errs = append(errs, m.addLinks(e, devname))
+		}
+	case "remove":
+		m.removeLinks(e)
+		errs = append(errs, m.runCommands(e, devname, rules))
+		if err := os.Remove(filepath.Join(m.devRoot(), devname)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s %s: %w", e.Action, e.DevPath, err)
+	}
+	return nil
+}
+
+func (m *Manager) loadModule(modalias string) error {
+	if m.modaliases[modalias] {
+		return nil
+	}
+	if m.modaliases == nil {
+		m.modaliases = make(map[string]bool)
+	}
+	m.modaliases[modalias] = true
+
+	if m.LoadModule != nil {
+		return m.LoadModule(modalias)
+	}
+	if m.aliases == nil && m.aliasErr == nil {
+		m.aliases, m.aliasErr = kmodule.ReadAliases(kmodule.ProbeOpts{})
+		if m.aliasErr != nil {
+			// Without modules.alias there is nothing to load, say
+			// so once.
+			return m.aliasErr
+		}
+	}
+	// Most devices have no module, only read everything else for
+	// those that do.
+	if len(m.aliases.Lookup(modalias)) == 0 {
+		return nil
+	}
+	if err := kmodule.Probe(modalias, ""); err != nil {
+		return fmt.Errorf("loading modules for %s: %w", modalias, err)
+	}
+	return nil
+}
+
+// matchingRules returns the rules that apply to a device: the first
+// matching one, and the matching ones before it that continue matching.
+func (m *Manager) matchingRules(devname string, env map[string]string) []*Rule {
+	var rules []*Rule
+	for i := range m.Rules {
+		r := &m.Rules[i]
+		if !r.matches(devname, env) {
+			continue
+		}
+		rules = append(rules, r)
+		if !r.Continue {
+			break
+		}
+	}
+	return rules
+}
+
+// addNode creates the device node if devtmpfs did not, and sets its owner
+// and mode as the rules say.
+func (m *Manager) addNode(e *uevent.Event, devname string, rules []*Rule) error {
+	node := filepath.Join(m.devRoot(), devname)
+	mode, uid, gid := os.FileMode(0o660), -1, -1
+	if len(rules) > 0 {
+		r := rules[len(rules)-1]
+		mode, uid, gid = r.Mode, r.UID, r.GID
+	}
+
+	if _, err := os.Lstat(node); errors.Is(err, os.ErrNotExist) {
+		major, err := strconv.ParseUint(e.Env["MAJOR"], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s has no major number", devname)
+		}
+		minor, err := strconv.ParseUint(e.Env["MINOR"], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s has no minor number", devname)
+		}
+		typ := uint32(unix.S_IFCHR)
+		if e.Subsystem == "block" {
+			typ = unix.S_IFBLK
+		}
+		if err := os.MkdirAll(filepath.Dir(node), 0o755); err != nil {
+			return err
+		}
+		if err := unix.Mknod(node, typ|uint32(mode), int(unix.Mkdev(uint32(major), uint32(minor)))); err != nil {
+			return fmt.Errorf("mknod %s: %w", node, err)
+		}
+	} else if err != nil {
+		return err
+	} else if len(rules) == 0 {
+		// Leave nodes of devtmpfs alone unless a rule says otherwise.
+		return nil
+	}
+
+	if err := os.Chmod(node, mode); err != nil {
+		return err
+	}
+	if uid != -1 || gid != -1 {
+		return os.Lchown(node, uid, gid)
+	}
+	return nil
+}
+
+func (m *Manager) runCommands(e *uevent.Event, devname string, rules []*Rule) error {
+	var errs []error
+	for _, r := range rules {
+		if !r.runsOn(e.Action) {
+			continue
+		}
+		env := append(os.Environ(), e.Environ()...)
+		env = append(env, "MDEV="+devname)
+		if err := m.runCommand(r.Command, env); err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", r.Command, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) runCommand(command string, env []string) error {
+	if m.RunCommand != nil {
+		return m.RunCommand(command, env)
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = env
+	cmd.Dir = m.devRoot()
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// addLinks creates the /dev/disk links of a block device, for everything
+// that can be probed.
+func (m *Manager) addLinks(e *uevent.Event, devname string) error {
+	node := filepath.Join(m.devRoot(), devname)
+	names := map[string]string{}
+	if uuid, err := block.FSUUID(node); err == nil {
+		names["by-uuid"] = uuid
+	}
+	if label, err := block.FSLabel(node); err == nil && label != "" {
+		names["by-label"] = encodeName(label)
+	}
+
+	parent := filepath.Dir(e.DevPath)
+	id := pathID(m.sysRoot(), e.DevPath)
+	if e.Env["DEVTYPE"] == "partition" {
+		partn, err := strconv.Atoi(e.Env["PARTN"])
+		if err != nil {
+			return fmt.Errorf("partition %s has no number", devname)
+		}
+		if uuid, err := block.PartUUID(filepath.Join(m.devRoot(), filepath.Base(parent)), partn); err == nil {
+			names["by-partuuid"] = uuid
+		}
+		if id = pathID(m.sysRoot(), parent); id != "" {
+			id += "-part" + strconv.Itoa(partn)
+		}
+	}
+	if id != "" {
+		names["by-path"] = id
+	}
+
+	var errs []error
+	for dir, name := range names {
+		link := filepath.Join(m.devRoot(), "disk", dir, name)
+		if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// The newest device with a name gets it, like with udev.
+		_ = os.Remove(link)
+		if err := os.Symlink(filepath.Join("../..", devname), link); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if m.links == nil {
+			m.links = make(map[string][]string)
+		}
+		m.links[e.DevPath] = append(m.links[e.DevPath], link)
+	}
+	return errors.Join(errs...)
+}
+
+// removeLinks removes the /dev/disk links addLinks created for the device,
+// unless another device took them over.
+func (m *Manager) removeLinks(e *uevent.Event) {
+	target := filepath.Join("../..", e.Env["DEVNAME"])
+	for _, link := range m.links[e.DevPath] {
+		if t, err := os.Readlink(link); err == nil && t == target {
+			os.Remove(link)
+		}
+	}
+	delete(m.links, e.DevPath)
+}
+
+// encodeName escapes characters that do not belong in a file name, like
+// udev does for labels: "My Disk" becomes "My\x20Disk".
+func encodeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80 || strings.IndexByte("#+-.:=@_", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,289 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hotplug
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uevent"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ataDisk = "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda"
+	ataPart = ataDisk + "/sda1"
+)
+
+// sysDevice adds a device on subsystem to the fake sysfs at root.
+func sysDevice(t *testing.T, root, devpath, subsystem string) {
+	t.Helper()
+	dir := filepath.Join(root, devpath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "class", subsystem), filepath.Join(dir, "subsystem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "uevent"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeSys returns a sysfs with a SATA disk.
+func fakeSys(t *testing.T) string {
+	root := t.TempDir()
+	sysDevice(t, root, "/devices/pci0000:00/0000:00:1f.2", "pci")
+	sysDevice(t, root, "/devices/pci0000:00/0000:00:1f.2/ata1/host0", "scsi")
+	sysDevice(t, root, "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0", "scsi")
+	sysDevice(t, root, "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0", "scsi")
+	sysDevice(t, root, ataDisk, "block")
+	sysDevice(t, root, ataPart, "block")
+	return root
+}
+
+// writeImages writes a disk image with an MBR to sda and an ext4 file
+// system with a label to sda1.
+func writeImages(t *testing.T, dev string) {
+	t.Helper()
+	disk := make([]byte, 1024)
+	binary.LittleEndian.PutUint32(disk[440:], 0xcafe0001)
+	binary.LittleEndian.PutUint16(disk[510:], 0xaa55)
+	part := make([]byte, 2048)
+	binary.LittleEndian.PutUint16(part[1024+56:], 0xef53)
+	copy(part[1024+104:], []byte{0x02, 0x17, 0x59, 0x89, 0xd4, 0x9f, 0x4e, 0x8e, 0x83, 0x6e, 0x99, 0x30, 0x0a, 0xf6, 0x6f, 0xc1})
+	copy(part[1024+120:], "my root")
+	for name, b := range map[string][]byte{"sda": disk, "sda1": part} {
+		if err := os.WriteFile(filepath.Join(dev, name), b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// event parses a uevent message like the kernel sends.
+func event(t *testing.T, vars ...string) *uevent.Event {
+	t.Helper()
+	var action, devpath string
+	for _, v := range vars {
+		if s, ok := strings.CutPrefix(v, "ACTION="); ok {
+			action = s
+		}
+		if s, ok := strings.CutPrefix(v, "DEVPATH="); ok {
+			devpath = s
+		}
+	}
+	e, err := uevent.Parse([]byte(action + "@" + devpath + "\x00" + strings.Join(vars, "\x00") + "\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func readLink(t *testing.T, link string) string {
+	t.Helper()
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+func TestHandle(t *testing.T) {
+	dev := t.TempDir()
+	writeImages(t, dev)
+	rules, err := ParseRules(strings.NewReader(fmt.Sprintf("sd[a-z]+[0-9]+ %d:%d 0640 *echo", os.Getuid(), os.Getgid())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var modaliases []string
+	var commands []string
+	m := &Manager{
+		DevRoot: dev,
+		SysRoot: fakeSys(t),
+		Rules:   rules,
+		LoadModule: func(modalias string) error {
+			modaliases = append(modaliases, modalias)
+			return nil
+		},
+		RunCommand: func(command string, env []string) error {
+			if !slices.Contains(env, "MDEV=sda1") {
+				t.Errorf("command environment %q has no MDEV=sda1", env)
+			}
+			for _, v := range env {
+				if a, ok := strings.CutPrefix(v, "ACTION="); ok {
+					commands = append(commands, command+" "+a)
+				}
+			}
+			return nil
+		},
+	}
+
+	ahci := event(t, "ACTION=add", "DEVPATH=/devices/pci0000:00/0000:00:1f.2", "SUBSYSTEM=pci", "MODALIAS=pci:v00008086d00002922sv00001AF4sd00001100bc01sc06i01")
+	for _, e := range []*uevent.Event{
+		ahci,
+		ahci,
+		event(t, "ACTION=add", "DEVPATH="+ataDisk, "SUBSYSTEM=block", "MAJOR=8", "MINOR=0", "DEVNAME=sda", "DEVTYPE=disk"),
+		event(t, "ACTION=add", "DEVPATH="+ataPart, "SUBSYSTEM=block", "MAJOR=8", "MINOR=1", "DEVNAME=sda1", "DEVTYPE=partition", "PARTN=1"),
+	} {
+		if err := m.Handle(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{"pci:v00008086d00002922sv00001AF4sd00001100bc01sc06i01"}; !slices.Equal(modaliases, want) {
+		t.Errorf("loaded modules for %q, want %q", modaliases, want)
+	}
+	if fi, err := os.Stat(filepath.Join(dev, "sda1")); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Errorf("sda1 has mode %v, %v, want 0640", fi.Mode(), err)
+	}
+	if fi, err := os.Stat(filepath.Join(dev, "sda")); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("sda without rule changed mode to %v, %v", fi.Mode(), err)
+	}
+	links := map[string]string{
+		"disk/by-uuid/02175989-d49f-4e8e-836e-99300af66fc1": "../../sda1",
+		`disk/by-label/my\x20root`:                          "../../sda1",
+		"disk/by-partuuid/cafe0001-01":                      "../../sda1",
+		"disk/by-path/pci-0000:00:1f.2-ata-1-part1":         "../../sda1",
+		"disk/by-path/pci-0000:00:1f.2-ata-1":               "../../sda",
+	}
+	for link, want := range links {
+		if got := readLink(t, filepath.Join(dev, link)); got != want {
+			t.Errorf("%s -> %q, want %q", link, got, want)
+		}
+	}
+
+	if err := m.Handle(event(t, "ACTION=remove", "DEVPATH="+ataPart, "SUBSYSTEM=block", "MAJOR=8", "MINOR=1", "DEVNAME=sda1", "DEVTYPE=partition", "PARTN=1")); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range links {
+		if got := readLink(t, filepath.Join(dev, link)); target == "../../sda1" && got != "" {
+			t.Errorf("%s -> %q still exists after remove", link, got)
+		} else if target == "../../sda" && got != target {
+			t.Errorf("%s of another device removed", link)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dev, "sda1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sda1 exists after remove: %v", err)
+	}
+	if want := []string{"echo add", "echo remove"}; !slices.Equal(commands, want) {
+		t.Errorf("commands %q, want %q", commands, want)
+	}
+}
+
+func TestMknod(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("mknod needs root")
+	}
+	dev := t.TempDir()
+	m := &Manager{DevRoot: dev, SysRoot: t.TempDir()}
+	if err := m.Handle(event(t, "ACTION=add", "DEVPATH=/devices/virtual/mem/null", "SUBSYSTEM=mem", "MAJOR=1", "MINOR=3", "DEVNAME=null")); err != nil {
+		t.Fatal(err)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(filepath.Join(dev, "null"), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFCHR || st.Rdev != unix.Mkdev(1, 3) || st.Mode&0o777 != 0o660 {
+		t.Errorf("null has mode %o and device %x, want character device 1:3 with mode 0660", st.Mode, st.Rdev)
+	}
+
+	err := m.Handle(event(t, "ACTION=add", "DEVPATH=/devices/virtual/foo", "SUBSYSTEM=foo", "DEVNAME=foo"))
+	if err == nil {
+		t.Errorf("adding a device node without major and minor number succeeded")
+	}
+}
+
+// events is an EventReader of a list of events.
+type events []*uevent.Event
+
+func (e *events) Read() (*uevent.Event, error) {
+	if len(*e) == 0 {
+		return nil, io.EOF
+	}
+	ev := (*e)[0]
+	*e = (*e)[1:]
+	return ev, nil
+}
+
+func TestRun(t *testing.T) {
+	sys := fakeSys(t)
+	var modaliases []string
+	m := &Manager{
+		DevRoot: t.TempDir(),
+		SysRoot: sys,
+		LoadModule: func(modalias string) error {
+			modaliases = append(modaliases, modalias)
+			return nil
+		},
+	}
+	if err := os.WriteFile(filepath.Join(sys, "/devices/pci0000:00/0000:00:1f.2/uevent"), []byte("MODALIAS=pci:ahci\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Coldplug(); err != nil {
+		t.Fatal(err)
+	}
+	evs := &events{
+		event(t, "ACTION=add", "DEVPATH=/devices/pci0000:00/0000:00:14.0", "SUBSYSTEM=pci", "MODALIAS=pci:xhci"),
+		event(t, "ACTION=add", "DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1", "SUBSYSTEM=usb", "MODALIAS=pci:xhci"),
+	}
+	if err := m.Run(evs); !errors.Is(err, io.EOF) {
+		t.Errorf("Run = %v, want %v", err, io.EOF)
+	}
+	if want := []string{"pci:ahci", "pci:xhci"}; !slices.Equal(modaliases, want) {
+		t.Errorf("loaded modules for %q, want %q", modaliases, want)
+	}
+}
+
+func TestPathID(t *testing.T) {
+	root := t.TempDir()
+	for devpath, subsystem := range map[string]string{
+		"/devices/pci0000:00/0000:00:1c.0":                                                              "pci",
+		"/devices/pci0000:00/0000:00:1c.0/0000:01:00.0":                                                 "pci",
+		"/devices/pci0000:00/0000:00:1c.0/0000:01:00.0/nvme/nvme0":                                      "nvme",
+		"/devices/pci0000:00/0000:00:1c.0/0000:01:00.0/nvme/nvme0/nvme0n2":                              "block",
+		"/devices/pci0000:00/0000:00:14.0":                                                              "pci",
+		"/devices/pci0000:00/0000:00:14.0/usb1":                                                         "usb",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2":                                                     "usb",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4":                                               "usb",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4/1-2.4:1.0":                                     "usb",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4/1-2.4:1.0/host6":                               "scsi",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4/1-2.4:1.0/host6/target6:0:0":                   "scsi",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4/1-2.4:1.0/host6/target6:0:0/6:0:0:1":           "scsi",
+		"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4/1-2.4:1.0/host6/target6:0:0/6:0:0:1/block/sdb": "block",
+		"/devices/platform/soc":                                                                         "platform",
+		"/devices/platform/soc/fe340000.mmc":                                                            "platform",
+		"/devices/platform/soc/fe340000.mmc/mmc_host/mmc0":                                              "mmc_host",
+		"/devices/platform/soc/fe340000.mmc/mmc_host/mmc0/mmc0:0001":                                    "mmc",
+		"/devices/platform/soc/fe340000.mmc/mmc_host/mmc0/mmc0:0001/block/mmcblk0":                      "block",
+		"/devices/virtual/block/loop0":                                                                  "block",
+	} {
+		sysDevice(t, root, devpath, subsystem)
+	}
+
+	for _, tt := range []struct {
+		devpath string
+		want    string
+	}{
+		{"/devices/pci0000:00/0000:00:1c.0/0000:01:00.0/nvme/nvme0/nvme0n2", "pci-0000:01:00.0-nvme-2"},
+		{"/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2.4/1-2.4:1.0/host6/target6:0:0/6:0:0:1/block/sdb", "pci-0000:00:14.0-usb-0:2.4:1.0-scsi-0:0:0:1"},
+		{"/devices/platform/soc/fe340000.mmc/mmc_host/mmc0/mmc0:0001/block/mmcblk0", "platform-fe340000.mmc"},
+		{"/devices/virtual/block/loop0", ""},
+	} {
+		if got := pathID(root, tt.devpath); got != tt.want {
+			t.Errorf("pathID(%s) = %q, want %q", tt.devpath, got, tt.want)
+		}
+	}
+	if got := pathID(fakeSys(t), ataDisk); got != "pci-0000:00:1f.2-ata-1" {
+		t.Errorf("pathID(%s) = %q, want %q", ataDisk, got, "pci-0000:00:1f.2-ata-1")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hotplug
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	usbInterface = regexp.MustCompile(`^\d+-([\d.]+):(\d+\.\d+)$`)
+	scsiDevice   = regexp.MustCompile(`^\d+:\d+:\d+:\d+$`)
+	ataPort      = regexp.MustCompile(`/ata(\d+)/`)
+	nvmeNS       = regexp.MustCompile(`^nvme\d+(?:c\d+)?n(\d+)$`)
+	scsiHost     = regexp.MustCompile(`^host(\d+)$`)
+)
+
+// subsystem returns the subsystem of the device at devpath in the sysfs at
+// sysRoot, or "" if it has none.
+func subsystem(sysRoot, devpath string) string {
+	link, err := os.Readlink(filepath.Join(sysRoot, devpath, "subsystem"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(link)
+}
+
+// pathID returns a name for the device at devpath made of the buses and
+// ports it hangs off, like udev's path_id builtin does for the
+// /dev/disk/by-path links, e.g. "pci-0000:00:1f.2-ata-1". It returns "" for
+// devices that are not on a PCI or platform bus.
+func pathID(sysRoot, devpath string) string {
+	var id []string
+	prepend := func(s string) {
+		id = append([]string{s}, id...)
+	}
+
+	// The parents of a device on a bus are often on the same bus, like
+	// PCI bridges or USB hubs, and only the first one counts.
+	var skip, child string
+	for p := devpath; p != "/" && p != "."; child, p = path.Base(p), path.Dir(p) {
+		sub := subsystem(sysRoot, p)
+		if sub == skip {
+			continue
+		}
+		skip = ""
+		name := path.Base(p)
+		switch sub {
+		case "nvme":
+			if m := nvmeNS.FindStringSubmatch(child); m != nil {
+				prepend("nvme-" + m[1])
+			}
+		case "scsi":
+			if !scsiDevice.MatchString(name) {
+				continue
+			}
+			if m := ataPort.FindStringSubmatch(p); m != nil {
+				prepend("ata-" + m[1])
+			} else {
+				prepend("scsi-" + scsiID(sysRoot, p))
+			}
+			skip = sub
+		case "usb":
+			if m := usbInterface.FindStringSubmatch(name); m != nil {
+				prepend("usb-0:" + m[1] + ":" + m[2])
+				skip = sub
+			}
+		case "pci", "platform":
+			prepend(sub + "-" + name)
+			skip = sub
+		}
+	}
+	if len(id) == 0 || !strings.HasPrefix(id[0], "pci-") && !strings.HasPrefix(id[0], "platform-") {
+		return ""
+	}
+	return strings.Join(id, "-")
+}
+
+// scsiID returns the address of the SCSI device at devpath, like
+// "0:0:0:1", with the host number counting from the first host of the
+// controller rather than of the system, as udev does.
+func scsiID(sysRoot, devpath string) string {
+	name := path.Base(devpath)
+	host, rest, _ := strings.Cut(name, ":")
+	h, err := strconv.Atoi(host)
+	if err != nil {
+		return name
+	}
+	// devpath is .../hostN/targetN:C:T/N:C:T:L.
+	entries, err := os.ReadDir(filepath.Join(sysRoot, path.Dir(path.Dir(path.Dir(devpath)))))
+	if err != nil {
+		return name
+	}
+	base := h
+	for _, e := range entries {
+		if m := scsiHost.FindStringSubmatch(e.Name()); m != nil {
+			if n, _ := strconv.Atoi(m[1]); n < base {
+				base = n
+			}
+		}
+	}
+	return strconv.Itoa(h-base) + ":" + rest
+}
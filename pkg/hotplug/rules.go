@@ -0,0 +1,211 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hotplug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrBadRule is returned for lines of a rules file that do not parse.
+var ErrBadRule = errors.New("bad rule")
+
+// When a rule's command runs.
+const (
+	// RunOnAdd runs the command after a device node was created.
+	RunOnAdd = '@'
+	// RunOnRemove runs the command before a device node is removed.
+	RunOnRemove = '$'
+	// RunAlways runs the command on both.
+	RunAlways = '*'
+)
+
+// Rule sets the owner and permissions of the device nodes it matches, and
+// may run a command for them.
+//
+// Rules are written one per line, like busybox mdev.conf ones:
+//
+//	[-][$VAR=]regex user:group mode [@|$|*command]
+//
+// The regular expression matches the whole device name relative to /dev,
+// or the whole value of the uevent variable VAR. The first matching rule
+// applies, unless it starts with "-", in which case matching goes on.
+// Empty lines and those starting with "#" are ignored. For example:
+//
+//	# Everybody may use the virtual terminals.
+//	tty[0-9]+    0:5   0666
+//	$MODALIAS=usb:.* 0:0 0660 @logger "USB device $MDEV"
+//	sd[a-z][0-9]* root:disk 0660 *blockchanged.sh
+type Rule struct {
+	// Var is the uevent variable Match matches, or "" for the device
+	// name.
+	Var   string
+	Match *regexp.Regexp
+
+	UID  int
+	GID  int
+	Mode os.FileMode
+
+	// When is RunOnAdd, RunOnRemove or RunAlways if Command is set.
+	When    byte
+	Command string
+
+	// Continue is true if rules after this one are matched, too.
+	Continue bool
+}
+
+// ParseRules parses the rules in r.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, s.Err()
+}
+
+// ReadRules parses the rules in the file at path.
+func ReadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRules(f)
+}
+
+func parseRule(line string) (Rule, error) {
+	var rule Rule
+	match, rest := cutField(line)
+	owner, rest := cutField(rest)
+	perm, cmd := cutField(rest)
+	if perm == "" {
+		return rule, fmt.Errorf("%w: %q needs a match, owner and mode", ErrBadRule, line)
+	}
+
+	if strings.HasPrefix(match, "-") {
+		rule.Continue = true
+		match = match[1:]
+	}
+	if strings.HasPrefix(match, "$") {
+		v, m, ok := strings.Cut(match[1:], "=")
+		if !ok || v == "" {
+			return rule, fmt.Errorf("%w: %q is no $VAR=regex", ErrBadRule, match)
+		}
+		rule.Var, match = v, m
+	}
+	re, err := regexp.Compile("^(?:" + match + ")$")
+	if err != nil {
+		return rule, fmt.Errorf("%w: %w", ErrBadRule, err)
+	}
+	rule.Match = re
+
+	u, g, ok := strings.Cut(owner, ":")
+	if !ok {
+		return rule, fmt.Errorf("%w: owner %q is no user:group", ErrBadRule, owner)
+	}
+	if rule.UID, err = lookupID(u, lookupUser); err != nil {
+		return rule, err
+	}
+	if rule.GID, err = lookupID(g, lookupGroup); err != nil {
+		return rule, err
+	}
+
+	mode, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil || mode > 0o777 {
+		return rule, fmt.Errorf("%w: mode %q", ErrBadRule, perm)
+	}
+	rule.Mode = os.FileMode(mode)
+
+	if cmd != "" {
+		switch cmd[0] {
+		case RunOnAdd, RunOnRemove, RunAlways:
+			rule.When, rule.Command = cmd[0], strings.TrimSpace(cmd[1:])
+		default:
+			return rule, fmt.Errorf("%w: command %q does not start with @, $ or *", ErrBadRule, cmd)
+		}
+		if rule.Command == "" {
+			return rule, fmt.Errorf("%w: empty command", ErrBadRule)
+		}
+	}
+	return rule, nil
+}
+
+// cutField returns the first space separated field of s and the rest of s
+// after the spaces following it.
+func cutField(s string) (field, rest string) {
+	s = strings.TrimLeft(s, " \t")
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimLeft(s[i:], " \t")
+	}
+	return s, ""
+}
+
+func lookupUser(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGroup(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// lookupID returns the numeric ID of a user or group given by number or
+// name.
+func lookupID(s string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+	id, err := lookup(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrBadRule, err)
+	}
+	return strconv.Atoi(id)
+}
+
+// matches returns whether r matches the device devname with the uevent
+// variables env.
+func (r *Rule) matches(devname string, env map[string]string) bool {
+	if r.Var == "" {
+		return r.Match.MatchString(devname)
+	}
+	v, ok := env[r.Var]
+	return ok && r.Match.MatchString(v)
+}
+
+// runsOn returns whether the command of r runs for action.
+func (r *Rule) runsOn(action string) bool {
+	switch r.When {
+	case RunAlways:
+		return action == "add" || action == "remove"
+	case RunOnAdd:
+		return action == "add"
+	case RunOnRemove:
+		return action == "remove"
+	}
+	return false
+}
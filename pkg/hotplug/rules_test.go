@@ -0,0 +1,91 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hotplug
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# Comment.
+-sd[a-z].*   0:6 0640
+sd[a-z][0-9]* 0:6	0660  *echo "$ACTION $MDEV" > /tmp/log
+$MODALIAS=usb:.* 1000:100 0600 @logger usb
+tty[0-9]+ root:0 0666
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("got %d rules, want 4", len(rules))
+	}
+	for _, tt := range []struct {
+		rule     Rule
+		want     Rule
+		devname  string
+		env      map[string]string
+		matches  bool
+		runsOnRm bool
+	}{
+		{
+			rule:    rules[0],
+			want:    Rule{GID: 6, Mode: 0o640, Continue: true},
+			devname: "sda1",
+			matches: true,
+		},
+		{
+			rule:     rules[1],
+			want:     Rule{GID: 6, Mode: 0o660, When: RunAlways, Command: `echo "$ACTION $MDEV" > /tmp/log`},
+			devname:  "sda",
+			matches:  true,
+			runsOnRm: true,
+		},
+		{
+			rule:    rules[2],
+			want:    Rule{Var: "MODALIAS", UID: 1000, GID: 100, Mode: 0o600, When: RunOnAdd, Command: "logger usb"},
+			devname: "bus/usb/001/002",
+			env:     map[string]string{"MODALIAS": "usb:v1D6Bp0002d0606dc09dsc00dp01ic09isc00ip00in00"},
+			matches: true,
+		},
+		{
+			rule:    rules[3],
+			want:    Rule{Mode: 0o666},
+			devname: "tty",
+		},
+	} {
+		r := tt.rule
+		r.Match = nil
+		if r != tt.want {
+			t.Errorf("rule = %+v, want %+v", r, tt.want)
+		}
+		if got := tt.rule.matches(tt.devname, tt.env); got != tt.matches {
+			t.Errorf("rule %v matches %q = %t, want %t", tt.rule.Match, tt.devname, got, tt.matches)
+		}
+		if got := tt.rule.runsOn("remove"); got != tt.runsOnRm {
+			t.Errorf("rule %v runs on remove = %t, want %t", tt.rule.Match, got, tt.runsOnRm)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	for _, line := range []string{
+		"sda 0:0",
+		"sd(a 0:0 0660",
+		"$=sda 0:0 0660",
+		"sda 0 0660",
+		"sda nosuchuser:0 0660",
+		"sda 0:0 0999",
+		"sda 0:0 4755",
+		"sda 0:0 0660 echo",
+		"sda 0:0 0660 @",
+	} {
+		if _, err := ParseRules(strings.NewReader(line)); !errors.Is(err, ErrBadRule) {
+			t.Errorf("ParseRules(%q) = %v, want %v", line, err, ErrBadRule)
+		}
+	}
+}
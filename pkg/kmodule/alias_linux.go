@@ -0,0 +1,118 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kmodule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type alias struct {
+	pattern string
+	module  string
+}
+
+// Aliases maps modaliases of devices, like the MODALIAS of their uevents, to
+// the modules that drive them.
+type Aliases []alias
+
+// ReadAliases reads the modules.alias file of the kernel release of opts.
+func ReadAliases(opts ProbeOpts) (Aliases, error) {
+	dir, err := moduleDir(opts)
+	if err != nil {
+		return nil, err
+	}
+	return parseAliasFile(filepath.Join(dir, "modules.alias"))
+}
+
+func parseAliasFile(file string) (Aliases, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open alias file: %v", err)
+	}
+	defer f.Close()
+	return parseAliases(f)
+}
+
+func parseAliases(r io.Reader) (Aliases, error) {
+	var a Aliases
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) != 3 || f[0] != "alias" {
+			continue
+		}
+		a = append(a, alias{pattern: normalizeAlias(f[1]), module: f[2]})
+	}
+	return a, scanner.Err()
+}
+
+// Lookup returns the names of the modules whose aliases match modalias,
+// in the order of modules.alias.
+func (a Aliases) Lookup(modalias string) []string {
+	modalias = normalizeAlias(modalias)
+	var mods []string
+	for _, al := range a {
+		if ok, err := path.Match(al.pattern, modalias); ok && err == nil && !slices.Contains(mods, al.module) {
+			mods = append(mods, al.module)
+		}
+	}
+	return mods
+}
+
+// normalizeAlias replaces hyphens with underscores like modName, except in
+// bracket expressions where they denote ranges.
+func normalizeAlias(s string) string {
+	b := []byte(s)
+	inBrackets := false
+	for i, c := range b {
+		switch {
+		case c == '[':
+			inBrackets = true
+		case c == ']':
+			inBrackets = false
+		case c == '-' && !inBrackets:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// modinfo is what modules.builtin.modinfo says about builtin modules.
+type modinfo struct {
+	builtin map[string]bool
+	aliases Aliases
+}
+
+// readBuiltinModinfo reads modules.builtin.modinfo, which has "name.key=value"
+// strings, each NUL terminated, for all builtin modules. Kernels before 5.2
+// do not have it.
+func readBuiltinModinfo(moduleDir string) (*modinfo, error) {
+	m := &modinfo{builtin: make(map[string]bool)}
+	b, err := os.ReadFile(filepath.Join(moduleDir, "modules.builtin.modinfo"))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read builtin modinfo: %v", err)
+	}
+	for _, kv := range strings.Split(string(b), "\x00") {
+		name, rest, ok := strings.Cut(kv, ".")
+		if !ok {
+			continue
+		}
+		name = modName(name)
+		m.builtin[name] = true
+		if a, ok := strings.CutPrefix(rest, "alias="); ok {
+			m.aliases = append(m.aliases, alias{pattern: normalizeAlias(a), module: name})
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kmodule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// configDirs are the modprobe.d directories kmod reads, in order of
+// precedence: a file in one hides files of the same name in later ones.
+var configDirs = []string{
+	"/etc/modprobe.d",
+	"/run/modprobe.d",
+	"/usr/local/lib/modprobe.d",
+	"/lib/modprobe.d",
+	"/usr/lib/modprobe.d",
+}
+
+type softdep struct {
+	pre  []string
+	post []string
+}
+
+// config holds the modprobe.d directives, by module name with
+// underscores.
+type config struct {
+	aliases   Aliases
+	options   map[string][]string
+	install   map[string]string
+	remove    map[string]string
+	softdeps  map[string]softdep
+	blacklist map[string]bool
+}
+
+func newConfig() *config {
+	return &config{
+		options:   make(map[string][]string),
+		install:   make(map[string]string),
+		remove:    make(map[string]string),
+		softdeps:  make(map[string]softdep),
+		blacklist: make(map[string]bool),
+	}
+}
+
+// modName returns the name the kernel knows a module by, with
+// underscores for hyphens.
+func modName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// skipFields returns s without its first n whitespace separated fields and
+// the whitespace around them.
+func skipFields(s string, n int) string {
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if j := strings.IndexFunc(s, unicode.IsSpace); j >= 0 {
+			s = s[j:]
+		} else {
+			s = ""
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// readConfig reads the *.conf files in dirs, in the order of their names.
+func readConfig(dirs []string) (*config, error) {
+	files := make(map[string]string)
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if _, ok := files[filepath.Base(m)]; !ok {
+				files[filepath.Base(m)] = m
+			}
+		}
+	}
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	c := newConfig()
+	for _, n := range names {
+		f, err := os.Open(files[n])
+		if err != nil {
+			return nil, err
+		}
+		err = c.parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", files[n], err)
+		}
+	}
+	return c, nil
+}
+
+// parse adds the directives in r, in modprobe.d(5) format, to c. Unknown
+// directives are ignored, like kmod does.
+func (c *config) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	var line string
+	for scanner.Scan() {
+		// Lines ending in a backslash continue on the next one.
+		if l, ok := strings.CutSuffix(scanner.Text(), "\\"); ok {
+			line += l + " "
+			continue
+		}
+		line += scanner.Text()
+		f := strings.Fields(line)
+		cmd := line
+		line = ""
+		if len(f) < 2 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+
+		mod := modName(f[1])
+		switch f[0] {
+		case "alias":
+			if len(f) == 3 {
+				c.aliases = append(c.aliases, alias{pattern: normalizeAlias(f[1]), module: f[2]})
+			}
+		case "options":
+			c.options[mod] = append(c.options[mod], f[2:]...)
+		case "install", "remove":
+			// The command is the rest of the line, as is.
+			rest := skipFields(cmd, 2)
+			if f[0] == "install" {
+				c.install[mod] = strings.TrimSpace(rest)
+			} else {
+				c.remove[mod] = strings.TrimSpace(rest)
+			}
+		case "blacklist":
+			c.blacklist[mod] = true
+		case "softdep":
+			var sd softdep
+			var list *[]string
+			for _, w := range f[2:] {
+				switch w {
+				case "pre:":
+					list = &sd.pre
+				case "post:":
+					list = &sd.post
+				default:
+					if list != nil {
+						*list = append(*list, w)
+					}
+				}
+			}
+			c.softdeps[mod] = sd
+		}
+	}
+	return scanner.Err()
+}
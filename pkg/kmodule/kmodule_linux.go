@@ -10,11 +10,14 @@ package kmodule
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/klauspost/compress/zstd"
@@ -101,6 +104,9 @@ type dependency struct {
 
 type depMap map[string]*dependency
 
+// procModules lists the loaded modules.
+var procModules = "/proc/modules"
+
 // ProbeOpts contains optional parameters to Probe.
 //
 // An empty ProbeOpts{} should lead to the default behavior.
@@ -109,6 +115,29 @@ type ProbeOpts struct {
 	RootDir        string
 	KVer           string
 	IgnoreProcMods bool
+
+	// ConfigDirs are the modprobe.d directories, in order of precedence.
+	// By default, kmod's under RootDir are used.
+	ConfigDirs []string
+
+	// IgnoreConfig ignores modprobe.d.
+	IgnoreConfig bool
+
+	// ShowDepends is called with what would be done, instead of doing
+	// it, one line at a time like modprobe --show-depends prints them:
+	// "insmod <path> <params>", "builtin <name>" or "install <command>",
+	// and "rmmod <path>" or "remove <command>" for Remove.
+	ShowDepends func(string)
+}
+
+func (o *ProbeOpts) dryRun() bool {
+	return o.DryRunCB != nil || o.ShowDepends != nil
+}
+
+func (o *ProbeOpts) show(format string, v ...any) {
+	if o.ShowDepends != nil {
+		o.ShowDepends(strings.TrimSpace(fmt.Sprintf(format, v...)))
+	}
 }
 
 // Probe loads the given kernel module and its dependencies.
@@ -119,30 +148,250 @@ func Probe(name string, modParams string) error {
 
 // ProbeOptions loads the given kernel module and its dependencies.
 // This functions takes ProbeOpts.
+//
+// name is a module name, or an alias of modules like a device's modalias
+// as found in modules.alias, modules.builtin.modinfo or modprobe.d. All
+// modules of an alias that are not blacklisted in modprobe.d are loaded.
+//
+// The options of modprobe.d are passed to modules before modParams.
+// Modules with an install command in modprobe.d are loaded by running it,
+// and the soft dependencies of modules are loaded before and after them;
+// failing soft dependencies are ignored.
 func ProbeOptions(name, modParams string, opts ProbeOpts) error {
+	p, err := newProber(opts)
+	if err != nil {
+		return err
+	}
+	mods, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, mod := range mods {
+		errs = append(errs, p.load(mod, modParams))
+	}
+	return errors.Join(errs...)
+}
+
+// prober loads and removes modules by name, with what it knows about
+// them.
+type prober struct {
+	opts      ProbeOpts
+	moduleDir string
+	deps      depMap
+	conf      *config
+	modinfo   *modinfo
+
+	// aliases are read from modules.alias when needed.
+	aliases  Aliases
+	aliasErr error
+}
+
+func newProber(opts ProbeOpts) (*prober, error) {
 	deps, err := genDeps(opts)
 	if err != nil {
-		return fmt.Errorf("could not generate dependency map %v", err)
+		return nil, fmt.Errorf("could not generate dependency map %v", err)
+	}
+	dir, err := moduleDir(opts)
+	if err != nil {
+		return nil, err
+	}
+	p := &prober{opts: opts, moduleDir: dir, deps: deps, conf: newConfig()}
+	if p.modinfo, err = readBuiltinModinfo(dir); err != nil {
+		return nil, err
+	}
+	if !opts.IgnoreConfig {
+		dirs := opts.ConfigDirs
+		if dirs == nil {
+			for _, d := range configDirs {
+				dirs = append(dirs, filepath.Join(opts.RootDir, d))
+			}
+		}
+		if p.conf, err = readConfig(dirs); err != nil {
+			return nil, fmt.Errorf("could not read modprobe.d: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// isModule returns whether name is a module, or has an install command.
+func (p *prober) isModule(name string) bool {
+	if _, ok := p.conf.install[modName(name)]; ok {
+		return true
+	}
+	if p.modinfo.builtin[modName(name)] {
+		return true
+	}
+	_, err := findModPath(name, p.deps)
+	return err == nil
+}
+
+// resolve returns the modules name stands for.
+func (p *prober) resolve(name string) ([]string, error) {
+	if p.isModule(name) {
+		return []string{name}, nil
+	}
+
+	// Aliases of modprobe.d take precedence over those of modules.
+	mods := p.conf.aliases.Lookup(name)
+	if len(mods) == 0 {
+		if p.aliases == nil && p.aliasErr == nil {
+			p.aliases, p.aliasErr = parseAliasFile(filepath.Join(p.moduleDir, "modules.alias"))
+		}
+		mods = append(p.aliases.Lookup(name), p.modinfo.aliases.Lookup(name)...)
+	}
+	if len(mods) == 0 {
+		return nil, fmt.Errorf("could not find module path %q: %w", name, p.errNotFound(name))
+	}
+
+	var allowed []string
+	for _, mod := range mods {
+		if !p.conf.blacklist[modName(mod)] && !slices.Contains(allowed, mod) {
+			allowed = append(allowed, mod)
+		}
 	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("all modules of alias %q are blacklisted: %v", name, mods)
+	}
+	return allowed, nil
+}
+
+func (p *prober) errNotFound(name string) error {
+	if p.aliasErr != nil {
+		return fmt.Errorf("could not find path for module %q and no aliases: %v", name, p.aliasErr)
+	}
+	return fmt.Errorf("could not find path for module %q", name)
+}
 
-	modPath, err := findModPath(name, deps)
+// load loads the module name with its dependencies and soft dependencies.
+func (p *prober) load(name, modParams string) error {
+	mod := modName(name)
+	if p.modinfo.builtin[mod] {
+		p.opts.show("builtin %s", mod)
+		return nil
+	}
+	modPath, err := findModPath(name, p.deps)
 	if err != nil {
+		if _, ok := p.conf.install[mod]; ok {
+			return p.install(mod, modParams)
+		}
 		return fmt.Errorf("could not find module path %q: %v", name, err)
 	}
 
-	dep := deps[modPath]
-
-	if dep.state == builtin || dep.state == loaded {
+	dep := p.deps[modPath]
+	switch dep.state {
+	case builtin:
+		p.opts.show("builtin %s", mod)
+		return nil
+	case loaded:
 		return nil
+	case loading:
+		return fmt.Errorf("circular dependency! %q already LOADING", modPath)
 	}
 
+	sd := p.conf.softdeps[mod]
+	for _, pre := range sd.pre {
+		p.loadSoft(pre)
+	}
+	if err := p.loadDeps(modPath); err != nil {
+		return err
+	}
+	if _, ok := p.conf.install[mod]; ok {
+		if err := p.install(mod, modParams); err != nil {
+			return err
+		}
+		dep.state = loaded
+	} else if err := p.loadModule(modPath, modParams); err != nil {
+		return err
+	}
+	for _, post := range sd.post {
+		p.loadSoft(post)
+	}
+	return nil
+}
+
+// loadSoft loads a soft dependency, if it can.
+func (p *prober) loadSoft(name string) {
+	if mods, err := p.resolve(name); err == nil {
+		for _, mod := range mods {
+			_ = p.load(mod, "")
+		}
+	}
+}
+
+// loadDeps loads the dependencies of the module at modPath, and marks it
+// loading.
+func (p *prober) loadDeps(modPath string) error {
+	dep := p.deps[modPath]
 	dep.state = loading
 	for _, d := range dep.deps {
-		if err := loadDeps(d, deps, opts); err != nil {
+		dd, ok := p.deps[d]
+		if !ok {
+			return fmt.Errorf("could not find dependency %q", d)
+		}
+		switch dd.state {
+		case loading:
+			return fmt.Errorf("circular dependency! %q already LOADING", d)
+		case loaded, builtin:
+			continue
+		}
+		if err := p.loadDeps(d); err != nil {
+			return err
+		}
+		// done with dependencies, load module
+		mod := nameOf(d)
+		if _, ok := p.conf.install[mod]; ok {
+			if err := p.install(mod, ""); err != nil {
+				return err
+			}
+			dd.state = loaded
+		} else if err := p.loadModule(d, ""); err != nil {
 			return err
 		}
 	}
-	return loadModule(modPath, modParams, opts)
+	return nil
+}
+
+// loadModule loads the module at modPath with the options of modprobe.d
+// and modParams.
+func (p *prober) loadModule(modPath, modParams string) error {
+	params := strings.Join(append(slices.Clone(p.conf.options[nameOf(modPath)]), modParams), " ")
+	p.opts.show("insmod %s %s", modPath, params)
+	if err := loadModule(modPath, strings.TrimSpace(params), p.opts); err != nil {
+		return err
+	}
+	p.deps[modPath].state = loaded
+	return nil
+}
+
+// install runs the install command of the module mod, with the options
+// of modprobe.d and modParams as $CMDLINE_OPTS.
+func (p *prober) install(mod, modParams string) error {
+	return p.runCommand("install", mod, p.conf.install[mod], modParams)
+}
+
+func (p *prober) runCommand(kind, mod, command, modParams string) error {
+	if p.opts.dryRun() {
+		p.opts.show("%s %s", kind, command)
+		return nil
+	}
+	params := strings.TrimSpace(strings.Join(append(slices.Clone(p.conf.options[mod]), modParams), " "))
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "MODPROBE_MODULE="+mod, "CMDLINE_OPTS="+params)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s command of %s: %w", kind, mod, err)
+	}
+	return nil
+}
+
+// nameOf returns the name of the module at modPath.
+func nameOf(modPath string) string {
+	name := path.Base(modPath)
+	for _, ext := range []string{".gz", ".xz", ".zst"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return modName(strings.TrimSuffix(name, ".ko"))
 }
 
 func checkBuiltin(moduleDir string, deps depMap) error {
@@ -167,14 +416,15 @@ func checkBuiltin(moduleDir string, deps depMap) error {
 	return scanner.Err()
 }
 
-func genDeps(opts ProbeOpts) (depMap, error) {
-	deps := make(depMap)
+// moduleDir returns the directory with the modules of the kernel release
+// of opts, or of the running kernel.
+func moduleDir(opts ProbeOpts) (string, error) {
 	rel := opts.KVer
 
 	if rel == "" {
 		var u unix.Utsname
 		if err := unix.Uname(&u); err != nil {
-			return nil, fmt.Errorf("could not get release (uname -r): %v", err)
+			return "", fmt.Errorf("could not get release (uname -r): %v", err)
 		}
 		rel = unix.ByteSliceToString(u.Release[:])
 	}
@@ -186,6 +436,15 @@ func genDeps(opts ProbeOpts) (depMap, error) {
 			break
 		}
 	}
+	return moduleDir, nil
+}
+
+func genDeps(opts ProbeOpts) (depMap, error) {
+	deps := make(depMap)
+	moduleDir, err := moduleDir(opts)
+	if err != nil {
+		return nil, err
+	}
 
 	f, err := os.Open(filepath.Join(moduleDir, "modules.dep"))
 	if err != nil {
@@ -218,7 +477,7 @@ func genDeps(opts ProbeOpts) (depMap, error) {
 	}
 
 	if !opts.IgnoreProcMods {
-		fm, err := os.Open("/proc/modules")
+		fm, err := os.Open(procModules)
 		if err == nil {
 			defer fm.Close()
 			genLoadedMods(fm, deps)
@@ -247,38 +506,11 @@ func findModPath(name string, m depMap) (string, error) {
 	return "", fmt.Errorf("could not find path for module %q", name)
 }
 
-func loadDeps(path string, m depMap, opts ProbeOpts) error {
-	dependency, ok := m[path]
-	if !ok {
-		return fmt.Errorf("could not find dependency %q", path)
-	}
-
-	if dependency.state == loading {
-		return fmt.Errorf("circular dependency! %q already LOADING", path)
-	} else if (dependency.state == loaded) || (dependency.state == builtin) {
-		return nil
-	}
-
-	m[path].state = loading
-
-	for _, dep := range dependency.deps {
-		if err := loadDeps(dep, m, opts); err != nil {
-			return err
-		}
-	}
-
-	// done with dependencies, load module
-	if err := loadModule(path, "", opts); err != nil {
-		return err
-	}
-	m[path].state = loaded
-
-	return nil
-}
-
 func loadModule(path, modParams string, opts ProbeOpts) error {
-	if opts.DryRunCB != nil {
-		opts.DryRunCB(path)
+	if opts.dryRun() {
+		if opts.DryRunCB != nil {
+			opts.DryRunCB(path)
+		}
 		return nil
 	}
 
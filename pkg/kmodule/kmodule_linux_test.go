@@ -6,7 +6,11 @@ package kmodule
 
 import (
 	"bytes"
+	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +36,231 @@ func TestGenLoadedMods(t *testing.T) {
 		}
 	}
 }
+
+var modulesAliasMock = `# Aliases extracted from modules themselves.
+alias pci:v00008086d000015B8sv*sd*bc*sc*i* e1000e
+alias pci:v00008086d*sv*sd*bc0Csc03i30* xhci_pci
+alias usb:v*p*d*dc*dsc*dp*ic03isc01ip01in* usbhid
+alias usb:v*p*d*dc*dsc*dp*ic03isc*ip*in* usbhid
+alias acpi*:PNP0C0C:* button
+`
+
+func TestAliasesLookup(t *testing.T) {
+	a, err := parseAliases(bytes.NewBufferString(modulesAliasMock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		modalias string
+		want     []string
+	}{
+		{"pci:v00008086d000015B8sv00001028sd000007A1bc02sc00i00", []string{"e1000e"}},
+		{"pci:v00008086d0000A36Dsv00001028sd0000085Abc0Csc03i30", []string{"xhci_pci"}},
+		{"usb:v046DpC52Bd1211dc00dsc00dp00ic03isc01ip01in00", []string{"usbhid"}},
+		{"acpi:PNP0C0C:", []string{"button"}},
+		{"pci:v000010DEd00001C82sv00001458sd00003755bc03sc00i00", nil},
+	} {
+		if got := a.Lookup(tt.modalias); !slices.Equal(got, tt.want) {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.modalias, got, tt.want)
+		}
+	}
+}
+
+// fakeRoot returns a root directory with modules of kernel 6.6.6 and
+// modprobe.d configuration.
+func fakeRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"lib/modules/6.6.6/modules.dep": `kernel/drivers/net/ethernet/intel/e1000e/e1000e.ko.xz: kernel/drivers/ptp/ptp.ko.xz kernel/drivers/pps/pps_core.ko.xz
+kernel/drivers/ptp/ptp.ko.xz: kernel/drivers/pps/pps_core.ko.xz
+kernel/drivers/pps/pps_core.ko.xz:
+kernel/drivers/hid/usbhid/usbhid.ko:
+kernel/drivers/hid/hid-generic.ko:
+kernel/drivers/gpu/drm/nouveau/nouveau.ko:
+kernel/drivers/usb/storage/usb-storage.ko:
+kernel/net/ipv6/ipv6.ko:
+`,
+		"lib/modules/6.6.6/modules.alias": modulesAliasMock + `alias pci:v000010DEd*sv*sd*bc03sc*i* nouveau
+alias usb:v*p*d*dc*dsc*dp*ic08isc06ip50in* usb_storage
+`,
+		"lib/modules/6.6.6/modules.builtin":         "kernel/drivers/usb/host/xhci-pci.ko\n",
+		"lib/modules/6.6.6/modules.builtin.modinfo": "ext4.description=Fourth Extended Filesystem\x00ext4.alias=fs-ext4\x00xhci_pci.license=GPL\x00",
+		"etc/modprobe.d/e1000e.conf": `# Comment.
+options e1000e InterruptThrottleRate=3000 \
+	SmartPowerDownEnable=1
+softdep usbhid pre: hid-generic post: no_such_module
+blacklist nouveau
+install usb-storage /sbin/modprobe --ignore-install usb-storage $CMDLINE_OPTS && echo loaded
+alias net-pf-10 ipv6
+remove ipv6 echo never
+install	st   echo st loaded
+`,
+		"lib/modprobe.d/e1000e.conf": "options e1000e hidden=1\n",
+		"lib/modprobe.d/pps.conf":    "options pps_core debug=1\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestProbeShowDepends(t *testing.T) {
+	root := fakeRoot(t)
+	mods := filepath.Join(root, "lib/modules/6.6.6/kernel")
+	for _, tt := range []struct {
+		name   string
+		params string
+		want   []string
+		err    bool
+	}{
+		{
+			name:   "e1000e",
+			params: "debug=16",
+			want: []string{
+				"insmod " + mods + "/drivers/pps/pps_core.ko.xz debug=1",
+				"insmod " + mods + "/drivers/ptp/ptp.ko.xz",
+				"insmod " + mods + "/drivers/net/ethernet/intel/e1000e/e1000e.ko.xz InterruptThrottleRate=3000 SmartPowerDownEnable=1 debug=16",
+			},
+		},
+		{
+			name: "pci:v00008086d000015B8sv00001028sd000007A1bc02sc00i00",
+			want: []string{
+				"insmod " + mods + "/drivers/pps/pps_core.ko.xz debug=1",
+				"insmod " + mods + "/drivers/ptp/ptp.ko.xz",
+				"insmod " + mods + "/drivers/net/ethernet/intel/e1000e/e1000e.ko.xz InterruptThrottleRate=3000 SmartPowerDownEnable=1",
+			},
+		},
+		{
+			name: "usbhid",
+			want: []string{
+				"insmod " + mods + "/drivers/hid/hid-generic.ko",
+				"insmod " + mods + "/drivers/hid/usbhid/usbhid.ko",
+			},
+		},
+		{
+			name: "usb:v0781p5567d0100dc00dsc00dp00ic08isc06ip50in00",
+			want: []string{"install /sbin/modprobe --ignore-install usb-storage $CMDLINE_OPTS && echo loaded"},
+		},
+		{
+			name: "net-pf-10",
+			want: []string{"insmod " + mods + "/net/ipv6/ipv6.ko"},
+		},
+		{
+			// The module name is also in "install".
+			name: "st",
+			want: []string{"install echo st loaded"},
+		},
+		{
+			name: "xhci-pci",
+			want: []string{"builtin xhci_pci"},
+		},
+		{
+			name: "pci:v00008086d0000A36Dsv00001028sd0000085Abc0Csc03i30",
+			want: []string{"builtin xhci_pci"},
+		},
+		{
+			name: "fs-ext4",
+			want: []string{"builtin ext4"},
+		},
+		{
+			name: "nouveau",
+			want: []string{"insmod " + mods + "/drivers/gpu/drm/nouveau/nouveau.ko"},
+		},
+		{
+			name: "pci:v000010DEd00001C82sv00001458sd00003755bc03sc00i00",
+			err:  true,
+		},
+		{
+			name: "no_such_module",
+			err:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := ProbeOptions(tt.name, tt.params, ProbeOpts{
+				RootDir:        root,
+				KVer:           "6.6.6",
+				IgnoreProcMods: true,
+				ShowDepends:    func(s string) { got = append(got, s) },
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("ProbeOptions = %v, want error %t", err, tt.err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ProbeOptions showed\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	root := fakeRoot(t)
+	mods := filepath.Join(root, "lib/modules/6.6.6/kernel")
+	procModules = filepath.Join(root, "proc_modules")
+	defer func() { procModules = "/proc/modules" }()
+	if err := os.WriteFile(procModules, []byte(`e1000e 352256 0 - Live 0x0000000000000000
+ptp 36864 1 e1000e, Live 0x0000000000000000
+pps_core 24576 2 e1000e,ptp, Live 0x0000000000000000
+usbhid 77824 1 - Live 0x0000000000000000
+ipv6 593920 30 [permanent], Live 0x0000000000000000
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		want []string
+		err  bool
+	}{
+		{
+			name: "e1000e",
+			want: []string{
+				"rmmod " + mods + "/drivers/net/ethernet/intel/e1000e/e1000e.ko.xz",
+				"rmmod " + mods + "/drivers/ptp/ptp.ko.xz",
+				"rmmod " + mods + "/drivers/pps/pps_core.ko.xz",
+			},
+		},
+		{
+			name: "ptp",
+			err:  true,
+		},
+		{
+			name: "usbhid",
+			err:  true,
+		},
+		{
+			name: "net-pf-10",
+			want: []string{"remove echo never"},
+		},
+		{
+			name: "xhci_pci",
+			err:  true,
+		},
+		{
+			name: "nouveau",
+			err:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := Remove(tt.name, ProbeOpts{
+				RootDir:     root,
+				KVer:        "6.6.6",
+				ShowDepends: func(s string) { got = append(got, s) },
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("Remove = %v, want error %t", err, tt.err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Remove showed\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kmodule
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// loadedModule is a module as /proc/modules lists it.
+type loadedModule struct {
+	refcnt int
+	users  []string
+}
+
+func parseProcModules(r io.Reader) (map[string]*loadedModule, error) {
+	mods := make(map[string]*loadedModule)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// name size refcnt users state address
+		f := strings.Fields(scanner.Text())
+		if len(f) < 4 {
+			continue
+		}
+		refcnt, err := strconv.Atoi(f[2])
+		if err != nil {
+			return nil, fmt.Errorf("bad reference count in %q: %v", scanner.Text(), err)
+		}
+		m := &loadedModule{refcnt: refcnt}
+		for _, u := range strings.Split(f[3], ",") {
+			if u != "" && u != "-" {
+				m.users = append(m.users, u)
+			}
+		}
+		mods[f[0]] = m
+	}
+	return mods, scanner.Err()
+}
+
+// Remove unloads the given kernel module, and then its dependencies that
+// nothing else uses anymore, like modprobe -r.
+//
+// name may be an alias like for ProbeOptions. Modules with a remove command
+// in modprobe.d are unloaded by running it instead, without their
+// dependencies.
+func Remove(name string, opts ProbeOpts) error {
+	p, err := newProber(opts)
+	if err != nil {
+		return err
+	}
+	mods, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(procModules)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	loaded, err := parseProcModules(f)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, mod := range mods {
+		errs = append(errs, p.remove(mod, loaded, true))
+	}
+	return errors.Join(errs...)
+}
+
+// remove unloads the module name and unwinds its dependencies. Modules that
+// are builtin, not loaded or in use are errors only if explicit.
+func (p *prober) remove(name string, loaded map[string]*loadedModule, explicit bool) error {
+	mod := modName(name)
+	if command, ok := p.conf.remove[mod]; ok {
+		return p.runCommand("remove", mod, command, "")
+	}
+
+	modPath, pathErr := findModPath(name, p.deps)
+	if p.modinfo.builtin[mod] || pathErr == nil && p.deps[modPath].state == builtin {
+		if explicit {
+			return fmt.Errorf("module %q is builtin", mod)
+		}
+		return nil
+	}
+	m, ok := loaded[mod]
+	if !ok {
+		if explicit {
+			return fmt.Errorf("module %q is not loaded", mod)
+		}
+		return nil
+	}
+	if m.refcnt > 0 {
+		if explicit {
+			return fmt.Errorf("module %q is in use by %v", mod, m.users)
+		}
+		return nil
+	}
+
+	if p.opts.dryRun() {
+		if pathErr != nil {
+			modPath = mod
+		}
+		if p.opts.DryRunCB != nil {
+			p.opts.DryRunCB(modPath)
+		}
+		p.opts.show("rmmod %s", modPath)
+	} else if err := Delete(mod, 0); err != nil {
+		return fmt.Errorf("could not remove module %q: %w", mod, err)
+	}
+	delete(loaded, mod)
+	for _, other := range loaded {
+		if i := slices.Index(other.users, mod); i >= 0 {
+			other.users = slices.Delete(other.users, i, i+1)
+			other.refcnt--
+		}
+	}
+
+	if pathErr != nil {
+		return nil
+	}
+	for _, d := range p.deps[modPath].deps {
+		if err := p.remove(nameOf(d), loaded, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
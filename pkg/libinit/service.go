@@ -0,0 +1,225 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/shlex"
+)
+
+// Restart policies of services.
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+var (
+	// ErrBadService is returned for services without a name or command,
+	// with an unknown restart policy, or with duplicate names.
+	ErrBadService = errors.New("bad service")
+	// ErrUnknownService is returned for services after unknown ones.
+	ErrUnknownService = errors.New("unknown service")
+	// ErrServiceCycle is returned for services that are after
+	// themselves.
+	ErrServiceCycle = errors.New("services are after each other")
+)
+
+// Service is a program that init starts, and restarts when it exits.
+type Service struct {
+	// Name identifies the service in logs and in After.
+	Name string `json:"name"`
+	// Cmd is the path of the program and its arguments.
+	Cmd []string `json:"cmd"`
+	// Env is added to the environment of init.
+	Env []string `json:"env,omitempty"`
+	// Dir is the working directory.
+	Dir string `json:"dir,omitempty"`
+	// TTY is the terminal, like ttyS0, that becomes the standard input,
+	// output, error and controlling terminal of the service. If empty,
+	// the service has no input, and writes to those of init.
+	TTY string `json:"tty,omitempty"`
+	// After are the services to start before this one. Oneshot
+	// services must have succeeded.
+	After []string `json:"after,omitempty"`
+	// Oneshot services, like dhclient -1, run to completion.
+	Oneshot bool `json:"oneshot,omitempty"`
+	// Restart is when to restart the service after it exits: "always",
+	// the default, "on-failure", the default of oneshot services, or
+	// "never".
+	Restart string `json:"restart,omitempty"`
+}
+
+func (s *Service) String() string {
+	return s.Name
+}
+
+// restart returns whether to restart the service after it exits.
+func (s *Service) restart(success bool) bool {
+	switch s.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return !success
+	case RestartNever:
+		return false
+	}
+	return !s.Oneshot || !success
+}
+
+// ServiceConfig is the service file of init, in JSON, like
+//
+//	{
+//	  "services": [
+//	    {"name": "dhclient", "cmd": ["/bbin/dhclient", "-1"], "oneshot": true},
+//	    {"name": "sshd", "cmd": ["/bbin/sshd"], "after": ["dhclient"]}
+//	  ]
+//	}
+type ServiceConfig struct {
+	Services []*Service `json:"services"`
+	// NoGetty turns off the gettys of the consoles of console=.
+	NoGetty bool `json:"no_getty,omitempty"`
+}
+
+// LoadServices reads the service file at path or, if it is a directory,
+// the services of its *.json files, one per file, in the order of their
+// names like those of /etc/init.d. The name of a service in a directory
+// defaults to that of its file.
+//
+// The services are checked, and put in the order to start them.
+func LoadServices(path string) (*ServiceConfig, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &ServiceConfig{}
+	if !fi.IsDir() {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		// Glob returns names in order.
+		files, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			s := &Service{Name: strings.TrimSuffix(filepath.Base(f), ".json")}
+			if err := json.Unmarshal(b, s); err != nil {
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			c.Services = append(c.Services, s)
+		}
+	}
+	if c.Services, err = OrderServices(c.Services); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// OrderServices checks services, and returns them in the order to start
+// them: each after those of its After, and otherwise in their order.
+func OrderServices(services []*Service) ([]*Service, error) {
+	byName := make(map[string]*Service, len(services))
+	for _, s := range services {
+		switch {
+		case s.Name == "":
+			return nil, fmt.Errorf("%w: service without a name", ErrBadService)
+		case len(s.Cmd) == 0:
+			return nil, fmt.Errorf("%w: %s has no command", ErrBadService, s)
+		case byName[s.Name] != nil:
+			return nil, fmt.Errorf("%w: two services are named %s", ErrBadService, s)
+		}
+		switch s.Restart {
+		case "", RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			return nil, fmt.Errorf("%w: %s has unknown restart policy %q", ErrBadService, s, s.Restart)
+		}
+		byName[s.Name] = s
+	}
+
+	ordered := make([]*Service, 0, len(services))
+	// A service is visiting while those after which it is are added.
+	visiting, added := map[*Service]bool{}, map[*Service]bool{}
+	var add func(s *Service) error
+	add = func(s *Service) error {
+		if added[s] {
+			return nil
+		}
+		if visiting[s] {
+			return fmt.Errorf("%w: %s", ErrServiceCycle, s)
+		}
+		visiting[s] = true
+		for _, name := range s.After {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("%w: %s is after %s", ErrUnknownService, s, name)
+			}
+			if err := add(dep); err != nil {
+				return err
+			}
+		}
+		added[s] = true
+		ordered = append(ordered, s)
+		return nil
+	}
+	for _, s := range services {
+		if err := add(s); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Consoles returns the terminals of the console= of the kernel command
+// line, like ttyS0 for console=ttyS0,115200n8, in order.
+func Consoles(cmdline string) []string {
+	var consoles []string
+	seen := map[string]bool{}
+	for _, arg := range shlex.Argv(cmdline) {
+		v, ok := strings.CutPrefix(arg, "console=")
+		if !ok {
+			continue
+		}
+		tty, _, _ := strings.Cut(v, ",")
+		tty = strings.TrimPrefix(tty, "/dev/")
+		// console=uart8250,io,0x3f8 and console=null have no terminal.
+		if tty == "" || tty == "null" || strings.HasPrefix(tty, "uart") || seen[tty] {
+			continue
+		}
+		seen[tty] = true
+		consoles = append(consoles, tty)
+	}
+	return consoles
+}
+
+// Gettys returns services that run cmd on each of consoles, like those of
+// Consoles.
+func Gettys(consoles []string, cmd ...string) []*Service {
+	var services []*Service
+	for _, tty := range consoles {
+		services = append(services, &Service{
+			Name:    "getty-" + tty,
+			Cmd:     cmd,
+			TTY:     tty,
+			Restart: RestartAlways,
+		})
+	}
+	return services
+}
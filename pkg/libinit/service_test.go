@@ -0,0 +1,215 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func names(services []*Service) []string {
+	var n []string
+	for _, s := range services {
+		n = append(n, s.Name)
+	}
+	return n
+}
+
+func TestOrderServices(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		services []*Service
+		want     []string
+		err      error
+	}{
+		{
+			name: "in order",
+			services: []*Service{
+				{Name: "a", Cmd: []string{"a"}},
+				{Name: "b", Cmd: []string{"b"}},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "after",
+			services: []*Service{
+				{Name: "agent", Cmd: []string{"agent"}, After: []string{"sshd", "dhclient"}},
+				{Name: "sshd", Cmd: []string{"sshd"}, After: []string{"dhclient"}},
+				{Name: "getty", Cmd: []string{"sh"}},
+				{Name: "dhclient", Cmd: []string{"dhclient"}, Oneshot: true},
+			},
+			want: []string{"dhclient", "sshd", "agent", "getty"},
+		},
+		{
+			name: "cycle",
+			services: []*Service{
+				{Name: "a", Cmd: []string{"a"}, After: []string{"b"}},
+				{Name: "b", Cmd: []string{"b"}, After: []string{"a"}},
+			},
+			err: ErrServiceCycle,
+		},
+		{
+			name: "unknown",
+			services: []*Service{
+				{Name: "a", Cmd: []string{"a"}, After: []string{"b"}},
+			},
+			err: ErrUnknownService,
+		},
+		{
+			name: "duplicate",
+			services: []*Service{
+				{Name: "a", Cmd: []string{"a"}},
+				{Name: "a", Cmd: []string{"b"}},
+			},
+			err: ErrBadService,
+		},
+		{
+			name:     "no name",
+			services: []*Service{{Cmd: []string{"a"}}},
+			err:      ErrBadService,
+		},
+		{
+			name:     "no command",
+			services: []*Service{{Name: "a"}},
+			err:      ErrBadService,
+		},
+		{
+			name:     "bad restart",
+			services: []*Service{{Name: "a", Cmd: []string{"a"}, Restart: "sometimes"}},
+			err:      ErrBadService,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OrderServices(tt.services)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("OrderServices() = %v, want %v", err, tt.err)
+			}
+			if diff := cmp.Diff(tt.want, names(got)); diff != "" {
+				t.Errorf("OrderServices() (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRestart(t *testing.T) {
+	for _, tt := range []struct {
+		s                Service
+		success, failure bool
+	}{
+		{s: Service{}, success: true, failure: true},
+		{s: Service{Oneshot: true}, success: false, failure: true},
+		{s: Service{Oneshot: true, Restart: RestartAlways}, success: true, failure: true},
+		{s: Service{Restart: RestartOnFailure}, success: false, failure: true},
+		{s: Service{Restart: RestartNever}, success: false, failure: false},
+	} {
+		if got := tt.s.restart(true); got != tt.success {
+			t.Errorf("%+v.restart(true) = %v, want %v", tt.s, got, tt.success)
+		}
+		if got := tt.s.restart(false); got != tt.failure {
+			t.Errorf("%+v.restart(false) = %v, want %v", tt.s, got, tt.failure)
+		}
+	}
+}
+
+func TestLoadServices(t *testing.T) {
+	d := t.TempDir()
+	file := filepath.Join(d, "init.json")
+	if err := os.WriteFile(file, []byte(`{
+	"services": [
+		{"name": "sshd", "cmd": ["/bbin/sshd"], "after": ["dhclient"]},
+		{"name": "dhclient", "cmd": ["/bbin/dhclient", "-1"], "oneshot": true}
+	],
+	"no_getty": true
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadServices(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ServiceConfig{
+		Services: []*Service{
+			{Name: "dhclient", Cmd: []string{"/bbin/dhclient", "-1"}, Oneshot: true},
+			{Name: "sshd", Cmd: []string{"/bbin/sshd"}, After: []string{"dhclient"}},
+		},
+		NoGetty: true,
+	}
+	if diff := cmp.Diff(want, c); diff != "" {
+		t.Errorf("LoadServices(%s) (-want, +got): %s", file, diff)
+	}
+
+	dir := filepath.Join(d, "init.d")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]string{
+		"10-dhclient.json": `{"name": "dhclient", "cmd": ["/bbin/dhclient", "-1"], "oneshot": true}`,
+		"20-agent.json":    `{"cmd": ["/bin/agent"], "after": ["sshd"], "restart": "on-failure"}`,
+		"30-sshd.json":     `{"name": "sshd", "cmd": ["/bbin/sshd"], "after": ["dhclient"]}`,
+		"README":           `not a service`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err = LoadServices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &ServiceConfig{
+		Services: []*Service{
+			{Name: "dhclient", Cmd: []string{"/bbin/dhclient", "-1"}, Oneshot: true},
+			{Name: "sshd", Cmd: []string{"/bbin/sshd"}, After: []string{"dhclient"}},
+			{Name: "20-agent", Cmd: []string{"/bin/agent"}, After: []string{"sshd"}, Restart: RestartOnFailure},
+		},
+	}
+	if diff := cmp.Diff(want, c); diff != "" {
+		t.Errorf("LoadServices(%s) (-want, +got): %s", dir, diff)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"services": [{"name": "a"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadServices(file); !errors.Is(err, ErrBadService) {
+		t.Errorf("LoadServices(%s) = %v, want %v", file, err, ErrBadService)
+	}
+	if _, err := LoadServices(filepath.Join(d, "none")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadServices(none) = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestConsoles(t *testing.T) {
+	for _, tt := range []struct {
+		cmdline string
+		want    []string
+	}{
+		{cmdline: "", want: nil},
+		{cmdline: "quiet root=/dev/sda1", want: nil},
+		{cmdline: "console=ttyS0,115200n8", want: []string{"ttyS0"}},
+		{
+			cmdline: "earlyprintk=ttyS0 console=tty0 console=/dev/ttyS0,115200n8 console=ttyS0 console=uart8250,io,0x3f8 console=null console=hvc0",
+			want:    []string{"tty0", "ttyS0", "hvc0"},
+		},
+	} {
+		if diff := cmp.Diff(tt.want, Consoles(tt.cmdline)); diff != "" {
+			t.Errorf("Consoles(%q) (-want, +got): %s", tt.cmdline, diff)
+		}
+	}
+}
+
+func TestGettys(t *testing.T) {
+	got := Gettys([]string{"tty0", "ttyS0"}, "/bin/sh", "-l")
+	want := []*Service{
+		{Name: "getty-tty0", Cmd: []string{"/bin/sh", "-l"}, TTY: "tty0", Restart: RestartAlways},
+		{Name: "getty-ttyS0", Cmd: []string{"/bin/sh", "-l"}, TTY: "ttyS0", Restart: RestartAlways},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Gettys() (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultStopTimeout is how long services get to exit after SIGTERM,
+	// before SIGKILL.
+	DefaultStopTimeout = 10 * time.Second
+	// stableTime is how long a service must run for its backoff to
+	// reset.
+	stableTime = 10 * time.Second
+)
+
+// forwardedSignals are forwarded to all services.
+var forwardedSignals = []os.Signal{unix.SIGHUP, unix.SIGUSR1, unix.SIGUSR2}
+
+// Supervisor starts services in order, restarts them when they exit, and
+// stops them in reverse order on SIGTERM or SIGPWR.
+type Supervisor struct {
+	Services []*Service
+	// StopTimeout is how long services get to exit after SIGTERM. If
+	// zero, it is DefaultStopTimeout.
+	StopTimeout time.Duration
+	// NewBackOff returns the backoff of restarting a service. If nil,
+	// it is exponential from 500ms up to a minute, like that of the
+	// backoff command without a timeout.
+	NewBackOff func() backoff.BackOff
+	// Debug logs what the supervisor does, if not nil.
+	Debug func(string, ...interface{})
+}
+
+// service is the state of a Service.
+type service struct {
+	*Service
+	cmd     *exec.Cmd
+	started time.Time
+	back    backoff.BackOff
+	timer   *time.Timer
+
+	// ran is set once the service started, and succeeded once a oneshot
+	// service exited with 0.
+	ran       bool
+	succeeded bool
+	// pending is set until the service first starts.
+	pending bool
+}
+
+// supervisor is the state of a run of Supervisor.
+type supervisor struct {
+	*Supervisor
+	services []*service
+	byPID    map[int]*service
+	restarts chan *service
+	stopping bool
+}
+
+func defaultBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = time.Minute
+	b.MaxElapsedTime = 0
+	return b
+}
+
+// Run starts the services, and supervises them until SIGTERM or SIGPWR,
+// which it returns after stopping the services. It forwards SIGHUP,
+// SIGUSR1 and SIGUSR2 to them, and reaps all children, as init must.
+func (s *Supervisor) Run() (os.Signal, error) {
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs, append(forwardedSignals, unix.SIGCHLD, unix.SIGTERM, unix.SIGPWR)...)
+	defer signal.Stop(sigs)
+	return s.run(sigs)
+}
+
+func (s *Supervisor) run(sigs <-chan os.Signal) (os.Signal, error) {
+	ordered, err := OrderServices(s.Services)
+	if err != nil {
+		return nil, err
+	}
+	sv := &supervisor{
+		Supervisor: s,
+		byPID:      map[int]*service{},
+		restarts:   make(chan *service, len(ordered)),
+	}
+	for _, svc := range ordered {
+		back := defaultBackOff()
+		if s.NewBackOff != nil {
+			back = s.NewBackOff()
+		}
+		sv.services = append(sv.services, &service{Service: svc, back: back, pending: true})
+	}
+
+	sv.startReady()
+	for {
+		select {
+		case sig := <-sigs:
+			switch sig {
+			case unix.SIGCHLD:
+				sv.reap()
+			case unix.SIGTERM, unix.SIGPWR:
+				log.Printf("Got %v, stopping services", sig)
+				sv.stop(sigs)
+				return sig, nil
+			default:
+				sv.forward(sig)
+			}
+		case svc := <-sv.restarts:
+			sv.start(svc)
+			sv.startReady()
+		}
+	}
+}
+
+func (s *supervisor) debug(format string, v ...interface{}) {
+	if s.Debug != nil {
+		s.Debug(format, v...)
+	}
+}
+
+// ready returns whether the services after svc may start.
+func (svc *service) ready() bool {
+	if svc.Oneshot {
+		return svc.succeeded
+	}
+	return svc.ran
+}
+
+// startReady starts the pending services whose After are ready.
+func (s *supervisor) startReady() {
+	byName := map[string]*service{}
+	for _, svc := range s.services {
+		byName[svc.Name] = svc
+	}
+	// The services are in order, so one pass starts all that can.
+	for _, svc := range s.services {
+		if !svc.pending {
+			continue
+		}
+		ready := true
+		for _, name := range svc.After {
+			ready = ready && byName[name].ready()
+		}
+		if ready {
+			svc.pending = false
+			s.start(svc)
+		}
+	}
+}
+
+func (s *supervisor) start(svc *service) {
+	cmd := exec.Command(svc.Cmd[0], svc.Cmd[1:]...)
+	cmd.Env = append(os.Environ(), svc.Env...)
+	cmd.Dir = svc.Dir
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// Services get their own session, to stop them with their children.
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
+	if svc.TTY != "" {
+		tty, err := os.OpenFile(filepath.Join("/dev", svc.TTY), os.O_RDWR, 0)
+		if err != nil {
+			log.Printf("Error opening the terminal of service %s: %v", svc, err)
+			s.exited(svc, false)
+			return
+		}
+		defer tty.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+		cmd.SysProcAttr.Setctty = true
+	}
+
+	s.debug("Starting service %s: %q", svc, svc.Cmd)
+	svc.ran = true
+	svc.started = time.Now()
+	if err := cmd.Start(); err != nil {
+		log.Printf("Error starting service %s: %v", svc, err)
+		s.exited(svc, false)
+		return
+	}
+	svc.cmd = cmd
+	s.byPID[cmd.Process.Pid] = svc
+}
+
+// reap reaps all exited children, services or orphans.
+func (s *supervisor) reap() {
+	for {
+		var ws unix.WaitStatus
+		pid, err := unix.Wait4(-1, &ws, unix.WNOHANG, nil)
+		if pid <= 0 || err != nil {
+			return
+		}
+		svc, ok := s.byPID[pid]
+		if !ok {
+			s.debug("Reaped PID %d, exit status %d", pid, ws.ExitStatus())
+			continue
+		}
+		delete(s.byPID, pid)
+		svc.cmd.Process.Release()
+		svc.cmd = nil
+		success := ws.Exited() && ws.ExitStatus() == 0
+		if ws.Signaled() {
+			log.Printf("Service %s was killed by %v", svc, ws.Signal())
+		} else {
+			log.Printf("Service %s exited with status %d", svc, ws.ExitStatus())
+		}
+		s.exited(svc, success)
+	}
+}
+
+// exited restarts svc, if it should be, after it exited or failed to
+// start.
+func (s *supervisor) exited(svc *service, success bool) {
+	if s.stopping {
+		return
+	}
+	if svc.Oneshot && success {
+		svc.succeeded = true
+		defer s.startReady()
+	}
+	if !svc.restart(success) {
+		return
+	}
+	if time.Since(svc.started) >= stableTime {
+		svc.back.Reset()
+	}
+	d := svc.back.NextBackOff()
+	if d == backoff.Stop {
+		log.Printf("Service %s failed too many times, not restarting it", svc)
+		return
+	}
+	s.debug("Restarting service %s in %v", svc, d)
+	svc.timer = time.AfterFunc(d, func() {
+		s.restarts <- svc
+	})
+}
+
+func (s *supervisor) forward(sig os.Signal) {
+	for _, svc := range s.services {
+		if svc.cmd != nil {
+			s.debug("Forwarding %v to service %s", sig, svc)
+			svc.cmd.Process.Signal(sig)
+		}
+	}
+}
+
+// stop stops the services in reverse order.
+func (s *supervisor) stop(sigs <-chan os.Signal) {
+	s.stopping = true
+	timeout := s.StopTimeout
+	if timeout == 0 {
+		timeout = DefaultStopTimeout
+	}
+	for i := len(s.services) - 1; i >= 0; i-- {
+		svc := s.services[i]
+		if svc.timer != nil {
+			svc.timer.Stop()
+		}
+		if svc.cmd == nil {
+			continue
+		}
+		log.Printf("Stopping service %s", svc)
+		pid := svc.cmd.Process.Pid
+		if svc.TTY != "" {
+			// Interactive shells ignore SIGTERM.
+			unix.Kill(-pid, unix.SIGHUP)
+		}
+		unix.Kill(-pid, unix.SIGTERM)
+		deadline := time.NewTimer(timeout)
+		for svc.cmd != nil {
+			select {
+			case sig := <-sigs:
+				if sig == unix.SIGCHLD {
+					s.reap()
+				}
+			case <-deadline.C:
+				log.Printf("Service %s did not stop in %v, killing it", svc, timeout)
+				unix.Kill(-pid, unix.SIGKILL)
+			}
+		}
+		deadline.Stop()
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/sys/unix"
+)
+
+// supervise runs s until the returned function sends it sig.
+func supervise(t *testing.T, s *Supervisor) func(sig os.Signal) {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skipf("no shell: %v", err)
+	}
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs, unix.SIGCHLD)
+	type result struct {
+		sig os.Signal
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		sig, err := s.run(sigs)
+		done <- result{sig, err}
+	}()
+	return func(sig os.Signal) {
+		t.Helper()
+		sigs <- sig
+		if sig != unix.SIGTERM && sig != unix.SIGPWR {
+			return
+		}
+		defer signal.Stop(sigs)
+		select {
+		case r := <-done:
+			if r.err != nil || r.sig != sig {
+				t.Errorf("run() = %v, %v, want %v, nil", r.sig, r.err, sig)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("run() did not return after %v", sig)
+		}
+	}
+}
+
+func shell(script string) []string {
+	return []string{"/bin/sh", "-c", script}
+}
+
+// waitLog waits for the log file to be want.
+func waitLog(t *testing.T, file, want string) {
+	t.Helper()
+	var got []byte
+	for i := 0; i < 1000; i++ {
+		got, _ = os.ReadFile(file)
+		if string(got) == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("log = %q, want %q", got, want)
+}
+
+func TestSuperviseOrder(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	stop := supervise(t, &Supervisor{
+		Services: []*Service{
+			{Name: "sshd", Cmd: shell("echo sshd >> " + log + "; exec sleep 100"), After: []string{"dhclient"}},
+			{Name: "dhclient", Cmd: shell("sleep 0.2; echo dhclient >> " + log), Oneshot: true},
+		},
+	})
+	waitLog(t, log, "dhclient\nsshd\n")
+	stop(unix.SIGTERM)
+}
+
+func TestSuperviseRestart(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	stop := supervise(t, &Supervisor{
+		Services: []*Service{
+			{Name: "agent", Cmd: shell("echo agent >> " + log + "; exit 1")},
+			{Name: "once", Cmd: shell("echo once >> " + log + ".once"), Oneshot: true},
+		},
+		NewBackOff: func() backoff.BackOff {
+			return backoff.WithMaxRetries(backoff.NewConstantBackOff(10*time.Millisecond), 3)
+		},
+	})
+	waitLog(t, log, strings.Repeat("agent\n", 4))
+	waitLog(t, log+".once", "once\n")
+	// It does not restart after 3 retries, or after success.
+	time.Sleep(100 * time.Millisecond)
+	waitLog(t, log, strings.Repeat("agent\n", 4))
+	waitLog(t, log+".once", "once\n")
+	stop(unix.SIGTERM)
+}
+
+func TestSuperviseForward(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	stop := supervise(t, &Supervisor{
+		Services: []*Service{
+			{Name: "agent", Cmd: shell("trap 'echo usr1 >> " + log + "' USR1; echo up >> " + log + "; while :; do sleep 0.01; done")},
+		},
+	})
+	waitLog(t, log, "up\n")
+	stop(unix.SIGUSR1)
+	waitLog(t, log, "up\nusr1\n")
+	stop(unix.SIGTERM)
+}
+
+func TestSuperviseStop(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	var services []*Service
+	for _, name := range []string{"a", "b", "c"} {
+		services = append(services, &Service{
+			Name: name,
+			Cmd:  shell("trap 'echo " + name + " >> " + log + "; exit 0' TERM; touch " + filepath.Join(dir, name) + "; while :; do sleep 0.01; done"),
+		})
+	}
+	// stuck ignores SIGTERM, and is killed.
+	services = append(services, &Service{Name: "stuck", Cmd: shell("trap '' TERM; touch " + filepath.Join(dir, "stuck") + "; while :; do sleep 0.01; done")})
+	stop := supervise(t, &Supervisor{Services: services, StopTimeout: 100 * time.Millisecond})
+	for _, s := range services {
+		for i := 0; ; i++ {
+			if _, err := os.Stat(filepath.Join(dir, s.Name)); err == nil {
+				break
+			}
+			if i == 1000 {
+				t.Fatalf("service %s did not start", s)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	stop(unix.SIGPWR)
+	waitLog(t, log, "c\nb\na\n")
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rekby/gpt"
+	"golang.org/x/sys/unix"
+)
+
+// FSUUID returns the UUID of the vfat, ext4 or xfs file system on the
+// device or image file at devpath.
+func FSUUID(devpath string) (string, error) {
+	return getFSUUID(devpath)
+}
+
+// Offsets and sizes of the volume labels of the file systems getFSUUID
+// knows.
+const (
+	ext2SprblkLabelOff  = 120
+	ext2SprblkLabelSize = 16
+
+	fat16LabelOff  = 0x2b
+	fat32LabelOff  = 0x47
+	fatLabelSize   = 11
+	fatLabelNoName = "NO NAME"
+
+	xfsLabelOff  = 108
+	xfsLabelSize = 12
+)
+
+// FSLabel returns the volume label of the vfat, ext4 or xfs file system on
+// the device or image file at devpath.
+//
+// A file system without label has an empty label.
+func FSLabel(devpath string) (string, error) {
+	file, err := os.Open(devpath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	for _, fs := range []struct {
+		try  func(io.ReaderAt) (string, error)
+		off  int64
+		size int
+	}{
+		{tryFAT32, fat32LabelOff, fatLabelSize},
+		{tryFAT16, fat16LabelOff, fatLabelSize},
+		{tryEXT4, ext2SprblkOff + ext2SprblkLabelOff, ext2SprblkLabelSize},
+		{tryXFS, xfsLabelOff, xfsLabelSize},
+	} {
+		if _, err := fs.try(file); err == nil {
+			return readLabel(file, fs.off, fs.size)
+		}
+	}
+	return "", fmt.Errorf("unknown label (not vfat, ext4, nor xfs)")
+}
+
+func readLabel(file io.ReaderAt, off int64, size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := file.ReadAt(b, off); err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	label := strings.TrimRight(string(b), " ")
+	if label == fatLabelNoName && size == fatLabelSize {
+		return "", nil
+	}
+	return label, nil
+}
+
+// Offsets of the MBR disk signature and boot signature.
+const (
+	mbrDiskSigOff = 440
+	mbrBootSigOff = 510
+	mbrBootSig    = 0xaa55
+)
+
+// PartUUID returns the partition UUID of partition partNo, counting from 1,
+// of the disk or image file at diskpath, like the kernel's PARTUUID= root
+// option expects it.
+//
+// For GPT disks it is the unique partition GUID; for MBR disks it is the
+// disk signature and partition number, like "1234abcd-02".
+func PartUUID(diskpath string, partNo int) (string, error) {
+	file, err := os.Open(diskpath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Image files have no logical block size.
+	blkSize := 512
+	if s, err := unix.IoctlGetInt(int(file.Fd()), unix.BLKSSZGET); err == nil {
+		blkSize = s
+	}
+
+	if _, err := file.Seek(int64(blkSize), io.SeekStart); err != nil {
+		return "", err
+	}
+	if table, err := gpt.ReadTable(file, uint64(blkSize)); err == nil {
+		if partNo < 1 || partNo > len(table.Partitions) || table.Partitions[partNo-1].IsEmpty() {
+			return "", fmt.Errorf("%s has no GPT partition %d", diskpath, partNo)
+		}
+		return strings.ToLower(table.Partitions[partNo-1].Id.String()), nil
+	}
+
+	b := make([]byte, 2)
+	if _, err := file.ReadAt(b, mbrBootSigOff); err != nil {
+		return "", err
+	}
+	if binary.LittleEndian.Uint16(b) != mbrBootSig {
+		return "", fmt.Errorf("%s has neither GPT nor MBR partition table", diskpath)
+	}
+	b = make([]byte, 4)
+	if _, err := file.ReadAt(b, mbrDiskSigOff); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x-%02x", binary.LittleEndian.Uint32(b), partNo), nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeImage(t *testing.T, fill func(b []byte)) string {
+	t.Helper()
+	b := make([]byte, 4096)
+	fill(b)
+	p := filepath.Join(t.TempDir(), "img")
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFSLabel(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		fill  func(b []byte)
+		uuid  string
+		label string
+	}{
+		{
+			name: "ext4",
+			fill: func(b []byte) {
+				binary.LittleEndian.PutUint16(b[ext2SprblkOff+ext2SprblkMagicOff:], ext2SprblkMagic)
+				copy(b[ext2SprblkOff+ext2SprblkUUIDOff:], []byte{0x02, 0x17, 0x59, 0x89, 0xd4, 0x9f, 0x4e, 0x8e, 0x83, 0x6e, 0x99, 0x30, 0x0a, 0xf6, 0x6f, 0xc1})
+				copy(b[ext2SprblkOff+ext2SprblkLabelOff:], "rootfs")
+			},
+			uuid:  "02175989-d49f-4e8e-836e-99300af66fc1",
+			label: "rootfs",
+		},
+		{
+			name: "fat32",
+			fill: func(b []byte) {
+				copy(b[fat32MagicOff:], fat32Magic)
+				copy(b[fat32IDOff:], []byte{0xef, 0xbe, 0xad, 0xde})
+				copy(b[fat32LabelOff:], "EFI        ")
+			},
+			uuid:  "dead-beef",
+			label: "EFI",
+		},
+		{
+			name: "fat16 without label",
+			fill: func(b []byte) {
+				copy(b[fat16MagicOff:], fat16Magic)
+				copy(b[fat16LabelOff:], "NO NAME    ")
+			},
+			uuid: "0000-0000",
+		},
+		{
+			name: "xfs",
+			fill: func(b []byte) {
+				copy(b, xfsMagic)
+				copy(b[xfsLabelOff:], "home")
+			},
+			uuid:  "00000000-0000-0000-0000-000000000000",
+			label: "home",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := writeImage(t, tt.fill)
+			if uuid, err := FSUUID(p); err != nil || uuid != tt.uuid {
+				t.Errorf("FSUUID = %q, %v, want %q", uuid, err, tt.uuid)
+			}
+			if label, err := FSLabel(p); err != nil || label != tt.label {
+				t.Errorf("FSLabel = %q, %v, want %q", label, err, tt.label)
+			}
+		})
+	}
+
+	if _, err := FSLabel(writeImage(t, func([]byte) {})); err == nil {
+		t.Errorf("FSLabel of an empty image succeeded")
+	}
+}
+
+func TestPartUUID(t *testing.T) {
+	mbr := writeImage(t, func(b []byte) {
+		binary.LittleEndian.PutUint32(b[mbrDiskSigOff:], 0x1234abcd)
+		binary.LittleEndian.PutUint16(b[mbrBootSigOff:], mbrBootSig)
+	})
+	for _, tt := range []struct {
+		disk   string
+		partNo int
+		want   string
+		err    bool
+	}{
+		{disk: mbr, partNo: 2, want: "1234abcd-02"},
+		{disk: "testdata/gptdisk_label", partNo: 1, want: "1e62d13e-9600-40d2-b0f1-946893f399fb"},
+		{disk: "testdata/gptdisk_label", partNo: 2, want: "53adc1b3-ce89-4b44-9460-8a1d7667b2bf"},
+		{disk: "testdata/gptdisk_label", partNo: 3, err: true},
+		{disk: writeImage(t, func([]byte) {}), partNo: 1, err: true},
+	} {
+		got, err := PartUUID(tt.disk, tt.partNo)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("PartUUID(%s, %d) = %q, %v, want %q", tt.disk, tt.partNo, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dm creates and manages Linux device-mapper devices.
+//
+// It talks to the kernel through the ioctl interface on /dev/mapper/control,
+// the same way dmsetup does. Because u-root has no udev, device nodes under
+// /dev/mapper are created by this package.
+package dm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/ubinary"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// MapperDir is where device nodes for mapped devices are created.
+	MapperDir = "/dev/mapper"
+
+	// ControlPath is the device-mapper control device.
+	ControlPath = "/dev/mapper/control"
+
+	// Debug function to override for verbose logging.
+	Debug = func(string, ...interface{}) {}
+)
+
+// initialBufferSize is the size of the result area passed to the kernel.
+// It is grown when the kernel sets DM_BUFFER_FULL_FLAG.
+const initialBufferSize = 16 << 10
+
+// Device is an active device-mapper device.
+//
+// Device implements mount.Mounter.
+type Device struct {
+	// Name is the device-mapper name, i.e. the name in /dev/mapper.
+	Name string
+	// UUID is the optional device-mapper UUID.
+	UUID string
+	// Dev is the device number.
+	Dev uint64
+
+	// FSType is the file system to use when mounting the device.
+	FSType string
+	// Data is the data to pass to mount(2).
+	Data string
+}
+
+var _ mount.Mounter = &Device{}
+
+// DevName implements mount.Mounter.
+func (d *Device) DevName() string {
+	return filepath.Join(MapperDir, d.Name)
+}
+
+// Mount implements mount.Mounter.
+func (d *Device) Mount(path string, flags uintptr, opts ...func() error) (*mount.MountPoint, error) {
+	if d.FSType == "" {
+		return mount.TryMount(d.DevName(), path, d.Data, flags, opts...)
+	}
+	return mount.Mount(d.DevName(), path, d.FSType, d.Data, flags, opts...)
+}
+
+// Remove removes the device and its node.
+func (d *Device) Remove() error {
+	return Remove(d.Name)
+}
+
+// String implements fmt.Stringer.
+func (d *Device) String() string {
+	return fmt.Sprintf("dm.Device(name=%s, uuid=%s, dev=%d:%d)", d.Name, d.UUID, unix.Major(d.Dev), unix.Minor(d.Dev))
+}
+
+// New creates a device called name, loads t into it and activates it.
+//
+// On failure, the partially created device is removed again.
+func New(name, uuid string, t Table, readOnly bool) (*Device, error) {
+	if _, err := CreateDevice(name, uuid); err != nil {
+		return nil, err
+	}
+	if err := LoadTable(name, t, readOnly); err != nil {
+		RemoveDevice(name)
+		return nil, err
+	}
+	dev, err := Resume(name)
+	if err != nil {
+		RemoveDevice(name)
+		return nil, err
+	}
+	if err := mknod(name, dev); err != nil {
+		RemoveDevice(name)
+		return nil, err
+	}
+	return &Device{Name: name, UUID: uuid, Dev: dev}, nil
+}
+
+// Remove removes the device called name and its node in MapperDir.
+func Remove(name string) error {
+	if err := RemoveDevice(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(MapperDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Version returns the version of the kernel's device-mapper ioctl interface.
+func Version() ([3]uint32, error) {
+	r, err := call(unix.DM_VERSION, newRequest("", "", 0), 0)
+	if err != nil {
+		return [3]uint32{}, err
+	}
+	return r.hdr.Version, nil
+}
+
+// CreateDevice creates a new, empty device and returns its device number.
+func CreateDevice(name, uuid string) (uint64, error) {
+	r, err := call(unix.DM_DEV_CREATE, newRequest(name, uuid, 0), 0)
+	if err != nil {
+		return 0, fmt.Errorf("creating %q: %w", name, err)
+	}
+	return r.hdr.Dev, nil
+}
+
+// LoadTable loads t into the inactive table slot of the device. It takes
+// effect on the next Resume.
+func LoadTable(name string, t Table, readOnly bool) error {
+	var flags uint32
+	if readOnly {
+		flags |= unix.DM_READONLY_FLAG
+	}
+	data, err := marshalTable(t)
+	if err != nil {
+		return err
+	}
+	req := newRequest(name, "", flags)
+	req.hdr.Target_count = uint32(len(t))
+	req.data = data
+	if _, err := call(unix.DM_TABLE_LOAD, req, 0); err != nil {
+		return fmt.Errorf("loading table into %q: %w", name, err)
+	}
+	return nil
+}
+
+// Resume activates the inactive table, if any, and resumes I/O. It returns
+// the device number.
+func Resume(name string) (uint64, error) {
+	r, err := call(unix.DM_DEV_SUSPEND, newRequest(name, "", 0), 0)
+	if err != nil {
+		return 0, fmt.Errorf("resuming %q: %w", name, err)
+	}
+	return r.hdr.Dev, nil
+}
+
+// Suspend suspends I/O to the device.
+func Suspend(name string) error {
+	if _, err := call(unix.DM_DEV_SUSPEND, newRequest(name, "", unix.DM_SUSPEND_FLAG), 0); err != nil {
+		return fmt.Errorf("suspending %q: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveDevice removes the device from the kernel. It does not touch the
+// device node; see Remove.
+func RemoveDevice(name string) error {
+	if _, err := call(unix.DM_DEV_REMOVE, newRequest(name, "", 0), 0); err != nil {
+		return fmt.Errorf("removing %q: %w", name, err)
+	}
+	return nil
+}
+
+// Status returns the status line of each target of the active table.
+func Status(name string) (Table, error) {
+	return tableStatus(name, 0)
+}
+
+// GetTable returns the active table of the device.
+func GetTable(name string) (Table, error) {
+	return tableStatus(name, unix.DM_STATUS_TABLE_FLAG)
+}
+
+func tableStatus(name string, flags uint32) (Table, error) {
+	r, err := call(unix.DM_TABLE_STATUS, newRequest(name, "", flags), initialBufferSize)
+	if err != nil {
+		return nil, fmt.Errorf("status of %q: %w", name, err)
+	}
+	return unmarshalTable(r.data, r.hdr.Target_count)
+}
+
+// List returns the names of all device-mapper devices.
+func List() ([]string, error) {
+	r, err := call(unix.DM_LIST_DEVICES, newRequest("", "", 0), initialBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return parseNameList(r.data)
+}
+
+// parseNameList parses a sequence of struct dm_name_list.
+func parseNameList(data []byte) ([]string, error) {
+	// struct dm_name_list { __u64 dev; __u32 next; char name[]; }
+	const nameOffset = 12
+	var names []string
+	for off := 0; ; {
+		if off+nameOffset > len(data) {
+			return nil, ErrShortBuffer
+		}
+		e := data[off:]
+		if ubinary.NativeEndian.Uint64(e) == 0 {
+			// No devices.
+			return names, nil
+		}
+		names = append(names, cstring(e[nameOffset:]))
+		next := ubinary.NativeEndian.Uint32(e[8:])
+		if next == 0 {
+			return names, nil
+		}
+		off += int(next)
+	}
+}
+
+// call issues a device-mapper ioctl, growing the result buffer as needed.
+func call(cmd uint, req *request, extra int) (*request, error) {
+	f, err := openControl()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	for {
+		b := req.marshal(extra)
+		Debug("dm: ioctl %#x on %q, %d bytes", cmd, cstring(req.hdr.Name[:]), len(b))
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), uintptr(cmd), uintptr(unsafe.Pointer(&b[0]))); errno != 0 {
+			return nil, os.NewSyscallError("ioctl", errno)
+		}
+		var hdr unix.DmIoctl
+		if err := binary.Read(bytes.NewReader(b), ubinary.NativeEndian, &hdr); err != nil {
+			return nil, err
+		}
+		if hdr.Flags&unix.DM_BUFFER_FULL_FLAG != 0 {
+			extra = 2*extra + initialBufferSize
+			continue
+		}
+		return unmarshal(b)
+	}
+}
+
+func openControl() (*os.File, error) {
+	f, err := os.OpenFile(ControlPath, os.O_RDWR, 0)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return f, err
+	}
+	// No udev or devtmpfs entry. Find the misc minor and make the node.
+	minor, err := miscMinor("device-mapper")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(ControlPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := unix.Mknod(ControlPath, unix.S_IFCHR|0o600, int(unix.Mkdev(10, minor))); err != nil {
+		return nil, &os.PathError{Op: "mknod", Path: ControlPath, Err: err}
+	}
+	return os.OpenFile(ControlPath, os.O_RDWR, 0)
+}
+
+// miscMinor finds the minor number of a misc device in /proc/misc.
+func miscMinor(name string) (uint32, error) {
+	f, err := os.Open("/proc/misc")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[1] == name {
+			m, err := strconv.ParseUint(fields[0], 10, 32)
+			return uint32(m), err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s: %w (is CONFIG_BLK_DEV_DM enabled?)", name, os.ErrNotExist)
+}
+
+// mknod creates MapperDir/name for dev, replacing a stale node.
+func mknod(name string, dev uint64) error {
+	if err := os.MkdirAll(MapperDir, 0o755); err != nil {
+		return err
+	}
+	p := filepath.Join(MapperDir, name)
+	var st unix.Stat_t
+	if err := unix.Stat(p, &st); err == nil {
+		if st.Mode&unix.S_IFMT == unix.S_IFBLK && uint64(st.Rdev) == dev {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	if err := unix.Mknod(p, unix.S_IFBLK|0o600, int(dev)); err != nil {
+		return &os.PathError{Op: "mknod", Path: p, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/u-root/u-root/pkg/ubinary"
+	"golang.org/x/sys/unix"
+)
+
+// ErrShortBuffer is returned when the kernel hands back a truncated result.
+var ErrShortBuffer = errors.New("device-mapper result buffer is truncated")
+
+// request is a device-mapper ioctl payload: the dm_ioctl header followed by
+// command specific data.
+type request struct {
+	hdr  unix.DmIoctl
+	data []byte
+}
+
+func newRequest(name, uuid string, flags uint32) *request {
+	r := &request{}
+	r.hdr.Version = [3]uint32{unix.DM_VERSION_MAJOR, 0, 0}
+	r.hdr.Flags = flags
+	copy(r.hdr.Name[:len(r.hdr.Name)-1], name)
+	copy(r.hdr.Uuid[:len(r.hdr.Uuid)-1], uuid)
+	return r
+}
+
+// marshal serializes the request. Extra zeroed space is appended so the
+// kernel has room to return data.
+func (r *request) marshal(extra int) []byte {
+	r.hdr.Data_start = unix.SizeofDmIoctl
+	r.hdr.Data_size = uint32(unix.SizeofDmIoctl + len(r.data) + extra)
+	var b bytes.Buffer
+	binary.Write(&b, ubinary.NativeEndian, &r.hdr)
+	b.Write(r.data)
+	b.Write(make([]byte, extra))
+	return b.Bytes()
+}
+
+// unmarshal parses the kernel's response to a request.
+func unmarshal(b []byte) (*request, error) {
+	if len(b) < unix.SizeofDmIoctl {
+		return nil, ErrShortBuffer
+	}
+	r := &request{}
+	if err := binary.Read(bytes.NewReader(b), ubinary.NativeEndian, &r.hdr); err != nil {
+		return nil, err
+	}
+	if int(r.hdr.Data_start) > len(b) || int(r.hdr.Data_size) > len(b) {
+		return nil, ErrShortBuffer
+	}
+	if r.hdr.Data_size > r.hdr.Data_start {
+		r.data = b[r.hdr.Data_start:r.hdr.Data_size]
+	}
+	return r, nil
+}
+
+// marshalTable encodes a table as a sequence of dm_target_spec structures,
+// each followed by its NUL terminated, 8-byte aligned parameter string.
+func marshalTable(t Table) ([]byte, error) {
+	var b bytes.Buffer
+	for _, e := range t {
+		typ := e.Target.Type()
+		if len(typ) >= unix.DM_MAX_TYPE_NAME {
+			return nil, fmt.Errorf("target type %q is too long", typ)
+		}
+		params := append([]byte(e.Target.Params()), 0)
+		if pad := len(params) % 8; pad != 0 {
+			params = append(params, make([]byte, 8-pad)...)
+		}
+		spec := unix.DmTargetSpec{
+			Sector_start: e.Start,
+			Length:       e.Length,
+			Next:         uint32(unix.SizeofDmTargetSpec + len(params)),
+		}
+		copy(spec.Target_type[:], typ)
+		binary.Write(&b, ubinary.NativeEndian, &spec)
+		b.Write(params)
+	}
+	return b.Bytes(), nil
+}
+
+// unmarshalTable decodes count target specs as returned by DM_TABLE_STATUS.
+// Unlike on load, Next is relative to the start of data.
+func unmarshalTable(data []byte, count uint32) (Table, error) {
+	var t Table
+	var off uint32
+	for i := uint32(0); i < count; i++ {
+		if int(off)+unix.SizeofDmTargetSpec > len(data) {
+			return nil, ErrShortBuffer
+		}
+		var spec unix.DmTargetSpec
+		if err := binary.Read(bytes.NewReader(data[off:]), ubinary.NativeEndian, &spec); err != nil {
+			return nil, err
+		}
+		p := data[off+unix.SizeofDmTargetSpec:]
+		if n := bytes.IndexByte(p, 0); n >= 0 {
+			p = p[:n]
+		}
+		t = append(t, TableEntry{
+			Start:  spec.Sector_start,
+			Length: spec.Length,
+			Target: Raw{TargetType: cstring(spec.Target_type[:]), Args: string(p)},
+		})
+		if spec.Next <= off && i+1 < count {
+			return nil, ErrShortBuffer
+		}
+		off = spec.Next
+	}
+	return t, nil
+}
+
+func cstring(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		return string(b[:n])
+	}
+	return string(b)
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hugelgupf/vmtest/guest"
+	"github.com/u-root/u-root/pkg/ubinary"
+	"golang.org/x/sys/unix"
+)
+
+func TestRequestMarshal(t *testing.T) {
+	r := newRequest("vg-root", "LVM-abc", unix.DM_READONLY_FLAG)
+	r.data = []byte("hello")
+	b := r.marshal(11)
+	if len(b) != unix.SizeofDmIoctl+5+11 {
+		t.Fatalf("len = %d, want %d", len(b), unix.SizeofDmIoctl+16)
+	}
+	got, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := cstring(got.hdr.Name[:]); n != "vg-root" {
+		t.Errorf("name = %q, want vg-root", n)
+	}
+	if u := cstring(got.hdr.Uuid[:]); u != "LVM-abc" {
+		t.Errorf("uuid = %q, want LVM-abc", u)
+	}
+	if got.hdr.Flags != unix.DM_READONLY_FLAG {
+		t.Errorf("flags = %#x", got.hdr.Flags)
+	}
+	if !bytes.HasPrefix(got.data, []byte("hello")) {
+		t.Errorf("data = %q", got.data)
+	}
+	if _, err := unmarshal(b[:10]); err != ErrShortBuffer {
+		t.Errorf("unmarshal(short) = %v, want %v", err, ErrShortBuffer)
+	}
+}
+
+func TestTableRoundTrip(t *testing.T) {
+	tab := Table{
+		{0, 2048, Linear{"/dev/sda1", 0}},
+		{2048, 4096, Striped{128, []Stripe{{"8:1", 0}, {"8:17", 0}}}},
+	}
+	b, err := marshalTable(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b)%8 != 0 {
+		t.Errorf("table length %d is not 8-byte aligned", len(b))
+	}
+
+	// The kernel returns Next relative to the start of data rather than
+	// relative to the current spec. Rewrite it to look like a status reply.
+	var off uint32
+	for i := 0; i < len(tab); i++ {
+		next := ubinary.NativeEndian.Uint32(b[off+20:])
+		ubinary.NativeEndian.PutUint32(b[off+20:], off+next)
+		off += next
+	}
+
+	got, err := unmarshalTable(b, uint32(len(tab)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Table{
+		{0, 2048, Raw{"linear", "/dev/sda1 0"}},
+		{2048, 4096, Raw{"striped", "2 128 8:1 0 8:17 0"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := marshalTable(Table{{0, 1, Raw{"a-very-long-target-name", ""}}}); err == nil {
+		t.Errorf("marshalTable(long type) = nil error, want error")
+	}
+}
+
+func TestParseNameList(t *testing.T) {
+	var b bytes.Buffer
+	entry := func(dev uint64, name string, last bool) {
+		rec := make([]byte, 12)
+		ubinary.NativeEndian.PutUint64(rec, dev)
+		rec = append(rec, name...)
+		rec = append(rec, 0)
+		for len(rec)%8 != 0 {
+			rec = append(rec, 0)
+		}
+		if !last {
+			ubinary.NativeEndian.PutUint32(rec[8:], uint32(len(rec)))
+		}
+		b.Write(rec)
+	}
+	entry(unix.Mkdev(253, 0), "vg-root", false)
+	entry(unix.Mkdev(253, 1), "vg-swap", true)
+
+	got, err := parseNameList(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"vg-root", "vg-swap"}, got); diff != "" {
+		t.Errorf("parseNameList mismatch (-want +got):\n%s", diff)
+	}
+
+	empty := make([]byte, 16)
+	if got, err := parseNameList(empty); err != nil || len(got) != 0 {
+		t.Errorf("parseNameList(empty) = %v, %v, want no names", got, err)
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	if s := binary.Size(unix.DmIoctl{}); s != unix.SizeofDmIoctl {
+		t.Errorf("binary.Size(DmIoctl) = %d, want %d", s, unix.SizeofDmIoctl)
+	}
+	if s := binary.Size(unix.DmTargetSpec{}); s != unix.SizeofDmTargetSpec {
+		t.Errorf("binary.Size(DmTargetSpec) = %d, want %d", s, unix.SizeofDmTargetSpec)
+	}
+}
+
+func TestLinearDevice(t *testing.T) {
+	guest.SkipIfNotInVM(t)
+
+	if _, err := Version(); err != nil {
+		t.Skipf("no device-mapper: %v", err)
+	}
+	devs, err := filepath.Glob("/sys/class/block/[sv]d[a-z]")
+	if err != nil || len(devs) == 0 {
+		t.Skip("no block device to map")
+	}
+	src := filepath.Join("/dev", filepath.Base(devs[0]))
+
+	d, err := New("u-root-test", "", Table{{0, 8, Linear{src, 0}}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Remove()
+
+	if _, err := os.Stat(d.DevName()); err != nil {
+		t.Errorf("device node: %v", err)
+	}
+	tab, err := GetTable(d.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tab) != 1 || tab[0].Target.Type() != "linear" || tab[0].Length != 8 {
+		t.Errorf("GetTable() = %v", tab)
+	}
+	names, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, n := range names {
+		found = found || n == d.Name
+	}
+	if !found {
+		t.Errorf("List() = %v, missing %q", names, d.Name)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SectorSize is the unit device-mapper uses for all offsets and lengths.
+const SectorSize = 512
+
+var (
+	// ErrTableSyntax is returned when a table line cannot be parsed.
+	ErrTableSyntax = errors.New("table line must be of the form: start length type [params...]")
+)
+
+// Target is a device-mapper target that knows how to format its own
+// parameter string, as it would appear in a dmsetup table.
+type Target interface {
+	// Type returns the kernel target type name, e.g. "linear".
+	Type() string
+	// Params returns the target-specific parameter string.
+	Params() string
+}
+
+// TableEntry maps a range of sectors of the mapped device to a target.
+type TableEntry struct {
+	// Start is the first sector of the mapped device this entry covers.
+	Start uint64
+	// Length is the number of sectors covered by this entry.
+	Length uint64
+	// Target does the mapping.
+	Target Target
+}
+
+// String formats the entry the way dmsetup table prints it.
+func (e TableEntry) String() string {
+	return fmt.Sprintf("%d %d %s %s", e.Start, e.Length, e.Target.Type(), e.Target.Params())
+}
+
+// Table is a device-mapper table, i.e. an ordered list of entries.
+type Table []TableEntry
+
+// String formats the table in dmsetup format, one entry per line.
+func (t Table) String() string {
+	var s []string
+	for _, e := range t {
+		s = append(s, e.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+// Size returns the total number of sectors covered by the table.
+func (t Table) Size() uint64 {
+	var n uint64
+	for _, e := range t {
+		n += e.Length
+	}
+	return n
+}
+
+// Linear maps sectors linearly onto another block device.
+type Linear struct {
+	// Device is a block device path or a major:minor pair.
+	Device string
+	// Offset is the starting sector on Device.
+	Offset uint64
+}
+
+// Type implements Target.
+func (Linear) Type() string { return "linear" }
+
+// Params implements Target.
+func (l Linear) Params() string {
+	return fmt.Sprintf("%s %d", l.Device, l.Offset)
+}
+
+// Stripe is one leg of a Striped target.
+type Stripe struct {
+	Device string
+	Offset uint64
+}
+
+// Striped spreads chunks of ChunkSize sectors round-robin across stripes.
+type Striped struct {
+	// ChunkSize is the stripe size in sectors.
+	ChunkSize uint64
+	Stripes   []Stripe
+}
+
+// Type implements Target.
+func (Striped) Type() string { return "striped" }
+
+// Params implements Target.
+func (s Striped) Params() string {
+	p := []string{strconv.Itoa(len(s.Stripes)), strconv.FormatUint(s.ChunkSize, 10)}
+	for _, st := range s.Stripes {
+		p = append(p, st.Device, strconv.FormatUint(st.Offset, 10))
+	}
+	return strings.Join(p, " ")
+}
+
+// Crypt is a dm-crypt target.
+type Crypt struct {
+	// Cipher is the kernel crypto API cipher spec, e.g. aes-xts-plain64.
+	Cipher string
+	// Key is the raw key. It is hex encoded in the table.
+	Key []byte
+	// KeyRef, if set, is used instead of Key. It is a keyring reference
+	// of the form :<key_size>:<key_type>:<key_description>.
+	KeyRef string
+	// IVOffset is added to the sector number when computing the IV.
+	IVOffset uint64
+	Device   string
+	Offset   uint64
+	// Options are optional feature arguments, e.g. allow_discards.
+	Options []string
+}
+
+// Type implements Target.
+func (Crypt) Type() string { return "crypt" }
+
+// Params implements Target.
+func (c Crypt) Params() string {
+	key := c.KeyRef
+	if key == "" {
+		key = hex.EncodeToString(c.Key)
+		if key == "" {
+			key = "-"
+		}
+	}
+	p := fmt.Sprintf("%s %s %d %s %d", c.Cipher, key, c.IVOffset, c.Device, c.Offset)
+	return p + optionalArgs(c.Options)
+}
+
+// Verity is a dm-verity target.
+type Verity struct {
+	// Version is the hash format version: 0 for Chrome OS, 1 for
+	// veritysetup's default format.
+	Version       int
+	DataDevice    string
+	HashDevice    string
+	DataBlockSize uint32
+	HashBlockSize uint32
+	// NumDataBlocks is the number of DataBlockSize blocks to verify.
+	NumDataBlocks uint64
+	// HashStartBlock is the offset, in HashBlockSize blocks, of the root
+	// of the hash tree on HashDevice.
+	HashStartBlock uint64
+	// Algorithm is the hash algorithm, e.g. sha256.
+	Algorithm string
+	RootHash  []byte
+	// Salt may be empty, in which case "-" is used.
+	Salt    []byte
+	Options []string
+}
+
+// Type implements Target.
+func (Verity) Type() string { return "verity" }
+
+// Params implements Target.
+func (v Verity) Params() string {
+	salt := hex.EncodeToString(v.Salt)
+	if salt == "" {
+		salt = "-"
+	}
+	p := fmt.Sprintf("%d %s %s %d %d %d %d %s %s %s",
+		v.Version, v.DataDevice, v.HashDevice, v.DataBlockSize, v.HashBlockSize,
+		v.NumDataBlocks, v.HashStartBlock, v.Algorithm, hex.EncodeToString(v.RootHash), salt)
+	return p + optionalArgs(v.Options)
+}
+
+// Raw is any target given as a type name and an unparsed parameter string.
+// It is what ParseTable and Status return.
+type Raw struct {
+	TargetType string
+	Args       string
+}
+
+// Type implements Target.
+func (r Raw) Type() string { return r.TargetType }
+
+// Params implements Target.
+func (r Raw) Params() string { return r.Args }
+
+func optionalArgs(opts []string) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" %d %s", len(opts), strings.Join(opts, " "))
+}
+
+// ParseTable parses a table in dmsetup format. Empty lines and lines
+// starting with # are ignored. All targets are returned as Raw.
+func ParseTable(s string) (Table, error) {
+	var t Table
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 3 {
+			return nil, fmt.Errorf("%q: %w", line, ErrTableSyntax)
+		}
+		start, err := strconv.ParseUint(f[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: start: %w", line, err)
+		}
+		length, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: length: %w", line, err)
+		}
+		t = append(t, TableEntry{
+			Start:  start,
+			Length: length,
+			Target: Raw{TargetType: f[2], Args: strings.Join(f[3:], " ")},
+		})
+	}
+	return t, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTargetParams(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		target Target
+		want   string
+	}{
+		{
+			name:   "linear",
+			target: Linear{Device: "/dev/sda1", Offset: 2048},
+			want:   "linear /dev/sda1 2048",
+		},
+		{
+			name: "striped",
+			target: Striped{
+				ChunkSize: 128,
+				Stripes:   []Stripe{{"8:1", 384}, {"8:17", 384}},
+			},
+			want: "striped 2 128 8:1 384 8:17 384",
+		},
+		{
+			name: "crypt",
+			target: Crypt{
+				Cipher:  "aes-xts-plain64",
+				Key:     []byte{0xde, 0xad, 0xbe, 0xef},
+				Device:  "/dev/vda2",
+				Offset:  4096,
+				Options: []string{"allow_discards"},
+			},
+			want: "crypt aes-xts-plain64 deadbeef 0 /dev/vda2 4096 1 allow_discards",
+		},
+		{
+			name: "crypt keyring",
+			target: Crypt{
+				Cipher: "aes-cbc-essiv:sha256",
+				KeyRef: ":32:logon:my:key",
+				Device: "8:2",
+			},
+			want: "crypt aes-cbc-essiv:sha256 :32:logon:my:key 0 8:2 0",
+		},
+		{
+			name: "verity",
+			target: Verity{
+				Version:        1,
+				DataDevice:     "/dev/sda1",
+				HashDevice:     "/dev/sda2",
+				DataBlockSize:  4096,
+				HashBlockSize:  4096,
+				NumDataBlocks:  262144,
+				HashStartBlock: 1,
+				Algorithm:      "sha256",
+				RootHash:       []byte{0x4a, 0x2b},
+			},
+			want: "verity 1 /dev/sda1 /dev/sda2 4096 4096 262144 1 sha256 4a2b -",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := TableEntry{Start: 0, Length: 100, Target: tt.target}
+			if got, want := e.String(), "0 100 "+tt.want; got != want {
+				t.Errorf("String() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	in := `# comment
+0 2048 linear /dev/sda1 0
+
+2048 4096 striped 2 128 8:1 0 8:17 0
+`
+	got, err := ParseTable(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Table{
+		{0, 2048, Raw{"linear", "/dev/sda1 0"}},
+		{2048, 4096, Raw{"striped", "2 128 8:1 0 8:17 0"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseTable() mismatch (-want +got):\n%s", diff)
+	}
+	if got.Size() != 6144 {
+		t.Errorf("Size() = %d, want 6144", got.Size())
+	}
+	if got.String() != "0 2048 linear /dev/sda1 0\n2048 4096 striped 2 128 8:1 0 8:17 0" {
+		t.Errorf("String() = %q", got.String())
+	}
+
+	for _, bad := range []string{"0 10", "x 10 linear", "0 y linear"} {
+		if _, err := ParseTable(bad); err == nil {
+			t.Errorf("ParseTable(%q) = nil error, want error", bad)
+		}
+	}
+	if _, err := ParseTable("0 1"); !errors.Is(err, ErrTableSyntax) {
+		t.Errorf("ParseTable(short) = %v, want %v", err, ErrTableSyntax)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lvm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrSyntax is returned for malformed LVM2 text metadata.
+var ErrSyntax = errors.New("lvm metadata syntax error")
+
+// Section is a named block of LVM2 text metadata, such as a volume group or
+// a logical volume.
+//
+// Values hold int64, string or []any (of int64 and string).
+type Section struct {
+	Name     string
+	Values   map[string]any
+	Sections []*Section
+}
+
+// Section returns the first child section called name, or nil.
+func (s *Section) Section(name string) *Section {
+	for _, c := range s.Sections {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// String returns the string value of key, or "" if it is missing or not a
+// string.
+func (s *Section) String(key string) string {
+	v, _ := s.Values[key].(string)
+	return v
+}
+
+// Int returns the integer value of key.
+func (s *Section) Int(key string) (int64, error) {
+	v, ok := s.Values[key]
+	if !ok {
+		return 0, fmt.Errorf("%s: missing %q", s.Name, key)
+	}
+	i, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%s: %q is %T, not an integer", s.Name, key, v)
+	}
+	return i, nil
+}
+
+// Uint returns the non-negative integer value of key.
+func (s *Section) Uint(key string) (uint64, error) {
+	i, err := s.Int(key)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("%s: %q is negative", s.Name, key)
+	}
+	return uint64(i), nil
+}
+
+// Strings returns the string elements of the array value of key.
+func (s *Section) Strings(key string) []string {
+	a, _ := s.Values[key].([]any)
+	var r []string
+	for _, v := range a {
+		if str, ok := v.(string); ok {
+			r = append(r, str)
+		}
+	}
+	return r
+}
+
+// ParseConfig parses LVM2 text metadata, as found in the metadata area of a
+// physical volume or in /etc/lvm/backup. The returned section is unnamed and
+// holds the top level values and sections.
+func ParseConfig(text string) (*Section, error) {
+	p := &parser{s: text}
+	root := &Section{Values: map[string]any{}}
+	if err := p.section(root, true); err != nil {
+		return nil, fmt.Errorf("line %d: %w", p.line(), err)
+	}
+	return root, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) line() int {
+	return strings.Count(p.s[:p.pos], "\n") + 1
+}
+
+// skip skips white space and comments.
+func (p *parser) skip() {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func isIdent(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.+", r)
+}
+
+func (p *parser) ident() (string, error) {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.s) && isIdent(rune(p.s[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", fmt.Errorf("%w: expected identifier", ErrSyntax)
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *parser) section(sec *Section, top bool) error {
+	for {
+		c := p.peek()
+		switch {
+		case c == 0 && top:
+			return nil
+		case c == 0:
+			return fmt.Errorf("%w: unterminated section %q", ErrSyntax, sec.Name)
+		case c == '}' && !top:
+			p.pos++
+			return nil
+		}
+
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		switch p.peek() {
+		case '{':
+			p.pos++
+			child := &Section{Name: name, Values: map[string]any{}}
+			if err := p.section(child, false); err != nil {
+				return err
+			}
+			sec.Sections = append(sec.Sections, child)
+		case '=':
+			p.pos++
+			v, err := p.value(true)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			sec.Values[name] = v
+		default:
+			return fmt.Errorf("%w: expected '{' or '=' after %q", ErrSyntax, name)
+		}
+	}
+}
+
+func (p *parser) value(arrayOK bool) (any, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		return p.str()
+	case c == '[' && arrayOK:
+		p.pos++
+		a := []any{}
+		for {
+			if p.peek() == ']' {
+				p.pos++
+				return a, nil
+			}
+			v, err := p.value(false)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+			switch p.peek() {
+			case ',':
+				p.pos++
+			case ']':
+			default:
+				return nil, fmt.Errorf("%w: expected ',' or ']' in array", ErrSyntax)
+			}
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.s) && (p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		num := p.s[start:p.pos]
+		if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+			return i, nil
+		}
+		// Floats only occur in lvm.conf style files; keep them as text.
+		if _, err := strconv.ParseFloat(num, 64); err == nil {
+			return num, nil
+		}
+		return nil, fmt.Errorf("%w: bad number %q", ErrSyntax, num)
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, c)
+	}
+}
+
+func (p *parser) str() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.pos < len(p.s) {
+				b.WriteByte(p.s[p.pos])
+				p.pos++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("%w: unterminated string", ErrSyntax)
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	sectorSize = 512
+
+	// labelScanSectors is how many sectors at the start of a device may
+	// hold the label.
+	labelScanSectors = 4
+
+	// mdaHeaderSize is the size of the metadata area header. The circular
+	// metadata buffer starts right after it.
+	mdaHeaderSize = 512
+
+	idLen = 32
+)
+
+var (
+	labelID   = []byte("LABELONE")
+	labelType = []byte("LVM2 001")
+	mdaMagic  = []byte(" LVM2 x[5A%r0N*>")
+
+	// ErrNoLabel is returned when a device does not carry an LVM2 label.
+	ErrNoLabel = errors.New("no LVM2 label found")
+
+	// ErrNoMetadata is returned when a physical volume has no usable
+	// metadata area.
+	ErrNoMetadata = errors.New("no LVM2 metadata found")
+)
+
+// labelHeader is struct label_header from lib/label/label.h.
+type labelHeader struct {
+	ID       [8]byte
+	SectorXL uint64
+	CRCXL    uint32
+	OffsetXL uint32
+	Type     [8]byte
+}
+
+// mdaHeader is struct mda_header from lib/format_text/layout.h, without
+// the trailing raw_locn list.
+type mdaHeader struct {
+	ChecksumXL uint32
+	Magic      [16]byte
+	Version    uint32
+	Start      uint64
+	Size       uint64
+}
+
+// rawLocn is struct raw_locn: where in the metadata area the text lives.
+type rawLocn struct {
+	Offset   uint64
+	Size     uint64
+	Checksum uint32
+	Flags    uint32
+}
+
+// Area is a region of a physical volume, in bytes.
+type Area struct {
+	Offset uint64
+	Size   uint64
+}
+
+// Label is the on-disk header of an LVM2 physical volume.
+type Label struct {
+	// UUID is the PV UUID without dashes.
+	UUID string
+	// DeviceSize is the size of the PV in bytes as recorded on disk.
+	DeviceSize    uint64
+	DataAreas     []Area
+	MetadataAreas []Area
+}
+
+// ReadLabel reads the LVM2 label from the first sectors of r.
+func ReadLabel(r io.ReaderAt) (*Label, error) {
+	buf := make([]byte, labelScanSectors*sectorSize)
+	if _, err := r.ReadAt(buf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for s := 0; s < labelScanSectors; s++ {
+		sec := buf[s*sectorSize : (s+1)*sectorSize]
+		if !bytes.Equal(sec[:8], labelID) {
+			continue
+		}
+		var lh labelHeader
+		if err := binary.Read(bytes.NewReader(sec), binary.LittleEndian, &lh); err != nil {
+			return nil, err
+		}
+		if lh.SectorXL != uint64(s) || !bytes.Equal(lh.Type[:], labelType) {
+			continue
+		}
+		if crc := calcCRC(initialCRC, sec[20:]); crc != lh.CRCXL {
+			return nil, fmt.Errorf("label in sector %d: bad checksum %#x, want %#x", s, crc, lh.CRCXL)
+		}
+		// Not OffsetXL+idLen+8 > sectorSize, which wraps around for
+		// offsets near 1<<32.
+		if lh.OffsetXL > sectorSize-idLen-8 {
+			return nil, fmt.Errorf("label in sector %d: bad pv_header offset %d", s, lh.OffsetXL)
+		}
+		return parsePVHeader(sec[lh.OffsetXL:])
+	}
+	return nil, ErrNoLabel
+}
+
+func parsePVHeader(b []byte) (*Label, error) {
+	l := &Label{
+		UUID:       string(b[:idLen]),
+		DeviceSize: binary.LittleEndian.Uint64(b[idLen:]),
+	}
+	b = b[idLen+8:]
+	// Two zero terminated lists of disk_locn: data areas, then metadata
+	// areas.
+	for _, list := range []*[]Area{&l.DataAreas, &l.MetadataAreas} {
+		for {
+			if len(b) < 16 {
+				return nil, fmt.Errorf("pv_header: area list is not terminated")
+			}
+			a := Area{binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint64(b[8:])}
+			b = b[16:]
+			if a.Offset == 0 {
+				break
+			}
+			*list = append(*list, a)
+		}
+	}
+	return l, nil
+}
+
+// ReadMetadata returns the committed text metadata from the first usable
+// metadata area of the PV.
+func (l *Label) ReadMetadata(r io.ReaderAt) (string, error) {
+	var errs []error
+	for _, a := range l.MetadataAreas {
+		text, err := readMDA(r, a)
+		if err == nil {
+			return text, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return "", ErrNoMetadata
+	}
+	return "", errors.Join(append([]error{ErrNoMetadata}, errs...)...)
+}
+
+func readMDA(r io.ReaderAt, a Area) (string, error) {
+	hdr := make([]byte, mdaHeaderSize)
+	if _, err := r.ReadAt(hdr, int64(a.Offset)); err != nil {
+		return "", err
+	}
+	var mh mdaHeader
+	if err := binary.Read(bytes.NewReader(hdr), binary.LittleEndian, &mh); err != nil {
+		return "", err
+	}
+	if !bytes.Equal(mh.Magic[:], mdaMagic) {
+		return "", fmt.Errorf("metadata area at %d: bad magic %q", a.Offset, mh.Magic)
+	}
+	if crc := calcCRC(initialCRC, hdr[4:]); crc != mh.ChecksumXL {
+		return "", fmt.Errorf("metadata area at %d: bad checksum %#x, want %#x", a.Offset, crc, mh.ChecksumXL)
+	}
+	if mh.Start != a.Offset {
+		return "", fmt.Errorf("metadata area at %d: header claims start %d", a.Offset, mh.Start)
+	}
+
+	var rl rawLocn
+	if err := binary.Read(bytes.NewReader(hdr[binary.Size(mh):]), binary.LittleEndian, &rl); err != nil {
+		return "", err
+	}
+	if rl.Offset == 0 || rl.Size == 0 {
+		return "", fmt.Errorf("metadata area at %d: %w", a.Offset, ErrNoMetadata)
+	}
+	if mh.Size <= mdaHeaderSize || rl.Offset < mdaHeaderSize || rl.Offset >= mh.Size || rl.Size > mh.Size-mdaHeaderSize {
+		return "", fmt.Errorf("metadata area at %d: text at %d+%d out of bounds", a.Offset, rl.Offset, rl.Size)
+	}
+
+	// The text lives in a circular buffer following the header. It is
+	// read with io.ReadAll, so that a bogus size fails at the end of the
+	// device rather than allocating it all up front.
+	first := rl.Size
+	if rl.Offset+rl.Size > mh.Size {
+		first = mh.Size - rl.Offset
+	}
+	text, err := readFull(r, mh.Start+rl.Offset, first)
+	if err != nil {
+		return "", err
+	}
+	if first < rl.Size {
+		rest, err := readFull(r, mh.Start+mdaHeaderSize, rl.Size-first)
+		if err != nil {
+			return "", err
+		}
+		text = append(text, rest...)
+	}
+	if crc := calcCRC(initialCRC, text); crc != rl.Checksum {
+		return "", fmt.Errorf("metadata area at %d: bad text checksum %#x, want %#x", a.Offset, crc, rl.Checksum)
+	}
+	return string(bytes.TrimRight(text, "\x00")), nil
+}
+
+// readFull reads n bytes at off of r.
+func readFull(r io.ReaderAt, off, n uint64) ([]byte, error) {
+	if off > math.MaxInt64 || n > math.MaxInt64-off {
+		return nil, fmt.Errorf("reading %d bytes at %d: %w", n, off, io.ErrUnexpectedEOF)
+	}
+	b, err := io.ReadAll(io.NewSectionReader(r, int64(off), int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(b)) != n {
+		return nil, fmt.Errorf("reading %d bytes at %d: %w", n, off, io.ErrUnexpectedEOF)
+	}
+	return b, nil
+}
+
+const initialCRC = 0xf597a6cf
+
+// calcCRC is LVM2's calc_crc: a CRC-32 without the final inversion and with
+// a custom initial value.
+func calcCRC(crc uint32, b []byte) uint32 {
+	for _, c := range b {
+		crc ^= uint32(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xedb88320
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
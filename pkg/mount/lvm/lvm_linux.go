@@ -0,0 +1,188 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lvm reads LVM2 metadata and activates logical volumes with
+// device-mapper.
+//
+// Only linear and striped logical volumes are supported, which covers the
+// default layout of most distribution installers.
+package lvm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/mount/dm"
+)
+
+// DevDir is where /dev/<vg>/<lv> symlinks are created.
+var DevDir = "/dev"
+
+// Debug function to override for verbose logging.
+var Debug = func(string, ...interface{}) {}
+
+// ScanDevice reads the LVM2 label and metadata of the PV at path.
+func ScanDevice(path string) (*Label, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	l, err := ReadLabel(f)
+	if err != nil {
+		return nil, "", err
+	}
+	text, err := l.ReadMetadata(f)
+	if err != nil {
+		return l, "", err
+	}
+	return l, text, nil
+}
+
+// Scan looks for PVs on devs and returns the volume groups found, sorted by
+// name. PVs of each VG are resolved to their device paths; missing PVs have
+// an empty Device.
+//
+// When several PVs carry metadata for the same VG, the copy with the
+// highest sequence number wins.
+func Scan(devs block.BlockDevices) ([]*VolumeGroup, error) {
+	vgs := map[string]*VolumeGroup{}
+	// PV UUID (without dashes) to device path.
+	pvDevs := map[string]string{}
+	for _, d := range devs {
+		l, text, err := ScanDevice(d.DevicePath())
+		if err != nil {
+			if !errors.Is(err, ErrNoLabel) {
+				Debug("lvm: %s: %v", d.DevicePath(), err)
+			}
+			if l == nil {
+				continue
+			}
+		}
+		Debug("lvm: %s: found PV %s", d.DevicePath(), l.UUID)
+		pvDevs[l.UUID] = d.DevicePath()
+		if text == "" {
+			continue
+		}
+		vg, err := ParseVolumeGroup(text)
+		if err != nil {
+			Debug("lvm: %s: %v", d.DevicePath(), err)
+			continue
+		}
+		if old, ok := vgs[vg.Name]; !ok || old.Seqno < vg.Seqno {
+			vgs[vg.Name] = vg
+		}
+	}
+
+	var r []*VolumeGroup
+	for _, vg := range vgs {
+		for _, pv := range vg.PVs {
+			pv.Device = pvDevs[strings.ReplaceAll(pv.ID, "-", "")]
+		}
+		r = append(r, vg)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r, nil
+}
+
+// ScanAll scans all block devices on the system.
+func ScanAll() ([]*VolumeGroup, error) {
+	devs, err := block.GetBlockDevices()
+	if err != nil {
+		return nil, err
+	}
+	return Scan(devs)
+}
+
+// Activate activates all visible LVs of vg, or only the named ones if
+// names is not empty. It returns the devices it created and an error for
+// each LV that could not be activated. It activates nothing if any of the
+// names is not an LV of vg.
+func (vg *VolumeGroup) Activate(names ...string) ([]*dm.Device, error) {
+	lvs, err := vg.Select(names...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		devs []*dm.Device
+		errs []error
+	)
+	for _, lv := range lvs {
+		d, err := vg.activate(lv)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		devs = append(devs, d)
+	}
+	return devs, errors.Join(errs...)
+}
+
+func (vg *VolumeGroup) activate(lv *LogicalVolume) (*dm.Device, error) {
+	t, err := vg.Table(lv)
+	if err != nil {
+		return nil, err
+	}
+	name := vg.DMName(lv)
+	Debug("lvm: activating %s/%s as %s:\n%s", vg.Name, lv.Name, name, t)
+	d, err := dm.New(name, vg.DMUUID(lv), t, !lv.writable())
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", vg.Name, lv.Name, err)
+	}
+	if err := vg.link(lv, d); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// link creates the /dev/<vg>/<lv> symlink to the mapper node.
+func (vg *VolumeGroup) link(lv *LogicalVolume, d *dm.Device) error {
+	dir := filepath.Join(DevDir, vg.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	p := filepath.Join(dir, lv.Name)
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(d.DevName(), p)
+}
+
+// Deactivate removes the device-mapper devices of all LVs of vg, or only
+// the named ones if names is not empty. LVs that are not active are skipped.
+func (vg *VolumeGroup) Deactivate(names ...string) error {
+	lvs, err := vg.Select(names...)
+	if err != nil {
+		return err
+	}
+	active, err := dm.List()
+	if err != nil {
+		return err
+	}
+	isActive := map[string]bool{}
+	for _, n := range active {
+		isActive[n] = true
+	}
+
+	var errs []error
+	for _, lv := range lvs {
+		name := vg.DMName(lv)
+		if !isActive[name] {
+			continue
+		}
+		if err := dm.Remove(name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		os.Remove(filepath.Join(DevDir, vg.Name, lv.Name))
+	}
+	// Only succeeds once the directory is empty.
+	os.Remove(filepath.Join(DevDir, vg.Name))
+	return errors.Join(errs...)
+}
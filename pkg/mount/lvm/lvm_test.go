@@ -0,0 +1,382 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/mount/dm"
+)
+
+const testMetadata = `vg0 {
+id = "Xq2nYd-0bF3-Lx7g-8KcQ-2m8Q-ZtHc-UaS1Pz"
+seqno = 3
+format = "lvm2" # informational
+status = ["RESIZEABLE", "READ", "WRITE"]
+flags = []
+extent_size = 8192
+max_lv = 0
+max_pv = 0
+
+physical_volumes {
+
+pv0 {
+id = "3QVyoR-kKeL-mx1W-1Q1i-ALfM-2b1J-d2Hu6X"
+device = "/dev/sda1"
+
+status = ["ALLOCATABLE"]
+flags = []
+dev_size = 2097152
+pe_start = 2048
+pe_count = 255
+}
+
+pv1 {
+id = "mpV3ut-7sxd-GxK8-0bq4-CfT3-nU5L-1dLzQh"
+device = "/dev/sdb1"
+status = ["ALLOCATABLE"]
+dev_size = 2097152
+pe_start = 2048
+pe_count = 255
+}
+}
+
+logical_volumes {
+
+root {
+id = "r00t00-aaaa-bbbb-cccc-dddd-eeee-ffffff"
+status = ["READ", "WRITE", "VISIBLE"]
+flags = []
+creation_host = "build\"er"
+segment_count = 2
+
+segment1 {
+start_extent = 0
+extent_count = 100
+
+type = "striped"
+stripe_count = 1	# linear
+
+stripes = [
+"pv0", 0
+]
+}
+segment2 {
+start_extent = 100
+extent_count = 20
+
+type = "striped"
+stripe_count = 1
+
+stripes = [
+"pv1", 200
+]
+}
+}
+
+data {
+id = "da7a00-aaaa-bbbb-cccc-dddd-eeee-ffffff"
+status = ["READ", "VISIBLE"]
+segment_count = 1
+
+segment1 {
+start_extent = 0
+extent_count = 50
+
+type = "striped"
+stripe_count = 2
+stripe_size = 128
+
+stripes = [
+"pv0", 100,
+"pv1", 0
+]
+}
+}
+
+pool_tmeta {
+id = "meta00-aaaa-bbbb-cccc-dddd-eeee-ffffff"
+status = ["READ", "WRITE"]
+segment_count = 1
+
+segment1 {
+start_extent = 0
+extent_count = 1
+type = "thin-pool"
+}
+}
+}
+}
+# Generated by LVM2
+contents = "Text Format Volume Group"
+version = 1
+creation_time = 1700000000
+`
+
+func TestParseConfig(t *testing.T) {
+	root, err := ParseConfig(testMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := root.String("contents"); got != "Text Format Volume Group" {
+		t.Errorf("contents = %q", got)
+	}
+	if v, err := root.Int("version"); err != nil || v != 1 {
+		t.Errorf("version = %d, %v; want 1", v, err)
+	}
+	vg := root.Section("vg0")
+	if vg == nil {
+		t.Fatal("no vg0 section")
+	}
+	if diff := cmp.Diff([]string{"RESIZEABLE", "READ", "WRITE"}, vg.Strings("status")); diff != "" {
+		t.Errorf("status (-want +got):\n%s", diff)
+	}
+	lv := vg.Section("logical_volumes").Section("root")
+	if got := lv.String("creation_host"); got != `build"er` {
+		t.Errorf("creation_host = %q", got)
+	}
+	if _, err := vg.Int("format"); err == nil {
+		t.Errorf("Int(format) = nil error, want error for a string")
+	}
+
+	for _, bad := range []string{
+		"vg {",
+		"x = ",
+		`x = "abc`,
+		"x = [1 2]",
+		"x y",
+		"}",
+	} {
+		if _, err := ParseConfig(bad); !errors.Is(err, ErrSyntax) {
+			t.Errorf("ParseConfig(%q) = %v, want %v", bad, err, ErrSyntax)
+		}
+	}
+}
+
+func TestVolumeGroupTable(t *testing.T) {
+	vg, err := ParseVolumeGroup(testMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vg.Name != "vg0" || vg.Seqno != 3 || vg.ExtentSize != 8192 {
+		t.Errorf("vg = %s seqno %d extent size %d", vg.Name, vg.Seqno, vg.ExtentSize)
+	}
+	if !vg.Partial() {
+		t.Errorf("Partial() = false before resolving devices")
+	}
+	if _, err := vg.Table(vg.LV("root")); !errors.Is(err, ErrMissingPV) {
+		t.Errorf("Table(root) = %v, want %v", err, ErrMissingPV)
+	}
+	vg.PV("pv0").Device = "/dev/sda1"
+	vg.PV("pv1").Device = "/dev/sdb1"
+
+	for _, tt := range []struct {
+		lv   string
+		want dm.Table
+	}{
+		{
+			lv: "root",
+			want: dm.Table{
+				{Start: 0, Length: 100 * 8192, Target: dm.Linear{Device: "/dev/sda1", Offset: 2048}},
+				{Start: 100 * 8192, Length: 20 * 8192, Target: dm.Linear{Device: "/dev/sdb1", Offset: 2048 + 200*8192}},
+			},
+		},
+		{
+			lv: "data",
+			want: dm.Table{
+				{Start: 0, Length: 50 * 8192, Target: dm.Striped{
+					ChunkSize: 128,
+					Stripes:   []dm.Stripe{{Device: "/dev/sda1", Offset: 2048 + 100*8192}, {Device: "/dev/sdb1", Offset: 2048}},
+				}},
+			},
+		},
+	} {
+		got, err := vg.Table(vg.LV(tt.lv))
+		if err != nil {
+			t.Errorf("Table(%s) = %v", tt.lv, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Table(%s) (-want +got):\n%s", tt.lv, diff)
+		}
+	}
+
+	if _, err := vg.Table(vg.LV("pool_tmeta")); !errors.Is(err, ErrUnsupportedSegment) {
+		t.Errorf("Table(pool_tmeta) = %v, want %v", err, ErrUnsupportedSegment)
+	}
+
+	lvs, err := vg.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var visible []string
+	for _, lv := range lvs {
+		visible = append(visible, lv.Name)
+	}
+	if diff := cmp.Diff([]string{"root", "data"}, visible); diff != "" {
+		t.Errorf("visible LVs (-want +got):\n%s", diff)
+	}
+	if _, err := vg.Select("root", "nope"); !errors.Is(err, ErrNoLV) {
+		t.Errorf("Select(root, nope) = %v, want %v", err, ErrNoLV)
+	}
+	if !vg.LV("root").writable() || vg.LV("data").writable() {
+		t.Errorf("writable() is wrong")
+	}
+}
+
+func TestDMName(t *testing.T) {
+	vg := &VolumeGroup{Name: "my-vg", ID: "abc-def"}
+	lv := &LogicalVolume{Name: "lv-root", ID: "123-456"}
+	if got := vg.DMName(lv); got != "my--vg-lv--root" {
+		t.Errorf("DMName = %q, want my--vg-lv--root", got)
+	}
+	if got := vg.DMUUID(lv); got != "LVM-abcdef123456" {
+		t.Errorf("DMUUID = %q, want LVM-abcdef123456", got)
+	}
+}
+
+// makePV builds a minimal PV image with a label in sector 1 and a metadata
+// area at 4096. The text is placed at textOffset within the metadata area,
+// which lets tests exercise the circular buffer.
+func makePV(t testing.TB, uuid, text string, textOffset uint64) []byte {
+	t.Helper()
+	const (
+		mdaStart = 4096
+		mdaSize  = 4096
+	)
+	img := make([]byte, mdaStart+mdaSize)
+
+	// Label header and pv_header in sector 1.
+	sec := img[sectorSize : 2*sectorSize]
+	lh := labelHeader{SectorXL: 1, OffsetXL: 32}
+	copy(lh.ID[:], labelID)
+	copy(lh.Type[:], labelType)
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &lh)
+	b.WriteString(uuid)
+	for _, v := range []uint64{1 << 30, 1 << 20, 0, 0, 0, mdaStart, mdaSize, 0, 0} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	copy(sec, b.Bytes())
+	binary.LittleEndian.PutUint32(sec[16:], calcCRC(initialCRC, sec[20:]))
+
+	// Text, wrapping around the end of the metadata area if necessary.
+	data := append([]byte(text), 0)
+	area := img[mdaStart:]
+	n := copy(area[textOffset:], data)
+	copy(area[mdaHeaderSize:], data[n:])
+
+	mh := mdaHeader{Version: 1, Start: mdaStart, Size: mdaSize}
+	copy(mh.Magic[:], mdaMagic)
+	rl := rawLocn{Offset: textOffset, Size: uint64(len(data)), Checksum: calcCRC(initialCRC, data)}
+	b.Reset()
+	binary.Write(&b, binary.LittleEndian, &mh)
+	binary.Write(&b, binary.LittleEndian, &rl)
+	copy(area, b.Bytes())
+	binary.LittleEndian.PutUint32(area, calcCRC(initialCRC, area[4:mdaHeaderSize]))
+	return img
+}
+
+func TestReadLabel(t *testing.T) {
+	const uuid = "3QVyoRkKeLmx1W1Q1iALfM2b1Jd2Hu6X"
+	text := "vg0 {\nid = \"x\"\nseqno = 1\nextent_size = 8\n}\n"
+	for _, tt := range []struct {
+		name   string
+		offset uint64
+	}{
+		{"contiguous", mdaHeaderSize},
+		{"wrapped", 4096 - 16},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img := makePV(t, uuid, text, tt.offset)
+			r := bytes.NewReader(img)
+			l, err := ReadLabel(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &Label{
+				UUID:          uuid,
+				DeviceSize:    1 << 30,
+				DataAreas:     []Area{{1 << 20, 0}},
+				MetadataAreas: []Area{{4096, 4096}},
+			}
+			if diff := cmp.Diff(want, l); diff != "" {
+				t.Errorf("ReadLabel (-want +got):\n%s", diff)
+			}
+			got, err := l.ReadMetadata(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != text {
+				t.Errorf("ReadMetadata = %q, want %q", got, text)
+			}
+			vg, err := ParseVolumeGroup(got)
+			if err != nil || vg.Name != "vg0" {
+				t.Errorf("ParseVolumeGroup = %v, %v", vg, err)
+			}
+		})
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		img := makePV(t, uuid, text, mdaHeaderSize)
+		img[4096+mdaHeaderSize] ^= 0xff
+		l, err := ReadLabel(bytes.NewReader(img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.ReadMetadata(bytes.NewReader(img)); !errors.Is(err, ErrNoMetadata) || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("ReadMetadata = %v, want checksum error", err)
+		}
+		img[sectorSize+40] ^= 0xff
+		if _, err := ReadLabel(bytes.NewReader(img)); err == nil {
+			t.Errorf("ReadLabel(corrupt label) = nil error")
+		}
+	})
+
+	t.Run("bad pv_header offset", func(t *testing.T) {
+		for _, off := range []uint32{sectorSize - idLen - 7, 1<<32 - 8} {
+			img := makePV(t, uuid, text, mdaHeaderSize)
+			sec := img[sectorSize : 2*sectorSize]
+			binary.LittleEndian.PutUint32(sec[20:], off)
+			binary.LittleEndian.PutUint32(sec[16:], calcCRC(initialCRC, sec[20:]))
+			if _, err := ReadLabel(bytes.NewReader(img)); err == nil || !strings.Contains(err.Error(), "offset") {
+				t.Errorf("ReadLabel(offset %#x) = %v, want offset error", off, err)
+			}
+		}
+	})
+
+	t.Run("no label", func(t *testing.T) {
+		if _, err := ReadLabel(bytes.NewReader(make([]byte, 8192))); !errors.Is(err, ErrNoLabel) {
+			t.Errorf("ReadLabel = %v, want %v", err, ErrNoLabel)
+		}
+	})
+}
+
+func FuzzReadLabel(f *testing.F) {
+	img := makePV(f, "3QVyoRkKeLmx1W1Q1iALfM2b1Jd2Hu6X", "vg0 {\n}\n", mdaHeaderSize)
+	f.Add(img)
+	f.Fuzz(func(t *testing.T, img []byte) {
+		// Keep the checksums valid, or the fuzzer hardly gets past them.
+		if len(img) >= 2*sectorSize {
+			sec := img[sectorSize : 2*sectorSize]
+			binary.LittleEndian.PutUint32(sec[16:], calcCRC(initialCRC, sec[20:]))
+		}
+		if len(img) >= 4096+mdaHeaderSize {
+			area := img[4096 : 4096+mdaHeaderSize]
+			binary.LittleEndian.PutUint32(area, calcCRC(initialCRC, area[4:]))
+		}
+		r := bytes.NewReader(img)
+		l, err := ReadLabel(r)
+		if err != nil {
+			return
+		}
+		l.ReadMetadata(r)
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lvm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/mount/dm"
+)
+
+var (
+	// ErrMissingPV is returned when an LV uses a PV that was not found.
+	ErrMissingPV = errors.New("physical volume is missing")
+
+	// ErrUnsupportedSegment is returned for segment types other than
+	// striped (which includes linear).
+	ErrUnsupportedSegment = errors.New("unsupported segment type")
+
+	// ErrNoLV is returned when a named LV is not in the VG.
+	ErrNoLV = errors.New("logical volume not found")
+)
+
+// PhysicalVolume is a PV as described in the VG metadata.
+type PhysicalVolume struct {
+	// Name is the PV's name in the metadata, e.g. pv0.
+	Name string
+	ID   string
+	// Device is the path to the block device, or "" if it was not found.
+	Device string
+	// PEStart is the sector of the first physical extent.
+	PEStart uint64
+	PECount uint64
+}
+
+// StripeRef is a reference to a run of extents on a PV.
+type StripeRef struct {
+	PV     string
+	Extent uint64
+}
+
+// Segment is a contiguous range of extents of an LV.
+type Segment struct {
+	StartExtent uint64
+	ExtentCount uint64
+	Type        string
+	// StripeSize is in sectors. It is only set when there is more than one
+	// stripe.
+	StripeSize uint64
+	Stripes    []StripeRef
+}
+
+// LogicalVolume is an LV as described in the VG metadata.
+type LogicalVolume struct {
+	Name     string
+	ID       string
+	Status   []string
+	Segments []Segment
+}
+
+// Visible reports whether the LV is a user visible volume, as opposed to
+// an internal volume such as a thin pool's metadata.
+func (lv *LogicalVolume) Visible() bool {
+	for _, s := range lv.Status {
+		if s == "VISIBLE" {
+			return true
+		}
+	}
+	return false
+}
+
+func (lv *LogicalVolume) writable() bool {
+	for _, s := range lv.Status {
+		if s == "WRITE" {
+			return true
+		}
+	}
+	return false
+}
+
+// VolumeGroup is an LVM2 volume group.
+type VolumeGroup struct {
+	Name  string
+	ID    string
+	Seqno int64
+	// ExtentSize is in sectors.
+	ExtentSize uint64
+	PVs        []*PhysicalVolume
+	LVs        []*LogicalVolume
+}
+
+// ParseVolumeGroup parses the text metadata of a PV and returns the volume
+// group it describes. PV devices are not resolved.
+func ParseVolumeGroup(text string) (*VolumeGroup, error) {
+	root, err := ParseConfig(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(root.Sections) != 1 {
+		return nil, fmt.Errorf("%w: want exactly one volume group, found %d", ErrSyntax, len(root.Sections))
+	}
+	s := root.Sections[0]
+	vg := &VolumeGroup{Name: s.Name, ID: s.String("id")}
+	if vg.Seqno, err = s.Int("seqno"); err != nil {
+		return nil, err
+	}
+	if vg.ExtentSize, err = s.Uint("extent_size"); err != nil {
+		return nil, err
+	}
+
+	if pvs := s.Section("physical_volumes"); pvs != nil {
+		for _, p := range pvs.Sections {
+			pv := &PhysicalVolume{Name: p.Name, ID: p.String("id")}
+			if pv.PEStart, err = p.Uint("pe_start"); err != nil {
+				return nil, err
+			}
+			if pv.PECount, err = p.Uint("pe_count"); err != nil {
+				return nil, err
+			}
+			vg.PVs = append(vg.PVs, pv)
+		}
+	}
+
+	if lvs := s.Section("logical_volumes"); lvs != nil {
+		for _, l := range lvs.Sections {
+			lv := &LogicalVolume{Name: l.Name, ID: l.String("id"), Status: l.Strings("status")}
+			for _, seg := range l.Sections {
+				sg, err := parseSegment(seg)
+				if err != nil {
+					return nil, fmt.Errorf("%s/%s: %w", vg.Name, lv.Name, err)
+				}
+				lv.Segments = append(lv.Segments, sg)
+			}
+			vg.LVs = append(vg.LVs, lv)
+		}
+	}
+	return vg, nil
+}
+
+func parseSegment(s *Section) (Segment, error) {
+	var (
+		sg  = Segment{Type: s.String("type")}
+		err error
+	)
+	if sg.StartExtent, err = s.Uint("start_extent"); err != nil {
+		return sg, err
+	}
+	if sg.ExtentCount, err = s.Uint("extent_count"); err != nil {
+		return sg, err
+	}
+	if sg.Type != "striped" {
+		// Other segment types have their own layout; they are rejected
+		// when building a table.
+		return sg, nil
+	}
+	count, err := s.Uint("stripe_count")
+	if err != nil {
+		return sg, err
+	}
+	if count > 1 {
+		if sg.StripeSize, err = s.Uint("stripe_size"); err != nil {
+			return sg, err
+		}
+	}
+	stripes, _ := s.Values["stripes"].([]any)
+	if uint64(len(stripes)) != 2*count {
+		return sg, fmt.Errorf("%s: %w: stripe_count is %d but %d stripes are listed", s.Name, ErrSyntax, count, len(stripes)/2)
+	}
+	for i := 0; i < len(stripes); i += 2 {
+		pv, ok1 := stripes[i].(string)
+		ext, ok2 := stripes[i+1].(int64)
+		if !ok1 || !ok2 || ext < 0 {
+			return sg, fmt.Errorf("%s: %w: bad stripe %v", s.Name, ErrSyntax, stripes[i:i+2])
+		}
+		sg.Stripes = append(sg.Stripes, StripeRef{PV: pv, Extent: uint64(ext)})
+	}
+	return sg, nil
+}
+
+// PV returns the PV called name, e.g. pv0.
+func (vg *VolumeGroup) PV(name string) *PhysicalVolume {
+	for _, pv := range vg.PVs {
+		if pv.Name == name {
+			return pv
+		}
+	}
+	return nil
+}
+
+// LV returns the LV called name.
+func (vg *VolumeGroup) LV(name string) *LogicalVolume {
+	for _, lv := range vg.LVs {
+		if lv.Name == name {
+			return lv
+		}
+	}
+	return nil
+}
+
+// Select returns all visible LVs of vg, or the named ones if names is not
+// empty. It fails if any of the names is not an LV of vg.
+func (vg *VolumeGroup) Select(names ...string) ([]*LogicalVolume, error) {
+	var lvs []*LogicalVolume
+	if len(names) == 0 {
+		for _, lv := range vg.LVs {
+			if lv.Visible() {
+				lvs = append(lvs, lv)
+			}
+		}
+		return lvs, nil
+	}
+	for _, n := range names {
+		lv := vg.LV(n)
+		if lv == nil {
+			return nil, fmt.Errorf("%s/%s: %w", vg.Name, n, ErrNoLV)
+		}
+		lvs = append(lvs, lv)
+	}
+	return lvs, nil
+}
+
+// Partial reports whether any PV of the VG is missing.
+func (vg *VolumeGroup) Partial() bool {
+	for _, pv := range vg.PVs {
+		if pv.Device == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// DMName returns the device-mapper name of lv, e.g. vg-root. Dashes within
+// the VG and LV names are doubled, as LVM2 does.
+func (vg *VolumeGroup) DMName(lv *LogicalVolume) string {
+	esc := func(s string) string { return strings.ReplaceAll(s, "-", "--") }
+	return esc(vg.Name) + "-" + esc(lv.Name)
+}
+
+// DMUUID returns the device-mapper UUID LVM2 uses for lv.
+func (vg *VolumeGroup) DMUUID(lv *LogicalVolume) string {
+	strip := func(s string) string { return strings.ReplaceAll(s, "-", "") }
+	return "LVM-" + strip(vg.ID) + strip(lv.ID)
+}
+
+// Table builds the device-mapper table for lv.
+func (vg *VolumeGroup) Table(lv *LogicalVolume) (dm.Table, error) {
+	var t dm.Table
+	for _, sg := range lv.Segments {
+		if sg.Type != "striped" {
+			return nil, fmt.Errorf("%s/%s: %w %q", vg.Name, lv.Name, ErrUnsupportedSegment, sg.Type)
+		}
+		var stripes []dm.Stripe
+		for _, st := range sg.Stripes {
+			pv := vg.PV(st.PV)
+			if pv == nil || pv.Device == "" {
+				return nil, fmt.Errorf("%s/%s: %s: %w", vg.Name, lv.Name, st.PV, ErrMissingPV)
+			}
+			stripes = append(stripes, dm.Stripe{
+				Device: pv.Device,
+				Offset: pv.PEStart + st.Extent*vg.ExtentSize,
+			})
+		}
+		e := dm.TableEntry{
+			Start:  sg.StartExtent * vg.ExtentSize,
+			Length: sg.ExtentCount * vg.ExtentSize,
+		}
+		if len(stripes) == 1 {
+			e.Target = dm.Linear{Device: stripes[0].Device, Offset: stripes[0].Offset}
+		} else {
+			e.Target = dm.Striped{ChunkSize: sg.StripeSize, Stripes: stripes}
+		}
+		t = append(t, e)
+	}
+	return t, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verity
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/cmdline"
+)
+
+// ErrNoRootHash is returned when the kernel command line has no root hash.
+var ErrNoRootHash = errors.New("no verity root hash on the kernel command line")
+
+// Config is a verity root device as described on the kernel command line.
+//
+// The parameters are the ones understood by systemd-veritysetup-generator:
+//
+//	roothash=<hex>
+//	systemd.verity_root_data=<device>
+//	systemd.verity_root_hash=<device>
+//	systemd.verity_root_options=<opt>[,<opt>...]
+//
+// Devices may be paths or PARTUUID=, PARTLABEL= or UUID= specifications.
+type Config struct {
+	RootHash   []byte
+	DataDevice string
+	HashDevice string
+	// HashOffset is the byte offset of the superblock on HashDevice.
+	HashOffset uint64
+	// Options are dm-verity optional arguments, e.g. panic_on_corruption.
+	Options []string
+}
+
+// ParseCmdline extracts the verity root configuration from c.
+func ParseCmdline(c *cmdline.CmdLine) (*Config, error) {
+	h, ok := c.Flag("roothash")
+	if !ok {
+		return nil, ErrNoRootHash
+	}
+	root, err := hex.DecodeString(h)
+	if err != nil {
+		return nil, fmt.Errorf("bad root hash %q: %w", h, err)
+	}
+	if len(root) == 0 {
+		return nil, ErrNoRootHash
+	}
+	cfg := &Config{RootHash: root}
+	cfg.DataDevice, _ = c.Flag("systemd.verity_root_data")
+	cfg.HashDevice, _ = c.Flag("systemd.verity_root_hash")
+	if cfg.DataDevice == "" {
+		return nil, fmt.Errorf("systemd.verity_root_data= is required")
+	}
+	if cfg.HashDevice == "" {
+		// Hash tree appended to the data device.
+		cfg.HashDevice = cfg.DataDevice
+	}
+	if opts, ok := c.Flag("systemd.verity_root_options"); ok {
+		if err := cfg.parseOptions(opts); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// kernelOptions maps veritysetup option names to dm-verity arguments.
+var kernelOptions = map[string]string{
+	"ignore-corruption":     "ignore_corruption",
+	"restart-on-corruption": "restart_on_corruption",
+	"panic-on-corruption":   "panic_on_corruption",
+	"ignore-zero-blocks":    "ignore_zero_blocks",
+	"check-at-most-once":    "check_at_most_once",
+}
+
+func (c *Config) parseOptions(s string) error {
+	for _, o := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(o, "=")
+		switch k {
+		case "":
+		case "hash-offset":
+			off, err := strconv.ParseUint(v, 0, 64)
+			if err != nil {
+				return fmt.Errorf("bad hash-offset %q: %w", v, err)
+			}
+			c.HashOffset = off
+		default:
+			ko, ok := kernelOptions[k]
+			if !ok {
+				return fmt.Errorf("unsupported verity option %q", k)
+			}
+			c.Options = append(c.Options, ko)
+		}
+	}
+	return nil
+}
+
+// FromCmdline returns the verity root configuration of the running kernel.
+func FromCmdline() (*Config, error) {
+	return ParseCmdline(cmdline.NewCmdLine())
+}
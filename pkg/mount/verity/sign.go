@@ -0,0 +1,45 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verity
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/u-root/u-root/pkg/vfile"
+)
+
+// VerifyRootHash checks a detached OpenPGP signature of the root hash.
+//
+// The signed message is the lower case hex encoding of the root hash, i.e.
+// the contents of the .roothash file veritysetup users usually sign. A
+// trailing newline in the signed file is accepted.
+//
+// Errors are of type vfile.ErrUnsigned, like vfile.OpenSignedFile's.
+func VerifyRootHash(keyring openpgp.KeyRing, rootHash []byte, sig io.Reader) error {
+	const name = "verity root hash"
+	if keyring == nil {
+		return vfile.ErrUnsigned{Path: name, Err: vfile.ErrNoKeyRing}
+	}
+	sigBytes, err := io.ReadAll(sig)
+	if err != nil {
+		return vfile.ErrUnsigned{Path: name, Err: err}
+	}
+	msg := hex.EncodeToString(rootHash)
+	var lastErr error
+	for _, m := range []string{msg, msg + "\n"} {
+		signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader([]byte(m)), bytes.NewReader(sigBytes), nil)
+		if err == nil && signer != nil {
+			return nil
+		}
+		if err == nil {
+			err = vfile.ErrWrongSigner{KeyRing: keyring}
+		}
+		lastErr = err
+	}
+	return vfile.ErrUnsigned{Path: name, Err: lastErr}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verity
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+var (
+	// ErrRootHashMismatch is returned when the top of the hash tree does
+	// not hash to the expected root hash.
+	ErrRootHashMismatch = errors.New("verity root hash mismatch")
+
+	// ErrHashBlockCorrupt is returned when a block of the hash tree does
+	// not match its parent.
+	ErrHashBlockCorrupt = errors.New("verity hash block is corrupt")
+
+	// ErrDataBlockCorrupt is returned when a data block does not match
+	// the hash tree.
+	ErrDataBlockCorrupt = errors.New("verity data block is corrupt")
+)
+
+// Tree is a dm-verity hash tree.
+type Tree struct {
+	params *Params
+	// Levels holds the hash blocks of each level, leaves first.
+	Levels [][]byte
+	// RootHash is the hash of the top level block.
+	RootHash []byte
+}
+
+// geometry describes the shape of the tree as the kernel computes it.
+type geometry struct {
+	digestSize int
+	// entrySize is the space one digest occupies in a hash block: the
+	// digest padded to a power of two, or, for HashTypeChromeOS, the
+	// digest itself, as the kernel's version 0 format packs them.
+	entrySize int
+	// perBlockBits is log2 of the number of digests per hash block.
+	perBlockBits uint
+	// levelBlocks is the number of hash blocks of each level, leaves first.
+	levelBlocks []uint64
+}
+
+func (p *Params) geometry() (*geometry, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	h, _ := p.hash()
+	g := &geometry{digestSize: h.Size()}
+	hashBlockBits := uint(bits.TrailingZeros32(p.HashBlockSize))
+	g.perBlockBits = uint(bits.Len32(p.HashBlockSize/uint32(g.digestSize)) - 1)
+	g.entrySize = 1 << (hashBlockBits - g.perBlockBits)
+	if p.HashType == HashTypeChromeOS {
+		g.entrySize = g.digestSize
+	}
+
+	// Same as dm-verity's verity_ctr.
+	levels := uint(0)
+	if p.DataBlocks > 0 {
+		for g.perBlockBits*levels < 64 && (p.DataBlocks-1)>>(g.perBlockBits*levels) != 0 {
+			levels++
+		}
+	}
+	for i := uint(0); i < levels; i++ {
+		shift := (i + 1) * g.perBlockBits
+		n := p.DataBlocks >> shift
+		if p.DataBlocks&(1<<shift-1) != 0 {
+			n++
+		}
+		g.levelBlocks = append(g.levelBlocks, n)
+	}
+	return g, nil
+}
+
+// hashBlock returns the salted digest of b.
+func (p *Params) hashBlock(b []byte) []byte {
+	ch, _ := p.hash()
+	h := ch.New()
+	if p.HashType == HashTypeNormal {
+		h.Write(p.Salt)
+		h.Write(b)
+	} else {
+		h.Write(b)
+		h.Write(p.Salt)
+	}
+	return h.Sum(nil)
+}
+
+// ComputeTree computes the hash tree of p.DataBlocks blocks of data.
+func (p *Params) ComputeTree(data io.ReaderAt) (*Tree, error) {
+	g, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree{params: p}
+	blk := make([]byte, p.DataBlockSize)
+	if len(g.levelBlocks) == 0 {
+		if p.DataBlocks == 0 {
+			return nil, fmt.Errorf("%w: no data blocks", ErrInvalidParams)
+		}
+		if _, err := data.ReadAt(blk, 0); err != nil {
+			return nil, err
+		}
+		t.RootHash = p.hashBlock(blk)
+		return t, nil
+	}
+
+	// Leaves: the digests of each data block.
+	var digests [][]byte
+	for i := uint64(0); i < p.DataBlocks; i++ {
+		if _, err := data.ReadAt(blk, int64(i)*int64(p.DataBlockSize)); err != nil {
+			return nil, fmt.Errorf("reading data block %d: %w", i, err)
+		}
+		digests = append(digests, p.hashBlock(blk))
+	}
+
+	for _, n := range g.levelBlocks {
+		level := make([]byte, n*uint64(p.HashBlockSize))
+		for i, d := range digests {
+			// Digests are numbered across the blocks of a level.
+			blk, idx := i>>g.perBlockBits, i&(1<<g.perBlockBits-1)
+			copy(level[blk*int(p.HashBlockSize)+idx*g.entrySize:], d)
+		}
+		t.Levels = append(t.Levels, level)
+
+		digests = digests[:0]
+		for off := 0; off < len(level); off += int(p.HashBlockSize) {
+			digests = append(digests, p.hashBlock(level[off:off+int(p.HashBlockSize)]))
+		}
+	}
+	t.RootHash = digests[0]
+	return t, nil
+}
+
+// WriteTo writes the hash area, i.e. the superblock unless p.NoSuperblock
+// is set, followed by the tree levels from the top down, to w at
+// p.HashOffset.
+func (t *Tree) WriteTo(w io.WriterAt) error {
+	p := t.params
+	if !p.NoSuperblock {
+		sb, err := p.MarshalSuperblock()
+		if err != nil {
+			return err
+		}
+		if _, err := w.WriteAt(sb, int64(p.HashOffset)); err != nil {
+			return err
+		}
+	}
+	off := int64(p.HashStartBlock()) * int64(p.HashBlockSize)
+	for i := len(t.Levels) - 1; i >= 0; i-- {
+		if _, err := w.WriteAt(t.Levels[i], off); err != nil {
+			return err
+		}
+		off += int64(len(t.Levels[i]))
+	}
+	return nil
+}
+
+// Format computes the hash tree of data and writes it to hash, like
+// veritysetup format. It returns the root hash.
+func Format(data io.ReaderAt, hash io.WriterAt, p *Params) ([]byte, error) {
+	t, err := p.ComputeTree(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.WriteTo(hash); err != nil {
+		return nil, err
+	}
+	return t.RootHash, nil
+}
+
+// Verify checks data against the hash tree stored on hash and the trusted
+// root hash, the same way the kernel target does: every hash block is
+// checked against its parent, starting at the root, and then every data
+// block against its leaf.
+func Verify(data, hash io.ReaderAt, p *Params, rootHash []byte) error {
+	g, err := p.geometry()
+	if err != nil {
+		return err
+	}
+	bs := int64(p.HashBlockSize)
+	if len(g.levelBlocks) == 0 {
+		// A single data block hashes straight to the root.
+		blk := make([]byte, p.DataBlockSize)
+		if _, err := data.ReadAt(blk, 0); err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(p.hashBlock(blk), rootHash) != 1 {
+			return ErrRootHashMismatch
+		}
+		return nil
+	}
+
+	// Read the levels, which are stored top level first.
+	levels := make([][]byte, len(g.levelBlocks))
+	off := int64(p.HashStartBlock()) * bs
+	for i := len(levels) - 1; i >= 0; i-- {
+		levels[i] = make([]byte, int64(g.levelBlocks[i])*bs)
+		if _, err := hash.ReadAt(levels[i], off); err != nil {
+			return fmt.Errorf("reading hash level %d: %w", i, err)
+		}
+		off += int64(len(levels[i]))
+	}
+
+	top := levels[len(levels)-1]
+	if subtle.ConstantTimeCompare(p.hashBlock(top), rootHash) != 1 {
+		return ErrRootHashMismatch
+	}
+
+	entry := func(level []byte, idx uint64) []byte {
+		o := int64(idx>>g.perBlockBits)*bs + int64(idx&(1<<g.perBlockBits-1))*int64(g.entrySize)
+		return level[o : o+int64(g.digestSize)]
+	}
+	for i := len(levels) - 2; i >= 0; i-- {
+		for j := uint64(0); j < g.levelBlocks[i]; j++ {
+			b := levels[i][int64(j)*bs : int64(j+1)*bs]
+			if !bytes.Equal(p.hashBlock(b), entry(levels[i+1], j)) {
+				return fmt.Errorf("%w: level %d block %d", ErrHashBlockCorrupt, i, j)
+			}
+		}
+	}
+
+	blk := make([]byte, p.DataBlockSize)
+	for j := uint64(0); j < p.DataBlocks; j++ {
+		if _, err := data.ReadAt(blk, int64(j)*int64(p.DataBlockSize)); err != nil {
+			return fmt.Errorf("reading data block %d: %w", j, err)
+		}
+		if !bytes.Equal(p.hashBlock(blk), entry(levels[0], j)) {
+			return fmt.Errorf("%w: block %d", ErrDataBlockCorrupt, j)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package verity sets up dm-verity verified block devices.
+//
+// It reads the veritysetup on-disk superblock, builds dm-verity tables and
+// can compute and verify the hash tree in Go, without the kernel target.
+package verity
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+
+	// Register the hashes dm-verity images commonly use.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/u-root/u-root/pkg/mount/dm"
+)
+
+const (
+	// SuperblockSize is the size of the veritysetup superblock.
+	SuperblockSize = 512
+
+	maxSaltSize = 256
+)
+
+// Hash types, as stored in the superblock and passed as the table version.
+const (
+	// HashTypeChromeOS appends the salt to the hashed block.
+	HashTypeChromeOS = 0
+	// HashTypeNormal prepends the salt to the hashed block. This is the
+	// veritysetup default.
+	HashTypeNormal = 1
+)
+
+var (
+	superblockMagic = [8]byte{'v', 'e', 'r', 'i', 't', 'y', 0, 0}
+
+	// ErrNoSuperblock is returned when no veritysetup superblock is found.
+	ErrNoSuperblock = errors.New("no verity superblock found")
+
+	// ErrUnsupportedHash is returned for unknown hash algorithms.
+	ErrUnsupportedHash = errors.New("unsupported verity hash algorithm")
+
+	// ErrInvalidParams is returned for parameters the kernel would reject.
+	ErrInvalidParams = errors.New("invalid verity parameters")
+)
+
+// superblock is struct verity_sb from cryptsetup's lib/verity/verity.c.
+type superblock struct {
+	Signature     [8]byte
+	Version       uint32
+	HashType      uint32
+	UUID          [16]byte
+	Algorithm     [32]byte
+	DataBlockSize uint32
+	HashBlockSize uint32
+	DataBlocks    uint64
+	SaltSize      uint16
+	_             [6]byte
+	Salt          [maxSaltSize]byte
+	_             [168]byte
+}
+
+// Params describe a dm-verity hash tree.
+type Params struct {
+	HashType uint32
+	// Algorithm is the hash name as the kernel knows it, e.g. sha256.
+	Algorithm     string
+	DataBlockSize uint32
+	HashBlockSize uint32
+	// DataBlocks is the number of data blocks covered by the tree.
+	DataBlocks uint64
+	Salt       []byte
+	UUID       [16]byte
+
+	// HashOffset is the byte offset of the hash area on the hash device.
+	// Unless NoSuperblock is set, the area begins with the superblock.
+	HashOffset   uint64
+	NoSuperblock bool
+}
+
+// ReadSuperblock reads the veritysetup superblock at offset off of the hash
+// device.
+func ReadSuperblock(r io.ReaderAt, off int64) (*Params, error) {
+	b := make([]byte, SuperblockSize)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil, fmt.Errorf("reading verity superblock: %w", err)
+	}
+	var sb superblock
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &sb); err != nil {
+		return nil, err
+	}
+	if sb.Signature != superblockMagic {
+		return nil, ErrNoSuperblock
+	}
+	if sb.Version != 1 {
+		return nil, fmt.Errorf("%w: superblock version %d", ErrInvalidParams, sb.Version)
+	}
+	if sb.SaltSize > maxSaltSize {
+		return nil, fmt.Errorf("%w: salt size %d", ErrInvalidParams, sb.SaltSize)
+	}
+	p := &Params{
+		HashType:      sb.HashType,
+		Algorithm:     strings.ToLower(string(bytes.TrimRight(sb.Algorithm[:], "\x00"))),
+		DataBlockSize: sb.DataBlockSize,
+		HashBlockSize: sb.HashBlockSize,
+		DataBlocks:    sb.DataBlocks,
+		Salt:          append([]byte(nil), sb.Salt[:sb.SaltSize]...),
+		UUID:          sb.UUID,
+		HashOffset:    uint64(off),
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MarshalSuperblock encodes p as a veritysetup superblock.
+func (p *Params) MarshalSuperblock() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	sb := superblock{
+		Signature:     superblockMagic,
+		Version:       1,
+		HashType:      p.HashType,
+		UUID:          p.UUID,
+		DataBlockSize: p.DataBlockSize,
+		HashBlockSize: p.HashBlockSize,
+		DataBlocks:    p.DataBlocks,
+		SaltSize:      uint16(len(p.Salt)),
+	}
+	copy(sb.Algorithm[:], p.Algorithm)
+	copy(sb.Salt[:], p.Salt)
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, &sb); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+var hashes = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+func (p *Params) hash() (crypto.Hash, error) {
+	h, ok := hashes[p.Algorithm]
+	if !ok || !h.Available() {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedHash, p.Algorithm)
+	}
+	return h, nil
+}
+
+func validBlockSize(s uint32) bool {
+	return s >= 512 && s <= 1<<20 && bits.OnesCount32(s) == 1
+}
+
+// Validate checks p for values the kernel would reject.
+func (p *Params) Validate() error {
+	if p.HashType > HashTypeNormal {
+		return fmt.Errorf("%w: hash type %d", ErrInvalidParams, p.HashType)
+	}
+	if !validBlockSize(p.DataBlockSize) || !validBlockSize(p.HashBlockSize) {
+		return fmt.Errorf("%w: block sizes %d/%d", ErrInvalidParams, p.DataBlockSize, p.HashBlockSize)
+	}
+	if len(p.Salt) > maxSaltSize {
+		return fmt.Errorf("%w: salt size %d", ErrInvalidParams, len(p.Salt))
+	}
+	h, err := p.hash()
+	if err != nil {
+		return err
+	}
+	if uint32(h.Size()) > p.HashBlockSize/2 {
+		return fmt.Errorf("%w: %s digests do not fit twice in a %d byte block", ErrInvalidParams, p.Algorithm, p.HashBlockSize)
+	}
+	return nil
+}
+
+// HashStartBlock returns the block, in HashBlockSize units, of the root of
+// the hash tree on the hash device.
+func (p *Params) HashStartBlock() uint64 {
+	off := p.HashOffset
+	if !p.NoSuperblock {
+		off += SuperblockSize
+	}
+	bs := uint64(p.HashBlockSize)
+	return (off + bs - 1) / bs
+}
+
+// DataSize returns the size in bytes of the verified data.
+func (p *Params) DataSize() uint64 {
+	return p.DataBlocks * uint64(p.DataBlockSize)
+}
+
+// Target returns the dm-verity target for the given devices and root hash.
+func (p *Params) Target(dataDev, hashDev string, rootHash []byte, opts ...string) dm.Verity {
+	return dm.Verity{
+		Version:        int(p.HashType),
+		DataDevice:     dataDev,
+		HashDevice:     hashDev,
+		DataBlockSize:  p.DataBlockSize,
+		HashBlockSize:  p.HashBlockSize,
+		NumDataBlocks:  p.DataBlocks,
+		HashStartBlock: p.HashStartBlock(),
+		Algorithm:      p.Algorithm,
+		RootHash:       rootHash,
+		Salt:           p.Salt,
+		Options:        opts,
+	}
+}
+
+// Table returns a single entry dm-verity table covering all data blocks.
+func (p *Params) Table(dataDev, hashDev string, rootHash []byte, opts ...string) dm.Table {
+	return dm.Table{{
+		Start:  0,
+		Length: p.DataSize() / dm.SectorSize,
+		Target: p.Target(dataDev, hashDev, rootHash, opts...),
+	}}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verity
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/mount/dm"
+)
+
+// Open reads the superblock at hashOffset on hashDev and creates a
+// read-only dm-verity device called name.
+//
+// rootHash must come from a trusted source, e.g. a signed kernel command
+// line or a root hash checked with VerifyRootHash.
+func Open(name, dataDev, hashDev string, hashOffset uint64, rootHash []byte, opts ...string) (*dm.Device, error) {
+	f, err := os.Open(hashDev)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ReadSuperblock(f, int64(hashOffset))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hashDev, err)
+	}
+	return OpenParams(name, dataDev, hashDev, p, rootHash, opts...)
+}
+
+// OpenParams creates a read-only dm-verity device called name from explicit
+// parameters, e.g. for a hash device without a superblock.
+func OpenParams(name, dataDev, hashDev string, p *Params, rootHash []byte, opts ...string) (*dm.Device, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return dm.New(name, "", p.Table(dataDev, hashDev, rootHash, opts...), true)
+}
+
+// Open resolves the devices of c and creates a dm-verity device called
+// name.
+func (c *Config) Open(name string) (*dm.Device, error) {
+	data, err := ResolveDevice(c.DataDevice)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := ResolveDevice(c.HashDevice)
+	if err != nil {
+		return nil, err
+	}
+	return Open(name, data, hash, c.HashOffset, c.RootHash, c.Options...)
+}
+
+// ResolveDevice turns a device specification, i.e. a path or a
+// PARTUUID=, PARTLABEL= or UUID= reference, into a device path.
+func ResolveDevice(spec string) (string, error) {
+	kind, val, ok := strings.Cut(spec, "=")
+	if !ok {
+		return spec, nil
+	}
+	devs, err := block.GetBlockDevices()
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case "PARTUUID":
+		devs = devs.FilterPartID(val)
+	case "PARTLABEL":
+		devs = devs.FilterPartLabel(val)
+	case "UUID":
+		devs = devs.FilterFSUUID(val)
+	default:
+		return "", fmt.Errorf("unsupported device specification %q", spec)
+	}
+	if len(devs) == 0 {
+		return "", fmt.Errorf("%s: %w", spec, os.ErrNotExist)
+	}
+	return devs[0].DevicePath(), nil
+}
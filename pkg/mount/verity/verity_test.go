@@ -0,0 +1,369 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/vfile"
+)
+
+func testParams(blocks uint64) *Params {
+	return &Params{
+		HashType:      HashTypeNormal,
+		Algorithm:     "sha256",
+		DataBlockSize: 512,
+		HashBlockSize: 512,
+		DataBlocks:    blocks,
+		Salt:          []byte{0x01, 0x02, 0x03, 0x04},
+		UUID:          [16]byte{1, 2, 3},
+	}
+}
+
+func tempFile(t *testing.T, name string, content []byte) *os.File {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func randomData(blocks uint64, bs uint32) []byte {
+	b := make([]byte, blocks*uint64(bs))
+	rand.New(rand.NewSource(int64(blocks))).Read(b)
+	return b
+}
+
+func TestSuperblock(t *testing.T) {
+	p := testParams(1234)
+	p.HashOffset = 4096
+	sb, err := p.MarshalSuperblock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sb) != SuperblockSize {
+		t.Fatalf("superblock is %d bytes, want %d", len(sb), SuperblockSize)
+	}
+	img := append(make([]byte, 4096), sb...)
+	got, err := ReadSuperblock(bytes.NewReader(img), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(p, got); diff != "" {
+		t.Errorf("ReadSuperblock (-want +got):\n%s", diff)
+	}
+	if _, err := ReadSuperblock(bytes.NewReader(img), 0); !errors.Is(err, ErrNoSuperblock) {
+		t.Errorf("ReadSuperblock(0) = %v, want %v", err, ErrNoSuperblock)
+	}
+
+	// The tree starts at the first hash block after the superblock.
+	if got := p.HashStartBlock(); got != 9 {
+		t.Errorf("HashStartBlock() = %d, want 9", got)
+	}
+	p.NoSuperblock = true
+	if got := p.HashStartBlock(); got != 8 {
+		t.Errorf("HashStartBlock() without superblock = %d, want 8", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(p *Params)
+		want   error
+	}{
+		{"ok", func(p *Params) {}, nil},
+		{"hash", func(p *Params) { p.Algorithm = "md4" }, ErrUnsupportedHash},
+		{"block size", func(p *Params) { p.DataBlockSize = 1000 }, ErrInvalidParams},
+		{"hash type", func(p *Params) { p.HashType = 2 }, ErrInvalidParams},
+		{"salt", func(p *Params) { p.Salt = make([]byte, 257) }, ErrInvalidParams},
+		{"sha512 small block", func(p *Params) { p.Algorithm = "sha512" }, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testParams(8)
+			tt.modify(p)
+			if err := p.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestSingleLevel checks the layout of a one level tree against a hand
+// computed one.
+func TestSingleLevel(t *testing.T) {
+	p := testParams(3)
+	p.Salt = nil
+	data := randomData(3, 512)
+
+	leaf := make([]byte, 512)
+	for i := 0; i < 3; i++ {
+		h := sha256.Sum256(data[i*512 : (i+1)*512])
+		copy(leaf[i*32:], h[:])
+	}
+	wantRoot := sha256.Sum256(leaf)
+
+	tree, err := p.ComputeTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Levels) != 1 || !bytes.Equal(tree.Levels[0], leaf) {
+		t.Errorf("leaf level mismatch")
+	}
+	if !bytes.Equal(tree.RootHash, wantRoot[:]) {
+		t.Errorf("root = %x, want %x", tree.RootHash, wantRoot)
+	}
+}
+
+func TestFormatVerify(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		blocks uint64
+		levels int
+		modify func(p *Params)
+	}{
+		{name: "one block", blocks: 1, levels: 0},
+		{name: "one level", blocks: 16, levels: 1},
+		{name: "three levels", blocks: 300, levels: 3},
+		{name: "chromeos", blocks: 40, levels: 2, modify: func(p *Params) { p.HashType = HashTypeChromeOS }},
+		{name: "sha1 padded entries", blocks: 40, levels: 2, modify: func(p *Params) { p.Algorithm = "sha1" }},
+		{name: "hash offset", blocks: 40, levels: 2, modify: func(p *Params) { p.HashOffset = 8192 }},
+		{name: "no superblock", blocks: 40, levels: 2, modify: func(p *Params) { p.NoSuperblock = true }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testParams(tt.blocks)
+			if tt.modify != nil {
+				tt.modify(p)
+			}
+			data := tempFile(t, "data", randomData(tt.blocks, p.DataBlockSize))
+			hash := tempFile(t, "hash", nil)
+
+			tree, err := p.ComputeTree(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tree.Levels) != tt.levels {
+				t.Errorf("got %d levels, want %d", len(tree.Levels), tt.levels)
+			}
+			root, err := Format(data, hash, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(root, tree.RootHash) {
+				t.Errorf("Format root %x != ComputeTree root %x", root, tree.RootHash)
+			}
+			if err := Verify(data, hash, p, root); err != nil {
+				t.Fatalf("Verify() = %v", err)
+			}
+			if !p.NoSuperblock {
+				sp, err := ReadSuperblock(hash, int64(p.HashOffset))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := Verify(data, hash, sp, root); err != nil {
+					t.Errorf("Verify() with superblock params = %v", err)
+				}
+			}
+
+			bad := append([]byte(nil), root...)
+			bad[0] ^= 1
+			if err := Verify(data, hash, p, bad); !errors.Is(err, ErrRootHashMismatch) {
+				t.Errorf("Verify(bad root) = %v, want %v", err, ErrRootHashMismatch)
+			}
+
+			// Flip a bit in the last data block.
+			last := int64(tt.blocks-1) * int64(p.DataBlockSize)
+			b := make([]byte, 1)
+			data.ReadAt(b, last)
+			b[0] ^= 0x80
+			data.WriteAt(b, last)
+			wantErr := ErrDataBlockCorrupt
+			if tt.levels == 0 {
+				wantErr = ErrRootHashMismatch
+			}
+			if err := Verify(data, hash, p, root); !errors.Is(err, wantErr) {
+				t.Errorf("Verify(corrupt data) = %v, want %v", err, wantErr)
+			}
+			if tt.levels == 0 {
+				return
+			}
+			if err := Verify(data, hash, p, root); err == nil || !strings.Contains(err.Error(), "block") {
+				t.Errorf("Verify(corrupt data) error %v does not name the block", err)
+			}
+
+			if tt.levels > 1 {
+				// Corrupt the leaf level, which is stored last.
+				b[0] ^= 0x80
+				data.WriteAt(b, last)
+				fi, _ := hash.Stat()
+				hash.WriteAt([]byte{0xff}, fi.Size()-1)
+				if err := Verify(data, hash, p, root); !errors.Is(err, ErrHashBlockCorrupt) {
+					t.Errorf("Verify(corrupt hash) = %v, want %v", err, ErrHashBlockCorrupt)
+				}
+			}
+		})
+	}
+}
+
+// TestChromeOSSHA1 checks a tree against one made by veritysetup format
+// --format=0 --hash=sha1 --data-block-size=512 --hash-block-size=512
+// --data-blocks=40 --salt=01020304 --no-superblock, whose sha1 digests are
+// packed 20 bytes apart rather than padded to 32.
+func TestChromeOSSHA1(t *testing.T) {
+	want, err := os.ReadFile("testdata/chromeos-sha1.hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRoot, _ := hex.DecodeString("daac7ea016a023c3b8f7137136bfb3e14c95c795")
+	p := testParams(40)
+	p.HashType = HashTypeChromeOS
+	p.Algorithm = "sha1"
+	p.NoSuperblock = true
+	data := make([]byte, 40*512)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	tree, err := p.ComputeTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tree.RootHash, wantRoot) {
+		t.Errorf("root = %x, want %x", tree.RootHash, wantRoot)
+	}
+	hash := tempFile(t, "hash", nil)
+	if err := tree.WriteTo(hash); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(hash.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("hash area differs from veritysetup's")
+	}
+	if err := Verify(bytes.NewReader(data), bytes.NewReader(want), p, wantRoot); err != nil {
+		t.Errorf("Verify(veritysetup tree) = %v", err)
+	}
+}
+
+func TestTable(t *testing.T) {
+	p := testParams(2048)
+	root, _ := hex.DecodeString("abcd")
+	got := p.Table("/dev/sda1", "/dev/sda2", root, "panic_on_corruption").String()
+	want := "0 2048 verity 1 /dev/sda1 /dev/sda2 512 512 2048 1 sha256 abcd 01020304 1 panic_on_corruption"
+	if got != want {
+		t.Errorf("Table() = %q, want %q", got, want)
+	}
+}
+
+func TestParseCmdline(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		flags   map[string]string
+		want    *Config
+		wantErr error
+	}{
+		{
+			name: "full",
+			flags: map[string]string{
+				"roothash":                    "00ff",
+				"systemd.verity_root_data":    "PARTUUID=1234",
+				"systemd.verity_root_hash":    "/dev/vda3",
+				"systemd.verity_root_options": "hash-offset=4096,panic-on-corruption",
+			},
+			want: &Config{
+				RootHash:   []byte{0, 0xff},
+				DataDevice: "PARTUUID=1234",
+				HashDevice: "/dev/vda3",
+				HashOffset: 4096,
+				Options:    []string{"panic_on_corruption"},
+			},
+		},
+		{
+			name: "appended tree",
+			flags: map[string]string{
+				"roothash":                 "01",
+				"systemd.verity_root_data": "/dev/vda2",
+			},
+			want: &Config{RootHash: []byte{1}, DataDevice: "/dev/vda2", HashDevice: "/dev/vda2"},
+		},
+		{
+			name:    "no root hash",
+			flags:   map[string]string{"systemd.verity_root_data": "/dev/vda2"},
+			wantErr: ErrNoRootHash,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCmdline(&cmdline.CmdLine{AsMap: tt.flags})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseCmdline() = %v, want %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseCmdline() (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, bad := range []map[string]string{
+		{"roothash": "zz", "systemd.verity_root_data": "/dev/a"},
+		{"roothash": "00"},
+		{"roothash": "00", "systemd.verity_root_data": "/dev/a", "systemd.verity_root_options": "bogus"},
+	} {
+		if _, err := ParseCmdline(&cmdline.CmdLine{AsMap: bad}); err == nil {
+			t.Errorf("ParseCmdline(%v) = nil error", bad)
+		}
+	}
+}
+
+func TestVerifyRootHash(t *testing.T) {
+	conf := &packet.Config{RSABits: 1024}
+	key, err := openpgp.NewEntity("verity", "test", "verity@example.com", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "test", "other@example.com", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, key, strings.NewReader("deadbeef\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRootHash(openpgp.EntityList{key}, root, bytes.NewReader(sig.Bytes())); err != nil {
+		t.Errorf("VerifyRootHash() = %v", err)
+	}
+
+	var ue vfile.ErrUnsigned
+	if err := VerifyRootHash(openpgp.EntityList{other}, root, bytes.NewReader(sig.Bytes())); !errors.As(err, &ue) {
+		t.Errorf("VerifyRootHash(wrong key) = %v, want ErrUnsigned", err)
+	}
+	if err := VerifyRootHash(openpgp.EntityList{key}, []byte{1}, bytes.NewReader(sig.Bytes())); err == nil {
+		t.Errorf("VerifyRootHash(wrong hash) = nil error")
+	}
+	if err := VerifyRootHash(nil, root, bytes.NewReader(sig.Bytes())); !errors.Is(err, vfile.ErrNoKeyRing) {
+		t.Errorf("VerifyRootHash(nil) = %v, want %v", err, vfile.ErrNoKeyRing)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package namespace
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ninePort is the port of 9P servers, 9fs.
+const ninePort = "564"
+
+// ninep returns the source and options of the v9fs mount of the 9P server
+// servername, and the file, if any, to close once mounted. servername is
+//
+//   - a dial string, tcp!host[!port], unix!path or fd!rfd[!wfd], of file
+//     descriptors open in this process,
+//   - host[:port], of a TCP server,
+//   - or a path, of a Unix domain socket, or of a file, like a pipe or a
+//     virtio port, to open and mount.
+//
+// The kernel resolves no names, so host is resolved here.
+func ninep(servername string) (string, string, *os.File, error) {
+	proto, addr, ok := strings.Cut(servername, "!")
+	if !ok {
+		if !strings.Contains(servername, "/") {
+			proto, addr = "tcp", servername
+			if host, port, err := net.SplitHostPort(servername); err == nil {
+				addr = host + "!" + port
+			}
+		} else if fi, err := os.Stat(servername); err != nil {
+			return "", "", nil, err
+		} else if fi.Mode()&os.ModeSocket != 0 {
+			proto, addr = "unix", servername
+		} else {
+			f, err := os.OpenFile(servername, os.O_RDWR, 0)
+			if err != nil {
+				return "", "", nil, err
+			}
+			return servername, fmt.Sprintf("trans=fd,rfdno=%d,wfdno=%d", f.Fd(), f.Fd()), f, nil
+		}
+	}
+
+	switch proto {
+	case "tcp", "net":
+		host, port, ok := strings.Cut(addr, "!")
+		if !ok {
+			port = ninePort
+		}
+		p, err := net.LookupPort("tcp", port)
+		if err != nil {
+			return "", "", nil, err
+		}
+		ip, err := net.ResolveIPAddr("ip", host)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return ip.IP.String(), fmt.Sprintf("trans=tcp,port=%d", p), nil, nil
+	case "unix":
+		return addr, "trans=unix", nil, nil
+	case "fd":
+		r, w, ok := strings.Cut(addr, "!")
+		if !ok {
+			w = r
+		}
+		for _, fd := range []string{r, w} {
+			if _, err := strconv.Atoi(fd); err != nil {
+				return "", "", nil, fmt.Errorf("%q: bad file descriptor %q", servername, fd)
+			}
+		}
+		return servername, fmt.Sprintf("trans=fd,rfdno=%s,wfdno=%s", r, w), nil, nil
+	}
+	return "", "", nil, fmt.Errorf("%q: unknown network %q", servername, proto)
+}
+
+// Mount mounts the 9P server servername, described at ninep, on old with
+// the kernel v9fs client. spec is the tree to attach to, and CACHE turns on
+// its caching.
+//
+// The server of a union directory is mounted on a directory in
+// os.TempDir, which the overlayfs mount can only use in this name space.
+func (ns *unixnamespace) Mount(servername string, old string, spec string, flag mountflag) error {
+	old, err := filepath.Abs(old)
+	if err != nil {
+		return err
+	}
+	source, opts, f, err := ninep(servername)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		defer f.Close()
+	}
+	if spec != "" {
+		opts += ",aname=" + spec
+	}
+	if flag&CACHE != 0 {
+		opts += ",cache=loose"
+	}
+
+	if flag&(BEFORE|AFTER) == 0 {
+		if err := ns.detach(old); err != nil {
+			return err
+		}
+		if err := unix.Mount(source, old, "9p", 0, opts); err != nil {
+			return &os.PathError{Op: "mount 9p", Path: old, Err: err}
+		}
+		return nil
+	}
+	mnt, err := os.MkdirTemp("", "ns9p")
+	if err != nil {
+		return err
+	}
+	if err := unix.Mount(source, mnt, "9p", 0, opts); err != nil {
+		os.Remove(mnt)
+		return &os.PathError{Op: "mount 9p", Path: mnt, Err: err}
+	}
+	l := &layer{name: servername, create: flag&CREATE != 0, mnt: mnt}
+	if l.dir, err = openPath(mnt); err != nil {
+		unix.Unmount(mnt, unix.MNT_DETACH)
+		os.Remove(mnt)
+		return err
+	}
+	return ns.add(old, l, flag&BEFORE != 0)
+}
+
+// Import imports a name space from a remote system
+//
+// Linux has no exportfs, so Import mounts the 9P server of host, at the
+// 9fs port unless host is a dial string with another, and attaches to
+// remotepath.
+func (ns *unixnamespace) Import(host string, remotepath string, mountpoint string, flag mountflag) error {
+	if !strings.Contains(host, "!") {
+		host = "tcp!" + host
+	}
+	return ns.Mount(host, mountpoint, remotepath, flag)
+}
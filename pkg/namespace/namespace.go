@@ -72,8 +72,13 @@ func buildNS(ns Namespace, nsfile, user string, new bool) error {
 	if ns == nil {
 		ns = DefaultNamespace
 	}
+	if nsfile == "" {
+		nsfile = "/lib/namespace"
+	}
 	if new {
-		ns.Clear()
+		if err := ns.Clear(); err != nil {
+			return err
+		}
 	}
 	r, err := NewBuilder()
 	if err != nil {
@@ -0,0 +1,261 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package namespace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// unixnamespace modifies the mount namespace of Linux.
+//
+// Binds are bind mounts, and the union directories of BEFORE and AFTER
+// are overlayfs mounts, whose layers are kept open to rebuild the union
+// when a directory is added to or removed from it. The first layer bound
+// with CREATE is the upper directory of the overlay, which is searched
+// first, unlike on Plan 9, and overlayfs needs a work directory next to
+// it, on the same file system, named .NAME.nswork.
+//
+// The layers are named by their /proc/self/fd links, so /proc must be
+// mounted.
+type unixnamespace struct {
+	unions map[string]*union
+}
+
+// layer is a directory of a union directory.
+type layer struct {
+	// name is the path bound, by which it is unmounted.
+	name string
+	// dir is opened with O_PATH.
+	dir    *os.File
+	create bool
+	// mnt is where a server mounted in the union is mounted.
+	mnt string
+}
+
+func (l *layer) close() {
+	l.dir.Close()
+	if l.mnt != "" {
+		unix.Unmount(l.mnt, unix.MNT_DETACH)
+		os.Remove(l.mnt)
+	}
+}
+
+type union struct {
+	layers  []*layer
+	mounted bool
+}
+
+// openPath opens name with O_PATH. Its /proc/self/fd link names it even
+// once mounts cover it, and whatever characters it has.
+func openPath(name string) (*os.File, error) {
+	fd, err := unix.Open(name, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+func fdPath(f *os.File) string {
+	return fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+}
+
+// Bind binds new on old.
+func (ns *unixnamespace) Bind(new string, old string, flag mountflag) error {
+	old, err := filepath.Abs(old)
+	if err != nil {
+		return err
+	}
+	// Open new first, as it may be in the union old is.
+	f, err := openPath(new)
+	if err != nil {
+		return err
+	}
+	if flag&(BEFORE|AFTER) == 0 {
+		defer f.Close()
+		if err := ns.detach(old); err != nil {
+			return err
+		}
+		if err := unix.Mount(fdPath(f), old, "", unix.MS_BIND, ""); err != nil {
+			return &os.PathError{Op: "bind", Path: old, Err: err}
+		}
+		return nil
+	}
+	name, err := filepath.Abs(new)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return ns.add(old, &layer{name: name, dir: f, create: flag&CREATE != 0}, flag&BEFORE != 0)
+}
+
+// add adds l to the union directory at old, at its beginning if before.
+func (ns *unixnamespace) add(old string, l *layer, before bool) error {
+	if ns.unions == nil {
+		ns.unions = map[string]*union{}
+	}
+	u, ok := ns.unions[old]
+	if !ok {
+		f, err := openPath(old)
+		if err != nil {
+			l.close()
+			return err
+		}
+		u = &union{layers: []*layer{{name: old, dir: f}}}
+	}
+	layers := u.layers
+	if before {
+		u.layers = append([]*layer{l}, layers...)
+	} else {
+		u.layers = append(layers[:len(layers):len(layers)], l)
+	}
+	if err := ns.remount(old, u); err != nil {
+		u.layers = layers
+		l.close()
+		if !ok {
+			layers[0].close()
+		} else if !u.mounted {
+			// Put back the union it replaced.
+			ns.remount(old, u)
+		}
+		return err
+	}
+	ns.unions[old] = u
+	return nil
+}
+
+// remount mounts the union directory u at old, replacing that mounted
+// before.
+func (ns *unixnamespace) remount(old string, u *union) error {
+	var lower []string
+	var upper *layer
+	for _, l := range u.layers {
+		if l.create && upper == nil {
+			upper = l
+			continue
+		}
+		lower = append(lower, fdPath(l.dir))
+	}
+	opts := "lowerdir=" + strings.Join(lower, ":")
+	if upper != nil {
+		work := filepath.Join(filepath.Dir(upper.name), "."+filepath.Base(upper.name)+".nswork")
+		if err := os.Mkdir(work, 0o700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		w, err := openPath(work)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		opts += ",upperdir=" + fdPath(upper.dir) + ",workdir=" + fdPath(w)
+	}
+	if u.mounted {
+		if err := unix.Unmount(old, unix.MNT_DETACH); err != nil {
+			return &os.PathError{Op: "unmount", Path: old, Err: err}
+		}
+		u.mounted = false
+	}
+	if err := unix.Mount("overlay", old, "overlay", 0, opts); err != nil {
+		return &os.PathError{Op: "mount overlay", Path: old, Err: err}
+	}
+	u.mounted = true
+	return nil
+}
+
+// detach unmounts the union directory at old, if there is one.
+func (ns *unixnamespace) detach(old string) error {
+	u, ok := ns.unions[old]
+	if !ok {
+		return nil
+	}
+	if u.mounted {
+		if err := unix.Unmount(old, unix.MNT_DETACH); err != nil {
+			return &os.PathError{Op: "unmount", Path: old, Err: err}
+		}
+	}
+	for _, l := range u.layers {
+		l.close()
+	}
+	delete(ns.unions, old)
+	return nil
+}
+
+// Unmount unmounts new from old, or everything mounted on old if new is missing.
+func (ns *unixnamespace) Unmount(new string, old string) error {
+	old, err := filepath.Abs(old)
+	if err != nil {
+		return err
+	}
+	u, ok := ns.unions[old]
+	if !ok || new == "" {
+		if ok {
+			if err := ns.detach(old); err != nil {
+				return err
+			}
+		} else if err := unix.Unmount(old, 0); err != nil {
+			return &os.PathError{Op: "unmount", Path: old, Err: err}
+		}
+		// Unmount what else is mounted on old.
+		for new == "" {
+			if err := unix.Unmount(old, 0); err != nil {
+				break
+			}
+		}
+		return nil
+	}
+	name, err := filepath.Abs(new)
+	if err != nil {
+		return err
+	}
+	for i, l := range u.layers {
+		if l.name != name {
+			continue
+		}
+		if len(u.layers) == 2 {
+			return ns.detach(old)
+		}
+		layers := u.layers
+		u.layers = append(layers[:i:i], layers[i+1:]...)
+		if err := ns.remount(old, u); err != nil {
+			u.layers = layers
+			if !u.mounted {
+				ns.remount(old, u)
+			}
+			return err
+		}
+		l.close()
+		return nil
+	}
+	return fmt.Errorf("unmount %s %s: %w", new, old, os.ErrNotExist)
+}
+
+// Clear gives the calling thread a new mount namespace, a copy of the
+// current one that mounts do not propagate to or from. Linux has no empty
+// name space like that of rfork(RFCNAMEG), so bind or mount what the new
+// name space should have over what it should not.
+//
+// Mount namespaces are per thread, so Clear locks the calling goroutine to
+// its thread for good: modify the name space, and run programs in it, from
+// that goroutine.
+func (ns *unixnamespace) Clear() error {
+	runtime.LockOSThread()
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("unshare: %w", err)
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+	return nil
+}
+
+// Chdir changes the working directory to dir.
+func (ns *unixnamespace) Chdir(dir string) error {
+	return os.Chdir(dir)
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package namespace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+// inNS runs f in a new mount namespace, on a thread that exits with it.
+func inNS(t *testing.T, f func(ns *unixnamespace)) {
+	t.Helper()
+	if os.Getuid() != 0 {
+		t.Skip("not root")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ns := &unixnamespace{}
+		if err := ns.Clear(); err != nil {
+			t.Errorf("Clear() = %v", err)
+			return
+		}
+		f(ns)
+	}()
+	<-done
+}
+
+func ls(t *testing.T, dir string) string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestLinuxNamespace(t *testing.T) {
+	d := t.TempDir()
+	inNS(t, func(ns *unixnamespace) {
+		// overlayfs upper directories must be on a file system like tmpfs.
+		if err := unix.Mount("tmpfs", d, "tmpfs", 0, ""); err != nil {
+			t.Errorf("mounting tmpfs: %v", err)
+			return
+		}
+		for _, f := range []string{"a/x", "a/f", "b/y", "b/f", "c/z", "d/"} {
+			dir, file := filepath.Split(f)
+			if err := os.MkdirAll(filepath.Join(d, dir), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if file != "" {
+				if err := os.WriteFile(filepath.Join(d, f), []byte(f), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		a, b, c, dd := filepath.Join(d, "a"), filepath.Join(d, "b"), filepath.Join(d, "c"), filepath.Join(d, "d")
+
+		for _, tt := range []struct {
+			name string
+			op   func() error
+			ls   string
+			f    string
+		}{
+			{name: "bind", op: func() error { return ns.Bind(a, c, REPL) }, ls: "f x", f: "a/f"},
+			{name: "bind -a", op: func() error { return ns.Bind(b, c, AFTER) }, ls: "f x y", f: "a/f"},
+			{name: "unmount b", op: func() error { return ns.Unmount(b, c) }, ls: "f x", f: "a/f"},
+			{name: "bind -bc", op: func() error {
+				if err := ns.Bind(b, c, BEFORE|CREATE); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(c, "new"), nil, 0o644)
+			}, ls: "f new x y", f: "b/f"},
+			{name: "unmount", op: func() error { return ns.Unmount("", c) }, ls: "z"},
+			{name: "bind file", op: func() error { return ns.Bind(filepath.Join(b, "f"), filepath.Join(c, "z"), REPL) }, ls: "z"},
+			{name: "unmount file", op: func() error { return ns.Unmount("", filepath.Join(c, "z")) }, ls: "z"},
+			{name: "bind -a new", op: func() error { return ns.Bind(dd, c, AFTER) }, ls: "z"},
+			{name: "bind from union", op: func() error { return ns.Bind(filepath.Join(c, "z"), filepath.Join(b, "f"), REPL) }, ls: "z"},
+		} {
+			if err := tt.op(); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				return
+			}
+			if got := ls(t, c); got != tt.ls {
+				t.Errorf("%s: ls = %q, want %q", tt.name, got, tt.ls)
+			}
+			if tt.f == "" {
+				continue
+			}
+			if got, err := os.ReadFile(filepath.Join(c, "f")); err != nil || string(got) != tt.f {
+				t.Errorf("%s: f = %q, %v, want %q", tt.name, got, err, tt.f)
+			}
+		}
+		// Files created in the union are in the directory bound with -c.
+		if _, err := os.Stat(filepath.Join(b, "new")); err != nil {
+			t.Errorf("created file is not in %s: %v", b, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(b, "f")); err != nil || string(got) != "c/z" {
+			t.Errorf("bound file = %q, %v, want %q", got, err, "c/z")
+		}
+		if err := ns.Unmount(a, c); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Unmount(a, c) = %v, want %v", err, os.ErrNotExist)
+		}
+
+		if err := ns.Chdir(c); err != nil {
+			t.Fatal(err)
+		}
+		if wd, err := os.Getwd(); err != nil || wd != c {
+			t.Errorf("Getwd() = %q, %v, want %q", wd, err, c)
+		}
+	})
+	// None of it is seen outside.
+	if got := ls(t, d); got != "" {
+		t.Errorf("ls %s = %q outside the name space, want none", d, got)
+	}
+}
+
+func TestNinep(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "sock")
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrUnix{Name: sock}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		server string
+		source string
+		opts   string
+		err    bool
+	}{
+		{server: "tcp!127.0.0.1!5640", source: "127.0.0.1", opts: "trans=tcp,port=5640"},
+		{server: "tcp!127.0.0.1", source: "127.0.0.1", opts: "trans=tcp,port=564"},
+		{server: "net!localhost!564", source: "127.0.0.1", opts: "trans=tcp,port=564"},
+		{server: "[::1]:5640", source: "::1", opts: "trans=tcp,port=5640"},
+		{server: "127.0.0.1", source: "127.0.0.1", opts: "trans=tcp,port=564"},
+		{server: "unix!/run/9p", source: "/run/9p", opts: "trans=unix"},
+		{server: sock, source: sock, opts: "trans=unix"},
+		{server: "fd!3", source: "fd!3", opts: "trans=fd,rfdno=3,wfdno=3"},
+		{server: "fd!3!4", source: "fd!3!4", opts: "trans=fd,rfdno=3,wfdno=4"},
+		{server: "fd!x", err: true},
+		{server: "il!host", err: true},
+		{server: "/does/not/exist", err: true},
+	} {
+		source, opts, f, err := ninep(tt.server)
+		if f != nil {
+			f.Close()
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("ninep(%q) = %v, want error %v", tt.server, err, tt.err)
+			continue
+		}
+		if diff := cmp.Diff([]string{tt.source, tt.opts}, []string{source, opts}); !tt.err && diff != "" {
+			t.Errorf("ninep(%q) (-want, +got): %s", tt.server, diff)
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, opts, f, err := ninep(fdPath(w)); err != nil || !strings.HasPrefix(opts, "trans=fd,") || f == nil {
+		t.Errorf("ninep(pipe) = %q, %v, %v, want trans=fd", opts, f, err)
+	} else {
+		f.Close()
+	}
+}
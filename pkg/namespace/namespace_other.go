@@ -0,0 +1,40 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9 && !linux
+// +build !plan9,!linux
+
+package namespace
+
+type unixnamespace struct{}
+
+// Bind binds new on old.
+func (ns *unixnamespace) Bind(new string, old string, flag mountflag) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Mount mounts servename on old.
+func (ns *unixnamespace) Mount(servername string, old string, spec string, flag mountflag) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Unmount unmounts new from old, or everything mounted on old if new is missing.
+func (ns *unixnamespace) Unmount(new string, old string) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Clear clears the name space with rfork(RFCNAMEG).
+func (ns *unixnamespace) Clear() error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Chdir changes the working directory to dir.
+func (ns *unixnamespace) Chdir(dir string) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Import imports a name space from a remote system
+func (ns *unixnamespace) Import(host string, remotepath string, mountpoint string, flag mountflag) error {
+	panic("not implemented") // TODO: Implement
+}
@@ -6,6 +6,7 @@ package ntpdate
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -21,6 +22,8 @@ const DefaultNTPConfig = "/etc/ntp.conf"
 
 var Debug = func(string, ...interface{}) {}
 
+var errNoServers = errors.New("no servers")
+
 func parseServers(r *bufio.Reader) []string {
 	var uri []string
 	var l string
@@ -89,7 +92,9 @@ func (*realGetterSetter) SetRTCTime(t time.Time) error {
 	return r.Set(t)
 }
 
-func setTime(servers []string, config string, fallback string, setRTC bool, gs timeGetterSetter) (string, float64, error) {
+// Servers returns servers followed by the servers of the config file, or
+// fallback if there are none.
+func Servers(servers []string, config string, fallback string) []string {
 	servers = servers[:]
 
 	if config != "" {
@@ -109,9 +114,13 @@ func setTime(servers []string, config string, fallback string, setRTC bool, gs t
 		Debug("No servers provided, falling back to %v", fallback)
 		servers = append(servers, fallback)
 	}
+	return servers
+}
 
+func setTime(servers []string, config string, fallback string, setRTC bool, gs timeGetterSetter) (string, float64, error) {
+	servers = Servers(servers, config, fallback)
 	if len(servers) == 0 {
-		return "", 0, fmt.Errorf("no servers")
+		return "", 0, errNoServers
 	}
 
 	t, server, err := gs.GetTime(servers)
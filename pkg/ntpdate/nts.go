@@ -0,0 +1,255 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// NTS constants, from RFC 8915.
+const (
+	ntsKEPort        = "4460"
+	ntsALPN          = "ntske/1"
+	ntsExporterLabel = "EXPORTER-network-time-security"
+
+	recEnd          = 0
+	recNextProtocol = 1
+	recError        = 2
+	recWarning      = 3
+	recAEAD         = 4
+	recCookie       = 5
+	recServer       = 6
+	recPort         = 7
+	recCritical     = 0x8000
+
+	protocolNTPv4 = 0
+	// aeadAESSIVCMAC256 is AEAD_AES_SIV_CMAC_256, from RFC 5297.
+	aeadAESSIVCMAC256 = 15
+	ntsKeyLen         = 32
+
+	// ntsCookies is the number of cookies to keep.
+	ntsCookies = 8
+	uidLen     = 32
+	nonceLen   = 16
+)
+
+var (
+	errNTSKE     = errors.New("NTS key exchange failed")
+	errNTS       = errors.New("NTS authentication failed")
+	errNoCookies = errors.New("no NTS cookies left")
+)
+
+// ntsSession is what NTS-KE establishes to query an NTP server.
+type ntsSession struct {
+	// addr is the address of the NTP server, host:port.
+	addr string
+	c2s  []byte
+	s2c  []byte
+	// cookies are used once each. The server sends new ones.
+	cookies [][]byte
+}
+
+func appendRecord(b []byte, typ uint16, body []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	return append(b, body...)
+}
+
+// ntsKeyExchange runs NTS-KE with server, host or host:port, and returns
+// the session to query the NTP server it names.
+func ntsKeyExchange(server string, config *tls.Config, timeout time.Duration) (*ntsSession, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = server, ntsKEPort
+	}
+	c := &tls.Config{}
+	if config != nil {
+		c = config.Clone()
+	}
+	c.MinVersion = tls.VersionTLS13
+	c.NextProtos = []string{ntsALPN}
+	if c.ServerName == "" {
+		c.ServerName = host
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", net.JoinHostPort(host, port), c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNTSKE, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	cs := conn.ConnectionState()
+	if cs.NegotiatedProtocol != ntsALPN {
+		return nil, fmt.Errorf("%w: server does not speak %s", errNTSKE, ntsALPN)
+	}
+
+	var req []byte
+	req = appendRecord(req, recCritical|recNextProtocol, []byte{0, protocolNTPv4})
+	req = appendRecord(req, recAEAD, []byte{0, aeadAESSIVCMAC256})
+	req = appendRecord(req, recCritical|recEnd, nil)
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("%w: %w", errNTSKE, err)
+	}
+
+	s := &ntsSession{}
+	ntpHost, ntpPort := host, "123"
+	protocol, aead := false, false
+	for done := false; !done; {
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(conn, h); err != nil {
+			return nil, fmt.Errorf("%w: %w", errNTSKE, err)
+		}
+		typ := binary.BigEndian.Uint16(h)
+		body := make([]byte, binary.BigEndian.Uint16(h[2:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, fmt.Errorf("%w: %w", errNTSKE, err)
+		}
+		switch typ &^ recCritical {
+		case recEnd:
+			done = true
+		case recNextProtocol:
+			protocol = bytes.Equal(body, []byte{0, protocolNTPv4})
+		case recError:
+			return nil, fmt.Errorf("%w: error %x", errNTSKE, body)
+		case recWarning:
+			Debug("NTS-KE warning %x from %s", body, server)
+		case recAEAD:
+			aead = bytes.Equal(body, []byte{0, aeadAESSIVCMAC256})
+		case recCookie:
+			s.cookies = append(s.cookies, body)
+		case recServer:
+			ntpHost = string(body)
+		case recPort:
+			if len(body) != 2 {
+				return nil, fmt.Errorf("%w: bad port record", errNTSKE)
+			}
+			ntpPort = strconv.Itoa(int(binary.BigEndian.Uint16(body)))
+		default:
+			if typ&recCritical != 0 {
+				return nil, fmt.Errorf("%w: unknown critical record %d", errNTSKE, typ&^recCritical)
+			}
+		}
+	}
+	if !protocol || !aead || len(s.cookies) == 0 {
+		return nil, fmt.Errorf("%w: no NTPv4, AES-SIV-CMAC-256 or cookies", errNTSKE)
+	}
+
+	s.addr = net.JoinHostPort(ntpHost, ntpPort)
+	context := []byte{0, protocolNTPv4, 0, aeadAESSIVCMAC256, 0}
+	if s.c2s, err = cs.ExportKeyingMaterial(ntsExporterLabel, context, ntsKeyLen); err != nil {
+		return nil, err
+	}
+	context[4] = 1
+	if s.s2c, err = cs.ExportKeyingMaterial(ntsExporterLabel, context, ntsKeyLen); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// request appends the NTS extension fields to the NTP request pkt. It
+// returns the request, and the unique identifier the response must have.
+func (s *ntsSession) request(pkt []byte) ([]byte, []byte, error) {
+	if len(s.cookies) == 0 {
+		return nil, nil, errNoCookies
+	}
+	uid := make([]byte, uidLen)
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(uid); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	cookie := s.cookies[0]
+	s.cookies = s.cookies[1:]
+
+	pkt = appendExtensionField(pkt, efUniqueIdentifier, uid, 0)
+	pkt = appendExtensionField(pkt, efCookie, cookie, 0)
+	// Placeholders ask for as many new cookies.
+	for i := len(s.cookies) + 1; i < ntsCookies; i++ {
+		pkt = appendExtensionField(pkt, efCookiePlaceholder, make([]byte, len(cookie)), 0)
+	}
+	ct, err := sivSeal(s.c2s, nil, pkt, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkt = appendExtensionField(pkt, efAuthenticator, authenticator(nonce, ct), 0)
+	return pkt, uid, nil
+}
+
+// authenticator returns the body of an NTS authenticator extension field.
+func authenticator(nonce, ct []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(nonce)))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(ct)))
+	b = append(b, nonce...)
+	b = append(b, make([]byte, padLen(len(nonce))-len(nonce))...)
+	b = append(b, ct...)
+	return append(b, make([]byte, padLen(len(ct))-len(ct))...)
+}
+
+// openAuthenticator authenticates the packet pkt up to the authenticator
+// of key at off, and returns the plaintext it encrypts.
+func openAuthenticator(key, pkt []byte, off int, body []byte) ([]byte, error) {
+	if len(body) < 4 {
+		return nil, errNTS
+	}
+	nl, cl := int(binary.BigEndian.Uint16(body)), int(binary.BigEndian.Uint16(body[2:]))
+	if 4+padLen(nl)+cl > len(body) {
+		return nil, errNTS
+	}
+	nonce := body[4 : 4+nl]
+	ct := body[4+padLen(nl) : 4+padLen(nl)+cl]
+	p, err := sivOpen(key, ct, pkt[:off], nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNTS, err)
+	}
+	return p, nil
+}
+
+// verify authenticates the response pkt to the request with uid, and
+// keeps the cookies it has.
+func (s *ntsSession) verify(pkt, uid []byte) error {
+	efs, offsets, err := parseExtensionFields(pkt[headerLen:])
+	if err != nil {
+		return err
+	}
+	uidOK := false
+	for i, ef := range efs {
+		switch ef.typ {
+		case efUniqueIdentifier:
+			uidOK = bytes.Equal(ef.body, uid)
+		case efAuthenticator:
+			if !uidOK {
+				return fmt.Errorf("%w: unique identifier does not match", errNTS)
+			}
+			p, err := openAuthenticator(s.s2c, pkt, headerLen+offsets[i], ef.body)
+			if err != nil {
+				return err
+			}
+			encrypted, _, err := parseExtensionFields(p)
+			if err != nil {
+				return err
+			}
+			for _, e := range encrypted {
+				if e.typ == efCookie {
+					s.cookies = append(s.cookies, e.body)
+				}
+			}
+			// Fields after the authenticator are not authenticated.
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no authenticator", errNTS)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ntsServer runs NTS-KE for r, and returns its address and the TLS
+// configuration that trusts it.
+func ntsServer(t *testing.T, r *responder) (string, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{ntsALPN},
+		MinVersion:   tls.VersionTLS13,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r.keyExchange(c.(*tls.Conn))
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return l.Addr().String(), &tls.Config{RootCAs: roots}
+}
+
+// keyExchange answers an NTS-KE request for the NTP server of r.
+func (r *responder) keyExchange(c *tls.Conn) {
+	defer c.Close()
+	for {
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(c, h); err != nil {
+			return
+		}
+		if _, err := io.CopyN(io.Discard, c, int64(binary.BigEndian.Uint16(h[2:]))); err != nil {
+			return
+		}
+		if binary.BigEndian.Uint16(h)&^recCritical == recEnd {
+			break
+		}
+	}
+	cs := c.ConnectionState()
+	c2s, _ := cs.ExportKeyingMaterial(ntsExporterLabel, []byte{0, protocolNTPv4, 0, aeadAESSIVCMAC256, 0}, ntsKeyLen)
+	s2c, _ := cs.ExportKeyingMaterial(ntsExporterLabel, []byte{0, protocolNTPv4, 0, aeadAESSIVCMAC256, 1}, ntsKeyLen)
+
+	host, port, _ := net.SplitHostPort(r.addr())
+	p, _ := strconv.Atoi(port)
+	var resp []byte
+	resp = appendRecord(resp, recCritical|recNextProtocol, []byte{0, protocolNTPv4})
+	resp = appendRecord(resp, recAEAD, []byte{0, aeadAESSIVCMAC256})
+	resp = appendRecord(resp, recServer, []byte(host))
+	resp = appendRecord(resp, recPort, binary.BigEndian.AppendUint16(nil, uint16(p)))
+	r.mu.Lock()
+	r.c2s, r.s2c = c2s, s2c
+	for i := 0; i < ntsCookies; i++ {
+		resp = appendRecord(resp, recCookie, r.cookie())
+	}
+	r.mu.Unlock()
+	resp = appendRecord(resp, recCritical|recEnd, nil)
+	c.Write(resp)
+}
+
+func TestNTS(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		tamper bool
+		want   error
+	}{
+		{name: "ok"},
+		{name: "tampered", tamper: true, want: errNTS},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newResponder(t, time.Second)
+			r.tamper = tt.tamper
+			server, config := ntsServer(t, r)
+
+			s, err := ntsKeyExchange(server, config, time.Second)
+			if err != nil {
+				t.Fatalf("ntsKeyExchange(%s) = %v", server, err)
+			}
+			if s.addr != r.addr() || len(s.cookies) != ntsCookies {
+				t.Fatalf("ntsKeyExchange(%s) = %s with %d cookies, want %s with %d", server, s.addr, len(s.cookies), r.addr(), ntsCookies)
+			}
+			_, err = query(s.addr, s, time.Second)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("query(%s) = %v, want %v", s.addr, err, tt.want)
+			}
+			if err == nil && len(s.cookies) != ntsCookies {
+				t.Errorf("%d cookies after query, want %d", len(s.cookies), ntsCookies)
+			}
+		})
+	}
+}
+
+func TestNTSUntrusted(t *testing.T) {
+	r := newResponder(t, time.Second)
+	server, _ := ntsServer(t, r)
+	if _, err := ntsKeyExchange(server, nil, time.Second); !errors.Is(err, errNTSKE) {
+		t.Errorf("ntsKeyExchange(%s) = %v, want %v", server, err, errNTSKE)
+	}
+}
+
+func TestSyncNTS(t *testing.T) {
+	r := newResponder(t, time.Second)
+	server, config := ntsServer(t, r)
+	o := &Opts{Servers: []string{server}, NTS: true, TLSConfig: config, Timeout: time.Second}
+	c := &fakeClock{}
+	s := newSyncer(o, c)
+	for i := 0; i < 3; i++ {
+		if _, err := s.poll(); err != nil {
+			t.Fatalf("poll() = %v", err)
+		}
+	}
+	if c.step < 2*time.Second {
+		t.Errorf("step = %v, want about %v", c.step, 3*time.Second)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NTP protocol constants, from RFC 5905.
+const (
+	ntpVersion = 4
+	modeClient = 3
+	modeServer = 4
+
+	leapUnsynchronized = 3
+
+	headerLen = 48
+
+	// ntpEpochOffset is the number of seconds from 1900, the NTP epoch,
+	// to 1970.
+	ntpEpochOffset = 2208988800
+)
+
+var errBadPacket = errors.New("bad NTP packet")
+
+// header is the header of an NTP packet.
+type header struct {
+	LeapVersionMode uint8
+	Stratum         uint8
+	Poll            int8
+	Precision       int8
+	RootDelay       uint32
+	RootDispersion  uint32
+	ReferenceID     uint32
+	ReferenceTime   uint64
+	OriginTime      uint64
+	ReceiveTime     uint64
+	TransmitTime    uint64
+}
+
+func (h *header) leap() uint8 { return h.LeapVersionMode >> 6 }
+func (h *header) mode() uint8 { return h.LeapVersionMode & 7 }
+
+func (h *header) marshal() []byte {
+	b := make([]byte, headerLen)
+	b[0], b[1], b[2], b[3] = h.LeapVersionMode, h.Stratum, byte(h.Poll), byte(h.Precision)
+	binary.BigEndian.PutUint32(b[4:], h.RootDelay)
+	binary.BigEndian.PutUint32(b[8:], h.RootDispersion)
+	binary.BigEndian.PutUint32(b[12:], h.ReferenceID)
+	binary.BigEndian.PutUint64(b[16:], h.ReferenceTime)
+	binary.BigEndian.PutUint64(b[24:], h.OriginTime)
+	binary.BigEndian.PutUint64(b[32:], h.ReceiveTime)
+	binary.BigEndian.PutUint64(b[40:], h.TransmitTime)
+	return b
+}
+
+func parseHeader(b []byte) (*header, error) {
+	if len(b) < headerLen {
+		return nil, fmt.Errorf("%w: %d bytes", errBadPacket, len(b))
+	}
+	return &header{
+		LeapVersionMode: b[0],
+		Stratum:         b[1],
+		Poll:            int8(b[2]),
+		Precision:       int8(b[3]),
+		RootDelay:       binary.BigEndian.Uint32(b[4:]),
+		RootDispersion:  binary.BigEndian.Uint32(b[8:]),
+		ReferenceID:     binary.BigEndian.Uint32(b[12:]),
+		ReferenceTime:   binary.BigEndian.Uint64(b[16:]),
+		OriginTime:      binary.BigEndian.Uint64(b[24:]),
+		ReceiveTime:     binary.BigEndian.Uint64(b[32:]),
+		TransmitTime:    binary.BigEndian.Uint64(b[40:]),
+	}, nil
+}
+
+// toNTP returns the NTP timestamp of t.
+func toNTP(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+// fromNTP returns the time of an NTP timestamp. Timestamps before 1968
+// are taken to be of the next era, which starts in 2036.
+func fromNTP(ts uint64) time.Time {
+	sec := int64(ts >> 32)
+	if sec < 0x80000000 {
+		sec += 1 << 32
+	}
+	nsec := int64(((ts & 0xffffffff) * uint64(time.Second)) >> 32)
+	return time.Unix(sec-ntpEpochOffset, nsec)
+}
+
+// shortToDuration returns the duration of an NTP short format value, in
+// seconds with 16 bits of fraction.
+func shortToDuration(s uint32) time.Duration {
+	return time.Duration((int64(s) * int64(time.Second)) >> 16)
+}
+
+// Extension field types, from RFC 8915.
+const (
+	efUniqueIdentifier  = 0x0104
+	efCookie            = 0x0204
+	efCookiePlaceholder = 0x0304
+	efAuthenticator     = 0x0404
+)
+
+// extensionField is an NTP extension field, from RFC 7822.
+type extensionField struct {
+	typ  uint16
+	body []byte
+}
+
+// padLen returns n rounded up to a multiple of 4.
+func padLen(n int) int {
+	return (n + 3) &^ 3
+}
+
+// appendExtensionField appends the field of typ with body to b, padded to
+// at least minLen bytes.
+func appendExtensionField(b []byte, typ uint16, body []byte, minLen int) []byte {
+	n := max(padLen(4+len(body)), minLen)
+	b = binary.BigEndian.AppendUint16(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(n))
+	b = append(b, body...)
+	return append(b, make([]byte, n-4-len(body))...)
+}
+
+// parseExtensionFields returns the extension fields of b, and the offsets
+// they start at.
+func parseExtensionFields(b []byte) ([]extensionField, []int, error) {
+	var efs []extensionField
+	var offsets []int
+	for off := 0; off < len(b); {
+		if len(b)-off < 4 {
+			return nil, nil, fmt.Errorf("%w: short extension field", errBadPacket)
+		}
+		typ := binary.BigEndian.Uint16(b[off:])
+		n := int(binary.BigEndian.Uint16(b[off+2:]))
+		if n < 4 || n%4 != 0 || off+n > len(b) {
+			return nil, nil, fmt.Errorf("%w: extension field length %d", errBadPacket, n)
+		}
+		efs = append(efs, extensionField{typ: typ, body: b[off+4 : off+n]})
+		offsets = append(offsets, off)
+		off += n
+	}
+	return efs, offsets, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var errUnsynchronized = errors.New("server is not synchronized")
+
+// sample is the result of a query of an NTP server.
+type sample struct {
+	// offset is how much the server's clock is ahead of ours.
+	offset time.Duration
+	// delay is the round trip delay.
+	delay          time.Duration
+	rootDelay      time.Duration
+	rootDispersion time.Duration
+	stratum        uint8
+}
+
+// distance is the root distance of the sample, the bound of its error.
+func (s *sample) distance() time.Duration {
+	return s.rootDelay/2 + s.rootDispersion + s.delay/2
+}
+
+// query queries the NTP server at addr, host:port, through the NTS
+// session if it is not nil.
+func query(addr string, nts *ntsSession, timeout time.Duration) (*sample, error) {
+	conn, err := net.DialTimeout("udp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	t1 := time.Now()
+	req := &header{
+		LeapVersionMode: leapUnsynchronized<<6 | ntpVersion<<3 | modeClient,
+		TransmitTime:    toNTP(t1),
+	}
+	pkt := req.marshal()
+	var uid []byte
+	if nts != nil {
+		if pkt, uid, err = nts.request(pkt); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write(pkt); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 2048)
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		t4 := time.Now()
+		resp, err := parseHeader(b[:n])
+		if err != nil {
+			return nil, err
+		}
+		// Drop stray and replayed packets.
+		if resp.mode() != modeServer || resp.OriginTime != req.TransmitTime {
+			continue
+		}
+		if resp.Stratum == 0 {
+			// A kiss-o'-death, with its code in the reference ID.
+			code := binary.BigEndian.AppendUint32(nil, resp.ReferenceID)
+			return nil, fmt.Errorf("%w: kiss code %q", errUnsynchronized, code)
+		}
+		if resp.leap() == leapUnsynchronized || resp.Stratum > 15 || resp.TransmitTime == 0 {
+			return nil, fmt.Errorf("%w: leap %d, stratum %d", errUnsynchronized, resp.leap(), resp.Stratum)
+		}
+		if nts != nil {
+			if err := nts.verify(b[:n], uid); err != nil {
+				return nil, err
+			}
+		}
+
+		t2, t3 := fromNTP(resp.ReceiveTime), fromNTP(resp.TransmitTime)
+		return &sample{
+			offset:         (t2.Sub(t1) + t3.Sub(t4)) / 2,
+			delay:          max(t4.Sub(t1)-t3.Sub(t2), 0),
+			rootDelay:      shortToDuration(resp.RootDelay),
+			rootDispersion: shortToDuration(resp.RootDispersion),
+			stratum:        resp.Stratum,
+		}, nil
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// AES-SIV-CMAC, from RFC 5297, is the AEAD of NTS.
+
+var errAuth = errors.New("message authentication failed")
+
+// dbl doubles x in GF(2^128).
+func dbl(x []byte) []byte {
+	d := make([]byte, aes.BlockSize)
+	for i := 0; i < aes.BlockSize-1; i++ {
+		d[i] = x[i]<<1 | x[i+1]>>7
+	}
+	d[aes.BlockSize-1] = x[aes.BlockSize-1] << 1
+	if x[0]&0x80 != 0 {
+		d[aes.BlockSize-1] ^= 0x87
+	}
+	return d
+}
+
+// cmac returns the AES-CMAC of msg, from RFC 4493.
+func cmac(b cipher.Block, msg []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	b.Encrypt(k1, k1)
+	k1 = dbl(k1)
+	k2 := dbl(k1)
+
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	last := make([]byte, aes.BlockSize)
+	if n > 0 && len(msg)%aes.BlockSize == 0 {
+		subtle.XORBytes(last, msg[(n-1)*aes.BlockSize:], k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		rest := msg[(n-1)*aes.BlockSize:]
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		subtle.XORBytes(last, last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		subtle.XORBytes(x, x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		b.Encrypt(x, x)
+	}
+	subtle.XORBytes(x, x, last)
+	b.Encrypt(x, x)
+	return x
+}
+
+// s2v is the S2V of RFC 5297 over the strings, the last of which is the
+// plaintext.
+func s2v(b cipher.Block, strs [][]byte) []byte {
+	d := cmac(b, make([]byte, aes.BlockSize))
+	for _, s := range strs[:len(strs)-1] {
+		d = dbl(d)
+		subtle.XORBytes(d, d, cmac(b, s))
+	}
+	sn := strs[len(strs)-1]
+	var t []byte
+	if len(sn) >= aes.BlockSize {
+		t = append([]byte(nil), sn...)
+		end := t[len(t)-aes.BlockSize:]
+		subtle.XORBytes(end, end, d)
+	} else {
+		t = dbl(d)
+		pad := make([]byte, aes.BlockSize)
+		copy(pad, sn)
+		pad[len(sn)] = 0x80
+		subtle.XORBytes(t, t, pad)
+	}
+	return cmac(b, t)
+}
+
+// sivCTR encrypts or decrypts in with the counter of the synthetic IV v.
+func sivCTR(b cipher.Block, v, in []byte) []byte {
+	q := append([]byte(nil), v...)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	out := make([]byte, len(in))
+	cipher.NewCTR(b, q).XORKeyStream(out, in)
+	return out
+}
+
+func sivCiphers(key []byte) (cipher.Block, cipher.Block, error) {
+	if len(key) != 32 && len(key) != 48 && len(key) != 64 {
+		return nil, nil, aes.KeySizeError(len(key))
+	}
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, nil, err
+	}
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return mac, ctr, nil
+}
+
+// sivSeal encrypts and authenticates plaintext and the associated data,
+// and returns the synthetic IV followed by the ciphertext.
+func sivSeal(key, plaintext []byte, ad ...[]byte) ([]byte, error) {
+	mac, ctr, err := sivCiphers(key)
+	if err != nil {
+		return nil, err
+	}
+	v := s2v(mac, append(ad[:len(ad):len(ad)], plaintext))
+	return append(v, sivCTR(ctr, v, plaintext)...), nil
+}
+
+// sivOpen decrypts and authenticates the output of sivSeal.
+func sivOpen(key, ciphertext []byte, ad ...[]byte) ([]byte, error) {
+	mac, ctr, err := sivCiphers(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errAuth
+	}
+	v := ciphertext[:aes.BlockSize]
+	p := sivCTR(ctr, v, ciphertext[aes.BlockSize:])
+	if subtle.ConstantTimeCompare(s2v(mac, append(ad[:len(ad):len(ad)], p)), v) != 1 {
+		return nil, errAuth
+	}
+	return p, nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// setInt sets the Timex field at p, whose width depends on the
+// architecture.
+func setInt[T int32 | int64](p *T, v int64) {
+	*p = T(v)
+}
+
+// slew makes the kernel adjust the clock by offset gradually, like
+// adjtime(3).
+func slew(offset time.Duration) error {
+	tx := &unix.Timex{Modes: unix.ADJ_OFFSET_SINGLESHOT}
+	setInt(&tx.Offset, offset.Microseconds())
+	_, err := unix.Adjtimex(tx)
+	return err
+}
@@ -0,0 +1,287 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Defaults of Opts.
+const (
+	DefaultPoll          = 64 * time.Second
+	DefaultStepThreshold = 128 * time.Millisecond
+	// DefaultRTCInterval is that of the kernel's 11 minute mode.
+	DefaultRTCInterval = 11 * time.Minute
+	DefaultSamples     = 4
+	DefaultTimeout     = 5 * time.Second
+)
+
+var errNoMajority = errors.New("no majority of servers agrees on the time")
+
+// Opts configures Sync.
+type Opts struct {
+	// Servers are host or host:port. With NTS, the port is that of
+	// NTS-KE.
+	Servers []string
+	// NTS authenticates the servers with NTS, from RFC 8915.
+	NTS bool
+	// TLSConfig is the configuration of NTS-KE. If nil, the system's
+	// roots verify the servers.
+	TLSConfig *tls.Config
+	// Poll is the interval between polls of the servers.
+	Poll time.Duration
+	// Samples is the number of queries of each server per poll, of
+	// which the one with the least delay counts.
+	Samples int
+	// Offsets over StepThreshold step the clock, smaller ones slew it.
+	StepThreshold time.Duration
+	// RTC sets the RTC from the system clock every RTCInterval once the
+	// clock is synchronized.
+	RTC         bool
+	RTCInterval time.Duration
+	// Timeout is that of each query.
+	Timeout time.Duration
+}
+
+// clock is the system clock that Sync disciplines.
+type clock interface {
+	Step(offset time.Duration) error
+	Slew(offset time.Duration) error
+	SetRTCTime(time.Time) error
+}
+
+type realClock struct {
+	realGetterSetter
+}
+
+func (*realClock) Step(offset time.Duration) error {
+	tv := syscall.NsecToTimeval(time.Now().Add(offset).UnixNano())
+	return syscall.Settimeofday(&tv)
+}
+
+func (*realClock) Slew(offset time.Duration) error {
+	return slew(offset)
+}
+
+// source is an NTP server.
+type source struct {
+	server string
+	// nts is nil without NTS, or until NTS-KE ran.
+	nts *ntsSession
+}
+
+type syncer struct {
+	opts    Opts
+	clock   clock
+	sources []*source
+	lastRTC time.Time
+}
+
+// Sync keeps the system clock synchronized with the servers until ctx is
+// done. Each poll, it queries all servers, keeps the servers whose time
+// intervals agree, and steps or slews the clock by their combined offset.
+func Sync(ctx context.Context, opts *Opts) error {
+	return newSyncer(opts, &realClock{}).run(ctx)
+}
+
+func newSyncer(opts *Opts, c clock) *syncer {
+	s := &syncer{opts: *opts, clock: c}
+	if s.opts.Poll <= 0 {
+		s.opts.Poll = DefaultPoll
+	}
+	if s.opts.Samples <= 0 {
+		s.opts.Samples = DefaultSamples
+	}
+	if s.opts.StepThreshold <= 0 {
+		s.opts.StepThreshold = DefaultStepThreshold
+	}
+	if s.opts.RTCInterval <= 0 {
+		s.opts.RTCInterval = DefaultRTCInterval
+	}
+	if s.opts.Timeout <= 0 {
+		s.opts.Timeout = DefaultTimeout
+	}
+	for _, server := range opts.Servers {
+		s.sources = append(s.sources, &source{server: server})
+	}
+	return s
+}
+
+func (s *syncer) run(ctx context.Context) error {
+	if len(s.sources) == 0 {
+		return errNoServers
+	}
+	t := time.NewTicker(s.opts.Poll)
+	defer t.Stop()
+	for {
+		if offset, err := s.poll(); err != nil {
+			Debug("Poll: %v", err)
+		} else {
+			Debug("Adjusted time by %v", offset)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// measure returns the sample of src with the least delay out of those of
+// a poll, which is the one least affected by queuing in the network.
+func (s *syncer) measure(src *source) (*sample, error) {
+	addr := src.server
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "123")
+	}
+	var best *sample
+	var err error
+	for i := 0; i < s.opts.Samples; i++ {
+		if s.opts.NTS && (src.nts == nil || len(src.nts.cookies) == 0) {
+			if src.nts, err = ntsKeyExchange(src.server, s.opts.TLSConfig, s.opts.Timeout); err != nil {
+				return nil, err
+			}
+		}
+		if src.nts != nil {
+			addr = src.nts.addr
+		}
+		var smp *sample
+		smp, err = query(addr, src.nts, s.opts.Timeout)
+		if err != nil {
+			Debug("Querying %s: %v", src.server, err)
+			// A new key exchange may help, like after a
+			// kiss-o'-death or lost cookies.
+			src.nts = nil
+			continue
+		}
+		if best == nil || smp.delay < best.delay {
+			best = smp
+		}
+	}
+	if best == nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// poll disciplines the clock from the sources, and returns the offset.
+func (s *syncer) poll() (time.Duration, error) {
+	var samples []*sample
+	for _, src := range s.sources {
+		smp, err := s.measure(src)
+		if err != nil {
+			Debug("No time from %s: %v", src.server, err)
+			continue
+		}
+		Debug("%s: offset %v, delay %v, distance %v", src.server, smp.offset, smp.delay, smp.distance())
+		samples = append(samples, smp)
+	}
+	truechimers := selectSamples(samples)
+	if len(truechimers) == 0 {
+		return 0, errNoMajority
+	}
+	offset := combine(truechimers)
+
+	if offset >= s.opts.StepThreshold || offset <= -s.opts.StepThreshold {
+		if err := s.clock.Step(offset); err != nil {
+			return 0, fmt.Errorf("unable to step time: %w", err)
+		}
+	} else if err := s.clock.Slew(offset); err != nil {
+		// Without slewing, steps do.
+		Debug("Slewing: %v", err)
+		if err := s.clock.Step(offset); err != nil {
+			return 0, fmt.Errorf("unable to step time: %w", err)
+		}
+	}
+
+	if s.opts.RTC && time.Since(s.lastRTC) >= s.opts.RTCInterval {
+		if err := s.clock.SetRTCTime(time.Now()); err != nil {
+			return offset, fmt.Errorf("unable to set RTC time: %w", err)
+		}
+		s.lastRTC = time.Now()
+	}
+	return offset, nil
+}
+
+// selectSamples returns the truechimers of the samples, those whose
+// intervals of offset plus or minus root distance intersect with those of
+// a majority, like the selection algorithm of RFC 5905, section 11.2.1.
+func selectSamples(samples []*sample) []*sample {
+	type edge struct {
+		v   time.Duration
+		typ int
+	}
+	n := len(samples)
+	var edges []edge
+	for _, s := range samples {
+		d := s.distance()
+		edges = append(edges, edge{s.offset - d, -1}, edge{s.offset, 0}, edge{s.offset + d, 1})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].v != edges[j].v {
+			return edges[i].v < edges[j].v
+		}
+		return edges[i].typ < edges[j].typ
+	})
+
+	// Allow for f falsetickers, as few as possible.
+	for f := 0; 2*f < n; f++ {
+		var low, high time.Duration
+		found, chime := 0, 0
+		lowOK, highOK := false, false
+		for _, e := range edges {
+			chime -= e.typ
+			if chime >= n-f {
+				low, lowOK = e.v, true
+				break
+			}
+			if e.typ == 0 {
+				found++
+			}
+		}
+		chime = 0
+		for i := len(edges) - 1; i >= 0; i-- {
+			e := edges[i]
+			chime += e.typ
+			if chime >= n-f {
+				high, highOK = e.v, true
+				break
+			}
+			if e.typ == 0 {
+				found++
+			}
+		}
+		if !lowOK || !highOK || found > f || low > high {
+			continue
+		}
+		var t []*sample
+		for _, s := range samples {
+			if s.offset-s.distance() <= high && s.offset+s.distance() >= low {
+				t = append(t, s)
+			}
+		}
+		return t
+	}
+	return nil
+}
+
+// combine returns the average of the offsets of the samples, weighted by
+// the inverse of their root distance.
+func combine(samples []*sample) time.Duration {
+	var sum, weights float64
+	for _, s := range samples {
+		w := 1 / max(s.distance().Seconds(), 1e-6)
+		sum += w * s.offset.Seconds()
+		weights += w
+	}
+	return time.Duration(sum / weights * float64(time.Second))
+}
@@ -0,0 +1,259 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ntpdate
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// responder is a local NTP server whose clock is offset from ours.
+type responder struct {
+	conn   *net.UDPConn
+	offset time.Duration
+
+	mu sync.Mutex
+	// With keys, the responder is an NTS server that takes the cookies.
+	c2s, s2c []byte
+	cookies  map[string]bool
+	// tamper breaks the authenticators of responses.
+	tamper bool
+}
+
+func newResponder(t *testing.T, offset time.Duration) *responder {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &responder{conn: conn, offset: offset, cookies: map[string]bool{}}
+	t.Cleanup(func() { conn.Close() })
+	go r.serve()
+	return r
+}
+
+func (r *responder) addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+func (r *responder) serve() {
+	b := make([]byte, 2048)
+	for {
+		n, addr, err := r.conn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		now := time.Now().Add(r.offset)
+		req, err := parseHeader(b[:n])
+		if err != nil {
+			continue
+		}
+		resp := &header{
+			LeapVersionMode: ntpVersion<<3 | modeServer,
+			Stratum:         2,
+			RootDispersion:  1 << 16 / 100,
+			ReferenceTime:   toNTP(now),
+			OriginTime:      req.TransmitTime,
+			ReceiveTime:     toNTP(now),
+			TransmitTime:    toNTP(time.Now().Add(r.offset)),
+		}
+		pkt := resp.marshal()
+		if pkt, err = r.nts(b[:n], pkt); err != nil {
+			continue
+		}
+		r.conn.WriteToUDP(pkt, addr)
+	}
+}
+
+// nts authenticates the request, and appends the NTS extension fields of
+// the response to pkt, if the responder is an NTS server.
+func (r *responder) nts(req, pkt []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.c2s == nil {
+		return pkt, nil
+	}
+	efs, offsets, err := parseExtensionFields(req[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+	var uid []byte
+	cookies := 0
+	for i, ef := range efs {
+		switch ef.typ {
+		case efUniqueIdentifier:
+			uid = ef.body
+		case efCookie:
+			if !r.cookies[string(ef.body)] {
+				return nil, errNTS
+			}
+			delete(r.cookies, string(ef.body))
+			cookies++
+		case efCookiePlaceholder:
+			cookies++
+		case efAuthenticator:
+			if _, err := openAuthenticator(r.c2s, req, headerLen+offsets[i], ef.body); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var plaintext []byte
+	for i := 0; i < cookies; i++ {
+		plaintext = appendExtensionField(plaintext, efCookie, r.cookie(), 0)
+	}
+	pkt = appendExtensionField(pkt, efUniqueIdentifier, uid, 0)
+	nonce := make([]byte, nonceLen)
+	rand.Read(nonce)
+	ct, err := sivSeal(r.s2c, plaintext, pkt, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if r.tamper {
+		ct[0] ^= 1
+	}
+	return appendExtensionField(pkt, efAuthenticator, authenticator(nonce, ct), 0), nil
+}
+
+func (r *responder) cookie() []byte {
+	c := make([]byte, 16)
+	rand.Read(c)
+	r.cookies[string(c)] = true
+	return c
+}
+
+// fakeClock records the adjustments of the clock.
+type fakeClock struct {
+	step, slew time.Duration
+	rtc        int
+}
+
+func (c *fakeClock) Step(offset time.Duration) error {
+	c.step += offset
+	return nil
+}
+
+func (c *fakeClock) Slew(offset time.Duration) error {
+	c.slew += offset
+	return nil
+}
+
+func (c *fakeClock) SetRTCTime(time.Time) error {
+	c.rtc++
+	return nil
+}
+
+func TestQuery(t *testing.T) {
+	r := newResponder(t, time.Hour)
+	s, err := query(r.addr(), nil, time.Second)
+	if err != nil {
+		t.Fatalf("query(%s) = %v", r.addr(), err)
+	}
+	if d := s.offset - time.Hour; d < -10*time.Millisecond || d > 10*time.Millisecond {
+		t.Errorf("offset = %v, want %v", s.offset, time.Hour)
+	}
+	if s.stratum != 2 {
+		t.Errorf("stratum = %d, want 2", s.stratum)
+	}
+}
+
+func TestSelectSamples(t *testing.T) {
+	ms := time.Millisecond
+	for _, tt := range []struct {
+		name    string
+		offsets []time.Duration
+		want    int
+	}{
+		{name: "one", offsets: []time.Duration{ms}, want: 1},
+		{name: "agree", offsets: []time.Duration{ms, 2 * ms, 3 * ms}, want: 3},
+		{name: "falseticker", offsets: []time.Duration{ms, 2 * ms, time.Second}, want: 2},
+		{name: "two falsetickers", offsets: []time.Duration{ms, 2 * ms, 3 * ms, time.Second, -time.Second}, want: 3},
+		{name: "no majority", offsets: []time.Duration{ms, time.Second}, want: 0},
+		{name: "none", want: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var samples []*sample
+			for _, o := range tt.offsets {
+				samples = append(samples, &sample{offset: o, rootDispersion: 5 * ms})
+			}
+			if got := selectSamples(samples); len(got) != tt.want {
+				t.Errorf("len(selectSamples(%v)) = %d, want %d", tt.offsets, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		offsets   []time.Duration
+		rtc       bool
+		wantStep  time.Duration
+		wantSlew  time.Duration
+		wantRTC   int
+		wantError error
+	}{
+		{
+			name:     "step",
+			offsets:  []time.Duration{time.Second, time.Second, time.Minute},
+			wantStep: time.Second,
+		},
+		{
+			name:     "slew",
+			offsets:  []time.Duration{20 * time.Millisecond, 20 * time.Millisecond},
+			rtc:      true,
+			wantSlew: 20 * time.Millisecond,
+			wantRTC:  1,
+		},
+		{
+			name:      "no majority",
+			offsets:   []time.Duration{time.Second, time.Minute},
+			rtc:       true,
+			wantError: errNoMajority,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Opts{Samples: 2, RTC: tt.rtc, Timeout: time.Second}
+			for _, offset := range tt.offsets {
+				o.Servers = append(o.Servers, newResponder(t, offset).addr())
+			}
+			c := &fakeClock{}
+			if _, err := newSyncer(o, c).poll(); !errors.Is(err, tt.wantError) {
+				t.Fatalf("poll() = %v, want %v", err, tt.wantError)
+			}
+			near := func(got, want time.Duration) bool {
+				return got-want < 10*time.Millisecond && want-got < 10*time.Millisecond
+			}
+			if !near(c.step, tt.wantStep) || !near(c.slew, tt.wantSlew) {
+				t.Errorf("step, slew = %v, %v, want %v, %v", c.step, c.slew, tt.wantStep, tt.wantSlew)
+			}
+			if c.rtc != tt.wantRTC {
+				t.Errorf("RTC set %d times, want %d", c.rtc, tt.wantRTC)
+			}
+		})
+	}
+}
+
+func TestSyncRun(t *testing.T) {
+	o := &Opts{Servers: []string{newResponder(t, time.Second).addr()}, Samples: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &fakeClock{}
+	if err := newSyncer(o, c).run(ctx); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if c.step == 0 {
+		t.Errorf("run() did not step the clock")
+	}
+
+	if err := newSyncer(&Opts{}, c).run(ctx); !errors.Is(err, errNoServers) {
+		t.Errorf("run() = %v, want %v", err, errNoServers)
+	}
+}
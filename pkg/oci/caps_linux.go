@@ -0,0 +1,68 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// dropBounding removes everything not in c.Bounding from the bounding set.
+func dropBounding(c *Capabilities) error {
+	keep, err := capMask(c.Bounding)
+	if err != nil {
+		return err
+	}
+	for i := uint(0); i < 64; i++ {
+		if keep&(1<<i) != 0 {
+			continue
+		}
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(i), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			// Past the last capability the kernel knows.
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setCaps sets the capability sets of the calling thread.
+func setCaps(c *Capabilities) error {
+	var sets [3]uint64
+	for i, names := range [][]string{c.Effective, c.Permitted, c.Inheritable} {
+		m, err := capMask(names)
+		if err != nil {
+			return err
+		}
+		sets[i] = m
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	for i := range data {
+		data[i].Effective = uint32(sets[0] >> (32 * i))
+		data[i].Permitted = uint32(sets[1] >> (32 * i))
+		data[i].Inheritable = uint32(sets[2] >> (32 * i))
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return err
+	}
+	ambient, err := capMask(c.Ambient)
+	if err != nil {
+		return err
+	}
+	for i := uint(0); i < 64; i++ {
+		if ambient&(1<<i) == 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(i), 0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
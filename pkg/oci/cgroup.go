@@ -0,0 +1,185 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CgroupRoot is where the cgroup v2 hierarchy is mounted.
+var CgroupRoot = "/sys/fs/cgroup"
+
+// ErrNoCgroup2 is returned when CgroupRoot is not a cgroup v2 mount.
+var ErrNoCgroup2 = errors.New("no cgroup v2 hierarchy")
+
+// Cgroup is a cgroup v2 directory created for a container.
+type Cgroup struct {
+	Path string
+}
+
+// cgroupSetting is a value written to a cgroup interface file.
+type cgroupSetting struct {
+	file  string
+	value string
+}
+
+func (s cgroupSetting) controller() string {
+	c, _, _ := strings.Cut(s.file, ".")
+	return c
+}
+
+// cgroupSettings translates OCI resources, which use cgroup v1 semantics,
+// into cgroup v2 interface file values.
+func cgroupSettings(r *Resources) ([]cgroupSetting, error) {
+	var s []cgroupSetting
+	if r == nil {
+		return nil, nil
+	}
+	if m := r.Memory; m != nil {
+		if m.Limit != nil {
+			s = append(s, cgroupSetting{"memory.max", limit(*m.Limit)})
+		}
+		if m.Reservation != nil {
+			s = append(s, cgroupSetting{"memory.low", limit(*m.Reservation)})
+		}
+		if m.Swap != nil {
+			// v1 limits memory+swap, v2 limits swap alone.
+			swap := *m.Swap
+			switch {
+			case swap == -1:
+			case m.Limit == nil || *m.Limit == -1:
+				return nil, fmt.Errorf("%w: memory.swap needs memory.limit", ErrInvalidSpec)
+			case swap < *m.Limit:
+				return nil, fmt.Errorf("%w: memory.swap %d is below memory.limit %d", ErrInvalidSpec, swap, *m.Limit)
+			default:
+				swap -= *m.Limit
+			}
+			s = append(s, cgroupSetting{"memory.swap.max", limit(swap)})
+		}
+	}
+	if c := r.CPU; c != nil {
+		if c.Shares != nil && *c.Shares != 0 {
+			s = append(s, cgroupSetting{"cpu.weight", strconv.FormatUint(cpuWeight(*c.Shares), 10)})
+		}
+		if c.Quota != nil || c.Period != nil {
+			quota := "max"
+			if c.Quota != nil && *c.Quota > 0 {
+				quota = strconv.FormatInt(*c.Quota, 10)
+			}
+			period := uint64(100000)
+			if c.Period != nil && *c.Period != 0 {
+				period = *c.Period
+			}
+			s = append(s, cgroupSetting{"cpu.max", fmt.Sprintf("%s %d", quota, period)})
+		}
+		if c.Cpus != "" {
+			s = append(s, cgroupSetting{"cpuset.cpus", c.Cpus})
+		}
+		if c.Mems != "" {
+			s = append(s, cgroupSetting{"cpuset.mems", c.Mems})
+		}
+	}
+	if p := r.Pids; p != nil {
+		s = append(s, cgroupSetting{"pids.max", limit(p.Limit)})
+	}
+	return s, nil
+}
+
+func limit(v int64) string {
+	if v < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// cpuWeight converts cgroup v1 cpu.shares in [2, 262144] to cgroup v2
+// cpu.weight in [1, 10000].
+func cpuWeight(shares uint64) uint64 {
+	shares = min(max(shares, 2), 262144)
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// NewCgroup creates the cgroup path, relative to CgroupRoot, and applies r.
+//
+// The controllers r needs are enabled in the subtree_control of every
+// ancestor.
+func NewCgroup(path string, r *Resources) (*Cgroup, error) {
+	settings, err := cgroupSettings(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(CgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%w at %s: %w", ErrNoCgroup2, CgroupRoot, err)
+	}
+	rel := filepath.Clean("/" + path)
+	if rel == "/" {
+		return nil, fmt.Errorf("%w: cgroups path %q is the root cgroup", ErrInvalidSpec, path)
+	}
+	cg := &Cgroup{Path: filepath.Join(CgroupRoot, rel)}
+	if err := os.MkdirAll(cg.Path, 0o755); err != nil {
+		return nil, err
+	}
+
+	var ctrls []string
+	seen := map[string]bool{}
+	for _, s := range settings {
+		if c := s.controller(); !seen[c] {
+			seen[c] = true
+			ctrls = append(ctrls, c)
+		}
+	}
+	if err := enableControllers(rel, ctrls); err != nil {
+		cg.Destroy()
+		return nil, err
+	}
+	for _, s := range settings {
+		if err := os.WriteFile(filepath.Join(cg.Path, s.file), []byte(s.value), 0o644); err != nil {
+			cg.Destroy()
+			return nil, fmt.Errorf("setting %s to %q: %w", s.file, s.value, err)
+		}
+	}
+	return cg, nil
+}
+
+// enableControllers enables ctrls in CgroupRoot and every ancestor of rel.
+func enableControllers(rel string, ctrls []string) error {
+	if len(ctrls) == 0 {
+		return nil
+	}
+	dir := CgroupRoot
+	for _, elem := range strings.Split(filepath.Dir(rel), "/") {
+		dir = filepath.Join(dir, elem)
+		b, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+		if err != nil {
+			return err
+		}
+		enabled := strings.Fields(string(b))
+		for _, c := range ctrls {
+			if slices.Contains(enabled, c) {
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+c), 0o644); err != nil {
+				return fmt.Errorf("enabling %s controller in %s: %w", c, dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Add moves process pid into the cgroup.
+func (c *Cgroup) Add(pid int) error {
+	return os.WriteFile(filepath.Join(c.Path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644)
+}
+
+// Destroy removes the cgroup. It must not have any processes left.
+func (c *Cgroup) Destroy() error {
+	return os.Remove(c.Path)
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func i64(i int64) *int64   { return &i }
+func u64(u uint64) *uint64 { return &u }
+
+func TestCgroupSettings(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		r    *Resources
+		want []cgroupSetting
+		err  error
+	}{
+		{name: "none"},
+		{
+			name: "memory",
+			r:    &Resources{Memory: &Memory{Limit: i64(64 << 20), Reservation: i64(-1), Swap: i64(96 << 20)}},
+			want: []cgroupSetting{{"memory.max", "67108864"}, {"memory.low", "max"}, {"memory.swap.max", "33554432"}},
+		},
+		{
+			name: "unlimited swap",
+			r:    &Resources{Memory: &Memory{Swap: i64(-1)}},
+			want: []cgroupSetting{{"memory.swap.max", "max"}},
+		},
+		{
+			name: "swap without limit",
+			r:    &Resources{Memory: &Memory{Swap: i64(1 << 20)}},
+			err:  ErrInvalidSpec,
+		},
+		{
+			name: "swap below limit",
+			r:    &Resources{Memory: &Memory{Limit: i64(2 << 20), Swap: i64(1 << 20)}},
+			err:  ErrInvalidSpec,
+		},
+		{
+			name: "cpu",
+			r:    &Resources{CPU: &CPU{Shares: u64(1024), Quota: i64(50000), Cpus: "0-1"}},
+			want: []cgroupSetting{{"cpu.weight", "39"}, {"cpu.max", "50000 100000"}, {"cpuset.cpus", "0-1"}},
+		},
+		{
+			name: "cpu period only",
+			r:    &Resources{CPU: &CPU{Shares: u64(262144), Period: u64(20000)}},
+			want: []cgroupSetting{{"cpu.weight", "10000"}, {"cpu.max", "max 20000"}},
+		},
+		{
+			name: "pids",
+			r:    &Resources{Pids: &Pids{Limit: 0}},
+			want: []cgroupSetting{{"pids.max", "0"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cgroupSettings(tt.r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("cgroupSettings() = %v, want %v", err, tt.err)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(cgroupSetting{})); diff != "" {
+				t.Errorf("cgroupSettings() (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewCgroup(t *testing.T) {
+	root := t.TempDir()
+	defer func(old string) { CgroupRoot = old }(CgroupRoot)
+	CgroupRoot = root
+
+	if _, err := NewCgroup("oci/test", nil); !errors.Is(err, ErrNoCgroup2) {
+		t.Fatalf("NewCgroup without cgroup2 = %v, want %v", err, ErrNoCgroup2)
+	}
+
+	// Fake the interface files a cgroup2 mount would have.
+	for _, f := range []string{"cgroup.controllers", "cgroup.subtree_control", "oci/cgroup.subtree_control"} {
+		p := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("cpu\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewCgroup("/", nil); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("NewCgroup(/) = %v, want %v", err, ErrInvalidSpec)
+	}
+
+	cg, err := NewCgroup("/oci/test", &Resources{Pids: &Pids{Limit: 8}, CPU: &CPU{Quota: i64(1000)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "oci/test"); cg.Path != want {
+		t.Errorf("cgroup path %q, want %q", cg.Path, want)
+	}
+	for f, want := range map[string]string{
+		"pids.max":                     "8",
+		"cpu.max":                      "1000 100000",
+		"../cgroup.subtree_control":    "+pids",
+		"../../cgroup.subtree_control": "+pids",
+	} {
+		b, err := os.ReadFile(filepath.Join(cg.Path, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(b)); got != want {
+			t.Errorf("%s = %q, want %q", f, got, want)
+		}
+	}
+	if err := cg.Add(42); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(cg.Path, "cgroup.procs")); string(b) != "42" {
+		t.Errorf("cgroup.procs = %q, want 42", b)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// initEnv marks a process started by Container.Start that must run Init.
+const initEnv = "_UROOT_OCI_INIT"
+
+// File descriptors passed to the init process.
+const (
+	specFD = 3 + iota
+	syncFD
+	errFD
+)
+
+var cloneFlags = map[NamespaceType]uintptr{
+	PIDNamespace:     syscall.CLONE_NEWPID,
+	NetworkNamespace: syscall.CLONE_NEWNET,
+	MountNamespace:   syscall.CLONE_NEWNS,
+	IPCNamespace:     syscall.CLONE_NEWIPC,
+	UTSNamespace:     syscall.CLONE_NEWUTS,
+	UserNamespace:    syscall.CLONE_NEWUSER,
+	CgroupNamespace:  syscall.CLONE_NEWCGROUP,
+}
+
+// Container is a process running from a Spec.
+//
+// The container's init step runs in a re-executed copy of the calling
+// program, so programs using Container must call Init first thing in main.
+type Container struct {
+	ID   string
+	Spec *Spec
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	cmd    *exec.Cmd
+	cgroup *Cgroup
+}
+
+// CgroupPath returns the cgroup the container runs in, relative to
+// CgroupRoot, or "" if it needs none.
+func (c *Container) CgroupPath() string {
+	l := c.Spec.Linux
+	if l == nil || (l.CgroupsPath == "" && l.Resources == nil) {
+		return ""
+	}
+	if l.CgroupsPath != "" {
+		return l.CgroupsPath
+	}
+	return "oci/" + c.ID
+}
+
+func idMap(m []IDMapping) []syscall.SysProcIDMap {
+	var r []syscall.SysProcIDMap
+	for _, e := range m {
+		r = append(r, syscall.SysProcIDMap{ContainerID: int(e.ContainerID), HostID: int(e.HostID), Size: int(e.Size)})
+	}
+	return r
+}
+
+func mapsRoot(m []syscall.SysProcIDMap) bool {
+	for _, e := range m {
+		if e.ContainerID == 0 && e.Size > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Container) sysProcAttr() *syscall.SysProcAttr {
+	s := c.Spec
+	attr := &syscall.SysProcAttr{
+		Setsid:    true,
+		Setctty:   s.Process.Terminal,
+		Pdeathsig: syscall.SIGKILL,
+	}
+	if s.Linux == nil {
+		return attr
+	}
+	for _, ns := range s.Linux.Namespaces {
+		if ns.Path == "" {
+			attr.Cloneflags |= cloneFlags[ns.Type]
+		}
+	}
+	if s.HasNamespace(UserNamespace) {
+		attr.UidMappings = idMap(s.Linux.UIDMappings)
+		attr.GidMappings = idMap(s.Linux.GIDMappings)
+		// Without mappings, map root in the container to the caller, as
+		// unprivileged users are allowed to.
+		if len(attr.UidMappings) == 0 {
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+		}
+		if len(attr.GidMappings) == 0 {
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+		}
+		// Only a privileged parent may allow setgroups in the child.
+		attr.GidMappingsEnableSetgroups = os.Geteuid() == 0
+		// Become root in the namespace before executing init, or the
+		// exec drops all capabilities when the caller's IDs are not
+		// mapped to root.
+		if mapsRoot(attr.UidMappings) && mapsRoot(attr.GidMappings) {
+			attr.Credential = &syscall.Credential{NoSetGroups: !attr.GidMappingsEnableSetgroups}
+		}
+	}
+	return attr
+}
+
+// Start starts the container and returns once its process has been set up
+// and executed, or failed to.
+func (c *Container) Start() error {
+	if c.cmd != nil {
+		return errors.New("container already started")
+	}
+	if err := c.Spec.Validate(); err != nil {
+		return err
+	}
+	spec, err := json.Marshal(c.Spec)
+	if err != nil {
+		return err
+	}
+
+	var files [3][2]*os.File
+	for i := range files {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		defer w.Close()
+		files[i] = [2]*os.File{r, w}
+	}
+	specR, specW := files[0][0], files[0][1]
+	syncR, syncW := files[1][0], files[1][1]
+	errR, errW := files[2][0], files[2][1]
+
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Args = []string{os.Args[0]}
+	cmd.Env = []string{initEnv + "=1"}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.Stdin, c.Stdout, c.Stderr
+	cmd.ExtraFiles = []*os.File{specR, syncR, errW}
+	cmd.SysProcAttr = c.sysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting container init: %w", err)
+	}
+	specR.Close()
+	syncR.Close()
+	errW.Close()
+
+	fail := func(err error) error {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if c.cgroup != nil {
+			c.cgroup.Destroy()
+			c.cgroup = nil
+		}
+		return err
+	}
+	if _, err := specW.Write(spec); err != nil {
+		return fail(err)
+	}
+	specW.Close()
+
+	if p := c.CgroupPath(); p != "" {
+		cg, err := NewCgroup(p, c.Spec.Linux.Resources)
+		if err != nil {
+			return fail(err)
+		}
+		c.cgroup = cg
+		if err := cg.Add(cmd.Process.Pid); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := syncW.Write([]byte{0}); err != nil {
+		return fail(err)
+	}
+	syncW.Close()
+
+	// The error pipe is close-on-exec in the child: EOF means the
+	// container process is running.
+	msg, err := io.ReadAll(errR)
+	if err != nil {
+		return fail(err)
+	}
+	if len(msg) > 0 {
+		return fail(fmt.Errorf("container init: %s", msg))
+	}
+	c.cmd = cmd
+	return nil
+}
+
+// Pid returns the host pid of the container process.
+func (c *Container) Pid() int {
+	return c.cmd.Process.Pid
+}
+
+// Wait waits for the container process to exit and removes its cgroup.
+func (c *Container) Wait() error {
+	if c.cmd == nil {
+		return errors.New("container not started")
+	}
+	err := c.cmd.Wait()
+	if c.cgroup != nil {
+		if cerr := c.cgroup.Destroy(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Run starts the container and waits for it.
+func (c *Container) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
@@ -0,0 +1,249 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Init sets up the container and executes its process if the calling
+// program was started by Container.Start. Otherwise it returns at once.
+//
+// On failure the error is passed to the parent and Init exits.
+func Init() {
+	if os.Getenv(initEnv) != "1" {
+		return
+	}
+	// Capabilities and credentials set below are per thread, and the
+	// process must be executed from the same thread.
+	runtime.LockOSThread()
+	errPipe := os.NewFile(errFD, "error pipe")
+	err := initContainer()
+	fmt.Fprintf(errPipe, "%v", err)
+	os.Exit(1)
+}
+
+func initContainer() error {
+	unix.CloseOnExec(errFD)
+	var s Spec
+	specPipe := os.NewFile(specFD, "spec pipe")
+	if err := json.NewDecoder(specPipe).Decode(&s); err != nil {
+		return fmt.Errorf("reading spec: %w", err)
+	}
+	specPipe.Close()
+
+	// Wait for the parent to put us into the cgroup.
+	syncPipe := os.NewFile(syncFD, "sync pipe")
+	if _, err := syncPipe.Read(make([]byte, 1)); err != nil {
+		return fmt.Errorf("waiting for parent: %w", err)
+	}
+	syncPipe.Close()
+
+	if err := joinNamespaces(&s); err != nil {
+		return err
+	}
+	if err := setupRootfs(&s); err != nil {
+		return err
+	}
+	if s.HasNamespace(UTSNamespace) && s.Hostname != "" {
+		if err := unix.Sethostname([]byte(s.Hostname)); err != nil {
+			return fmt.Errorf("sethostname: %w", err)
+		}
+	}
+	if s.Linux != nil {
+		for k, v := range s.Linux.Sysctl {
+			p := filepath.Join("/proc/sys", strings.ReplaceAll(k, ".", "/"))
+			if err := os.WriteFile(p, []byte(v), 0o644); err != nil {
+				return fmt.Errorf("sysctl %s: %w", k, err)
+			}
+		}
+	}
+	return execProcess(&s)
+}
+
+func joinNamespaces(s *Spec) error {
+	if s.Linux == nil {
+		return nil
+	}
+	for _, ns := range s.Linux.Namespaces {
+		if ns.Path == "" {
+			continue
+		}
+		fd, err := unix.Open(ns.Path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("%s namespace: %w", ns.Type, err)
+		}
+		err = unix.Setns(fd, int(cloneFlags[ns.Type]))
+		unix.Close(fd)
+		if err != nil {
+			return fmt.Errorf("joining %s namespace %s: %w", ns.Type, ns.Path, err)
+		}
+	}
+	return nil
+}
+
+func setupRootfs(s *Spec) error {
+	rootfs := s.Root.Path
+	if !s.HasNamespace(MountNamespace) {
+		// Mounts would leak into the host's namespace.
+		if len(s.Mounts) > 0 || s.Root.Readonly {
+			return fmt.Errorf("%w: mounts need a mount namespace", ErrInvalidSpec)
+		}
+		if err := unix.Chroot(rootfs); err != nil {
+			return fmt.Errorf("chroot: %w", err)
+		}
+		return unix.Chdir("/")
+	}
+
+	prop := uintptr(unix.MS_SLAVE | unix.MS_REC)
+	if s.Linux != nil && s.Linux.RootfsPropagation != "" {
+		p, ok := propagationFlags[s.Linux.RootfsPropagation]
+		if !ok {
+			return fmt.Errorf("%w: bad rootfs propagation %q", ErrInvalidSpec, s.Linux.RootfsPropagation)
+		}
+		prop = p
+	}
+	if err := unix.Mount("", "/", "", prop, ""); err != nil {
+		return fmt.Errorf("setting root propagation: %w", err)
+	}
+	// pivot_root needs the new root to be a mount point.
+	if err := unix.Mount(rootfs, rootfs, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("binding rootfs: %w", err)
+	}
+	for _, m := range s.Mounts {
+		if err := mountOne(rootfs, m); err != nil {
+			return err
+		}
+	}
+	if err := populateDev(rootfs); err != nil {
+		return err
+	}
+	if err := pivotRoot(rootfs); err != nil {
+		return err
+	}
+	if s.Linux != nil {
+		for _, p := range s.Linux.MaskedPaths {
+			if err := maskPath(p); err != nil {
+				return fmt.Errorf("masking %s: %w", p, err)
+			}
+		}
+		for _, p := range s.Linux.ReadonlyPaths {
+			if err := readonlyPath(p); err != nil {
+				return fmt.Errorf("making %s read-only: %w", p, err)
+			}
+		}
+	}
+	if s.Root.Readonly {
+		if err := remountBind("/", unix.MS_RDONLY); err != nil {
+			return fmt.Errorf("making root read-only: %w", err)
+		}
+	}
+	return nil
+}
+
+// execProcess drops privileges and executes the container process. The
+// seccomp filter goes last so that it only has to allow the system calls
+// of execve and of the process itself.
+func execProcess(s *Spec) error {
+	p := s.Process
+	for _, r := range p.Rlimits {
+		rl := unix.Rlimit{Cur: r.Soft, Max: r.Hard}
+		if err := unix.Setrlimit(rlimits[r.Type], &rl); err != nil {
+			return fmt.Errorf("setrlimit %s: %w", r.Type, err)
+		}
+	}
+	if p.User.Umask != nil {
+		unix.Umask(int(*p.User.Umask))
+	}
+	if p.Capabilities != nil {
+		if err := dropBounding(p.Capabilities); err != nil {
+			return fmt.Errorf("dropping bounding capabilities: %w", err)
+		}
+	}
+	var sc *Seccomp
+	if s.Linux != nil {
+		sc = s.Linux.Seccomp
+	}
+	if p.NoNewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("no_new_privs: %w", err)
+		}
+	} else if sc != nil {
+		// Without no_new_privs installing the filter needs
+		// CAP_SYS_ADMIN, which the process may be about to lose.
+		if err := installSeccomp(sc); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+		sc = nil
+	}
+	if err := setUser(p); err != nil {
+		return err
+	}
+	if p.Cwd != "" {
+		if err := unix.Chdir(p.Cwd); err != nil {
+			return fmt.Errorf("chdir %s: %w", p.Cwd, err)
+		}
+	}
+
+	os.Clearenv()
+	for _, e := range p.Env {
+		k, v, _ := strings.Cut(e, "=")
+		os.Setenv(k, v)
+	}
+	path, err := exec.LookPath(p.Args[0])
+	if err != nil {
+		return err
+	}
+	if sc != nil {
+		if err := installSeccomp(sc); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+	}
+	if err := unix.Exec(path, p.Args, p.Env); err != nil {
+		return fmt.Errorf("exec %s: %w", path, err)
+	}
+	return nil
+}
+
+// setUser switches to the process user, keeping the configured
+// capabilities.
+func setUser(p *Process) error {
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	gids := make([]int, len(p.User.AdditionalGids))
+	for i, g := range p.User.AdditionalGids {
+		gids[i] = int(g)
+	}
+	// Unprivileged user namespaces deny setgroups, which is fine as long
+	// as no groups were asked for.
+	if err := unix.Setgroups(gids); err != nil && (len(gids) > 0 || !errors.Is(err, unix.EPERM)) {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := unix.Setresgid(int(p.User.GID), int(p.User.GID), int(p.User.GID)); err != nil {
+		return fmt.Errorf("setgid %d: %w", p.User.GID, err)
+	}
+	if err := unix.Setresuid(int(p.User.UID), int(p.User.UID), int(p.User.UID)); err != nil {
+		return fmt.Errorf("setuid %d: %w", p.User.UID, err)
+	}
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 0, 0, 0, 0); err != nil {
+		return err
+	}
+	if p.Capabilities != nil {
+		if err := setCaps(p.Capabilities); err != nil {
+			return fmt.Errorf("setting capabilities: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountFlags are the fstab style options that map to mount flags. A clear
+// flag removes the bits instead of setting them.
+var mountFlags = map[string]struct {
+	clear bool
+	flag  uintptr
+}{
+	"async":         {true, unix.MS_SYNCHRONOUS},
+	"atime":         {true, unix.MS_NOATIME},
+	"bind":          {false, unix.MS_BIND},
+	"defaults":      {false, 0},
+	"dev":           {true, unix.MS_NODEV},
+	"diratime":      {true, unix.MS_NODIRATIME},
+	"dirsync":       {false, unix.MS_DIRSYNC},
+	"exec":          {true, unix.MS_NOEXEC},
+	"mand":          {false, unix.MS_MANDLOCK},
+	"noatime":       {false, unix.MS_NOATIME},
+	"nodev":         {false, unix.MS_NODEV},
+	"nodiratime":    {false, unix.MS_NODIRATIME},
+	"noexec":        {false, unix.MS_NOEXEC},
+	"nomand":        {true, unix.MS_MANDLOCK},
+	"norelatime":    {true, unix.MS_RELATIME},
+	"nostrictatime": {true, unix.MS_STRICTATIME},
+	"nosuid":        {false, unix.MS_NOSUID},
+	"rbind":         {false, unix.MS_BIND | unix.MS_REC},
+	"relatime":      {false, unix.MS_RELATIME},
+	"remount":       {false, unix.MS_REMOUNT},
+	"ro":            {false, unix.MS_RDONLY},
+	"rw":            {true, unix.MS_RDONLY},
+	"strictatime":   {false, unix.MS_STRICTATIME},
+	"suid":          {true, unix.MS_NOSUID},
+	"sync":          {false, unix.MS_SYNCHRONOUS},
+}
+
+// propagationFlags are the options that change mount propagation.
+var propagationFlags = map[string]uintptr{
+	"private":     unix.MS_PRIVATE,
+	"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
+	"shared":      unix.MS_SHARED,
+	"rshared":     unix.MS_SHARED | unix.MS_REC,
+	"slave":       unix.MS_SLAVE,
+	"rslave":      unix.MS_SLAVE | unix.MS_REC,
+	"unbindable":  unix.MS_UNBINDABLE,
+	"runbindable": unix.MS_UNBINDABLE | unix.MS_REC,
+}
+
+// parseMountOptions splits OCI mount options into mount flags, propagation
+// changes and file system specific data.
+func parseMountOptions(opts []string) (flags uintptr, prop []uintptr, data string) {
+	var d []string
+	for _, o := range opts {
+		if f, ok := mountFlags[o]; ok {
+			if f.clear {
+				flags &^= f.flag
+			} else {
+				flags |= f.flag
+			}
+			continue
+		}
+		if p, ok := propagationFlags[o]; ok {
+			prop = append(prop, p)
+			continue
+		}
+		d = append(d, o)
+	}
+	return flags, prop, strings.Join(d, ",")
+}
+
+// lockedFlags returns the flags of the mount at path that an unprivileged
+// remount must keep.
+func lockedFlags(path string) uintptr {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0
+	}
+	var f uintptr
+	for sf, mf := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if int64(st.Flags)&sf != 0 {
+			f |= mf
+		}
+	}
+	return f
+}
+
+// remountBind applies flags to the bind mount at path.
+func remountBind(path string, flags uintptr) error {
+	flags |= lockedFlags(path)
+	return unix.Mount("", path, "", unix.MS_BIND|unix.MS_REMOUNT|flags, "")
+}
+
+// mountOne mounts m below rootfs.
+//
+// Destinations are joined to rootfs without resolving symlinks, so the
+// root file system must be trusted.
+func mountOne(rootfs string, m Mount) error {
+	flags, prop, data := parseMountOptions(m.Options)
+	dst := filepath.Join(rootfs, m.Destination)
+	typ := m.Type
+	if typ == "cgroup" {
+		// Only the unified hierarchy is supported.
+		typ = "cgroup2"
+	}
+
+	bind := flags&unix.MS_BIND != 0 || typ == "bind"
+	if bind {
+		flags |= unix.MS_BIND
+		st, err := os.Stat(m.Source)
+		if err != nil {
+			return err
+		}
+		if err := mkMountpoint(dst, st.IsDir()); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+
+	mflags := flags
+	if bind {
+		// Bind mounts ignore all other flags until they are remounted.
+		mflags &= unix.MS_BIND | unix.MS_REC
+	}
+	if err := unix.Mount(m.Source, dst, typ, mflags, data); err != nil {
+		return fmt.Errorf("mounting %s on %s: %w", m.Source, m.Destination, err)
+	}
+	if remount := flags &^ (unix.MS_BIND | unix.MS_REC | unix.MS_REMOUNT); bind && remount != 0 {
+		if err := remountBind(dst, remount); err != nil {
+			return fmt.Errorf("remounting %s: %w", m.Destination, err)
+		}
+	}
+	for _, p := range prop {
+		if err := unix.Mount("", dst, "", p, ""); err != nil {
+			return fmt.Errorf("setting propagation of %s: %w", m.Destination, err)
+		}
+	}
+	return nil
+}
+
+// mkMountpoint creates a directory or an empty file to mount on.
+func mkMountpoint(path string, dir bool) error {
+	if dir {
+		return os.MkdirAll(path, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// defaultDevices are bind mounted from the host into /dev, which works in
+// user namespaces where mknod does not.
+var defaultDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+var defaultLinks = [][2]string{
+	{"/proc/self/fd", "fd"},
+	{"/proc/self/fd/0", "stdin"},
+	{"/proc/self/fd/1", "stdout"},
+	{"/proc/self/fd/2", "stderr"},
+	{"pts/ptmx", "ptmx"},
+	{"/proc/kcore", "core"},
+}
+
+// populateDev makes the default devices and links in rootfs/dev.
+func populateDev(rootfs string) error {
+	dev := filepath.Join(rootfs, "dev")
+	if _, err := os.Stat(dev); err != nil {
+		return nil
+	}
+	for _, d := range defaultDevices {
+		dst := filepath.Join(dev, d)
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		if err := mkMountpoint(dst, false); err != nil {
+			return err
+		}
+		if err := unix.Mount(filepath.Join("/dev", d), dst, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("binding /dev/%s: %w", d, err)
+		}
+	}
+	for _, l := range defaultLinks {
+		if err := os.Symlink(l[0], filepath.Join(dev, l[1])); err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// pivotRoot makes rootfs the root of the mount namespace and detaches the
+// old root.
+func pivotRoot(rootfs string) error {
+	if err := unix.Chdir(rootfs); err != nil {
+		return err
+	}
+	// Stacking the old root below the new one avoids needing a directory
+	// for it.
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detaching old root: %w", err)
+	}
+	return unix.Chdir("/")
+}
+
+// maskPath hides path: directories get an empty read-only tmpfs, anything
+// else /dev/null.
+func maskPath(path string) error {
+	st, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "")
+	}
+	return unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+}
+
+// readonlyPath makes path read-only.
+func readonlyPath(path string) error {
+	if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return remountBind(path, unix.MS_RDONLY)
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	for _, tt := range []struct {
+		opts  []string
+		flags uintptr
+		prop  []uintptr
+		data  string
+	}{
+		{},
+		{
+			opts:  []string{"nosuid", "noexec", "nodev", "mode=755", "size=65536k"},
+			flags: unix.MS_NOSUID | unix.MS_NOEXEC | unix.MS_NODEV,
+			data:  "mode=755,size=65536k",
+		},
+		{
+			opts:  []string{"rbind", "ro", "rw", "rprivate"},
+			flags: unix.MS_BIND | unix.MS_REC,
+			prop:  []uintptr{unix.MS_PRIVATE | unix.MS_REC},
+		},
+		{
+			opts:  []string{"newinstance", "ptmxmode=0666", "nosuid", "suid", "noexec", "slave"},
+			flags: unix.MS_NOEXEC,
+			prop:  []uintptr{unix.MS_SLAVE},
+			data:  "newinstance,ptmxmode=0666",
+		},
+	} {
+		flags, prop, data := parseMountOptions(tt.opts)
+		if flags != tt.flags || data != tt.data || !cmp.Equal(prop, tt.prop) {
+			t.Errorf("parseMountOptions(%q) = %#x, %#x, %q, want %#x, %#x, %q", tt.opts, flags, prop, data, tt.flags, tt.prop, tt.data)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"fmt"
+
+	"golang.org/x/net/bpf"
+)
+
+// Seccomp return values from linux/seccomp.h.
+const (
+	seccompRetKillThread  = 0x00000000
+	seccompRetKillProcess = 0x80000000
+	seccompRetTrap        = 0x00030000
+	seccompRetErrno       = 0x00050000
+	seccompRetTrace       = 0x7ff00000
+	seccompRetLog         = 0x7ffc0000
+	seccompRetAllow       = 0x7fff0000
+)
+
+// Audit architectures from linux/audit.h.
+const (
+	auditArchX86_64  = 0xc000003e
+	auditArchAARCH64 = 0xc00000b7
+	auditArchRISCV64 = 0xc00000f3
+
+	// x32SyscallBit is set in the system call numbers of the x32 ABI,
+	// which also run with auditArchX86_64.
+	x32SyscallBit = 0x40000000
+)
+
+// Offsets into struct seccomp_data.
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArgs = 16
+)
+
+// seccompAction returns the filter return value for an OCI action name.
+func seccompAction(action string, errnoRet *uint) (uint32, error) {
+	ret := uint32(1) // EPERM
+	if errnoRet != nil {
+		ret = uint32(*errnoRet) & 0xffff
+	}
+	switch action {
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		return seccompRetKillThread, nil
+	case "SCMP_ACT_KILL_PROCESS":
+		return seccompRetKillProcess, nil
+	case "SCMP_ACT_TRAP":
+		return seccompRetTrap, nil
+	case "SCMP_ACT_ERRNO":
+		return seccompRetErrno | ret, nil
+	case "SCMP_ACT_TRACE":
+		return seccompRetTrace | ret, nil
+	case "SCMP_ACT_LOG":
+		return seccompRetLog, nil
+	case "SCMP_ACT_ALLOW":
+		return seccompRetAllow, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported seccomp action %q", ErrInvalidSpec, action)
+}
+
+// Jump targets while assembling a rule.
+const (
+	toNext = iota // the following instruction
+	toPass        // the first instruction after the current argument check
+	toFail        // the first instruction after the rule
+)
+
+type step struct {
+	ins  bpf.Instruction
+	jump bool
+	cond bpf.JumpTest
+	val  uint32
+	t, f int
+}
+
+func load(off uint32) step {
+	return step{ins: bpf.LoadAbsolute{Off: off, Size: 4}}
+}
+
+func jump(cond bpf.JumpTest, val uint32, t, f int) step {
+	return step{jump: true, cond: cond, val: val, t: t, f: f}
+}
+
+// argSteps compares the 64-bit argument a.Index with a.Value. Arguments
+// are loaded as two 32-bit words, which assumes a little-endian machine.
+func argSteps(a Arg) ([]step, error) {
+	if a.Index > 5 {
+		return nil, fmt.Errorf("%w: seccomp argument index %d out of range", ErrInvalidSpec, a.Index)
+	}
+	lo := load(seccompDataArgs + 8*uint32(a.Index))
+	hi := load(seccompDataArgs + 8*uint32(a.Index) + 4)
+	vlo, vhi := uint32(a.Value), uint32(a.Value>>32)
+	switch a.Op {
+	case "SCMP_CMP_EQ":
+		return []step{
+			hi, jump(bpf.JumpEqual, vhi, toNext, toFail),
+			lo, jump(bpf.JumpEqual, vlo, toPass, toFail),
+		}, nil
+	case "SCMP_CMP_NE":
+		return []step{
+			hi, jump(bpf.JumpEqual, vhi, toNext, toPass),
+			lo, jump(bpf.JumpEqual, vlo, toFail, toPass),
+		}, nil
+	case "SCMP_CMP_MASKED_EQ":
+		v2lo, v2hi := uint32(a.ValueTwo), uint32(a.ValueTwo>>32)
+		return []step{
+			hi, {ins: bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: vhi}}, jump(bpf.JumpEqual, v2hi, toNext, toFail),
+			lo, {ins: bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: vlo}}, jump(bpf.JumpEqual, v2lo, toPass, toFail),
+		}, nil
+	case "SCMP_CMP_GT", "SCMP_CMP_GE":
+		last := jump(bpf.JumpGreaterThan, vlo, toPass, toFail)
+		if a.Op == "SCMP_CMP_GE" {
+			last.cond = bpf.JumpGreaterOrEqual
+		}
+		return []step{
+			hi, jump(bpf.JumpGreaterThan, vhi, toPass, toNext), jump(bpf.JumpEqual, vhi, toNext, toFail),
+			lo, last,
+		}, nil
+	case "SCMP_CMP_LT", "SCMP_CMP_LE":
+		last := jump(bpf.JumpGreaterOrEqual, vlo, toFail, toPass)
+		if a.Op == "SCMP_CMP_LE" {
+			last.cond = bpf.JumpGreaterThan
+		}
+		return []step{
+			hi, jump(bpf.JumpGreaterOrEqual, vhi, toNext, toPass), jump(bpf.JumpEqual, vhi, toNext, toFail),
+			lo, last,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported seccomp operator %q", ErrInvalidSpec, a.Op)
+}
+
+// ruleBlock returns action if the system call is nr and all args match,
+// and falls through to the next instruction otherwise.
+func ruleBlock(nr uint32, args []Arg, action uint32) ([]bpf.Instruction, error) {
+	steps := []step{load(seccompDataNr), jump(bpf.JumpEqual, nr, toNext, toFail)}
+	pass := []int{0, 0}
+	for _, a := range args {
+		s, err := argSteps(a)
+		if err != nil {
+			return nil, err
+		}
+		end := len(steps) + len(s)
+		for range s {
+			pass = append(pass, end)
+		}
+		steps = append(steps, s...)
+	}
+	steps = append(steps, step{ins: bpf.RetConstant{Val: action}})
+
+	fail := len(steps)
+	prog := make([]bpf.Instruction, len(steps))
+	for i, s := range steps {
+		if !s.jump {
+			prog[i] = s.ins
+			continue
+		}
+		target := func(t int) (uint8, error) {
+			var to int
+			switch t {
+			case toNext:
+				to = i + 1
+			case toPass:
+				to = pass[i]
+			case toFail:
+				to = fail
+			}
+			if to-i-1 > 255 {
+				return 0, fmt.Errorf("%w: seccomp rule too long", ErrInvalidSpec)
+			}
+			return uint8(to - i - 1), nil
+		}
+		st, err := target(s.t)
+		if err != nil {
+			return nil, err
+		}
+		sf, err := target(s.f)
+		if err != nil {
+			return nil, err
+		}
+		prog[i] = bpf.JumpIf{Cond: s.cond, Val: s.val, SkipTrue: st, SkipFalse: sf}
+	}
+	return prog, nil
+}
+
+// compileSeccomp turns sc into a classic BPF program for the audit
+// architecture arch. System calls from other architectures, and from the
+// x32 ABI on x86-64, kill the process. sysno maps names to numbers; names it does not know are
+// ignored, as libseccomp does.
+func compileSeccomp(sc *Seccomp, arch uint32, sysno func(string) (uint32, bool)) ([]bpf.RawInstruction, error) {
+	def, err := seccompAction(sc.DefaultAction, sc.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+	prog := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: seccompDataArch, Size: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: arch, SkipTrue: 1},
+		bpf.RetConstant{Val: seccompRetKillProcess},
+	}
+	if arch == auditArchX86_64 {
+		// Else a denied system call could be made by its x32 number.
+		prog = append(prog,
+			bpf.LoadAbsolute{Off: seccompDataNr, Size: 4},
+			bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: x32SyscallBit, SkipFalse: 1},
+			bpf.RetConstant{Val: seccompRetKillProcess},
+		)
+	}
+	for _, r := range sc.Syscalls {
+		action, err := seccompAction(r.Action, r.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range r.Names {
+			nr, ok := sysno(name)
+			if !ok {
+				continue
+			}
+			b, err := ruleBlock(nr, r.Args, action)
+			if err != nil {
+				return nil, err
+			}
+			prog = append(prog, b...)
+		}
+	}
+	prog = append(prog, bpf.RetConstant{Val: def})
+	return bpf.Assemble(prog)
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build arm64 || amd64 || riscv64
+
+package oci
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/u-root/u-root/pkg/strace"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+)
+
+var nativeArch = map[string]uint32{
+	"amd64":   auditArchX86_64,
+	"arm64":   auditArchAARCH64,
+	"riscv64": auditArchRISCV64,
+}[runtime.GOARCH]
+
+func nativeSysno(name string) (uint32, bool) {
+	n, err := strace.ByName(name)
+	return uint32(n), err == nil
+}
+
+// installSeccomp loads the filter for sc into all threads of the process.
+// no_new_privs must already be set, or the caller must have CAP_SYS_ADMIN.
+func installSeccomp(sc *Seccomp) error {
+	raw, err := compileSeccomp(sc, nativeArch, nativeSysno)
+	if err != nil {
+		return err
+	}
+	filter := make([]unix.SockFilter, len(raw))
+	for i, r := range raw {
+		filter[i] = unix.SockFilter{Code: r.Op, Jt: r.Jt, Jf: r.Jf, K: r.K}
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
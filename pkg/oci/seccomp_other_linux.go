@@ -0,0 +1,17 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !arm64 && !amd64 && !riscv64
+
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+func installSeccomp(*Seccomp) error {
+	return fmt.Errorf("seccomp on %s: %w", runtime.GOARCH, errors.ErrUnsupported)
+}
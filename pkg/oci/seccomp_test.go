@@ -0,0 +1,155 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+var testSyscalls = map[string]uint32{
+	"read":  0,
+	"write": 1,
+	"open":  2,
+	"ioctl": 16,
+}
+
+func testSysno(name string) (uint32, bool) {
+	n, ok := testSyscalls[name]
+	return n, ok
+}
+
+// seccompData builds a struct seccomp_data. The BPF VM loads big-endian
+// words, so every 32-bit word is stored big-endian here, which is what a
+// native load sees on a little-endian kernel.
+func seccompData(arch, nr uint32, args ...uint64) []byte {
+	b := make([]byte, 64)
+	binary.BigEndian.PutUint32(b[0:], nr)
+	binary.BigEndian.PutUint32(b[4:], arch)
+	for i, a := range args {
+		binary.BigEndian.PutUint32(b[16+8*i:], uint32(a))
+		binary.BigEndian.PutUint32(b[16+8*i+4:], uint32(a>>32))
+	}
+	return b
+}
+
+func uintp(u uint) *uint { return &u }
+
+func TestSeccomp(t *testing.T) {
+	sc := &Seccomp{
+		DefaultAction:   "SCMP_ACT_ERRNO",
+		DefaultErrnoRet: uintp(38),
+		Syscalls: []Syscall{
+			{Names: []string{"read", "write", "nosuchcall"}, Action: "SCMP_ACT_ALLOW"},
+			{Names: []string{"ioctl"}, Action: "SCMP_ACT_ALLOW", Args: []Arg{{Index: 1, Value: 0x5401, Op: "SCMP_CMP_EQ"}}},
+			{Names: []string{"ioctl"}, Action: "SCMP_ACT_KILL_PROCESS", Args: []Arg{{Index: 1, Value: 0xff00, ValueTwo: 0x4200, Op: "SCMP_CMP_MASKED_EQ"}}},
+			{Names: []string{"open"}, Action: "SCMP_ACT_ERRNO", Args: []Arg{
+				{Index: 2, Value: 0x1_0000_0000, Op: "SCMP_CMP_GE"},
+				{Index: 2, Value: 0x1_0000_0010, Op: "SCMP_CMP_LT"},
+			}},
+			{Names: []string{"open"}, Action: "SCMP_ACT_LOG", Args: []Arg{{Index: 0, Value: 7, Op: "SCMP_CMP_NE"}}},
+			{Names: []string{"open"}, Action: "SCMP_ACT_TRAP", Args: []Arg{{Index: 0, Value: 7, Op: "SCMP_CMP_LE"}}},
+		},
+	}
+	raw, err := compileSeccomp(sc, auditArchX86_64, testSysno)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := make([]bpf.Instruction, len(raw))
+	for i, r := range raw {
+		prog[i] = r.Disassemble()
+	}
+	vm, err := bpf.NewVM(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want uint32
+	}{
+		{"wrong arch", seccompData(auditArchAARCH64, 0), seccompRetKillProcess},
+		{"read", seccompData(auditArchX86_64, 0), seccompRetAllow},
+		{"x32 read", seccompData(auditArchX86_64, x32SyscallBit|0), seccompRetKillProcess},
+		{"x32 open", seccompData(auditArchX86_64, x32SyscallBit|2, 8), seccompRetKillProcess},
+		{"write", seccompData(auditArchX86_64, 1), seccompRetAllow},
+		{"default", seccompData(auditArchX86_64, 3), seccompRetErrno | 38},
+		{"ioctl TCGETS", seccompData(auditArchX86_64, 16, 1, 0x5401), seccompRetAllow},
+		{"ioctl high bits", seccompData(auditArchX86_64, 16, 1, 0x1_0000_5401), seccompRetErrno | 38},
+		{"ioctl masked", seccompData(auditArchX86_64, 16, 1, 0x4299), seccompRetKillProcess},
+		{"ioctl other", seccompData(auditArchX86_64, 16, 1, 0x4399), seccompRetErrno | 38},
+		{"open in range", seccompData(auditArchX86_64, 2, 7, 0, 0x1_0000_0005), seccompRetErrno | 1},
+		{"open range start", seccompData(auditArchX86_64, 2, 7, 0, 0x1_0000_0000), seccompRetErrno | 1},
+		{"open range end", seccompData(auditArchX86_64, 2, 7, 0, 0x1_0000_0010), seccompRetTrap},
+		{"open below range", seccompData(auditArchX86_64, 2, 7, 0, 0xffff_ffff), seccompRetTrap},
+		{"open ne", seccompData(auditArchX86_64, 2, 8), seccompRetLog},
+		{"open ne high", seccompData(auditArchX86_64, 2, 0x1_0000_0007), seccompRetLog},
+		{"open le", seccompData(auditArchX86_64, 2, 7), seccompRetTrap},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := vm.Run(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uint32(got) != tt.want {
+				t.Errorf("filter returned %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeccompLE(t *testing.T) {
+	sc := &Seccomp{
+		DefaultAction: "SCMP_ACT_ALLOW",
+		Syscalls: []Syscall{
+			{Names: []string{"write"}, Action: "SCMP_ACT_TRAP", Args: []Arg{{Index: 0, Value: 2, Op: "SCMP_CMP_LE"}}},
+			{Names: []string{"write"}, Action: "SCMP_ACT_KILL", Args: []Arg{{Index: 0, Value: 2, Op: "SCMP_CMP_GT"}}},
+		},
+	}
+	raw, err := compileSeccomp(sc, auditArchRISCV64, testSysno)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := make([]bpf.Instruction, len(raw))
+	for i, r := range raw {
+		prog[i] = r.Disassemble()
+	}
+	vm, err := bpf.NewVM(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fd, want := range map[uint64]uint32{
+		0:         seccompRetTrap,
+		2:         seccompRetTrap,
+		3:         seccompRetKillThread,
+		1 << 32:   seccompRetKillThread,
+		1<<32 | 1: seccompRetKillThread,
+	} {
+		got, err := vm.Run(seccompData(auditArchRISCV64, 1, fd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint32(got) != want {
+			t.Errorf("write(%#x): filter returned %#x, want %#x", fd, got, want)
+		}
+	}
+}
+
+func TestSeccompErrors(t *testing.T) {
+	for _, sc := range []*Seccomp{
+		{DefaultAction: "SCMP_ACT_NOTIFY"},
+		{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []Syscall{{Names: []string{"read"}, Action: "bogus"}}},
+		{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []Syscall{{Names: []string{"read"}, Action: "SCMP_ACT_KILL", Args: []Arg{{Index: 6, Op: "SCMP_CMP_EQ"}}}}},
+		{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []Syscall{{Names: []string{"read"}, Action: "SCMP_ACT_KILL", Args: []Arg{{Index: 0, Op: "SCMP_CMP_ODD"}}}}},
+	} {
+		if _, err := compileSeccomp(sc, auditArchX86_64, testSysno); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("compileSeccomp(%+v): got %v, want %v", sc, err, ErrInvalidSpec)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oci runs processes from OCI runtime-spec bundles.
+//
+// It implements the subset of the runtime specification that is useful for
+// isolating tools inside an initramfs: namespaces including user namespaces,
+// cgroup v2 resource limits, pivot_root, masked and read-only paths,
+// capabilities, rlimits and seccomp filters. Hooks, devices cgroups and
+// checkpointing are not supported.
+//
+// The types below mirror github.com/opencontainers/runtime-spec/specs-go,
+// restricted to the fields this package understands, so that config.json
+// files written for runc work unchanged.
+package oci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrInvalidSpec is returned for a config.json this package cannot run.
+var ErrInvalidSpec = errors.New("invalid OCI runtime spec")
+
+// Spec is the contents of an OCI bundle's config.json.
+type Spec struct {
+	Version  string   `json:"ociVersion"`
+	Process  *Process `json:"process,omitempty"`
+	Root     *Root    `json:"root,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	Mounts   []Mount  `json:"mounts,omitempty"`
+	Linux    *Linux   `json:"linux,omitempty"`
+}
+
+// Process is the container process.
+type Process struct {
+	Terminal        bool          `json:"terminal,omitempty"`
+	User            User          `json:"user"`
+	Args            []string      `json:"args,omitempty"`
+	Env             []string      `json:"env,omitempty"`
+	Cwd             string        `json:"cwd"`
+	Capabilities    *Capabilities `json:"capabilities,omitempty"`
+	Rlimits         []Rlimit      `json:"rlimits,omitempty"`
+	NoNewPrivileges bool          `json:"noNewPrivileges,omitempty"`
+}
+
+// User is the identity the process runs as.
+type User struct {
+	UID            uint32   `json:"uid"`
+	GID            uint32   `json:"gid"`
+	Umask          *uint32  `json:"umask,omitempty"`
+	AdditionalGids []uint32 `json:"additionalGids,omitempty"`
+}
+
+// Capabilities are the capability sets of the process, by name, e.g.
+// CAP_NET_ADMIN.
+type Capabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+// Rlimit is a resource limit, e.g. RLIMIT_NOFILE.
+type Rlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+// Root is the container's root file system.
+type Root struct {
+	// Path is relative to the bundle unless absolute.
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+// Mount is a file system mounted in the container.
+type Mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// Linux holds the Linux specific configuration.
+type Linux struct {
+	UIDMappings       []IDMapping       `json:"uidMappings,omitempty"`
+	GIDMappings       []IDMapping       `json:"gidMappings,omitempty"`
+	Sysctl            map[string]string `json:"sysctl,omitempty"`
+	Resources         *Resources        `json:"resources,omitempty"`
+	CgroupsPath       string            `json:"cgroupsPath,omitempty"`
+	Namespaces        []Namespace       `json:"namespaces,omitempty"`
+	Seccomp           *Seccomp          `json:"seccomp,omitempty"`
+	RootfsPropagation string            `json:"rootfsPropagation,omitempty"`
+	MaskedPaths       []string          `json:"maskedPaths,omitempty"`
+	ReadonlyPaths     []string          `json:"readonlyPaths,omitempty"`
+}
+
+// IDMapping maps a range of IDs in the container to the host.
+type IDMapping struct {
+	ContainerID uint32 `json:"containerID"`
+	HostID      uint32 `json:"hostID"`
+	Size        uint32 `json:"size"`
+}
+
+// NamespaceType is one of the Linux namespace kinds.
+type NamespaceType string
+
+// Namespace types.
+const (
+	PIDNamespace     NamespaceType = "pid"
+	NetworkNamespace NamespaceType = "network"
+	MountNamespace   NamespaceType = "mount"
+	IPCNamespace     NamespaceType = "ipc"
+	UTSNamespace     NamespaceType = "uts"
+	UserNamespace    NamespaceType = "user"
+	CgroupNamespace  NamespaceType = "cgroup"
+)
+
+var knownNamespaces = map[NamespaceType]bool{
+	PIDNamespace:     true,
+	NetworkNamespace: true,
+	MountNamespace:   true,
+	IPCNamespace:     true,
+	UTSNamespace:     true,
+	UserNamespace:    true,
+	CgroupNamespace:  true,
+}
+
+// joinable are the namespaces a multi-threaded process can setns into.
+// Joining user and mount namespaces requires a single-threaded caller, and
+// joining a pid namespace only affects children.
+var joinable = map[NamespaceType]bool{
+	NetworkNamespace: true,
+	IPCNamespace:     true,
+	UTSNamespace:     true,
+	CgroupNamespace:  true,
+}
+
+// Namespace is a namespace to create, or to join if Path is set.
+type Namespace struct {
+	Type NamespaceType `json:"type"`
+	Path string        `json:"path,omitempty"`
+}
+
+// Resources are cgroup limits.
+type Resources struct {
+	Memory *Memory `json:"memory,omitempty"`
+	CPU    *CPU    `json:"cpu,omitempty"`
+	Pids   *Pids   `json:"pids,omitempty"`
+}
+
+// Memory limits, in bytes.
+type Memory struct {
+	Limit       *int64 `json:"limit,omitempty"`
+	Reservation *int64 `json:"reservation,omitempty"`
+	// Swap is the limit of memory plus swap, as in cgroup v1.
+	Swap *int64 `json:"swap,omitempty"`
+}
+
+// CPU limits.
+type CPU struct {
+	Shares *uint64 `json:"shares,omitempty"`
+	Quota  *int64  `json:"quota,omitempty"`
+	Period *uint64 `json:"period,omitempty"`
+	Cpus   string  `json:"cpus,omitempty"`
+	Mems   string  `json:"mems,omitempty"`
+}
+
+// Pids limits the number of tasks.
+type Pids struct {
+	Limit int64 `json:"limit"`
+}
+
+// Seccomp is a seccomp filter specification.
+type Seccomp struct {
+	DefaultAction   string    `json:"defaultAction"`
+	DefaultErrnoRet *uint     `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string  `json:"architectures,omitempty"`
+	Syscalls        []Syscall `json:"syscalls,omitempty"`
+}
+
+// Syscall is a seccomp rule for a set of system calls.
+type Syscall struct {
+	Names    []string `json:"names"`
+	Action   string   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []Arg    `json:"args,omitempty"`
+}
+
+// Arg is a condition on a system call argument.
+type Arg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	Op       string `json:"op"`
+}
+
+// ConfigName is the name of the configuration file in a bundle.
+const ConfigName = "config.json"
+
+// Load reads bundle/config.json. The root path is made absolute.
+func Load(bundle string) (*Spec, error) {
+	b, err := os.ReadFile(filepath.Join(bundle, ConfigName))
+	if err != nil {
+		return nil, err
+	}
+	var s Spec
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", ConfigName, err)
+	}
+	if s.Root != nil && !filepath.IsAbs(s.Root.Path) {
+		abs, err := filepath.Abs(filepath.Join(bundle, s.Root.Path))
+		if err != nil {
+			return nil, err
+		}
+		s.Root.Path = abs
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate checks that s has everything needed to start a container.
+func (s *Spec) Validate() error {
+	if s.Process == nil || len(s.Process.Args) == 0 {
+		return fmt.Errorf("%w: process.args is required", ErrInvalidSpec)
+	}
+	if s.Root == nil || s.Root.Path == "" {
+		return fmt.Errorf("%w: root.path is required", ErrInvalidSpec)
+	}
+	if s.Process.Cwd != "" && !filepath.IsAbs(s.Process.Cwd) {
+		return fmt.Errorf("%w: process.cwd %q is not absolute", ErrInvalidSpec, s.Process.Cwd)
+	}
+	for _, m := range s.Mounts {
+		if !filepath.IsAbs(m.Destination) {
+			return fmt.Errorf("%w: mount destination %q is not absolute", ErrInvalidSpec, m.Destination)
+		}
+	}
+	if s.Linux == nil {
+		return nil
+	}
+	seen := map[NamespaceType]bool{}
+	for _, ns := range s.Linux.Namespaces {
+		if !knownNamespaces[ns.Type] {
+			return fmt.Errorf("%w: unknown namespace %q", ErrInvalidSpec, ns.Type)
+		}
+		if seen[ns.Type] {
+			return fmt.Errorf("%w: namespace %q listed twice", ErrInvalidSpec, ns.Type)
+		}
+		seen[ns.Type] = true
+		if ns.Path != "" && !joinable[ns.Type] {
+			return fmt.Errorf("%w: joining an existing %s namespace is not supported", ErrInvalidSpec, ns.Type)
+		}
+	}
+	if (len(s.Linux.UIDMappings) > 0 || len(s.Linux.GIDMappings) > 0) && !s.HasNamespace(UserNamespace) {
+		return fmt.Errorf("%w: uid/gid mappings need a user namespace", ErrInvalidSpec)
+	}
+	if s.Process.Capabilities != nil {
+		c := s.Process.Capabilities
+		for _, set := range [][]string{c.Bounding, c.Effective, c.Inheritable, c.Permitted, c.Ambient} {
+			if _, err := capMask(set); err != nil {
+				return err
+			}
+		}
+	}
+	for _, r := range s.Process.Rlimits {
+		if _, ok := rlimits[r.Type]; !ok {
+			return fmt.Errorf("%w: unknown rlimit %q", ErrInvalidSpec, r.Type)
+		}
+	}
+	return nil
+}
+
+// HasNamespace reports whether a new namespace of type t is created.
+func (s *Spec) HasNamespace(t NamespaceType) bool {
+	if s.Linux == nil {
+		return false
+	}
+	for _, ns := range s.Linux.Namespaces {
+		if ns.Type == t && ns.Path == "" {
+			return true
+		}
+	}
+	return false
+}
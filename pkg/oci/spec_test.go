@@ -0,0 +1,105 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oci
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `{
+	"ociVersion": "1.0.2",
+	"process": {
+		"user": {"uid": 1000, "gid": 1000},
+		"args": ["sh"],
+		"env": ["PATH=/bin"],
+		"cwd": "/",
+		"capabilities": {"bounding": ["CAP_NET_RAW", "kill"]},
+		"rlimits": [{"type": "RLIMIT_NOFILE", "hard": 1024, "soft": 1024}]
+	},
+	"root": {"path": "rootfs", "readonly": true},
+	"hostname": "diag",
+	"mounts": [{"destination": "/proc", "type": "proc", "source": "proc"}],
+	"linux": {
+		"namespaces": [{"type": "pid"}, {"type": "mount"}, {"type": "user"}, {"type": "network", "path": "/proc/1/ns/net"}],
+		"uidMappings": [{"containerID": 0, "hostID": 100000, "size": 65536}],
+		"resources": {"pids": {"limit": 32}}
+	}
+}`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ConfigName), []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "rootfs"); s.Root.Path != want {
+		t.Errorf("root path %q, want %q", s.Root.Path, want)
+	}
+	if s.Process.User.UID != 1000 || s.Hostname != "diag" || s.Linux.Resources.Pids.Limit != 32 {
+		t.Errorf("spec not decoded: %+v", s)
+	}
+	for ns, want := range map[NamespaceType]bool{
+		PIDNamespace:     true,
+		UserNamespace:    true,
+		NetworkNamespace: false, // joined, not created
+		UTSNamespace:     false,
+	} {
+		if got := s.HasNamespace(ns); got != want {
+			t.Errorf("HasNamespace(%s) = %v, want %v", ns, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Spec {
+		return &Spec{
+			Process: &Process{Args: []string{"sh"}, Cwd: "/"},
+			Root:    &Root{Path: "/rootfs"},
+			Linux:   &Linux{},
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+	for _, tt := range []struct {
+		name   string
+		modify func(*Spec)
+	}{
+		{"no args", func(s *Spec) { s.Process.Args = nil }},
+		{"no root", func(s *Spec) { s.Root = nil }},
+		{"relative cwd", func(s *Spec) { s.Process.Cwd = "tmp" }},
+		{"relative mount", func(s *Spec) { s.Mounts = []Mount{{Destination: "proc"}} }},
+		{"unknown namespace", func(s *Spec) { s.Linux.Namespaces = []Namespace{{Type: "time"}} }},
+		{"duplicate namespace", func(s *Spec) { s.Linux.Namespaces = []Namespace{{Type: "pid"}, {Type: "pid"}} }},
+		{"join user namespace", func(s *Spec) { s.Linux.Namespaces = []Namespace{{Type: "user", Path: "/proc/1/ns/user"}} }},
+		{"mappings without userns", func(s *Spec) { s.Linux.UIDMappings = []IDMapping{{Size: 1}} }},
+		{"bad capability", func(s *Spec) { s.Process.Capabilities = &Capabilities{Ambient: []string{"CAP_FLY"}} }},
+		{"bad rlimit", func(s *Spec) { s.Process.Rlimits = []Rlimit{{Type: "RLIMIT_BEER"}} }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.modify(s)
+			if err := s.Validate(); !errors.Is(err, ErrInvalidSpec) {
+				t.Errorf("Validate() = %v, want %v", err, ErrInvalidSpec)
+			}
+		})
+	}
+}
+
+func TestCapMask(t *testing.T) {
+	m, err := capMask([]string{"CAP_CHOWN", "net_admin", "CAP_CHECKPOINT_RESTORE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(1<<0 | 1<<12 | 1<<40); m != want {
+		t.Errorf("capMask = %#x, want %#x", m, want)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !race
+
+package oci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hugelgupf/vmtest"
+	"github.com/hugelgupf/vmtest/guest"
+	"github.com/hugelgupf/vmtest/qemu"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	Init()
+	if os.Getenv("OCI_TEST_HELPER") == "1" {
+		helper()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// helper reports what the container process sees.
+func helper() {
+	host, _ := os.Hostname()
+	fmt.Printf("uid=%d gid=%d host=%s\n", os.Getuid(), os.Getgid(), host)
+	status, _ := os.ReadFile("/proc/self/status")
+	for _, l := range strings.Split(string(status), "\n") {
+		k, v, _ := strings.Cut(l, ":")
+		switch k {
+		case "CapEff", "CapBnd", "NoNewPrivs", "Seccomp":
+			fmt.Printf("%s=%s\n", k, strings.TrimSpace(v))
+		}
+	}
+	fmt.Printf("pid=%d\n", os.Getpid())
+	fmt.Printf("mkdir=%v\n", errors.Is(os.Mkdir("/tmp/x", 0o755), os.ErrPermission))
+	cmdline, err := os.ReadFile("/proc/cmdline")
+	fmt.Printf("cmdline=%d %v\n", len(cmdline), err)
+	fmt.Printf("rofile=%v\n", os.WriteFile("/ro", nil, 0o644) != nil)
+}
+
+func TestIntegrationOCI(t *testing.T) {
+	vmtest.SkipIfNotArch(t, qemu.ArchAMD64)
+	vmtest.RunGoTestsInVM(t, []string{"github.com/u-root/u-root/pkg/oci"},
+		vmtest.WithVMOpt(vmtest.WithQEMUFn(qemu.WithVMTimeout(2*time.Minute))),
+	)
+}
+
+// testBundle makes a root file system holding a copy of the test binary.
+func testBundle(t *testing.T) string {
+	rootfs := t.TempDir()
+	// The container's root is not root on the host.
+	for _, d := range []string{rootfs, filepath.Dir(rootfs)} {
+		if err := os.Chmod(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exe, err := os.Open("/proc/self/exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exe.Close()
+	for _, d := range []string{"bin", "proc", "dev", "tmp"} {
+		if err := os.Mkdir(filepath.Join(rootfs, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(rootfs, "bin", "helper"), os.O_CREATE|os.O_WRONLY, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(f, exe); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return rootfs
+}
+
+func TestContainer(t *testing.T) {
+	guest.SkipIfNotInVM(t)
+
+	cgroot := t.TempDir()
+	if err := unix.Mount("cgroup2", cgroot, "cgroup2", 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Unmount(cgroot, unix.MNT_DETACH)
+	defer func(old string) { CgroupRoot = old }(CgroupRoot)
+	CgroupRoot = cgroot
+
+	errno := uint(unix.EACCES)
+	s := &Spec{
+		Process: &Process{
+			User: User{UID: 1000, GID: 1000},
+			Args: []string{"helper"},
+			Env:  []string{"PATH=/bin", "OCI_TEST_HELPER=1"},
+			Cwd:  "/",
+			Capabilities: &Capabilities{
+				Bounding:    []string{"CAP_KILL", "CAP_NET_RAW"},
+				Effective:   []string{"CAP_KILL"},
+				Permitted:   []string{"CAP_KILL"},
+				Inheritable: []string{"CAP_KILL"},
+				Ambient:     []string{"CAP_KILL"},
+			},
+			NoNewPrivileges: true,
+		},
+		Root:     &Root{Path: testBundle(t), Readonly: true},
+		Hostname: "oci-test",
+		Mounts: []Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc", Options: []string{"nosuid", "noexec", "nodev"}},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "mode=755"}},
+			{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs", Options: []string{"mode=1777"}},
+		},
+		Linux: &Linux{
+			Namespaces: []Namespace{
+				{Type: PIDNamespace}, {Type: MountNamespace}, {Type: UTSNamespace},
+				{Type: IPCNamespace}, {Type: NetworkNamespace}, {Type: UserNamespace},
+			},
+			UIDMappings: []IDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+			GIDMappings: []IDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+			Resources:   &Resources{Pids: &Pids{Limit: 16}},
+			MaskedPaths: []string{"/proc/cmdline"},
+			Seccomp: &Seccomp{
+				DefaultAction: "SCMP_ACT_ALLOW",
+				Syscalls: []Syscall{
+					{Names: []string{"mkdir", "mkdirat"}, Action: "SCMP_ACT_ERRNO", ErrnoRet: &errno},
+				},
+			},
+		},
+	}
+	var out bytes.Buffer
+	c := &Container{ID: "test", Spec: s, Stdout: &out, Stderr: os.Stderr}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(cgroot, "oci/test/pids.max"))
+	if err != nil || strings.TrimSpace(string(b)) != "16" {
+		t.Errorf("pids.max = %q, %v, want 16", b, err)
+	}
+	if err := c.Wait(); err != nil {
+		t.Fatalf("container: %v\n%s", err, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(cgroot, "oci/test")); !os.IsNotExist(err) {
+		t.Errorf("cgroup not removed: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"uid=1000 gid=1000 host=oci-test",
+		"CapEff=0000000000000020",
+		"CapBnd=0000000000002020",
+		"NoNewPrivs=1",
+		"Seccomp=2",
+		"pid=1",
+		"mkdir=true",
+		"cmdline=0 <nil>",
+		"rofile=true",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("container output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestContainerInitError(t *testing.T) {
+	guest.SkipIfNotInVM(t)
+
+	s := &Spec{
+		Process: &Process{Args: []string{"/no/such/binary"}, Cwd: "/"},
+		Root:    &Root{Path: testBundle(t)},
+		Linux:   &Linux{Namespaces: []Namespace{{Type: MountNamespace}, {Type: PIDNamespace}}},
+	}
+	c := &Container{ID: "fail", Spec: s}
+	err := c.Start()
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("Start() = %v, want a no such file error", err)
+	}
+}
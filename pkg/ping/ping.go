@@ -0,0 +1,286 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ping sends ICMP echo requests and probes, and reads the replies
+// and ICMP errors they cause. It is shared by ping and traceroute.
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Protocol numbers of the datagrams quoted by ICMP errors.
+const (
+	ProtoICMP   = 1
+	ProtoUDP    = 17
+	ProtoICMPv6 = 58
+)
+
+// ErrBadPMTUDisc is returned by ParsePMTUDisc for unknown strategies.
+var ErrBadPMTUDisc = errors.New("path MTU discovery must be one of do, want, dont or probe")
+
+// PMTUDisc is a path MTU discovery strategy, as in IP_MTU_DISCOVER.
+type PMTUDisc int
+
+// Path MTU discovery strategies. PMTUDiscDefault leaves that of the system.
+const (
+	PMTUDiscDefault PMTUDisc = iota
+	// PMTUDiscDont never sets the don't fragment bit.
+	PMTUDiscDont
+	// PMTUDiscWant fragments packets larger than the known path MTU.
+	PMTUDiscWant
+	// PMTUDiscDo sets the don't fragment bit, and fails to send packets
+	// larger than the known path MTU.
+	PMTUDiscDo
+	// PMTUDiscProbe sets the don't fragment bit, ignoring the known path
+	// MTU.
+	PMTUDiscProbe
+)
+
+// ParsePMTUDisc parses the strategies of ping -M.
+func ParsePMTUDisc(s string) (PMTUDisc, error) {
+	switch s {
+	case "do":
+		return PMTUDiscDo, nil
+	case "want":
+		return PMTUDiscWant, nil
+	case "dont":
+		return PMTUDiscDont, nil
+	case "probe":
+		return PMTUDiscProbe, nil
+	}
+	return PMTUDiscDefault, fmt.Errorf("%w: %q", ErrBadPMTUDisc, s)
+}
+
+// Opts are the options of the sockets of Listen and ListenUDP.
+type Opts struct {
+	// IPv6 selects ICMPv6 and IPv6.
+	IPv6 bool
+	// Source is the address to send from. If nil, any address is used.
+	Source net.IP
+	// Interface is the name of the network interface to send through.
+	Interface string
+	// TTL is the TTL, or hop limit for IPv6, of the packets sent. If
+	// zero, it is that of the system.
+	TTL int
+	// PMTUDisc is the path MTU discovery strategy.
+	PMTUDisc PMTUDisc
+	// Raw requires a raw socket. Otherwise, an unprivileged ICMP
+	// datagram socket is used if raw sockets are not permitted, which
+	// does not receive ICMP errors.
+	Raw bool
+}
+
+func (o *Opts) network(proto string) (string, string) {
+	if o.IPv6 {
+		return proto + "6", "::"
+	}
+	return proto + "4", "0.0.0.0"
+}
+
+func (o *Opts) address(unspec string) string {
+	if o.Source != nil {
+		return o.Source.String()
+	}
+	return unspec
+}
+
+// Conn is an ICMP socket.
+type Conn struct {
+	c     net.PacketConn
+	p4    *ipv4.PacketConn
+	p6    *ipv6.PacketConn
+	ipv6  bool
+	dgram bool
+	id    int
+	buf   []byte
+}
+
+// Listen opens an ICMP socket with the options of o.
+func Listen(o *Opts) (*Conn, error) {
+	network, unspec := o.network("ip")
+	if o.IPv6 {
+		network += ":ipv6-icmp"
+	} else {
+		network += ":icmp"
+	}
+	lc := net.ListenConfig{Control: control(o)}
+	c, err := lc.ListenPacket(context.Background(), network, o.address(unspec))
+	dgram := false
+	if errors.Is(err, os.ErrPermission) && !o.Raw {
+		c, err = listenDatagram(o)
+		dgram = true
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't open ICMP socket: %w", err)
+	}
+	conn := NewConn(c, o.IPv6, dgram)
+	if o.TTL != 0 {
+		if err := conn.SetTTL(o.TTL); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ListenUDP opens a UDP socket with the options of o, to send probes from.
+func ListenUDP(o *Opts) (net.PacketConn, error) {
+	network, unspec := o.network("udp")
+	lc := net.ListenConfig{Control: control(o)}
+	c, err := lc.ListenPacket(context.Background(), network, net.JoinHostPort(o.address(unspec), "0"))
+	if err != nil {
+		return nil, err
+	}
+	if o.TTL != 0 {
+		if err := SetTTL(c, o.IPv6, o.TTL); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// SetTTL sets the TTL, or hop limit for IPv6, of the packets c sends.
+func SetTTL(c net.PacketConn, v6 bool, ttl int) error {
+	switch c.(type) {
+	case *net.IPConn, *net.UDPConn:
+	default:
+		return fmt.Errorf("setting the TTL of %T: %w", c, errors.ErrUnsupported)
+	}
+	if v6 {
+		return ipv6.NewPacketConn(c).SetHopLimit(ttl)
+	}
+	return ipv4.NewPacketConn(c).SetTTL(ttl)
+}
+
+// NewConn returns a Conn of c, a raw ICMP socket or, if dgram, an ICMP
+// datagram socket.
+func NewConn(c net.PacketConn, v6, dgram bool) *Conn {
+	conn := &Conn{c: c, ipv6: v6, dgram: dgram, id: os.Getpid() & 0xffff, buf: make([]byte, 1<<16)}
+	if a, ok := c.LocalAddr().(*net.UDPAddr); ok && dgram {
+		// The kernel sets the ID of echo requests to the port.
+		conn.id = a.Port
+	}
+	switch c.(type) {
+	case *net.IPConn, *net.UDPConn:
+		// The TTL of replies is best effort.
+		if v6 {
+			conn.p6 = ipv6.NewPacketConn(c)
+			conn.p6.SetControlMessage(ipv6.FlagHopLimit, true)
+		} else {
+			conn.p4 = ipv4.NewPacketConn(c)
+			conn.p4.SetControlMessage(ipv4.FlagTTL, true)
+		}
+	}
+	return conn
+}
+
+// Datagram returns whether c is an unprivileged ICMP datagram socket.
+func (c *Conn) Datagram() bool {
+	return c.dgram
+}
+
+// SetTTL sets the TTL, or hop limit for IPv6, of the packets c sends.
+func (c *Conn) SetTTL(ttl int) error {
+	return SetTTL(c.c, c.ipv6, ttl)
+}
+
+// SetReadDeadline sets the deadline of Read.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.c.SetReadDeadline(t)
+}
+
+// Close closes the socket.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+// WriteEcho sends an echo request with seq and data to dst.
+func (c *Conn) WriteEcho(dst *net.IPAddr, seq int, data []byte) error {
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if c.ipv6 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	m := icmp.Message{Type: typ, Body: &icmp.Echo{ID: c.id, Seq: seq, Data: data}}
+	b, err := m.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	var addr net.Addr = dst
+	if c.dgram {
+		addr = &net.UDPAddr{IP: dst.IP, Zone: dst.Zone}
+	}
+	_, err = c.c.WriteTo(b, addr)
+	return err
+}
+
+// Read returns the next echo reply, or ICMP error about a packet of
+// ours, that c receives.
+func (c *Conn) Read() (*Reply, error) {
+	for {
+		n, ttl, from, err := c.readFrom(c.buf)
+		if err != nil {
+			return nil, err
+		}
+		r, err := ParseReply(c.buf[:n], c.ipv6)
+		if err != nil {
+			continue
+		}
+		r.From, r.TTL, r.Received = addrIP(from), ttl, time.Now()
+		if r.EchoReply() {
+			// Datagram sockets only receive their own replies.
+			if c.dgram || r.ID == c.id {
+				return r, nil
+			}
+			continue
+		}
+		switch r.Proto {
+		case ProtoICMP, ProtoICMPv6:
+			if r.ID == c.id {
+				return r, nil
+			}
+		case ProtoUDP:
+			return r, nil
+		}
+	}
+}
+
+func (c *Conn) readFrom(b []byte) (int, int, net.Addr, error) {
+	switch {
+	case c.p4 != nil:
+		n, cm, from, err := c.p4.ReadFrom(b)
+		if cm != nil {
+			return n, cm.TTL, from, err
+		}
+		return n, -1, from, err
+	case c.p6 != nil:
+		n, cm, from, err := c.p6.ReadFrom(b)
+		if cm != nil {
+			return n, cm.HopLimit, from, err
+		}
+		return n, -1, from, err
+	}
+	n, from, err := c.c.ReadFrom(b)
+	return n, -1, from, err
+}
+
+func addrIP(a net.Addr) net.IP {
+	switch a := a.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ping
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// quote returns an IP header of proto to dst followed by payload, as ICMP
+// errors quote packets.
+func quote(v6 bool, proto int, dst net.IP, payload []byte) []byte {
+	var h []byte
+	if v6 {
+		h = make([]byte, ipv6.HeaderLen)
+		h[0] = 6 << 4
+		h[6] = byte(proto)
+		copy(h[24:], dst.To16())
+	} else {
+		h = make([]byte, ipv4.HeaderLen)
+		h[0] = 4<<4 | ipv4.HeaderLen>>2
+		h[9] = byte(proto)
+		copy(h[16:], dst.To4())
+	}
+	return append(h, payload...)
+}
+
+func marshal(t *testing.T, m icmp.Message) []byte {
+	t.Helper()
+	b, err := m.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseReply(t *testing.T) {
+	dst4, dst6 := net.IPv4(192, 0, 2, 1).To4(), net.ParseIP("2001:db8::1")
+	echo := func(typ icmp.Type) []byte {
+		b := marshal(t, icmp.Message{Type: typ, Body: &icmp.Echo{ID: 42, Seq: 7}})
+		return b[:8]
+	}
+	udp := []byte{0x80, 0x00, 0x82, 0x9b, 0, 8, 0, 0}
+
+	fragNeeded := marshal(t, icmp.Message{
+		Type: ipv4.ICMPTypeDestinationUnreachable,
+		Code: 4,
+		Body: &icmp.DstUnreach{Data: quote(false, ProtoICMP, dst4, echo(ipv4.ICMPTypeEcho))},
+	})
+	fragNeeded[6], fragNeeded[7] = 0x05, 0x78
+
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		v6   bool
+		want Reply
+		desc string
+		err  error
+	}{
+		{
+			name: "echo reply",
+			b:    marshal(t, icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 42, Seq: 7, Data: make([]byte, 56)}}),
+			want: Reply{Type: ipv4.ICMPTypeEchoReply, Len: 64, ID: 42, Seq: 7},
+		},
+		{
+			name: "echo reply v6",
+			b:    marshal(t, icmp.Message{Type: ipv6.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 42, Seq: 7}}),
+			v6:   true,
+			want: Reply{Type: ipv6.ICMPTypeEchoReply, Len: 8, ID: 42, Seq: 7},
+		},
+		{
+			name: "echo request",
+			b:    marshal(t, icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 42, Seq: 7}}),
+			err:  ErrNotReply,
+		},
+		{
+			name: "time exceeded",
+			b: marshal(t, icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quote(false, ProtoICMP, dst4, echo(ipv4.ICMPTypeEcho))},
+			}),
+			want: Reply{Type: ipv4.ICMPTypeTimeExceeded, Len: 36, ID: 42, Seq: 7, Proto: ProtoICMP, Dst: dst4},
+			desc: "Time to live exceeded",
+		},
+		{
+			name: "port unreachable",
+			b: marshal(t, icmp.Message{
+				Type: ipv4.ICMPTypeDestinationUnreachable,
+				Code: 3,
+				Body: &icmp.DstUnreach{Data: quote(false, ProtoUDP, dst4, udp)},
+			}),
+			want: Reply{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 3, Len: 36, Proto: ProtoUDP, Dst: dst4, Port: 33435},
+			desc: "Destination Port Unreachable",
+		},
+		{
+			name: "fragmentation needed",
+			b:    fragNeeded,
+			want: Reply{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 4, Len: 36, MTU: 1400, ID: 42, Seq: 7, Proto: ProtoICMP, Dst: dst4},
+			desc: "Frag needed and DF set (mtu = 1400)",
+		},
+		{
+			name: "packet too big",
+			b: marshal(t, icmp.Message{
+				Type: ipv6.ICMPTypePacketTooBig,
+				Body: &icmp.PacketTooBig{MTU: 1280, Data: quote(true, ProtoICMPv6, dst6, echo(ipv6.ICMPTypeEchoRequest))},
+			}),
+			v6:   true,
+			want: Reply{Type: ipv6.ICMPTypePacketTooBig, Len: 56, MTU: 1280, ID: 42, Seq: 7, Proto: ProtoICMPv6, Dst: dst6},
+			desc: "Packet too big: mtu=1280",
+		},
+		{
+			name: "hop limit exceeded",
+			b: marshal(t, icmp.Message{
+				Type: ipv6.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quote(true, ProtoUDP, dst6, udp)},
+			}),
+			v6:   true,
+			want: Reply{Type: ipv6.ICMPTypeTimeExceeded, Len: 56, Proto: ProtoUDP, Dst: dst6, Port: 33435},
+			desc: "Time exceeded: Hop limit",
+		},
+		{
+			name: "short quote",
+			b: marshal(t, icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quote(false, ProtoUDP, dst4, udp[:4])},
+			}),
+			err: ErrNotReply,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseReply(tt.b, tt.v6)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseReply() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			tt.want.TTL = -1
+			if r.Type != tt.want.Type || r.Code != tt.want.Code || r.Len != tt.want.Len || r.MTU != tt.want.MTU ||
+				r.ID != tt.want.ID || r.Seq != tt.want.Seq || r.Proto != tt.want.Proto || r.Port != tt.want.Port ||
+				!r.Dst.Equal(tt.want.Dst) || r.TTL != tt.want.TTL {
+				t.Errorf("ParseReply() = %+v, want %+v", r, tt.want)
+			}
+			if r.EchoReply() != (tt.want.Proto == 0) {
+				t.Errorf("EchoReply() = %v, want %v", r.EchoReply(), tt.want.Proto == 0)
+			}
+			if tt.desc != "" && r.Description() != tt.desc {
+				t.Errorf("Description() = %q, want %q", r.Description(), tt.desc)
+			}
+		})
+	}
+}
+
+func TestParsePMTUDisc(t *testing.T) {
+	for s, want := range map[string]PMTUDisc{"do": PMTUDiscDo, "want": PMTUDiscWant, "dont": PMTUDiscDont, "probe": PMTUDiscProbe} {
+		if got, err := ParsePMTUDisc(s); err != nil || got != want {
+			t.Errorf("ParsePMTUDisc(%q) = %v, %v, want %v, nil", s, got, err, want)
+		}
+	}
+	if _, err := ParsePMTUDisc("maybe"); !errors.Is(err, ErrBadPMTUDisc) {
+		t.Errorf("ParsePMTUDisc(maybe) = %v, want %v", err, ErrBadPMTUDisc)
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := Stats{Sent: 3, Duplicates: 1}
+	for _, ms := range []time.Duration{1, 2, 3} {
+		s.AddRTT(ms * time.Millisecond)
+	}
+	s.Sent++
+	var b bytes.Buffer
+	s.Summary(&b, "example.com", 3003*time.Millisecond)
+	want := `
+--- example.com ping statistics ---
+4 packets transmitted, 3 received, +1 duplicates, 25% packet loss, time 3003ms
+rtt min/avg/max/mdev = 1.000/2.000/3.000/0.816 ms
+`
+	if b.String() != want {
+		t.Errorf("Summary() = %q, want %q", b.String(), want)
+	}
+
+	s = Stats{Sent: 3, Errors: 2}
+	b.Reset()
+	s.Summary(&b, "example.com", 0)
+	want = `
+--- example.com ping statistics ---
+3 packets transmitted, 0 received, +2 errors, 100% packet loss, time 0ms
+`
+	if b.String() != want {
+		t.Errorf("Summary() = %q, want %q", b.String(), want)
+	}
+
+	s = Stats{Sent: 3}
+	s.AddRTT(time.Millisecond)
+	b.Reset()
+	s.Summary(&b, "example.com", 0)
+	if !strings.Contains(b.String(), ", 66.6667% packet loss,") {
+		t.Errorf("Summary() = %q, want 66.6667%% packet loss", b.String())
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		o    Opts
+		dst  string
+	}{
+		{name: "ipv4", o: Opts{TTL: 17}, dst: "127.0.0.1"},
+		{name: "ipv6", o: Opts{IPv6: true, TTL: 17}, dst: "::1"},
+		{name: "ipv4 df", o: Opts{PMTUDisc: PMTUDiscDo, Interface: "lo"}, dst: "127.0.0.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Listen(&tt.o)
+			if errors.Is(err, os.ErrPermission) || errors.Is(err, errors.ErrUnsupported) {
+				t.Skipf("Listen() = %v", err)
+			}
+			if err != nil {
+				t.Fatalf("Listen() = %v", err)
+			}
+			defer c.Close()
+			dst := &net.IPAddr{IP: net.ParseIP(tt.dst)}
+			if err := c.WriteEcho(dst, 3, []byte("hello")); err != nil {
+				t.Skipf("WriteEcho() = %v", err)
+			}
+			c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			r, err := c.Read()
+			if err != nil {
+				t.Fatalf("Read() = %v", err)
+			}
+			if !r.EchoReply() || r.Seq != 3 || !r.From.Equal(dst.IP) || r.Len != 13 {
+				t.Errorf("Read() = %+v, want echo reply with seq 3 from %v", r, dst)
+			}
+			// The TTL is that of the reply, which the kernel picks.
+			if r.TTL <= 0 {
+				t.Errorf("Read() TTL = %d, want > 0", r.TTL)
+			}
+		})
+	}
+}
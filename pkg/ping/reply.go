@@ -0,0 +1,179 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ping
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ErrNotReply is returned by ParseReply for ICMP messages that are neither
+// echo replies nor errors.
+var ErrNotReply = errors.New("not an echo reply or ICMP error")
+
+// Reply is an echo reply, or an ICMP error about a packet we sent.
+type Reply struct {
+	// From is the address the reply came from.
+	From net.IP
+	// TTL is the TTL, or hop limit, of the reply, or -1 if unknown.
+	TTL int
+	// Received is the time the reply was read.
+	Received time.Time
+
+	Type icmp.Type
+	Code int
+	// Len is the length of the ICMP message.
+	Len int
+	// MTU is the next-hop MTU of "fragmentation needed" and "packet too
+	// big" errors.
+	MTU int
+
+	// ID and Seq are those of the echo reply, or of the echo request an
+	// error is about.
+	ID  int
+	Seq int
+
+	// Proto is the protocol of the packet an error is about, and Dst its
+	// destination. Proto is 0 for echo replies.
+	Proto int
+	Dst   net.IP
+	// Port is the destination port of the UDP datagram an error is about.
+	Port int
+}
+
+// ParseReply parses the echo reply or ICMP error of the ICMP message b.
+func ParseReply(b []byte, v6 bool) (*Reply, error) {
+	proto := ProtoICMP
+	if v6 {
+		proto = ProtoICMPv6
+	}
+	m, err := icmp.ParseMessage(proto, b)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reply{TTL: -1, Type: m.Type, Code: m.Code, Len: len(b)}
+	switch body := m.Body.(type) {
+	case *icmp.Echo:
+		if !r.EchoReply() {
+			return nil, ErrNotReply
+		}
+		r.ID, r.Seq = body.ID, body.Seq
+		return r, nil
+	case *icmp.DstUnreach:
+		if m.Type == ipv4.ICMPTypeDestinationUnreachable && m.Code == 4 {
+			// Fragmentation needed has the MTU in the second half of
+			// the unused word.
+			r.MTU = int(binary.BigEndian.Uint16(b[6:8]))
+		}
+		err = r.parseQuoted(body.Data, v6)
+	case *icmp.TimeExceeded:
+		err = r.parseQuoted(body.Data, v6)
+	case *icmp.PacketTooBig:
+		r.MTU = body.MTU
+		err = r.parseQuoted(body.Data, v6)
+	case *icmp.ParamProb:
+		err = r.parseQuoted(body.Data, v6)
+	default:
+		return nil, ErrNotReply
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseQuoted parses the start of the packet an ICMP error quotes, which
+// is its IP header and at least 8 bytes of its payload.
+func (r *Reply) parseQuoted(b []byte, v6 bool) error {
+	var payload []byte
+	if v6 {
+		if len(b) < ipv6.HeaderLen {
+			return fmt.Errorf("%w: quoted packet of %d bytes", ErrNotReply, len(b))
+		}
+		r.Proto, r.Dst, payload = int(b[6]), net.IP(b[24:40]), b[ipv6.HeaderLen:]
+	} else {
+		if len(b) < ipv4.HeaderLen {
+			return fmt.Errorf("%w: quoted packet of %d bytes", ErrNotReply, len(b))
+		}
+		hlen := int(b[0]&0x0f) << 2
+		if hlen < ipv4.HeaderLen || len(b) < hlen {
+			return fmt.Errorf("%w: quoted header of %d bytes", ErrNotReply, hlen)
+		}
+		r.Proto, r.Dst, payload = int(b[9]), net.IP(b[16:20]), b[hlen:]
+	}
+	r.Dst = append(net.IP(nil), r.Dst...)
+	if len(payload) < 8 {
+		return fmt.Errorf("%w: quoted payload of %d bytes", ErrNotReply, len(payload))
+	}
+	switch r.Proto {
+	case ProtoICMP, ProtoICMPv6:
+		r.ID = int(binary.BigEndian.Uint16(payload[4:6]))
+		r.Seq = int(binary.BigEndian.Uint16(payload[6:8]))
+	case ProtoUDP:
+		r.Port = int(binary.BigEndian.Uint16(payload[2:4]))
+	}
+	return nil
+}
+
+// EchoReply returns whether r is an echo reply rather than an error.
+func (r *Reply) EchoReply() bool {
+	return r.Type == ipv4.ICMPTypeEchoReply || r.Type == ipv6.ICMPTypeEchoReply
+}
+
+// Description describes an ICMP error the way iputils ping does.
+func (r *Reply) Description() string {
+	switch r.Type {
+	case ipv4.ICMPTypeDestinationUnreachable:
+		switch r.Code {
+		case 0:
+			return "Destination Net Unreachable"
+		case 1:
+			return "Destination Host Unreachable"
+		case 2:
+			return "Destination Protocol Unreachable"
+		case 3:
+			return "Destination Port Unreachable"
+		case 4:
+			return fmt.Sprintf("Frag needed and DF set (mtu = %d)", r.MTU)
+		case 5:
+			return "Source Route Failed"
+		case 9, 10, 13:
+			return "Packet filtered"
+		}
+	case ipv4.ICMPTypeTimeExceeded:
+		if r.Code == 0 {
+			return "Time to live exceeded"
+		}
+		return "Frag reassembly time exceeded"
+	case ipv4.ICMPTypeParameterProblem, ipv6.ICMPTypeParameterProblem:
+		return "Parameter problem"
+	case ipv6.ICMPTypeDestinationUnreachable:
+		switch r.Code {
+		case 0:
+			return "Destination unreachable: No route"
+		case 1:
+			return "Destination unreachable: Administratively prohibited"
+		case 3:
+			return "Destination unreachable: Address unreachable"
+		case 4:
+			return "Destination unreachable: Port unreachable"
+		}
+	case ipv6.ICMPTypePacketTooBig:
+		return fmt.Sprintf("Packet too big: mtu=%d", r.MTU)
+	case ipv6.ICMPTypeTimeExceeded:
+		if r.Code == 0 {
+			return "Time exceeded: Hop limit"
+		}
+		return "Time exceeded: Defragmentation failure"
+	}
+	return fmt.Sprintf("%v, code %d", r.Type, r.Code)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ping
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var pmtuDisc = map[PMTUDisc]int{
+	PMTUDiscDont:  unix.IP_PMTUDISC_DONT,
+	PMTUDiscWant:  unix.IP_PMTUDISC_WANT,
+	PMTUDiscDo:    unix.IP_PMTUDISC_DO,
+	PMTUDiscProbe: unix.IP_PMTUDISC_PROBE,
+}
+
+// control returns the net.ListenConfig.Control that sets the options of o.
+func control(o *Opts) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = setsockopts(int(fd), o)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
+
+func setsockopts(fd int, o *Opts) error {
+	if o.Interface != "" {
+		if err := unix.BindToDevice(fd, o.Interface); err != nil {
+			return os.NewSyscallError("setsockopt SO_BINDTODEVICE", err)
+		}
+	}
+	if o.PMTUDisc != PMTUDiscDefault {
+		level, opt := unix.IPPROTO_IP, unix.IP_MTU_DISCOVER
+		if o.IPv6 {
+			level, opt = unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER
+		}
+		// The IPV6_PMTUDISC values are those of IP_PMTUDISC.
+		if err := unix.SetsockoptInt(fd, level, opt, pmtuDisc[o.PMTUDisc]); err != nil {
+			return os.NewSyscallError("setsockopt MTU_DISCOVER", err)
+		}
+	}
+	return nil
+}
+
+// listenDatagram opens an unprivileged ICMP datagram socket, which Linux
+// allows the groups of net.ipv4.ping_group_range.
+func listenDatagram(o *Opts) (net.PacketConn, error) {
+	var sa unix.Sockaddr
+	family, proto := unix.AF_INET, unix.IPPROTO_ICMP
+	if o.IPv6 {
+		family, proto = unix.AF_INET6, unix.IPPROTO_ICMPV6
+		a := &unix.SockaddrInet6{}
+		copy(a.Addr[:], o.Source.To16())
+		sa = a
+	} else {
+		a := &unix.SockaddrInet4{}
+		copy(a.Addr[:], o.Source.To4())
+		sa = a
+	}
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	if err := setsockopts(fd, o); err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return net.FilePacketConn(f)
+}
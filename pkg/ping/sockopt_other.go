@@ -0,0 +1,28 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package ping
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// control returns the net.ListenConfig.Control that sets the options of o.
+func control(o *Opts) func(network, address string, c syscall.RawConn) error {
+	if o.Interface == "" && o.PMTUDisc == PMTUDiscDefault {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		return fmt.Errorf("interface and path MTU discovery options: %w", errors.ErrUnsupported)
+	}
+}
+
+func listenDatagram(o *Opts) (net.PacketConn, error) {
+	return nil, fmt.Errorf("ICMP datagram sockets: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ping
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Stats are the statistics of a run of ping.
+type Stats struct {
+	Sent       int
+	Received   int
+	Duplicates int
+	Errors     int
+
+	min, max  time.Duration
+	sum, sum2 float64
+}
+
+// AddRTT records the round-trip time of a received reply.
+func (s *Stats) AddRTT(rtt time.Duration) {
+	if s.Received == 0 || rtt < s.min {
+		s.min = rtt
+	}
+	if rtt > s.max {
+		s.max = rtt
+	}
+	s.Received++
+	f := float64(rtt)
+	s.sum += f
+	s.sum2 += f * f
+}
+
+// Loss returns the percentage of packets sent that were not received.
+func (s *Stats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+}
+
+// RTT returns the minimum, average, maximum and mean deviation of the
+// round-trip times.
+func (s *Stats) RTT() (minRTT, avg, maxRTT, mdev time.Duration) {
+	if s.Received == 0 {
+		return 0, 0, 0, 0
+	}
+	n := float64(s.Received)
+	mean := s.sum / n
+	return s.min, time.Duration(mean), s.max, time.Duration(math.Sqrt(max(s.sum2/n-mean*mean, 0)))
+}
+
+// Summary writes the statistics of pinging host for elapsed the way
+// iputils ping does, which scripts parse:
+//
+//	--- host ping statistics ---
+//	3 packets transmitted, 3 received, 0% packet loss, time 2003ms
+//	rtt min/avg/max/mdev = 0.031/0.043/0.052/0.008 ms
+func (s *Stats) Summary(w io.Writer, host string, elapsed time.Duration) {
+	fmt.Fprintf(w, "\n--- %s ping statistics ---\n", host)
+	fmt.Fprintf(w, "%d packets transmitted, %d received", s.Sent, s.Received)
+	if s.Duplicates > 0 {
+		fmt.Fprintf(w, ", +%d duplicates", s.Duplicates)
+	}
+	if s.Errors > 0 {
+		fmt.Fprintf(w, ", +%d errors", s.Errors)
+	}
+	fmt.Fprintf(w, ", %s%% packet loss, time %dms\n", strconv.FormatFloat(s.Loss(), 'g', 6, 64), elapsed.Milliseconds())
+	if s.Received > 0 {
+		minRTT, avg, maxRTT, mdev := s.RTT()
+		fmt.Fprintf(w, "rtt min/avg/max/mdev = %s/%s/%s/%s ms\n", Millis(minRTT), Millis(avg), Millis(maxRTT), Millis(mdev))
+	}
+}
+
+// Millis formats d in milliseconds with 3 decimals, as ping and
+// traceroute print times.
+func Millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
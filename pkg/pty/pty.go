@@ -102,6 +102,12 @@ func (p *Pty) Run() error {
 	return p.Wait()
 }
 
+// SetWinSize sets the window size of the pty, like when the terminal at
+// the other end is resized. It works after the Pts was closed.
+func (p *Pty) SetWinSize(w *termios.Winsize) error {
+	return termios.SetWinSize(p.Ptm.Fd(), w)
+}
+
 // Wait waits for a previously started command to finish, and restores the
 // tty mode when it is done.
 func (p *Pty) Wait() error {
@@ -0,0 +1,468 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is an SFTP client, like on the "sftp" subsystem of an SSH
+// session. Requests are sent one at a time.
+type Client struct {
+	r io.Reader
+	w io.Writer
+
+	mu sync.Mutex
+	id uint32
+	// extensions are those the server announced, by name.
+	extensions map[string]string
+}
+
+// NewClient starts a session with the server that reads w and writes r.
+func NewClient(r io.Reader, w io.Writer) (*Client, error) {
+	c := &Client{r: r, w: w, extensions: make(map[string]string)}
+	if err := writePacket(w, fxpInit, appendUint32(nil, Version)); err != nil {
+		return nil, err
+	}
+	typ, b, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{b: b}
+	if v := d.uint32(); typ != fxpVersion || d.err != nil || v != Version {
+		return nil, fmt.Errorf("%w: got packet type %d of version %d, want version %d", ErrBadPacket, typ, v, Version)
+	}
+	for len(d.b) > 0 && d.err == nil {
+		name, data := d.string(), d.string()
+		c.extensions[name] = data
+	}
+	return c, d.err
+}
+
+// Close closes the writer of the client if it is an io.Closer, which ends
+// the session.
+func (c *Client) Close() error {
+	if wc, ok := c.w.(io.Closer); ok {
+		return wc.Close()
+	}
+	return nil
+}
+
+// request sends a request and returns the reply.
+func (c *Client) request(typ byte, b []byte) (byte, *decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id++
+	if err := writePacket(c.w, typ, append(appendUint32(nil, c.id), b...)); err != nil {
+		return 0, nil, err
+	}
+	typ, b, err := readPacket(c.r)
+	if err != nil {
+		return 0, nil, err
+	}
+	d := &decoder{b: b}
+	if id := d.uint32(); d.err != nil || id != c.id {
+		return 0, nil, fmt.Errorf("%w: reply to request %d, want %d", ErrBadPacket, id, c.id)
+	}
+	return typ, d, nil
+}
+
+// reply returns an error for status replies with a code other than
+// StatusOK, and replies of types other than want.
+func reply(typ byte, d *decoder, want byte) error {
+	if typ == fxpStatus {
+		code, msg := d.uint32(), d.string()
+		if d.err != nil {
+			return d.err
+		}
+		if code == StatusOK && want == fxpStatus {
+			return nil
+		}
+		if code == StatusOK {
+			return fmt.Errorf("%w: got status OK, want packet type %d", ErrBadPacket, want)
+		}
+		return &StatusError{Code: code, Msg: msg}
+	}
+	if typ != want {
+		return fmt.Errorf("%w: got packet type %d, want %d", ErrBadPacket, typ, want)
+	}
+	return nil
+}
+
+func (c *Client) status(typ byte, b []byte) error {
+	rtyp, d, err := c.request(typ, b)
+	if err != nil {
+		return err
+	}
+	return reply(rtyp, d, fxpStatus)
+}
+
+func (c *Client) handle(typ byte, b []byte) (string, error) {
+	rtyp, d, err := c.request(typ, b)
+	if err != nil {
+		return "", err
+	}
+	if err := reply(rtyp, d, fxpHandle); err != nil {
+		return "", err
+	}
+	h := d.string()
+	return h, d.err
+}
+
+func (c *Client) attrs(typ byte, b []byte) (*Attrs, error) {
+	rtyp, d, err := c.request(typ, b)
+	if err != nil {
+		return nil, err
+	}
+	if err := reply(rtyp, d, fxpAttrs); err != nil {
+		return nil, err
+	}
+	a := d.attrs()
+	return a, d.err
+}
+
+func (c *Client) names(typ byte, b []byte) ([]string, []*Attrs, error) {
+	rtyp, d, err := c.request(typ, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := reply(rtyp, d, fxpName); err != nil {
+		return nil, nil, err
+	}
+	n := d.uint32()
+	var names []string
+	var attrs []*Attrs
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		names = append(names, d.string())
+		d.string() // The long name.
+		attrs = append(attrs, d.attrs())
+	}
+	return names, attrs, d.err
+}
+
+// fileInfo is the os.FileInfo of a remote file.
+type fileInfo struct {
+	name  string
+	attrs *Attrs
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.attrs.Size) }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.attrs.FileMode() }
+func (fi *fileInfo) ModTime() time.Time { return fi.attrs.ModTime() }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+
+// Sys returns the *Attrs of the file.
+func (fi *fileInfo) Sys() any { return fi.attrs }
+
+// Stat returns information about the file at p, following symlinks.
+func (c *Client) Stat(p string) (os.FileInfo, error) {
+	a, err := c.attrs(fxpStat, appendString(nil, p))
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: err}
+	}
+	return &fileInfo{name: path.Base(p), attrs: a}, nil
+}
+
+// Lstat returns information about the file at p, not following symlinks.
+func (c *Client) Lstat(p string) (os.FileInfo, error) {
+	a, err := c.attrs(fxpLstat, appendString(nil, p))
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: p, Err: err}
+	}
+	return &fileInfo{name: path.Base(p), attrs: a}, nil
+}
+
+// ErrBadName is returned by ReadDir for entries whose name is not a single
+// path element, like "../../.bashrc", which a malicious server could send
+// to make clients write outside the directory.
+var ErrBadName = errors.New("bad file name")
+
+// ReadDir returns the entries of the directory at p, without "." and "..".
+func (c *Client) ReadDir(p string) ([]os.FileInfo, error) {
+	h, err := c.handle(fxpOpendir, appendString(nil, p))
+	if err != nil {
+		return nil, &os.PathError{Op: "opendir", Path: p, Err: err}
+	}
+	defer c.status(fxpClose, appendString(nil, h))
+
+	var entries []os.FileInfo
+	for {
+		names, attrs, err := c.names(fxpReaddir, appendString(nil, h))
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: p, Err: err}
+		}
+		for i, n := range names {
+			switch {
+			case n == "." || n == "..":
+			case n == "" || strings.Contains(n, "/"):
+				return nil, &os.PathError{Op: "readdir", Path: p, Err: fmt.Errorf("%w: %q", ErrBadName, n)}
+			default:
+				entries = append(entries, &fileInfo{name: n, attrs: attrs[i]})
+			}
+		}
+	}
+}
+
+// Setstat sets the attributes of the file at p that a.Flags has.
+func (c *Client) Setstat(p string, a *Attrs) error {
+	if err := c.status(fxpSetstat, appendAttrs(appendString(nil, p), a)); err != nil {
+		return &os.PathError{Op: "setstat", Path: p, Err: err}
+	}
+	return nil
+}
+
+// Chmod sets the permissions of the file at p.
+func (c *Client) Chmod(p string, mode os.FileMode) error {
+	return c.Setstat(p, &Attrs{Flags: AttrPermissions, Mode: unixMode(mode) &^ modeType})
+}
+
+// Chtimes sets the access and modification times of the file at p.
+func (c *Client) Chtimes(p string, atime, mtime time.Time) error {
+	return c.Setstat(p, &Attrs{Flags: AttrACModTime, Atime: uint32(atime.Unix()), Mtime: uint32(mtime.Unix())})
+}
+
+// Mkdir creates the directory p.
+func (c *Client) Mkdir(p string, perm os.FileMode) error {
+	a := &Attrs{Flags: AttrPermissions, Mode: uint32(perm.Perm())}
+	if err := c.status(fxpMkdir, appendAttrs(appendString(nil, p), a)); err != nil {
+		return &os.PathError{Op: "mkdir", Path: p, Err: err}
+	}
+	return nil
+}
+
+// Remove removes the file at p.
+func (c *Client) Remove(p string) error {
+	if err := c.status(fxpRemove, appendString(nil, p)); err != nil {
+		return &os.PathError{Op: "remove", Path: p, Err: err}
+	}
+	return nil
+}
+
+// RemoveDir removes the empty directory p.
+func (c *Client) RemoveDir(p string) error {
+	if err := c.status(fxpRmdir, appendString(nil, p)); err != nil {
+		return &os.PathError{Op: "rmdir", Path: p, Err: err}
+	}
+	return nil
+}
+
+// Rename renames from to to. Servers that support OpenSSH's posix-rename
+// extension replace to like rename(2), others fail if it exists.
+func (c *Client) Rename(from, to string) error {
+	var err error
+	if _, ok := c.extensions[posixRename]; ok {
+		err = c.status(fxpExtended, appendString(appendString(appendString(nil, posixRename), from), to))
+	} else {
+		err = c.status(fxpRename, appendString(appendString(nil, from), to))
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: err}
+	}
+	return nil
+}
+
+// RealPath returns the absolute, canonical form of p, which is "." for
+// the directory of the session.
+func (c *Client) RealPath(p string) (string, error) {
+	names, _, err := c.names(fxpRealpath, appendString(nil, p))
+	if err == nil && len(names) != 1 {
+		err = fmt.Errorf("%w: %d names, want 1", ErrBadPacket, len(names))
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "realpath", Path: p, Err: err}
+	}
+	return names[0], nil
+}
+
+// ReadLink returns the target of the symlink p.
+func (c *Client) ReadLink(p string) (string, error) {
+	names, _, err := c.names(fxpReadlink, appendString(nil, p))
+	if err == nil && len(names) != 1 {
+		err = fmt.Errorf("%w: %d names, want 1", ErrBadPacket, len(names))
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: p, Err: err}
+	}
+	return names[0], nil
+}
+
+// Symlink creates link as a symlink to target.
+func (c *Client) Symlink(target, link string) error {
+	// OpenSSH's order, which servers expect.
+	if err := c.status(fxpSymlink, appendString(appendString(nil, target), link)); err != nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: link, Err: err}
+	}
+	return nil
+}
+
+// Open opens the file at p for reading.
+func (c *Client) Open(p string) (*File, error) {
+	return c.OpenFile(p, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the file at p, and opens it for writing.
+func (c *Client) Create(p string) (*File, error) {
+	return c.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens the file at p with the os.O_* flags, and the permissions
+// perm if it is created.
+func (c *Client) OpenFile(p string, flag int, perm os.FileMode) (*File, error) {
+	var flags uint32
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		flags = FlagRead
+	case os.O_WRONLY:
+		flags = FlagWrite
+	case os.O_RDWR:
+		flags = FlagRead | FlagWrite
+	}
+	for _, f := range []struct {
+		os   int
+		sftp uint32
+	}{
+		{os.O_APPEND, FlagAppend},
+		{os.O_CREATE, FlagCreate},
+		{os.O_TRUNC, FlagTrunc},
+		{os.O_EXCL, FlagExcl},
+	} {
+		if flag&f.os != 0 {
+			flags |= f.sftp
+		}
+	}
+	b := appendUint32(appendString(nil, p), flags)
+	b = appendAttrs(b, &Attrs{Flags: AttrPermissions, Mode: uint32(perm.Perm())})
+	h, err := c.handle(fxpOpen, b)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	return &File{c: c, name: p, handle: h}, nil
+}
+
+// File is an open remote file.
+type File struct {
+	c      *Client
+	name   string
+	handle string
+	off    int64
+}
+
+// Name returns the path the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	if err := f.c.status(fxpClose, appendString(nil, f.handle)); err != nil {
+		return &os.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Stat returns information about the file.
+func (f *File) Stat() (os.FileInfo, error) {
+	a, err := f.c.attrs(fxpFstat, appendString(nil, f.handle))
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return &fileInfo{name: path.Base(f.name), attrs: a}, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	var n int
+	for n < len(b) {
+		k, err := f.read(b[n:], off+int64(n))
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// read reads once, as much as the server returns.
+func (f *File) read(b []byte, off int64) (int, error) {
+	req := appendUint64(appendString(nil, f.handle), uint64(off))
+	typ, d, err := f.c.request(fxpRead, appendUint32(req, uint32(min(len(b), maxData))))
+	if err != nil {
+		return 0, err
+	}
+	if err := reply(typ, d, fxpData); errors.Is(err, io.EOF) {
+		return 0, io.EOF
+	} else if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	data := d.string()
+	if d.err != nil {
+		return 0, d.err
+	}
+	return copy(b, data), nil
+}
+
+// Read implements io.Reader.
+func (f *File) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := f.read(b, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	var n int
+	for n < len(b) {
+		k := min(len(b)-n, maxData)
+		req := appendUint64(appendString(nil, f.handle), uint64(off+int64(n)))
+		if err := f.c.status(fxpWrite, appendString(req, string(b[n:n+k]))); err != nil {
+			return n, &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+		n += k
+	}
+	return n, nil
+}
+
+// Write implements io.Writer.
+func (f *File) Write(b []byte) (int, error) {
+	n, err := f.WriteAt(b, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return f.off, err
+		}
+		offset += fi.Size()
+	default:
+		return f.off, fmt.Errorf("seek %s: invalid whence %d", f.name, whence)
+	}
+	if offset < 0 {
+		return f.off, fmt.Errorf("seek %s: negative offset %d", f.name, offset)
+	}
+	f.off = offset
+	return f.off, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newClient(t *testing.T, dir string) *Client {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Server{Dir: dir}).Serve(server)
+		server.Close()
+	}()
+	c, err := NewClient(client, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve = %v", err)
+		}
+	})
+	return c
+}
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	c := newClient(t, dir)
+
+	// More than fits in one packet.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 5000)
+	f, err := c.Create("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write(data); n != len(data) || err != nil {
+		t.Errorf("Write = %d, %v, want %d, nil", n, err, len(data))
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "f")); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("written file has %d bytes, %v, want %d", len(b), err, len(data))
+	}
+
+	f, err = c.Open("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(f); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("ReadAll = %d bytes, %v, want %d", len(b), err, len(data))
+	}
+	if _, err := f.Seek(-6, io.SeekEnd); err != nil {
+		t.Errorf("Seek = %v", err)
+	}
+	if b, err := io.ReadAll(f); err != nil || string(b) != "abcdef" {
+		t.Errorf("ReadAll after Seek = %q, %v, want abcdef", b, err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != int64(len(data)) || fi.Name() != "f" {
+		t.Errorf("Stat = %v, %v, want f of %d bytes", fi, err, len(data))
+	}
+	f.Close()
+
+	if err := c.Chmod("f", 0o600); err != nil {
+		t.Errorf("Chmod = %v", err)
+	}
+	mtime := time.Unix(1e9, 0)
+	if err := c.Chtimes("f", mtime, mtime); err != nil {
+		t.Errorf("Chtimes = %v", err)
+	}
+	if fi, err := c.Stat("f"); err != nil || fi.Mode() != 0o600 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("Stat = %v, %v, want mode 0600 and time %v", fi, err, mtime)
+	}
+
+	if err := c.Mkdir("d", 0o755); err != nil {
+		t.Errorf("Mkdir = %v", err)
+	}
+	if err := c.Symlink("../f", "d/l"); err != nil {
+		t.Errorf("Symlink = %v", err)
+	}
+	if target, err := c.ReadLink("d/l"); err != nil || target != "../f" {
+		t.Errorf("ReadLink = %q, %v, want ../f", target, err)
+	}
+	if fi, err := c.Lstat("d/l"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat = %v, %v, want a symlink", fi, err)
+	}
+	if p, err := c.RealPath("."); err != nil || p != dir {
+		t.Errorf("RealPath = %q, %v, want %q", p, err, dir)
+	}
+
+	entries, err := c.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs := map[string]bool{}
+	for _, e := range entries {
+		dirs[e.Name()] = e.IsDir()
+	}
+	if len(dirs) != 2 || !dirs["d"] || dirs["f"] {
+		t.Errorf("ReadDir = %v, want directory d and file f", dirs)
+	}
+
+	if err := c.Rename("f", "d/l"); err != nil {
+		t.Errorf("Rename onto existing file = %v", err)
+	}
+	if _, err := c.Stat("f"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of renamed file = %v, want %v", err, os.ErrNotExist)
+	}
+	if _, err := c.Open("nosuch"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open of missing file = %v, want %v", err, os.ErrNotExist)
+	}
+	if err := c.RemoveDir("d"); err == nil {
+		t.Errorf("RemoveDir of non-empty directory succeeded")
+	}
+	if err := c.Remove("d/l"); err != nil {
+		t.Errorf("Remove = %v", err)
+	}
+	if err := c.RemoveDir("d"); err != nil {
+		t.Errorf("RemoveDir = %v", err)
+	}
+}
+
+// TestReadDirBadName checks that names of entries a malicious server
+// sends cannot be paths.
+func TestReadDirBadName(t *testing.T) {
+	for _, name := range []string{"../../.bashrc", "a/../../x", "/etc/passwd", ""} {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			readdir := 0
+			for {
+				typ, b, err := readPacket(server)
+				if err != nil {
+					return
+				}
+				if typ == fxpInit {
+					writePacket(server, fxpVersion, appendUint32(nil, Version))
+					continue
+				}
+				id := b[:4]
+				switch typ {
+				case fxpOpendir:
+					writePacket(server, fxpHandle, appendString(id, "h"))
+				case fxpReaddir:
+					if readdir++; readdir > 1 {
+						writePacket(server, fxpStatus, appendString(appendString(appendUint32(id, StatusEOF), "EOF"), ""))
+						continue
+					}
+					b := appendUint32(id, 2)
+					for _, n := range []string{"ok", name} {
+						b = appendAttrs(appendString(appendString(b, n), n), &Attrs{})
+					}
+					writePacket(server, fxpName, b)
+				default:
+					writePacket(server, fxpStatus, appendString(appendString(appendUint32(id, StatusOK), ""), ""))
+				}
+			}
+		}()
+		c, err := NewClient(client, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ReadDir("."); !errors.Is(err, ErrBadName) {
+			t.Errorf("ReadDir with entry %q = %v, want %v", name, err, ErrBadName)
+		}
+		c.Close()
+	}
+}
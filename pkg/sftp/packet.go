@@ -0,0 +1,350 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sftp implements version 3 of the SSH file transfer protocol, as
+// OpenSSH speaks it.
+//
+// See https://datatracker.ietf.org/doc/html/draft-ietf-secsh-filexfer-02.
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Version is the protocol version spoken.
+const Version = 3
+
+// Packet types.
+const (
+	fxpInit          = 1
+	fxpVersion       = 2
+	fxpOpen          = 3
+	fxpClose         = 4
+	fxpRead          = 5
+	fxpWrite         = 6
+	fxpLstat         = 7
+	fxpFstat         = 8
+	fxpSetstat       = 9
+	fxpFsetstat      = 10
+	fxpOpendir       = 11
+	fxpReaddir       = 12
+	fxpRemove        = 13
+	fxpMkdir         = 14
+	fxpRmdir         = 15
+	fxpRealpath      = 16
+	fxpStat          = 17
+	fxpRename        = 18
+	fxpReadlink      = 19
+	fxpSymlink       = 20
+	fxpStatus        = 101
+	fxpHandle        = 102
+	fxpData          = 103
+	fxpName          = 104
+	fxpAttrs         = 105
+	fxpExtended      = 200
+	fxpExtendedReply = 201
+)
+
+// Flags of an open request.
+const (
+	FlagRead   = 0x1
+	FlagWrite  = 0x2
+	FlagAppend = 0x4
+	FlagCreate = 0x8
+	FlagTrunc  = 0x10
+	FlagExcl   = 0x20
+)
+
+// Status codes.
+const (
+	StatusOK               = 0
+	StatusEOF              = 1
+	StatusNoSuchFile       = 2
+	StatusPermissionDenied = 3
+	StatusFailure          = 4
+	StatusBadMessage       = 5
+	StatusOpUnsupported    = 8
+)
+
+// posixRename is OpenSSH's extension for renames that replace the target.
+const posixRename = "posix-rename@openssh.com"
+
+// maxPacket is the largest packet accepted, as OpenSSH's.
+const maxPacket = 256 * 1024
+
+// maxData is the most data read at once.
+const maxData = 32 * 1024
+
+// ErrBadPacket is returned for malformed packets.
+var ErrBadPacket = errors.New("malformed sftp packet")
+
+// StatusError is a status other than StatusOK.
+type StatusError struct {
+	Code uint32
+	Msg  string
+}
+
+// Error implements error.
+func (s *StatusError) Error() string {
+	return fmt.Sprintf("sftp status %d: %s", s.Code, s.Msg)
+}
+
+// Is makes errors.Is(err, os.ErrNotExist) and similar work for statuses.
+func (s *StatusError) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist:
+		return s.Code == StatusNoSuchFile
+	case os.ErrPermission:
+		return s.Code == StatusPermissionDenied
+	case io.EOF:
+		return s.Code == StatusEOF
+	}
+	return false
+}
+
+// Attribute flags.
+const (
+	AttrSize        = 0x1
+	AttrUIDGID      = 0x2
+	AttrPermissions = 0x4
+	AttrACModTime   = 0x8
+	attrExtended    = 0x80000000
+)
+
+// File type bits of Attrs.Mode.
+const (
+	modeType    = 0o170000
+	modeSocket  = 0o140000
+	modeSymlink = 0o120000
+	modeRegular = 0o100000
+	modeBlock   = 0o060000
+	modeDir     = 0o040000
+	modeChar    = 0o020000
+	modeFIFO    = 0o010000
+)
+
+// Attrs are the attributes of a file. Flags says which fields are set.
+type Attrs struct {
+	Flags uint32
+	Size  uint64
+	UID   uint32
+	GID   uint32
+	// Mode is the Unix mode, with file type and permission bits.
+	Mode  uint32
+	Atime uint32
+	Mtime uint32
+}
+
+// FileMode returns the mode of a as an os.FileMode.
+func (a *Attrs) FileMode() os.FileMode {
+	m := os.FileMode(a.Mode & 0o777)
+	switch a.Mode & modeType {
+	case modeDir:
+		m |= os.ModeDir
+	case modeSymlink:
+		m |= os.ModeSymlink
+	case modeSocket:
+		m |= os.ModeSocket
+	case modeFIFO:
+		m |= os.ModeNamedPipe
+	case modeChar:
+		m |= os.ModeDevice | os.ModeCharDevice
+	case modeBlock:
+		m |= os.ModeDevice
+	}
+	if a.Mode&0o4000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if a.Mode&0o2000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if a.Mode&0o1000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// unixMode returns m as Unix mode bits.
+func unixMode(m os.FileMode) uint32 {
+	u := uint32(m.Perm())
+	switch {
+	case m.IsDir():
+		u |= modeDir
+	case m&os.ModeSymlink != 0:
+		u |= modeSymlink
+	case m&os.ModeSocket != 0:
+		u |= modeSocket
+	case m&os.ModeNamedPipe != 0:
+		u |= modeFIFO
+	case m&os.ModeCharDevice != 0:
+		u |= modeChar
+	case m&os.ModeDevice != 0:
+		u |= modeBlock
+	default:
+		u |= modeRegular
+	}
+	if m&os.ModeSetuid != 0 {
+		u |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		u |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		u |= 0o1000
+	}
+	return u
+}
+
+// ModTime returns the modification time of a.
+func (a *Attrs) ModTime() time.Time {
+	return time.Unix(int64(a.Mtime), 0)
+}
+
+// fileAttrs returns the attributes of fi.
+func fileAttrs(fi os.FileInfo) *Attrs {
+	a := &Attrs{
+		Flags: AttrSize | AttrPermissions | AttrACModTime,
+		Size:  uint64(fi.Size()),
+		Mode:  unixMode(fi.Mode()),
+		Mtime: uint32(fi.ModTime().Unix()),
+		Atime: uint32(fi.ModTime().Unix()),
+	}
+	if uid, gid, ok := owner(fi); ok {
+		a.Flags |= AttrUIDGID
+		a.UID, a.GID = uid, gid
+	}
+	return a
+}
+
+// longName returns a line about a file like ls -l prints it, as clients
+// show it in directory listings.
+func longName(name string, a *Attrs) string {
+	const types = "?pc?d?b?-?l?s???"
+	perm := []byte(types[a.Mode>>12&0xf:][:1] + "rwxrwxrwx")
+	for i := 0; i < 9; i++ {
+		if a.Mode&(1<<(8-i)) == 0 {
+			perm[i+1] = '-'
+		}
+	}
+	mtime := a.ModTime()
+	layout := "Jan _2 15:04"
+	if time.Since(mtime) > 180*24*time.Hour {
+		layout = "Jan _2  2006"
+	}
+	return fmt.Sprintf("%s %4d %-8d %-8d %8d %s %s", perm, 1, a.UID, a.GID, a.Size, mtime.Format(layout), name)
+}
+
+// decoder reads the fields of a packet.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if len(d.b) < 4 {
+		d.err = ErrBadPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	return uint64(d.uint32())<<32 | uint64(d.uint32())
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	if uint64(n) > uint64(len(d.b)) {
+		d.err = ErrBadPacket
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func (d *decoder) attrs() *Attrs {
+	a := &Attrs{Flags: d.uint32()}
+	if a.Flags&AttrSize != 0 {
+		a.Size = d.uint64()
+	}
+	if a.Flags&AttrUIDGID != 0 {
+		a.UID, a.GID = d.uint32(), d.uint32()
+	}
+	if a.Flags&AttrPermissions != 0 {
+		a.Mode = d.uint32()
+	}
+	if a.Flags&AttrACModTime != 0 {
+		a.Atime, a.Mtime = d.uint32(), d.uint32()
+	}
+	if a.Flags&attrExtended != 0 {
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			d.string()
+			d.string()
+		}
+	}
+	return a
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func appendAttrs(b []byte, a *Attrs) []byte {
+	flags := a.Flags &^ attrExtended
+	b = appendUint32(b, flags)
+	if flags&AttrSize != 0 {
+		b = appendUint64(b, a.Size)
+	}
+	if flags&AttrUIDGID != 0 {
+		b = appendUint32(appendUint32(b, a.UID), a.GID)
+	}
+	if flags&AttrPermissions != 0 {
+		b = appendUint32(b, a.Mode)
+	}
+	if flags&AttrACModTime != 0 {
+		b = appendUint32(appendUint32(b, a.Atime), a.Mtime)
+	}
+	return b
+}
+
+// readPacket reads a packet and returns its type and payload.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	if n == 0 || n > maxPacket {
+		return 0, nil, fmt.Errorf("%w: length %d", ErrBadPacket, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return b[0], b[1:], nil
+}
+
+// writePacket writes a packet of type typ with the payload b.
+func writePacket(w io.Writer, typ byte, b []byte) error {
+	p := appendUint32(make([]byte, 0, 5+len(b)), uint32(1+len(b)))
+	p = append(append(p, typ), b...)
+	_, err := w.Write(p)
+	return err
+}
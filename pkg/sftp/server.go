@@ -0,0 +1,445 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Server serves the local file system over SFTP, like an SSH server's
+// "sftp" subsystem.
+type Server struct {
+	// Dir is the directory relative paths are relative to, like the
+	// user's home directory. It is the working directory by default.
+	Dir string
+}
+
+// handle is an open file or directory.
+type handle struct {
+	f      *os.File
+	append bool
+	// entries holds the rest of a directory listing.
+	entries []os.DirEntry
+	dirRead bool
+}
+
+// conn is the state of one client.
+type conn struct {
+	dir     string
+	rw      io.ReadWriter
+	handles map[string]*handle
+	next    uint64
+}
+
+// Serve serves requests from rw until it is closed. Requests are handled
+// one after the other.
+func (s *Server) Serve(rw io.ReadWriter) error {
+	dir := s.Dir
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	c := &conn{dir: dir, rw: rw, handles: make(map[string]*handle)}
+	defer func() {
+		for _, h := range c.handles {
+			h.f.Close()
+		}
+	}()
+
+	typ, b, err := readPacket(rw)
+	if err != nil {
+		return err
+	}
+	if typ != fxpInit {
+		return fmt.Errorf("%w: got packet type %d, want init", ErrBadPacket, typ)
+	}
+	// Clients speaking newer versions fall back to ours.
+	reply := appendUint32(nil, Version)
+	reply = appendString(appendString(reply, posixRename), "1")
+	if err := writePacket(rw, fxpVersion, reply); err != nil {
+		return err
+	}
+
+	for {
+		typ, b, err = readPacket(rw)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.handle(typ, b); err != nil {
+			return err
+		}
+	}
+}
+
+// path returns the local path of p.
+func (c *conn) path(p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(c.dir, p)
+}
+
+func (c *conn) status(id uint32, err error) error {
+	code, msg := uint32(StatusOK), "Success"
+	var se *StatusError
+	switch {
+	case err == nil:
+	case errors.As(err, &se):
+		code, msg = se.Code, se.Msg
+	case errors.Is(err, io.EOF):
+		code, msg = StatusEOF, "End of file"
+	case errors.Is(err, fs.ErrNotExist):
+		code, msg = StatusNoSuchFile, err.Error()
+	case errors.Is(err, fs.ErrPermission):
+		code, msg = StatusPermissionDenied, err.Error()
+	default:
+		code, msg = StatusFailure, err.Error()
+	}
+	b := appendUint32(appendUint32(nil, id), code)
+	b = appendString(appendString(b, msg), "")
+	return writePacket(c.rw, fxpStatus, b)
+}
+
+func (c *conn) name(id uint32, names []string, attrs []*Attrs) error {
+	b := appendUint32(appendUint32(nil, id), uint32(len(names)))
+	for i, n := range names {
+		b = appendString(b, n)
+		b = appendString(b, longName(n, attrs[i]))
+		b = appendAttrs(b, attrs[i])
+	}
+	return writePacket(c.rw, fxpName, b)
+}
+
+func (c *conn) attrs(id uint32, fi os.FileInfo, err error) error {
+	if err != nil {
+		return c.status(id, err)
+	}
+	return writePacket(c.rw, fxpAttrs, appendAttrs(appendUint32(nil, id), fileAttrs(fi)))
+}
+
+func (c *conn) newHandle(id uint32, h *handle) error {
+	c.next++
+	name := strconv.FormatUint(c.next, 10)
+	c.handles[name] = h
+	return writePacket(c.rw, fxpHandle, appendString(appendUint32(nil, id), name))
+}
+
+func (c *conn) getHandle(name string) (*handle, error) {
+	h, ok := c.handles[name]
+	if !ok {
+		return nil, &StatusError{Code: StatusFailure, Msg: "invalid handle"}
+	}
+	return h, nil
+}
+
+// handle replies to one request. Only failures to reply are returned.
+func (c *conn) handle(typ byte, b []byte) error {
+	d := &decoder{b: b}
+	id := d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+	bad := func() error {
+		return c.status(id, &StatusError{Code: StatusBadMessage, Msg: "malformed request"})
+	}
+
+	switch typ {
+	case fxpOpen:
+		p, flags, a := d.string(), d.uint32(), d.attrs()
+		if d.err != nil {
+			return bad()
+		}
+		mode := os.FileMode(0o644)
+		if a.Flags&AttrPermissions != 0 {
+			mode = os.FileMode(a.Mode & 0o777)
+		}
+		f, err := os.OpenFile(c.path(p), openFlags(flags), mode)
+		if err != nil {
+			return c.status(id, err)
+		}
+		return c.newHandle(id, &handle{f: f, append: flags&FlagAppend != 0})
+
+	case fxpOpendir:
+		p := d.string()
+		if d.err != nil {
+			return bad()
+		}
+		f, err := os.Open(c.path(p))
+		if err != nil {
+			return c.status(id, err)
+		}
+		if fi, err := f.Stat(); err != nil || !fi.IsDir() {
+			f.Close()
+			return c.status(id, &StatusError{Code: StatusFailure, Msg: p + " is not a directory"})
+		}
+		return c.newHandle(id, &handle{f: f})
+
+	case fxpClose:
+		name := d.string()
+		h, err := c.getHandle(name)
+		if err != nil {
+			return c.status(id, err)
+		}
+		delete(c.handles, name)
+		return c.status(id, h.f.Close())
+
+	case fxpRead:
+		name, off, n := d.string(), d.uint64(), d.uint32()
+		if d.err != nil {
+			return bad()
+		}
+		h, err := c.getHandle(name)
+		if err != nil {
+			return c.status(id, err)
+		}
+		buf := make([]byte, min(n, maxData))
+		k, err := h.f.ReadAt(buf, int64(off))
+		if k == 0 && err != nil {
+			return c.status(id, err)
+		}
+		return writePacket(c.rw, fxpData, appendString(appendUint32(nil, id), string(buf[:k])))
+
+	case fxpWrite:
+		name, off, data := d.string(), d.uint64(), d.string()
+		if d.err != nil {
+			return bad()
+		}
+		h, err := c.getHandle(name)
+		if err != nil {
+			return c.status(id, err)
+		}
+		// Files opened for appending can only be written at their
+		// end.
+		if h.append {
+			_, err = h.f.Write([]byte(data))
+		} else {
+			_, err = h.f.WriteAt([]byte(data), int64(off))
+		}
+		return c.status(id, err)
+
+	case fxpReaddir:
+		name := d.string()
+		h, err := c.getHandle(name)
+		if err != nil {
+			return c.status(id, err)
+		}
+		if !h.dirRead {
+			h.dirRead = true
+			if h.entries, err = h.f.ReadDir(-1); err != nil {
+				return c.status(id, err)
+			}
+		}
+		if len(h.entries) == 0 {
+			return c.status(id, io.EOF)
+		}
+		n := min(len(h.entries), 100)
+		var names []string
+		var attrs []*Attrs
+		for _, e := range h.entries[:n] {
+			fi, err := e.Info()
+			if err != nil {
+				// Gone since listing the directory.
+				continue
+			}
+			names = append(names, e.Name())
+			attrs = append(attrs, fileAttrs(fi))
+		}
+		h.entries = h.entries[n:]
+		return c.name(id, names, attrs)
+
+	case fxpStat, fxpLstat:
+		p := d.string()
+		if d.err != nil {
+			return bad()
+		}
+		stat := os.Lstat
+		if typ == fxpStat {
+			stat = os.Stat
+		}
+		fi, err := stat(c.path(p))
+		return c.attrs(id, fi, err)
+
+	case fxpFstat:
+		h, err := c.getHandle(d.string())
+		if err != nil {
+			return c.status(id, err)
+		}
+		fi, err := h.f.Stat()
+		return c.attrs(id, fi, err)
+
+	case fxpSetstat:
+		p, a := d.string(), d.attrs()
+		if d.err != nil {
+			return bad()
+		}
+		return c.status(id, setstat(c.path(p), nil, a))
+
+	case fxpFsetstat:
+		name, a := d.string(), d.attrs()
+		if d.err != nil {
+			return bad()
+		}
+		h, err := c.getHandle(name)
+		if err != nil {
+			return c.status(id, err)
+		}
+		return c.status(id, setstat(h.f.Name(), h.f, a))
+
+	case fxpRemove:
+		p := d.string()
+		if d.err != nil {
+			return bad()
+		}
+		p = c.path(p)
+		if fi, err := os.Lstat(p); err == nil && fi.IsDir() {
+			return c.status(id, &StatusError{Code: StatusFailure, Msg: p + " is a directory"})
+		}
+		return c.status(id, os.Remove(p))
+
+	case fxpMkdir:
+		p, a := d.string(), d.attrs()
+		if d.err != nil {
+			return bad()
+		}
+		mode := os.FileMode(0o755)
+		if a.Flags&AttrPermissions != 0 {
+			mode = os.FileMode(a.Mode & 0o777)
+		}
+		return c.status(id, os.Mkdir(c.path(p), mode))
+
+	case fxpRmdir:
+		p := d.string()
+		if d.err != nil {
+			return bad()
+		}
+		p = c.path(p)
+		if fi, err := os.Lstat(p); err == nil && !fi.IsDir() {
+			return c.status(id, &StatusError{Code: StatusFailure, Msg: p + " is not a directory"})
+		}
+		return c.status(id, os.Remove(p))
+
+	case fxpRealpath:
+		p := d.string()
+		if d.err != nil {
+			return bad()
+		}
+		p = c.path(p)
+		// Like OpenSSH, resolve symlinks of existing paths.
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			p = r
+		}
+		return c.name(id, []string{filepath.ToSlash(p)}, []*Attrs{{}})
+
+	case fxpRename:
+		from, to := d.string(), d.string()
+		if d.err != nil {
+			return bad()
+		}
+		// Unlike rename(2), SFTP renames do not replace files.
+		if _, err := os.Lstat(c.path(to)); err == nil {
+			return c.status(id, &StatusError{Code: StatusFailure, Msg: to + " exists"})
+		}
+		return c.status(id, os.Rename(c.path(from), c.path(to)))
+
+	case fxpReadlink:
+		p := d.string()
+		if d.err != nil {
+			return bad()
+		}
+		target, err := os.Readlink(c.path(p))
+		if err != nil {
+			return c.status(id, err)
+		}
+		return c.name(id, []string{target}, []*Attrs{{}})
+
+	case fxpSymlink:
+		// OpenSSH swapped the arguments, and everybody followed.
+		target, link := d.string(), d.string()
+		if d.err != nil {
+			return bad()
+		}
+		return c.status(id, os.Symlink(target, c.path(link)))
+
+	case fxpExtended:
+		ext := d.string()
+		if ext == posixRename {
+			from, to := d.string(), d.string()
+			if d.err != nil {
+				return bad()
+			}
+			return c.status(id, os.Rename(c.path(from), c.path(to)))
+		}
+		return c.status(id, &StatusError{Code: StatusOpUnsupported, Msg: "unsupported extension " + ext})
+	}
+	return c.status(id, &StatusError{Code: StatusOpUnsupported, Msg: fmt.Sprintf("unsupported request %d", typ)})
+}
+
+func openFlags(flags uint32) int {
+	var f int
+	switch {
+	case flags&FlagRead != 0 && flags&FlagWrite != 0:
+		f = os.O_RDWR
+	case flags&FlagWrite != 0:
+		f = os.O_WRONLY
+	default:
+		f = os.O_RDONLY
+	}
+	if flags&FlagAppend != 0 {
+		f |= os.O_APPEND
+	}
+	if flags&FlagCreate != 0 {
+		f |= os.O_CREATE
+	}
+	if flags&FlagTrunc != 0 {
+		f |= os.O_TRUNC
+	}
+	if flags&FlagExcl != 0 {
+		f |= os.O_EXCL
+	}
+	return f
+}
+
+// setstat sets the attributes a of the file at p, open as f if not nil.
+func setstat(p string, f *os.File, a *Attrs) error {
+	if a.Flags&AttrSize != 0 {
+		var err error
+		if f != nil {
+			err = f.Truncate(int64(a.Size))
+		} else {
+			err = os.Truncate(p, int64(a.Size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a.Flags&AttrPermissions != 0 {
+		if err := os.Chmod(p, a.FileMode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+	if a.Flags&AttrUIDGID != 0 {
+		if err := os.Chown(p, int(a.UID), int(a.GID)); err != nil {
+			return err
+		}
+	}
+	if a.Flags&AttrACModTime != 0 {
+		if err := os.Chtimes(p, time.Unix(int64(a.Atime), 0), time.Unix(int64(a.Mtime), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
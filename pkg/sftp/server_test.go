@@ -0,0 +1,212 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rawClient speaks the protocol packet by packet.
+type rawClient struct {
+	t    *testing.T
+	conn net.Conn
+	id   uint32
+}
+
+func newRawClient(t *testing.T, dir string) *rawClient {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Server{Dir: dir}).Serve(server)
+		server.Close()
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve = %v", err)
+		}
+	})
+
+	c := &rawClient{t: t, conn: client}
+	if err := writePacket(client, fxpInit, appendUint32(nil, Version)); err != nil {
+		t.Fatal(err)
+	}
+	typ, b, err := readPacket(client)
+	if err != nil || typ != fxpVersion {
+		t.Fatalf("init got packet %d, %v, want version", typ, err)
+	}
+	d := &decoder{b: b}
+	if v, ext := d.uint32(), d.string(); v != Version || ext != posixRename {
+		t.Fatalf("server version %d with extension %q, want %d with %q", v, ext, Version, posixRename)
+	}
+	return c
+}
+
+// request sends a request and returns the type and the rest of the reply
+// after its ID.
+func (c *rawClient) request(typ byte, fields ...any) (byte, *decoder) {
+	c.t.Helper()
+	c.id++
+	b := appendUint32(nil, c.id)
+	for _, f := range fields {
+		switch f := f.(type) {
+		case string:
+			b = appendString(b, f)
+		case uint32:
+			b = appendUint32(b, f)
+		case uint64:
+			b = appendUint64(b, f)
+		case *Attrs:
+			b = appendAttrs(b, f)
+		}
+	}
+	if err := writePacket(c.conn, typ, b); err != nil {
+		c.t.Fatal(err)
+	}
+	rtyp, rb, err := readPacket(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	d := &decoder{b: rb}
+	if id := d.uint32(); id != c.id {
+		c.t.Fatalf("reply has ID %d, want %d", id, c.id)
+	}
+	return rtyp, d
+}
+
+// status sends a request expecting a status reply and returns the code.
+func (c *rawClient) status(typ byte, fields ...any) uint32 {
+	c.t.Helper()
+	rtyp, d := c.request(typ, fields...)
+	if rtyp != fxpStatus {
+		c.t.Fatalf("request %d got reply %d, want status", typ, rtyp)
+	}
+	return d.uint32()
+}
+
+func (c *rawClient) handle(typ byte, fields ...any) string {
+	c.t.Helper()
+	rtyp, d := c.request(typ, fields...)
+	if rtyp != fxpHandle {
+		c.t.Fatalf("request %d got reply %d, want handle", typ, rtyp)
+	}
+	return d.string()
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	c := newRawClient(t, dir)
+
+	h := c.handle(fxpOpen, "f", uint32(FlagWrite|FlagCreate|FlagTrunc), &Attrs{Flags: AttrPermissions, Mode: 0o600})
+	if code := c.status(fxpWrite, h, uint64(6), "world"); code != StatusOK {
+		t.Errorf("write status %d", code)
+	}
+	if code := c.status(fxpWrite, h, uint64(0), "hello "); code != StatusOK {
+		t.Errorf("write status %d", code)
+	}
+	if code := c.status(fxpClose, h); code != StatusOK {
+		t.Errorf("close status %d", code)
+	}
+	if code := c.status(fxpClose, h); code != StatusFailure {
+		t.Errorf("second close status %d, want failure", code)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "f")); err != nil || string(b) != "hello world" {
+		t.Errorf("written file has %q, %v", b, err)
+	}
+
+	typ, d := c.request(fxpStat, filepath.Join(dir, "f"))
+	if a := d.attrs(); typ != fxpAttrs || a.Size != 11 || a.Mode != modeRegular|0o600 {
+		t.Errorf("stat = %d, %+v, want regular file of 11 bytes with mode 0600", typ, a)
+	}
+
+	h = c.handle(fxpOpen, "f", uint32(FlagRead), &Attrs{})
+	typ, d = c.request(fxpRead, h, uint64(6), uint32(100))
+	if data := d.string(); typ != fxpData || data != "world" {
+		t.Errorf("read = %d, %q, want data %q", typ, data, "world")
+	}
+	if code := c.status(fxpRead, h, uint64(11), uint32(100)); code != StatusEOF {
+		t.Errorf("read at end status %d, want EOF", code)
+	}
+	c.status(fxpClose, h)
+
+	if code := c.status(fxpMkdir, "d", &Attrs{}); code != StatusOK {
+		t.Errorf("mkdir status %d", code)
+	}
+	if code := c.status(fxpSymlink, "../f", "d/l"); code != StatusOK {
+		t.Errorf("symlink status %d", code)
+	}
+	typ, d = c.request(fxpReadlink, "d/l")
+	if n, name := d.uint32(), d.string(); typ != fxpName || n != 1 || name != "../f" {
+		t.Errorf("readlink = %d, %q", typ, name)
+	}
+	typ, d = c.request(fxpRealpath, "d/l")
+	if n, name := d.uint32(), d.string(); typ != fxpName || n != 1 || name != filepath.Join(dir, "f") {
+		t.Errorf("realpath = %d, %q, want %q", typ, name, filepath.Join(dir, "f"))
+	}
+
+	h = c.handle(fxpOpendir, ".")
+	typ, d = c.request(fxpReaddir, h)
+	names := map[string]string{}
+	for n := d.uint32(); n > 0; n-- {
+		name, long := d.string(), d.string()
+		d.attrs()
+		names[name] = long[:1]
+	}
+	if typ != fxpName || len(names) != 2 || names["f"] != "-" || names["d"] != "d" {
+		t.Errorf("readdir = %d, %v, want file f and directory d", typ, names)
+	}
+	if code := c.status(fxpReaddir, h); code != StatusEOF {
+		t.Errorf("second readdir status %d, want EOF", code)
+	}
+	c.status(fxpClose, h)
+
+	if code := c.status(fxpOpendir, "f"); code != StatusFailure {
+		t.Errorf("opendir of a file status %d, want failure", code)
+	}
+	if code := c.status(fxpSetstat, "f", &Attrs{Flags: AttrPermissions | AttrSize, Mode: 0o640, Size: 5}); code != StatusOK {
+		t.Errorf("setstat status %d", code)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "f")); err != nil || fi.Mode() != 0o640 || fi.Size() != 5 {
+		t.Errorf("after setstat f has mode %v and size %d, %v", fi.Mode(), fi.Size(), err)
+	}
+	if code := c.status(fxpRename, "f", "d/l"); code != StatusFailure {
+		t.Errorf("rename onto existing file status %d, want failure", code)
+	}
+	if code := c.status(fxpExtended, posixRename, "f", "d/l"); code != StatusOK {
+		t.Errorf("posix rename status %d", code)
+	}
+	if code := c.status(fxpRemove, "f"); code != StatusNoSuchFile {
+		t.Errorf("remove of renamed file status %d, want no such file", code)
+	}
+	if code := c.status(fxpRmdir, "d"); code != StatusFailure {
+		t.Errorf("rmdir of non-empty directory status %d, want failure", code)
+	}
+	if code := c.status(fxpRemove, "d/l"); code != StatusOK {
+		t.Errorf("remove status %d", code)
+	}
+	if code := c.status(fxpRmdir, "d"); code != StatusOK {
+		t.Errorf("rmdir status %d", code)
+	}
+	if code := c.status(fxpExtended, "statvfs@openssh.com", "/"); code != StatusOpUnsupported {
+		t.Errorf("statvfs status %d, want unsupported", code)
+	}
+	if code := c.status(fxpOpen, "f"); code != StatusBadMessage {
+		t.Errorf("open without flags status %d, want bad message", code)
+	}
+}
+
+func TestLongName(t *testing.T) {
+	a := &Attrs{Mode: modeDir | 0o755, UID: 0, GID: 5, Size: 4096, Mtime: 100000}
+	// The date is in the local time zone.
+	got := longName("etc", a)
+	if want := "drwxr-xr-x    1 0        5            4096 "; !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "1970 etc") {
+		t.Errorf("longName = %q, want %q, a date in 1970 and the name", got, want)
+	}
+}
@@ -75,3 +75,8 @@ func (t *TTYIO) Read(b []byte) (int, error) {
 func (t *TTYIO) Write(b []byte) (int, error) {
 	return t.f.Write(b)
 }
+
+// Close closes the tty.
+func (t *TTYIO) Close() error {
+	return t.f.Close()
+}
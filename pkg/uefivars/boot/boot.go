@@ -46,6 +46,80 @@ type EfiLoadOption struct {
 	FilePathList       EfiDevicePathProtocolList
 	OptionalData       []byte
 }
+
+// Attributes of an EfiLoadOption.
+const (
+	LoadOptionActive         = 0x00000001
+	LoadOptionForceReconnect = 0x00000002
+	LoadOptionHidden         = 0x00000008
+	LoadOptionCategoryApp    = 0x00000100
+)
+
+// NewEfiLoadOption returns an active EfiLoadOption booting the given device
+// path.
+func NewEfiLoadOption(description string, path EfiDevicePathProtocolList, optionalData []byte) *EfiLoadOption {
+	return &EfiLoadOption{
+		Attributes:   LoadOptionActive,
+		Description:  description,
+		FilePathList: path,
+		OptionalData: optionalData,
+	}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. FilePathListLength is
+// computed from FilePathList.
+func (o *EfiLoadOption) MarshalBinary() ([]byte, error) {
+	fpl, err := o.FilePathList.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(fpl) > 0xffff {
+		return nil, fmt.Errorf("FilePathList of %d bytes: %w", len(fpl), ErrParse)
+	}
+	b := make([]byte, 6)
+	binary.LittleEndian.PutUint32(b[:4], o.Attributes)
+	binary.LittleEndian.PutUint16(b[4:6], uint16(len(fpl)))
+	b = append(b, uefivars.EncodeUTF16(o.Description)...)
+	b = append(b, 0, 0)
+	b = append(b, fpl...)
+	return append(b, o.OptionalData...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (o *EfiLoadOption) UnmarshalBinary(b []byte) error {
+	if len(b) < 6 {
+		return ErrParse
+	}
+	o.Attributes = binary.LittleEndian.Uint32(b[:4])
+	o.FilePathListLength = binary.LittleEndian.Uint16(b[4:6])
+	b = b[6:]
+
+	// Description is null-terminated utf16
+	i := 0
+	for ; ; i += 2 {
+		if i+1 >= len(b) {
+			return fmt.Errorf("unterminated description: %w", ErrParse)
+		}
+		if b[i] == 0 && b[i+1] == 0 {
+			break
+		}
+	}
+	var err error
+	if o.Description, err = uefivars.DecodeUTF16(b[:i]); err != nil {
+		return err
+	}
+	b = b[i+2:]
+
+	if len(b) < int(o.FilePathListLength) {
+		return fmt.Errorf("FilePathList of %d bytes in %d: %w", o.FilePathListLength, len(b), ErrParse)
+	}
+	if o.FilePathList, err = ParseFilePathList(b[:o.FilePathListLength]); err != nil {
+		return err
+	}
+	o.OptionalData = b[o.FilePathListLength:]
+	return nil
+}
+
 type BootEntryVars []*BootEntryVar
 
 // Gets BootXXXX var, if it exists
@@ -0,0 +1,261 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	guid "github.com/google/uuid"
+	"github.com/u-root/u-root/pkg/efivarfs"
+)
+
+// BootVarAttributes are the attributes of the boot manager's variables.
+const BootVarAttributes = efivarfs.AttributeNonVolatile | efivarfs.AttributeBootserviceAccess | efivarfs.AttributeRuntimeAccess
+
+// ErrNoFreeEntry is returned when all 65536 boot entry numbers are in use.
+var ErrNoFreeEntry = errors.New("no free boot entry number")
+
+var bootGUID = guid.MustParse(BootUUID)
+
+func bootDesc(name string) efivarfs.VariableDescriptor {
+	return efivarfs.VariableDescriptor{Name: name, GUID: bootGUID}
+}
+
+func bootEntryName(num uint16) string {
+	return fmt.Sprintf("Boot%04X", num)
+}
+
+// readU16s reads a variable holding an array of little endian uint16s.
+func readU16s(e efivarfs.EFIVar, name string) ([]uint16, error) {
+	_, data, err := e.Get(bootDesc(name))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("%s has odd length %d: %w", name, len(data), ErrParse)
+	}
+	v := make([]uint16, len(data)/2)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return v, nil
+}
+
+// writeU16s writes a variable holding an array of little endian uint16s.
+func writeU16s(e efivarfs.EFIVar, name string, v []uint16) error {
+	data := make([]byte, 2*len(v))
+	for i, n := range v {
+		binary.LittleEndian.PutUint16(data[2*i:], n)
+	}
+	if err := e.Set(bootDesc(name), BootVarAttributes, data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func readU16(e efivarfs.EFIVar, name string) (uint16, error) {
+	v, err := readU16s(e, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 1 {
+		return 0, fmt.Errorf("%s has length %d: %w", name, 2*len(v), ErrParse)
+	}
+	return v[0], nil
+}
+
+// ReadBootOrder returns the BootOrder variable, the order in which boot
+// entries are tried.
+func ReadBootOrder(e efivarfs.EFIVar) ([]uint16, error) {
+	return readU16s(e, "BootOrder")
+}
+
+// WriteBootOrder sets the BootOrder variable.
+func WriteBootOrder(e efivarfs.EFIVar, order []uint16) error {
+	return writeU16s(e, "BootOrder", order)
+}
+
+// ReadBootNext returns the BootNext variable, the entry to try first on the
+// next boot only.
+func ReadBootNext(e efivarfs.EFIVar) (uint16, error) {
+	return readU16(e, "BootNext")
+}
+
+// WriteBootNext sets the BootNext variable.
+func WriteBootNext(e efivarfs.EFIVar, num uint16) error {
+	return writeU16s(e, "BootNext", []uint16{num})
+}
+
+// RemoveBootNext removes the BootNext variable.
+func RemoveBootNext(e efivarfs.EFIVar) error {
+	if err := e.Remove(bootDesc("BootNext")); err != nil {
+		return fmt.Errorf("removing BootNext: %w", err)
+	}
+	return nil
+}
+
+// ReadTimeout returns the Timeout variable, the number of seconds the
+// firmware waits before booting the first entry.
+func ReadTimeout(e efivarfs.EFIVar) (uint16, error) {
+	return readU16(e, "Timeout")
+}
+
+// WriteTimeout sets the Timeout variable. 0xffff waits for user input.
+func WriteTimeout(e efivarfs.EFIVar, seconds uint16) error {
+	return writeU16s(e, "Timeout", []uint16{seconds})
+}
+
+// ListBootEntries returns the numbers of all BootXXXX entries in ascending
+// order.
+func ListBootEntries(e efivarfs.EFIVar) ([]uint16, error) {
+	descs, err := e.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing variables: %w", err)
+	}
+	var nums []uint16
+	for _, d := range descs {
+		if d.GUID != bootGUID || !BootEntryFilter(BootUUID, d.Name) {
+			continue
+		}
+		n, err := strconv.ParseUint(d.Name[4:], 16, 16)
+		if err != nil {
+			continue
+		}
+		nums = append(nums, uint16(n))
+	}
+	slices.Sort(nums)
+	return nums, nil
+}
+
+// ReadBootEntry reads and decodes BootXXXX.
+func ReadBootEntry(e efivarfs.EFIVar, num uint16) (*BootEntryVar, error) {
+	name := bootEntryName(num)
+	_, data, err := e.Get(bootDesc(name))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	b := &BootEntryVar{Number: num}
+	if err := b.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// WriteBootEntry encodes opt and writes it to BootXXXX. It does not change
+// BootOrder.
+func WriteBootEntry(e efivarfs.EFIVar, num uint16, opt *EfiLoadOption) error {
+	name := bootEntryName(num)
+	data, err := opt.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", name, err)
+	}
+	if err := e.Set(bootDesc(name), BootVarAttributes, data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// CreateBootEntry writes opt to the lowest unused BootXXXX and adds it to
+// BootOrder, first if first is set and last otherwise. It returns the number
+// of the new entry.
+func CreateBootEntry(e efivarfs.EFIVar, opt *EfiLoadOption, first bool) (uint16, error) {
+	nums, err := ListBootEntries(e)
+	if err != nil {
+		return 0, err
+	}
+	num, ok := freeNumber(nums)
+	if !ok {
+		return 0, ErrNoFreeEntry
+	}
+	order, err := ReadBootOrder(e)
+	if err != nil && !errors.Is(err, efivarfs.ErrVarNotExist) {
+		return 0, err
+	}
+	if err := WriteBootEntry(e, num, opt); err != nil {
+		return 0, err
+	}
+	if first {
+		order = append([]uint16{num}, order...)
+	} else {
+		order = append(order, num)
+	}
+	return num, WriteBootOrder(e, order)
+}
+
+// freeNumber returns the lowest number not in the sorted list nums.
+func freeNumber(nums []uint16) (uint16, bool) {
+	var want uint16
+	for _, n := range nums {
+		if n != want {
+			break
+		}
+		if want == 0xffff {
+			return 0, false
+		}
+		want++
+	}
+	return want, true
+}
+
+// DeleteBootEntry removes BootXXXX, and removes it from BootOrder and
+// BootNext.
+func DeleteBootEntry(e efivarfs.EFIVar, num uint16) error {
+	name := bootEntryName(num)
+	if err := e.Remove(bootDesc(name)); err != nil {
+		return fmt.Errorf("removing %s: %w", name, err)
+	}
+
+	order, err := ReadBootOrder(e)
+	switch {
+	case errors.Is(err, efivarfs.ErrVarNotExist):
+	case err != nil:
+		return err
+	case slices.Contains(order, num):
+		order = slices.DeleteFunc(order, func(n uint16) bool { return n == num })
+		if err := WriteBootOrder(e, order); err != nil {
+			return err
+		}
+	}
+
+	next, err := ReadBootNext(e)
+	switch {
+	case errors.Is(err, efivarfs.ErrVarNotExist):
+	case err != nil:
+		return err
+	case next == num:
+		return RemoveBootNext(e)
+	}
+	return nil
+}
+
+// SetBootEntryActive sets or clears the LoadOptionActive attribute of
+// BootXXXX. Firmware skips inactive entries in BootOrder.
+func SetBootEntryActive(e efivarfs.EFIVar, num uint16, active bool) error {
+	name := bootEntryName(num)
+	attrs, data, err := e.Get(bootDesc(name))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("%s has length %d: %w", name, len(data), ErrParse)
+	}
+	// Only touch the attributes, so that entries with device paths we
+	// cannot encode are preserved.
+	a := binary.LittleEndian.Uint32(data[:4])
+	if active {
+		a |= LoadOptionActive
+	} else {
+		a &^= LoadOptionActive
+	}
+	binary.LittleEndian.PutUint32(data[:4], a)
+	if err := e.Set(bootDesc(name), attrs, data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
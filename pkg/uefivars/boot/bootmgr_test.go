@@ -0,0 +1,180 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/efivarfs"
+)
+
+type fakeVar struct {
+	attrs efivarfs.VariableAttributes
+	data  []byte
+}
+
+// fakeVarFS keeps variables in memory. Unlike a plain directory standing in
+// for efivarfs, writing replaces the whole variable, as the kernel does.
+type fakeVarFS map[efivarfs.VariableDescriptor]fakeVar
+
+var _ efivarfs.EFIVar = fakeVarFS{}
+
+func (f fakeVarFS) Get(desc efivarfs.VariableDescriptor) (efivarfs.VariableAttributes, []byte, error) {
+	v, ok := f[desc]
+	if !ok {
+		return 0, nil, efivarfs.ErrVarNotExist
+	}
+	return v.attrs, append([]byte{}, v.data...), nil
+}
+
+func (f fakeVarFS) Set(desc efivarfs.VariableDescriptor, attrs efivarfs.VariableAttributes, data []byte) error {
+	f[desc] = fakeVar{attrs: attrs, data: append([]byte{}, data...)}
+	return nil
+}
+
+func (f fakeVarFS) Remove(desc efivarfs.VariableDescriptor) error {
+	if _, ok := f[desc]; !ok {
+		return efivarfs.ErrVarNotExist
+	}
+	delete(f, desc)
+	return nil
+}
+
+func (f fakeVarFS) List() ([]efivarfs.VariableDescriptor, error) {
+	var descs []efivarfs.VariableDescriptor
+	for d := range f {
+		descs = append(descs, d)
+	}
+	return descs, nil
+}
+
+func TestBootEntries(t *testing.T) {
+	e := fakeVarFS{}
+	// An entry we cannot fully decode must survive untouched.
+	raw := &EfiDevPathRaw{Hdr: EfiDevicePathProtocolHdr{ProtoType: DppTypeBBS, ProtoSubType: 1, Length: 6}, Raw: []byte{1, 2}}
+	if err := WriteBootEntry(e, 0, NewEfiLoadOption("legacy", EfiDevicePathProtocolList{raw}, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	http, err := CreateBootEntry(e, NewEfiLoadOption("HTTP", EfiDevicePathProtocolList{
+		NewDppMsgMAC(net.HardwareAddr{0x52, 0x54, 0, 0x12, 0x34, 0x56}),
+		NewDppMsgIPv4(),
+		NewDppMsgURI("http://10.0.0.1/boot.efi"),
+	}, nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := CreateBootEntry(e, NewEfiLoadOption("disk", EfiDevicePathProtocolList{
+		NewDppMediaFilePath("/EFI/BOOT/BOOTX64.EFI"),
+	}, nil), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if http != 1 || disk != 2 {
+		t.Errorf("CreateBootEntry numbers = %d, %d, want 1, 2", http, disk)
+	}
+	if order, err := ReadBootOrder(e); err != nil || !reflect.DeepEqual(order, []uint16{2, 1}) {
+		t.Errorf("ReadBootOrder = %v, %v, want [2 1], nil", order, err)
+	}
+	if nums, err := ListBootEntries(e); err != nil || !reflect.DeepEqual(nums, []uint16{0, 1, 2}) {
+		t.Errorf("ListBootEntries = %v, %v, want [0 1 2], nil", nums, err)
+	}
+
+	b, err := ReadBootEntry(e, http)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Boot0001: attrs=0x1, desc=\"HTTP\", path=MAC(525400123456)/IPv4(0.0.0.0,0,DHCP,0.0.0.0,0.0.0.0,0.0.0.0)/Uri(http://10.0.0.1/boot.efi), opts="
+	if b.String() != want {
+		t.Errorf("ReadBootEntry =\n%s, want\n%s", b, want)
+	}
+	if attrs, _, _ := e.Get(bootDesc("Boot0001")); attrs != BootVarAttributes {
+		t.Errorf("Boot0001 attributes = %#x, want %#x", attrs, BootVarAttributes)
+	}
+
+	if err := SetBootEntryActive(e, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ReadBootEntry(e, 0); err != nil || b.Attributes != 0 || b.FilePathList.String() != raw.String() {
+		t.Errorf("ReadBootEntry(0) after deactivating = %v, %v", b, err)
+	}
+	if err := SetBootEntryActive(e, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ReadBootEntry(e, 0); err != nil || b.Attributes != LoadOptionActive {
+		t.Errorf("ReadBootEntry(0) after activating = %v, %v", b, err)
+	}
+
+	if err := WriteBootNext(e, http); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteBootEntry(e, http); err != nil {
+		t.Fatal(err)
+	}
+	if order, err := ReadBootOrder(e); err != nil || !reflect.DeepEqual(order, []uint16{2}) {
+		t.Errorf("ReadBootOrder after delete = %v, %v, want [2], nil", order, err)
+	}
+	if _, err := ReadBootNext(e); !errors.Is(err, efivarfs.ErrVarNotExist) {
+		t.Errorf("ReadBootNext after delete = %v, want %v", err, efivarfs.ErrVarNotExist)
+	}
+	if _, err := ReadBootEntry(e, http); !errors.Is(err, efivarfs.ErrVarNotExist) {
+		t.Errorf("ReadBootEntry after delete = %v, want %v", err, efivarfs.ErrVarNotExist)
+	}
+
+	// The freed number is reused.
+	if n, err := CreateBootEntry(e, NewEfiLoadOption("again", EfiDevicePathProtocolList{}, nil), false); err != nil || n != http {
+		t.Errorf("CreateBootEntry = %d, %v, want %d, nil", n, err, http)
+	}
+	if err := DeleteBootEntry(e, 7); !errors.Is(err, efivarfs.ErrVarNotExist) {
+		t.Errorf("DeleteBootEntry(7) = %v, want %v", err, efivarfs.ErrVarNotExist)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	e := fakeVarFS{}
+	if _, err := ReadTimeout(e); !errors.Is(err, efivarfs.ErrVarNotExist) {
+		t.Errorf("ReadTimeout = %v, want %v", err, efivarfs.ErrVarNotExist)
+	}
+	if err := WriteTimeout(e, 5); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadTimeout(e); err != nil || got != 5 {
+		t.Errorf("ReadTimeout = %d, %v, want 5, nil", got, err)
+	}
+	if got := e[bootDesc("Timeout")].data; !reflect.DeepEqual(got, []byte{5, 0}) {
+		t.Errorf("Timeout = %x, want 0500", got)
+	}
+
+	e[bootDesc("Timeout")] = fakeVar{data: []byte{5}}
+	if _, err := ReadTimeout(e); !errors.Is(err, ErrParse) {
+		t.Errorf("ReadTimeout of odd length = %v, want %v", err, ErrParse)
+	}
+}
+
+func TestFreeNumber(t *testing.T) {
+	for _, tt := range []struct {
+		nums []uint16
+		want uint16
+		ok   bool
+	}{
+		{nums: nil, want: 0, ok: true},
+		{nums: []uint16{0, 1, 3}, want: 2, ok: true},
+		{nums: []uint16{1, 2}, want: 0, ok: true},
+		{nums: func() []uint16 {
+			all := make([]uint16, 0x10000)
+			for i := range all {
+				all[i] = uint16(i)
+			}
+			return all
+		}(), want: 0, ok: false},
+	} {
+		if got, ok := freeNumber(tt.nums); got != tt.want || ok != tt.ok {
+			t.Errorf("freeNumber(%d numbers) = %d, %t, want %d, %t", len(tt.nums), got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -7,4 +7,7 @@
 
 // Package boot manipulates UEFI boot variables, and can identify and mount
 // the volume referenced by a boot var.
+//
+// Boot entries, BootOrder, BootNext and Timeout can be created and edited
+// through an efivarfs.EFIVar, like efibootmgr does.
 package boot
@@ -8,6 +8,8 @@
 package boot
 
 import (
+	"encoding"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
@@ -104,6 +106,12 @@ loop:
 				p, err = ParseDppMsgATAPI(h, data)
 			case DppMsgTypeMAC:
 				p, err = ParseDppMsgMAC(h, data)
+			case DppMsgTypeIP4:
+				p, err = ParseDppMsgIPv4(h, data)
+			case DppMsgTypeIP6:
+				p, err = ParseDppMsgIPv6(h, data)
+			case DppMsgTypeURI:
+				p, err = ParseDppMsgURI(h, data)
 			default:
 				log.Printf("unhandled msg subtype %s: %q", st, data)
 			}
@@ -181,6 +189,29 @@ type EfiDevicePathProtocol interface {
 
 type EfiDevicePathProtocolList []EfiDevicePathProtocol
 
+// MarshalBinary encodes the list as a FilePathList, terminated by an end of
+// entire device path node. Every element must implement
+// encoding.BinaryMarshaler.
+func (list EfiDevicePathProtocolList) MarshalBinary() ([]byte, error) {
+	var b []byte
+	for _, dpp := range list {
+		m, ok := dpp.(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, fmt.Errorf("encoding %s %s: %w", dpp.Header().ProtoType, dpp.ProtoSubTypeStr(), ErrUnimpl)
+		}
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, data...)
+	}
+	end, err := NewEfiDevPathEnd().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, end...), nil
+}
+
 func (list EfiDevicePathProtocolList) String() string {
 	var res string
 	for n, dpp := range list {
@@ -211,6 +242,29 @@ type EfiDevicePathProtocolHdr struct {
 	Length       uint16
 }
 
+// newDppHdr returns the header of a node with a body of the given length.
+func newDppHdr(t EfiDevPathProtoType, st EfiDevPathProtoSubType, bodyLen int) EfiDevicePathProtocolHdr {
+	return EfiDevicePathProtocolHdr{
+		ProtoType:    t,
+		ProtoSubType: st,
+		Length:       uint16(4 + bodyLen),
+	}
+}
+
+// marshalDpp encodes a node with the given header type and body. The length
+// is computed from the body, so parsed nodes with a stale Length still
+// encode correctly.
+func marshalDpp(h EfiDevicePathProtocolHdr, body []byte) ([]byte, error) {
+	if len(body)+4 > 0xffff {
+		return nil, fmt.Errorf("%s node of %d bytes: %w", h.ProtoType, len(body)+4, ErrParse)
+	}
+	b := make([]byte, 4, 4+len(body))
+	b[0] = byte(h.ProtoType)
+	b[1] = byte(h.ProtoSubType)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(4+len(body)))
+	return append(b, body...), nil
+}
+
 type EfiDevPathProtoType uint8
 
 const (
@@ -270,6 +324,14 @@ type EfiDevPathEnd struct {
 
 var _ EfiDevicePathProtocol = (*EfiDevPathEnd)(nil)
 
+// NewEfiDevPathEnd returns the node ending an entire device path.
+func NewEfiDevPathEnd() *EfiDevPathEnd {
+	return &EfiDevPathEnd{Hdr: newDppHdr(DppTypeEnd, EfiDevPathProtoSubType(DppETypeEndEntire), 0)}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *EfiDevPathEnd) MarshalBinary() ([]byte, error) { return marshalDpp(e.Hdr, nil) }
+
 func (e *EfiDevPathEnd) Header() EfiDevicePathProtocolHdr { return e.Hdr }
 
 // ProtoSubTypeStr returns the subtype as human readable.
@@ -303,6 +365,9 @@ func (e *EfiDevPathRaw) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrParse
 }
 
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *EfiDevPathRaw) MarshalBinary() ([]byte, error) { return marshalDpp(e.Hdr, e.Raw) }
+
 /* https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_A_Feb14.pdf
 Boot0007* UEFI OS       HD(1,GPT,81635ccd-1b4f-4d3f-b7b7-f78a5b029f35,0x40,0xf000)/File(\EFI\BOOT\BOOTX64.EFI)..BO
 
@@ -8,8 +8,11 @@
 package boot
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 
+	guid "github.com/google/uuid"
 	"github.com/u-root/u-root/pkg/uefivars"
 )
 
@@ -75,3 +78,67 @@ func TestParseFilePathList(t *testing.T) {
 		t.Errorf("\nwant %s\n got %s", expectedOutput, output)
 	}
 }
+
+// func (o *EfiLoadOption) MarshalBinary() ([]byte, error)
+func TestMarshalEfiLoadOption(t *testing.T) {
+	part := uefivars.UUID(guid.MustParse("81635ccd-1b4f-4d3f-b7b8-f78a5b029f35"))
+	opt := NewEfiLoadOption("UEFI OS", EfiDevicePathProtocolList{
+		NewDppMediaHDDGPT(1, 0x40, 0xf000, part),
+		NewDppMediaFilePath("/EFI/BOOT/BOOTX64.EFI"),
+	}, []byte{0x00, 0x00, 0x42, 0x4f})
+	got, err := opt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, boot7) {
+		t.Errorf("mismatch\nwant %x\n got %x", boot7, got)
+	}
+
+	var back EfiLoadOption
+	if err := back.UnmarshalBinary(got); err != nil {
+		t.Fatal(err)
+	}
+	want := "HD(1,GPT,81635ccd-1b4f-4d3f-b7b8-f78a5b029f35,0x40,0xf000)/File(/EFI/BOOT/BOOTX64.EFI)"
+	if back.FilePathList.String() != want || back.Description != "UEFI OS" || back.FilePathListLength != 0x5e {
+		t.Errorf("round trip = %q %q %#x, want %q %q 0x5e", back.Description, back.FilePathList, back.FilePathListLength, "UEFI OS", want)
+	}
+}
+
+// Every boot entry in testdata must encode to the bytes it was parsed from.
+func TestMarshalEfiLoadOptionRoundTrip(t *testing.T) {
+	for _, v := range uefivars.ReadVars(BootEntryFilter) {
+		var opt EfiLoadOption
+		if err := opt.UnmarshalBinary(v.Data); err != nil {
+			t.Errorf("%s: %v", v.Name, err)
+			continue
+		}
+		got, err := opt.MarshalBinary()
+		if err != nil {
+			t.Errorf("%s: %v", v.Name, err)
+			continue
+		}
+		if !bytes.Equal(got, v.Data) {
+			t.Errorf("%s mismatch\nwant %x\n got %x", v.Name, v.Data, got)
+		}
+	}
+}
+
+// func (o *EfiLoadOption) UnmarshalBinary(b []byte) error
+func TestUnmarshalEfiLoadOptionErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   []byte
+	}{
+		{name: "short", in: boot7[:4]},
+		{name: "unterminated description", in: boot7[:12]},
+		{name: "short file path list", in: boot7[:40]},
+		{name: "missing end node", in: append(append([]byte{}, boot7[:4]...), append([]byte{0x2a, 0}, boot7[6:64]...)...)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var opt EfiLoadOption
+			if err := opt.UnmarshalBinary(tt.in); !errors.Is(err, ErrParse) {
+				t.Errorf("UnmarshalBinary = %v, want %v", err, ErrParse)
+			}
+		})
+	}
+}
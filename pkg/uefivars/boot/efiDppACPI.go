@@ -69,6 +69,14 @@ func (e *DppAcpiDevPath) String() string { return fmt.Sprintf("ACPI(0x%x,0x%x)",
 // associated with ErrUnimpl.
 func (e *DppAcpiDevPath) Resolver() (EfiPathSegmentResolver, error) { return nil, ErrUnimpl }
 
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppAcpiDevPath) MarshalBinary() ([]byte, error) {
+	if len(e.HID) != 4 || len(e.UID) != 4 {
+		return nil, ErrParse
+	}
+	return marshalDpp(e.Hdr, append(append([]byte{}, e.HID...), e.UID...))
+}
+
 // DppAcpiExDevPath is an expanded dpp acpi device path.
 type DppAcpiExDevPath struct {
 	Hdr                    EfiDevicePathProtocolHdr
@@ -125,6 +133,21 @@ func (e *DppAcpiExDevPath) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrUnimpl
 }
 
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppAcpiExDevPath) MarshalBinary() ([]byte, error) {
+	if len(e.HID) != 4 || len(e.UID) != 4 || len(e.CID) != 4 {
+		return nil, ErrParse
+	}
+	var b []byte
+	b = append(b, e.HID...)
+	b = append(b, e.UID...)
+	b = append(b, e.CID...)
+	for _, s := range []string{e.HIDSTR, e.UIDSTR, e.CIDSTR} {
+		b = append(append(b, s...), 0)
+	}
+	return marshalDpp(e.Hdr, b)
+}
+
 func readToNull(b []byte) (string, error) {
 	i := bytes.IndexRune(b, 0)
 	if i < 0 {
@@ -75,3 +75,8 @@ func (e *DppHwPci) String() string {
 func (e *DppHwPci) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrUnimpl
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppHwPci) MarshalBinary() ([]byte, error) {
+	return marshalDpp(e.Hdr, []byte{e.Function, e.Device})
+}
@@ -67,6 +67,21 @@ type DppMediaHDD struct {
 
 var _ EfiDevicePathProtocol = (*DppMediaHDD)(nil)
 
+// NewDppMediaHDDGPT returns a DppMediaHDD for partition partNum of a GPT
+// disk. start and size are in logical blocks, and partUUID is the unique
+// partition GUID.
+func NewDppMediaHDDGPT(partNum uint32, start, size uint64, partUUID uefivars.UUID) *DppMediaHDD {
+	return &DppMediaHDD{
+		Hdr:       newDppHdr(DppTypeMedia, EfiDevPathProtoSubType(DppMTypeHdd), 38),
+		PartNum:   partNum,
+		PartStart: start,
+		PartSize:  size,
+		PartSig:   partUUID.ToMixedGUID(),
+		PartFmt:   2,
+		SigType:   2,
+	}
+}
+
 // ParseDppMediaHdd parses input into a DppMediaHDD struct.
 func ParseDppMediaHdd(h EfiDevicePathProtocolHdr, b []byte) (*DppMediaHDD, error) {
 	if len(b) < 38 {
@@ -125,6 +140,18 @@ func (e *DppMediaHDD) Resolver() (EfiPathSegmentResolver, error) {
 	return &HddResolver{BlockDev: blocks[0]}, nil
 }
 
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMediaHDD) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 38)
+	binary.LittleEndian.PutUint32(b[:4], e.PartNum)
+	binary.LittleEndian.PutUint64(b[4:12], e.PartStart)
+	binary.LittleEndian.PutUint64(b[12:20], e.PartSize)
+	copy(b[20:36], e.PartSig[:])
+	b[36] = e.PartFmt
+	b[37] = e.SigType
+	return marshalDpp(e.Hdr, b)
+}
+
 // return the partition table type as a string
 func (e *DppMediaHDD) pttype() string {
 	switch e.PartFmt {
@@ -160,6 +187,14 @@ type DppMediaFilePath struct {
 
 var _ EfiDevicePathProtocol = (*DppMediaFilePath)(nil)
 
+// NewDppMediaFilePath returns a DppMediaFilePath for path, relative to the
+// root of the file system, e.g. /EFI/BOOT/BOOTX64.EFI.
+func NewDppMediaFilePath(path string) *DppMediaFilePath {
+	fp := &DppMediaFilePath{PathNameDecoded: path}
+	fp.Hdr = newDppHdr(DppTypeMedia, EfiDevPathProtoSubType(DppMTypeFilePath), len(fp.encode()))
+	return fp
+}
+
 func ParseDppMediaFilePath(h EfiDevicePathProtocolHdr, b []byte) (*DppMediaFilePath, error) {
 	if len(b) < int(h.Length)-4 {
 		return nil, ErrParse
@@ -196,6 +231,17 @@ func (e *DppMediaFilePath) Resolver() (EfiPathSegmentResolver, error) {
 	return &pr, nil
 }
 
+// encode returns the path as null terminated utf16 with windows slashes.
+func (e *DppMediaFilePath) encode() []byte {
+	path := strings.ReplaceAll(e.PathNameDecoded, string(os.PathSeparator), "\\")
+	return append(uefivars.EncodeUTF16(path), 0, 0)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMediaFilePath) MarshalBinary() ([]byte, error) {
+	return marshalDpp(e.Hdr, e.encode())
+}
+
 // struct in EfiDevicePathProtocol for DppMTypePIWGFV
 type DppMediaPIWGFV struct {
 	Hdr EfiDevicePathProtocolHdr
@@ -234,6 +280,9 @@ func (e *DppMediaPIWGFV) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrUnimpl
 }
 
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMediaPIWGFV) MarshalBinary() ([]byte, error) { return marshalDpp(e.Hdr, e.Fv) }
+
 // struct in EfiDevicePathProtocol for DppMTypePIWGFF
 type DppMediaPIWGFF struct {
 	Hdr EfiDevicePathProtocolHdr
@@ -272,3 +321,6 @@ func (e *DppMediaPIWGFF) String() string {
 func (e *DppMediaPIWGFF) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrUnimpl
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMediaPIWGFF) MarshalBinary() ([]byte, error) { return marshalDpp(e.Hdr, e.Ff) }
@@ -10,6 +10,7 @@ package boot
 import (
 	"encoding/binary"
 	"fmt"
+	"net"
 )
 
 type EfiDppMsgSubType EfiDevPathProtoSubType
@@ -131,6 +132,19 @@ func (e *DppMsgATAPI) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrUnimpl
 }
 
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMsgATAPI) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	if !e.Primary {
+		b[0] = 1
+	}
+	if !e.Master {
+		b[1] = 1
+	}
+	binary.LittleEndian.PutUint16(b[2:4], e.LUN)
+	return marshalDpp(e.Hdr, b)
+}
+
 // DppMsgMAC contains a MAC address.
 // pg 300
 type DppMsgMAC struct {
@@ -139,6 +153,19 @@ type DppMsgMAC struct {
 	IfType uint8    // RFC3232; seems ethernet is 6
 }
 
+var _ EfiDevicePathProtocol = (*DppMsgMAC)(nil)
+
+// NewDppMsgMAC returns a DppMsgMAC for the ethernet interface with the given
+// hardware address.
+func NewDppMsgMAC(mac net.HardwareAddr) *DppMsgMAC {
+	m := &DppMsgMAC{
+		Hdr:    newDppHdr(DppTypeMessaging, EfiDevPathProtoSubType(DppMsgTypeMAC), 33),
+		IfType: 1,
+	}
+	copy(m.Mac[:], mac)
+	return m
+}
+
 // ParseDppMsgMAC parses input into a DppMsgMAC.
 func ParseDppMsgMAC(h EfiDevicePathProtocolHdr, b []byte) (*DppMsgMAC, error) {
 	if h.Length != 37 {
@@ -174,3 +201,242 @@ func (e *DppMsgMAC) String() string {
 func (e *DppMsgMAC) Resolver() (EfiPathSegmentResolver, error) {
 	return nil, ErrUnimpl
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMsgMAC) MarshalBinary() ([]byte, error) {
+	return marshalDpp(e.Hdr, append(e.Mac[:], e.IfType))
+}
+
+// ipProtoString returns the name of the common IP protocols.
+func ipProtoString(proto uint16) string {
+	switch proto {
+	case 6:
+		return "TCP"
+	case 17:
+		return "UDP"
+	default:
+		return fmt.Sprintf("%d", proto)
+	}
+}
+
+// DppMsgIPv4 describes the IPv4 configuration of a network boot.
+// pg 301
+type DppMsgIPv4 struct {
+	Hdr                   EfiDevicePathProtocolHdr
+	LocalIP, RemoteIP     [4]byte
+	LocalPort, RemotePort uint16
+	Protocol              uint16 // IANA protocol number, e.g. 6 for TCP
+	StaticIP              bool   // false if the address came from DHCP
+	GatewayIP, SubnetMask [4]byte
+}
+
+var _ EfiDevicePathProtocol = (*DppMsgIPv4)(nil)
+
+// NewDppMsgIPv4 returns a DppMsgIPv4 for an interface configured by DHCP.
+func NewDppMsgIPv4() *DppMsgIPv4 {
+	return &DppMsgIPv4{
+		Hdr: newDppHdr(DppTypeMessaging, EfiDevPathProtoSubType(DppMsgTypeIP4), 23),
+	}
+}
+
+// ParseDppMsgIPv4 parses input into a DppMsgIPv4.
+func ParseDppMsgIPv4(h EfiDevicePathProtocolHdr, b []byte) (*DppMsgIPv4, error) {
+	if h.Length != 27 {
+		return nil, ErrParse
+	}
+	ip := &DppMsgIPv4{
+		Hdr:        h,
+		LocalPort:  binary.LittleEndian.Uint16(b[8:10]),
+		RemotePort: binary.LittleEndian.Uint16(b[10:12]),
+		Protocol:   binary.LittleEndian.Uint16(b[12:14]),
+		StaticIP:   b[14] != 0,
+	}
+	copy(ip.LocalIP[:], b[0:4])
+	copy(ip.RemoteIP[:], b[4:8])
+	copy(ip.GatewayIP[:], b[15:19])
+	copy(ip.SubnetMask[:], b[19:23])
+	return ip, nil
+}
+
+func (e *DppMsgIPv4) Header() EfiDevicePathProtocolHdr { return e.Hdr }
+
+// ProtoSubTypeStr returns the subtype as human readable.
+func (e *DppMsgIPv4) ProtoSubTypeStr() string {
+	return EfiDppMsgSubType(e.Hdr.ProtoSubType).String()
+}
+
+func (e *DppMsgIPv4) String() string {
+	origin := "DHCP"
+	if e.StaticIP {
+		origin = "Static"
+	}
+	return fmt.Sprintf("IPv4(%s,%s,%s,%s,%s,%s)", net.IP(e.RemoteIP[:]), ipProtoString(e.Protocol), origin,
+		net.IP(e.LocalIP[:]), net.IP(e.GatewayIP[:]), net.IP(e.SubnetMask[:]))
+}
+
+// Resolver returns a nil EfiPathSegmentResolver and ErrUnimpl. See the comment
+// associated with ErrUnimpl.
+func (e *DppMsgIPv4) Resolver() (EfiPathSegmentResolver, error) {
+	return nil, ErrUnimpl
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMsgIPv4) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 23)
+	copy(b[0:4], e.LocalIP[:])
+	copy(b[4:8], e.RemoteIP[:])
+	binary.LittleEndian.PutUint16(b[8:10], e.LocalPort)
+	binary.LittleEndian.PutUint16(b[10:12], e.RemotePort)
+	binary.LittleEndian.PutUint16(b[12:14], e.Protocol)
+	if e.StaticIP {
+		b[14] = 1
+	}
+	copy(b[15:19], e.GatewayIP[:])
+	copy(b[19:23], e.SubnetMask[:])
+	return marshalDpp(e.Hdr, b)
+}
+
+// IPv6 address origins of DppMsgIPv6.
+const (
+	IPv6OriginStatic    = 0
+	IPv6OriginStateless = 1 // SLAAC
+	IPv6OriginStateful  = 2 // DHCPv6
+)
+
+// DppMsgIPv6 describes the IPv6 configuration of a network boot.
+// pg 302
+type DppMsgIPv6 struct {
+	Hdr                   EfiDevicePathProtocolHdr
+	LocalIP, RemoteIP     [16]byte
+	LocalPort, RemotePort uint16
+	Protocol              uint16 // IANA protocol number, e.g. 6 for TCP
+	IPAddressOrigin       uint8
+	PrefixLength          uint8
+	GatewayIP             [16]byte
+}
+
+var _ EfiDevicePathProtocol = (*DppMsgIPv6)(nil)
+
+// NewDppMsgIPv6 returns a DppMsgIPv6 for an interface configured by DHCPv6.
+func NewDppMsgIPv6() *DppMsgIPv6 {
+	return &DppMsgIPv6{
+		Hdr:             newDppHdr(DppTypeMessaging, EfiDevPathProtoSubType(DppMsgTypeIP6), 56),
+		IPAddressOrigin: IPv6OriginStateful,
+	}
+}
+
+// ParseDppMsgIPv6 parses input into a DppMsgIPv6. Nodes written before UEFI
+// 2.4 lack the prefix length and gateway, which are left 0.
+func ParseDppMsgIPv6(h EfiDevicePathProtocolHdr, b []byte) (*DppMsgIPv6, error) {
+	if h.Length != 60 && h.Length != 43 {
+		return nil, ErrParse
+	}
+	ip := &DppMsgIPv6{
+		Hdr:             h,
+		LocalPort:       binary.LittleEndian.Uint16(b[32:34]),
+		RemotePort:      binary.LittleEndian.Uint16(b[34:36]),
+		Protocol:        binary.LittleEndian.Uint16(b[36:38]),
+		IPAddressOrigin: b[38],
+	}
+	copy(ip.LocalIP[:], b[0:16])
+	copy(ip.RemoteIP[:], b[16:32])
+	if h.Length == 60 {
+		ip.PrefixLength = b[39]
+		copy(ip.GatewayIP[:], b[40:56])
+	}
+	return ip, nil
+}
+
+func (e *DppMsgIPv6) Header() EfiDevicePathProtocolHdr { return e.Hdr }
+
+// ProtoSubTypeStr returns the subtype as human readable.
+func (e *DppMsgIPv6) ProtoSubTypeStr() string {
+	return EfiDppMsgSubType(e.Hdr.ProtoSubType).String()
+}
+
+func (e *DppMsgIPv6) String() string {
+	var origin string
+	switch e.IPAddressOrigin {
+	case IPv6OriginStatic:
+		origin = "Static"
+	case IPv6OriginStateless:
+		origin = "StatelessAutoConfigure"
+	case IPv6OriginStateful:
+		origin = "StatefulAutoConfigure"
+	default:
+		origin = fmt.Sprintf("%d", e.IPAddressOrigin)
+	}
+	return fmt.Sprintf("IPv6(%s,%s,%s,%s,%s,%d)", net.IP(e.RemoteIP[:]), ipProtoString(e.Protocol), origin,
+		net.IP(e.LocalIP[:]), net.IP(e.GatewayIP[:]), e.PrefixLength)
+}
+
+// Resolver returns a nil EfiPathSegmentResolver and ErrUnimpl. See the comment
+// associated with ErrUnimpl.
+func (e *DppMsgIPv6) Resolver() (EfiPathSegmentResolver, error) {
+	return nil, ErrUnimpl
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It always uses the
+// current, 60 byte, encoding.
+func (e *DppMsgIPv6) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 56)
+	copy(b[0:16], e.LocalIP[:])
+	copy(b[16:32], e.RemoteIP[:])
+	binary.LittleEndian.PutUint16(b[32:34], e.LocalPort)
+	binary.LittleEndian.PutUint16(b[34:36], e.RemotePort)
+	binary.LittleEndian.PutUint16(b[36:38], e.Protocol)
+	b[38] = e.IPAddressOrigin
+	b[39] = e.PrefixLength
+	copy(b[40:56], e.GatewayIP[:])
+	return marshalDpp(e.Hdr, b)
+}
+
+// DppMsgURI contains the URI of a network boot, e.g. for HTTP boot.
+// pg 316
+type DppMsgURI struct {
+	Hdr EfiDevicePathProtocolHdr
+	URI string // not null terminated
+}
+
+var _ EfiDevicePathProtocol = (*DppMsgURI)(nil)
+
+// NewDppMsgURI returns a DppMsgURI for uri.
+func NewDppMsgURI(uri string) *DppMsgURI {
+	return &DppMsgURI{
+		Hdr: newDppHdr(DppTypeMessaging, EfiDevPathProtoSubType(DppMsgTypeURI), len(uri)),
+		URI: uri,
+	}
+}
+
+// ParseDppMsgURI parses input into a DppMsgURI.
+func ParseDppMsgURI(h EfiDevicePathProtocolHdr, b []byte) (*DppMsgURI, error) {
+	if len(b) != int(h.Length)-4 {
+		return nil, ErrParse
+	}
+	return &DppMsgURI{
+		Hdr: h,
+		URI: string(b),
+	}, nil
+}
+
+func (e *DppMsgURI) Header() EfiDevicePathProtocolHdr { return e.Hdr }
+
+// ProtoSubTypeStr returns the subtype as human readable.
+func (e *DppMsgURI) ProtoSubTypeStr() string {
+	return EfiDppMsgSubType(e.Hdr.ProtoSubType).String()
+}
+
+func (e *DppMsgURI) String() string {
+	return fmt.Sprintf("Uri(%s)", e.URI)
+}
+
+// Resolver returns a nil EfiPathSegmentResolver and ErrUnimpl. See the comment
+// associated with ErrUnimpl.
+func (e *DppMsgURI) Resolver() (EfiPathSegmentResolver, error) {
+	return nil, ErrUnimpl
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *DppMsgURI) MarshalBinary() ([]byte, error) {
+	return marshalDpp(e.Hdr, []byte(e.URI))
+}
@@ -8,6 +8,7 @@
 package boot
 
 import (
+	"net"
 	"testing"
 )
 
@@ -64,3 +65,100 @@ func TestParseDppMsgMAC(t *testing.T) {
 		t.Errorf("want %s got %s", wantp, gotp)
 	}
 }
+
+func TestDppMsgNetworkMarshal(t *testing.T) {
+	ip4 := NewDppMsgIPv4()
+	ip4.Protocol = 6
+	ip6 := NewDppMsgIPv6()
+	ip6.Protocol = 6
+	ip6.PrefixLength = 64
+	copy(ip6.GatewayIP[:], net.ParseIP("fe80::1"))
+	for _, tt := range []struct {
+		name    string
+		dpp     interface{ MarshalBinary() ([]byte, error) }
+		parse   func(EfiDevicePathProtocolHdr, []byte) (EfiDevicePathProtocol, error)
+		want    string
+		wantLen int
+	}{
+		{
+			name: "MAC",
+			dpp:  NewDppMsgMAC(net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}),
+			parse: func(h EfiDevicePathProtocolHdr, b []byte) (EfiDevicePathProtocol, error) {
+				return ParseDppMsgMAC(h, b)
+			},
+			want:    "MAC(525400123456)",
+			wantLen: 37,
+		},
+		{
+			name: "IPv4",
+			dpp:  ip4,
+			parse: func(h EfiDevicePathProtocolHdr, b []byte) (EfiDevicePathProtocol, error) {
+				return ParseDppMsgIPv4(h, b)
+			},
+			want:    "IPv4(0.0.0.0,TCP,DHCP,0.0.0.0,0.0.0.0,0.0.0.0)",
+			wantLen: 27,
+		},
+		{
+			name: "IPv6",
+			dpp:  ip6,
+			parse: func(h EfiDevicePathProtocolHdr, b []byte) (EfiDevicePathProtocol, error) {
+				return ParseDppMsgIPv6(h, b)
+			},
+			want:    "IPv6(::,TCP,StatefulAutoConfigure,::,fe80::1,64)",
+			wantLen: 60,
+		},
+		{
+			name: "URI",
+			dpp:  NewDppMsgURI("http://192.168.0.1/boot.efi"),
+			parse: func(h EfiDevicePathProtocolHdr, b []byte) (EfiDevicePathProtocol, error) {
+				return ParseDppMsgURI(h, b)
+			},
+			want:    "Uri(http://192.168.0.1/boot.efi)",
+			wantLen: 31,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.dpp.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != tt.wantLen {
+				t.Errorf("encoded length %d, want %d", len(b), tt.wantLen)
+			}
+			list, err := ParseFilePathList(append(b, 0x7f, 0xff, 0x04, 0x00))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].String() != tt.want {
+				t.Errorf("ParseFilePathList = %s, want %s", list, tt.want)
+			}
+			p, err := tt.parse(list[0].Header(), b[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.String() != tt.want {
+				t.Errorf("\nwant %s\n got %s", tt.want, p.String())
+			}
+		})
+	}
+}
+
+// Nodes written before UEFI 2.4 have no prefix length or gateway.
+func TestParseDppMsgIPv6Short(t *testing.T) {
+	in := make([]byte, 39)
+	copy(in[16:32], net.ParseIP("2001:db8::1"))
+	in[36] = 17
+	hdr := EfiDevicePathProtocolHdr{
+		ProtoType:    3,
+		ProtoSubType: 13,
+		Length:       uint16(len(in) + 4),
+	}
+	p, err := ParseDppMsgIPv6(hdr, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "IPv6(2001:db8::1,UDP,Static,::,::,0)"
+	if got := p.String(); want != got {
+		t.Errorf("\nwant %s\n got %s", want, got)
+	}
+}
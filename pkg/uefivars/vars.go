@@ -126,6 +126,18 @@ func DecodeUTF16(b []byte) (string, error) {
 	return ret.String(), nil
 }
 
+// EncodeUTF16 encodes the input as little endian utf16. It does not add a
+// null terminator.
+func EncodeUTF16(s string) []byte {
+	u16s := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u16s))
+	for i, u := range u16s {
+		b[2*i] = byte(u)
+		b[2*i+1] = byte(u >> 8)
+	}
+	return b
+}
+
 // BytesToU16 converts a []byte of length 2 to a uint16.
 func BytesToU16(b []byte) uint16 {
 	if len(b) != 2 {
@@ -0,0 +1,109 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package uevent reads the kernel's device events (uevents), both as they
+// happen from a netlink socket and by replaying those of the devices that
+// already exist from sysfs.
+package uevent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNotUevent is returned by Parse for messages that are not kernel
+// uevents, like those libudev sends on the same socket.
+var ErrNotUevent = errors.New("not a kernel uevent")
+
+// Event is a kernel uevent.
+type Event struct {
+	// Action is what happened, like "add", "remove", "change" or "bind".
+	Action string
+
+	// DevPath is the path of the device in sysfs, without /sys, like
+	// "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda".
+	DevPath string
+
+	// Subsystem is the subsystem of the device, like "block" or "usb".
+	Subsystem string
+
+	// Env holds all variables of the event, including ACTION, DEVPATH and
+	// SUBSYSTEM, and for example DEVNAME, MAJOR, MINOR and MODALIAS.
+	Env map[string]string
+}
+
+// Parse parses a uevent message as the kernel sends it on a netlink socket:
+// "action@devpath" followed by KEY=VALUE variables, all NUL terminated.
+func Parse(b []byte) (*Event, error) {
+	fields := bytes.Split(bytes.TrimRight(b, "\x00"), []byte{0})
+	action, devpath, ok := strings.Cut(string(fields[0]), "@")
+	if !ok || action == "" || !strings.HasPrefix(devpath, "/") {
+		return nil, fmt.Errorf("%w: header %q", ErrNotUevent, fields[0])
+	}
+
+	e := &Event{Env: make(map[string]string)}
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(string(f), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: variable %q", ErrNotUevent, f)
+		}
+		e.Env[k] = v
+	}
+	e.fill(action, devpath)
+	return e, nil
+}
+
+// fill sets Action, DevPath and Subsystem from Env, or Env from the given
+// action and devpath.
+func (e *Event) fill(action, devpath string) {
+	if _, ok := e.Env["ACTION"]; !ok {
+		e.Env["ACTION"] = action
+	}
+	if _, ok := e.Env["DEVPATH"]; !ok {
+		e.Env["DEVPATH"] = devpath
+	}
+	e.Action = e.Env["ACTION"]
+	e.DevPath = e.Env["DEVPATH"]
+	e.Subsystem = e.Env["SUBSYSTEM"]
+}
+
+// Bytes returns e in the format Parse reads.
+//
+// The variables are sorted after ACTION, DEVPATH and SUBSYSTEM, which the
+// kernel always sends first.
+func (e *Event) Bytes() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s@%s\x00", e.Action, e.DevPath)
+	fmt.Fprintf(&b, "ACTION=%s\x00DEVPATH=%s\x00", e.Action, e.DevPath)
+	if e.Subsystem != "" {
+		fmt.Fprintf(&b, "SUBSYSTEM=%s\x00", e.Subsystem)
+	}
+	keys := make([]string, 0, len(e.Env))
+	for k := range e.Env {
+		switch k {
+		case "ACTION", "DEVPATH", "SUBSYSTEM":
+		default:
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\x00", k, e.Env[k])
+	}
+	return b.Bytes()
+}
+
+// Environ returns the variables of e in the form "KEY=VALUE", for the
+// environment of a command.
+func (e *Event) Environ() []string {
+	var env []string
+	for k, v := range e.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
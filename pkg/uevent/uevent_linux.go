@@ -0,0 +1,134 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package uevent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// The kernel sends uevents to netlink multicast group 1; udevd resends them
+// to group 2.
+const kernelGroup = 1
+
+// The kernel drops events when the receive buffer is full, which happens
+// when many devices appear at once.
+const rcvBufSize = 1 << 20
+
+// Conn receives uevents from the kernel.
+type Conn struct {
+	fd  int
+	buf []byte
+}
+
+// Listen returns a Conn receiving the uevents the kernel sends from now on.
+func Listen() (*Conn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("uevent socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: kernelGroup}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("binding uevent socket: %w", err)
+	}
+	// Only root may force the size, others get what rmem_max allows.
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, rcvBufSize); err != nil {
+		_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, rcvBufSize)
+	}
+	return &Conn{fd: fd, buf: make([]byte, os.Getpagesize()*2)}, nil
+}
+
+// Read blocks until the kernel sends a uevent and returns it.
+//
+// Messages from user space processes on the same socket are skipped.
+func (c *Conn) Read() (*Event, error) {
+	for {
+		n, from, err := unix.Recvfrom(c.fd, c.buf, 0)
+		if errors.Is(err, unix.EINTR) || errors.Is(err, unix.ENOBUFS) {
+			// ENOBUFS means events were lost, nothing can be done
+			// about it.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading uevent: %w", err)
+		}
+		if nl, ok := from.(*unix.SockaddrNetlink); !ok || nl.Pid != 0 {
+			continue
+		}
+		e, err := Parse(c.buf[:n])
+		if errors.Is(err, ErrNotUevent) {
+			continue
+		}
+		return e, err
+	}
+}
+
+// Close closes the netlink socket.
+func (c *Conn) Close() error {
+	return unix.Close(c.fd)
+}
+
+// Coldplug calls f with synthetic "add" events for all devices under
+// sysRoot, usually /sys, as read from the uevent files in sysRoot/devices.
+// Parents come before their children.
+//
+// This replays the events of devices that appeared before anybody listened,
+// like those present at boot. Coldplug stops at the first error of f.
+func Coldplug(sysRoot string, f func(*Event) error) error {
+	root := filepath.Join(sysRoot, "devices")
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Devices may disappear during the walk.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		e, err := readEvent(p)
+		if err != nil || e == nil {
+			// Not a device, or one that went away.
+			return nil
+		}
+		rel, err := filepath.Rel(sysRoot, p)
+		if err != nil {
+			return err
+		}
+		e.fill("add", path.Join("/", filepath.ToSlash(rel)))
+		return f(e)
+	})
+}
+
+// readEvent reads the variables of the device in dir from its uevent file.
+// Directories that are no devices with a subsystem, which the kernel sends
+// no events for, are skipped with a nil Event.
+func readEvent(dir string) (*Event, error) {
+	subsystem, err := os.Readlink(filepath.Join(dir, "subsystem"))
+	if err != nil {
+		return nil, nil
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return nil, err
+	}
+	e := &Event{Env: map[string]string{"SUBSYSTEM": filepath.Base(subsystem)}}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if k, v, ok := bytes.Cut(s.Bytes(), []byte("=")); ok {
+			e.Env[string(k)] = string(v)
+		}
+	}
+	return e, s.Err()
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package uevent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sysDevice adds a device with the given subsystem and uevent file to the
+// fake sysfs at root.
+func sysDevice(t *testing.T, root, devpath, subsystem, uevent string) {
+	t.Helper()
+	dir := filepath.Join(root, devpath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if subsystem != "" {
+		if err := os.Symlink(filepath.Join(root, "bus", subsystem), filepath.Join(dir, "subsystem")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "uevent"), []byte(uevent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestColdplug(t *testing.T) {
+	root := t.TempDir()
+	sysDevice(t, root, "devices/pci0000:00", "", "")
+	sysDevice(t, root, "devices/pci0000:00/0000:00:1f.2", "pci", "DRIVER=ahci\nPCI_CLASS=10601\nMODALIAS=pci:v00008086d00002922sv00001AF4sd00001100bc01sc06i01\n")
+	sysDevice(t, root, "devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda", "block", "MAJOR=8\nMINOR=0\nDEVNAME=sda\nDEVTYPE=disk\n")
+
+	var got []*Event
+	if err := Coldplug(root, func(e *Event) error {
+		got = append(got, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []*Event{
+		{
+			Action:    "add",
+			DevPath:   "/devices/pci0000:00/0000:00:1f.2",
+			Subsystem: "pci",
+			Env: map[string]string{
+				"ACTION":    "add",
+				"DEVPATH":   "/devices/pci0000:00/0000:00:1f.2",
+				"SUBSYSTEM": "pci",
+				"DRIVER":    "ahci",
+				"PCI_CLASS": "10601",
+				"MODALIAS":  "pci:v00008086d00002922sv00001AF4sd00001100bc01sc06i01",
+			},
+		},
+		{
+			Action:    "add",
+			DevPath:   "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+			Subsystem: "block",
+			Env: map[string]string{
+				"ACTION":    "add",
+				"DEVPATH":   "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+				"SUBSYSTEM": "block",
+				"MAJOR":     "8",
+				"MINOR":     "0",
+				"DEVNAME":   "sda",
+				"DEVTYPE":   "disk",
+			},
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Coldplug replayed %d events, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("Coldplug event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	errStop := errors.New("stop")
+	if err := Coldplug(root, func(e *Event) error { return errStop }); !errors.Is(err, errStop) {
+		t.Errorf("Coldplug = %v, want %v", err, errStop)
+	}
+}
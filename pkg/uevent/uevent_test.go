@@ -0,0 +1,99 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package uevent
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		msg  string
+		want *Event
+		err  error
+	}{
+		{
+			name: "add disk",
+			msg:  "add@/devices/virtual/block/loop0\x00ACTION=add\x00DEVPATH=/devices/virtual/block/loop0\x00SUBSYSTEM=block\x00MAJOR=7\x00MINOR=0\x00DEVNAME=loop0\x00DEVTYPE=disk\x00SEQNUM=2711\x00",
+			want: &Event{
+				Action:    "add",
+				DevPath:   "/devices/virtual/block/loop0",
+				Subsystem: "block",
+				Env: map[string]string{
+					"ACTION":    "add",
+					"DEVPATH":   "/devices/virtual/block/loop0",
+					"SUBSYSTEM": "block",
+					"MAJOR":     "7",
+					"MINOR":     "0",
+					"DEVNAME":   "loop0",
+					"DEVTYPE":   "disk",
+					"SEQNUM":    "2711",
+				},
+			},
+		},
+		{
+			name: "header only",
+			msg:  "remove@/devices/platform/serial8250",
+			want: &Event{
+				Action:  "remove",
+				DevPath: "/devices/platform/serial8250",
+				Env: map[string]string{
+					"ACTION":  "remove",
+					"DEVPATH": "/devices/platform/serial8250",
+				},
+			},
+		},
+		{
+			name: "modalias with equal sign",
+			msg:  "bind@/devices/pci0000:00/0000:00:02.0\x00SUBSYSTEM=pci\x00MODALIAS=of:Nfoo=bar\x00",
+			want: &Event{
+				Action:    "bind",
+				DevPath:   "/devices/pci0000:00/0000:00:02.0",
+				Subsystem: "pci",
+				Env: map[string]string{
+					"ACTION":    "bind",
+					"DEVPATH":   "/devices/pci0000:00/0000:00:02.0",
+					"SUBSYSTEM": "pci",
+					"MODALIAS":  "of:Nfoo=bar",
+				},
+			},
+		},
+		{
+			name: "libudev",
+			msg:  "libudev\x00\xfe\xed\xca\xfe",
+			err:  ErrNotUevent,
+		},
+		{
+			name: "bad variable",
+			msg:  "add@/devices/foo\x00ACTION\x00",
+			err:  ErrNotUevent,
+		},
+		{
+			name: "relative devpath",
+			msg:  "add@devices/foo\x00",
+			err:  ErrNotUevent,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.msg))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			again, err := Parse(got.Bytes())
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("Parse(Bytes()) = %+v, %v, want %+v", again, err, got)
+			}
+		})
+	}
+}
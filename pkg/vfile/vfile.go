@@ -148,11 +148,6 @@ func OpenSignedFile(keyring openpgp.KeyRing, path, pathSig string, opts ...OpenS
 	if err != nil {
 		return nil, err
 	}
-	var o openSignedFileOptions
-	// Apply options if given.
-	for _, opt := range opts {
-		opt(&o)
-	}
 
 	signaturef, err := os.Open(pathSig)
 	if err != nil {
@@ -160,22 +155,37 @@ func OpenSignedFile(keyring openpgp.KeyRing, path, pathSig string, opts ...OpenS
 	}
 	defer signaturef.Close()
 
+	// After CheckDetachedSignature reads the whole file, seek back to the beginning.
+	defer f.Seek(0, os.SEEK_SET)
+
+	return f, CheckSignature(keyring, path, f, signaturef, opts...)
+}
+
+// CheckSignature checks that signature is a detached signature of data
+// made by a key in keyring. It returns ErrUnsigned with path if it is not.
+//
+// Unlike OpenSignedFile, it can check data that was already read into
+// memory, so that what is used later is what was verified.
+func CheckSignature(keyring openpgp.KeyRing, path string, data, signature io.Reader, opts ...OpenSignedFileOption) error {
+	var o openSignedFileOptions
+	// Apply options if given.
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var config packet.Config
 	if o.ignoreTimeConflict {
 		config.Time = getEndOfTime
 	}
 
-	// After CheckDetachedSignature reads the whole file, seek back to the beginning.
-	defer f.Seek(0, os.SEEK_SET)
-
 	if keyring == nil {
-		return f, ErrUnsigned{Path: path, Err: ErrNoKeyRing}
-	} else if signer, err := openpgp.CheckDetachedSignature(keyring, f, signaturef, &config); err != nil {
-		return f, ErrUnsigned{Path: path, Err: err}
+		return ErrUnsigned{Path: path, Err: ErrNoKeyRing}
+	} else if signer, err := openpgp.CheckDetachedSignature(keyring, data, signature, &config); err != nil {
+		return ErrUnsigned{Path: path, Err: err}
 	} else if signer == nil {
-		return f, ErrUnsigned{Path: path, Err: ErrWrongSigner{keyring}}
+		return ErrUnsigned{Path: path, Err: ErrWrongSigner{keyring}}
 	}
-	return f, nil
+	return nil
 }
 
 // ErrInvalidHash is returned when hash verification failed.
@@ -0,0 +1,113 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vpd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/u-root/u-root/pkg/flash"
+	"github.com/u-root/u-root/pkg/spidev"
+	"golang.org/x/sys/unix"
+)
+
+// mtdClass is where the MTD devices are in sysfs.
+var mtdClass = "/sys/class/mtd"
+
+// biosMTD is the name of the MTD device the intel-spi driver makes of the
+// flash chip of Intel chipsets.
+const biosMTD = "BIOS"
+
+// flashDevice returns FlashDevice, or else the intel-spi MTD device, or
+// else /dev/spidev0.0.
+func flashDevice() string {
+	if FlashDevice != "" {
+		return FlashDevice
+	}
+	names, _ := filepath.Glob(filepath.Join(mtdClass, "mtd*", "name"))
+	for _, n := range names {
+		dev := filepath.Base(filepath.Dir(n))
+		// mtd0ro is the read-only mtd0.
+		if strings.HasSuffix(dev, "ro") {
+			continue
+		}
+		if b, err := os.ReadFile(n); err == nil && strings.TrimSpace(string(b)) == biosMTD {
+			return filepath.Join("/dev", dev)
+		}
+	}
+	return "/dev/spidev0.0"
+}
+
+// mtd is an MTD device, like /dev/mtd0, which the kernel reads and writes
+// the flash chip through.
+type mtd struct {
+	*os.File
+	info unix.MtdInfo
+}
+
+func openMTD(name string) (*mtd, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	m := &mtd{File: f}
+	if err := m.ioctl(unix.MEMGETINFO, unsafe.Pointer(&m.info)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return m, nil
+}
+
+func (m *mtd) ioctl(req uint, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, m.Fd(), uintptr(req), uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Size returns the size of the device.
+func (m *mtd) Size() int64 {
+	return int64(m.info.Size)
+}
+
+// EraseAt erases n bytes from offset off. Both must be aligned to the
+// erase blocks of the device.
+func (m *mtd) EraseAt(n int64, off int64) (int64, error) {
+	bs := int64(m.info.Erasesize)
+	if bs == 0 || off%bs != 0 || n%bs != 0 || off < 0 || off+n > m.Size() {
+		return 0, fmt.Errorf("erasing %#x bytes at %#x of %s, of %#x byte erase blocks: %w", n, off, m.Name(), bs, os.ErrInvalid)
+	}
+	e := unix.EraseInfo{Start: uint32(off), Length: uint32(n)}
+	if err := m.ioctl(unix.MEMERASE, unsafe.Pointer(&e)); err != nil {
+		return 0, fmt.Errorf("erasing %#x bytes at %#x of %s: %w", n, off, m.Name(), err)
+	}
+	return n, nil
+}
+
+// openFlash opens the flash chip, and returns it, and a function to close
+// it.
+var openFlash = func() (Flash, func() error, error) {
+	dev := flashDevice()
+	if strings.HasPrefix(filepath.Base(dev), "mtd") {
+		m, err := openMTD(dev)
+		if err != nil {
+			return nil, nil, err
+		}
+		return m, m.Close, nil
+	}
+	spi, err := spidev.Open(dev)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := flash.New(spi)
+	if err != nil {
+		spi.Close()
+		return nil, nil, err
+	}
+	return f, spi.Close, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vpd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlashDevice(t *testing.T) {
+	defer func(c, d string) { mtdClass, FlashDevice = c, d }(mtdClass, FlashDevice)
+	mtdClass = t.TempDir()
+	FlashDevice = ""
+	if got := flashDevice(); got != "/dev/spidev0.0" {
+		t.Errorf("flashDevice() without MTD devices = %q, want /dev/spidev0.0", got)
+	}
+
+	for dev, name := range map[string]string{"mtd0": "other", "mtd1": "BIOS", "mtd1ro": "BIOS"} {
+		if err := os.MkdirAll(filepath.Join(mtdClass, dev), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(mtdClass, dev, "name"), []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := flashDevice(); got != "/dev/mtd1" {
+		t.Errorf("flashDevice() = %q, want the intel-spi /dev/mtd1", got)
+	}
+
+	FlashDevice = "/dev/spidev1.0"
+	if got := flashDevice(); got != FlashDevice {
+		t.Errorf("flashDevice() = %q, want FlashDevice %q", got, FlashDevice)
+	}
+}
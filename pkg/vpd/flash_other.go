@@ -0,0 +1,17 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package vpd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// openFlash opens the flash chip, which pkg/flash only can on Linux.
+var openFlash = func() (Flash, func() error, error) {
+	return nil, nil, fmt.Errorf("opening the flash chip: %w", errors.ErrUnsupported)
+}
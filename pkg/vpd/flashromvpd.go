@@ -5,143 +5,113 @@
 package vpd
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
-	"syscall"
 )
 
+// FlashDevice is the device of the flash chip VPD is in: an MTD device, like
+// /dev/mtd0, or a spidev device, like /dev/spidev0.0. If it is empty, the
+// MTD device the intel-spi driver makes of the flash chip of Intel
+// chipsets is used, or else /dev/spidev0.0.
+var FlashDevice string
+
+// Flash is the flash chip of this machine, like a *flash.Flash.
+type Flash interface {
+	Image
+	Size() int64
+}
+
 func handler(c <-chan os.Signal) {
 	for range c {
 		log.Printf("ignoring SIGINT during flash write to prevent corruption")
 	}
 }
 
-// Set RW_VPD key-value via flashrom and vpd executables, delete set to false would set or add the key,
-// delete set to true would delete an existing key.
-func FlashromRWVpdSet(key string, value []byte, delete bool) error {
-	file, err := os.CreateTemp("/tmp", "rwvpd*.bin")
+// updateFlash reads the VPD region name of the flash chip, an empty blob
+// if it has never been written, passes it to update, and writes it back.
+func updateFlash(name string, update func(*Blob) error) error {
+	f, closeFlash, err := openFlash()
 	if err != nil {
 		return err
 	}
-	defer os.Remove(file.Name())
-
-	c := make(chan os.Signal, 1)
-	go handler(c)
-	defer close(c)
-
-	cmd := exec.Command("flashrom", "-p", "internal:ich_spi_mode=hwseq", "-c", "Opaque flash chip", "--fmap", "-i", "RW_VPD", "-r", file.Name())
-	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
-	if err = cmd.Run(); err != nil {
-		log.Printf("flashrom failed to read RW_VPD: %v", err)
-		return err
-	}
-
-	if delete {
-		cmd = exec.Command("vpd", "-f", file.Name(), "-d", key)
-		if err = cmd.Run(); err != nil {
-			log.Printf("vpd failed to delete key: %v, err: %v", key, err)
-			return err
-		}
-	} else {
-		cmd = exec.Command("vpd", "-f", file.Name(), "-s", key+"="+string(value[:]))
-		if err = cmd.Run(); err != nil {
-			log.Printf("vpd failed to set key: %v value: %v, err: %v", key, string(value[:]), err)
-			return err
-		}
-	}
+	defer closeFlash()
 
-	cmd = exec.Command("flashrom", "-p", "internal:ich_spi_mode=hwseq", "-c", "Opaque flash chip", "--fmap", "-i", "RW_VPD", "--noverify-all", "-w", file.Name())
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
+	b, err := ReadRegion(f, f.Size(), name)
+	if errors.Is(err, ErrNoVPD) {
+		b, err = &Blob{}, nil
 	}
-	signal.Notify(c, syscall.SIGINT)
-	defer signal.Reset(syscall.SIGINT)
-	if err = cmd.Run(); err != nil {
-		log.Printf("flashrom failed to write RW_VPD: %v", err)
+	if err != nil {
 		return err
 	}
-	return nil
-}
-
-// ClearRwVpd re-format RW_VPD via flashrom and vpd executables
-func ClearRwVpd() error {
-	file, err := os.CreateTemp("/tmp", "rwvpd*.bin")
-	if err != nil {
+	if err := update(b); err != nil {
 		return err
 	}
-	defer os.Remove(file.Name())
 
 	c := make(chan os.Signal, 1)
 	go handler(c)
 	defer close(c)
-
-	log.Printf("Reading RW_VPD...")
-	cmd := exec.Command("flashrom", "-p", "internal:ich_spi_mode=hwseq", "-c", "Opaque flash chip", "--fmap", "-i", "RW_VPD", "-r", file.Name())
-	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
-	if err = cmd.Run(); err != nil {
-		log.Printf("flashrom failed to read RW_VPD: %v", err)
-		return err
-	}
-	cmd = exec.Command("vpd", "-f", file.Name(), "-O")
-	if err = cmd.Run(); err != nil {
-		log.Printf("vpd failed to re-format RW_VPD: %v", err)
-		return err
-	}
-	cmd = exec.Command("flashrom", "-p", "internal:ich_spi_mode=hwseq", "-c", "Opaque flash chip", "--fmap", "-i", "RW_VPD", "--noverify-all", "-w", file.Name())
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
-	}
-	signal.Notify(c, syscall.SIGINT)
-	defer signal.Reset(syscall.SIGINT)
-	if err = cmd.Run(); err != nil {
-		log.Printf("flashrom failed to write RW_VPD: %v", err)
-		return err
-	}
-	return nil
+	signal.Notify(c, os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+	return WriteRegion(f, f.Size(), name, b)
 }
 
-// FlashromVpdDump read and dump all VPD values from RO and RW VPD flash regions directly
-func FlashromVpdDump() error {
-	file, err := os.CreateTemp("/tmp", "rovpd*.bin")
+// ReadFlash reads the VPD region name, like RO_VPD, of the flash chip.
+func ReadFlash(name string) (*Blob, error) {
+	f, closeFlash, err := openFlash()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer os.Remove(file.Name())
+	defer closeFlash()
+	return ReadRegion(f, f.Size(), name)
+}
 
-	log.Printf("RO_VPD values:")
-	cmd := exec.Command("flashrom", "-p", "internal:ich_spi_mode=hwseq", "-c", "Opaque flash chip", "--fmap", "-i", "RO_VPD", "-r", file.Name())
-	if err = cmd.Run(); err != nil {
-		log.Printf("flashrom failed to read RO_VPD: %v", err)
-		return err
-	}
-	cmd = exec.Command("vpd", "-f", file.Name(), "-l")
-	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
-	if err = cmd.Run(); err != nil {
-		log.Printf("vpd failed to print RO_VPD: %v", err)
-		return err
-	}
+// FlashromRWVpdSet sets key to value in RW_VPD of the flash chip, or
+// deletes it.
+func FlashromRWVpdSet(key string, value []byte, delete bool) error {
+	return updateFlash(RW_VPD, func(b *Blob) error {
+		if !delete {
+			b.Set(key, value)
+			return nil
+		}
+		if !b.Delete(key) {
+			return fmt.Errorf("deleting %q from %s: %w", key, RW_VPD, os.ErrNotExist)
+		}
+		return nil
+	})
+}
 
-	os.Remove(file.Name())
-	file, err = os.CreateTemp("/tmp", "rwvpd*.bin")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(file.Name())
+// ClearRwVpd deletes all keys of RW_VPD of the flash chip.
+func ClearRwVpd() error {
+	log.Printf("Clearing RW_VPD...")
+	return updateFlash(RW_VPD, func(b *Blob) error {
+		b.Entries = nil
+		return nil
+	})
+}
 
-	log.Printf("RW_VPD values:")
-	cmd = exec.Command("flashrom", "-p", "internal:ich_spi_mode=hwseq", "-c", "Opaque flash chip", "--fmap", "-i", "RW_VPD", "-r", file.Name())
-	if err = cmd.Run(); err != nil {
-		log.Printf("flashrom failed to read RW_VPD: %v", err)
-		return err
-	}
-	cmd = exec.Command("vpd", "-f", file.Name(), "-l")
-	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
-	if err = cmd.Run(); err != nil {
-		log.Printf("vpd failed to print RW_VPD: %v", err)
-		return err
+func dump(w io.Writer) error {
+	for _, name := range []string{RO_VPD, RW_VPD} {
+		b, err := ReadFlash(name)
+		if errors.Is(err, ErrNoVPD) {
+			b, err = &Blob{}, nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s values:\n", name)
+		for _, e := range b.Entries {
+			fmt.Fprintf(w, "\"%s\"=\"%s\"\n", e.Key, e.Value)
+		}
 	}
-
 	return nil
 }
+
+// FlashromVpdDump prints the keys of RO_VPD and RW_VPD of the flash chip,
+// as vpd -l does.
+func FlashromVpdDump() error {
+	return dump(os.Stdout)
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vpd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/coreboot"
+)
+
+// VPD regions, areas of the flash map.
+const (
+	RO_VPD = "RO_VPD"
+	RW_VPD = "RW_VPD"
+)
+
+// Image is a firmware image with a flash map, like a *flash.Flash, or a
+// ROM file.
+type Image interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// eraser is flash, like *flash.Flash, which must be erased before it is
+// written.
+type eraser interface {
+	EraseAt(n int64, off int64) (int64, error)
+}
+
+// ReadRegion reads the VPD 2.0 blob of the region name, like RO_VPD, of a
+// firmware image of size bytes.
+func ReadRegion(r io.ReaderAt, size int64, name string) (*Blob, error) {
+	f, err := coreboot.ReadFMAP(r, size)
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.ReadArea(r, name)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := ParseBlob(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return blob, nil
+}
+
+// WriteRegion writes b to the region name, like RW_VPD, of a firmware
+// image of size bytes, which is erased first if it is flash.
+func WriteRegion(img Image, size int64, name string, b *Blob) error {
+	f, err := coreboot.ReadFMAP(img, size)
+	if err != nil {
+		return err
+	}
+	a, err := f.Area(name)
+	if err != nil {
+		return err
+	}
+	r, err := b.MarshalRegion(int(a.Size))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if e, ok := img.(eraser); ok {
+		if _, err := e.EraseAt(int64(a.Size), int64(a.Offset)); err != nil {
+			return fmt.Errorf("erasing %s: %w", name, err)
+		}
+	}
+	if _, err := img.WriteAt(r, int64(a.Offset)); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
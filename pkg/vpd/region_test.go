@@ -0,0 +1,169 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vpd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/u-root/u-root/pkg/coreboot"
+)
+
+// testFlash is NOR flash in memory: writes only clear bits, so what is
+// written must be erased first.
+type testFlash struct {
+	b      []byte
+	erased int
+}
+
+func (f *testFlash) ReadAt(b []byte, off int64) (int, error) {
+	return bytes.NewReader(f.b).ReadAt(b, off)
+}
+
+func (f *testFlash) WriteAt(b []byte, off int64) (int, error) {
+	for i, c := range b {
+		f.b[off+int64(i)] &= c
+	}
+	return len(b), nil
+}
+
+func (f *testFlash) EraseAt(n int64, off int64) (int64, error) {
+	copy(f.b[off:off+n], bytes.Repeat([]byte{0xff}, int(n)))
+	f.erased++
+	return n, nil
+}
+
+func (f *testFlash) Size() int64 {
+	return int64(len(f.b))
+}
+
+// genFlash generates a 64K image whose RO_VPD has a serial number, and
+// whose RW_VPD has never been written.
+func genFlash(t *testing.T) *testFlash {
+	t.Helper()
+	f := &testFlash{b: bytes.Repeat([]byte{0xff}, 0x10000)}
+	m := &coreboot.FMAP{
+		VerMajor: 1,
+		Size:     0x10000,
+		Name:     "FLASH",
+		Areas: []coreboot.FMAPArea{
+			{Offset: 0, Size: 0x1000, Name: "FMAP"},
+			{Offset: 0x4000, Size: 0x4000, Name: RO_VPD, Flags: coreboot.FMAP_AREA_RO},
+			{Offset: 0x8000, Size: 0x2000, Name: RW_VPD},
+		},
+	}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(f.b, b)
+	ro, err := (&Blob{Entries: []Entry{{Key: "serial_number", Value: []byte("SN1234")}}}).MarshalRegion(0x4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(f.b[0x4000:], ro)
+	return f
+}
+
+func TestRegion(t *testing.T) {
+	f := genFlash(t)
+	ro, err := ReadRegion(f, f.Size(), RO_VPD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ro.Get("serial_number"); !ok || string(v) != "SN1234" {
+		t.Errorf("RO_VPD serial_number = %q, %v, want SN1234", v, ok)
+	}
+	if _, err := ReadRegion(f, f.Size(), RW_VPD); !errors.Is(err, ErrNoVPD) {
+		t.Errorf("ReadRegion(RW_VPD) = %v, want %v", err, ErrNoVPD)
+	}
+
+	for _, entries := range [][]Entry{
+		{{Key: "Boot0001", Value: []byte("first")}},
+		{{Key: "Boot0002", Value: []byte("second, where the first was")}},
+	} {
+		if err := WriteRegion(f, f.Size(), RW_VPD, &Blob{Entries: entries}); err != nil {
+			t.Fatal(err)
+		}
+		rw, err := ReadRegion(f, f.Size(), RW_VPD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(entries, rw.Entries); diff != "" {
+			t.Errorf("RW_VPD (-want, +got): %s", diff)
+		}
+	}
+	if f.erased != 2 {
+		t.Errorf("RW_VPD was erased %d times, want 2", f.erased)
+	}
+	if !bytes.Equal(f.b[0xa000:], bytes.Repeat([]byte{0xff}, 0x6000)) {
+		t.Errorf("WriteRegion(RW_VPD) wrote past RW_VPD")
+	}
+
+	if err := WriteRegion(f, f.Size(), "RW_NVRAM", &Blob{}); !errors.Is(err, coreboot.ErrNoFMAPArea) {
+		t.Errorf("WriteRegion(RW_NVRAM) = %v, want %v", err, coreboot.ErrNoFMAPArea)
+	}
+	big := &Blob{Entries: []Entry{{Key: "big", Value: make([]byte, 0x2000)}}}
+	if err := WriteRegion(f, f.Size(), RW_VPD, big); !errors.Is(err, ErrVPDFull) {
+		t.Errorf("WriteRegion(big) = %v, want %v", err, ErrVPDFull)
+	}
+	if _, err := ReadRegion(&testFlash{b: make([]byte, 0x1000)}, 0x1000, RO_VPD); !errors.Is(err, coreboot.ErrNoFMAP) {
+		t.Errorf("ReadRegion(no flash map) = %v, want %v", err, coreboot.ErrNoFMAP)
+	}
+}
+
+func TestFlashromRWVpdSet(t *testing.T) {
+	f := genFlash(t)
+	closed := 0
+	defer func(o func() (Flash, func() error, error)) { openFlash = o }(openFlash)
+	openFlash = func() (Flash, func() error, error) {
+		return f, func() error { closed++; return nil }, nil
+	}
+
+	for _, tt := range []struct {
+		key    string
+		value  string
+		delete bool
+		err    error
+	}{
+		{key: "Boot0001", value: "localboot"},
+		{key: "systemboot_log_level", value: "6"},
+		{key: "Boot0001", value: "netboot"},
+		{key: "systemboot_log_level", delete: true},
+		{key: "none", delete: true, err: os.ErrNotExist},
+	} {
+		if err := FlashromRWVpdSet(tt.key, []byte(tt.value), tt.delete); !errors.Is(err, tt.err) {
+			t.Errorf("FlashromRWVpdSet(%q, %q, %v) = %v, want %v", tt.key, tt.value, tt.delete, err, tt.err)
+		}
+	}
+	var b bytes.Buffer
+	if err := dump(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "RO_VPD values:\n\"serial_number\"=\"SN1234\"\nRW_VPD values:\n\"Boot0001\"=\"netboot\"\n"; got != want {
+		t.Errorf("dump() = %q, want %q", got, want)
+	}
+
+	if err := ClearRwVpd(); err != nil {
+		t.Fatal(err)
+	}
+	rw, err := ReadFlash(RW_VPD)
+	if err != nil || len(rw.Entries) != 0 {
+		t.Errorf("ReadFlash(RW_VPD) = %v, %v, want no entries", rw, err)
+	}
+	if closed != 9 {
+		t.Errorf("flash closed %d times, want 9", closed)
+	}
+
+	openFlash = func() (Flash, func() error, error) {
+		return nil, nil, os.ErrNotExist
+	}
+	if err := FlashromRWVpdSet("a", nil, false); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("FlashromRWVpdSet(no flash) = %v, want %v", err, os.ErrNotExist)
+	}
+}
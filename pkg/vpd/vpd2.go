@@ -0,0 +1,167 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Types of VPD 2.0 entries.
+const (
+	VPD_TYPE_TERMINATOR          = 0x00
+	VPD_TYPE_STRING              = 0x01
+	VPD_TYPE_INFO                = 0xfe
+	VPD_TYPE_IMPLICIT_TERMINATOR = 0xff
+)
+
+// VPDInfoMagic starts the Google VPD info header, which is itself an
+// entry, of type VPD_TYPE_INFO, whose key is the info version, 1, and
+// "gVpdInfo", and whose value, 4 bytes, is the size of the entries after it.
+const VPDInfoMagic = "\xfe\x09\x01gVpdInfo\x04"
+
+// vpdInfoSize is the size of the Google VPD info header.
+const vpdInfoSize = len(VPDInfoMagic) + 4
+
+// Errors of VPD 2.0 blobs.
+var (
+	ErrNoVPD   = errors.New("no VPD info header")
+	ErrBadVPD  = errors.New("bad VPD")
+	ErrVPDFull = errors.New("VPD does not fit")
+)
+
+// Entry is a VPD key and its value.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// Blob is the VPD 2.0 blob of a VPD region, like RO_VPD or RW_VPD: a Google
+// VPD info header, and entries of a type, a key and a value, of lengths
+// encoded 7 bits a byte, most significant first, in which the top bit says
+// more follow. Its entries are kept in order.
+type Blob struct {
+	Entries []Entry
+}
+
+// Get returns the value of key.
+func (b *Blob) Get(key string) ([]byte, bool) {
+	for _, e := range b.Entries {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets key to value, where key is, or after the other entries.
+func (b *Blob) Set(key string, value []byte) {
+	for i, e := range b.Entries {
+		if e.Key == key {
+			b.Entries[i].Value = value
+			return
+		}
+	}
+	b.Entries = append(b.Entries, Entry{Key: key, Value: value})
+}
+
+// Delete deletes key, and returns whether it was there.
+func (b *Blob) Delete(key string) bool {
+	for i, e := range b.Entries {
+		if e.Key == key {
+			b.Entries = append(b.Entries[:i], b.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func decodeLen(b []byte) (int, int, error) {
+	var n int
+	for i, c := range b {
+		// 4 bytes are 28 bits, more than VPD regions have.
+		if i == 4 {
+			break
+		}
+		n = n<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			return n, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: bad length", ErrBadVPD)
+}
+
+func appendLen(b []byte, n int) []byte {
+	l := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		l = append([]byte{byte(n&0x7f) | 0x80}, l...)
+	}
+	return append(b, l...)
+}
+
+// ParseBlob parses the VPD 2.0 blob at the start of region. A region
+// which has never been written has no info header, and ErrNoVPD is
+// returned.
+func ParseBlob(region []byte) (*Blob, error) {
+	if len(region) < vpdInfoSize || string(region[:len(VPDInfoMagic)]) != VPDInfoMagic {
+		return nil, ErrNoVPD
+	}
+	size := binary.LittleEndian.Uint32(region[len(VPDInfoMagic):])
+	if uint64(size) > uint64(len(region)-vpdInfoSize) {
+		return nil, fmt.Errorf("%w: %d bytes in a %d byte region", ErrBadVPD, size, len(region))
+	}
+	b := &Blob{}
+	for d := region[vpdInfoSize : vpdInfoSize+int(size)]; len(d) > 0; {
+		typ := d[0]
+		if typ == VPD_TYPE_TERMINATOR || typ == VPD_TYPE_IMPLICIT_TERMINATOR {
+			break
+		}
+		d = d[1:]
+		var kv [2][]byte
+		for i := range kv {
+			n, l, err := decodeLen(d)
+			if err != nil {
+				return nil, err
+			}
+			if l+n > len(d) {
+				return nil, fmt.Errorf("%w: entry of %d bytes in %d", ErrBadVPD, n, len(d)-l)
+			}
+			kv[i], d = d[l:l+n], d[l+n:]
+		}
+		switch typ {
+		case VPD_TYPE_STRING:
+			b.Entries = append(b.Entries, Entry{Key: string(kv[0]), Value: append([]byte{}, kv[1]...)})
+		case VPD_TYPE_INFO:
+		default:
+			return nil, fmt.Errorf("%w: entry of type %#x", ErrBadVPD, typ)
+		}
+	}
+	return b, nil
+}
+
+// MarshalRegion encodes the blob as a region of size bytes, padded with
+// 0xff, as erased flash is.
+func (b *Blob) MarshalRegion(size int) ([]byte, error) {
+	d := []byte{}
+	for _, e := range b.Entries {
+		if e.Key == "" {
+			return nil, fmt.Errorf("%w: empty key", ErrBadVPD)
+		}
+		d = append(d, VPD_TYPE_STRING)
+		d = append(appendLen(d, len(e.Key)), e.Key...)
+		d = append(appendLen(d, len(e.Value)), e.Value...)
+	}
+	d = append(d, VPD_TYPE_TERMINATOR)
+	if vpdInfoSize+len(d) > size {
+		return nil, fmt.Errorf("%w: %d bytes in a %d byte region", ErrVPDFull, vpdInfoSize+len(d), size)
+	}
+	r := bytes.Repeat([]byte{0xff}, size)
+	copy(r, VPDInfoMagic)
+	binary.LittleEndian.PutUint32(r[len(VPDInfoMagic):], uint32(len(d)))
+	copy(r[vpdInfoSize:], d)
+	return r, nil
+}
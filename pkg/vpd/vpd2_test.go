@@ -0,0 +1,113 @@
+// Copyright 2024 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vpd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBlob(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 200)
+	b := &Blob{Entries: []Entry{
+		{Key: "serial_number", Value: []byte("SN1234")},
+		{Key: "Boot0001", Value: []byte(`{"type":"localboot","method":"grub"}`)},
+		{Key: "long", Value: long},
+		{Key: "empty", Value: []byte{}},
+	}}
+	r, err := b.MarshalRegion(0x400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 0x400 || r[0x3ff] != 0xff {
+		t.Errorf("MarshalRegion() is %d bytes ending in %#x, want 0x400 ending in 0xff", len(r), r[len(r)-1])
+	}
+	// The header, and the first entry.
+	want := append([]byte(VPDInfoMagic), 0x1e, 0x01, 0x00, 0x00)
+	want = append(want, append([]byte{VPD_TYPE_STRING, 13}, "serial_number\x06SN1234"...)...)
+	if !bytes.HasPrefix(r, want) {
+		t.Errorf("MarshalRegion() = % x, want it to start with % x", r[:len(want)], want)
+	}
+	// A value of 200 bytes has a length of 2 bytes.
+	if !bytes.Contains(r, append([]byte("\x04long\x81\x48"), long...)) {
+		t.Errorf("MarshalRegion() does not encode a length of 200 as 81 48")
+	}
+
+	got, err := ParseBlob(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(b, got); diff != "" {
+		t.Errorf("ParseBlob() (-want, +got): %s", diff)
+	}
+
+	b.Set("serial_number", []byte("SN5678"))
+	b.Set("new", []byte("1"))
+	if !b.Delete("long") || b.Delete("none") {
+		t.Errorf("Delete() did not delete only what was there")
+	}
+	if v, ok := b.Get("serial_number"); !ok || string(v) != "SN5678" {
+		t.Errorf("Get(serial_number) = %q, %v, want SN5678", v, ok)
+	}
+	if _, ok := b.Get("long"); ok {
+		t.Errorf("Get(long) found a deleted key")
+	}
+	var keys []string
+	for _, e := range b.Entries {
+		keys = append(keys, e.Key)
+	}
+	if diff := cmp.Diff([]string{"serial_number", "Boot0001", "empty", "new"}, keys); diff != "" {
+		t.Errorf("keys (-want, +got): %s", diff)
+	}
+
+	if _, err := b.MarshalRegion(0x40); !errors.Is(err, ErrVPDFull) {
+		t.Errorf("MarshalRegion(0x40) = %v, want %v", err, ErrVPDFull)
+	}
+	if _, err := (&Blob{Entries: []Entry{{}}}).MarshalRegion(0x40); !errors.Is(err, ErrBadVPD) {
+		t.Errorf("MarshalRegion(empty key) = %v, want %v", err, ErrBadVPD)
+	}
+}
+
+func TestParseBlob(t *testing.T) {
+	header := func(size byte) []byte {
+		return append([]byte(VPDInfoMagic), size, 0, 0, 0)
+	}
+	for _, tt := range []struct {
+		name   string
+		region []byte
+		want   *Blob
+		err    error
+	}{
+		{name: "erased", region: bytes.Repeat([]byte{0xff}, 0x100), err: ErrNoVPD},
+		{name: "short", region: []byte(VPDInfoMagic), err: ErrNoVPD},
+		{name: "empty", region: append(header(1), VPD_TYPE_TERMINATOR), want: &Blob{}},
+		{
+			name:   "implicit terminator",
+			region: append(header(0x10), "\x01\x01a\x01b\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"...),
+			want:   &Blob{Entries: []Entry{{Key: "a", Value: []byte("b")}}},
+		},
+		{
+			name:   "info",
+			region: append(header(0xb), "\xfe\x01i\x01j\x01\x01a\x01b\x00"...),
+			want:   &Blob{Entries: []Entry{{Key: "a", Value: []byte("b")}}},
+		},
+		{name: "too big", region: append(header(0x10), 0), err: ErrBadVPD},
+		{name: "truncated", region: append(header(4), "\x01\x05ab\x00"...), err: ErrBadVPD},
+		{name: "bad length", region: append(header(6), "\x01\xff\xff\xff\xff\x00"...), err: ErrBadVPD},
+		{name: "bad type", region: append(header(6), "\x07\x01a\x01b\x00"...), err: ErrBadVPD},
+	} {
+		got, err := ParseBlob(tt.region)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: ParseBlob() = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: ParseBlob() (-want, +got): %s", tt.name, diff)
+		}
+	}
+}
@@ -132,17 +132,43 @@ func addBootEntry(cfg systembooter.Booter, vpdDir string) error {
 	}
 	vpdReader := vpd.NewReader()
 	vpdReader.VpdDir = vpdDir
+	exists := func(key string) (bool, error) {
+		_, err := vpdReader.Get(key, false)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	write := func(key string) error {
+		return vpdReader.Set(key, data, false)
+	}
+	if vpdDir == vpd.DefaultVpdDir {
+		// The kernel's VPD can not be written, and is as it was at
+		// boot, so look for a free entry in flash, and write it there.
+		b, err := vpd.ReadFlash(vpd.RW_VPD)
+		if errors.Is(err, vpd.ErrNoVPD) {
+			b, err = &vpd.Blob{}, nil
+		}
+		if err != nil {
+			return err
+		}
+		exists = func(key string) (bool, error) {
+			_, ok := b.Get(key)
+			return ok, nil
+		}
+		write = func(key string) error {
+			return vpd.FlashromRWVpdSet(key, data, false)
+		}
+	}
 	for i := 1; i < vpd.MaxBootEntry; i++ {
 		key := fmt.Sprintf("Boot%04d", i)
-		if _, err := vpdReader.Get(key, false); err != nil {
-			if os.IsNotExist(err) {
-				if err := vpdReader.Set(key, data, false); err != nil {
-					return err
-				}
-				return nil
-			}
+		ok, err := exists(key)
+		if err != nil {
 			return err
 		}
+		if !ok {
+			return write(key)
+		}
 	}
 	return errors.New("maximum number of boot entries already set")
 }
@@ -5,8 +5,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+
+	"github.com/u-root/u-root/pkg/vpd"
 )
 
 func getUsage(progname string) string {
@@ -38,6 +41,12 @@ Flags for localboot:
 Global flags:
 
 -vpd-dir - VPD dir to use
+-flash - flash device, before the action, like -flash /dev/mtd0 set, an
+	MTD or spidev device. Defaults to the intel-spi MTD device, or
+	/dev/spidev0.0
+
+set, delete, dump, and add without -vpd-dir, read and write the RO_VPD and
+RW_VPD areas of the flash chip directly.
 
 `, progname, progname, progname, progname, progname)
 }
@@ -51,6 +60,12 @@ func main() {
 }
 
 func cli(args []string) error {
+	flg := flag.NewFlagSet("vpdbootmanager", flag.ContinueOnError)
+	flg.StringVar(&vpd.FlashDevice, "flash", vpd.FlashDevice, "flash device")
+	if err := flg.Parse(args); err != nil {
+		return err
+	}
+	args = flg.Args()
 	if len(args) < 1 {
 		return fmt.Errorf("you need to provide action")
 	}
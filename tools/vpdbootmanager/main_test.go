@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/u-root/u-root/pkg/boot/systembooter"
+	"github.com/u-root/u-root/pkg/vpd"
 )
 
 func TestInvalidCommand(t *testing.T) {
@@ -19,6 +20,16 @@ func TestInvalidCommand(t *testing.T) {
 	}
 }
 
+func TestFlashFlag(t *testing.T) {
+	defer func(d string) { vpd.FlashDevice = d }(vpd.FlashDevice)
+	if err := cli([]string{"-flash", "/dev/mtd1", "unknown"}); err == nil {
+		t.Errorf("cli(unknown) = nil, want an error")
+	}
+	if vpd.FlashDevice != "/dev/mtd1" {
+		t.Errorf("FlashDevice = %q, want /dev/mtd1", vpd.FlashDevice)
+	}
+}
+
 func TestNoEntryType(t *testing.T) {
 	if err := cli([]string{"add", "localboot"}); err.Error() != "you need to provide method" {
 		t.Errorf(`err.Error() = %q, want "you need to provide method"`, err.Error())